@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/utils"
+)
+
+// runAppend implements "append": it backs up late-arriving sources and adds
+// them to an existing archive, merging their items into its manifest. The
+// archive's compressed data is kept as is; only the new entries and a new
+// footer are written.
+func runAppend(args []string, stdout, stderr io.Writer) int {
+	appendCmd := flag.NewFlagSet("append", flag.ContinueOnError)
+	archivePath := appendCmd.String("archive", "", "Existing archive to add to")
+	sources := appendCmd.String("source", "", "Comma-separated source files or directories to back up into the archive")
+	method := appendCmd.String("method", constants.MethodCheckpoint, "Backup method for RocksDB sources")
+	signKey := appendCmd.String("sign-key", "", "Ed25519 private key (PEM) to re-sign the archive with; required when the archive is signed")
+	logLevel := appendCmd.String("log-level", "info", "Log level")
+	tmpDir := appendCmd.String("tmp-dir", "", "Directory the new items are backed up in before they are appended (default: $TMPDIR or /tmp)")
+	if err := appendCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+
+	var sourcePaths []string
+	for _, source := range strings.Split(*sources, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sourcePaths = append(sourcePaths, source)
+		}
+	}
+	if *archivePath == "" || len(sourcePaths) == 0 {
+		fmt.Fprintln(stderr, "Usage: archiveFiles append -archive=existing.tar.gz -source=/new/dir[,/other] [-method=method] [-sign-key=key.pem]")
+		return 1
+	}
+
+	// A signature over the old footer would no longer match
+	signaturePath := *archivePath + compress.SignatureSuffix
+	if _, err := os.Stat(signaturePath); err == nil && *signKey == "" {
+		fmt.Fprintf(stderr, "Error: %s is signed; pass -sign-key to re-sign it after appending\n", *archivePath)
+		return 1
+	}
+
+	data, err := compress.ReadEntry(*archivePath, manifest.FileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+	archiveManifest, err := manifest.Parse(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: failed to parse the manifest of %s: %v\n", *archivePath, err)
+		return 1
+	}
+
+	cfg := config.GetDefaultConfig()
+	cfg.SourcePaths = sourcePaths
+	cfg.Method = *method
+	cfg.LogLevel = *logLevel
+	cfg.TmpDir = *tmpDir
+	cfg.Compress = false
+	for _, source := range sourcePaths {
+		if info, err := os.Stat(source); err == nil && info.IsDir() {
+			cfg.BatchMode = true
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "Configuration validation failed: %v\n", err)
+		return 1
+	}
+
+	utils.SetTmpDir(cfg.TmpDir)
+	workDir, err := utils.MkdirTemp(constants.TmpPrefix + "append-")
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to create work directory: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(workDir)
+	cfg.BackupPath = filepath.Join(workDir, "backup")
+	initLogger(cfg)
+
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "Backup failed: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+	if result.Failed > 0 {
+		fmt.Fprintf(stderr, "Error: %d item(s) failed to back up; %s was left unchanged\n", result.Failed, *archivePath)
+		return 1
+	}
+
+	// The merged manifest is appended again and supersedes the old one
+	manifestPath := filepath.Join(result.BackupPath, manifest.FileName)
+	appended, err := manifest.Load(manifestPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	archiveManifest.Merge(appended)
+	if err := archiveManifest.Write(manifestPath); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	footer, err := compress.AppendDirectory(*archivePath, result.BackupPath, []string{manifest.FileName}, compress.Options{Durability: cfg.Durability, EntryChecksums: cfg.EntryChecksums})
+	if err != nil {
+		fmt.Fprintf(stderr, "Append failed: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+
+	if *signKey != "" {
+		privateKey, err := compress.LoadPrivateKey(*signKey)
+		if err == nil {
+			_, err = compress.SignArchive(*archivePath, privateKey)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: appended, but failed to re-sign the archive: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(stdout, "Appended %d item(s) to %s (%d entries)\n", len(appended.Items), *archivePath, footer.EntryCount)
+	return 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+func TestRunAppend(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "nightly")
+	lateDir := filepath.Join(tempDir, "late")
+	for dir, name := range map[string]string{sourceDir: "a.log", lateDir: "b.log"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("log line from "+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(tempDir, "backup"),
+		ArchivePath:  filepath.Join(tempDir, "nightly.tar.gz"),
+		Compress:     true,
+		BatchMode:    true,
+		Method:       constants.MethodCheckpoint,
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+
+	// A signed archive is only appended to when it can be re-signed
+	signaturePath := result.ArchivePath + compress.SignatureSuffix
+	if err := os.WriteFile(signaturePath, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	args := []string{"-archive", result.ArchivePath, "-source", lateDir, "-log-level", "error"}
+	if code := runAppend(args, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "-sign-key") {
+		t.Fatalf("exit code = %d, stderr %q; want a refusal for the signed archive", code, stderr.String())
+	}
+	os.Remove(signaturePath)
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runAppend(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "Appended 1 item(s)") {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+
+	targetDir := filepath.Join(tempDir, "restored")
+	if _, err := compress.ExtractArchive(result.ArchivePath, targetDir); err != nil {
+		t.Fatalf("Appended archive does not extract: %v", err)
+	}
+	for _, relPath := range []string{"nightly/a.log", "late/b.log"} {
+		if _, err := os.Stat(filepath.Join(targetDir, relPath)); err != nil {
+			t.Errorf("%s missing from the appended archive: %v", relPath, err)
+		}
+	}
+
+	merged, err := manifest.Load(filepath.Join(targetDir, manifest.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Items) != 2 || len(merged.AppendedRuns) != 1 || merged.RunID != result.RunID {
+		t.Errorf("merged manifest has %d items, appended runs %v, run ID %s; want 2 items, 1 appended run and the original run ID",
+			len(merged.Items), merged.AppendedRuns, merged.RunID)
+	}
+
+	// Appending the same source again would collide with its entries
+	if code := runAppend(args, &stdout, &stderr); code != 1 {
+		t.Errorf("exit code = %d, want 1 for a source already in the archive", code)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/approval"
+	"archiveFiles/internal/audit"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+)
+
+// runApproveRestore implements "approve-restore": the approver signs a
+// token allowing one archive of a protected namespace to be restored
+func runApproveRestore(args []string, stdout, stderr io.Writer) int {
+	approveCmd := flag.NewFlagSet("approve-restore", flag.ExitOnError)
+	archivePath := approveCmd.String("archive", "", "Archive to approve the restore of")
+	mirrorTarget := approveCmd.String("mirror", "", "Mirrored run to approve the restore of instead of an archive: user@host:/path of the run, or of the mirror target for its latest run")
+	sshCommand := approveCmd.String("ssh", "ssh", "SSH command used with -mirror, including options")
+	keyPath := approveCmd.String("key", "", "Approver's Ed25519 private key (PKCS#8 PEM)")
+	valid := approveCmd.Duration("valid", constants.ApprovalValidityHours*time.Hour, "How long the token stays valid")
+	approver := approveCmd.String("approver", os.Getenv("USER"), "Approver name recorded in the restore audit log")
+	if err := approveCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if (*archivePath == "") == (*mirrorTarget == "") || *keyPath == "" || *valid <= 0 {
+		fmt.Fprintln(stderr, "Usage: archiveFiles approve-restore -archive=archive_path -key=approver.pem [-valid=24h] [-approver=name]")
+		fmt.Fprintln(stderr, "       archiveFiles approve-restore -mirror=user@host:/path -key=approver.pem [-ssh=command] [-valid=24h] [-approver=name]")
+		return 1
+	}
+
+	key, err := compress.LoadPrivateKey(*keyPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	var namespace, digest string
+	if *mirrorTarget != "" {
+		var source *mirrorSource
+		if source, err = openMirror(strings.Fields(*sshCommand), *mirrorTarget); err == nil {
+			namespace, digest, err = source.namespace()
+			*archivePath = source.runDir
+		}
+	} else {
+		namespace, digest, err = archiveNamespace(*archivePath)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+	if digest == "" {
+		fmt.Fprintf(stderr, "Error: %s is a legacy archive without a manifest; it needs no approval\n", *archivePath)
+		return 1
+	}
+
+	claims := approval.Claims{
+		Archive:        filepath.Base(*archivePath),
+		Namespace:      namespace,
+		ManifestSHA256: digest,
+		Approver:       *approver,
+		Expires:        time.Now().Add(*valid).UTC().Truncate(time.Second),
+	}
+	token, err := approval.Issue(claims, key)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Approved restoring %s (namespace %q) until %s\n", *archivePath, namespace, claims.Expires.Format(time.RFC3339))
+	fmt.Fprintln(stdout, token)
+	return 0
+}
+
+// readArchiveManifest returns the manifest.json of an archive, or nil for
+// legacy archives, which predate manifests
+func readArchiveManifest(archivePath string) ([]byte, error) {
+	switch {
+	case compress.IsIndexed(archivePath):
+		return compress.ReadEntry(filepath.Join(archivePath, compress.RootMemberName), manifest.FileName)
+	case compress.IsLegacy(archivePath):
+		return nil, nil
+	default:
+		return compress.ReadEntry(archivePath, manifest.FileName)
+	}
+}
+
+// archiveNamespace returns the namespace recorded in the manifest of an
+// archive and the manifest's digest, which approval tokens are bound to.
+// Legacy archives predate manifests and namespaces and return neither.
+func archiveNamespace(archivePath string) (string, string, error) {
+	data, err := readArchiveManifest(archivePath)
+	if err != nil || data == nil {
+		return "", "", err
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse the manifest of %s: %v", archivePath, err)
+	}
+	return m.Namespace, approval.ManifestDigest(data), nil
+}
+
+// restoreGuard enforces the restore approval settings of a config and
+// records restore attempts in its audit log. The zero guard allows every
+// restore and records nothing.
+type restoreGuard struct {
+	protected map[string]bool
+	publicKey ed25519.PublicKey
+	writer    audit.Writer
+}
+
+// loadRestoreGuard reads the restore approval settings from configFile, or
+// from the default config when it is empty. Without a config every restore
+// is allowed.
+func loadRestoreGuard(configFile string) (*restoreGuard, error) {
+	cfg, err := loadOptionalConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return newRestoreGuard(cfg)
+}
+
+// loadOptionalConfig reads configFile, or the default config when it is
+// empty, for subcommands that only need a few settings from it. Without a
+// config it returns an empty one.
+func loadOptionalConfig(configFile string) (*types.Config, error) {
+	if configFile == "" {
+		configFile = config.FindDefaultConfig()
+	}
+	if configFile == "" {
+		return &types.Config{}, nil
+	}
+	return config.LoadConfigFromJSON(configFile)
+}
+
+// newRestoreGuard returns the guard for the restore approval settings of cfg
+func newRestoreGuard(cfg *types.Config) (*restoreGuard, error) {
+	if err := cfg.ValidateRestoreApproval(); err != nil {
+		return nil, err
+	}
+	guard := &restoreGuard{protected: make(map[string]bool), writer: audit.Writer{Path: cfg.AuditLogPath(), Syslog: cfg.AuditSyslog}}
+	for _, namespace := range cfg.RestoreApprovalNamespaces {
+		guard.protected[namespace] = true
+	}
+	if cfg.RestoreApprovalPubKey != "" {
+		var err error
+		if guard.publicKey, err = compress.LoadPublicKey(cfg.RestoreApprovalPubKey); err != nil {
+			return nil, err
+		}
+	}
+	// Refuse to restore rather than restore without a trace
+	if guard.writer.Path != "" {
+		if err := audit.CheckWritable(guard.writer.Path); err != nil {
+			return nil, err
+		}
+	}
+	return guard, nil
+}
+
+// authorize checks that archivePath may be restored into targetDir with
+// token and returns the audit record of the attempt. A denied attempt is
+// recorded before the error is returned.
+func (g *restoreGuard) authorize(archivePath, targetDir, token string, stderr io.Writer) (audit.Record, error) {
+	return g.authorizeSource(archivePath, targetDir, token, func() (string, string, error) {
+		return archiveNamespace(archivePath)
+	}, stderr)
+}
+
+// authorizeSource is authorize for a backup that is not necessarily an
+// archive, such as a mirror; namespaceOf returns its namespace and the
+// digest of its manifest
+func (g *restoreGuard) authorizeSource(source, targetDir, token string, namespaceOf func() (string, string, error), stderr io.Writer) (audit.Record, error) {
+	record := audit.NewRecord("restore")
+	record.Archive = source
+	record.Target = targetDir
+	if len(g.protected) == 0 {
+		return record, nil
+	}
+
+	namespace, digest, err := namespaceOf()
+	record.Namespace = namespace
+	if err == nil && g.protected[namespace] {
+		var claims *approval.Claims
+		if claims, err = approval.Verify(token, g.publicKey, namespace, digest, time.Now()); err == nil {
+			record.Approver = claims.Approver
+			fmt.Fprintf(stderr, "Restore of namespace %q approved by %s until %s\n", namespace, claims.Approver, claims.Expires.Format(time.RFC3339))
+		}
+	}
+	if err != nil {
+		record.Result = audit.ResultDenied
+		record.Error = err.Error()
+		g.record(record, stderr)
+		return record, err
+	}
+	return record, nil
+}
+
+// finish records the outcome of an authorized restore
+func (g *restoreGuard) finish(record audit.Record, err error, stderr io.Writer) {
+	record.Finish(err)
+	g.record(record, stderr)
+}
+
+// record sends record to the audit log, if one is configured. An audited
+// invocation writes it as part of its finish record instead, so that each
+// restore is recorded once.
+func (g *restoreGuard) record(record audit.Record, stderr io.Writer) {
+	if audited != nil {
+		audited.recordOutcome(record)
+		return
+	}
+	if !g.writer.Enabled() {
+		return
+	}
+	if err := g.writer.Write(record); err != nil {
+		fmt.Fprintf(stderr, "Warning: %v\n", err)
+	}
+}
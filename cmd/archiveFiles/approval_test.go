@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/audit"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/manifest"
+)
+
+// createNamespaceArchive compresses a backup of one file whose manifest
+// records namespace
+func createNamespaceArchive(t *testing.T, dir, name, namespace string) string {
+	t.Helper()
+	backupDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Join(backupDir, namespace, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, namespace, "data", "records.csv"), []byte("id,name\n1,a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New("copy")
+	m.Namespace = namespace
+	if err := m.Write(filepath.Join(backupDir, manifest.FileName)); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(dir, name+".tar.gz")
+	if err := compress.CompressDirectory(backupDir, archivePath); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+// writeApprovalConfig writes an approver key pair and a config protecting
+// the pii namespace, and returns the config and private key paths
+func writeApprovalConfig(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath := filepath.Join(dir, "approver.pem")
+	publicPath := filepath.Join(dir, "approver.pub.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := map[string]interface{}{
+		"restore_approval_namespaces": []string{"pii"},
+		"restore_approval_pubkey":     publicPath,
+		"audit_log":                   filepath.Join(dir, "audit.jsonl"),
+	}
+	data, _ := json.Marshal(cfg)
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, privatePath
+}
+
+// readAuditLog returns the records of the audit log at path
+func readAuditLog(t *testing.T, path string) []audit.Record {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []audit.Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record audit.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Line %q is not a record: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRunRestoreArchive_Approval(t *testing.T) {
+	dir := t.TempDir()
+	configPath, keyPath := writeApprovalConfig(t, dir)
+	protected := createNamespaceArchive(t, dir, "pii-backup", "pii")
+	other := createNamespaceArchive(t, dir, "pii-backup-2", "pii")
+	open := createNamespaceArchive(t, dir, "ops-backup", "ops")
+	t.Setenv("ARCHIVEFILES_APPROVAL_TOKEN", "")
+
+	// Without a token the protected archive is refused before extraction
+	target := filepath.Join(dir, "restored")
+	var stdout, stderr bytes.Buffer
+	code := runRestoreArchive([]string{"-config", configPath, "-archive", protected, "-target", target}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "requires an approval token") {
+		t.Fatalf("exit code = %d, want 1 with a missing token error; stderr: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("A denied restore should extract nothing, stat: %v", err)
+	}
+
+	// A token for another run of the same namespace does not carry over
+	stdout.Reset()
+	stderr.Reset()
+	if code := runApproveRestore([]string{"-archive", other, "-key", keyPath, "-approver", "alice"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("approve-restore exit code = %d; stderr: %s", code, stderr.String())
+	}
+	otherToken := strings.TrimSpace(stdout.String())
+	stdout.Reset()
+	stderr.Reset()
+	code = runRestoreArchive([]string{"-config", configPath, "-archive", protected, "-target", target, "-approval-token", otherToken}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "another archive") {
+		t.Fatalf("exit code = %d, want 1 with a wrong archive error; stderr: %s", code, stderr.String())
+	}
+
+	// The approved archive restores with its token from the environment
+	stdout.Reset()
+	stderr.Reset()
+	if code := runApproveRestore([]string{"-archive", protected, "-key", keyPath, "-approver", "alice"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("approve-restore exit code = %d; stderr: %s", code, stderr.String())
+	}
+	t.Setenv("ARCHIVEFILES_APPROVAL_TOKEN", strings.TrimSpace(stdout.String()))
+	stdout.Reset()
+	stderr.Reset()
+	code = runRestoreArchive([]string{"-config", configPath, "-archive", protected, "-target", target}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0; stderr: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(target, "pii", "data", "records.csv")); err != nil {
+		t.Errorf("Restored file missing: %v", err)
+	}
+
+	// Unprotected namespaces need no token
+	stdout.Reset()
+	stderr.Reset()
+	t.Setenv("ARCHIVEFILES_APPROVAL_TOKEN", "")
+	code = runRestoreArchive([]string{"-config", configPath, "-archive", open, "-target", filepath.Join(dir, "ops")}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0; stderr: %s", code, stderr.String())
+	}
+
+	records := readAuditLog(t, filepath.Join(dir, "audit.jsonl"))
+	if len(records) != 4 {
+		t.Fatalf("Got %d audit records, want 4: %+v", len(records), records)
+	}
+	for i, want := range []string{audit.ResultDenied, audit.ResultDenied, audit.ResultOK, audit.ResultOK} {
+		if records[i].Result != want || records[i].Operation != "restore" {
+			t.Errorf("Record %d = %+v, want result %s", i, records[i], want)
+		}
+	}
+	if records[2].Approver != "alice" || records[2].Namespace != "pii" || records[2].Target != target {
+		t.Errorf("Unexpected approved record %+v", records[2])
+	}
+	if records[3].Namespace != "ops" || records[3].Approver != "" {
+		t.Errorf("Unexpected unprotected record %+v", records[3])
+	}
+}
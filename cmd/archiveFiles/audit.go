@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"archiveFiles/internal/audit"
+	"archiveFiles/internal/config"
+)
+
+// exit ends the process; main replaces it to record the exit code of
+// audited commands first
+var exit = os.Exit
+
+// audited is the audit run of this invocation, or nil when it is not
+// audited
+var audited *auditRun
+
+// auditedCommands maps the commands recorded in the audit log to their
+// operation. A run without a command is a backup.
+var auditedCommands = map[string]string{
+	"":                "backup",
+	"remote-backup":   "backup",
+	"append":          "append",
+	"verify":          "verify",
+	"verify-archive":  "verify",
+	"drill":           "drill",
+	"restore":         "restore",
+	"restore-archive": "restore",
+	"gc":              "gc",
+}
+
+// secretFlags are the flags whose values are left out of audit records
+var secretFlags = map[string]bool{
+	"approval-token": true,
+}
+
+// redacted replaces secret flag values in audit records
+const redacted = "REDACTED"
+
+// auditRun is an invocation of an audited command
+type auditRun struct {
+	writer  audit.Writer
+	record  audit.Record
+	started time.Time
+	stderr  io.Writer
+	once    sync.Once
+	outcome *audit.Record // Outcome the command recorded, such as a restore with its namespace and approver
+}
+
+// startAudit records the start of the command in args when it is audited
+// and the config (-config, else the default config) names an audit log or
+// syslog, and returns the run to finish on exit. Otherwise it returns nil.
+func startAudit(args []string, stderr io.Writer) *auditRun {
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+	}
+	operation, ok := auditedCommands[command]
+	if !ok {
+		return nil
+	}
+
+	configFile := configArg(args)
+	if configFile == "" {
+		configFile = config.FindDefaultConfig()
+	}
+	if configFile == "" {
+		return nil
+	}
+	cfg, err := config.LoadConfigFromJSON(configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Warning: audit log disabled: %v\n", err)
+		return nil
+	}
+	writer := audit.Writer{Path: cfg.AuditLogPath(), Syslog: cfg.AuditSyslog}
+	if !writer.Enabled() {
+		return nil
+	}
+
+	run := &auditRun{writer: writer, record: audit.NewRecord(operation), started: time.Now(), stderr: stderr}
+	run.record.Args = redactArgs(args)
+	run.record.Result = audit.ResultStarted
+	run.write(run.record)
+	return run
+}
+
+// recordOutcome keeps the outcome of the operation for the finish record,
+// so that a restore is one record with its archive, namespace and approver
+func (r *auditRun) recordOutcome(outcome audit.Record) {
+	r.outcome = &outcome
+}
+
+// finish records the exit code of the command, with the outcome it
+// recorded, if any. Only the first call counts.
+func (r *auditRun) finish(code int) {
+	r.once.Do(func() {
+		record := r.record
+		record.Time = time.Now().UTC()
+		record.Duration = time.Since(r.started).Seconds()
+		record.ExitCode = code
+		record.Result = audit.ResultOK
+		if code != 0 {
+			record.Result = audit.ResultFailed
+		}
+		if outcome := r.outcome; outcome != nil {
+			record.Archive, record.Target = outcome.Archive, outcome.Target
+			record.Namespace, record.Approver = outcome.Namespace, outcome.Approver
+			record.Error = outcome.Error
+			if outcome.Result != audit.ResultOK {
+				record.Result = outcome.Result
+			}
+		}
+		r.write(record)
+	})
+}
+
+// exit finishes the run and ends the process with code
+func (r *auditRun) exit(code int) {
+	r.finish(code)
+	os.Exit(code)
+}
+
+// write sends record to the audit destinations; a failure is only a
+// warning, the command itself is not affected
+func (r *auditRun) write(record audit.Record) {
+	if err := r.writer.Write(record); err != nil {
+		fmt.Fprintf(r.stderr, "Warning: %v\n", err)
+	}
+}
+
+// configArg returns the value of the -config flag in args, or ""
+func configArg(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// redactArgs returns a copy of args with the values of secret flags
+// replaced
+func redactArgs(args []string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i, arg := range result {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !secretFlags[name] {
+			continue
+		}
+		if hasValue {
+			result[i] = arg[:strings.Index(arg, "=")+1] + redacted
+		} else if i+1 < len(result) {
+			result[i+1] = redacted
+		}
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"archiveFiles/internal/audit"
+)
+
+func TestStartAudit(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.jsonl")
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"audit_log": "`+logPath+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if run := startAudit([]string{"lock", "-config", configPath}, &stderr); run != nil {
+		t.Error("lock should not be audited")
+	}
+
+	args := []string{"restore-archive", "-config", configPath, "-archive", "backup.tar.gz", "-approval-token=secret"}
+	run := startAudit(args, &stderr)
+	if run == nil {
+		t.Fatalf("restore-archive should be audited; stderr: %s", stderr.String())
+	}
+	run.finish(1)
+	run.finish(0)
+
+	records := readAuditLog(t, logPath)
+	if len(records) != 2 {
+		t.Fatalf("Got %d audit records, want 2: %+v", len(records), records)
+	}
+	started, finished := records[0], records[1]
+	if started.Result != audit.ResultStarted || started.Operation != "restore" || started.User == "" || started.PID != os.Getpid() {
+		t.Errorf("Unexpected started record %+v", started)
+	}
+	wantArgs := []string{"restore-archive", "-config", configPath, "-archive", "backup.tar.gz", "-approval-token=REDACTED"}
+	if !reflect.DeepEqual(started.Args, wantArgs) {
+		t.Errorf("Args = %q, want %q", started.Args, wantArgs)
+	}
+	if finished.Result != audit.ResultFailed || finished.ExitCode != 1 || finished.Time.Before(started.Time) {
+		t.Errorf("Unexpected finished record %+v", finished)
+	}
+
+	// A backup run is a run without a command
+	run = startAudit([]string{"-config=" + configPath, "-source", "/data"}, &stderr)
+	if run == nil {
+		t.Fatal("A backup run should be audited")
+	}
+	run.finish(0)
+	records = readAuditLog(t, logPath)
+	if last := records[len(records)-1]; last.Operation != "backup" || last.Result != audit.ResultOK {
+		t.Errorf("Unexpected backup record %+v", last)
+	}
+}
+
+func TestAuditRun_RestoreOutcome(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.jsonl")
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"restore_audit_log": "`+logPath+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restore_audit_log of older configs is the audit log, and a
+	// denied restore is one finish record carrying the guard's details
+	var stderr bytes.Buffer
+	run := startAudit([]string{"restore-archive", "-config", configPath}, &stderr)
+	if run == nil {
+		t.Fatalf("restore-archive should be audited; stderr: %s", stderr.String())
+	}
+	defer func(previous *auditRun) { audited = previous }(audited)
+	audited = run
+
+	guard := &restoreGuard{writer: audit.Writer{Path: logPath}}
+	denied := audit.NewRecord("restore")
+	denied.Archive, denied.Namespace = "backup.tar.gz", "pii"
+	denied.Result, denied.Error = audit.ResultDenied, "requires an approval token"
+	guard.record(denied, &stderr)
+	run.finish(1)
+
+	records := readAuditLog(t, logPath)
+	if len(records) != 2 {
+		t.Fatalf("Got %d audit records, want started and finished: %+v", len(records), records)
+	}
+	finished := records[1]
+	if finished.Result != audit.ResultDenied || finished.ExitCode != 1 || finished.Archive != "backup.tar.gz" || finished.Namespace != "pii" || finished.Error == "" || len(finished.Args) == 0 {
+		t.Errorf("Unexpected finished record %+v", finished)
+	}
+}
+
+func TestAuditedCommands_FlagErrorsReturn(t *testing.T) {
+	// Audited commands return on a bad flag instead of exiting, so their
+	// finish record is written
+	var stdout, stderr bytes.Buffer
+	if code := runGC([]string{"-no-such-flag"}, &stdout, &stderr); code != 1 {
+		t.Errorf("gc exit code = %d, want 1", code)
+	}
+	if code := runRestoreArchive([]string{"-no-such-flag"}, &stdout, &stderr); code != 1 {
+		t.Errorf("restore-archive exit code = %d, want 1", code)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"restore", "-pick", "--approval-token", "secret", "-target", "/srv"}
+	got := redactArgs(args)
+	want := []string{"restore", "-pick", "--approval-token", "REDACTED", "-target", "/srv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactArgs = %q, want %q", got, want)
+	}
+	if args[3] != "secret" {
+		t.Error("redactArgs modified its argument")
+	}
+}
+
+func TestConfigArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-config", "a.json"}, "a.json"},
+		{[]string{"gc", "--config=b.json"}, "b.json"},
+		{[]string{"-source", "config"}, ""},
+		{[]string{"-config"}, ""},
+	}
+	for _, tt := range tests {
+		if got := configArg(tt.args); got != tt.want {
+			t.Errorf("configArg(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// interactive is set when stdin is a terminal someone can answer prompts
+// on. Scheduled runs (daemon and Kubernetes modes) clear it.
+var interactive bool
+
+// Where prompts are answered and asked; replaced in tests
+var (
+	promptInput  io.Reader = os.Stdin
+	promptOutput io.Writer = os.Stderr
+)
+
+// stdinIsTerminal reports whether stdin is a terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks question before a destructive operation and reports whether
+// to go ahead. With -yes, or when nobody can answer (e.g. under cron), it
+// goes ahead without asking.
+func confirm(question string, yes bool) bool {
+	if yes || !interactive {
+		return true
+	}
+	fmt.Fprintf(promptOutput, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(promptInput).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// refuseSourceLike returns an error when removing or replacing path could
+// destroy data it was not meant to: path is the filesystem root or the home
+// directory, or it is or contains one of sources. -yes does not override it.
+func refuseSourceLike(path string, sources []string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %v", path, err)
+	}
+	if absPath == filepath.Dir(absPath) {
+		return fmt.Errorf("refusing to touch %s: it is the filesystem root", path)
+	}
+	if home, err := os.UserHomeDir(); err == nil && absPath == filepath.Clean(home) {
+		return fmt.Errorf("refusing to touch %s: it is the home directory", path)
+	}
+	for _, source := range sources {
+		if strings.HasPrefix(source, constants.DockerVolumeScheme) {
+			continue
+		}
+		if utils.IsWithin(source, absPath) {
+			return fmt.Errorf("refusing to touch %s: it holds source %s", path, source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// answerPrompts makes confirm ask and read answers from input for the rest
+// of the test, returning what it asked
+func answerPrompts(t *testing.T, input string) *bytes.Buffer {
+	var asked bytes.Buffer
+	interactive, promptInput, promptOutput = true, strings.NewReader(input), &asked
+	t.Cleanup(func() {
+		interactive, promptInput, promptOutput = false, os.Stdin, os.Stderr
+	})
+	return &asked
+}
+
+func TestConfirm(t *testing.T) {
+	if !confirm("Remove everything?", false) {
+		t.Error("Without a terminal confirm should go ahead")
+	}
+
+	tests := map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false}
+	for input, want := range tests {
+		asked := answerPrompts(t, input)
+		if got := confirm("Remove everything?", false); got != want {
+			t.Errorf("confirm with answer %q = %v, want %v", input, got, want)
+		}
+		if asked.String() != "Remove everything? [y/N] " {
+			t.Errorf("Asked %q", asked.String())
+		}
+	}
+
+	asked := answerPrompts(t, "n\n")
+	if !confirm("Remove everything?", true) || asked.Len() != 0 {
+		t.Errorf("-yes should go ahead without asking, asked %q", asked.String())
+	}
+}
+
+func TestRefuseSourceLike(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "data", "app")
+	sources := []string{source, "docker-volume://db"}
+
+	for _, path := range []string{"/", dir, filepath.Join(dir, "data"), source + "/"} {
+		if err := refuseSourceLike(path, sources); err == nil {
+			t.Errorf("Expected %s to be refused", path)
+		}
+	}
+	for _, path := range []string{filepath.Join(dir, "backup"), filepath.Join(source, "backups"), filepath.Join(dir, "data", "application")} {
+		if err := refuseSourceLike(path, sources); err != nil {
+			t.Errorf("Expected %s to be allowed, got: %v", path, err)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := refuseSourceLike(home, nil); err == nil || !strings.Contains(err.Error(), "home directory") {
+			t.Errorf("Expected the home directory to be refused, got: %v", err)
+		}
+	}
+}
+
+func TestRunGC_Declined(t *testing.T) {
+	dir := t.TempDir()
+	orphan := filepath.Join(dir, "backup_1")
+	if err := os.Mkdir(orphan, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeOldRunMarker(t, orphan, "aaaa1111", time.Now().Add(-10*24*time.Hour))
+
+	asked := answerPrompts(t, "n\n")
+	var stdout, stderr bytes.Buffer
+	if code := runGC([]string{"-path=" + dir}, &stdout, &stderr); code != 1 {
+		t.Fatalf("runGC exit code = %d, want 1 when declined; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(asked.String(), "Remove 1 leftover(s)") {
+		t.Errorf("Asked %q", asked.String())
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Errorf("Declined gc removed %s: %v", orphan, err)
+	}
+
+	if code := runGC([]string{"-path=" + dir, "-yes"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("runGC -yes exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("gc -yes should remove %s, stat error: %v", orphan, err)
+	}
+}
+
+func TestConfirmSwap(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "live")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+
+	if confirmSwap(target, filepath.Join(target, "backup.tar.gz"), false, true, &stderr) {
+		t.Error("A swap replacing the directory holding the archive should be refused, even with -yes")
+	}
+	if !confirmSwap(filepath.Join(dir, "new"), filepath.Join(dir, "backup.tar.gz"), false, false, &stderr) {
+		t.Error("Restoring into a new directory needs no confirmation")
+	}
+
+	asked := answerPrompts(t, "n\n")
+	if confirmSwap(target, filepath.Join(dir, "backup.tar.gz"), false, false, &stderr) {
+		t.Error("A declined swap should not go ahead")
+	}
+	if !strings.Contains(asked.String(), "live.old") {
+		t.Errorf("Asked %q", asked.String())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/types"
+)
+
+// assignConsistencyGroups marks the databases discovered in sourcePath,
+// walked at scanPath, that belong to a consistency group. Members are named
+// by their path in the source, so a database scanned from a snapshot is
+// still found.
+func assignConsistencyGroups(groups []types.ConsistencyGroup, sourcePath, scanPath string, databases []types.DatabaseInfo) {
+	if len(groups) == 0 {
+		return
+	}
+	groupOf := make(map[string]string)
+	for _, group := range groups {
+		for _, path := range group.Paths {
+			groupOf[filepath.Clean(path)] = group.Name
+		}
+	}
+	for i, db := range databases {
+		path := db.Path
+		if relPath, err := filepath.Rel(scanPath, db.Path); err == nil {
+			path = filepath.Join(sourcePath, relPath)
+		}
+		if name, ok := groupOf[path]; ok {
+			databases[i].ConsistencyGroup = name
+		} else if name, ok := groupOf[filepath.Clean(db.Path)]; ok {
+			databases[i].ConsistencyGroup = name
+		}
+	}
+}
+
+// checkConsistencyGroups warns about groups of which discovery found fewer
+// members than configured; the members found are still backed up together
+func checkConsistencyGroups(groups []types.ConsistencyGroup, databases []types.DatabaseInfo) {
+	found := make(map[string]int)
+	for _, db := range databases {
+		if db.ConsistencyGroup != "" {
+			found[db.ConsistencyGroup]++
+		}
+	}
+	for _, group := range groups {
+		if found[group.Name] < len(group.Paths) {
+			logger.Warning("Consistency group %s: found %d of its %d database(s)", group.Name, found[group.Name], len(group.Paths))
+		}
+	}
+}
+
+// jobUnits splits the scheduled databases into the units a worker takes at
+// once: every member of a consistency group in one unit, at the position of
+// its first member, and every other database on its own
+func jobUnits(databases []types.DatabaseInfo) [][]types.DatabaseInfo {
+	var units [][]types.DatabaseInfo
+	groupUnit := make(map[string]int)
+	for _, db := range databases {
+		if db.ConsistencyGroup == "" {
+			units = append(units, []types.DatabaseInfo{db})
+			continue
+		}
+		if i, ok := groupUnit[db.ConsistencyGroup]; ok {
+			units[i] = append(units[i], db)
+			continue
+		}
+		groupUnit[db.ConsistencyGroup] = len(units)
+		units = append(units, []types.DatabaseInfo{db})
+	}
+	return units
+}
+
+// runGroupHook runs the pre or post hook of group with sh, telling it the
+// group and the backup directory through the environment. The hook is not
+// cancelled with the run: an application paused by the pre hook must
+// always be resumed by the post hook.
+func runGroupHook(group types.ConsistencyGroup, hook, command, backupPath string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"ARCHIVEFILES_CONSISTENCY_GROUP="+group.Name,
+		"ARCHIVEFILES_BACKUP_PATH="+backupPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s hook of consistency group %s failed: %v: %s", hook, group.Name, err, output)
+	}
+	return nil
+}
+
+// processGroup backs up the members of group with process, one after the
+// other, between the group's hooks. When the pre hook fails no member is
+// backed up and fail records the error for all of them.
+func processGroup(group types.ConsistencyGroup, members []types.DatabaseInfo, backupPath string, dryRun bool, process func(types.DatabaseInfo), fail func(error)) {
+	if group.PreHook != "" {
+		if dryRun {
+			logger.Info("[DRY RUN] Would run the pre hook of consistency group %s", group.Name)
+		} else if err := runGroupHook(group, "pre", group.PreHook, backupPath); err != nil {
+			logger.Error("%v", err)
+			fail(err)
+			return
+		}
+	}
+
+	started := time.Now()
+	for _, db := range members {
+		process(db)
+	}
+	logger.Info("Consistency group %s: backed up %d database(s) in %s", group.Name, len(members), time.Since(started).Round(time.Millisecond))
+
+	if group.PostHook != "" {
+		if dryRun {
+			logger.Info("[DRY RUN] Would run the post hook of consistency group %s", group.Name)
+		} else if err := runGroupHook(group, "post", group.PostHook, backupPath); err != nil {
+			logger.Warning("%v", err)
+		}
+	}
+}
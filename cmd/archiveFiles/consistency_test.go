@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/types"
+)
+
+func TestJobUnits(t *testing.T) {
+	databases := []types.DatabaseInfo{
+		{Name: "a"},
+		{Name: "store", ConsistencyGroup: "app"},
+		{Name: "b"},
+		{Name: "meta.db", ConsistencyGroup: "app"},
+		{Name: "c"},
+	}
+	var got []string
+	for _, unit := range jobUnits(databases) {
+		names := make([]string, len(unit))
+		for i, db := range unit {
+			names[i] = db.Name
+		}
+		got = append(got, strings.Join(names, "+"))
+	}
+	if want := "a store+meta.db b c"; strings.Join(got, " ") != want {
+		t.Errorf("jobUnits = %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestAssignConsistencyGroups(t *testing.T) {
+	groups := []types.ConsistencyGroup{{Name: "app", Paths: []string{"/data/app/store", "/data/app/meta.db"}}}
+	databases := []types.DatabaseInfo{
+		{Name: "app/store", Path: "/snapshot/data/app/store"},
+		{Name: "app/meta.db", Path: "/snapshot/data/app/meta.db"},
+		{Name: "other.db", Path: "/snapshot/data/other.db"},
+	}
+	// Members are matched by their path in the source, not in the snapshot
+	assignConsistencyGroups(groups, "/data", "/snapshot/data", databases)
+	for i, want := range []string{"app", "app", ""} {
+		if databases[i].ConsistencyGroup != want {
+			t.Errorf("%s: group = %q, want %q", databases[i].Name, databases[i].ConsistencyGroup, want)
+		}
+	}
+}
+
+func TestProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	hookLog := filepath.Join(dir, "hooks.log")
+	group := types.ConsistencyGroup{
+		Name:     "app",
+		PreHook:  `echo "pre $ARCHIVEFILES_CONSISTENCY_GROUP" >> ` + hookLog,
+		PostHook: `echo "post $ARCHIVEFILES_BACKUP_PATH" >> ` + hookLog,
+	}
+	members := []types.DatabaseInfo{{Name: "store"}, {Name: "meta.db"}}
+
+	var processed []string
+	process := func(db types.DatabaseInfo) {
+		data, _ := os.ReadFile(hookLog)
+		processed = append(processed, db.Name+" after "+strings.TrimSpace(string(data)))
+	}
+	processGroup(group, members, dir, false, process, func(err error) {
+		t.Errorf("Unexpected failure: %v", err)
+	})
+	if want := []string{"store after pre app", "meta.db after pre app"}; strings.Join(processed, ",") != strings.Join(want, ",") {
+		t.Errorf("processed = %q, want %q", processed, want)
+	}
+	if data, err := os.ReadFile(hookLog); err != nil || string(data) != "pre app\npost "+dir+"\n" {
+		t.Errorf("hook log = %q, %v", data, err)
+	}
+
+	// A failing pre hook fails the group without backing up any member,
+	// and the post hook is not run for a group that never started
+	os.Remove(hookLog)
+	processed = nil
+	group.PreHook = "echo paused >&2; exit 3"
+	var failed error
+	processGroup(group, members, dir, false, process, func(err error) { failed = err })
+	if failed == nil || !strings.Contains(failed.Error(), "pre hook of consistency group app failed") || !strings.Contains(failed.Error(), "paused") {
+		t.Errorf("failure = %v, want the pre hook and its output reported", failed)
+	}
+	if len(processed) != 0 {
+		t.Errorf("processed = %q after a failed pre hook, want none", processed)
+	}
+	if _, err := os.Stat(hookLog); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("post hook ran after a failed pre hook (stat error: %v)", err)
+	}
+}
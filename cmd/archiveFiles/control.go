@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/utils"
+)
+
+// controlHelp lists the commands of the control socket
+const controlHelp = "commands: status, progress, pause, resume, cancel-item <name>, cancel-run, reload"
+
+// listenControl opens the control socket at path, replacing a socket left
+// behind by an earlier process. Only the owner may connect.
+func listenControl(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket: %v", err)
+	}
+	if err := os.Chmod(path, constants.ControlSocketPermission); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %v", err)
+	}
+	return listener, nil
+}
+
+// startControlSocket serves the control socket at path for status and
+// returns a function closing it. Failing to open it is logged, not fatal.
+func startControlSocket(path string, status *runStatus) func() {
+	listener, err := listenControl(path)
+	if err != nil {
+		logger.Error("%v", err)
+		return func() {}
+	}
+	go serveControl(listener, status)
+	logger.Info("Accepting control commands on %s", path)
+	return func() { listener.Close() }
+}
+
+// serveControl accepts control connections until the listener is closed
+func serveControl(listener net.Listener, status *runStatus) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go handleControlConn(conn, status)
+	}
+}
+
+// handleControlConn answers one command per line with one line: OK or ERR
+// followed by a message, or the JSON status for "status"
+func handleControlConn(conn io.ReadWriteCloser, status *runStatus) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(conn, controlCommand(status, line)); err != nil {
+			return
+		}
+	}
+}
+
+// controlCommand runs one control command and returns its response
+func controlCommand(status *runStatus, line string) string {
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	logger.Debug("Control command: %s", line)
+
+	switch command {
+	case "status":
+		data, err := json.Marshal(status.report())
+		if err != nil {
+			return "ERR " + err.Error()
+		}
+		return string(data)
+	case "progress":
+		report := status.report()
+		if report.Phase == phaseIdle {
+			return "OK idle"
+		}
+		return fmt.Sprintf("OK %s: %d/%d items done, running: %s", report.Phase, report.ItemsDone, report.ItemsTotal, strings.Join(report.RunningItems, ", "))
+	case "pause":
+		utils.PauseIO()
+		return "OK paused"
+	case "resume":
+		utils.ResumeIO()
+		return "OK resumed"
+	case "cancel-item":
+		if arg == "" {
+			return "ERR usage: cancel-item <name>"
+		}
+		if err := status.cancelItem(arg); err != nil {
+			return "ERR " + err.Error()
+		}
+		logger.Warning("Item %s cancelled through the control socket", arg)
+		return "OK " + arg + " will be skipped"
+	case "cancel-run":
+		if err := status.cancelActiveRun(); err != nil {
+			return "ERR " + err.Error()
+		}
+		logger.Warning("Run cancelled through the control socket")
+		return "OK run cancelled"
+	case "reload":
+		if err := status.reloadConfig(); err != nil {
+			return "ERR " + err.Error()
+		}
+		return "OK configuration reloaded; it applies from the next run"
+	case "help":
+		return "OK " + controlHelp
+	default:
+		return fmt.Sprintf("ERR unknown command %q; %s", command, controlHelp)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+)
+
+func TestControlCommand(t *testing.T) {
+	status := newRunStatus()
+
+	if got := controlCommand(status, "progress"); got != "OK idle" {
+		t.Errorf("progress while idle = %q", got)
+	}
+	if got := controlCommand(status, "cancel-run"); !strings.HasPrefix(got, "ERR no run is active") {
+		t.Errorf("cancel-run while idle = %q", got)
+	}
+	if got := controlCommand(status, "reload"); !strings.HasPrefix(got, "ERR") {
+		t.Errorf("reload without a reload function = %q", got)
+	}
+	if got := controlCommand(status, "frobnicate"); !strings.HasPrefix(got, "ERR unknown command") {
+		t.Errorf("unknown command = %q", got)
+	}
+
+	// A run with one item in progress and one waiting
+	status.startRun("abcd1234")
+	status.setPhase(phaseBackingUp)
+	status.setItems([]types.DatabaseInfo{{Name: "a.db"}, {Name: "b.db"}})
+	status.beginItem("a.db")
+	cancelled := false
+	status.setCancelRun(func() { cancelled = true })
+
+	if got := controlCommand(status, "progress"); got != "OK backing-up: 0/2 items done, running: a.db" {
+		t.Errorf("progress = %q", got)
+	}
+	if got := controlCommand(status, "status"); !strings.Contains(got, `"running_items":["a.db"]`) {
+		t.Errorf("status = %q", got)
+	}
+	if got := controlCommand(status, "cancel-item a.db"); !strings.Contains(got, "already being backed up") {
+		t.Errorf("cancel-item of a running item = %q", got)
+	}
+	if got := controlCommand(status, "cancel-item missing.db"); !strings.HasPrefix(got, "ERR") {
+		t.Errorf("cancel-item of an unknown item = %q", got)
+	}
+	if got := controlCommand(status, "cancel-item b.db"); !strings.HasPrefix(got, "OK") {
+		t.Errorf("cancel-item of a waiting item = %q", got)
+	}
+	if status.beginItem("b.db") {
+		t.Error("A cancelled item should not start")
+	}
+	if got := controlCommand(status, "cancel-run"); got != "OK run cancelled" || !cancelled {
+		t.Errorf("cancel-run = %q, cancelled = %v", got, cancelled)
+	}
+
+	status.setReload(func() error { return errors.New("bad config") })
+	if got := controlCommand(status, "reload"); got != "ERR bad config" {
+		t.Errorf("failed reload = %q", got)
+	}
+	status.setReload(func() error { return nil })
+	if got := controlCommand(status, "reload"); !strings.HasPrefix(got, "OK") {
+		t.Errorf("reload = %q", got)
+	}
+}
+
+func TestControlSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "control.sock")
+	closeSocket := startControlSocket(socketPath, newRunStatus())
+	defer closeSocket()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Control socket not created: %v", err)
+	}
+	if info.Mode().Perm() != constants.ControlSocketPermission {
+		t.Errorf("Socket permissions = %v, want %v", info.Mode().Perm(), os.FileMode(constants.ControlSocketPermission))
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for _, command := range []string{"progress", "help"} {
+		fmt.Fprintln(conn, command)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read the answer to %s: %v", command, err)
+		}
+		if !strings.HasPrefix(line, "OK ") {
+			t.Errorf("%s = %q", command, line)
+		}
+	}
+}
+
+func TestProcessDatabasesConcurrently_CancelledItem(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.log", "b.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte("log line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	databases, err := discovery.DiscoverDatabases(&types.Config{SourcePaths: []string{sourceDir}, BatchMode: true}, sourceDir)
+	if err != nil || len(databases) != 2 {
+		t.Fatalf("Expected 2 items, got %d (%v)", len(databases), err)
+	}
+
+	status := newRunStatus()
+	status.startRun("abcd1234")
+	status.setItems(databases)
+	if err := status.cancelItem("b.log"); err != nil {
+		t.Fatalf("cancelItem failed: %v", err)
+	}
+
+	cfg := &types.Config{Method: constants.MethodCheckpoint, Durability: constants.DurabilityNone, HideProgress: true, LogLevel: "error"}
+	backupManifest := manifest.New(constants.MethodCheckpoint)
+	processDatabasesConcurrently(context.Background(), databases, filepath.Join(tempDir, "backup"), cfg,
+		progress.NewProgressTracker(false), 1, backupManifest, nil, nil, status)
+
+	for _, item := range backupManifest.Items {
+		want := manifest.StatusOK
+		if item.Name == "b.log" {
+			want = manifest.StatusSkipped
+		}
+		if item.Status != want {
+			t.Errorf("%s status = %s (%s), want %s", item.Name, item.Status, item.Error, want)
+		}
+	}
+	if report := status.report(); report.ItemsDone != 2 || len(report.RunningItems) != 0 {
+		t.Errorf("Report after the run = %+v", report)
+	}
+}
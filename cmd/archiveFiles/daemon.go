@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// Run phases reported by the status endpoint
+const (
+	phaseIdle        = "idle"
+	phaseDiscovering = "discovering"
+	phaseBackingUp   = "backing-up"
+	phaseFinalizing  = "finalizing"
+	phaseCompressing = "compressing"
+	phaseMirroring   = "mirroring"
+)
+
+// runStatus tracks the daemon's state for the status endpoint. setPhase and
+// setProgress are no-ops on a nil receiver, so single-shot runs can pass nil.
+type runStatus struct {
+	mu           sync.Mutex
+	phase        string
+	progress     *progress.ProgressTracker
+	lastRunID    string
+	lastRunStart time.Time
+	lastRunEnd   time.Time
+	lastRunError string
+	nextRun      time.Time
+	runs         int
+
+	// Items of the active run, for progress and item cancellation
+	itemsTotal int
+	itemsDone  int
+	pending    map[string]bool // Items not started yet, by name
+	running    map[string]bool // Items being backed up
+	cancelled  map[string]bool // Pending items the operator cancelled
+
+	cancelRun context.CancelFunc // Cancels the active run; nil between runs
+	reload    func() error       // Reloads the configuration; nil when not supported
+}
+
+// statusReport is the JSON document served at /status
+type statusReport struct {
+	Phase        string     `json:"phase"`
+	Progress     float64    `json:"progress_percent"`
+	LastRunID    string     `json:"last_run_id,omitempty"` // The current run while one is active
+	LastRunStart *time.Time `json:"last_run_start,omitempty"`
+	LastRunEnd   *time.Time `json:"last_run_end,omitempty"`
+	LastRunOK    bool       `json:"last_run_ok"`
+	LastRunError string     `json:"last_run_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	Runs         int        `json:"runs"`
+	Paused       bool       `json:"paused"`                // Backup I/O is halted by /pause
+	ItemsTotal   int        `json:"items_total,omitempty"` // Items of the current or last run
+	ItemsDone    int        `json:"items_done,omitempty"`
+	RunningItems []string   `json:"running_items,omitempty"`
+}
+
+func newRunStatus() *runStatus {
+	return &runStatus{phase: phaseIdle}
+}
+
+func (s *runStatus) setPhase(phase string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = phase
+}
+
+func (s *runStatus) setProgress(tracker *progress.ProgressTracker) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress = tracker
+}
+
+// startRun marks the beginning of a run
+func (s *runStatus) startRun(runID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRunID = runID
+	s.lastRunStart = time.Now().UTC()
+	s.nextRun = time.Time{}
+	s.progress = nil
+	s.itemsTotal = 0
+	s.itemsDone = 0
+	s.pending = nil
+	s.running = make(map[string]bool)
+	s.cancelled = make(map[string]bool)
+}
+
+// setNextRun updates when the next run is due
+func (s *runStatus) setNextRun(nextRun time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = nextRun.UTC()
+}
+
+// setItems records the items a run is about to back up
+func (s *runStatus) setItems(databases []types.DatabaseInfo) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.itemsTotal = len(databases)
+	s.pending = make(map[string]bool, len(databases))
+	for _, db := range databases {
+		s.pending[db.Name] = true
+	}
+}
+
+// beginItem marks an item as started. It returns false, and forgets the
+// cancellation, when the operator cancelled the item before it started.
+func (s *runStatus) beginItem(name string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, name)
+	if s.cancelled[name] {
+		delete(s.cancelled, name)
+		s.itemsDone++
+		return false
+	}
+	if s.running == nil {
+		s.running = make(map[string]bool)
+	}
+	s.running[name] = true
+	return true
+}
+
+// endItem marks a started item as finished, whatever its outcome
+func (s *runStatus) endItem(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+	s.itemsDone++
+}
+
+// cancelItem keeps an item of the active run from starting. Items already
+// being backed up cannot be interrupted.
+func (s *runStatus) cancelItem(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.running[name]:
+		return fmt.Errorf("%s is already being backed up", name)
+	case !s.pending[name]:
+		return fmt.Errorf("%s is not waiting to be backed up", name)
+	}
+	if s.cancelled == nil {
+		s.cancelled = make(map[string]bool)
+	}
+	s.cancelled[name] = true
+	return nil
+}
+
+// setCancelRun registers the cancel function of the active run, or nil once
+// it has ended
+func (s *runStatus) setCancelRun(cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelRun = cancel
+}
+
+// cancelActiveRun cancels the active run like an interrupt would
+func (s *runStatus) cancelActiveRun() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelRun == nil {
+		return fmt.Errorf("no run is active")
+	}
+	s.cancelRun()
+	return nil
+}
+
+// setReload registers how the configuration is reloaded
+func (s *runStatus) setReload(reload func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reload = reload
+}
+
+// reloadConfig reloads the configuration through the registered function
+func (s *runStatus) reloadConfig() error {
+	s.mu.Lock()
+	reload := s.reload
+	s.mu.Unlock()
+	if reload == nil {
+		return fmt.Errorf("configuration reload is only supported in daemon mode")
+	}
+	return reload()
+}
+
+// finishRun records the outcome of a run and when the next one is due
+func (s *runStatus) finishRun(err error, nextRun time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = phaseIdle
+	s.lastRunEnd = time.Now().UTC()
+	s.lastRunError = ""
+	if err != nil {
+		s.lastRunError = err.Error()
+	}
+	s.nextRun = nextRun.UTC()
+	s.runs++
+}
+
+// report returns a snapshot of the status
+func (s *runStatus) report() statusReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := statusReport{
+		Phase:        s.phase,
+		LastRunID:    s.lastRunID,
+		LastRunOK:    s.runs > 0 && s.lastRunError == "",
+		LastRunError: s.lastRunError,
+		Runs:         s.runs,
+		Paused:       utils.IOPaused(),
+		ItemsTotal:   s.itemsTotal,
+		ItemsDone:    s.itemsDone,
+	}
+	for name := range s.running {
+		report.RunningItems = append(report.RunningItems, name)
+	}
+	sort.Strings(report.RunningItems)
+	if s.progress != nil && s.phase != phaseIdle {
+		report.Progress = s.progress.Percent()
+	}
+	if !s.lastRunStart.IsZero() {
+		start := s.lastRunStart
+		report.LastRunStart = &start
+	}
+	if !s.lastRunEnd.IsZero() {
+		end := s.lastRunEnd
+		report.LastRunEnd = &end
+	}
+	if !s.nextRun.IsZero() {
+		next := s.nextRun
+		report.NextRun = &next
+	}
+	return report
+}
+
+// statusHandler serves /healthz and /status. With controls, it also serves
+// /pause and /resume to halt and continue backup I/O, and /reload to reload
+// the configuration; these only accept POST and answer with the status.
+// They carry no authentication, so they are only served on a Unix socket,
+// whose file permissions govern access.
+func statusHandler(status *runStatus, controls bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status.report())
+	})
+	if !controls {
+		return mux
+	}
+	control := func(apply func() error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if err := apply(); err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(status.report())
+		}
+	}
+	mux.HandleFunc("/pause", control(func() error { utils.PauseIO(); return nil }))
+	mux.HandleFunc("/resume", control(func() error { utils.ResumeIO(); return nil }))
+	mux.HandleFunc("/reload", control(status.reloadConfig))
+	return mux
+}
+
+// listenStatus listens on addr, which is a TCP address such as :8080 or
+// unix:/path/to.sock for a Unix socket. A socket left behind by an earlier
+// process is replaced.
+func listenStatus(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, "unix:")
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// runDaemon runs the archival process every interval until ctx is cancelled,
+// serving health and status endpoints and the control socket when
+// configured. A reloaded configuration applies from the next run.
+func runDaemon(ctx context.Context, cfg *types.Config, reload configLoader, signingKey ed25519.PrivateKey, interval time.Duration) {
+	interactive = false // Nobody answers prompts of scheduled runs
+	status := newRunStatus()
+
+	// Reloads replace the configuration of the next run; the endpoints keep
+	// the addresses they were started with. A changed interval reschedules
+	// the pending run.
+	var cfgMu sync.Mutex
+	rescheduled := make(chan struct{}, 1)
+	status.setReload(func() error {
+		newCfg, err := reload()
+		if err == nil && newCfg.Interval == "" {
+			err = fmt.Errorf("interval cannot be removed from a running daemon")
+		}
+		var newKey ed25519.PrivateKey
+		if err == nil && newCfg.SignKey != "" {
+			newKey, err = compress.LoadPrivateKey(newCfg.SignKey)
+		}
+		if err != nil {
+			logger.Warning("Configuration reload rejected: %v", err)
+			return err
+		}
+		// Validated with the rest of the configuration
+		newInterval, _ := time.ParseDuration(newCfg.Interval)
+
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		cfg, signingKey, interval = newCfg, newKey, newInterval
+		logger.Info("Configuration reloaded; it applies from the next run")
+		select {
+		case rescheduled <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	// SIGHUP reloads the configuration instead of ending the process
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				logger.Info("Received SIGHUP, reloading configuration")
+				status.reloadConfig()
+			}
+		}
+	}()
+
+	if cfg.ControlSocket != "" {
+		defer startControlSocket(cfg.ControlSocket, status)()
+	}
+
+	if cfg.StatusAddr != "" {
+		if listener, err := listenStatus(cfg.StatusAddr); err != nil {
+			logger.Error("Status endpoint failed: %v", err)
+		} else {
+			controls := strings.HasPrefix(cfg.StatusAddr, "unix:")
+			server := &http.Server{Handler: statusHandler(status, controls)}
+			go func() {
+				if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+					logger.Error("Status endpoint failed: %v", err)
+				}
+			}()
+			defer func() {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				server.Shutdown(shutdownCtx)
+			}()
+			if controls {
+				logger.Info("Serving /healthz, /status, /pause, /resume and /reload on %s", cfg.StatusAddr)
+			} else {
+				logger.Info("Serving /healthz and /status on %s; /pause, /resume and /reload are only served on a Unix socket", cfg.StatusAddr)
+			}
+		}
+	}
+
+	// Copies held by a pause have no context; let them finish on shutdown
+	go func() {
+		<-ctx.Done()
+		utils.ResumeIO()
+	}()
+
+	logger.Info("Daemon mode: running every %v", interval)
+	for {
+		if utils.IOPaused() {
+			logger.Info("Backup I/O is paused; the next run starts once it is resumed")
+			if utils.WaitWhilePaused(ctx) != nil {
+				logger.Info("Daemon stopped")
+				return
+			}
+		}
+
+		cfgMu.Lock()
+		runCfg, runKey := cfg, signingKey
+		cfgMu.Unlock()
+
+		runID := utils.NewRunID()
+		status.startRun(runID)
+		runCtx, cancelRun := context.WithCancel(ctx)
+		status.setCancelRun(cancelRun)
+		_, err := runArchive(runCtx, runCfg, runID, runKey, status)
+		status.setCancelRun(nil)
+		if ctx.Err() != nil {
+			cancelRun()
+			status.finishRun(ctx.Err(), time.Time{})
+			logger.Info("Daemon stopped")
+			return
+		}
+		if runCtx.Err() != nil {
+			err = fmt.Errorf("run cancelled by operator")
+		}
+		cancelRun()
+
+		// Drain a reload made during the run; it needs no rescheduling
+		select {
+		case <-rescheduled:
+		default:
+		}
+		runEnd := time.Now()
+		cfgMu.Lock()
+		nextRun := runEnd.Add(interval)
+		cfgMu.Unlock()
+		status.finishRun(err, nextRun)
+		if err != nil {
+			logger.Error("Backup run %s failed: %v", runID, err)
+		}
+		logger.Info("Next backup run at %s", nextRun.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(nextRun))
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				logger.Info("Daemon stopped")
+				return
+			case <-rescheduled:
+				cfgMu.Lock()
+				nextRun = runEnd.Add(interval)
+				cfgMu.Unlock()
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(time.Until(nextRun))
+				status.setNextRun(nextRun)
+				logger.Info("Next backup run rescheduled to %s", nextRun.Format(time.RFC3339))
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+}
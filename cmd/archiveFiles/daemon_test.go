@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+func TestStatusHandler(t *testing.T) {
+	status := newRunStatus()
+	handler := statusHandler(status, false)
+
+	t.Run("healthz", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("/healthz status = %d, want 200", rec.Code)
+		}
+	})
+
+	getStatus := func(t *testing.T) statusReport {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/status status = %d, want 200", rec.Code)
+		}
+		var report statusReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Invalid /status JSON: %v", err)
+		}
+		return report
+	}
+
+	if report := getStatus(t); report.Phase != phaseIdle || report.LastRunStart != nil || report.LastRunOK {
+		t.Errorf("Initial status = %+v", report)
+	}
+
+	// A run in progress reports its phase and progress
+	tracker := progress.NewProgressTracker(true)
+	tracker.Init(2, 100)
+	status.startRun("abcd1234")
+	status.setPhase(phaseBackingUp)
+	status.setProgress(tracker)
+	tracker.CompleteItem(50)
+
+	report := getStatus(t)
+	if report.Phase != phaseBackingUp || report.Progress != 50 || report.LastRunStart == nil || report.LastRunID != "abcd1234" {
+		t.Errorf("Running status = %+v", report)
+	}
+
+	// A finished run reports its outcome and the next scheduled run
+	nextRun := time.Now().Add(time.Hour)
+	status.finishRun(errors.New("disk full"), nextRun)
+	report = getStatus(t)
+	if report.Phase != phaseIdle || report.LastRunOK || report.LastRunError != "disk full" {
+		t.Errorf("Finished status = %+v", report)
+	}
+	if report.NextRun == nil || !report.NextRun.Equal(nextRun.UTC().Truncate(time.Nanosecond)) {
+		t.Errorf("NextRun = %v, want %v", report.NextRun, nextRun)
+	}
+	if report.Runs != 1 {
+		t.Errorf("Runs = %d, want 1", report.Runs)
+	}
+}
+
+func TestRunStatus_NilReceiver(t *testing.T) {
+	var status *runStatus
+	status.setPhase(phaseDiscovering)
+	status.setProgress(progress.NewProgressTracker(false))
+}
+
+func TestStatusHandler_PauseResume(t *testing.T) {
+	handler := statusHandler(newRunStatus(), true)
+	defer utils.ResumeIO()
+
+	post := func(t *testing.T, path string) statusReport {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, want 200", path, rec.Code)
+		}
+		var report statusReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Invalid %s JSON: %v", path, err)
+		}
+		return report
+	}
+
+	if report := post(t, "/pause"); !report.Paused || !utils.IOPaused() {
+		t.Errorf("After /pause: report paused = %v, IOPaused = %v", report.Paused, utils.IOPaused())
+	}
+	if report := post(t, "/resume"); report.Paused || utils.IOPaused() {
+		t.Errorf("After /resume: report paused = %v, IOPaused = %v", report.Paused, utils.IOPaused())
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pause", nil))
+	if rec.Code != http.StatusMethodNotAllowed || utils.IOPaused() {
+		t.Errorf("GET /pause status = %d, paused = %v; want 405 and no pause", rec.Code, utils.IOPaused())
+	}
+}
+
+func TestStatusHandler_NoControls(t *testing.T) {
+	handler := statusHandler(newRunStatus(), false)
+	defer utils.ResumeIO()
+
+	for _, path := range []string{"/pause", "/resume", "/reload"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("POST %s without controls = %d, want 404", path, rec.Code)
+		}
+	}
+	if utils.IOPaused() {
+		t.Error("POST /pause without controls paused backup I/O")
+	}
+}
+
+func TestListenStatus_UnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "control.sock")
+	listener, err := listenStatus("unix:" + socketPath)
+	if err != nil {
+		t.Fatalf("listenStatus failed: %v", err)
+	}
+	server := &http.Server{Handler: statusHandler(newRunStatus(), true)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://archivefiles/healthz")
+	if err != nil {
+		t.Fatalf("GET over the Unix socket failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestStatusHandler_Reload(t *testing.T) {
+	status := newRunStatus()
+	handler := statusHandler(status, true)
+
+	reload := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+		return rec.Code
+	}
+	if code := reload(); code != http.StatusUnprocessableEntity {
+		t.Errorf("/reload without a reload function = %d, want 422", code)
+	}
+	reloads := 0
+	status.setReload(func() error { reloads++; return nil })
+	if code := reload(); code != http.StatusOK || reloads != 1 {
+		t.Errorf("/reload = %d after %d reload(s), want 200 after 1", code, reloads)
+	}
+}
+
+func TestBuildConfig_Reload(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flagConfig := &types.Config{Method: constants.MethodCheckpoint}
+
+	writeConfig(`{"source_paths": ["` + tempDir + `"], "interval": "24h"}`)
+	cfg, err := buildConfig(configPath, flagConfig, sourceFlags{})
+	if err != nil {
+		t.Fatalf("buildConfig failed: %v", err)
+	}
+	if cfg.Interval != "24h" || !cfg.BatchMode {
+		t.Errorf("Config = interval %q, batch mode %v", cfg.Interval, cfg.BatchMode)
+	}
+
+	// A source added to the file shows up on reload
+	extraSource := filepath.Join(tempDir, "extra")
+	if err := os.MkdirAll(extraSource, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(`{"source_paths": ["` + tempDir + `", "` + extraSource + `"], "interval": "1h"}`)
+	if cfg, err = buildConfig(configPath, flagConfig, sourceFlags{}); err != nil {
+		t.Fatalf("buildConfig after the change failed: %v", err)
+	}
+	if len(cfg.SourcePaths) != 2 || cfg.Interval != "1h" {
+		t.Errorf("Reloaded config = sources %v, interval %q", cfg.SourcePaths, cfg.Interval)
+	}
+
+	// An invalid file is rejected
+	writeConfig(`{"source_paths": ["` + tempDir + `"], "interval": "sometimes"}`)
+	if _, err := buildConfig(configPath, flagConfig, sourceFlags{}); err == nil {
+		t.Error("Expected an invalid interval to be rejected")
+	}
+	// Paths read from stdin are reused on every reload
+	writeConfig(`{"interval": "1h"}`)
+	sources := sourceFlags{from: "-", stdin: []string{tempDir}}
+	for i := 0; i < 2; i++ {
+		cfg, err := buildConfig(configPath, flagConfig, sources)
+		if err != nil {
+			t.Fatalf("buildConfig with stdin sources failed: %v", err)
+		}
+		if len(cfg.SourcePaths) != 1 || cfg.SourcePaths[0] != tempDir {
+			t.Errorf("Sources from stdin = %v", cfg.SourcePaths)
+		}
+	}
+}
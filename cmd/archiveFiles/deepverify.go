@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/docker"
+	"archiveFiles/internal/utils"
+)
+
+// deepVerifyMount is where the extracted archive appears inside the
+// verification container
+const deepVerifyMount = "/archive"
+
+// deepVerify extracts an archive and runs the application's own consistency
+// check against it in a disposable container. The check's output is written
+// to out as part of the verification report; a non-zero exit fails the check.
+func deepVerify(ctx context.Context, client *docker.Client, archivePath, image, command string, out io.Writer) error {
+	// The check may write (e.g. RocksDB recovers its LOCK and logs), so it
+	// gets a scratch copy rather than the archive itself
+	extractDir, err := utils.MkdirTemp(constants.TmpPrefix + "deep-verify-")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory: %v", err)
+	}
+	defer os.RemoveAll(extractDir)
+
+	switch {
+	case compress.IsIndexed(archivePath):
+		err = compress.ExtractIndexed(archivePath, extractDir, nil)
+	case compress.IsLegacy(archivePath):
+		_, err = compress.ExtractLegacy(archivePath, extractDir)
+	default:
+		_, err = compress.ExtractArchive(archivePath, extractDir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract archive: %v", err)
+	}
+	// Docker requires absolute bind sources
+	if extractDir, err = filepath.Abs(extractDir); err != nil {
+		return err
+	}
+
+	result, err := client.RunContainer(ctx, docker.ContainerSpec{
+		Image: image,
+		Cmd:   []string{"sh", "-c", command},
+		Binds: []string{extractDir + ":" + deepVerifyMount},
+	})
+	if err != nil {
+		return fmt.Errorf("deep verification could not run: %v", err)
+	}
+
+	fmt.Fprintf(out, "Deep verification in %s: %s (exit code %d)\n", image, command, result.ExitCode)
+	if result.Truncated {
+		fmt.Fprintln(out, "[earlier output truncated]")
+	}
+	out.Write(result.Output)
+	if len(result.Output) > 0 && result.Output[len(result.Output)-1] != '\n' {
+		fmt.Fprintln(out)
+	}
+
+	if result.ExitCode != 0 {
+		return fmt.Errorf("consistency check exited with code %d", result.ExitCode)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"archiveFiles/internal/docker"
+	"archiveFiles/internal/logger"
+)
+
+// dockerSource is a source path resolved to the directory that is scanned
+type dockerSource struct {
+	ScanPath       string // Host directory to discover databases in
+	SourceRoot     string // Source root recorded for discovered items
+	PauseContainer string // Container to pause during the backup, if any
+}
+
+// resolveSource maps docker-volume:// sources to their host mountpoint and
+// passes other sources through. The Docker client is created on first use.
+func resolveSource(ctx context.Context, client **docker.Client, sourcePath string) (dockerSource, error) {
+	if !docker.IsVolumeSource(sourcePath) {
+		return dockerSource{ScanPath: sourcePath, SourceRoot: sourcePath}, nil
+	}
+
+	volume, err := docker.ParseVolumeSource(sourcePath)
+	if err != nil {
+		return dockerSource{}, err
+	}
+	if *client == nil {
+		if *client, err = docker.NewClient(); err != nil {
+			return dockerSource{}, err
+		}
+	}
+
+	mountpoint, err := (*client).VolumeMountpoint(ctx, volume.Volume)
+	if err != nil {
+		return dockerSource{}, fmt.Errorf("failed to resolve docker volume %s: %v", volume.Volume, err)
+	}
+	logger.Info("Docker volume %s is mounted at %s", volume.Volume, mountpoint)
+
+	return dockerSource{
+		ScanPath:       mountpoint,
+		SourceRoot:     volume.String(),
+		PauseContainer: volume.PauseContainer,
+	}, nil
+}
+
+// pauseContainers pauses each container and returns a function that unpauses
+// them again. If one fails to pause, the ones already paused are resumed.
+func pauseContainers(ctx context.Context, client *docker.Client, containers []string) (func(), error) {
+	var paused []string
+	unpause := func() {
+		// Resume even if the run was cancelled
+		for _, name := range paused {
+			if err := client.UnpauseContainer(context.Background(), name); err != nil {
+				logger.Error("Failed to unpause container %s: %v", name, err)
+				continue
+			}
+			logger.Info("Unpaused container %s", name)
+		}
+		paused = nil
+	}
+
+	for _, name := range containers {
+		if err := client.PauseContainer(ctx, name); err != nil {
+			unpause()
+			return func() {}, fmt.Errorf("failed to pause container %s: %v", name, err)
+		}
+		logger.Info("Paused container %s", name)
+		paused = append(paused, name)
+	}
+	return unpause, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// runDownload implements "download": it copies an archive from a remote
+// host over SSH in parts, the counterpart of upload
+func runDownload(args []string, stdout, stderr io.Writer) int {
+	downloadCmd := flag.NewFlagSet("download", flag.ExitOnError)
+	archivePath := downloadCmd.String("archive", "", "Local file to write (default: the remote file name in the current directory)")
+	partSize := downloadCmd.String("part-size", "64M", "Size of the parts the archive is fetched in, in whole MiB")
+	parallel := downloadCmd.Int("parallel", constants.TransferParallel, "Number of parts fetched at once, each over its own SSH connection")
+	sshCommand := downloadCmd.String("ssh", "ssh", "SSH command, including options (e.g. \"ssh -p 2222 -i key\")")
+	namespace := downloadCmd.String("namespace", "", "Tenant namespace the archive was uploaded with")
+
+	// Accept the source before or after the flags
+	var source string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		source, args = args[0], args[1:]
+	}
+	if err := downloadCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if source == "" && downloadCmd.NArg() > 0 {
+		source = downloadCmd.Arg(0)
+	}
+	if source == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles download user@host:/path [-archive=local_path] [-namespace=name] [-part-size=64M] [-parallel=4] [-ssh=command]")
+		return 1
+	}
+
+	remote, err := parseRemoteTarget(source)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	if *namespace != "" {
+		if err := types.ValidateNamespace(*namespace); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		remote.Path = namespacedPath(remote.Path, *namespace)
+	}
+	size, err := types.ParseSize(*partSize)
+	if err != nil || size <= 0 || size%constants.UploadBlockSize != 0 {
+		fmt.Fprintf(stderr, "Invalid -part-size %q: must be a positive number of whole MiB, e.g. 64M\n", *partSize)
+		return 1
+	}
+	if err := validateParallel(*parallel); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	sshArgs := strings.Fields(*sshCommand)
+	if len(sshArgs) == 0 {
+		fmt.Fprintln(stderr, "-ssh must not be empty")
+		return 1
+	}
+	if *archivePath == "" {
+		*archivePath = path.Base(remote.Path)
+	}
+
+	if err := downloadArchive(sshArgs, remote, *archivePath, size, *parallel, stderr); err != nil {
+		fmt.Fprintf(stderr, "Download failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, *archivePath)
+	return 0
+}
+
+// downloadArchive fetches the remote file in parts of partSize, up to
+// parallel parts at once, into <archivePath>.partial and renames it into
+// place once every part has arrived in full. An interrupted download
+// leaves nothing behind and starts over.
+func downloadArchive(sshArgs []string, remote remoteTarget, archivePath string, partSize int64, parallel int, stderr io.Writer) error {
+	size, err := remoteFileSize(sshArgs, remote)
+	if err != nil {
+		return err
+	}
+
+	partialPath := archivePath + constants.DownloadPartialSuffix
+	file, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, constants.FilePermission)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", partialPath, err)
+	}
+	defer os.Remove(partialPath)
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to allocate %s: %v", partialPath, err)
+	}
+
+	fmt.Fprintf(stderr, "Downloading %s:%s (%s) to %s...\n", remote.Host, remote.Path, utils.FormatBytes(size), archivePath)
+	parts := make([]int, (size+partSize-1)/partSize)
+	for i := range parts {
+		parts[i] = i
+	}
+	blocksPerPart := partSize / constants.UploadBlockSize
+	err = transferParts(parts, parallel, func(part int) error {
+		offset := int64(part) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		command := fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d", shellQuote(remote.Path), constants.UploadBlockSize, int64(part)*blocksPerPart, blocksPerPart)
+		out := &partWriter{w: io.NewOffsetWriter(file, offset)}
+		if err := runRemote(sshArgs, remote.Host, command, nil, out); err != nil {
+			return fmt.Errorf("failed to read part %d of %d: %v", part+1, len(parts), err)
+		}
+		// A remote file that changed size while it was read would leave a
+		// gap or spill into the next part
+		if out.n != length {
+			return fmt.Errorf("part %d of %d has %d bytes, want %d; was the remote file modified?", part+1, len(parts), out.n, length)
+		}
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %v", partialPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", partialPath, err)
+	}
+	if err := os.Rename(partialPath, archivePath); err != nil {
+		return fmt.Errorf("failed to rename archive into place: %v", err)
+	}
+	return nil
+}
+
+// remoteFileSize returns the size of the remote file in bytes
+func remoteFileSize(sshArgs []string, remote remoteTarget) (int64, error) {
+	var out bytes.Buffer
+	if err := runRemote(sshArgs, remote.Host, "wc -c < "+shellQuote(remote.Path), nil, &out); err != nil {
+		return 0, fmt.Errorf("failed to read the size of %s: %v", remote.Path, err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size %q of %s", strings.TrimSpace(out.String()), remote.Path)
+	}
+	return size, nil
+}
+
+// partWriter counts the bytes of a part as they are written
+type partWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (p *partWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+func TestDownloadArchive(t *testing.T) {
+	dir := t.TempDir()
+	remotePath := filepath.Join(dir, "remote", "backup.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(remotePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 5*constants.UploadBlockSize+4321)
+	rand.New(rand.NewSource(3)).Read(data)
+	if err := os.WriteFile(remotePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(dir, "local.tar.gz")
+	var stderr bytes.Buffer
+	if err := downloadArchive(fakeSSH(t), remoteTarget{Host: "nas", Path: remotePath}, archivePath, constants.UploadBlockSize, 3, &stderr); err != nil {
+		t.Fatalf("downloadArchive failed: %v", err)
+	}
+	downloaded, err := os.ReadFile(archivePath)
+	if err != nil || !bytes.Equal(downloaded, data) {
+		t.Fatalf("Downloaded file differs from the remote file (read error: %v)", err)
+	}
+	if _, err := os.Stat(archivePath + constants.DownloadPartialSuffix); !os.IsNotExist(err) {
+		t.Errorf("Partial file should be gone after success, stat error: %v", err)
+	}
+}
+
+func TestDownloadArchive_Failure(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "local.tar.gz")
+	var stderr bytes.Buffer
+	err := downloadArchive(fakeSSH(t), remoteTarget{Host: "nas", Path: filepath.Join(dir, "missing.tar.gz")}, archivePath, constants.UploadBlockSize, 2, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "failed to read the size") {
+		t.Fatalf("downloadArchive error = %v, want the missing file reported", err)
+	}
+	for _, path := range []string{archivePath, archivePath + constants.DownloadPartialSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist after a failed download, stat error: %v", path, err)
+		}
+	}
+}
+
+func TestRunDownload_Namespace(t *testing.T) {
+	dir := t.TempDir()
+	remotePath := filepath.Join(dir, "remote", "teamA", "backup.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(remotePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(remotePath, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	var stdout, stderr bytes.Buffer
+	source := "nas:" + filepath.Join(dir, "remote", "backup.tar.gz")
+	if code := runDownload([]string{source, "-archive", archivePath, "-namespace", "teamA", "-ssh", fakeSSH(t)[0]}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+	if downloaded, err := os.ReadFile(archivePath); err != nil || string(downloaded) != "archive" {
+		t.Errorf("Downloaded %s = %q, %v", archivePath, downloaded, err)
+	}
+
+	stderr.Reset()
+	if code := runDownload([]string{source, "-parallel", "0"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "-parallel") {
+		t.Errorf("exit code = %d, stderr %q, want -parallel 0 rejected", code, stderr.String())
+	}
+}
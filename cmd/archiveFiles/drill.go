@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/restore"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/verify"
+)
+
+// drillOptions controls how a restore drill checks an archive
+type drillOptions struct {
+	ScratchDir string            // Parent of the temporary restore directory
+	PublicKey  ed25519.PublicKey // Verify the archive signature when set
+	NotifyCmd  string            // Shell command run when a drill fails
+}
+
+// runDrill implements "drill": it restores an archive from the catalog into
+// scratch space, verifies every database in it and records the result in the
+// catalog. Without -archive a random archived run is picked. With -interval
+// it keeps drilling until interrupted.
+func runDrill(args []string, stdout, stderr io.Writer) int {
+	drillCmd := flag.NewFlagSet("drill", flag.ContinueOnError)
+	configFile := drillCmd.String("config", "", "JSON configuration file naming the catalog (default: search standard locations)")
+	catalogPath := drillCmd.String("catalog", "", "Catalog file (overrides catalog_path from the config)")
+	archivePath := drillCmd.String("archive", "", "Archive to drill (default: a random archive from the catalog)")
+	scratchDir := drillCmd.String("scratch", os.TempDir(), "Directory to restore into; the restored copy is removed afterwards")
+	pubKeyPath := drillCmd.String("pubkey", "", "Ed25519 public key (PEM) to verify the archive signature with")
+	notifyCmd := drillCmd.String("notify-cmd", "", "Shell command to run when a drill fails; ARCHIVEFILES_DRILL_ARCHIVE and ARCHIVEFILES_DRILL_ERROR describe the failure")
+	interval := drillCmd.Duration("interval", 0, "Repeat the drill at this interval until interrupted (default: run once)")
+	if err := drillCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+
+	if *catalogPath == "" {
+		if *configFile == "" {
+			*configFile = config.FindDefaultConfig()
+		}
+		if *configFile != "" {
+			cfg, err := config.LoadConfigFromJSON(*configFile)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				return 1
+			}
+			*catalogPath = cfg.CatalogPath
+		}
+	}
+	if *catalogPath == "" && *archivePath == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles drill [-config=file] [-catalog=catalog.json] [-archive=archive_path] [-scratch=dir] [-pubkey=key.pem] [-notify-cmd=command] [-interval=24h]")
+		return 1
+	}
+
+	opts := drillOptions{ScratchDir: *scratchDir, NotifyCmd: *notifyCmd}
+	if *pubKeyPath != "" {
+		publicKey, err := compress.LoadPublicKey(*pubKeyPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		opts.PublicKey = publicKey
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		succeeded := runDrillOnce(*catalogPath, *archivePath, opts, rng, stdout, stderr)
+		if *interval <= 0 {
+			if !succeeded {
+				return 1
+			}
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// runDrillOnce performs a single drill, prints its verdict and records it in
+// the catalog. It reports whether the archive restored and verified cleanly.
+func runDrillOnce(catalogPath, archivePath string, opts drillOptions, rng *rand.Rand, stdout, stderr io.Writer) bool {
+	drill := catalog.Drill{Time: time.Now().UTC(), ArchivePath: archivePath}
+
+	var err error
+	if catalogPath != "" {
+		var backupCatalog *catalog.Catalog
+		if backupCatalog, err = catalog.Load(catalogPath); err == nil && archivePath == "" {
+			var run catalog.Run
+			if run, err = pickDrillArchive(backupCatalog, rng); err == nil {
+				drill.RunID = run.RunID
+				drill.ArchivePath = run.ArchivePath
+			}
+		}
+	}
+	if err == nil {
+		fmt.Fprintf(stderr, "Drilling %s...\n", drill.ArchivePath)
+		err = drillArchive(drill.ArchivePath, opts, stderr)
+	}
+	drill.Duration = time.Since(drill.Time).Seconds()
+	drill.Succeeded = err == nil
+
+	if err != nil {
+		drill.Error = err.Error()
+		fmt.Fprintf(stdout, "Drill FAILED: %s: %v\n", drill.ArchivePath, err)
+		printHint(stderr, err)
+		if opts.NotifyCmd != "" {
+			if notifyErr := notifyDrillFailure(opts.NotifyCmd, drill); notifyErr != nil {
+				fmt.Fprintf(stderr, "Warning: drill failure notification failed: %v\n", notifyErr)
+			}
+		}
+	} else {
+		fmt.Fprintf(stdout, "Drill OK: %s restored and verified in %.1fs\n", drill.ArchivePath, drill.Duration)
+	}
+
+	// Reload so runs recorded while the drill was restoring are kept
+	if catalogPath != "" {
+		backupCatalog, loadErr := catalog.Load(catalogPath)
+		if loadErr == nil {
+			backupCatalog.AddDrill(drill)
+			loadErr = backupCatalog.Save(catalogPath)
+		}
+		if loadErr != nil {
+			fmt.Fprintf(stderr, "Warning: failed to record drill in catalog: %v\n", loadErr)
+		}
+	}
+	return drill.Succeeded
+}
+
+// pickDrillArchive picks a random run whose archive still exists
+func pickDrillArchive(backupCatalog *catalog.Catalog, rng *rand.Rand) (catalog.Run, error) {
+	var candidates []catalog.Run
+	for _, run := range backupCatalog.Runs {
+		if run.ArchivePath == "" {
+			continue
+		}
+		if _, err := os.Stat(run.ArchivePath); err == nil {
+			candidates = append(candidates, run)
+		}
+	}
+	if len(candidates) == 0 {
+		return catalog.Run{}, fmt.Errorf("no archive recorded in the catalog exists on disk")
+	}
+	return candidates[rng.Intn(len(candidates))], nil
+}
+
+// drillArchive checks the archive footer and signature, restores the archive
+// into a temporary directory under opts.ScratchDir and verifies the databases
+// listed in its manifest. The restored copy is always removed.
+func drillArchive(archivePath string, opts drillOptions, stderr io.Writer) error {
+	if err := checkArchive(archivePath, opts.PublicKey); err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp(opts.ScratchDir, "archiveFiles-drill-")
+	if err != nil {
+		return fmt.Errorf("failed to create scratch directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	check := compatibilityCheck(restore.CurrentEnvironment(), false, stderr)
+	return restore.RestoreArchive(archivePath, filepath.Join(workDir, "restore"), func(dir string) error {
+		if err := check(dir); err != nil {
+			return err
+		}
+		return verifyRestoredItems(dir, stderr)
+	})
+}
+
+// checkArchive checks an archive in full against its footer or index, and
+// its signature when publicKey is set. Per-item archives are not signed, so
+// they fail when a signature is asked for, as with verify-archive.
+func checkArchive(archivePath string, publicKey ed25519.PublicKey) error {
+	if compress.IsIndexed(archivePath) {
+		if publicKey != nil {
+			return fmt.Errorf("per-item archives are not signed")
+		}
+		_, err := compress.VerifyIndexed(archivePath)
+		return err
+	}
+	footer, err := compress.VerifyArchive(archivePath)
+	if err != nil {
+		return err
+	}
+	if publicKey != nil {
+		return compress.VerifySignature(archivePath, footer, publicKey)
+	}
+	return nil
+}
+
+// verifyRestoredItems runs the database checks on every item the manifest in
+// dir lists as backed up
+func verifyRestoredItems(dir string, stderr io.Writer) error {
+	m, err := manifest.Load(filepath.Join(dir, manifest.FileName))
+	if err != nil {
+		return err
+	}
+
+	checked := 0
+	for _, item := range m.Items {
+		// Encrypted databases cannot be opened without their key
+		if item.Status != manifest.StatusOK || item.Encrypted {
+			continue
+		}
+		itemPath := filepath.Join(dir, filepath.FromSlash(item.BackupPath))
+		switch item.Type {
+		case types.DatabaseTypeSQLite.String():
+			// SQLite items are a directory holding the database file
+			err = verify.CheckSQLiteIntegrity(filepath.Join(itemPath, filepath.Base(item.SourcePath)))
+		case types.DatabaseTypeRocksDB.String():
+			err = verify.CheckRocksDBReadable(itemPath)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", item.BackupPath, err)
+		}
+		checked++
+	}
+	fmt.Fprintf(stderr, "Verified %d database(s) of %d item(s)\n", checked, len(m.Items))
+	return nil
+}
+
+// notifyDrillFailure runs the -notify-cmd hook for a failed drill
+func notifyDrillFailure(command string, drill catalog.Drill) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"ARCHIVEFILES_DRILL_ARCHIVE="+drill.ArchivePath,
+		"ARCHIVEFILES_DRILL_RUN_ID="+drill.RunID,
+		"ARCHIVEFILES_DRILL_ERROR="+drill.Error,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"database/sql"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/manifest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// createDrillArchive compresses a backup holding one SQLite item, either a
+// valid database or a corrupt one
+func createDrillArchive(t *testing.T, dir string, corrupt bool) string {
+	t.Helper()
+	backupDir := filepath.Join(dir, "backup")
+	itemDir := filepath.Join(backupDir, "data", "app.db")
+	if err := os.MkdirAll(itemDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(itemDir, "app.db")
+	if corrupt {
+		if err := os.WriteFile(dbPath, bytes.Repeat([]byte("not a database"), 512), 0644); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); INSERT INTO t (v) VALUES ('a'), ('b')"); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+
+	m := manifest.New("sqlite-backup")
+	m.AddItem(manifest.Item{
+		Name:       "app.db",
+		Type:       "SQLite",
+		SourceRoot: "/data",
+		SourcePath: "/data/app.db",
+		BackupPath: "data/app.db",
+		Status:     manifest.StatusOK,
+	})
+	if err := m.Write(filepath.Join(backupDir, manifest.FileName)); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	if err := compress.CompressDirectory(backupDir, archivePath); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestRunDrill(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := createDrillArchive(t, dir, false)
+	catalogPath := filepath.Join(dir, "catalog.json")
+	backupCatalog := &catalog.Catalog{}
+	backupCatalog.AddRun(catalog.Run{RunID: "run-1", ArchivePath: archivePath})
+	backupCatalog.AddRun(catalog.Run{RunID: "run-2"}) // Never compressed
+	if err := backupCatalog.Save(catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runDrill([]string{"-catalog", catalogPath, "-scratch", dir}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0; stdout: %s stderr: %s", code, stdout.String(), stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "Drill OK: "+archivePath) {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+
+	backupCatalog, err := catalog.Load(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backupCatalog.Drills) != 1 {
+		t.Fatalf("recorded %d drills, want 1", len(backupCatalog.Drills))
+	}
+	if drill := backupCatalog.Drills[0]; !drill.Succeeded || drill.RunID != "run-1" {
+		t.Errorf("drill = %+v, want a successful drill of run-1", drill)
+	}
+
+	// The restored copy is removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "archiveFiles-drill-") {
+			t.Errorf("scratch directory %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestRunDrill_Failure(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := createDrillArchive(t, dir, true)
+	catalogPath := filepath.Join(dir, "catalog.json")
+	notified := filepath.Join(dir, "notified")
+
+	var stdout, stderr bytes.Buffer
+	code := runDrill([]string{
+		"-catalog", catalogPath,
+		"-archive", archivePath,
+		"-scratch", dir,
+		"-notify-cmd", `printf '%s' "$ARCHIVEFILES_DRILL_ARCHIVE" > ` + notified,
+	}, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1; stdout: %s", code, stdout.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "Drill FAILED: "+archivePath) {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+
+	data, err := os.ReadFile(notified)
+	if err != nil {
+		t.Fatalf("notify command did not run: %v", err)
+	}
+	if string(data) != archivePath {
+		t.Errorf("notify command got archive %q, want %q", data, archivePath)
+	}
+
+	backupCatalog, err := catalog.Load(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backupCatalog.Drills) != 1 || backupCatalog.Drills[0].Succeeded || backupCatalog.Drills[0].Error == "" {
+		t.Errorf("drills = %+v, want one failed drill with an error", backupCatalog.Drills)
+	}
+}
+
+func TestCheckArchive_PerItemWithPublicKey(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backup")
+	if err := os.MkdirAll(filepath.Join(backupDir, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, "logs", "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(dir, "backup.archive")
+	if _, err := compress.CompressItems(backupDir, archivePath, []string{"logs"}, compress.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkArchive(archivePath, nil); err != nil {
+		t.Errorf("checkArchive without a key failed: %v", err)
+	}
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkArchive(archivePath, publicKey); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("checkArchive with a key = %v, want an error that per-item archives are not signed", err)
+	}
+}
+
+func TestPickDrillArchive(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "a.tar.gz")
+	if err := os.WriteFile(existing, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backupCatalog := &catalog.Catalog{Runs: []catalog.Run{
+		{RunID: "gone", ArchivePath: filepath.Join(dir, "gone.tar.gz")},
+		{RunID: "uncompressed"},
+		{RunID: "a", ArchivePath: existing},
+	}}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5; i++ {
+		run, err := pickDrillArchive(backupCatalog, rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.RunID != "a" {
+			t.Errorf("picked %q, want the only archive that exists", run.RunID)
+		}
+	}
+
+	if _, err := pickDrillArchive(&catalog.Catalog{}, rng); err == nil {
+		t.Error("expected an error for a catalog without archives")
+	}
+}
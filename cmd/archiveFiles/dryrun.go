@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"archiveFiles/internal/backup"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// plannedItem is one entry of the dry-run backup tree
+type plannedItem struct {
+	BackupPath string // Relative to the backup root, slash-separated
+	Info       types.DatabaseInfo
+	Plan       backup.Plan
+	Err        error // Why the item would fail, if it would
+}
+
+// printDryRunPlan shows what a run would create: the backup tree with the
+// size and backup method of every item, then the estimate of the archive
+func printDryRunPlan(out io.Writer, cfg *types.Config, backupPath string, databases []types.DatabaseInfo) {
+	items := make([]plannedItem, 0, len(databases))
+	for _, db := range databases {
+		item := plannedItem{BackupPath: filepath.ToSlash(itemBackupPath(cfg.Namespace, db)), Info: db}
+		if cfg.RocksDBExport != "" && db.Type == types.DatabaseTypeRocksDB && !db.Encrypted {
+			item.Plan = backup.Plan{Method: backup.ExportStep(cfg.RocksDBExport)}
+		} else {
+			item.Plan, item.Err = backup.PlanBackup(db, cfg.Method)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].BackupPath < items[j].BackupPath })
+
+	fmt.Fprintf(out, "Backup plan for %s:\n", backupPath)
+	printBackupTree(out, items)
+	fmt.Fprintln(out)
+
+	est, err := estimateBackup(cfg, databases)
+	if err != nil {
+		fmt.Fprintf(out, "Estimate failed: %v\n", err)
+		return
+	}
+	printEstimate(out, cfg, est)
+}
+
+// printBackupTree prints items as an indented directory tree with aligned
+// size and method columns
+func printBackupTree(out io.Writer, items []plannedItem) {
+	type line struct {
+		label  string
+		detail string
+	}
+	var lines []line
+	var previous []string
+	for _, item := range items {
+		parts := strings.Split(item.BackupPath, "/")
+		dirs := parts[:len(parts)-1]
+
+		// Print the directories not shared with the previous item
+		shared := 0
+		for shared < len(dirs) && shared < len(previous) && dirs[shared] == previous[shared] {
+			shared++
+		}
+		for depth := shared; depth < len(dirs); depth++ {
+			lines = append(lines, line{label: strings.Repeat("  ", depth+1) + dirs[depth] + "/"})
+		}
+		previous = dirs
+
+		label := strings.Repeat("  ", len(dirs)+1) + parts[len(parts)-1]
+		lines = append(lines, line{label: label, detail: describePlan(item)})
+	}
+	lines = append(lines, line{label: "  " + manifest.FileName})
+
+	width := 0
+	for _, l := range lines {
+		width = max(width, utils.DisplayWidth(l.label))
+	}
+	for _, l := range lines {
+		if l.detail == "" {
+			fmt.Fprintln(out, l.label)
+			continue
+		}
+		padding := strings.Repeat(" ", width-utils.DisplayWidth(l.label))
+		fmt.Fprintf(out, "%s%s  %s\n", l.label, padding, l.detail)
+	}
+}
+
+// describePlan formats the type, size and backup method of an item
+func describePlan(item plannedItem) string {
+	detail := fmt.Sprintf("%-11s %10s  ", item.Info.Type.String(), utils.FormatBytes(item.Info.Size))
+	if item.Err != nil {
+		return detail + "would fail: " + item.Err.Error()
+	}
+	detail += item.Plan.Method
+	if item.Plan.Fallback != "" {
+		detail += ", fallback " + item.Plan.Fallback
+	}
+	if item.Info.Encrypted {
+		detail += " (encrypted: checksum verification only)"
+	}
+	if item.Plan.LockInfo != "" {
+		detail += " (locked: " + item.Plan.LockInfo + ")"
+	}
+	if len(item.Info.Attachments) > 0 {
+		names := make([]string, 0, len(item.Info.Attachments))
+		for _, attachment := range item.Info.Attachments {
+			names = append(names, filepath.Base(attachment))
+		}
+		detail += " + attached " + strings.Join(names, ", ")
+	}
+	return detail
+}
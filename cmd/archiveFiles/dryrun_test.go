@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+func TestPrintDryRunPlan(t *testing.T) {
+	sourceDir := filepath.Join(t.TempDir(), "source")
+	files := map[string]string{
+		"app.log":                           "log line\n",
+		filepath.Join("logs", "server.log"): "log line\n",
+		filepath.Join("data", "app.db"):     "SQLite format 3\x00",
+	}
+	var databases []types.DatabaseInfo
+	for relPath, content := range files {
+		fullPath := filepath.Join(sourceDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dbType := types.DatabaseTypeLogFile
+		if strings.HasSuffix(relPath, ".db") {
+			dbType = types.DatabaseTypeSQLite
+		}
+		databases = append(databases, types.DatabaseInfo{
+			Path:       fullPath,
+			Type:       dbType,
+			Name:       filepath.ToSlash(relPath),
+			SourceRoot: sourceDir,
+			Size:       int64(len(content)),
+		})
+	}
+
+	cfg := &types.Config{Method: constants.MethodCheckpoint, Compress: true}
+	var out bytes.Buffer
+	printDryRunPlan(&out, cfg, "/backups/run", databases)
+
+	want := []string{
+		"Backup plan for /backups/run:\n  source/\n    app.log ",
+		"\n    data/\n      app.db ",
+		"\n    logs/\n      server.log",
+		"\n  manifest.json\n",
+		"Projected archive:",
+	}
+	for _, s := range want {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Plan is missing %q:\n%s", s, out.String())
+		}
+	}
+	if strings.Count(out.String(), "file-copy") != 3 {
+		t.Errorf("Expected a file-copy method for each item:\n%s", out.String())
+	}
+}
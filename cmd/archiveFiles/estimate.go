@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// estimate is the projected cost of a backup run
+type estimate struct {
+	Items         int
+	TotalSize     int64
+	ByType        map[string]typeTotal
+	Ratio         float64 // Estimated compressed / raw size
+	SampledBytes  int64
+	ArchiveSize   int64         // Projected archive size (0 without -compress)
+	Duration      time.Duration // Expected backup duration (0 = unknown)
+	HistoryRuns   int           // Catalog runs the duration is based on
+	RequiredSpace int64         // Staging directory plus archive
+	SpacePath     string        // Existing directory the free space was measured at
+	FreeSpace     uint64
+	FreeSpaceOK   bool // Whether free space could be measured
+}
+
+// typeTotal counts the items of one type
+type typeTotal struct {
+	Count int
+	Size  int64
+}
+
+// runEstimate implements the estimate subcommand: it runs discovery and
+// reports what a backup would cost without writing anything. It returns 1
+// when the destination does not have enough free space.
+func runEstimate(ctx context.Context, cfg *types.Config, out io.Writer) int {
+	discovered, err := discoverSources(ctx, cfg, nil)
+	if err != nil {
+		fmt.Fprintf(out, "Discovery failed: %v\n", err)
+		return 1
+	}
+	if len(discovered.Databases) == 0 {
+		fmt.Fprintln(out, "No databases or files found to archive")
+		return 1
+	}
+
+	est, err := estimateBackup(cfg, discovered.Databases)
+	if err != nil {
+		fmt.Fprintf(out, "Estimate failed: %v\n", err)
+		return 1
+	}
+	printEstimate(out, cfg, est)
+
+	if est.FreeSpaceOK && uint64(est.RequiredSpace) > est.FreeSpace {
+		return 1
+	}
+	return 0
+}
+
+// estimateBackup computes the estimate for a set of discovered items
+func estimateBackup(cfg *types.Config, databases []types.DatabaseInfo) (estimate, error) {
+	est := estimate{Items: len(databases), ByType: map[string]typeTotal{}}
+
+	paths := make([]string, 0, len(databases))
+	for _, db := range databases {
+		est.TotalSize += db.Size
+		total := est.ByType[db.Type.String()]
+		total.Count++
+		total.Size += db.Size
+		est.ByType[db.Type.String()] = total
+		paths = append(paths, db.Path)
+		paths = append(paths, db.Attachments...)
+	}
+
+	ratio, sampled, err := compress.EstimateRatio(paths, constants.EstimateSampleBytes)
+	if err != nil {
+		return est, err
+	}
+	est.Ratio = ratio
+	est.SampledBytes = sampled
+
+	// The staging directory and the archive exist side by side until the
+	// staging directory is removed after compression
+	est.RequiredSpace = est.TotalSize
+	if cfg.Compress {
+		est.ArchiveSize = int64(float64(est.TotalSize) * ratio)
+		est.RequiredSpace += est.ArchiveSize
+	}
+
+	if cfg.CatalogPath != "" {
+		backupCatalog, err := catalog.Load(cfg.CatalogPath)
+		if err != nil {
+			return est, err
+		}
+		throughput, runs := backupCatalog.InNamespace(cfg.Namespace).Throughput(constants.AnomalyWindow)
+		if runs > 0 && throughput > 0 {
+			est.Duration = time.Duration(float64(est.TotalSize) / throughput * float64(time.Second))
+			est.HistoryRuns = runs
+		}
+	}
+
+	backupPath := utils.ReplaceDateVars(cfg.BackupPath)
+	if backupPath == "" {
+		backupPath = "."
+	}
+	est.SpacePath = existingAncestor(backupPath)
+	est.FreeSpace, est.FreeSpaceOK = utils.FreeSpace(est.SpacePath)
+	return est, nil
+}
+
+// existingAncestor returns path or its nearest existing parent directory
+func existingAncestor(path string) string {
+	path, _ = filepath.Abs(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// printEstimate writes a human-readable estimate
+func printEstimate(out io.Writer, cfg *types.Config, est estimate) {
+	fmt.Fprintf(out, "Items:               %d\n", est.Items)
+
+	typeNames := make([]string, 0, len(est.ByType))
+	for name := range est.ByType {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		total := est.ByType[name]
+		fmt.Fprintf(out, "  %-18s %d (%s)\n", name+":", total.Count, utils.FormatBytes(total.Size))
+	}
+
+	fmt.Fprintf(out, "Total size:          %s\n", utils.FormatBytes(est.TotalSize))
+	if cfg.Compress {
+		fmt.Fprintf(out, "Projected archive:   ~%s (%.0f%% of source, sampled %s)\n",
+			utils.FormatBytes(est.ArchiveSize), est.Ratio*100, utils.FormatBytes(est.SampledBytes))
+	}
+
+	switch {
+	case est.HistoryRuns > 0:
+		fmt.Fprintf(out, "Expected duration:   ~%s (from %d earlier run(s))\n", utils.FormatDuration(est.Duration), est.HistoryRuns)
+	case cfg.CatalogPath == "":
+		fmt.Fprintln(out, "Expected duration:   unknown (use -catalog for run history)")
+	default:
+		fmt.Fprintln(out, "Expected duration:   unknown (no timed runs in the catalog yet)")
+	}
+
+	fmt.Fprintf(out, "Required free space: %s\n", utils.FormatBytes(est.RequiredSpace))
+	if !est.FreeSpaceOK {
+		fmt.Fprintf(out, "Available:           unknown at %s\n", est.SpacePath)
+		return
+	}
+	fmt.Fprintf(out, "Available:           %s at %s\n", utils.FormatBytes(int64(est.FreeSpace)), est.SpacePath)
+	if uint64(est.RequiredSpace) > est.FreeSpace {
+		fmt.Fprintln(out, "⚠️  Not enough free space for this backup")
+	}
+}
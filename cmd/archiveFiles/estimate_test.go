@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/types"
+)
+
+func TestEstimateBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "app.log")
+	if err := os.WriteFile(logPath, bytes.Repeat([]byte("request handled\n"), 10000), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	databases := []types.DatabaseInfo{
+		{Path: logPath, Name: "app.log", Type: types.DatabaseTypeLogFile, Size: 160000},
+	}
+
+	catalogPath := filepath.Join(tempDir, "catalog.json")
+	history := &catalog.Catalog{}
+	history.AddRun(catalog.Run{
+		Time:     time.Now().UTC(),
+		Duration: 2,
+		Items:    []catalog.ItemRecord{{SourcePath: logPath, Size: 80000}},
+	})
+	if err := history.Save(catalogPath); err != nil {
+		t.Fatalf("Failed to save catalog: %v", err)
+	}
+
+	cfg := &types.Config{
+		BackupPath:  filepath.Join(tempDir, "not", "yet", "created"),
+		Compress:    true,
+		CatalogPath: catalogPath,
+	}
+	est, err := estimateBackup(cfg, databases)
+	if err != nil {
+		t.Fatalf("estimateBackup failed: %v", err)
+	}
+
+	if est.Items != 1 || est.TotalSize != 160000 || est.ByType["LogFile"].Count != 1 {
+		t.Errorf("Unexpected totals: %+v", est)
+	}
+	if est.ArchiveSize <= 0 || est.ArchiveSize >= est.TotalSize {
+		t.Errorf("ArchiveSize = %d, expected a compressed projection", est.ArchiveSize)
+	}
+	if est.RequiredSpace != est.TotalSize+est.ArchiveSize {
+		t.Errorf("RequiredSpace = %d, want staging plus archive", est.RequiredSpace)
+	}
+	// 80000 bytes in 2s is 40000 bytes/s, so 160000 bytes take 4s
+	if est.HistoryRuns != 1 || est.Duration != 4*time.Second {
+		t.Errorf("Duration = %v from %d runs, want 4s from 1 run", est.Duration, est.HistoryRuns)
+	}
+	if est.SpacePath != tempDir {
+		t.Errorf("SpacePath = %s, want nearest existing directory %s", est.SpacePath, tempDir)
+	}
+
+	var out bytes.Buffer
+	printEstimate(&out, cfg, est)
+	for _, want := range []string{"Items:", "LogFile:", "Projected archive:", "Expected duration:   ~", "Required free space:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/fleet"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/utils"
+)
+
+// fleetReport is the consolidated report of a fleet run, written next to
+// the archives and, with -json, to stdout
+type fleetReport struct {
+	Status          string            `json:"status"` // succeeded, failed (no host succeeded), partial (some hosts failed) or anomalous
+	RunID           string            `json:"run_id"`
+	ArchiveDir      string            `json:"archive_dir"`
+	Hosts           []fleetHostReport `json:"hosts"`
+	FailedHosts     int               `json:"failed_hosts"`
+	Items           int               `json:"items"`   // Items backed up across all hosts
+	Failed          int               `json:"failed"`  // Items that failed on hosts whose run succeeded
+	Skipped         int               `json:"skipped"` // Items skipped on hosts whose run succeeded
+	SizeAnomalies   int               `json:"size_anomalies"`
+	StartedAt       time.Time         `json:"started_at"`
+	FinishedAt      time.Time         `json:"finished_at"`
+	DurationSeconds float64           `json:"duration_seconds"`
+}
+
+// fleetHostReport is the outcome of the agent run on one host
+type fleetHostReport struct {
+	Host            string  `json:"host"`
+	Status          string  `json:"status"` // succeeded or failed
+	ArchivePath     string  `json:"archive_path,omitempty"`
+	ManifestSHA256  string  `json:"manifest_sha256,omitempty"` // From the footer of the received archive
+	Items           int     `json:"items"`
+	Failed          int     `json:"failed"`
+	Skipped         int     `json:"skipped"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+
+	manifestItems []manifest.Item // Items of the host's manifest, for the catalog
+}
+
+// runFleet implements the fleet subcommand: it backs up every host of a
+// fleet config through the remote agent, several hosts at once, and
+// consolidates the results into one report and one catalog run
+func runFleet(args []string, stdout, stderr io.Writer) int {
+	fleetCmd := flag.NewFlagSet("fleet", flag.ExitOnError)
+	configPath := fleetCmd.String("config", "", "Fleet config file listing the hosts and their sources")
+	jsonReport := fleetCmd.Bool("json", false, "Print the consolidated report as JSON on stdout instead of the archive paths")
+	if err := fleetCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if *configPath == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles fleet -config=fleet.json [-json]")
+		return 1
+	}
+	cfg, err := fleet.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+
+	sshCommand := cfg.SSH
+	if sshCommand == "" {
+		sshCommand = "ssh"
+	}
+	sshArgs := strings.Fields(sshCommand)
+	if len(sshArgs) == 0 {
+		fmt.Fprintln(stderr, "ssh must not be empty")
+		return 1
+	}
+	agent := cfg.Agent
+	if agent == "" {
+		agent = "archiveFiles"
+	}
+	archiveDir := cfg.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = "."
+	}
+	if err := os.MkdirAll(archiveDir, constants.DirPermission); err != nil {
+		fmt.Fprintf(stderr, "Failed to create archive directory: %v\n", err)
+		return 1
+	}
+
+	started := time.Now()
+	runID := utils.NewRunID()
+	fmt.Fprintf(stderr, "Backing up %d host(s), %d at a time (run %s)...\n", len(cfg.Hosts), cfg.Workers(), runID)
+	hosts := make([]fleetHostReport, len(cfg.Hosts))
+	indexes := make([]int, len(cfg.Hosts))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	// Hosts fail on their own; one failed host does not stop the others
+	transferParts(indexes, cfg.Workers(), func(i int) error {
+		archivePath := filepath.Join(archiveDir, fleet.ArchiveName(cfg.Hosts[i].Host, runID))
+		hosts[i] = backupFleetHost(sshArgs, agent, cfg.Hosts[i], archivePath)
+		if hosts[i].Error != "" {
+			fmt.Fprintf(stderr, "%s: failed: %s\n", hosts[i].Host, hosts[i].Error)
+		} else {
+			fmt.Fprintf(stderr, "%s: %d item(s) (%d failed, %d skipped) in %s\n", hosts[i].Host, hosts[i].Items, hosts[i].Failed, hosts[i].Skipped, hosts[i].ArchivePath)
+		}
+		return nil
+	})
+
+	report := newFleetReport(runID, archiveDir, hosts, started)
+	if cfg.CatalogPath != "" {
+		anomalies, err := recordFleetRun(cfg.CatalogPath, report)
+		if err != nil {
+			fmt.Fprintf(stderr, "Failed to update backup catalog: %v\n", err)
+		}
+		if anomalies > 0 {
+			report.SizeAnomalies = anomalies
+			if report.Status == reportSucceeded {
+				report.Status = reportAnomalous
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to marshal fleet report: %v\n", err)
+		return 1
+	}
+	reportPath := filepath.Join(archiveDir, constants.FleetReportFileName)
+	if err := os.WriteFile(reportPath, append(data, '\n'), constants.FilePermission); err != nil {
+		fmt.Fprintf(stderr, "Failed to write fleet report: %v\n", err)
+	}
+	if *jsonReport {
+		fmt.Fprintf(stdout, "%s\n", data)
+	} else {
+		for _, host := range report.Hosts {
+			if host.ArchivePath != "" {
+				fmt.Fprintln(stdout, host.ArchivePath)
+			}
+		}
+	}
+	fmt.Fprintf(stderr, "Fleet run %s: %d of %d host(s) succeeded, %d item(s) backed up\n", runID, len(report.Hosts)-report.FailedHosts, len(report.Hosts), report.Items)
+
+	switch report.Status {
+	case reportSucceeded:
+		return 0
+	case reportAnomalous:
+		return constants.ExitCodeSizeAnomaly
+	default:
+		return 1
+	}
+}
+
+// backupFleetHost runs the agent on host and receives its archive at
+// archivePath, then reads the item counts from the archive's manifest
+func backupFleetHost(sshArgs []string, agent string, host fleet.Host, archivePath string) fleetHostReport {
+	started := time.Now()
+	report := fleetHostReport{Host: host.Host, Status: reportFailed}
+	method := host.Method
+	if method == "" {
+		method = constants.MethodCheckpoint
+	}
+	command := strings.Join([]string{
+		shellQuote(agent), remoteAgentCommand,
+		"-sources=" + shellQuote(strings.Join(host.Sources, ",")),
+		"-method=" + shellQuote(method),
+		"-log-level=warning",
+	}, " ")
+
+	footer, err := fetchRemoteArchive(sshArgs, host.Host, command, archivePath)
+	if err == nil {
+		report.ArchivePath = archivePath
+		report.ManifestSHA256 = footer.ManifestSHA256
+		var data []byte
+		if data, err = readArchiveManifest(archivePath); err == nil {
+			var m *manifest.Manifest
+			if m, err = manifest.Parse(data); err == nil {
+				report.Status = reportSucceeded
+				report.manifestItems = m.Items
+				for _, item := range m.Items {
+					switch item.Status {
+					case manifest.StatusOK:
+						report.Items++
+					case manifest.StatusFailed:
+						report.Failed++
+					case manifest.StatusSkipped:
+						report.Skipped++
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.DurationSeconds = time.Since(started).Seconds()
+	return report
+}
+
+// newFleetReport totals the host reports of a fleet run
+func newFleetReport(runID, archiveDir string, hosts []fleetHostReport, started time.Time) fleetReport {
+	report := fleetReport{
+		Status:     reportSucceeded,
+		RunID:      runID,
+		ArchiveDir: archiveDir,
+		Hosts:      hosts,
+		StartedAt:  started.UTC(),
+		FinishedAt: time.Now().UTC(),
+	}
+	report.DurationSeconds = report.FinishedAt.Sub(report.StartedAt).Seconds()
+	for _, host := range hosts {
+		if host.Status == reportFailed {
+			report.FailedHosts++
+			continue
+		}
+		report.Items += host.Items
+		report.Failed += host.Failed
+		report.Skipped += host.Skipped
+	}
+	switch {
+	case report.FailedHosts == len(hosts):
+		report.Status = reportFailed
+	case report.FailedHosts > 0:
+		report.Status = reportPartial
+	}
+	return report
+}
+
+// recordFleetRun adds the fleet run to the catalog as one run holding the
+// items of every host, with source paths prefixed by their host, and
+// returns the number of size anomalies against earlier fleet runs
+func recordFleetRun(catalogPath string, report fleetReport) (int, error) {
+	backupCatalog, err := catalog.Load(catalogPath)
+	if err != nil {
+		return 0, err
+	}
+	run := catalog.Run{
+		RunID:      report.RunID,
+		Time:       report.FinishedAt,
+		BackupPath: report.ArchiveDir,
+		Duration:   report.DurationSeconds,
+	}
+	for _, host := range report.Hosts {
+		run.Hosts = append(run.Hosts, host.Host)
+		for _, item := range host.manifestItems {
+			if item.Status != manifest.StatusOK {
+				continue
+			}
+			run.Items = append(run.Items, catalog.ItemRecord{
+				SourceRoot: host.Host + ":" + item.SourceRoot,
+				SourcePath: host.Host + ":" + item.SourcePath,
+				Type:       item.Type,
+				Size:       item.BackupSize,
+
+				Classifications: item.Classifications,
+			})
+		}
+	}
+
+	anomalies := backupCatalog.DetectSizeAnomalies(run, constants.AnomalyWindow, float64(constants.DefaultSizeDropThreshold)/100)
+	backupCatalog.AddRun(run)
+	return len(anomalies), backupCatalog.Save(catalogPath)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+)
+
+// fakeAgent writes an agent script that streams archive, or fails for
+// sources containing "missing" like the agent does for a missing source
+func fakeAgent(t *testing.T, archive string) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "agent")
+	content := fmt.Sprintf("#!/bin/sh\ncase \"$*\" in *missing*) echo 'no databases found' >&2; exit 1;; esac\ncat %s\n", shellQuote(archive))
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestRunFleet(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backup")
+	if err := os.MkdirAll(filepath.Join(backupDir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, "data", "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New(constants.MethodCheckpoint)
+	m.AddItem(manifest.Item{Name: "app.log", SourceRoot: "/data", SourcePath: "/data/app.log", BackupPath: "data/app.log", BackupSize: 9, Status: manifest.StatusOK})
+	m.AddItem(manifest.Item{Name: "broken.db", SourcePath: "/data/broken.db", Status: manifest.StatusFailed})
+	if err := m.Write(filepath.Join(backupDir, manifest.FileName)); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "agent.tar.gz")
+	if err := compress.CompressDirectory(backupDir, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	archiveDir := filepath.Join(dir, "fleet")
+	catalogPath := filepath.Join(dir, "catalog.json")
+	writeFleetConfig := func(hosts string) string {
+		path := filepath.Join(dir, "fleet.json")
+		content := fmt.Sprintf(`{"ssh": %q, "agent": %q, "archive_dir": %q, "catalog_path": %q, "hosts": [%s]}`,
+			fakeSSH(t)[0], fakeAgent(t, archive), archiveDir, catalogPath, hosts)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	configPath := writeFleetConfig(`{"host": "backup@db1", "sources": ["/data"]}, {"host": "db2", "sources": ["/data", "/srv"]}`)
+	var stdout, stderr bytes.Buffer
+	if code := runFleet([]string{"-config", configPath, "-json"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+	var report fleetReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse report %q: %v", stdout.String(), err)
+	}
+	if report.Status != reportSucceeded || len(report.Hosts) != 2 || report.Items != 2 || report.Failed != 2 || report.FailedHosts != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	for _, host := range report.Hosts {
+		if _, err := os.Stat(host.ArchivePath); err != nil || host.ManifestSHA256 == "" {
+			t.Errorf("host %s: archive %s (%v), manifest digest %q", host.Host, host.ArchivePath, err, host.ManifestSHA256)
+		}
+	}
+	if filepath.Base(report.Hosts[0].ArchivePath) != "db1_"+report.RunID+".tar.gz" {
+		t.Errorf("archive of backup@db1 = %s", report.Hosts[0].ArchivePath)
+	}
+	if _, err := os.Stat(filepath.Join(archiveDir, constants.FleetReportFileName)); err != nil {
+		t.Errorf("fleet report not written: %v", err)
+	}
+
+	// The whole fleet is one catalog run
+	backupCatalog, err := catalog.Load(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backupCatalog.Runs) != 1 {
+		t.Fatalf("catalog has %d run(s), want 1", len(backupCatalog.Runs))
+	}
+	run := backupCatalog.Runs[0]
+	if run.RunID != report.RunID || strings.Join(run.Hosts, ",") != "backup@db1,db2" || len(run.Items) != 2 || run.Items[0].SourcePath != "backup@db1:/data/app.log" {
+		t.Errorf("catalog run = %+v", run)
+	}
+
+	// A failed host does not stop the others, but fails the fleet run
+	configPath = writeFleetConfig(`{"host": "db1", "sources": ["/data"]}, {"host": "db3", "sources": ["/missing"]}`)
+	stdout.Reset()
+	stderr.Reset()
+	if code := runFleet([]string{"-config", configPath}, &stdout, &stderr); code != 1 {
+		t.Errorf("exit code = %d, want 1 for a failed host", code)
+	}
+	if !strings.Contains(stderr.String(), "db3: failed") || strings.Count(stdout.String(), ".tar.gz") != 1 {
+		t.Errorf("stdout %q, stderr %q, want the archive of db1 and the failure of db3", stdout.String(), stderr.String())
+	}
+}
+
+func TestNewFleetReport(t *testing.T) {
+	ok := fleetHostReport{Host: "db1", Status: reportSucceeded, Items: 3, Failed: 1}
+	failed := fleetHostReport{Host: "db2", Status: reportFailed, Error: "remote agent failed"}
+	for _, tt := range []struct {
+		hosts []fleetHostReport
+		want  string
+	}{
+		{[]fleetHostReport{ok, ok}, reportSucceeded},
+		{[]fleetHostReport{ok, failed}, reportPartial},
+		{[]fleetHostReport{failed}, reportFailed},
+	} {
+		report := newFleetReport("run", "/backups", tt.hosts, time.Now())
+		if report.Status != tt.want {
+			t.Errorf("status = %s for %+v, want %s", report.Status, tt.hosts, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/docker"
+	"archiveFiles/internal/utils"
+)
+
+// Exit codes of check-freshness, following the Nagios plugin convention
+const (
+	freshnessOK       = 0
+	freshnessCritical = 2 // A source has no backup recent enough
+	freshnessUnknown  = 3 // The check itself could not run
+)
+
+// runCheckFreshness implements "check-freshness": it reports whether every
+// configured source was backed up successfully within -max-age, according
+// to the catalog. The verdict is a single line on stdout for monitoring.
+func runCheckFreshness(args []string, stdout, stderr io.Writer) int {
+	checkCmd := flag.NewFlagSet("check-freshness", flag.ExitOnError)
+	configFile := checkCmd.String("config", "", "JSON configuration file naming the sources and the catalog (default: search standard locations)")
+	catalogPath := checkCmd.String("catalog", "", "Catalog file (overrides catalog_path from the config)")
+	sources := checkCmd.String("sources", "", "Comma-separated sources to check (overrides source_paths from the config)")
+	namespace := checkCmd.String("namespace", "", "Tenant whose runs count (overrides namespace from the config)")
+	maxAge := checkCmd.String("max-age", "26h", "Oldest acceptable last successful backup, e.g. 26h or 2d")
+	if err := checkCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return freshnessUnknown
+	}
+	age, err := parseAge(*maxAge)
+	if err != nil {
+		fmt.Fprintf(stdout, "UNKNOWN: invalid -max-age: %v\n", err)
+		return freshnessUnknown
+	}
+
+	var sourcePaths []string
+	if *configFile == "" {
+		*configFile = config.FindDefaultConfig()
+	}
+	if *configFile != "" {
+		cfg, err := config.LoadConfigFromJSON(*configFile)
+		if err != nil {
+			fmt.Fprintf(stdout, "UNKNOWN: %v\n", err)
+			return freshnessUnknown
+		}
+		sourcePaths = cfg.SourcePaths
+		if *catalogPath == "" {
+			*catalogPath = cfg.CatalogPath
+		}
+		if *namespace == "" {
+			*namespace = cfg.Namespace
+		}
+	}
+	if *sources != "" {
+		sourcePaths = nil
+		for _, source := range strings.Split(*sources, ",") {
+			if source = strings.TrimSpace(source); source != "" {
+				sourcePaths = append(sourcePaths, source)
+			}
+		}
+	}
+	if *catalogPath == "" || len(sourcePaths) == 0 {
+		fmt.Fprintln(stderr, "Usage: archiveFiles check-freshness [-config=file] [-catalog=catalog.json] [-sources=a,b] [-namespace=name] [-max-age=26h]")
+		fmt.Fprintln(stdout, "UNKNOWN: no catalog or no sources configured")
+		return freshnessUnknown
+	}
+
+	backupCatalog, err := catalog.Load(*catalogPath)
+	if err != nil {
+		fmt.Fprintf(stdout, "UNKNOWN: %v\n", err)
+		return freshnessUnknown
+	}
+
+	stale := checkFreshness(backupCatalog.InNamespace(*namespace), sourcePaths, time.Now().Add(-age), stderr)
+	if len(stale) > 0 {
+		fmt.Fprintf(stdout, "CRITICAL: %d of %d source(s) not backed up within %s: %s\n", len(stale), len(sourcePaths), *maxAge, strings.Join(stale, ", "))
+		return freshnessCritical
+	}
+	fmt.Fprintf(stdout, "OK: %d source(s) backed up within %s\n", len(sourcePaths), *maxAge)
+	return freshnessOK
+}
+
+// checkFreshness returns the sources whose last successful backup is older
+// than cutoff, or that were never backed up. The last backup of every
+// source is written to details.
+func checkFreshness(backupCatalog *catalog.Catalog, sourcePaths []string, cutoff time.Time, details io.Writer) []string {
+	var stale []string
+	for _, source := range sourcePaths {
+		last, found := backupCatalog.LastBackup(sourceMatcher(source))
+		switch {
+		case !found:
+			fmt.Fprintf(details, "%s: never backed up\n", source)
+			stale = append(stale, source)
+		case last.Before(cutoff):
+			fmt.Fprintf(details, "%s: last backed up %s ago (%s)\n", source, utils.FormatDuration(time.Since(last)), last.Local().Format(time.RFC3339))
+			stale = append(stale, source)
+		default:
+			fmt.Fprintf(details, "%s: last backed up %s ago\n", source, utils.FormatDuration(time.Since(last)))
+		}
+	}
+	return stale
+}
+
+// sourceMatcher accepts the catalog items that were discovered in source
+func sourceMatcher(source string) func(catalog.ItemRecord) bool {
+	// Runs record docker volumes without their options
+	root := source
+	if volume, err := docker.ParseVolumeSource(source); err == nil {
+		root = volume.String()
+	}
+	return func(item catalog.ItemRecord) bool {
+		if item.SourceRoot != "" {
+			return item.SourceRoot == root
+		}
+		// Catalogs written before source roots were recorded
+		return item.SourcePath == source || strings.HasPrefix(item.SourcePath, source+string(filepath.Separator))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/catalog"
+)
+
+func TestRunCheckFreshness(t *testing.T) {
+	catalogPath := filepath.Join(t.TempDir(), "catalog.json")
+	now := time.Now().UTC()
+	backupCatalog := &catalog.Catalog{}
+	backupCatalog.AddRun(catalog.Run{
+		Time:  now.Add(-50 * time.Hour),
+		Items: []catalog.ItemRecord{{SourceRoot: "/data/orders", SourcePath: "/data/orders/db", Size: 10}},
+	})
+	backupCatalog.AddRun(catalog.Run{
+		Time: now.Add(-2 * time.Hour),
+		Items: []catalog.ItemRecord{
+			{SourceRoot: "/data/analytics", SourcePath: "/data/analytics/events.db", Size: 10},
+			{SourceRoot: "docker-volume://pgdata", SourcePath: "/var/lib/docker/volumes/pgdata/_data/base", Size: 10},
+		},
+	})
+	// A catalog entry written before source roots were recorded
+	backupCatalog.AddRun(catalog.Run{
+		Time:  now.Add(-3 * time.Hour),
+		Items: []catalog.ItemRecord{{SourcePath: "/data/legacy/app.db", Size: 10}},
+	})
+	if err := backupCatalog.Save(catalogPath); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sources  string
+		maxAge   string
+		wantCode int
+		wantOut  string
+	}{
+		{"Fresh", "/data/analytics,docker-volume://pgdata?pause=postgres,/data/legacy", "26h", freshnessOK, "OK: 3 source(s)"},
+		{"Stale", "/data/analytics,/data/orders", "26h", freshnessCritical, "CRITICAL: 1 of 2 source(s) not backed up within 26h: /data/orders"},
+		{"Days", "/data/orders", "3d", freshnessOK, "OK: 1 source(s)"},
+		{"Never backed up", "/data/new", "26h", freshnessCritical, "CRITICAL: 1 of 1"},
+		{"Prefix is not a parent", "/data/ana", "26h", freshnessCritical, "CRITICAL"},
+		{"Invalid age", "/data/orders", "soon", freshnessUnknown, "UNKNOWN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runCheckFreshness([]string{"-catalog", catalogPath, "-sources", tt.sources, "-max-age", tt.maxAge}, &stdout, &stderr)
+			if code != tt.wantCode || !strings.HasPrefix(stdout.String(), tt.wantOut) {
+				t.Errorf("check-freshness = %d %q, want %d %q (details: %s)", code, stdout.String(), tt.wantCode, tt.wantOut, stderr.String())
+			}
+		})
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runCheckFreshness([]string{"-config", filepath.Join(t.TempDir(), "missing.json")}, &stdout, &stderr); code != freshnessUnknown {
+		t.Errorf("Missing config: exit code %d, want %d", code, freshnessUnknown)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// runGC implements "gc": it removes backup directories and temporary
+// archives that crashed runs left behind in a destination directory
+func runGC(args []string, stdout, stderr io.Writer) int {
+	gcCmd := flag.NewFlagSet("gc", flag.ContinueOnError)
+	path := gcCmd.String("path", "", "Destination directory holding the backups")
+	olderThan := gcCmd.String("older-than", "7d", "Only remove leftovers older than this, e.g. 7d or 12h")
+	dryRun := gcCmd.Bool("dry-run", false, "List what would be removed without removing it")
+	yes := gcCmd.Bool("yes", false, "Do not ask before removing leftovers")
+	if err := gcCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if *path == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles gc -path=destination_directory [-older-than=7d] [-dry-run] [-yes]")
+		return 1
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid -older-than: %v\n", err)
+		return 1
+	}
+
+	if info, err := os.Stat(*path); err != nil || !info.IsDir() {
+		fmt.Fprintf(stderr, "%s is not a directory\n", *path)
+		return 1
+	}
+	if err := refuseSourceLike(*path, nil); err != nil {
+		fmt.Fprintf(stderr, "gc failed: %v\n", err)
+		return 1
+	}
+
+	// Holding the destination's run lock keeps runs from starting while
+	// their directories are judged, and fails while one is active
+	runLock, err := utils.AcquireRunLock(*path, "gc")
+	if err != nil {
+		fmt.Fprintf(stderr, "gc failed: %v\n", err)
+		return 1
+	}
+	defer runLock.Release()
+
+	stale, err := findStaleLeftovers(*path, time.Now().Add(-age), stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "gc failed: %v\n", err)
+		return 1
+	}
+
+	if !*dryRun && len(stale) > 0 && !confirm(fmt.Sprintf("Remove %d leftover(s) from %s?", len(stale), *path), *yes) {
+		fmt.Fprintln(stderr, "Nothing removed")
+		return 1
+	}
+
+	failed := false
+	for _, leftover := range stale {
+		if !*dryRun {
+			if err := os.RemoveAll(leftover); err != nil {
+				fmt.Fprintf(stderr, "Failed to remove %s: %v\n", leftover, err)
+				failed = true
+				continue
+			}
+		}
+		fmt.Fprintln(stdout, leftover)
+	}
+	if *dryRun {
+		fmt.Fprintf(stderr, "%d leftover(s) would be removed\n", len(stale))
+	} else {
+		fmt.Fprintf(stderr, "Removed %d leftover(s)\n", len(stale))
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// findStaleLeftovers returns the entries of dir older than cutoff that an
+// unfinished run left behind: backup directories still carrying a run
+// marker, and archives that were never renamed into place. Directories
+// without a marker are never considered, whatever their name, and of the
+// files only those named like a temporary archive, e.g. backup.tar.gz.tmp.
+func findStaleLeftovers(dir string, cutoff time.Time, stderr io.Writer) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", dir, err)
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			marker, err := utils.ReadRunMarker(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "Skipping %s: %v\n", path, err)
+				continue
+			}
+			if marker.CreatedAt.Before(cutoff) {
+				stale = append(stale, path)
+			}
+			continue
+		}
+
+		if !entry.Type().IsRegular() || !isTempArchiveName(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			stale = append(stale, path)
+		}
+	}
+	return stale, nil
+}
+
+// isTempArchiveName reports whether name is that of an archive still being
+// written: an archive extension followed by the temporary suffix
+func isTempArchiveName(name string) bool {
+	for _, format := range []string{constants.CompressionGzip, constants.CompressionXz, constants.CompressionBzip2, constants.CompressionNone} {
+		suffix := compress.ArchiveExtension(format) + constants.TempArchiveSuffix
+		if len(name) > len(suffix) && strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAge parses a duration, additionally accepting whole days such as 7d
+func parseAge(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if age < 0 {
+		return 0, fmt.Errorf("age must not be negative")
+	}
+	return age, nil
+}
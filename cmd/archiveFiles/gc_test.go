@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"0d":  0,
+	}
+	for value, want := range tests {
+		if got, err := parseAge(value); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "xd", "-1d", "-5h", "week"} {
+		if _, err := parseAge(value); err == nil {
+			t.Errorf("parseAge(%q) should fail", value)
+		}
+	}
+}
+
+func TestRunGC(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-10 * 24 * time.Hour)
+
+	// Orphaned backup from a crashed run
+	orphan := filepath.Join(dir, "backup_1")
+	if err := os.Mkdir(orphan, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeOldRunMarker(t, orphan, "aaaa1111", old)
+
+	// Run that is still young
+	recent := filepath.Join(dir, "backup_2")
+	if err := os.Mkdir(recent, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.WriteRunMarker(recent, "bbbb2222"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Completed backup and a directory that is not ours
+	for _, name := range []string{"backup_3", "photos"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(filepath.Join(dir, name), old, old)
+	}
+
+	// Archive that was never renamed into place
+	tempArchive := filepath.Join(dir, "backup_4.tar.gz.tmp")
+	if err := os.WriteFile(tempArchive, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(tempArchive, old, old)
+
+	// Temporary files of other programs
+	for _, name := range []string{"upload.tmp", "notes.txt.tmp", ".tar.gz.tmp"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("theirs"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(filepath.Join(dir, name), old, old)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runGC([]string{"-path", dir, "-dry-run"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("gc -dry-run exited with %d: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Errorf("Dry run removed %s", orphan)
+	}
+
+	stdout.Reset()
+	if code := runGC([]string{"-path", dir, "-older-than", "7d"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("gc exited with %d: %s", code, stderr.String())
+	}
+	removed := strings.Fields(stdout.String())
+	if len(removed) != 2 || removed[0] != orphan || removed[1] != tempArchive {
+		t.Errorf("gc removed %q, want %s and %s", removed, orphan, tempArchive)
+	}
+	for _, kept := range []string{recent, filepath.Join(dir, "backup_3"), filepath.Join(dir, "photos"), filepath.Join(dir, "upload.tmp"), filepath.Join(dir, "notes.txt.tmp")} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("%s should be kept: %v", kept, err)
+		}
+	}
+}
+
+// writeOldRunMarker writes a run marker with the given creation time
+func writeOldRunMarker(t *testing.T, dir, runID string, createdAt time.Time) {
+	t.Helper()
+	data, err := json.Marshal(utils.RunMarker{RunID: runID, CreatedAt: createdAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, constants.RunMarkerFileName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
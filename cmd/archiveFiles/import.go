@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"archiveFiles/internal/backup"
+)
+
+// runImport implements "import": it rebuilds a RocksDB database from an
+// export written with -rocksdb-export
+func runImport(args []string, stdout, stderr io.Writer) int {
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	input := importCmd.String("input", "", "Export directory holding export.json and the exported files")
+	target := importCmd.String("target", "", "Path of the RocksDB database to create; must not exist yet")
+	if err := importCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if *input == "" || *target == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles import -input=export_directory -target=new_database_path")
+		return 1
+	}
+	if _, err := os.Stat(*target); err == nil {
+		fmt.Fprintf(stderr, "Error: %s already exists; import only creates new databases\n", *target)
+		return 1
+	}
+
+	metadata, err := backup.ReadExportMetadata(*input)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	count, err := backup.ImportRocksDB(*input, *target)
+	if err != nil {
+		fmt.Fprintf(stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Imported %d records from a %s export (sequence number %d) into %s\n",
+		count, metadata.Format, metadata.SequenceNumber, *target)
+	return 0
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// inventoryRun lists the discovered items in a manifest at backupPath and
+// in the catalog without copying any data. Item sizes are those discovery
+// found; with inventory_hashes every file is hashed as well. The items that
+// drifted since the previous inventory in the catalog are logged.
+func inventoryRun(ctx context.Context, cfg *types.Config, runID, backupPath string, discovered discoveredSources, progressTracker *progress.ProgressTracker, started time.Time, result runResult) (runResult, error) {
+	inventory := manifest.New(cfg.Method)
+	inventory.RunID = runID
+	inventory.Namespace = cfg.Namespace
+	inventory.SkippedPaths = discovered.SkippedPaths
+	inventory.Inventory = true
+
+	for _, db := range discovered.Databases {
+		if ctx.Err() != nil {
+			logger.Warning("Inventory was cancelled: %v", ctx.Err())
+			return result, ctx.Err()
+		}
+		progressTracker.SetCurrentFile(db.Name)
+		item := manifestItem(db, cfg.Namespace, manifest.StatusOK, nil, nil)
+		if cfg.InventoryHashes {
+			checksums, err := inventoryChecksums(db.Path)
+			if err != nil {
+				logger.Error("Failed to hash %s: %v", db.Path, err)
+				item = manifestItem(db, cfg.Namespace, manifest.StatusFailed, err, nil)
+				result.Failed++
+			} else {
+				item.Checksums = checksums
+			}
+		}
+		if item.Status == manifest.StatusOK {
+			result.Items++
+		}
+		inventory.AddItem(item)
+		progressTracker.CompleteItem(db.Size)
+	}
+	if cfg.ShowProgress() {
+		progressTracker.Finish()
+	}
+
+	manifestPath := filepath.Join(backupPath, manifest.FileName)
+	if err := inventory.Write(manifestPath); err != nil {
+		return result, fmt.Errorf("failed to write inventory manifest: %v", err)
+	}
+	if cfg.Durability != constants.DurabilityNone {
+		if err := utils.SyncFile(manifestPath); err != nil {
+			return result, fmt.Errorf("failed to sync inventory manifest: %v", err)
+		}
+	}
+	if err := utils.RemoveRunMarker(backupPath); err != nil {
+		logger.Warning("%v", err)
+	}
+
+	if cfg.CatalogPath != "" {
+		var err error
+		result.Drift, err = recordInventory(cfg, backupPath, inventory, started)
+		if err != nil {
+			logger.Warning("Failed to update backup catalog: %v", err)
+		}
+	}
+
+	logger.Info("Inventory of %d item(s) written to: %s", result.Items, manifestPath)
+	result.BackupPath = backupPath
+	return result, nil
+}
+
+// inventoryChecksums hashes the files of an item, keyed by slash-separated
+// path relative to the item's directory like the checksums of a copy. A
+// file item is keyed by its name.
+func inventoryChecksums(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	root := path
+	if !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+	checksums := make(map[string]string)
+	err = filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		sum, err := fileChecksum(filePath)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		checksums[filepath.ToSlash(relPath)] = sum
+		return nil
+	})
+	return checksums, err
+}
+
+// fileChecksum returns the hex SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// itemChecksum digests the checksums of an item's files into one, so an
+// inventory records a single checksum per item in the catalog. Items
+// without checksums get none.
+func itemChecksum(checksums map[string]string) string {
+	if len(checksums) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(checksums))
+	for path := range checksums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hash := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(hash, "%s  %s\n", checksums[path], path)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordInventory adds an inventory run to the catalog and returns the
+// number of items that drifted since the previous inventory of the
+// namespace. Inventories are not judged for size anomalies: their sizes are
+// source sizes, not backup sizes.
+func recordInventory(cfg *types.Config, backupPath string, inventory *manifest.Manifest, started time.Time) (int, error) {
+	backupCatalog, err := catalog.Load(cfg.CatalogPath)
+	if err != nil {
+		return 0, err
+	}
+
+	run := catalog.Run{
+		RunID:      inventory.RunID,
+		Namespace:  cfg.Namespace,
+		Time:       time.Now().UTC(),
+		BackupPath: backupPath,
+		Duration:   time.Since(started).Seconds(),
+		Inventory:  true,
+	}
+	for _, item := range inventory.Items {
+		if item.Status != manifest.StatusOK {
+			continue
+		}
+		run.Items = append(run.Items, catalog.ItemRecord{
+			SourceRoot: item.SourceRoot,
+			SourcePath: item.SourcePath,
+			Type:       item.Type,
+			Size:       item.Size,
+			Checksum:   itemChecksum(item.Checksums),
+
+			Classifications: item.Classifications,
+		})
+	}
+
+	var drift []catalog.Drift
+	if previous, ok := backupCatalog.InNamespace(cfg.Namespace).LastInventory(); ok {
+		drift = catalog.DetectDrift(previous, run)
+		for _, change := range drift {
+			switch change.Change {
+			case catalog.DriftAdded:
+				logger.Info("Drift: %s was added (%s)", change.SourcePath, utils.FormatBytes(change.NewSize))
+			case catalog.DriftRemoved:
+				logger.Warning("Drift: %s was removed (was %s)", change.SourcePath, utils.FormatBytes(change.OldSize))
+			default:
+				logger.Info("Drift: %s changed (%s -> %s)", change.SourcePath, utils.FormatBytes(change.OldSize), utils.FormatBytes(change.NewSize))
+			}
+		}
+		logger.Info("%d item(s) drifted since inventory %s of %s", len(drift), previous.RunID, previous.Time.Format(time.RFC3339))
+	}
+
+	backupCatalog.AddRun(run)
+	return len(drift), backupCatalog.Save(cfg.CatalogPath)
+}
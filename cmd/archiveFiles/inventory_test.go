@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+func TestRunArchive_InventoryOnly(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	appLog := filepath.Join(sourceDir, "app.log")
+	if err := os.WriteFile(appLog, []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	catalogPath := filepath.Join(tempDir, "catalog.json")
+	newConfig := func(name string) *types.Config {
+		return &types.Config{
+			SourcePaths:     []string{sourceDir},
+			BackupPath:      filepath.Join(tempDir, name),
+			Method:          constants.MethodCheckpoint,
+			LogLevel:        "error",
+			Durability:      constants.DurabilityNone,
+			HideProgress:    true,
+			Compress:        true,
+			CatalogPath:     catalogPath,
+			InventoryOnly:   true,
+			InventoryHashes: true,
+		}
+	}
+
+	result, err := runArchive(context.Background(), newConfig("first"), utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	if result.Items != 1 || result.ArchivePath != "" || result.Drift != 0 {
+		t.Errorf("result = %+v, want one item, no archive and no drift", result)
+	}
+
+	// The backup directory holds nothing but the manifest
+	entries, err := os.ReadDir(result.BackupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != manifest.FileName {
+		t.Errorf("backup directory holds %v, want only the manifest", entries)
+	}
+	m, err := manifest.Load(filepath.Join(result.BackupPath, manifest.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Inventory || len(m.Items) != 1 || m.Items[0].Size != 9 || m.Items[0].Checksums["app.log"] == "" {
+		t.Errorf("manifest = %+v, want an inventory of app.log with its checksum", m)
+	}
+
+	// The next inventory reports what drifted: a changed log of the same
+	// size, noticed by its checksum, and a new file
+	if err := os.WriteFile(appLog, []byte("log LINE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "other.log"), []byte("more\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = runArchive(context.Background(), newConfig("second"), utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	if result.Drift != 2 {
+		t.Errorf("drift = %d, want 2", result.Drift)
+	}
+	backupCatalog, err := catalog.Load(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backupCatalog.Runs) != 2 || !backupCatalog.Runs[1].Inventory {
+		t.Errorf("catalog runs = %+v, want two inventory runs", backupCatalog.Runs)
+	}
+}
+
+func TestItemChecksum(t *testing.T) {
+	if itemChecksum(nil) != "" {
+		t.Error("an item without checksums should get none")
+	}
+	a := itemChecksum(map[string]string{"000001.sst": "aa", "CURRENT": "bb"})
+	if a == "" || a != itemChecksum(map[string]string{"CURRENT": "bb", "000001.sst": "aa"}) {
+		t.Errorf("itemChecksum = %q, want a digest independent of map order", a)
+	}
+	if a == itemChecksum(map[string]string{"000001.sst": "aa", "CURRENT": "cc"}) {
+		t.Error("itemChecksum should change with a file's checksum")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+// Verification outcomes recorded in item logs
+const (
+	verificationNotRequested = "not requested"
+	verificationPassed       = "passed"
+)
+
+// itemLog collects what happened while one item was backed up. With
+// -item-logs it is written next to the item as <item>.backup.log, so an
+// archive explains its own content without the run's logs.
+type itemLog struct {
+	Item         string
+	Type         string
+	Source       string
+	Started      time.Time
+	Finished     time.Time
+	Method       string        // Step that produced the copy
+	Fallbacks    []string      // Steps that failed before it, with their errors
+	BackupTime   time.Duration // Time spent copying
+	Verification string        // passed, failed: <error>, skipped: <reason> or not requested
+	VerifyTime   time.Duration
+	Warnings     []string
+	Err          error // Why the item failed, if it did
+}
+
+// newItemLog starts the log of db
+func newItemLog(db types.DatabaseInfo) *itemLog {
+	return &itemLog{
+		Item:         db.Name,
+		Type:         db.Type.String(),
+		Source:       db.Path,
+		Started:      time.Now(),
+		Verification: verificationNotRequested,
+	}
+}
+
+// String formats the log as "key: value" lines
+func (l *itemLog) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "item: %s\n", l.Item)
+	fmt.Fprintf(&b, "type: %s\n", l.Type)
+	fmt.Fprintf(&b, "source: %s\n", l.Source)
+	fmt.Fprintf(&b, "started: %s\n", l.Started.UTC().Format(time.RFC3339Nano))
+	if l.Method != "" {
+		fmt.Fprintf(&b, "method: %s\n", l.Method)
+	}
+	for _, fallback := range l.Fallbacks {
+		fmt.Fprintf(&b, "fallback: %s\n", fallback)
+	}
+	fmt.Fprintf(&b, "backup_seconds: %.3f\n", l.BackupTime.Seconds())
+	fmt.Fprintf(&b, "verification: %s\n", l.Verification)
+	if l.VerifyTime > 0 {
+		fmt.Fprintf(&b, "verification_seconds: %.3f\n", l.VerifyTime.Seconds())
+	}
+	for _, warning := range l.Warnings {
+		fmt.Fprintf(&b, "warning: %s\n", warning)
+	}
+	fmt.Fprintf(&b, "finished: %s\n", l.Finished.UTC().Format(time.RFC3339Nano))
+	if l.Err != nil {
+		fmt.Fprintf(&b, "result: failed: %v\n", l.Err)
+	} else {
+		fmt.Fprintf(&b, "result: ok\n")
+	}
+	return b.String()
+}
+
+// write finishes the log and writes it next to the item's backup
+// directory. Nothing is written for an item whose backup never started.
+func (l *itemLog) write(itemBackupDir string) error {
+	if _, err := os.Stat(itemBackupDir); err != nil {
+		return nil
+	}
+	l.Finished = time.Now()
+	path := itemBackupDir + constants.ItemLogSuffix
+	if err := os.WriteFile(path, []byte(l.String()), constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write item log %s: %v", path, err)
+	}
+	return nil
+}
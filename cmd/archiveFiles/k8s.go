@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// k8sEvent mirrors the fields of a core/v1 Event so log collectors can
+// forward it to the Events API unchanged
+type k8sEvent struct {
+	Kind           string            `json:"kind"`
+	APIVersion     string            `json:"apiVersion"`
+	Metadata       k8sEventMeta      `json:"metadata"`
+	Type           string            `json:"type"` // Normal or Warning
+	Reason         string            `json:"reason"`
+	Message        string            `json:"message"`
+	InvolvedObject k8sObjectRef      `json:"involvedObject"`
+	Source         map[string]string `json:"source"`
+	FirstTimestamp time.Time         `json:"firstTimestamp"`
+	LastTimestamp  time.Time         `json:"lastTimestamp"`
+	Count          int               `json:"count"`
+}
+
+// k8sEventMeta is the metadata of an Event. The run ID annotation lets
+// events of one run be correlated with its logs, manifest and report.
+type k8sEventMeta struct {
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// k8sObjectRef identifies the pod running the job, from the downward API
+type k8sObjectRef struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// emitEvent writes one Event of the run runID as a JSON line
+func emitEvent(w io.Writer, runID, eventType, reason, message string) {
+	now := time.Now().UTC()
+	event := k8sEvent{
+		Kind:       "Event",
+		APIVersion: "v1",
+		Metadata: k8sEventMeta{
+			Annotations: map[string]string{constants.K8sRunIDAnnotation: runID},
+		},
+		Type:    eventType,
+		Reason:  reason,
+		Message: message,
+		InvolvedObject: k8sObjectRef{
+			Kind:      "Pod",
+			Name:      os.Getenv("POD_NAME"),
+			Namespace: os.Getenv("POD_NAMESPACE"),
+		},
+		Source:         map[string]string{"component": "archiveFiles"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		logger.Warning("Failed to emit event: %v", err)
+	}
+}
+
+// writeTerminationMessage writes the report where Kubernetes picks it up as
+// the container's termination message, shortening the error to fit the limit
+func writeTerminationMessage(path string, report runReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	// The warning count stays; every warning is listed in the manifest
+	if len(data) > constants.K8sTerminationLogLimit && report.ItemWarnings != nil {
+		report.ItemWarnings = nil
+		if data, err = json.Marshal(report); err != nil {
+			return err
+		}
+	}
+	// Escaping can make the encoded error longer than the bytes cut from it,
+	// so it is cut, on a rune boundary, until the message fits
+	message := report.Error
+	for keep := len(message); len(data) > constants.K8sTerminationLogLimit && keep > 0; {
+		keep = max(keep-(len(data)-constants.K8sTerminationLogLimit)-len("..."), 0)
+		for keep > 0 && !utf8.RuneStart(message[keep]) {
+			keep--
+		}
+		report.Error = message[:keep] + "..."
+		if data, err = json.Marshal(report); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, constants.FilePermission)
+}
+
+// runK8sJob performs a single run for a Kubernetes Job or CronJob and returns
+// the process exit code
+func runK8sJob(ctx context.Context, cfg *types.Config, signingKey ed25519.PrivateKey, events io.Writer) int {
+	interactive = false // Jobs run unattended
+	started := time.Now()
+	runID := utils.NewRunID()
+	emitEvent(events, runID, "Normal", "BackupStarted", fmt.Sprintf("Archiving %d source(s)", len(cfg.SourcePaths)))
+
+	result, err := runArchive(ctx, cfg, runID, signingKey, nil)
+	report := newRunReport(result, err, started)
+
+	exitCode := 0
+	switch report.Status {
+	case reportFailed:
+		exitCode = 1
+		if ctx.Err() != nil {
+			exitCode = 130
+		}
+		emitEvent(events, runID, "Warning", "BackupFailed", report.Error)
+	case reportPartial:
+		exitCode = constants.ExitCodePartial
+		emitEvent(events, runID, "Warning", "BackupPartial",
+			fmt.Sprintf("Backup window %s closed with %d item(s) not started; archived %d item(s)", cfg.Window, result.NotStarted, result.Items))
+	case reportAnomalous:
+		exitCode = constants.ExitCodeSizeAnomaly
+		emitEvent(events, runID, "Warning", "BackupSizeAnomaly",
+			fmt.Sprintf("%d item(s) are much smaller than in earlier backups", result.SizeAnomalies))
+	default:
+		emitEvent(events, runID, "Normal", "BackupCompleted",
+			fmt.Sprintf("Archived %d item(s) (%d failed, %d skipped) in %.0fs", result.Items, result.Failed, result.Skipped, report.DurationSeconds))
+	}
+	if err == nil && result.Failed > 0 {
+		emitEvent(events, runID, "Warning", "BackupItemsFailed", fmt.Sprintf("%d item(s) failed to back up", result.Failed))
+	}
+	if warnings := result.warningCount(); err == nil && warnings > 0 {
+		emitEvent(events, runID, "Warning", "BackupWarnings", fmt.Sprintf("%d item(s) were archived with %d warning(s)", len(result.Warnings), warnings))
+	}
+
+	terminationLog := cfg.TerminationLog
+	if terminationLog == "" {
+		terminationLog = constants.K8sTerminationLogPath
+	}
+	if err := writeTerminationMessage(terminationLog, report); err != nil {
+		logger.Warning("Failed to write termination message to %s: %v", terminationLog, err)
+	}
+
+	if report.Error != "" {
+		logger.Error("%s", report.Error)
+	}
+	return exitCode
+}
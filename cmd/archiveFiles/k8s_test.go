@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+func TestRunK8sJob(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "settings.yaml"), []byte("key: value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	terminationLog := filepath.Join(tempDir, "termination-log")
+	cfg := &types.Config{
+		SourcePaths:    []string{sourceDir},
+		BackupPath:     filepath.Join(tempDir, "backup"),
+		Method:         constants.MethodCheckpoint,
+		LogLevel:       "error",
+		Durability:     constants.DurabilityNone,
+		IncludePattern: "*.yaml",
+		K8sJob:         true,
+		TerminationLog: terminationLog,
+	}
+
+	var events bytes.Buffer
+	if code := runK8sJob(context.Background(), cfg, nil, &events); code != 0 {
+		t.Fatalf("runK8sJob exit code = %d, want 0", code)
+	}
+
+	data, err := os.ReadFile(terminationLog)
+	if err != nil {
+		t.Fatalf("Termination message not written: %v", err)
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Invalid termination message: %v", err)
+	}
+	if report.Status != "succeeded" || report.Items != 1 || report.BackupPath != cfg.BackupPath {
+		t.Errorf("Report = %+v", report)
+	}
+
+	var reasons []string
+	scanner := bufio.NewScanner(&events)
+	for scanner.Scan() {
+		var event k8sEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid event line %q: %v", scanner.Text(), err)
+		}
+		if event.Kind != "Event" || event.APIVersion != "v1" || event.InvolvedObject.Kind != "Pod" {
+			t.Errorf("Event is not Events-compatible: %+v", event)
+		}
+		if runID := event.Metadata.Annotations[constants.K8sRunIDAnnotation]; report.RunID == "" || runID != report.RunID {
+			t.Errorf("Event run ID = %q, want the report's %q", runID, report.RunID)
+		}
+		reasons = append(reasons, event.Reason)
+	}
+	if got := strings.Join(reasons, ","); got != "BackupStarted,BackupCompleted" {
+		t.Errorf("Event reasons = %s", got)
+	}
+}
+
+func TestWriteTerminationMessage_Truncates(t *testing.T) {
+	// Multi-byte runes and characters JSON escapes must not push the
+	// message over the limit or leave half a rune behind
+	for _, message := range []string{strings.Repeat("x", 10000), strings.Repeat("é", 5000), strings.Repeat("<>", 5000)} {
+		path := filepath.Join(t.TempDir(), "termination-log")
+		report := runReport{Status: "failed", Error: message}
+
+		if err := writeTerminationMessage(path, report); err != nil {
+			t.Fatalf("writeTerminationMessage failed: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > constants.K8sTerminationLogLimit {
+			t.Errorf("Termination message is %d bytes, limit is %d", len(data), constants.K8sTerminationLogLimit)
+		}
+		var decoded runReport
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Truncated message is not valid JSON: %v", err)
+		}
+		if !utf8.ValidString(decoded.Error) || !strings.HasSuffix(decoded.Error, "...") {
+			t.Errorf("Truncated error %q should be valid UTF-8 ending in ...", decoded.Error)
+		}
+	}
+}
@@ -2,23 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	stderrors "errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"archiveFiles/internal/apperr"
 	"archiveFiles/internal/backup"
+	"archiveFiles/internal/catalog"
 	"archiveFiles/internal/compress"
 	"archiveFiles/internal/config"
 	"archiveFiles/internal/constants"
 	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/docker"
+	"archiveFiles/internal/faults"
 	"archiveFiles/internal/logger"
+	"archiveFiles/internal/manifest"
 	"archiveFiles/internal/progress"
 	"archiveFiles/internal/restore"
 	"archiveFiles/internal/types"
@@ -27,22 +36,35 @@ import (
 )
 
 func main() {
+	interactive = stdinIsTerminal()
+
+	// Audited commands are recorded when they start and when they exit,
+	// whatever the log level
+	if run := startAudit(os.Args[1:], os.Stderr); run != nil {
+		audited = run
+		exit = run.exit
+		logger.SetExitFunc(run.exit)
+		defer run.finish(0)
+	}
+
 	// Handle lock subcommand
 	if len(os.Args) > 1 && os.Args[1] == "lock" {
 		lockCmd := flag.NewFlagSet("lock", flag.ExitOnError)
-		dbPath := lockCmd.String("db", "", "RocksDB database path")
+		dbPath := lockCmd.String("db", "", "RocksDB or SQLite database path")
 		duration := lockCmd.String("duration", "", "Lock duration (e.g., 30s, 5m, 1h)")
+		writeLoad := lockCmd.String("write-load", "", "Generate background writes while locked (e.g., 100/s)")
 		if err := lockCmd.Parse(os.Args[2:]); err != nil {
 			fmt.Printf("Failed to parse flags: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if *dbPath == "" {
-			fmt.Println("Usage: archiveFiles lock -db=database_path [-duration=duration]")
+			fmt.Println("Usage: archiveFiles lock -db=database_path [-duration=duration] [-write-load=N/s]")
 			fmt.Println("Examples:")
 			fmt.Println("  archiveFiles lock -db=testdata/dir1/app.db -duration=30s")
 			fmt.Println("  archiveFiles lock -db=testdata/dir1/app.db  # Lock indefinitely until Ctrl+C")
-			os.Exit(1)
+			fmt.Println("  archiveFiles lock -db=testdata/dir1/users.sqlite -duration=1m -write-load=100/s")
+			exit(1)
 		}
 
 		var lockDuration time.Duration
@@ -52,258 +74,535 @@ func main() {
 			if err != nil {
 				fmt.Printf("Invalid duration format: %v\n", err)
 				fmt.Println("Supported formats: 30s, 5m, 1h, etc.")
-				os.Exit(1)
+				exit(1)
+			}
+		}
+
+		lockOpts := utils.LockOptions{Duration: lockDuration}
+		if *writeLoad != "" {
+			var err error
+			if lockOpts.WriteLoad, err = utils.ParseWriteLoad(*writeLoad); err != nil {
+				fmt.Printf("%v\n", err)
+				exit(1)
 			}
 		}
 
-		fmt.Printf("Locking RocksDB database: %s\n", *dbPath)
+		dbType := discovery.DetectDatabaseType(*dbPath)
+		fmt.Printf("Locking %s database: %s\n", dbType.String(), *dbPath)
 		if lockDuration > 0 {
 			fmt.Printf("Lock duration: %v\n", lockDuration)
 		} else {
 			fmt.Println("Lock indefinitely, press Ctrl+C to release")
 		}
 
-		err := utils.LockRocksDB(*dbPath, lockDuration)
+		var err error
+		switch dbType {
+		case types.DatabaseTypeRocksDB:
+			err = utils.LockRocksDBWithOptions(*dbPath, lockOpts)
+		case types.DatabaseTypeSQLite:
+			err = utils.LockSQLite(*dbPath, lockOpts)
+		default:
+			err = fmt.Errorf("%s is not a RocksDB or SQLite database", *dbPath)
+		}
 		if err != nil {
 			fmt.Printf("Lock failed: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
-		os.Exit(0)
+		exit(0)
+	}
+
+	// Handle config migrate subcommand
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "migrate" {
+		exit(runConfigMigrate(os.Args[3:], os.Stdout, os.Stderr))
+	}
+
+	// Handle restore-archive subcommand
+	if len(os.Args) > 1 && os.Args[1] == "restore-archive" {
+		exit(runRestoreArchive(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle approve-restore subcommand
+	if len(os.Args) > 1 && os.Args[1] == "approve-restore" {
+		exit(runApproveRestore(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle gc subcommand
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		exit(runGC(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle import subcommand
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		exit(runImport(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle append subcommand
+	if len(os.Args) > 1 && os.Args[1] == "append" {
+		exit(runAppend(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle drill subcommand
+	if len(os.Args) > 1 && os.Args[1] == "drill" {
+		exit(runDrill(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle check-freshness subcommand
+	if len(os.Args) > 1 && os.Args[1] == "check-freshness" {
+		exit(runCheckFreshness(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle remote-backup subcommand
+	if len(os.Args) > 1 && os.Args[1] == "remote-backup" {
+		exit(runRemoteBackup(os.Args[2:]))
+	}
+
+	// Handle fleet subcommand
+	if len(os.Args) > 1 && os.Args[1] == "fleet" {
+		exit(runFleet(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle upload subcommand
+	if len(os.Args) > 1 && os.Args[1] == "upload" {
+		exit(runUpload(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle download subcommand
+	if len(os.Args) > 1 && os.Args[1] == "download" {
+		exit(runDownload(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Handle the agent side of remote-backup. Stdout carries the archive, so
+	// everything else printed during the run is redirected to stderr.
+	if len(os.Args) > 1 && os.Args[1] == remoteAgentCommand {
+		archiveOut := os.Stdout
+		os.Stdout = os.Stderr
+		exit(runRemoteAgent(os.Args[2:], archiveOut))
+	}
+
+	// Handle restore -pick, which restores an archive chosen from the catalog
+	if len(os.Args) > 1 && os.Args[1] == "restore" && pickRequested(os.Args[2:]) {
+		exit(runRestorePick(os.Args[2:], os.Stdout, os.Stderr))
 	}
 
 	// Handle restore subcommand
 	if len(os.Args) > 1 && os.Args[1] == "restore" {
-		restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+		restoreCmd := flag.NewFlagSet("restore", flag.ContinueOnError)
 		backupDir := restoreCmd.String("backup", "", "BackupEngine format backup directory")
 		restoreDir := restoreCmd.String("restore", "", "Target directory to restore as original RocksDB structure")
 		if err := restoreCmd.Parse(os.Args[2:]); err != nil {
 			fmt.Printf("Failed to parse flags: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if *backupDir == "" || *restoreDir == "" {
 			fmt.Println("Usage: archiveFiles restore -backup=backup_directory -restore=restore_directory")
-			os.Exit(1)
+			exit(1)
 		}
 
-		fmt.Printf("Restoring backup from %s to %s...\n", *backupDir, *restoreDir)
+		fmt.Fprintf(os.Stderr, "Restoring backup from %s to %s...\n", *backupDir, *restoreDir)
 		err := restore.RestoreBackupToPlain(*backupDir, *restoreDir)
 		if err != nil {
-			fmt.Printf("Restore failed: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Restore failed: %v\n", err)
+			printHint(os.Stderr, err)
+			exit(1)
 		}
 		fmt.Printf("Restore to plain RocksDB directory successful: %s\n", *restoreDir)
-		os.Exit(0)
+		exit(0)
 	}
 
-	// Parse configuration
-	cfg := parseFlags()
-
-	// Initialize logger with config settings
-	initLogger(cfg)
-
-	// Set up context with cancellation support
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Handle interrupt signals for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		sig := <-sigChan
-		logger.Warning("\nReceived signal %v, initiating graceful shutdown...", sig)
-		cancel()
-	}()
-
-	// Log operational mode
-	if cfg.DryRun {
-		logger.Warning("DRY RUN MODE: No actual changes will be made")
+	// Handle verify subcommand
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		exit(runVerify(os.Args[2:], os.Stdout, os.Stderr))
 	}
 
-	logger.Info("Starting database archival process...")
-	logger.Info("Sources: %v", cfg.SourcePaths)
-	logger.Info("Method: %s", cfg.Method)
-	logger.Debug("Batch mode: %t", cfg.BatchMode)
-
-	// Auto-determine progress bar: disable for error log level, enable otherwise
-	showProgress := cfg.LogLevel != "error"
-
-	// Create progress tracker
-	progressTracker := progress.NewProgressTracker(showProgress)
-
-	// Discover databases from all source directories
-	allDatabases := []types.DatabaseInfo{}
-	for _, sourcePath := range cfg.SourcePaths {
-		logger.Info("Scanning source: %s", sourcePath)
+	// Handle verify-archive subcommand
+	if len(os.Args) > 1 && os.Args[1] == "verify-archive" {
+		verifyCmd := flag.NewFlagSet("verify-archive", flag.ContinueOnError)
+		archivePath := verifyCmd.String("archive", "", "Archive file to check")
+		full := verifyCmd.Bool("full", false, "Stream the whole archive and recompute the manifest digest")
+		pubKeyPath := verifyCmd.String("pubkey", "", "Ed25519 public key (PEM) to check the archive's detached signature (implies -full)")
+		deepImage := verifyCmd.String("deep-image", "", "Docker image to run the consistency check in (enables deep verification)")
+		deepCmd := verifyCmd.String("deep-cmd", "", "Consistency check run with sh -c in the container; the extracted archive is mounted at "+deepVerifyMount)
+		deepTimeout := verifyCmd.Duration("deep-timeout", 10*time.Minute, "Time limit for the consistency check")
+		tmpDir := verifyCmd.String("tmp-dir", "", "Directory the archive is extracted to for deep verification (default: $TMPDIR or /tmp)")
+		if err := verifyCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Printf("Failed to parse flags: %v\n", err)
+			exit(1)
+		}
 
-		// Create a temporary config for each source
-		sourceConfig := &types.Config{
-			SourcePaths: []string{sourcePath},
-			BatchMode:   cfg.BatchMode,
+		if *archivePath == "" {
+			fmt.Println("Usage: archiveFiles verify-archive -archive=archive_path [-full] [-pubkey=key.pem] [-deep-image=image -deep-cmd=command]")
+			exit(1)
+		}
+		if (*deepImage == "") != (*deepCmd == "") {
+			fmt.Fprintln(os.Stderr, "Deep verification needs both -deep-image and -deep-cmd")
+			exit(1)
 		}
 
-		databases, err := discovery.DiscoverDatabases(sourceConfig, sourcePath)
+		// A signature only vouches for the footer, so the content must be
+		// checked against it in full
+		var footer *compress.Footer
+		var err error
+		indexed := compress.IsIndexed(*archivePath)
+		legacy := !indexed && compress.IsLegacy(*archivePath)
+		switch {
+		case indexed && *pubKeyPath != "":
+			err = fmt.Errorf("per-item archives are not signed")
+		case legacy && *pubKeyPath != "":
+			err = fmt.Errorf("legacy archives without a footer are not signed")
+		case legacy:
+			// Without a footer only completeness can be proven
+			var entries []compress.LegacyEntry
+			if entries, err = compress.ScanLegacy(*archivePath); err == nil {
+				fmt.Printf("Archive OK: %s (legacy archive without footer, %d entries, %d items; content has no digest to check)\n",
+					*archivePath, len(entries), len(restore.LegacyManifest(entries).Items))
+			}
+		case indexed:
+			// Members are small enough to always be checked in full
+			var index *compress.Index
+			if index, err = compress.VerifyIndexed(*archivePath); err == nil {
+				fmt.Printf("Archive OK: %s (%d members)\n", *archivePath, len(index.Members))
+			}
+		case *full || *pubKeyPath != "":
+			footer, err = compress.VerifyArchive(*archivePath)
+		default:
+			footer, err = compress.ReadFooter(*archivePath)
+		}
 		if err != nil {
-			logger.Warning("Failed to discover databases in %s: %v", sourcePath, err)
-			continue
+			fmt.Fprintf(os.Stderr, "Archive verification failed: %v\n", err)
+			printHint(os.Stderr, err)
+			exit(1)
 		}
 
-		// Add source root information (size is already calculated during discovery)
-		for i := range databases {
-			databases[i].SourceRoot = sourcePath
+		// Per-item and legacy archives were reported above
+		if footer != nil {
+			if *pubKeyPath != "" {
+				publicKey, err := compress.LoadPublicKey(*pubKeyPath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to load public key: %v\n", err)
+					exit(1)
+				}
+				if err := compress.VerifySignature(*archivePath, footer, publicKey); err != nil {
+					fmt.Fprintf(os.Stderr, "Signature verification failed: %v\n", err)
+					exit(1)
+				}
+				fmt.Printf("Signature OK: %s\n", *archivePath+compress.SignatureSuffix)
+			}
+			fmt.Printf("Archive OK: %s (%d entries, manifest sha256 %s)\n", *archivePath, footer.EntryCount, footer.ManifestSHA256)
 		}
 
-		allDatabases = append(allDatabases, databases...)
+		if *deepImage != "" {
+			client, err := docker.NewClient()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Deep verification failed: %v\n", err)
+				exit(1)
+			}
+			utils.SetTmpDir(*tmpDir)
+			ctx, cancel := context.WithTimeout(context.Background(), *deepTimeout)
+			err = deepVerify(ctx, client, *archivePath, *deepImage, *deepCmd, os.Stdout)
+			cancel()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Deep verification failed: %v\n", err)
+				exit(1)
+			}
+			fmt.Println("Deep verification OK")
+		}
+		exit(0)
 	}
 
-	if len(allDatabases) == 0 {
-		logger.Fatal("No databases or files found to archive")
+	// The estimate subcommand takes the same flags as a backup run
+	estimateMode := len(os.Args) > 1 && os.Args[1] == "estimate"
+	if estimateMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
 	}
 
-	logger.Info("Found %d item(s) to archive:", len(allDatabases))
-	var totalSize int64
-	for _, db := range allDatabases {
-		logger.Info("  - %s (%s) from %s [%s]", db.Name, db.Type.String(), db.SourceRoot, utils.FormatBytes(db.Size))
-		totalSize += db.Size
-	}
+	// Parse configuration
+	cfg, reload := parseFlags()
 
-	// Initialize progress tracking
-	progressTracker.Init(len(allDatabases), totalSize)
+	// Initialize logger with config settings
+	initLogger(cfg)
 
-	// Create backup directory
-	backupPath := utils.ReplaceDateVars(cfg.BackupPath)
-	if backupPath == "" {
-		backupPath = utils.ReplaceDateVars(fmt.Sprintf("backup_%d", time.Now().Unix()))
+	if estimateMode {
+		exit(runEstimate(context.Background(), cfg, os.Stdout))
 	}
 
-	if cfg.DryRun {
-		logger.Info("[DRY RUN] Would create backup directory: %s", backupPath)
-	} else {
-		if err := os.MkdirAll(backupPath, constants.DirPermission); err != nil {
-			logger.Fatal("Failed to create backup directory: %v", err)
+	// Fault injection exercises recovery and verification in CI only
+	if cfg.FaultInject != "" {
+		// Validated with the rest of the configuration
+		spec, _ := faults.ParseSpec(cfg.FaultInject)
+		faults.Enable(spec)
+		logger.Warning("FAULT INJECTION ENABLED (%s): backups will be unreliable", cfg.FaultInject)
+	}
+
+	// Load the signing key up front so a bad key fails before any work
+	var signingKey ed25519.PrivateKey
+	if cfg.SignKey != "" {
+		var err error
+		if signingKey, err = compress.LoadPrivateKey(cfg.SignKey); err != nil {
+			logger.Fatal("Failed to load signing key: %v", err)
+		}
+		if !cfg.Compress {
+			logger.Warning("-sign-key has no effect without -compress: only archives are signed")
 		}
 	}
 
-	// Auto-determine number of workers based on CPU cores
-	workers := runtime.NumCPU()
+	// Set up context with cancellation support
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Cap workers at reasonable maximum
-	if workers > len(allDatabases) {
-		workers = len(allDatabases)
-	}
+	// Handle interrupt signals for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	if workers > 1 {
-		logger.Info("Using %d concurrent workers for backup", workers)
+	go func() {
+		sig := <-sigChan
+		logger.Warning("\nReceived signal %v, initiating graceful shutdown...", sig)
+		cancel()
+	}()
+
+	if cfg.Interval != "" {
+		// Validated with the rest of the configuration
+		interval, _ := time.ParseDuration(cfg.Interval)
+		runDaemon(ctx, cfg, reload, signingKey, interval)
+		return
 	}
 
-	// Process databases with worker pool
-	processDatabasesConcurrently(ctx, allDatabases, backupPath, cfg, progressTracker, workers)
+	if cfg.K8sJob {
+		exit(runK8sJob(ctx, cfg, signingKey, os.Stdout))
+	}
 
-	// Check if context was cancelled
-	if ctx.Err() != nil {
-		logger.Warning("Backup was cancelled: %v", ctx.Err())
-		logger.Warning("Partial backup may exist at: %s", backupPath)
-		os.Exit(130) // Exit code 130 for Ctrl+C
+	if cfg.StatusAddr != "" {
+		logger.Warning("-status-addr is only served in daemon mode (-interval)")
 	}
 
-	// Finish progress tracking
-	if showProgress {
-		progressTracker.Finish()
+	// A single run can be watched and cancelled through the control socket
+	// too; there is nothing to reload into
+	runID := utils.NewRunID()
+	var status *runStatus
+	if cfg.ControlSocket != "" {
+		status = newRunStatus()
+		status.startRun(runID)
+		status.setCancelRun(cancel)
+		defer startControlSocket(cfg.ControlSocket, status)()
 	}
 
-	logger.Info("Backup created successfully at: %s", backupPath)
+	started := time.Now()
+	result, err := runArchive(ctx, cfg, runID, signingKey, status)
 
-	// Compress backup if requested
-	if cfg.Compress {
-		archivePath := utils.ReplaceDateVars(cfg.ArchivePath)
-		if archivePath == "" {
-			archivePath = utils.ReplaceDateVars(fmt.Sprintf("%s.tar.gz", backupPath))
+	// Only results go to stdout; a dry run produces nothing to point at
+	if cfg.JSONReport || (err == nil && !cfg.DryRun) {
+		if err := printRunResult(os.Stdout, newRunReport(result, err, started), cfg.JSONReport); err != nil {
+			logger.Warning("Failed to print run result: %v", err)
 		}
-
-		if cfg.DryRun {
-			logger.Info("[DRY RUN] Would create compressed archive: %s", archivePath)
-			logger.Info("[DRY RUN] Would remove backup directory: %s", backupPath)
-		} else {
-			if showProgress {
-				logger.Info("Creating compressed archive...")
-			}
-
-			err := compress.CompressDirectory(backupPath, archivePath)
-			if err != nil {
-				logger.Fatal("Failed to compress backup: %v", err)
-			}
-
-			logger.Info("Archive created successfully at: %s", archivePath)
-
-			// Auto-remove original backup directory after compression
-			err = os.RemoveAll(backupPath)
-			if err != nil {
-				logger.Warning("Failed to remove backup directory: %v", err)
-			} else {
-				logger.Info("Backup directory removed: %s", backupPath)
-			}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			exit(130) // Exit code 130 for Ctrl+C
 		}
+		logger.Fatal("%v", err)
+	}
+	if result.NotStarted > 0 {
+		exit(constants.ExitCodePartial)
+	}
+	if result.SizeAnomalies > 0 {
+		exit(constants.ExitCodeSizeAnomaly)
 	}
-
-	logger.Info("Archival process completed successfully!")
 }
 
-func parseFlags() *types.Config {
+// parseFlags builds the configuration from the command line and the config
+// file it names, and returns a loader that rebuilds it after the file changed
+func parseFlags() (*types.Config, configLoader) {
 	var sourceFlag string
 	var sourcesFlag string
+	var sourcesFromFlag string
 	var configFile string
+	var removeBackup, showProgress bool
 
 	// Define all flags
 	flag.StringVar(&configFile, "config", "", "JSON configuration file path")
 	flag.StringVar(&sourceFlag, "source", "", "Source database path or directory")
 	flag.StringVar(&sourcesFlag, "sources", "", "Multiple source paths, comma-separated")
+	flag.StringVar(&sourcesFromFlag, "sources-from", "", "Read source paths from a file, one per line ('-' for stdin)")
 
 	// Create a temporary config for flag parsing
 	cfg := config.GetDefaultConfig()
 
 	flag.StringVar(&cfg.BackupPath, "backup", "", "Backup path (default: backup_timestamp)")
 	flag.StringVar(&cfg.ArchivePath, "archive", "", "Archive path (default: backup_path.tar.gz)")
+	flag.StringVar(&cfg.Namespace, "namespace", "", "Tenant namespace, e.g. teamA: items are stored below a directory of this name and catalog runs are tagged with it, so teams can share a backup host and catalog")
 	flag.StringVar(&cfg.Method, "method", "checkpoint", "RocksDB backup method: checkpoint (fast, hard-links), backup (native backup engine), copy (record-by-record)")
 	flag.BoolVar(&cfg.Compress, "compress", true, "Compress archived files (auto removes backup directory after compression)")
+	flag.BoolVar(&removeBackup, "remove-backup", true, "Remove the backup directory after compressing it")
+	flag.BoolVar(&cfg.AllowConcurrent, "allow-concurrent", false, "Run even if another run is writing to the same backup destination")
+	flag.StringVar(&cfg.CompressionFormat, "compression", "", "Archive compression format: gzip, xz or bzip2 for consumers that need them (much slower, uses the xz/bzip2 tools), or none for a plain tar on filesystems that compress (default: gzip)")
+	flag.IntVar(&cfg.CompressionLevel, "compression-level", 0, "Compression level, 1 (fastest) to 9 (smallest) (default: the format's default, 6 for gzip and xz, 9 for bzip2)")
+	flag.BoolVar(&cfg.StoreIncompressible, "store-incompressible", false, "Store files that are compressed already (zstd SST files, .gz, images) in the archive without compressing them again (gzip only)")
+	flag.BoolVar(&cfg.EntryChecksums, "entry-checksums", false, "Record the SHA-256 of each file in its PAX header, checked by verify-archive and readable by plain tar tooling (reads each file twice)")
+	flag.StringVar(&cfg.ArchiveLayout, "archive-layout", "", "Archive layout: single (one tar.gz), per-item (a directory with one tar.gz per item and index.json) (default: single)")
+	flag.StringVar(&cfg.VolumeSize, "volume-size", "", "With -archive-layout per-item, split items larger than this into volumes of at most this size, e.g. 500G")
+	flag.StringVar(&cfg.Output, "output", "", "Where the backup goes: local (backup directory, archived with -compress) or mirror (the backup tree copied file by file to -mirror-target, no archive) (default: local)")
+	flag.StringVar(&cfg.MirrorTarget, "mirror-target", "", "user@host:/path the backup is mirrored below with -output=mirror")
+	flag.StringVar(&cfg.MirrorSSH, "mirror-ssh", "", "SSH command used for -output=mirror, including options (e.g. \"ssh -p 2222 -i key\") (default: ssh)")
 	flag.BoolVar(&cfg.Verify, "verify", false, "Verify backup data integrity against source")
 	flag.BoolVar(&cfg.DryRun, "dry-run", false, "Dry run mode: simulate actions without actually executing them")
 	flag.StringVar(&cfg.LogLevel, "log-level", "info", "Log level: debug, info, warning, error (error level disables progress bar)")
+	flag.StringVar(&cfg.LogOutput, "log-output", "", "Where log messages go: stderr, syslog (local syslog daemon) or journald (systemd journal) (default: stderr)")
+	flag.BoolVar(&showProgress, "progress", true, "Draw a progress bar (on stderr)")
+	flag.StringVar(&cfg.ProgressInterval, "progress-interval", "", "How often the progress bar is redrawn, e.g. 1s (default: 100ms)")
+	flag.BoolVar(&cfg.JSONReport, "json", false, "Print the run report as JSON on stdout instead of the archive path")
+	flag.BoolVar(&cfg.WarningsAsErrors, "warnings-as-errors", false, "Fail the run (exit status 1) when any item was archived with warnings, e.g. an SST count mismatch")
 	flag.BoolVar(&cfg.ColorLog, "color-log", true, "Enable colored log output")
+	flag.BoolVar(&cfg.NetworkFS, "network-fs", false, "The archive is written to NFS or another network filesystem: fsync it after the rename and check its size and footer again")
+	flag.BoolVar(&cfg.Reproducible, "reproducible", false, "Create byte-identical archives for identical content (fixed owners, mtime from SOURCE_DATE_EPOCH or the Unix epoch)")
+	flag.StringVar(&cfg.IncludePattern, "include", "", "Comma-separated glob patterns; matching files that are not databases or logs are archived as generic files")
+	flag.StringVar(&cfg.ExcludePattern, "exclude", "", "Comma-separated glob patterns; matching files and directories are skipped during discovery")
+	flag.StringVar(&cfg.LogDetection, "log-detection", "", "Log file detection: permissive (log-like names, or timestamped or JSON lines content) or strict (content only) (default: permissive)")
+	flag.StringVar(&cfg.RocksDBExclude, "rocksdb-exclude", "", "Comma-separated glob patterns of RocksDB files to leave out of backups (default: "+constants.DefaultRocksDBExclude+")")
+	flag.BoolVar(&cfg.KeepRocksDBArtifacts, "keep-rocksdb-artifacts", false, "Copy rotated info logs, *.dbtmp and old OPTIONS files of RocksDB databases too, e.g. for forensics")
+	flag.BoolVar(&cfg.InventoryOnly, "inventory-only", false, "List the items found in the sources, with their sizes, in the manifest and catalog without copying any data; reports drift against the previous inventory")
+	flag.BoolVar(&cfg.InventoryHashes, "inventory-hashes", false, "With -inventory-only: also record the SHA-256 of every file, which reads all the data")
+	flag.StringVar(&cfg.RocksDBExport, "rocksdb-export", "", "Export RocksDB databases instead of backing them up: sst (external SST files for IngestExternalFile), jsonl or csv (text dumps); see the import subcommand")
+	flag.StringVar(&cfg.RocksDBExportEncoding, "rocksdb-export-encoding", "", "Encoding of binary keys and values in jsonl and csv exports: base64 (default) or hex")
+	flag.IntVar(&cfg.MaxDepth, "max-depth", 0, "Maximum directory depth to scan below each source (0 = unlimited)")
+	flag.IntVar(&cfg.RocksDBBackupRateMBps, "rocksdb-backup-rate-mbps", 0, "With -method=backup, copy RocksDB files at this many MB/s instead of through the BackupEngine, which cannot be rate-limited (0 = unlimited)")
+	flag.IntVar(&cfg.SQLiteMaxConnections, "sqlite-max-connections", 0, "SQLite connections open at once across all workers; more wait for a free one (0 = 16)")
+	flag.BoolVar(&cfg.OneFileSystem, "one-file-system", false, "Do not cross filesystem boundaries (mount points) during discovery")
+	flag.IntVar(&cfg.MaxItems, "max-items", 0, "Refuse to run when discovery finds more items than this, e.g. after a mistyped -source (0 = unlimited)")
+	flag.StringVar(&cfg.MaxTotalSize, "max-total-size", "", "Refuse to run when discovery finds more data than this, e.g. 500GB (empty = unlimited)")
+	flag.BoolVar(&cfg.Yes, "yes", false, "Do not ask before removing the backup directory, and proceed even when -max-items or -max-total-size is exceeded")
+	flag.StringVar(&cfg.Window, "window", "", "Daily time window such as 02:00-06:00; when it closes no new items are started and the run is archived as partial")
+	flag.StringVar(&cfg.Schedule, "schedule", "", "Order items are backed up in: discovery, largest-first, smallest-first, interleaved (default: discovery)")
+	flag.BoolVar(&cfg.DropPageCache, "drop-page-cache", false, "Evict copied source data from the page cache so the backup does not displace the application's working set (Linux)")
+	flag.BoolVar(&cfg.Preread, "preread", false, "Read each source file sequentially right before copying it, so the copy and checksum passes hit the page cache (faster on spinning disks)")
+	flag.StringVar(&cfg.TmpDir, "tmp-dir", "", "Directory for temporary state such as RocksDB secondary instances; needs 1GB free (default: $TMPDIR or /tmp)")
+	flag.BoolVar(&cfg.Nice, "nice", false, "Yield to the services on the host: lowest CPU priority, idle I/O class (Linux) and small RocksDB readahead")
+	flag.BoolVar(&cfg.HostInfo, "host-info", false, "Record the hostname, kernel, source mount options and library versions in HOSTINFO.json inside the backup")
+	flag.BoolVar(&cfg.ItemLogs, "item-logs", false, "Write <item>.backup.log next to each item in the backup with the method, fallbacks, warnings, timings and verification result")
+	flag.StringVar(&cfg.Snapshot, "snapshot", "", "Copy sources from a filesystem snapshot: apfs (macOS, requires root)")
+	flag.StringVar(&cfg.Durability, "durability", "", "fsync policy: none, data (files and archive), full (also directories) (default: data)")
+	flag.StringVar(&cfg.Interval, "interval", "", "Daemon mode: repeat the backup at this interval, e.g. 24h (default: run once)")
+	flag.StringVar(&cfg.StatusAddr, "status-addr", "", "Daemon mode: serve /healthz and /status on this address, e.g. :8080; a Unix socket such as unix:/run/archivefiles.sock also serves /pause, /resume and /reload")
+	flag.StringVar(&cfg.ControlSocket, "control-socket", "", "Accept control commands (status, progress, cancel-item, cancel-run, reload) on this Unix socket, e.g. "+constants.DefaultControlSocket)
+	flag.BoolVar(&cfg.K8sJob, "k8s-job", false, "Kubernetes Job mode: read "+constants.K8sConfigPath+" if mounted, write a run report to the termination log, emit Event JSON on stdout")
+	flag.StringVar(&cfg.TerminationLog, "termination-log", "", "Kubernetes job mode: run report path (default: "+constants.K8sTerminationLogPath+")")
+	flag.StringVar(&cfg.SignKey, "sign-key", "", "Ed25519 private key (PKCS#8 PEM) used to write a detached signature next to the archive")
+	flag.StringVar(&cfg.VerifySample, "verify-sample", "", "Verify a deterministic pseudo-random sample of keys/rows, e.g. 5% (implies -verify)")
+	flag.Int64Var(&cfg.VerifySeed, "verify-seed", 0, "Seed for -verify-sample, to reproduce an earlier run's sample (default: random per run)")
+	flag.StringVar(&cfg.CatalogPath, "catalog", "", "Catalog file tracking per-item backup sizes across runs, used to detect suspicious shrinkage")
+	flag.IntVar(&cfg.SizeDropThreshold, "size-drop-threshold", 0, "Percent drop against the trailing average size reported as an anomaly (default: 50)")
+	flag.StringVar(&cfg.OnAccessError, "on-access-error", "", "Policy for paths discovery cannot read: skip, warn, fail (default: warn)")
+	flag.StringVar(&cfg.OnCorruption, "on-corruption", "", "Policy for SQLite sources failing the integrity check: fail, backup-anyway, skip (default: fail; setting it enables the check)")
+	flag.StringVar(&cfg.FaultInject, faultInjectFlag, "", "Testing only: inject faults, e.g. fail=5%,corrupt=0.1%,delay=200ms,seed=42")
+	flag.Usage = usageWithoutHiddenFlags
+
+	// Parse flags. Errors end the run through exit, like flag.ExitOnError
+	// would, so that an audited run records them.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err == flag.ErrHelp {
+		exit(0)
+	} else if err != nil {
+		exit(2)
+	}
+	cfg.KeepBackup = !removeBackup
+	cfg.HideProgress = !showProgress
+
+	// In Kubernetes job mode the config usually comes from a mounted ConfigMap
+	if cfg.K8sJob && configFile == "" {
+		if _, err := os.Stat(constants.K8sConfigPath); err == nil {
+			configFile = constants.K8sConfigPath
+		}
+	}
+
+	sources := sourceFlags{single: sourceFlag, list: sourcesFlag, from: sourcesFromFlag}
+	// stdin can only be read once, so a reload reuses the paths read now
+	if sources.single == "" && sources.list == "" && sources.from == "-" {
+		sourcePaths, err := config.LoadSourceList(sources.from)
+		if err != nil {
+			logger.Fatal("failed to read source list: %v", err)
+		}
+		sources.stdin = sourcePaths
+	}
+	finalConfig, err := buildConfig(configFile, cfg, sources)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	reload := func() (*types.Config, error) {
+		if configFile == "" {
+			return nil, fmt.Errorf("no -config file to reload")
+		}
+		return buildConfig(configFile, cfg, sources)
+	}
+	return finalConfig, reload
+}
 
-	// Parse flags
-	flag.Parse()
+// sourceFlags holds the source paths given on the command line
+type sourceFlags struct {
+	single string   // -source
+	list   string   // -sources
+	from   string   // -sources-from
+	stdin  []string // Paths read from stdin for -sources-from=-
+}
 
+// configLoader reloads the configuration from the config file, with the
+// command line applied on top
+type configLoader func() (*types.Config, error)
 
-	// Load configuration from file if specified
+// buildConfig loads configFile (if any), applies the command line flags and
+// sources on top, fills in defaults and validates the result
+func buildConfig(configFile string, cfg *types.Config, sources sourceFlags) (*types.Config, error) {
 	var finalConfig *types.Config
 	if configFile != "" {
 		loadedConfig, err := config.LoadConfigFromJSON(configFile)
 		if err != nil {
-			logger.Fatal("Failed to load config file: %v", err)
+			return nil, fmt.Errorf("failed to load config file: %v", err)
+		}
+		if loadedConfig.ConfigVersion < constants.ConfigVersion {
+			logger.Warning("Config file %s uses an old schema; upgrade it with: archiveFiles config migrate -config=%s -w", configFile, configFile)
 		}
 		finalConfig = config.MergeConfigs(loadedConfig, cfg)
 	} else {
 		finalConfig = cfg
 	}
 
+	if finalConfig.Durability == "" {
+		finalConfig.Durability = constants.DefaultDurability
+	}
+	if finalConfig.OnAccessError == "" {
+		finalConfig.OnAccessError = constants.DefaultOnAccessError
+	}
+	// The mirror replaces the archive
+	if finalConfig.Output == constants.OutputMirror {
+		finalConfig.Compress = false
+	}
+
 	// Handle source paths
-	if sourceFlag != "" {
-		finalConfig.SourcePaths = []string{sourceFlag}
-	} else if sourcesFlag != "" {
-		finalConfig.SourcePaths = strings.Split(sourcesFlag, ",")
+	if sources.single != "" {
+		finalConfig.SourcePaths = []string{sources.single}
+	} else if sources.list != "" {
+		finalConfig.SourcePaths = strings.Split(sources.list, ",")
 		for i, path := range finalConfig.SourcePaths {
 			finalConfig.SourcePaths[i] = strings.TrimSpace(path)
 		}
+	} else if sources.from == "-" {
+		finalConfig.SourcePaths = append([]string(nil), sources.stdin...)
+	} else if sources.from != "" {
+		sourcePaths, err := config.LoadSourceList(sources.from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source list: %v", err)
+		}
+		finalConfig.SourcePaths = sourcePaths
 	}
-
 	// Validate configuration
 	if len(finalConfig.SourcePaths) == 0 {
-		logger.Fatal("No source paths specified. Use -source or -sources flag, or specify in config file.")
+		return nil, fmt.Errorf("no source paths specified. Use -source, -sources or -sources-from flag, or specify in config file")
 	}
 
-	// Auto-detect batch mode if any source is a directory
+	// Auto-detect batch mode if any source is a directory (Docker volumes always are)
 	for _, sourcePath := range finalConfig.SourcePaths {
+		if docker.IsVolumeSource(sourcePath) {
+			finalConfig.BatchMode = true
+			break
+		}
 		if info, err := os.Stat(sourcePath); err == nil && info.IsDir() {
 			finalConfig.BatchMode = true
 			break
@@ -312,33 +611,82 @@ func parseFlags() *types.Config {
 
 	// Validate configuration
 	if err := finalConfig.Validate(); err != nil {
-		logger.Fatal("Configuration validation failed: %v", err)
+		return nil, fmt.Errorf("configuration validation failed: %v", err)
 	}
 
-	return finalConfig
+	return finalConfig, nil
 }
 
-// processDatabasesConcurrently processes databases using a worker pool for concurrent backup
-func processDatabasesConcurrently(ctx context.Context, databases []types.DatabaseInfo, backupPath string, cfg *types.Config, progressTracker *progress.ProgressTracker, workers int) {
-	// Create job channel and error collection
-	jobs := make(chan types.DatabaseInfo, len(databases))
+// processDatabasesConcurrently processes databases using a worker pool for concurrent backup.
+// Once windowClosed is closed, items in progress are finished but no new
+// ones are started; those are recorded as skipped and their number returned.
+// itemDone, when not nil, is called with every item backed up successfully
+// as soon as its copy is complete. Items are reported to status, which may be
+// nil; those cancelled through it are skipped.
+func processDatabasesConcurrently(ctx context.Context, databases []types.DatabaseInfo, backupPath string, cfg *types.Config, progressTracker *progress.ProgressTracker, workers int, backupManifest *manifest.Manifest, windowClosed <-chan struct{}, itemDone func(manifest.Item), status *runStatus) int {
+	// Create job channel and error collection. The members of a
+	// consistency group form one job, so one worker backs them up
+	// back-to-back.
+	units := jobUnits(scheduleJobs(databases, cfg.Schedule))
+	jobs := make(chan []types.DatabaseInfo, len(units))
 	var wg sync.WaitGroup
 	var errorsMu sync.Mutex
 	errors := make(map[string]error)
+	var notStarted []types.DatabaseInfo
+	var cancelled []types.DatabaseInfo
+	groups := make(map[string]types.ConsistencyGroup)
+	for _, group := range cfg.ConsistencyGroups {
+		groups[group.Name] = group
+	}
+
+	process := func(db types.DatabaseInfo) {
+		if !status.beginItem(db.Name) {
+			logger.Warning("Skipping %s: cancelled by operator", db.Name)
+			errorsMu.Lock()
+			cancelled = append(cancelled, db)
+			errorsMu.Unlock()
+			progressTracker.CompleteItem(0)
+			return
+		}
+		processDatabase(ctx, db, backupPath, cfg, progressTracker, backupManifest, &errorsMu, errors, itemDone)
+		status.endItem(db.Name)
+	}
 
 	// Start worker pool
 	for w := 0; w < workers; w++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			for db := range jobs {
+			for unit := range jobs {
+				// No new item starts while backup I/O is paused; a
+				// cancellation during the pause is handled below
+				utils.WaitWhilePaused(ctx)
+
 				// Check if context was cancelled before processing
 				select {
 				case <-ctx.Done():
 					logger.Debug("Worker %d stopping due to cancellation", workerID)
 					return
+				case <-windowClosed:
+					errorsMu.Lock()
+					notStarted = append(notStarted, unit...)
+					errorsMu.Unlock()
 				default:
-					processDatabase(ctx, db, backupPath, cfg, progressTracker, &errorsMu, errors)
+					group, grouped := groups[unit[0].ConsistencyGroup]
+					if !grouped {
+						process(unit[0])
+						continue
+					}
+					processGroup(group, unit, backupPath, cfg.DryRun, process, func(err error) {
+						errorsMu.Lock()
+						for _, db := range unit {
+							errors[db.Name] = err
+						}
+						errorsMu.Unlock()
+						for range unit {
+							progressTracker.CompleteItem(0)
+						}
+					})
 				}
 			}
 		}(w)
@@ -346,12 +694,12 @@ func processDatabasesConcurrently(ctx context.Context, databases []types.Databas
 
 	// Send jobs to workers, respecting context cancellation
 	go func() {
-		for _, db := range databases {
+		for _, unit := range units {
 			select {
 			case <-ctx.Done():
 				close(jobs)
 				return
-			case jobs <- db:
+			case jobs <- unit:
 			}
 		}
 		close(jobs)
@@ -365,12 +713,39 @@ func processDatabasesConcurrently(ctx context.Context, databases []types.Databas
 		logger.Warning("%d database(s) failed to backup:", len(errors))
 		for name, err := range errors {
 			logger.Error("  - %s: %v", name, err)
+			if hint := apperr.Hint(err); hint != "" {
+				logger.Info("    Hint: %s", hint)
+			}
+		}
+	}
+
+	// Record failed items in the manifest
+	for _, db := range databases {
+		if err, failed := errors[db.Name]; failed {
+			backupManifest.AddItem(manifestItem(db, cfg.Namespace, manifest.StatusFailed, err, nil))
 		}
 	}
+
+	// Items the time window left no room for
+	for _, db := range notStarted {
+		err := fmt.Errorf("not started: the backup window %s closed", cfg.Window)
+		backupManifest.AddItem(manifestItem(db, cfg.Namespace, manifest.StatusSkipped, err, nil))
+	}
+	for _, db := range cancelled {
+		backupManifest.AddItem(manifestItem(db, cfg.Namespace, manifest.StatusSkipped, fmt.Errorf("cancelled by operator"), nil))
+	}
+	return len(notStarted)
+}
+
+// printHint prints the remediation hint of err, if it has one
+func printHint(out io.Writer, err error) {
+	if hint := apperr.Hint(err); hint != "" {
+		fmt.Fprintf(out, "Hint: %s\n", hint)
+	}
 }
 
 // processDatabase processes a single database backup
-func processDatabase(ctx context.Context, db types.DatabaseInfo, backupPath string, cfg *types.Config, progressTracker *progress.ProgressTracker, errorsMu *sync.Mutex, errors map[string]error) {
+func processDatabase(ctx context.Context, db types.DatabaseInfo, backupPath string, cfg *types.Config, progressTracker *progress.ProgressTracker, backupManifest *manifest.Manifest, errorsMu *sync.Mutex, errors map[string]error, itemDone func(manifest.Item)) {
 	// Check if context was cancelled before starting
 	select {
 	case <-ctx.Done():
@@ -382,7 +757,7 @@ func processDatabase(ctx context.Context, db types.DatabaseInfo, backupPath stri
 	}
 
 	// Determine if progress bar is shown
-	showProgress := cfg.LogLevel != "error"
+	showProgress := cfg.ShowProgress()
 
 	// Update progress
 	if showProgress {
@@ -395,23 +770,78 @@ func processDatabase(ctx context.Context, db types.DatabaseInfo, backupPath stri
 		}
 	}
 
-	// Create a subdirectory structure to avoid name collisions
-	sourceBaseName := filepath.Base(db.SourceRoot)
-	if sourceBaseName == "." || sourceBaseName == "" {
-		sourceBaseName = "root"
-	}
+	dbBackupPath := filepath.Join(backupPath, itemBackupPath(cfg.Namespace, db))
 
-	dbBackupPath := filepath.Join(backupPath, sourceBaseName, db.Name)
+	// RocksDB data may be exported for ingestion elsewhere instead, unless
+	// it is encrypted and cannot be opened
+	exporting := cfg.RocksDBExport != "" && db.Type == types.DatabaseTypeRocksDB && !db.Encrypted
+	if cfg.RocksDBExport != "" && db.Type == types.DatabaseTypeRocksDB && db.Encrypted {
+		logger.Warning("Copying the files of %s instead of exporting it: the database is encrypted", db.Name)
+	}
 
 	// In dry-run mode, simulate the operation
 	if cfg.DryRun {
-		if !showProgress {
+		if !showProgress && exporting {
+			logger.Info("[DRY RUN] Would export %s to %s as %s files", db.Name, dbBackupPath, cfg.RocksDBExport)
+		} else if !showProgress {
 			logger.Info("[DRY RUN] Would backup %s to %s using method: %s", db.Name, dbBackupPath, cfg.Method)
 		}
 		progressTracker.CompleteItem(db.Size)
 		return
 	}
 
+	// Check SQLite sources for corruption and apply the corruption policy.
+	// Encrypted databases cannot be opened to check them.
+	var warnings []string
+	sourceCorrupt := false
+
+	// The item log is written whatever the outcome, once the item's backup
+	// directory exists
+	itemLog := newItemLog(db)
+	if cfg.ItemLogs {
+		defer func() {
+			errorsMu.Lock()
+			itemLog.Err = errors[db.Name]
+			errorsMu.Unlock()
+			itemLog.Warnings = warnings
+			if err := itemLog.write(dbBackupPath); err != nil {
+				logger.Warning("%v", err)
+			}
+		}()
+	}
+	// The source check reads the whole database, so it only runs when
+	// verification or a corruption policy is asked for
+	if db.Type == types.DatabaseTypeSQLite && !db.Encrypted && (cfg.Verify || cfg.VerifySample != "" || cfg.OnCorruption != "") {
+		checkWarnings, corrupt, err := checkSQLiteUnit(db)
+		warnings = append(warnings, checkWarnings...)
+		if err != nil && !corrupt {
+			errorsMu.Lock()
+			errors[db.Name] = fmt.Errorf("source integrity check could not run: %w", err)
+			errorsMu.Unlock()
+			progressTracker.CompleteItem(0)
+			return
+		}
+		if err != nil {
+			switch cfg.OnCorruption {
+			case constants.OnCorruptionSkip:
+				logger.Warning("⚠️  Skipping corrupted database %s: %v", db.Name, err)
+				backupManifest.AddItem(manifestItem(db, cfg.Namespace, manifest.StatusSkipped, err, nil))
+				progressTracker.CompleteItem(0)
+				return
+			case constants.OnCorruptionBackupAnyway:
+				logger.Warning("⚠️  Backing up corrupted database %s anyway: %v", db.Name, err)
+				warnings = append(warnings, fmt.Sprintf("source integrity check failed: %v", err))
+				sourceCorrupt = true
+			default:
+				errorsMu.Lock()
+				errors[db.Name] = fmt.Errorf("source integrity check failed: %w", err)
+				errorsMu.Unlock()
+				progressTracker.CompleteItem(0)
+				return
+			}
+		}
+	}
+
 	// Ensure the parent directory exists
 	parentDir := filepath.Dir(dbBackupPath)
 	if err := os.MkdirAll(parentDir, constants.DirPermission); err != nil {
@@ -423,7 +853,16 @@ func processDatabase(ctx context.Context, db types.DatabaseInfo, backupPath stri
 	}
 
 	// Use safe backup method that handles locked databases
-	err := backup.SafeBackupDatabase(db, dbBackupPath, cfg.Method, progressTracker)
+	var result backup.Result
+	backupStarted := time.Now()
+	err := faults.Inject("backup " + db.Path)
+	if err == nil && exporting {
+		result, err = backup.ExportRocksDB(db, dbBackupPath, cfg.RocksDBExport, cfg.RocksDBExportEncoding, progressTracker)
+	} else if err == nil {
+		result, err = backup.SafeBackupDatabase(db, dbBackupPath, cfg.Method, progressTracker)
+	}
+	itemLog.BackupTime = time.Since(backupStarted)
+	itemLog.Method, itemLog.Fallbacks = result.Method, result.Fallbacks
 
 	if err != nil {
 		if !showProgress {
@@ -435,52 +874,409 @@ func processDatabase(ctx context.Context, db types.DatabaseInfo, backupPath stri
 		progressTracker.CompleteItem(0) // Still count as processed for progress
 		return
 	}
+	warnings = append(warnings, result.Warnings...)
+
+	// RocksDB may keep its WALs (and archived WALs) in a separate wal_dir
+	// and SST files in further db_paths; copy them so the backup contains
+	// the whole database. An export already holds all of its data, and the
+	// OPTIONS file naming them cannot be read when encrypted.
+	var externalPaths []manifest.PathMapping
+	if db.Type == types.DatabaseTypeRocksDB && !exporting && !db.Encrypted {
+		walDir, walBackupPath, err := backup.BackupExternalWALs(db.Path, dbBackupPath)
+		if err != nil {
+			errorsMu.Lock()
+			errors[db.Name] = err
+			errorsMu.Unlock()
+			progressTracker.CompleteItem(0)
+			return
+		}
+		if walDir != "" {
+			relPath, _ := filepath.Rel(backupPath, walBackupPath)
+			externalPaths = append(externalPaths, manifest.PathMapping{
+				Kind:       constants.WALBackupDirName,
+				SourcePath: walDir,
+				BackupPath: filepath.ToSlash(relPath),
+			})
+		}
+
+		// SST files placed on other devices through db_paths/cf_paths
+		dbPaths, err := backup.BackupExternalDBPaths(db.Path, dbBackupPath)
+		if err != nil {
+			errorsMu.Lock()
+			errors[db.Name] = err
+			errorsMu.Unlock()
+			progressTracker.CompleteItem(0)
+			return
+		}
+		for _, dir := range dbPaths {
+			relPath, _ := filepath.Rel(backupPath, dir.BackupPath)
+			externalPaths = append(externalPaths, manifest.PathMapping{
+				Kind:       constants.DBPathsBackupDirName,
+				SourcePath: dir.SourcePath,
+				BackupPath: filepath.ToSlash(relPath),
+			})
+		}
+	}
+
+	// Flush the backup to stable storage according to the durability policy
+	if cfg.Durability != constants.DurabilityNone {
+		if err := syncBackup(dbBackupPath, cfg.Durability); err != nil {
+			errorsMu.Lock()
+			errors[db.Name] = fmt.Errorf("failed to sync backup: %v", err)
+			errorsMu.Unlock()
+			progressTracker.CompleteItem(0)
+			return
+		}
+	}
+
+	// Damage the staged copy when fault injection asks for it, so that
+	// verification has something to catch
+	if corrupted, err := faults.CorruptTree(dbBackupPath); err != nil {
+		logger.Warning("Fault injection could not corrupt %s: %v", dbBackupPath, err)
+	} else if corrupted > 0 {
+		logger.Warning("Fault injection corrupted %d byte(s) in %s", corrupted, dbBackupPath)
+	}
 
-	// Verify backup if requested
-	if cfg.Verify {
-		err = verify.VerifyBackup(db, dbBackupPath, progressTracker)
+	// Verify backup if requested. A copy of a corrupted source cannot pass
+	// the integrity check, so items archived despite corruption are skipped.
+	// Sampled verification implies the quick checks as well.
+	verifyRequested := cfg.Verify || cfg.VerifySample != ""
+	if verifyRequested && sourceCorrupt {
+		logger.Warning("Skipping verification of %s: source failed its integrity check", db.Name)
+		itemLog.Verification = "skipped: source failed its integrity check"
+	} else if verifyRequested && exporting {
+		logger.Warning("Skipping verification of %s: exported %s files are not a database", db.Name, cfg.RocksDBExport)
+		itemLog.Verification = fmt.Sprintf("skipped: exported %s files are not a database", cfg.RocksDBExport)
+	} else if verifyRequested {
+		verifyStarted := time.Now()
+		var verifyWarnings []string
+		verifyWarnings, err = verify.VerifyBackup(db, dbBackupPath, progressTracker)
+		warnings = append(warnings, verifyWarnings...)
+		if err == nil && cfg.VerifySample != "" {
+			// Validated with the rest of the configuration
+			fraction, _ := types.ParseSamplePercent(cfg.VerifySample)
+			_, err = verify.VerifySample(db, dbBackupPath, verify.SampleOptions{Fraction: fraction, Seed: cfg.VerifySeed})
+		}
+		itemLog.VerifyTime = time.Since(verifyStarted)
 		if err != nil {
+			itemLog.Verification = fmt.Sprintf("failed: %v", err)
 			if !showProgress {
 				logger.Error("Verification failed for %s: %v", db.Name, err)
 			}
 			errorsMu.Lock()
-			errors[db.Name] = fmt.Errorf("verification failed: %v", err)
+			errors[db.Name] = fmt.Errorf("verification failed: %w", err)
 			errorsMu.Unlock()
 			progressTracker.CompleteItem(db.Size)
 			return
 		} else {
+			itemLog.Verification = verificationPassed
 			if !showProgress {
 				logger.Info("Verification passed for %s", db.Name)
 			}
 		}
 	}
 
+	item := manifestItem(db, cfg.Namespace, manifest.StatusOK, nil, externalPaths)
+	item.Warnings = warnings
+	item.BackupSize = utils.CalculateSize(dbBackupPath)
+	item.SequenceNumber = result.SequenceNumber
+	item.Checksums = copiedChecksums(dbBackupPath)
+	// A SQLite backup keeps the database file inside the item directory
+	formatPath := dbBackupPath
+	if db.Type == types.DatabaseTypeSQLite {
+		formatPath = filepath.Join(dbBackupPath, filepath.Base(db.Path))
+	}
+	if exporting {
+		item.Export = cfg.RocksDBExport
+	} else if db.Encrypted {
+		logger.Debug("%s is encrypted; its format is not recorded", db.Name)
+	} else if format, err := backup.ReadFormatInfo(db.Type, formatPath); err != nil {
+		logger.Warning("Could not read the format of %s: %v", db.Name, err)
+	} else {
+		item.RocksDBVersion = format.RocksDBVersion
+		item.FormatVersion = format.FormatVersion
+		item.PageSize = format.PageSize
+		item.SchemaFormat = format.SchemaFormat
+	}
+	backupManifest.AddItem(item)
+	if itemDone != nil {
+		itemDone(item)
+	}
+
 	progressTracker.CompleteItem(db.Size)
 	if !showProgress {
 		logger.Info("Successfully processed %s", db.Name)
 	}
 }
 
-// initLogger initializes the logger with configuration settings
-func initLogger(cfg *types.Config) {
-	// Determine log level from config
-	var level logger.LogLevel
-	switch strings.ToLower(cfg.LogLevel) {
-	case "debug":
-		level = logger.DEBUG
-	case "info":
-		level = logger.INFO
-	case "warning", "warn":
-		level = logger.WARNING
-	case "error":
-		level = logger.ERROR
-	default:
-		level = logger.INFO
+// updateCatalog records this run's item sizes in the catalog and returns how
+// many items shrank dramatically against their trailing average
+func updateCatalog(cfg *types.Config, backupPath string, backupManifest *manifest.Manifest, started time.Time) (int, error) {
+	backupCatalog, err := catalog.Load(cfg.CatalogPath)
+	if err != nil {
+		return 0, err
+	}
+
+	run := catalog.Run{
+		RunID:      backupManifest.RunID,
+		Namespace:  cfg.Namespace,
+		Time:       time.Now().UTC(),
+		BackupPath: backupPath,
+		Duration:   time.Since(started).Seconds(),
+	}
+	for _, item := range backupManifest.Items {
+		if item.Status != manifest.StatusOK {
+			continue
+		}
+		run.Items = append(run.Items, catalog.ItemRecord{
+			SourceRoot: item.SourceRoot,
+			SourcePath: item.SourcePath,
+			Type:       item.Type,
+			Size:       item.BackupSize,
+
+			Classifications: item.Classifications,
+		})
+	}
+
+	threshold := cfg.SizeDropThreshold
+	if threshold == 0 {
+		threshold = constants.DefaultSizeDropThreshold
+	}
+	// Tenants sharing a catalog may back up the same source paths
+	anomalies := backupCatalog.InNamespace(cfg.Namespace).DetectSizeAnomalies(run, constants.AnomalyWindow, float64(threshold)/100)
+	for _, anomaly := range anomalies {
+		logger.Warning("⚠️  Size anomaly: %s is %s, %.0f%% below its trailing average of %s",
+			anomaly.SourcePath, utils.FormatBytes(anomaly.Size), anomaly.Drop*100, utils.FormatBytes(anomaly.Average))
 	}
 
+	backupCatalog.AddRun(run)
+	if err := backupCatalog.Save(cfg.CatalogPath); err != nil {
+		return len(anomalies), err
+	}
+	return len(anomalies), nil
+}
+
+// recordArchive stores the absolute archive path and the archive size on
+// the run's catalog entry. Per-item archives are directories and get no size.
+func recordArchive(catalogPath, runID, archivePath string) error {
+	backupCatalog, err := catalog.Load(catalogPath)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve archive path: %v", err)
+	}
+	var size int64
+	if info, err := os.Stat(archivePath); err == nil && info.Mode().IsRegular() {
+		size = info.Size()
+	}
+	if !backupCatalog.SetArchivePath(runID, absPath, size) {
+		return fmt.Errorf("run %s is not in the catalog", runID)
+	}
+	return backupCatalog.Save(catalogPath)
+}
+
+// checkSQLiteUnit runs the source integrity check on a SQLite database and
+// its attached databases. Foreign key violations are returned as warnings.
+// The bool reports whether the error is corruption, which the
+// -on-corruption policy applies to, rather than a check that could not run.
+func checkSQLiteUnit(db types.DatabaseInfo) ([]string, bool, error) {
+	var warnings []string
+	paths := []string{db.Path}
+	for _, attachment := range db.Attachments {
+		if _, err := os.Stat(attachment); err == nil {
+			paths = append(paths, attachment)
+		}
+	}
+	for _, path := range paths {
+		err := verify.CheckSQLiteIntegrity(path)
+		var violations string
+		if err == nil {
+			violations, err = verify.CheckSQLiteForeignKeys(path)
+		}
+		if path != db.Path {
+			if err != nil {
+				err = fmt.Errorf("attached database %s: %w", path, err)
+			}
+			if violations != "" {
+				violations = fmt.Sprintf("attached database %s: %s", path, violations)
+			}
+		}
+		if err != nil {
+			return warnings, stderrors.Is(err, apperr.ErrCorrupt), err
+		}
+		if violations != "" {
+			logger.Warning("⚠️  %s: %s", db.Name, violations)
+			warnings = append(warnings, violations)
+		}
+	}
+	return warnings, false, nil
+}
+
+// itemBackupPath returns where an item is stored relative to the backup
+// root: below a subdirectory per source, to avoid name collisions, inside
+// the namespace directory if there is one
+func itemBackupPath(namespace string, db types.DatabaseInfo) string {
+	return filepath.Join(sourceBackupDir(namespace, db.SourceRoot), db.Name)
+}
+
+// sourceBackupDir returns the subdirectory of the backup root holding the
+// items of sourceRoot
+func sourceBackupDir(namespace, sourceRoot string) string {
+	sourceBaseName := filepath.Base(sourceRoot)
+	if sourceBaseName == "." || sourceBaseName == "" {
+		sourceBaseName = "root"
+	}
+	// Namespaces are validated to be a single path component
+	return filepath.Join(namespace, sourceBaseName)
+}
+
+// manifestItem builds the manifest entry for a processed database
+func manifestItem(db types.DatabaseInfo, namespace, status string, err error, externalPaths []manifest.PathMapping) manifest.Item {
+	item := manifest.Item{
+		Name:          db.Name,
+		Type:          db.Type.String(),
+		SourceRoot:    db.SourceRoot,
+		SourcePath:    db.Path,
+		BackupPath:    filepath.ToSlash(itemBackupPath(namespace, db)),
+		Size:          db.Size,
+		Status:        status,
+		ExternalPaths: externalPaths,
+		Encrypted:     db.Encrypted,
+
+		Classifications: db.Classifications,
+
+		ConsistencyGroup: db.ConsistencyGroup,
+	}
+	if err != nil {
+		item.Error = err.Error()
+	}
+	return item
+}
+
+// copiedChecksums returns the checksums recorded while the files of the
+// item at dbBackupPath were copied, keyed by path relative to it. Files
+// written another way, such as a RocksDB checkpoint, have none.
+func copiedChecksums(dbBackupPath string) map[string]string {
+	var checksums map[string]string
+	filepath.WalkDir(dbBackupPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		sum, ok := utils.CopyChecksum(path)
+		if !ok {
+			return nil
+		}
+		relPath, err := filepath.Rel(dbBackupPath, path)
+		if err != nil {
+			return nil
+		}
+		if checksums == nil {
+			checksums = make(map[string]string)
+		}
+		checksums[filepath.ToSlash(relPath)] = sum
+		return nil
+	})
+	return checksums
+}
+
+// syncBackup fsyncs a finished backup. With full durability the directories
+// and the parent entry are synced too, so the new backup cannot vanish.
+func syncBackup(dbBackupPath, durability string) error {
+	syncDirs := durability == constants.DurabilityFull
+	if err := utils.SyncTree(dbBackupPath, syncDirs); err != nil {
+		return err
+	}
+	if syncDirs {
+		return utils.SyncDir(filepath.Dir(dbBackupPath))
+	}
+	return nil
+}
+
+// rocksDBExclusions returns the patterns of RocksDB files to leave out of
+// the backup: none with keep_rocksdb_artifacts, otherwise rocksdb_exclude
+// or the defaults
+func rocksDBExclusions(cfg *types.Config) string {
+	if cfg.KeepRocksDBArtifacts {
+		return ""
+	}
+	if cfg.RocksDBExclude != "" {
+		return cfg.RocksDBExclude
+	}
+	return constants.DefaultRocksDBExclude
+}
+
+// sourceDateEpoch returns the time given by the SOURCE_DATE_EPOCH environment
+// variable, or the zero time when it is unset or invalid
+func sourceDateEpoch() time.Time {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		logger.Warning("Ignoring invalid SOURCE_DATE_EPOCH %q: %v", value, err)
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// faultInjectFlag is left out of -help: it is meant for CI, not operators
+const faultInjectFlag = "fault-inject"
+
+// usageWithoutHiddenFlags prints the default usage minus hidden flags
+func usageWithoutHiddenFlags() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage of %s:\n", os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == faultInjectFlag {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		line := "  -" + f.Name
+		if name != "" {
+			line += " " + name
+		}
+		switch f.DefValue {
+		case "", "false", "0":
+		default:
+			if name == "string" {
+				usage += fmt.Sprintf(" (default %q)", f.DefValue)
+			} else {
+				usage += fmt.Sprintf(" (default %v)", f.DefValue)
+			}
+		}
+		fmt.Fprintf(output, "%s\n    \t%s\n", line, strings.ReplaceAll(usage, "\n", "\n    \t"))
+	})
+}
+
+// initLogger initializes the logger with configuration settings
+func initLogger(cfg *types.Config) {
+	// Determine log level from config (unknown levels fall back to info)
+	level, _ := logger.ParseLevel(cfg.LogLevel)
 	logger.SetLevel(level)
+	for module, moduleLevel := range cfg.LogLevels {
+		if level, err := logger.ParseLevel(moduleLevel); err == nil {
+			logger.SetModuleLevel(module, level)
+		}
+	}
 	logger.SetColorOutput(cfg.ColorLog)
 
+	// A system log that cannot be reached leaves messages on stderr
+	var sink logger.Sink
+	var err error
+	switch cfg.LogOutput {
+	case constants.LogOutputSyslog:
+		sink, err = logger.NewSyslogSink(constants.LogTag)
+	case constants.LogOutputJournald:
+		sink, err = logger.NewJournalSink(constants.LogTag)
+	}
+	if err != nil {
+		logger.Warning("Logging to stderr instead of %s: %v", cfg.LogOutput, err)
+	}
+	logger.SetSink(sink)
+
 	// Log the logger initialization at debug level
-	logger.Debug("Logger initialized: level=%s, color=%t", cfg.LogLevel, cfg.ColorLog)
+	logger.Debug("Logger initialized: level=%s, color=%t, output=%s", cfg.LogLevel, cfg.ColorLog, cfg.LogOutput)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/constants"
+)
+
+// runConfigMigrate implements "config migrate": it upgrades a config file to
+// the current schema and prints it, or rewrites it in place keeping a .bak
+// copy of the original
+func runConfigMigrate(args []string, stdout, stderr io.Writer) int {
+	migrateCmd := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	configFile := migrateCmd.String("config", "", "Config file to migrate")
+	inPlace := migrateCmd.Bool("w", false, "Rewrite the file in place (the original is kept as <file>.bak)")
+	if err := migrateCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if *configFile == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles config migrate -config=config_file [-w]")
+		return 1
+	}
+
+	data, err := os.ReadFile(*configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to read config file: %v\n", err)
+		return 1
+	}
+	result, err := config.MigrateConfig(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+
+	for _, note := range result.Notes {
+		fmt.Fprintf(stderr, "Note: %s\n", note)
+	}
+
+	if !*inPlace {
+		stdout.Write(result.Data)
+		return 0
+	}
+
+	if result.FromVersion == constants.ConfigVersion {
+		fmt.Fprintf(stderr, "%s is already at config_version %d\n", *configFile, constants.ConfigVersion)
+		return 0
+	}
+	if err := os.WriteFile(*configFile+".bak", data, constants.FilePermission); err != nil {
+		fmt.Fprintf(stderr, "Failed to back up config file: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(*configFile, result.Data, constants.FilePermission); err != nil {
+		fmt.Fprintf(stderr, "Failed to write config file: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Migrated %s from config_version %d to %d (original saved as %s.bak)\n",
+		*configFile, result.FromVersion, constants.ConfigVersion, *configFile)
+	return 0
+}
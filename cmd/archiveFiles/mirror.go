@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"archiveFiles/internal/approval"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/mirror"
+	"archiveFiles/internal/restore"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// mirrorStats counts what a mirror upload did with the files of a backup
+type mirrorStats struct {
+	Sent      int   // Files sent over the connection
+	SentBytes int64 // Bytes of the files sent
+	Linked    int   // Files hard-linked to an identical file of the previous run
+}
+
+// mirrorRun mirrors the backup at backupPath to the target of cfg and
+// returns where it was stored
+func mirrorRun(cfg *types.Config, backupPath, runID string) (string, error) {
+	remote, err := parseRemoteTarget(cfg.MirrorTarget)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Namespace != "" {
+		remote.Path = path.Join(remote.Path, cfg.Namespace)
+	}
+	sshCommand := cfg.MirrorSSH
+	if sshCommand == "" {
+		sshCommand = "ssh"
+	}
+	sshArgs := strings.Fields(sshCommand)
+	if len(sshArgs) == 0 {
+		return "", fmt.Errorf("mirror_ssh must not be empty")
+	}
+
+	runDir, stats, err := mirrorBackup(sshArgs, backupPath, remote, runID, cfg.Namespace, constants.TransferParallel)
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Mirrored %d file(s) (%s) and linked %d unchanged file(s) to %s:%s",
+		stats.Sent, utils.FormatBytes(stats.SentBytes), stats.Linked, remote.Host, runDir)
+	return remote.Host + ":" + runDir, nil
+}
+
+// mirrorBackup copies the backup at backupPath file by file into a
+// directory of the same name below remote.Path, up to parallel files at
+// once. Files identical to one of the previous mirror are hard-linked to it
+// instead of being sent again. The index is written after every file and
+// LATEST is pointed at the run last, so a mirror interrupted halfway is
+// never taken for a complete one.
+func mirrorBackup(sshArgs []string, backupPath string, remote remoteTarget, runID, namespace string, parallel int) (string, mirrorStats, error) {
+	var stats mirrorStats
+	index, err := mirror.Build(backupPath)
+	if err != nil {
+		return "", stats, err
+	}
+	index.RunID = runID
+	index.Namespace = namespace
+
+	runName := filepath.Base(backupPath)
+	runDir := path.Join(remote.Path, runName)
+	previousDir, previous := loadPreviousMirror(sshArgs, remote, runName)
+	var previousFiles map[string]mirror.File
+	if previous != nil {
+		previousFiles = previous.BySHA256()
+	}
+
+	if err := runRemote(sshArgs, remote.Host, "mkdir -p "+shellQuote(runDir), nil, nil); err != nil {
+		return "", stats, fmt.Errorf("failed to create %s: %v", runDir, err)
+	}
+
+	files := make([]int, len(index.Files))
+	for i := range files {
+		files[i] = i
+	}
+	var statsMu sync.Mutex
+	err = transferParts(files, parallel, func(i int) error {
+		file := index.Files[i]
+		target := path.Join(runDir, file.Path)
+		// A shared inode has one mode, so only identical modes are linked.
+		// Hosts without hard links get the file sent instead.
+		if same, ok := previousFiles[file.SHA256]; ok && same.Mode == file.Mode {
+			link := fmt.Sprintf("mkdir -p %s && ln -f %s %s", shellQuote(path.Dir(target)), shellQuote(path.Join(previousDir, same.Path)), shellQuote(target))
+			if err := runRemote(sshArgs, remote.Host, link, nil, nil); err == nil {
+				statsMu.Lock()
+				stats.Linked++
+				statsMu.Unlock()
+				return nil
+			}
+		}
+
+		source, err := os.Open(filepath.Join(backupPath, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", file.Path, err)
+		}
+		defer source.Close()
+		if err := putRemoteFile(sshArgs, remote.Host, target, source, file.Size, file.Mode); err != nil {
+			return fmt.Errorf("failed to mirror %s: %v", file.Path, err)
+		}
+		statsMu.Lock()
+		stats.Sent++
+		stats.SentBytes += file.Size
+		statsMu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return "", stats, err
+	}
+
+	data, err := index.Marshal()
+	if err != nil {
+		return "", stats, err
+	}
+	if err := putRemoteFile(sshArgs, remote.Host, path.Join(runDir, mirror.IndexFileName), bytes.NewReader(data), int64(len(data)), constants.FilePermission); err != nil {
+		return "", stats, fmt.Errorf("failed to write mirror index: %v", err)
+	}
+	latest := path.Join(remote.Path, mirror.LatestFileName)
+	if err := putRemoteFile(sshArgs, remote.Host, latest, strings.NewReader(runName), int64(len(runName)), constants.FilePermission); err != nil {
+		return "", stats, fmt.Errorf("failed to update %s: %v", latest, err)
+	}
+	return runDir, stats, nil
+}
+
+// putRemoteFile writes size bytes from content to target on host through
+// <target>.partial, which is renamed into place once its size is right
+func putRemoteFile(sshArgs []string, host, target string, content io.Reader, size int64, mode os.FileMode) error {
+	partialPath := target + constants.UploadPartialSuffix
+	command := fmt.Sprintf("mkdir -p %s && cat > %s && [ $(wc -c < %s) -eq %d ] && chmod %o %s && mv -f %s %s",
+		shellQuote(path.Dir(target)), shellQuote(partialPath), shellQuote(partialPath), size,
+		mode.Perm(), shellQuote(partialPath), shellQuote(partialPath), shellQuote(target))
+	return runRemote(sshArgs, host, command, content, nil)
+}
+
+// loadPreviousMirror returns the run directory and index LATEST points to
+// below remote.Path, or nil when there is no previous mirror to link
+// unchanged files to
+func loadPreviousMirror(sshArgs []string, remote remoteTarget, runName string) (string, *mirror.Index) {
+	var out bytes.Buffer
+	latest := path.Join(remote.Path, mirror.LatestFileName)
+	if err := runRemote(sshArgs, remote.Host, fmt.Sprintf("if [ -f %[1]s ]; then cat %[1]s; fi", shellQuote(latest)), nil, &out); err != nil {
+		logger.Warning("Failed to read %s, sending every file: %v", latest, err)
+		return "", nil
+	}
+	previousName := strings.TrimSpace(out.String())
+	if previousName == "" || previousName == runName || strings.Contains(previousName, "/") {
+		return "", nil
+	}
+
+	previousDir := path.Join(remote.Path, previousName)
+	out.Reset()
+	if err := runRemote(sshArgs, remote.Host, "cat "+shellQuote(path.Join(previousDir, mirror.IndexFileName)), nil, &out); err != nil {
+		logger.Warning("Failed to read the index of the previous mirror %s, sending every file: %v", previousDir, err)
+		return "", nil
+	}
+	index, err := mirror.Parse(out.Bytes())
+	if err != nil {
+		logger.Warning("%v; sending every file", err)
+		return "", nil
+	}
+	return previousDir, index
+}
+
+// mirrorSource is a mirrored run a restore reads from
+type mirrorSource struct {
+	sshArgs  []string
+	host     string
+	runDir   string
+	index    *mirror.Index
+	manifest []byte // manifest.json of the run, which approval tokens are bound to
+}
+
+// openMirror reads the index and manifest of the mirrored run at target,
+// user@host:/path of either a run directory or a mirror target, whose
+// LATEST run is used then
+func openMirror(sshArgs []string, target string) (*mirrorSource, error) {
+	if len(sshArgs) == 0 {
+		return nil, fmt.Errorf("-ssh must not be empty")
+	}
+	remote, err := parseRemoteTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	latest := path.Join(remote.Path, mirror.LatestFileName)
+	if err := runRemote(sshArgs, remote.Host, fmt.Sprintf("if [ -f %[1]s ]; then cat %[1]s; fi", shellQuote(latest)), nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", latest, err)
+	}
+	source := &mirrorSource{sshArgs: sshArgs, host: remote.Host, runDir: remote.Path}
+	if name := strings.TrimSpace(out.String()); name != "" {
+		source.runDir = path.Join(remote.Path, name)
+	}
+
+	out.Reset()
+	if err := runRemote(sshArgs, remote.Host, "cat "+shellQuote(path.Join(source.runDir, mirror.IndexFileName)), nil, &out); err != nil {
+		return nil, fmt.Errorf("%s is not a complete mirror: %v", source.name(), err)
+	}
+	if source.index, err = mirror.Parse(out.Bytes()); err != nil {
+		return nil, err
+	}
+	out.Reset()
+	if err := runRemote(sshArgs, remote.Host, "cat "+shellQuote(path.Join(source.runDir, manifest.FileName)), nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of %s: %v", source.name(), err)
+	}
+	source.manifest = out.Bytes()
+	return source, nil
+}
+
+// name returns host:path of the mirrored run
+func (s *mirrorSource) name() string {
+	return s.host + ":" + s.runDir
+}
+
+// namespace returns the namespace recorded in the manifest of the run and
+// the manifest's digest, like archiveNamespace does for archives
+func (s *mirrorSource) namespace() (string, string, error) {
+	m, err := manifest.Parse(s.manifest)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse the manifest of %s: %v", s.name(), err)
+	}
+	return m.Namespace, approval.ManifestDigest(s.manifest), nil
+}
+
+// extractor returns the ExtractFunc fetching the files of items (all if
+// empty) into the staging directory, up to parallel files at once. Every
+// file is checked against its SHA-256 in the index.
+func (s *mirrorSource) extractor(items []string, parallel int, stderr io.Writer) restore.ExtractFunc {
+	return func(dir string) error {
+		m, err := manifest.Parse(s.manifest)
+		if err != nil {
+			return fmt.Errorf("failed to parse the manifest of %s: %v", s.name(), err)
+		}
+		files, err := s.index.Select(m, items)
+		if err != nil {
+			return err
+		}
+		var size int64
+		for _, file := range files {
+			size += file.Size
+		}
+		fmt.Fprintf(stderr, "Fetching %d of %d file(s) (%s) from %s...\n", len(files), len(s.index.Files), utils.FormatBytes(size), s.name())
+
+		if err := os.MkdirAll(dir, constants.DirPermission); err != nil {
+			return err
+		}
+		parts := make([]int, len(files))
+		for i := range parts {
+			parts[i] = i
+		}
+		return transferParts(parts, parallel, func(i int) error {
+			return s.fetchFile(files[i], dir)
+		})
+	}
+}
+
+// fetchFile copies one file of the run into dir and checks its checksum
+func (s *mirrorSource) fetchFile(file mirror.File, dir string) error {
+	// The index comes from the remote host; nothing may land outside dir
+	relPath := filepath.FromSlash(file.Path)
+	if !filepath.IsLocal(relPath) {
+		return fmt.Errorf("mirror index entry %q escapes the restore directory", file.Path)
+	}
+	localPath := filepath.Join(dir, relPath)
+	if err := os.MkdirAll(filepath.Dir(localPath), constants.DirPermission); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	fetchErr := runRemote(s.sshArgs, s.host, "cat "+shellQuote(path.Join(s.runDir, file.Path)), nil, io.MultiWriter(out, hash))
+	closeErr := out.Close()
+	if fetchErr != nil {
+		return fmt.Errorf("failed to fetch %s: %v", file.Path, fetchErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to write %s: %v", localPath, closeErr)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%s does not match its checksum in the mirror index", file.Path)
+	}
+	return nil
+}
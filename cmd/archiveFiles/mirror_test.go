@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/mirror"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+func TestMirrorBackup_LinksUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	remote := remoteTarget{Host: "nas", Path: filepath.Join(dir, "mirror")}
+	writeBackup := func(name, walContent string) string {
+		backupPath := filepath.Join(dir, name)
+		files := map[string]string{
+			"data/db/000001.sst": "immutable table",
+			"data/db/000002.log": walContent,
+			"manifest.json":      "{}",
+		}
+		for file, content := range files {
+			path := filepath.Join(backupPath, filepath.FromSlash(file))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return backupPath
+	}
+
+	first := writeBackup("backup_1", "wal 1")
+	runDir, stats, err := mirrorBackup(fakeSSH(t), first, remote, "run1", "", 2)
+	if err != nil {
+		t.Fatalf("mirrorBackup failed: %v", err)
+	}
+	if runDir != filepath.Join(remote.Path, "backup_1") || stats.Sent != 3 || stats.Linked != 0 {
+		t.Errorf("runDir = %s, stats %+v, want 3 files sent to backup_1", runDir, stats)
+	}
+
+	second := writeBackup("backup_2", "wal 2")
+	runDir, stats, err = mirrorBackup(fakeSSH(t), second, remote, "run2", "", 2)
+	if err != nil {
+		t.Fatalf("mirrorBackup failed: %v", err)
+	}
+	if stats.Sent != 1 || stats.Linked != 2 {
+		t.Errorf("stats = %+v, want the WAL sent and the rest linked", stats)
+	}
+	previousSST, _ := os.Stat(filepath.Join(remote.Path, "backup_1", "data", "db", "000001.sst"))
+	currentSST, err := os.Stat(filepath.Join(runDir, "data", "db", "000001.sst"))
+	if err != nil || !os.SameFile(previousSST, currentSST) {
+		t.Errorf("Unchanged SST should be a hard link to the previous run (stat error: %v)", err)
+	}
+	if wal, _ := os.ReadFile(filepath.Join(runDir, "data", "db", "000002.log")); string(wal) != "wal 2" {
+		t.Errorf("WAL = %q, want the new content", wal)
+	}
+
+	latest, _ := os.ReadFile(filepath.Join(remote.Path, mirror.LatestFileName))
+	if string(latest) != "backup_2" {
+		t.Errorf("LATEST = %q, want backup_2", latest)
+	}
+	data, err := os.ReadFile(filepath.Join(runDir, mirror.IndexFileName))
+	if err != nil {
+		t.Fatalf("Index missing: %v", err)
+	}
+	index, err := mirror.Parse(data)
+	if err != nil || index.RunID != "run2" || len(index.Files) != 3 {
+		t.Errorf("Unexpected index %+v (%v)", index, err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(runDir, "*", "*", "*"+constants.UploadPartialSuffix))
+	if len(leftovers) != 0 {
+		t.Errorf("Partial files left behind: %v", leftovers)
+	}
+}
+
+func TestRunArchive_Mirror(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mirrorRoot := filepath.Join(tempDir, "mirror")
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(tempDir, "backup"),
+		Method:       constants.MethodCheckpoint,
+		BatchMode:    true,
+		Output:       constants.OutputMirror,
+		MirrorTarget: "nas:" + mirrorRoot,
+		MirrorSSH:    fakeSSH(t)[0],
+		Namespace:    "teamA",
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+		Yes:          true,
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	if result.ArchivePath != "" || !strings.HasPrefix(result.MirrorPath, "nas:"+filepath.Join(mirrorRoot, "teamA")) {
+		t.Errorf("ArchivePath = %q, MirrorPath = %q, want only a mirror below the namespace", result.ArchivePath, result.MirrorPath)
+	}
+	mirrored := filepath.Join(mirrorRoot, "teamA", "backup")
+	if content, err := os.ReadFile(filepath.Join(mirrored, "teamA", "source", "app.log", "app.log")); err != nil || string(content) != "log line\n" {
+		t.Errorf("Mirrored log = %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(mirrored, mirror.IndexFileName)); err != nil {
+		t.Errorf("Mirror index missing: %v", err)
+	}
+	if _, err := os.Stat(cfg.BackupPath); !os.IsNotExist(err) {
+		t.Errorf("Backup directory should be removed after mirroring, stat error: %v", err)
+	}
+}
+
+func TestRunRestoreArchive_Mirror(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.log", "b.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(name+" line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mirrorRoot := filepath.Join(tempDir, "mirror")
+	ssh := fakeSSH(t)[0]
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(tempDir, "backup"),
+		Method:       constants.MethodCheckpoint,
+		BatchMode:    true,
+		Output:       constants.OutputMirror,
+		MirrorTarget: "nas:" + mirrorRoot,
+		MirrorSSH:    ssh,
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+		Yes:          true,
+	}
+	if _, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil); err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	t.Setenv("ARCHIVEFILES_APPROVAL_TOKEN", "")
+
+	// Only the selected item and the files outside items are fetched,
+	// from the run LATEST names
+	target := filepath.Join(tempDir, "restored")
+	var stdout, stderr bytes.Buffer
+	code := runRestoreArchive([]string{"-mirror", "nas:" + mirrorRoot, "-ssh", ssh, "-items", "source/b.log", "-target", target}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+	if content, err := os.ReadFile(filepath.Join(target, "source", "b.log", "b.log")); err != nil || string(content) != "b.log line\n" {
+		t.Errorf("Restored b.log = %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "source", "a.log")); !os.IsNotExist(err) {
+		t.Errorf("Unselected item should not be restored, stat error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "manifest.json")); err != nil {
+		t.Errorf("Manifest should be restored with the item: %v", err)
+	}
+
+	// A file changed on the mirror host fails the restore and leaves nothing
+	if err := os.WriteFile(filepath.Join(mirrorRoot, "backup", "source", "a.log", "a.log"), []byte("tampered\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(tempDir, "tampered")
+	stderr.Reset()
+	code = runRestoreArchive([]string{"-mirror", "nas:" + filepath.Join(mirrorRoot, "backup"), "-ssh", ssh, "-target", tampered}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "does not match its checksum") {
+		t.Errorf("exit code = %d, stderr %q, want a checksum mismatch", code, stderr.String())
+	}
+	if _, err := os.Stat(tampered); !os.IsNotExist(err) {
+		t.Errorf("A failed restore should leave nothing at the target, stat error: %v", err)
+	}
+}
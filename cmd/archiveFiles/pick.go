@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/restore"
+	"archiveFiles/internal/utils"
+)
+
+// pickEntry is an archived run offered by "restore -pick"
+type pickEntry struct {
+	Run     catalog.Run
+	Sources []string // Source roots of the run's items
+	Size    int64    // Total size of the run's items in the backup
+}
+
+// label describes the entry on one line: date, sources, size and archive
+func (e pickEntry) label() string {
+	return fmt.Sprintf("%s  %-30s %10s  %s", e.Run.Time.Local().Format("2006-01-02 15:04"),
+		strings.Join(e.Sources, ","), utils.FormatBytes(e.Size), e.Run.ArchivePath)
+}
+
+// pickRequested reports whether the restore arguments ask for -pick, which
+// is handled apart from the BackupEngine restore
+func pickRequested(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-pick", "--pick", "-pick=true", "--pick=true":
+			return true
+		}
+	}
+	return false
+}
+
+// runRestorePick implements "restore -pick": it lists the archived runs of
+// the catalog, narrows them down with a fuzzy search until one is picked,
+// then verifies that archive, extracts it into -target and checks the
+// restored databases. -query picks without prompting when it matches
+// exactly one run.
+func runRestorePick(args []string, stdout, stderr io.Writer) int {
+	pickCmd := flag.NewFlagSet("restore -pick", flag.ContinueOnError)
+	pickCmd.Bool("pick", true, "Pick the archive to restore from the catalog")
+	configFile := pickCmd.String("config", "", "JSON configuration file naming the catalog (default: search standard locations)")
+	catalogPath := pickCmd.String("catalog", "", "Catalog file (overrides catalog_path from the config)")
+	targetDir := pickCmd.String("target", "", "Directory to restore into")
+	query := pickCmd.String("query", "", "Initial search; picks without prompting when it matches a single archive")
+	strict := pickCmd.Bool("strict", false, "Fail instead of warning when the backup needs newer SQLite/RocksDB versions than this host has")
+	token := pickCmd.String("approval-token", os.Getenv(constants.ApprovalTokenEnv), "Approval token from approve-restore, needed for archives of protected namespaces (default: $"+constants.ApprovalTokenEnv+")")
+	if err := pickCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+
+	// The config supplies the restore approval settings even with -catalog
+	if *configFile == "" {
+		*configFile = config.FindDefaultConfig()
+	}
+	guard := &restoreGuard{}
+	if *configFile != "" {
+		cfg, err := config.LoadConfigFromJSON(*configFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		if *catalogPath == "" {
+			*catalogPath = cfg.CatalogPath
+		}
+		if guard, err = newRestoreGuard(cfg); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if *catalogPath == "" || *targetDir == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles restore -pick -target=directory [-config=file] [-catalog=catalog.json] [-query=search] [-strict] [-approval-token=token]")
+		return 1
+	}
+
+	backupCatalog, err := catalog.Load(*catalogPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	entries := pickEntries(backupCatalog)
+	if len(entries) == 0 {
+		fmt.Fprintln(stderr, "Error: no archive recorded in the catalog exists on disk")
+		return 1
+	}
+
+	entry, ok := pickArchive(entries, *query, stderr)
+	if !ok {
+		return 1
+	}
+
+	archivePath := entry.Run.ArchivePath
+	attempt, err := guard.authorize(archivePath, *targetDir, *token, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore denied: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Verifying %s...\n", archivePath)
+	if err := checkArchive(archivePath, nil); err != nil {
+		guard.finish(attempt, err, stderr)
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "Restoring %s to %s...\n", archivePath, *targetDir)
+	check := compatibilityCheck(restore.CurrentEnvironment(), *strict, stderr)
+	err = restore.RestoreArchive(archivePath, *targetDir, func(dir string) error {
+		if err := check(dir); err != nil {
+			return err
+		}
+		return verifyRestoredItems(dir, stderr)
+	})
+	guard.finish(attempt, err, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, *targetDir)
+	return 0
+}
+
+// pickEntries returns the runs whose archive still exists, newest first
+func pickEntries(backupCatalog *catalog.Catalog) []pickEntry {
+	var entries []pickEntry
+	for _, run := range backupCatalog.Runs {
+		if run.ArchivePath == "" {
+			continue
+		}
+		if _, err := os.Stat(run.ArchivePath); err != nil {
+			continue
+		}
+
+		entry := pickEntry{Run: run}
+		seen := make(map[string]bool)
+		for _, item := range run.Items {
+			source := item.SourceRoot
+			if source == "" {
+				source = item.SourcePath
+			}
+			if !seen[source] {
+				seen[source] = true
+				entry.Sources = append(entry.Sources, source)
+			}
+			entry.Size += item.Size
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Run.Time.After(entries[j].Run.Time) })
+	return entries
+}
+
+// pickArchive narrows entries down to the one to restore. On a terminal
+// the matches are listed and the user enters a number to pick one or text
+// to search again; otherwise query must match exactly one entry.
+func pickArchive(entries []pickEntry, query string, stderr io.Writer) (pickEntry, bool) {
+	matches := filterEntries(entries, query)
+	if !interactive {
+		if len(matches) == 1 {
+			return matches[0], true
+		}
+		fmt.Fprintf(stderr, "Error: -query %q matches %d archives; refine it to match exactly one:\n", query, len(matches))
+		printEntries(stderr, matches)
+		return pickEntry{}, false
+	}
+
+	input := bufio.NewReader(promptInput)
+	for {
+		printEntries(promptOutput, matches)
+		fmt.Fprint(promptOutput, "Number to restore, or text to search (empty to quit): ")
+		line, _ := input.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			fmt.Fprintln(stderr, "Restore aborted")
+			return pickEntry{}, false
+		}
+
+		if n, convErr := strconv.Atoi(line); convErr == nil {
+			if n >= 1 && n <= len(matches) {
+				return matches[n-1], true
+			}
+			fmt.Fprintf(promptOutput, "No archive %d\n", n)
+			continue
+		}
+		matches = filterEntries(entries, line)
+	}
+}
+
+// printEntries lists entries numbered from 1
+func printEntries(out io.Writer, entries []pickEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No matching archives")
+	}
+	for i, entry := range entries {
+		fmt.Fprintf(out, "%3d) %s\n", i+1, entry.label())
+	}
+}
+
+// filterEntries returns the entries whose label fuzzy-matches every word
+// of query
+func filterEntries(entries []pickEntry, query string) []pickEntry {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return entries
+	}
+
+	var matches []pickEntry
+	for _, entry := range entries {
+		label := entry.label() + " " + entry.Run.RunID
+		matched := true
+		for _, word := range words {
+			if !fuzzyMatch(word, label) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in text in
+// order, ignoring case, so "0315dat" matches "2024-03-15 02:00  /data"
+func fuzzyMatch(pattern, text string) bool {
+	remaining := []rune(strings.ToLower(pattern))
+	for _, r := range strings.ToLower(text) {
+		if len(remaining) == 0 {
+			break
+		}
+		if r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	return len(remaining) == 0
+}
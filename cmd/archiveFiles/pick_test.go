@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/catalog"
+)
+
+// createPickCatalog records two archived runs of different sources, a
+// newer one whose archive is gone and a run that was never compressed
+func createPickCatalog(t *testing.T, dir string) string {
+	t.Helper()
+	archivePath := createDrillArchive(t, dir, false)
+	day := time.Date(2024, 3, 15, 2, 0, 0, 0, time.UTC)
+
+	backupCatalog := &catalog.Catalog{}
+	backupCatalog.AddRun(catalog.Run{RunID: "run-1", Time: day, ArchivePath: archivePath,
+		Items: []catalog.ItemRecord{{SourceRoot: "/data", SourcePath: "/data/app.db", Size: 8192}}})
+	backupCatalog.AddRun(catalog.Run{RunID: "run-2", Time: day.Add(24 * time.Hour), ArchivePath: archivePath,
+		Items: []catalog.ItemRecord{{SourceRoot: "/srv/logs", SourcePath: "/srv/logs/app.log", Size: 100}}})
+	backupCatalog.AddRun(catalog.Run{RunID: "run-3", Time: day.Add(48 * time.Hour), ArchivePath: filepath.Join(dir, "gone.tar.gz")})
+	backupCatalog.AddRun(catalog.Run{RunID: "run-4", Time: day.Add(72 * time.Hour)})
+
+	catalogPath := filepath.Join(dir, "catalog.json")
+	if err := backupCatalog.Save(catalogPath); err != nil {
+		t.Fatal(err)
+	}
+	return catalogPath
+}
+
+func TestRunRestorePick_Query(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := createPickCatalog(t, dir)
+	target := filepath.Join(dir, "restored")
+
+	var stdout, stderr bytes.Buffer
+	code := runRestorePick([]string{"-pick", "-catalog", catalogPath, "-target", target}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "matches 2 archives") {
+		t.Fatalf("An ambiguous pick should fail, exit code %d, stderr: %s", code, stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = runRestorePick([]string{"-pick", "-catalog", catalogPath, "-target", target, "-query", "srv"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0; stderr: %s", code, stderr.String())
+	}
+	if strings.TrimSpace(stdout.String()) != target {
+		t.Errorf("stdout = %q, want the target directory", stdout.String())
+	}
+	if _, err := os.Stat(filepath.Join(target, "data", "app.db", "app.db")); err != nil {
+		t.Errorf("Restored database missing: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Verified 1 database(s)") {
+		t.Errorf("The restored databases should be verified, stderr: %s", stderr.String())
+	}
+}
+
+func TestRunRestorePick_Interactive(t *testing.T) {
+	dir := t.TempDir()
+	catalogPath := createPickCatalog(t, dir)
+	target := filepath.Join(dir, "restored")
+
+	// A search that finds nothing, one that finds the log run only, a number
+	// out of range, then the log run
+	asked := answerPrompts(t, "nothing-like-this\nlogs\n2\n1\n")
+	var stdout, stderr bytes.Buffer
+	code := runRestorePick([]string{"--pick", "-catalog", catalogPath, "-target", target}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0; stderr: %s", code, stderr.String())
+	}
+
+	prompts := asked.String()
+	newest := strings.Index(prompts, "/srv/logs")
+	if newest < 0 || newest > strings.Index(prompts, "/data") {
+		t.Errorf("Archives should be listed newest first:\n%s", prompts)
+	}
+	for _, want := range []string{"No matching archives", "No archive 2", "8.0 KB"} {
+		if !strings.Contains(prompts, want) {
+			t.Errorf("Prompts lack %q:\n%s", want, prompts)
+		}
+	}
+	if strings.Contains(prompts, "gone.tar.gz") {
+		t.Errorf("Archives missing on disk should not be offered:\n%s", prompts)
+	}
+
+	answerPrompts(t, "\n")
+	stderr.Reset()
+	if code := runRestorePick([]string{"-pick", "-catalog", catalogPath, "-target", filepath.Join(dir, "other")}, &stdout, &stderr); code != 1 {
+		t.Errorf("An empty answer should abort, exit code %d", code)
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		expected      bool
+	}{
+		{"dat0315", "2024-03-15 02:00  /data", false},
+		{"0315dat", "2024-03-15 02:00  /data", true},
+		{"DATA", "/data/app.db", true},
+		{"", "anything", true},
+		{"xyz", "/data", false},
+	}
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.pattern, tt.text); got != tt.expected {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.pattern, tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestPickRequested(t *testing.T) {
+	if !pickRequested([]string{"-target", "dir", "--pick"}) || !pickRequested([]string{"-pick=true"}) {
+		t.Error("-pick should be recognized anywhere in the arguments")
+	}
+	if pickRequested([]string{"-backup", "b", "-restore", "r"}) || pickRequested([]string{"-pick=false"}) {
+		t.Error("A BackupEngine restore should not be taken for -pick")
+	}
+}
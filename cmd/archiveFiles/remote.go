@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/config"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/utils"
+)
+
+// remoteAgentCommand is the hidden subcommand run on the remote host
+const remoteAgentCommand = "remote-agent"
+
+// remoteTarget is a parsed user@host:/path argument
+type remoteTarget struct {
+	Host string // SSH destination, e.g. user@host
+	Path string // Source path on the remote host
+}
+
+// parseRemoteTarget splits user@host:/path into destination and path
+func parseRemoteTarget(target string) (remoteTarget, error) {
+	host, path, ok := strings.Cut(target, ":")
+	if !ok || host == "" || path == "" {
+		return remoteTarget{}, fmt.Errorf("invalid remote target %q, expected user@host:/path", target)
+	}
+	if !filepath.IsAbs(path) {
+		return remoteTarget{}, fmt.Errorf("remote path must be absolute: %s", path)
+	}
+	return remoteTarget{Host: host, Path: path}, nil
+}
+
+// shellQuote quotes s for a POSIX shell, which is how ssh passes the
+// remote command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runRemoteBackup implements the remote-backup subcommand
+func runRemoteBackup(args []string) int {
+	remoteCmd := flag.NewFlagSet("remote-backup", flag.ContinueOnError)
+	archivePath := remoteCmd.String("archive", "", "Local archive file to write (default: <host>_<timestamp>.tar.gz)")
+	method := remoteCmd.String("method", constants.MethodCheckpoint, "Backup method used on the remote host")
+	agentPath := remoteCmd.String("agent", "archiveFiles", "archiveFiles binary on the remote host")
+	upload := remoteCmd.Bool("upload", false, "Upload this binary to the remote host for the run instead of using -agent")
+	sshCommand := remoteCmd.String("ssh", "ssh", "SSH command, including options (e.g. \"ssh -p 2222 -i key\")")
+	logLevel := remoteCmd.String("log-level", "warning", "Log level of the remote agent (debug, info, warning, error)")
+
+	// Accept the target before or after the flags
+	var target string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		target, args = args[0], args[1:]
+	}
+	if err := remoteCmd.Parse(args); err != nil {
+		fmt.Printf("Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if target == "" && remoteCmd.NArg() > 0 {
+		target = remoteCmd.Arg(0)
+	}
+	if target == "" {
+		fmt.Println("Usage: archiveFiles remote-backup user@host:/path [-archive=local.tar.gz] [-method=method] [-upload] [-agent=path] [-ssh=command]")
+		return 1
+	}
+
+	remote, err := parseRemoteTarget(target)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+	sshArgs := strings.Fields(*sshCommand)
+	if len(sshArgs) == 0 {
+		fmt.Println("-ssh must not be empty")
+		return 1
+	}
+
+	if *archivePath == "" {
+		host := remote.Host[strings.LastIndex(remote.Host, "@")+1:]
+		*archivePath = fmt.Sprintf("%s_%d.tar.gz", host, time.Now().Unix())
+	}
+
+	agent := *agentPath
+	if *upload {
+		if agent, err = uploadAgent(sshArgs, remote.Host); err != nil {
+			fmt.Printf("Failed to upload agent: %v\n", err)
+			return 1
+		}
+		defer removeRemoteFile(sshArgs, remote.Host, agent)
+	}
+
+	command := strings.Join([]string{
+		shellQuote(agent), remoteAgentCommand,
+		"-source=" + shellQuote(remote.Path),
+		"-method=" + shellQuote(*method),
+		"-log-level=" + shellQuote(*logLevel),
+	}, " ")
+
+	fmt.Fprintf(os.Stderr, "Backing up %s:%s to %s...\n", remote.Host, remote.Path, *archivePath)
+	footer, err := fetchRemoteArchive(sshArgs, remote.Host, command, *archivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Remote backup failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Archive OK: %s (%d entries, manifest sha256 %s)\n", *archivePath, footer.EntryCount, footer.ManifestSHA256)
+	return 0
+}
+
+// fetchRemoteArchive runs command on host and writes its stdout to
+// archivePath. The archive is checked against its footer before it is
+// renamed into place, so a dropped connection never leaves a truncated
+// archive under the final name.
+func fetchRemoteArchive(sshArgs []string, host, command, archivePath string) (*compress.Footer, error) {
+	tempPath := archivePath + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %v", err)
+	}
+	defer os.Remove(tempPath)
+
+	cmd := exec.Command(sshArgs[0], append(sshArgs[1:], host, command)...)
+	cmd.Stdout = file
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+	closeErr := file.Close()
+	if runErr != nil {
+		return nil, fmt.Errorf("remote agent failed: %v", runErr)
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("failed to write archive file: %v", closeErr)
+	}
+
+	footer, err := compress.VerifyArchive(tempPath)
+	if err != nil {
+		return nil, fmt.Errorf("received archive is incomplete: %v", err)
+	}
+	if err := os.Rename(tempPath, archivePath); err != nil {
+		return nil, fmt.Errorf("failed to rename archive into place: %v", err)
+	}
+	return footer, nil
+}
+
+// uploadAgent copies the running executable to a temporary file on host and
+// returns its remote path. The remote host must have the same OS and
+// architecture.
+func uploadAgent(sshArgs []string, host string) (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	binary, err := os.Open(self)
+	if err != nil {
+		return "", err
+	}
+	defer binary.Close()
+
+	var stdout bytes.Buffer
+	script := `tmp=$(mktemp) && cat > "$tmp" && chmod 700 "$tmp" && echo "$tmp"`
+	cmd := exec.Command(sshArgs[0], append(sshArgs[1:], host, script)...)
+	cmd.Stdin = binary
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	remotePath := strings.TrimSpace(stdout.String())
+	if remotePath == "" {
+		return "", fmt.Errorf("remote host did not report the upload path")
+	}
+	return remotePath, nil
+}
+
+// removeRemoteFile deletes an uploaded agent, logging rather than failing
+func removeRemoteFile(sshArgs []string, host, path string) {
+	cmd := exec.Command(sshArgs[0], append(sshArgs[1:], host, "rm -f "+shellQuote(path))...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logger.Warning("Failed to remove uploaded agent %s on %s: %v", path, host, err)
+	}
+}
+
+// runRemoteAgent implements the hidden remote-agent subcommand: it backs up
+// a local source into a temporary directory and streams the archive to out.
+// Everything else the run prints is sent to stderr so it cannot corrupt the
+// stream.
+func runRemoteAgent(args []string, out io.Writer) int {
+	agentCmd := flag.NewFlagSet(remoteAgentCommand, flag.ExitOnError)
+	agentCmd.SetOutput(os.Stderr)
+	source := agentCmd.String("source", "", "Source path to back up")
+	sources := agentCmd.String("sources", "", "Comma-separated source paths to back up, instead of -source")
+	method := agentCmd.String("method", constants.MethodCheckpoint, "Backup method")
+	logLevel := agentCmd.String("log-level", "warning", "Log level")
+	tmpDir := agentCmd.String("tmp-dir", "", "Directory the backup is written to before it is streamed (default: $TMPDIR or /tmp)")
+	if err := agentCmd.Parse(args); err != nil {
+		return 1
+	}
+
+	cfg := config.GetDefaultConfig()
+	cfg.SourcePaths = []string{*source}
+	if *sources != "" {
+		cfg.SourcePaths = strings.Split(*sources, ",")
+	}
+	cfg.Method = *method
+	cfg.LogLevel = *logLevel
+	cfg.TmpDir = *tmpDir
+	cfg.ColorLog = false
+	for _, sourcePath := range cfg.SourcePaths {
+		if info, err := os.Stat(sourcePath); err == nil && info.IsDir() {
+			cfg.BatchMode = true
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration validation failed: %v\n", err)
+		return 1
+	}
+
+	utils.SetTmpDir(cfg.TmpDir)
+	workDir, err := utils.MkdirTemp(constants.TmpPrefix + "agent-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create work directory: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(workDir)
+
+	// The archive is only read back once, so skip fsync
+	cfg.BackupPath = filepath.Join(workDir, "backup")
+	cfg.ArchivePath = filepath.Join(workDir, "backup.tar.gz")
+	cfg.Durability = constants.DurabilityNone
+	initLogger(cfg)
+
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Backup failed: %v\n", err)
+		return 1
+	}
+
+	archive, err := os.Open(result.ArchivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open archive: %v\n", err)
+		return 1
+	}
+	defer archive.Close()
+	if _, err := io.Copy(out, archive); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to stream archive: %v\n", err)
+		return 1
+	}
+	return 0
+}
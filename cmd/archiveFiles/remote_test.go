@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/compress"
+)
+
+func TestParseRemoteTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    remoteTarget
+		wantErr bool
+	}{
+		{"backup@db1:/data/db", remoteTarget{Host: "backup@db1", Path: "/data/db"}, false},
+		{"db1:/var/lib/app.db", remoteTarget{Host: "db1", Path: "/var/lib/app.db"}, false},
+		{"db1:relative/path", remoteTarget{}, true},
+		{"db1", remoteTarget{}, true},
+		{":/data", remoteTarget{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := parseRemoteTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRemoteTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseRemoteTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"/data/db", "it's here", "$(rm -rf /)", ""} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh failed for %q: %v", s, err)
+		}
+		if string(out) != s {
+			t.Errorf("shellQuote(%q) round-tripped to %q", s, out)
+		}
+	}
+}
+
+// fakeSSH writes a script that ignores the destination and runs the remote
+// command locally, like ssh would on the remote host
+func fakeSSH(t *testing.T) []string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "ssh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nshift\nexec sh -c \"$1\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake ssh: %v", err)
+	}
+	return []string{script}
+}
+
+func TestFetchRemoteArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	remoteArchive := filepath.Join(tempDir, "remote.tar.gz")
+	if err := compress.CompressDirectory(sourceDir, remoteArchive); err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+
+	t.Run("Complete stream", func(t *testing.T) {
+		localArchive := filepath.Join(tempDir, "local.tar.gz")
+		footer, err := fetchRemoteArchive(fakeSSH(t), "db1", "cat "+shellQuote(remoteArchive), localArchive)
+		if err != nil {
+			t.Fatalf("fetchRemoteArchive failed: %v", err)
+		}
+		if footer.EntryCount == 0 {
+			t.Error("Expected entries in the fetched archive")
+		}
+		if _, err := os.Stat(localArchive + ".tmp"); !os.IsNotExist(err) {
+			t.Error("Temporary archive should be removed")
+		}
+	})
+
+	t.Run("Truncated stream", func(t *testing.T) {
+		localArchive := filepath.Join(tempDir, "truncated.tar.gz")
+		command := "head -c 64 " + shellQuote(remoteArchive)
+		if _, err := fetchRemoteArchive(fakeSSH(t), "db1", command, localArchive); err == nil {
+			t.Fatal("Expected error for a truncated stream")
+		}
+		if _, err := os.Stat(localArchive); !os.IsNotExist(err) {
+			t.Error("Truncated archive should not be renamed into place")
+		}
+	})
+
+	t.Run("Agent failure", func(t *testing.T) {
+		localArchive := filepath.Join(tempDir, "failed.tar.gz")
+		if _, err := fetchRemoteArchive(fakeSSH(t), "db1", "exit 2", localArchive); err == nil {
+			t.Fatal("Expected error when the remote command fails")
+		}
+	})
+}
+
+func TestRunRemoteAgent(t *testing.T) {
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+
+	var stream bytes.Buffer
+	if code := runRemoteAgent([]string{"-source=" + sourceDir, "-log-level=error"}, &stream); code != 0 {
+		t.Fatalf("runRemoteAgent exit code = %d", code)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "streamed.tar.gz")
+	if err := os.WriteFile(archivePath, stream.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write streamed archive: %v", err)
+	}
+	if _, err := compress.VerifyArchive(archivePath); err != nil {
+		t.Errorf("Streamed archive failed verification: %v", err)
+	}
+}
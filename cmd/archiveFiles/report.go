@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/usage"
+)
+
+// Run report statuses
+const (
+	reportSucceeded = "succeeded"
+	reportFailed    = "failed"
+	reportAnomalous = "anomalous"
+	reportPartial   = "partial"
+)
+
+// runReport is the run summary written to the Kubernetes termination log,
+// or to stdout with -json
+type runReport struct {
+	Status          string              `json:"status"` // succeeded, failed, partial or anomalous
+	RunID           string              `json:"run_id,omitempty"`
+	BackupPath      string              `json:"backup_path,omitempty"`
+	ArchivePath     string              `json:"archive_path,omitempty"`
+	MirrorPath      string              `json:"mirror_path,omitempty"` // host:path of the mirrored backup
+	Items           int                 `json:"items"`
+	Failed          int                 `json:"failed"`
+	Skipped         int                 `json:"skipped"`
+	NotStarted      int                 `json:"not_started"` // Skipped items the time window left no room for
+	SizeAnomalies   int                 `json:"size_anomalies"`
+	Drift           int                 `json:"drift,omitempty"`         // Items added, removed or changed since the previous inventory
+	Warnings        int                 `json:"warnings"`                // Warnings across all items
+	ItemWarnings    map[string][]string `json:"item_warnings,omitempty"` // Item backup path -> its warnings
+	UnreadablePaths int                 `json:"unreadable_paths"`        // Paths discovery could not read
+	SkippedPaths    []string            `json:"skipped_paths,omitempty"` // The first of them; all are listed in the manifest
+	Error           string              `json:"error,omitempty"`
+	StartedAt       time.Time           `json:"started_at"`
+	FinishedAt      time.Time           `json:"finished_at"`
+	DurationSeconds float64             `json:"duration_seconds"`
+	Usage           *usage.Usage        `json:"usage,omitempty"` // CPU, storage I/O and memory of the run
+}
+
+// newRunReport summarizes a run started at started that just returned
+// result and err
+func newRunReport(result runResult, err error, started time.Time) runReport {
+	report := runReport{
+		Status:          reportSucceeded,
+		RunID:           result.RunID,
+		BackupPath:      result.BackupPath,
+		ArchivePath:     result.ArchivePath,
+		MirrorPath:      result.MirrorPath,
+		Items:           result.Items,
+		Failed:          result.Failed,
+		Skipped:         result.Skipped,
+		NotStarted:      result.NotStarted,
+		SizeAnomalies:   result.SizeAnomalies,
+		Drift:           result.Drift,
+		Warnings:        result.warningCount(),
+		ItemWarnings:    result.Warnings,
+		UnreadablePaths: len(result.SkippedPaths),
+		Usage:           result.Usage,
+		StartedAt:       started.UTC(),
+		FinishedAt:      time.Now().UTC(),
+	}
+	report.DurationSeconds = report.FinishedAt.Sub(report.StartedAt).Seconds()
+	for i, skipped := range result.SkippedPaths {
+		if i == constants.K8sReportSkippedPathsLimit {
+			break
+		}
+		report.SkippedPaths = append(report.SkippedPaths, skipped.Path)
+	}
+
+	switch {
+	case err != nil:
+		report.Status = reportFailed
+		report.Error = err.Error()
+	case result.NotStarted > 0:
+		report.Status = reportPartial
+	case result.SizeAnomalies > 0:
+		report.Status = reportAnomalous
+	}
+	return report
+}
+
+// printRunResult writes the outcome of a run to stdout, which is reserved for
+// results so it can be piped: the JSON report with -json, otherwise the path
+// of what the run produced. Progress and logs go to stderr.
+func printRunResult(w io.Writer, report runReport, jsonReport bool) error {
+	if jsonReport {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	if report.Status == reportFailed {
+		return nil
+	}
+	path := report.ArchivePath
+	if path == "" {
+		path = report.MirrorPath
+	}
+	if path == "" {
+		path = report.BackupPath
+	}
+	if path == "" {
+		return nil
+	}
+	_, err := fmt.Fprintln(w, path)
+	return err
+}
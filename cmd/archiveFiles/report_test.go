@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/types"
+)
+
+func TestNewRunReport(t *testing.T) {
+	started := time.Now().Add(-time.Second)
+	result := runResult{
+		RunID:         "abc123",
+		BackupPath:    "/backups/b",
+		ArchivePath:   "/backups/b.tar.gz",
+		Items:         2,
+		SizeAnomalies: 1,
+		SkippedPaths:  []types.SkippedPath{{Path: "/data/locked"}},
+	}
+
+	report := newRunReport(result, nil, started)
+	if report.Status != reportAnomalous {
+		t.Errorf("Expected status %q, got %q", reportAnomalous, report.Status)
+	}
+	if report.UnreadablePaths != 1 || len(report.SkippedPaths) != 1 {
+		t.Errorf("Expected one unreadable path, got %+v", report)
+	}
+	if report.DurationSeconds < 1 {
+		t.Errorf("Expected a duration of at least 1s, got %v", report.DurationSeconds)
+	}
+
+	report = newRunReport(result, errors.New("disk full"), started)
+	if report.Status != reportFailed || report.Error != "disk full" {
+		t.Errorf("Expected failed report with error, got %+v", report)
+	}
+
+	result.NotStarted = 3
+	report = newRunReport(result, nil, started)
+	if report.Status != reportPartial || report.NotStarted != 3 {
+		t.Errorf("Expected partial report with 3 items not started, got %+v", report)
+	}
+}
+
+func TestPrintRunResult(t *testing.T) {
+	report := runReport{Status: reportSucceeded, BackupPath: "/backups/b", ArchivePath: "/backups/b.tar.gz"}
+
+	var out bytes.Buffer
+	if err := printRunResult(&out, report, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "/backups/b.tar.gz\n" {
+		t.Errorf("Expected only the archive path on stdout, got %q", out.String())
+	}
+
+	out.Reset()
+	report.ArchivePath = ""
+	printRunResult(&out, report, false)
+	if out.String() != "/backups/b\n" {
+		t.Errorf("Expected the backup path without an archive, got %q", out.String())
+	}
+
+	out.Reset()
+	printRunResult(&out, runReport{Status: reportFailed, Error: "boom"}, false)
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing on stdout for a failed run, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := printRunResult(&out, report, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded runReport
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("JSON report is not valid JSON: %v", err)
+	}
+	if decoded.BackupPath != report.BackupPath {
+		t.Errorf("Expected backup path %q, got %q", report.BackupPath, decoded.BackupPath)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archiveFiles/internal/audit"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/restore"
+)
+
+// runRestoreArchive implements "restore-archive": it extracts an archive
+// into a directory, optionally swapping it in for a live directory
+func runRestoreArchive(args []string, stdout, stderr io.Writer) int {
+	restoreCmd := flag.NewFlagSet("restore-archive", flag.ContinueOnError)
+	archivePath := restoreCmd.String("archive", "", "Archive to restore")
+	mirrorTarget := restoreCmd.String("mirror", "", "Restore from a mirror instead of an archive: user@host:/path of a mirrored run, or of the mirror target for its latest run")
+	sshCommand := restoreCmd.String("ssh", "ssh", "SSH command used with -mirror, including options (e.g. \"ssh -p 2222 -i key\")")
+	parallel := restoreCmd.Int("parallel", constants.TransferParallel, "Number of files fetched at once from a -mirror, each over its own SSH connection")
+	targetDir := restoreCmd.String("target", "", "Directory to restore into")
+	swap := restoreCmd.Bool("swap", false, "Restore into <target>.new, verify it, then swap it in and keep the live directory as <target>.old")
+	rollback := restoreCmd.Bool("rollback", false, "Swap <target>.old back into place after a -swap restore")
+	items := restoreCmd.String("items", "", "Comma-separated backup paths of the items to restore from a per-item archive or a mirror, or of files inside an item split into volumes (default: all)")
+	yes := restoreCmd.Bool("yes", false, "Do not ask before -swap replaces the live directory or -rollback swaps it back")
+	strict := restoreCmd.Bool("strict", false, "Fail instead of warning when the backup needs newer SQLite/RocksDB versions than this host has")
+	configFile := restoreCmd.String("config", "", "JSON configuration file with the restore approval settings (default: search standard locations)")
+	token := restoreCmd.String("approval-token", os.Getenv(constants.ApprovalTokenEnv), "Approval token from approve-restore, needed for archives of protected namespaces (default: $"+constants.ApprovalTokenEnv+")")
+	env := restore.CurrentEnvironment()
+	restoreCmd.StringVar(&env.SQLiteVersion, "sqlite-version", env.SQLiteVersion, "SQLite version the application uses")
+	restoreCmd.StringVar(&env.RocksDBVersion, "rocksdb-version", "", "RocksDB version the application uses (default: not checked)")
+	if err := restoreCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+
+	source := *archivePath
+	if *mirrorTarget != "" {
+		source = *mirrorTarget
+	}
+	if *targetDir == "" || (source == "") != *rollback || (*archivePath != "" && *mirrorTarget != "") {
+		fmt.Fprintln(stderr, "Usage: archiveFiles restore-archive -archive=archive_path -target=directory [-swap] [-items=item,...] [-strict] [-rocksdb-version=X.Y.Z] [-approval-token=token] [-yes]")
+		fmt.Fprintln(stderr, "       archiveFiles restore-archive -mirror=user@host:/path -target=directory [-ssh=command] [-parallel=4] [-swap] [-items=item,...] ...")
+		fmt.Fprintln(stderr, "       archiveFiles restore-archive -rollback -target=directory [-yes]")
+		return 1
+	}
+	if err := validateParallel(*parallel); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+
+	var itemPaths []string
+	for _, item := range strings.Split(*items, ",") {
+		if item = strings.Trim(strings.TrimSpace(item), "/"); item != "" {
+			itemPaths = append(itemPaths, item)
+		}
+	}
+	if *swap && len(itemPaths) > 0 {
+		fmt.Fprintln(stderr, "Error: -items cannot be combined with -swap")
+		return 1
+	}
+
+	guard, err := loadRestoreGuard(*configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	var mirrored *mirrorSource
+	if *mirrorTarget != "" {
+		if mirrored, err = openMirror(strings.Fields(*sshCommand), *mirrorTarget); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		source = mirrored.name()
+	}
+	var attempt audit.Record
+	if mirrored != nil {
+		if attempt, err = guard.authorizeSource(source, *targetDir, *token, mirrored.namespace, stderr); err != nil {
+			fmt.Fprintf(stderr, "Restore denied: %v\n", err)
+			printHint(stderr, err)
+			return 1
+		}
+	} else if !*rollback {
+		if attempt, err = guard.authorize(*archivePath, *targetDir, *token, stderr); err != nil {
+			fmt.Fprintf(stderr, "Restore denied: %v\n", err)
+			printHint(stderr, err)
+			return 1
+		}
+	}
+
+	if (*swap || *rollback) && !confirmSwap(*targetDir, *archivePath, *rollback, *yes, stderr) {
+		return 1
+	}
+
+	if *rollback {
+		if err := restore.RollbackSwap(*targetDir); err != nil {
+			fmt.Fprintf(stderr, "Rollback failed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stderr, "Rolled back %s\n", *targetDir)
+		fmt.Fprintln(stdout, *targetDir)
+		return 0
+	}
+
+	check := compatibilityCheck(env, *strict, stderr)
+	fmt.Fprintf(stderr, "Restoring %s to %s...\n", source, *targetDir)
+	var oldDir string
+	switch {
+	case mirrored != nil && *swap:
+		oldDir, err = restore.SwapRestoreExtracted(*targetDir, mirrored.extractor(nil, *parallel, stderr), check)
+	case mirrored != nil:
+		err = restore.RestoreExtracted(*targetDir, mirrored.extractor(itemPaths, *parallel, stderr), check)
+	case *swap:
+		oldDir, err = restore.SwapRestoreArchive(*archivePath, *targetDir, check)
+	default:
+		err = restore.RestoreItems(*archivePath, *targetDir, itemPaths, check)
+	}
+	guard.finish(attempt, err, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+	if oldDir != "" {
+		fmt.Fprintf(stderr, "Previous directory kept at %s; undo with -rollback\n", oldDir)
+	}
+	fmt.Fprintln(stdout, *targetDir)
+	return 0
+}
+
+// confirmSwap checks that a swap restore or rollback may replace targetDir:
+// it must not be the root, the home directory or hold the archive being
+// restored, and the user is asked on a terminal
+func confirmSwap(targetDir, archivePath string, rollback, yes bool, stderr io.Writer) bool {
+	var sources []string
+	if archivePath != "" {
+		sources = append(sources, archivePath)
+	}
+	if err := refuseSourceLike(targetDir, sources); err != nil {
+		fmt.Fprintf(stderr, "Restore failed: %v\n", err)
+		return false
+	}
+
+	// Restoring into a new directory replaces nothing
+	if _, err := os.Stat(targetDir); os.IsNotExist(err) && !rollback {
+		return true
+	}
+	question := fmt.Sprintf("Replace %s with the restored archive, keeping it as %s?", targetDir, targetDir+constants.SwapOldSuffix)
+	if rollback {
+		question = fmt.Sprintf("Swap %s back into place, keeping the current %s as the rollback copy?", targetDir+constants.SwapOldSuffix, targetDir)
+	}
+	if !confirm(question, yes) {
+		fmt.Fprintln(stderr, "Restore aborted")
+		return false
+	}
+	return true
+}
+
+// compatibilityCheck warns about backups needing newer libraries than env,
+// or rejects them when strict is set. Archives without a manifest are not
+// checked.
+func compatibilityCheck(env restore.Environment, strict bool, stderr io.Writer) restore.CheckFunc {
+	return func(dir string) error {
+		manifestPath := filepath.Join(dir, manifest.FileName)
+		if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+			return nil
+		}
+		m, err := manifest.Load(manifestPath)
+		if err != nil {
+			return err
+		}
+
+		problems := restore.CheckCompatibility(m, env)
+		for _, problem := range problems {
+			fmt.Fprintf(stderr, "Warning: %s\n", problem)
+		}
+		if strict && len(problems) > 0 {
+			return fmt.Errorf("backup needs newer database libraries than this host has (%d problem(s))", len(problems))
+		}
+		return nil
+	}
+}
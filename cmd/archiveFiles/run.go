@@ -0,0 +1,807 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/backup"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/docker"
+	"archiveFiles/internal/hostinfo"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/sqlitedb"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/usage"
+	"archiveFiles/internal/utils"
+)
+
+// runResult summarizes one archival run
+type runResult struct {
+	RunID         string // Identifies the run in directory names and the manifest
+	BackupPath    string
+	ArchivePath   string // Empty when the backup was not compressed
+	MirrorPath    string // host:path the backup was mirrored to; empty without output mirror
+	SizeAnomalies int    // Items much smaller than their trailing average
+	NotStarted    int    // Items left out because the time window closed; the run is partial
+	Items         int    // Items archived successfully
+	Failed        int    // Items that failed
+	Skipped       int    // Items left out on purpose (e.g. by the corruption policy)
+	Drift         int    // Items added, removed or changed since the previous inventory; inventory runs only
+
+	SkippedPaths []types.SkippedPath // Paths discovery could not read
+	Warnings     map[string][]string // Item backup path -> problems it was archived despite
+	Usage        *usage.Usage        // Resources the run consumed; nil where they cannot be measured
+}
+
+// warningCount returns the number of warnings across all items
+func (r runResult) warningCount() int {
+	count := 0
+	for _, warnings := range r.Warnings {
+		count += len(warnings)
+	}
+	return count
+}
+
+// runArchive performs one complete archival run: discovery, backup,
+// manifest, catalog, compression and signing. runID identifies the run in
+// every log line and record it produces. status may be nil.
+func runArchive(ctx context.Context, cfg *types.Config, runID string, signingKey ed25519.PrivateKey, status *runStatus) (runResult, error) {
+	before, usageErr := usage.Read()
+	result, err := archiveRun(ctx, cfg, runID, signingKey, status)
+	if usageErr == nil {
+		if after, err := usage.Read(); err == nil {
+			runUsage := after.Since(before)
+			result.Usage = &runUsage
+			logger.Info("Run %s resource usage: %s", runID, runUsage)
+		}
+	}
+	return result, err
+}
+
+// archiveRun is runArchive without the resource accounting
+func archiveRun(ctx context.Context, cfg *types.Config, runID string, signingKey ed25519.PrivateKey, status *runStatus) (runResult, error) {
+	result := runResult{RunID: runID}
+	started := time.Now()
+
+	logger.SetPrefix("run=" + runID)
+	defer logger.SetPrefix("")
+	utils.SetDropPageCache(cfg.DropPageCache)
+	utils.SetPreread(cfg.Preread)
+	utils.ResetCopyChecksums()
+	utils.SetSmallReadahead(cfg.Nice)
+	utils.SetTmpDir(cfg.TmpDir)
+	backup.SetRocksDBReadahead(0)
+	if cfg.Nice {
+		// A process cannot raise its priority again, so this outlasts the run
+		if err := utils.LowerPriority(); err != nil {
+			logger.Warning("-nice: %v", err)
+		}
+		backup.SetRocksDBReadahead(constants.NiceRocksDBReadahead)
+	}
+	sqlitedb.SetMaxConnections(cfg.SQLiteMaxConnections)
+	backup.SetRocksDBBackupRate(int64(cfg.RocksDBBackupRateMBps) * 1024 * 1024)
+	backup.SetRocksDBExclusions(rocksDBExclusions(cfg))
+
+	// Each run samples differently unless a seed is given to reproduce one
+	if cfg.VerifySample != "" && cfg.VerifySeed == 0 {
+		runCfg := *cfg
+		runCfg.VerifySeed = time.Now().UnixNano()
+		cfg = &runCfg
+	}
+
+	// Log operational mode
+	if cfg.DryRun {
+		logger.Warning("DRY RUN MODE: No actual changes will be made")
+	}
+
+	// xz and bzip2 archives are written by external tools; a missing one
+	// should stop the run before the backup, not after it
+	if cfg.Compress && compress.IsCompatFormat(cfg.CompressionFormat) {
+		logger.Warning("%s compression is much slower than gzip; use it only for consumers that cannot read tar.gz", cfg.CompressionFormat)
+		if err := compress.CheckCompression(cfg.CompressionFormat); err != nil && !cfg.DryRun {
+			return result, err
+		}
+	}
+
+	// Secondary instances and the like fail halfway through a run when the
+	// temporary directory is full, so it is checked up front
+	if !cfg.DryRun {
+		for _, stale := range utils.RemoveStaleTemp(utils.TmpDir(), constants.TmpStaleHours*time.Hour) {
+			logger.Info("Removed stale temporary directory %s", stale)
+		}
+		if err := utils.CheckTmpDir(utils.TmpDir(), constants.TmpMinFree); err != nil {
+			return result, err
+		}
+	}
+
+	logger.Info("Starting database archival process...")
+	logger.Info("Sources: %v", cfg.SourcePaths)
+	logger.Info("Method: %s", cfg.Method)
+	logger.Debug("Batch mode: %t", cfg.BatchMode)
+
+	// Auto-determine progress bar: disable for error log level, enable otherwise
+	showProgress := cfg.ShowProgress()
+
+	// Create progress tracker
+	progressTracker := progress.NewProgressTracker(showProgress)
+	if cfg.ProgressInterval != "" {
+		// Validated with the rest of the configuration
+		interval, _ := time.ParseDuration(cfg.ProgressInterval)
+		progressTracker.SetInterval(interval)
+	}
+
+	// A run may only start inside its time window, and starts no new items
+	// once it closes
+	var windowClosed <-chan struct{}
+	if cfg.Window != "" && !cfg.DryRun {
+		// Validated with the rest of the configuration
+		window, _ := types.ParseTimeWindow(cfg.Window)
+		deadline, inside := window.Deadline(time.Now())
+		if !inside {
+			return result, fmt.Errorf("the backup window %s is closed", window)
+		}
+		logger.Info("Backup window %s closes at %s", window, deadline.Format("15:04"))
+		windowCtx, cancelWindow := context.WithDeadline(context.Background(), deadline)
+		defer cancelWindow()
+		windowClosed = windowCtx.Done()
+	}
+
+	// Snapshot the source volumes so databases are copied at one point in
+	// time while applications keep writing
+	var snapshots *sourceSnapshots
+	if cfg.Snapshot != "" && !cfg.DryRun {
+		var err error
+		if snapshots, err = takeSnapshots(ctx, cfg.SourcePaths); err != nil {
+			return result, err
+		}
+		defer snapshots.release()
+	}
+
+	// The run ID keeps runs started in the same second (e.g. two cron jobs)
+	// from sharing a backup directory
+	backupPath := utils.ReplaceDateVars(cfg.BackupPath)
+	if backupPath == "" {
+		backupPath = fmt.Sprintf(constants.DefaultBackupPathFormat+"_%s", time.Now().Unix(), runID)
+	}
+
+	// A destination inside a source would be archived into itself, growing
+	// with every run
+	if excludes := destinationExcludes(cfg, backupPath, runID); len(excludes) > 0 {
+		logger.Info("Leaving destination(s) inside sources out of discovery: %v", excludes)
+		runCfg := *cfg
+		runCfg.ExcludePaths = append(append([]string{}, cfg.ExcludePaths...), excludes...)
+		cfg = &runCfg
+	}
+
+	// Discover databases from all source directories
+	status.setPhase(phaseDiscovering)
+	discovered, err := discoverSources(ctx, cfg, snapshots)
+	if err != nil {
+		return result, err
+	}
+	allDatabases := discovered.Databases
+	result.SkippedPaths = discovered.SkippedPaths
+	if len(discovered.SkippedPaths) > 0 {
+		logger.Warning("%d unreadable path(s) skipped during discovery", len(discovered.SkippedPaths))
+	}
+
+	if len(allDatabases) == 0 {
+		return result, fmt.Errorf("no databases or files found to archive")
+	}
+	checkConsistencyGroups(cfg.ConsistencyGroups, allDatabases)
+
+	logger.Info("Found %d item(s) to archive:", len(allDatabases))
+	var totalSize int64
+	highPriority := 0
+	for _, db := range allDatabases {
+		logger.Info("  - %s (%s) from %s [%s]", db.Name, db.Type.String(), db.SourceRoot, utils.FormatBytes(db.Size))
+		totalSize += db.Size
+		if db.Priority == constants.PriorityHigh {
+			highPriority++
+		}
+	}
+	if highPriority > 0 {
+		logger.Info("%d high-priority item(s) will be backed up first", highPriority)
+	}
+	if err := checkGuardrails(cfg, len(allDatabases), totalSize); err != nil {
+		if !cfg.DryRun {
+			return result, err
+		}
+		logger.Warning("[DRY RUN] %v", err)
+	}
+
+	// Capture host metadata while the sources (and any snapshots) are mounted
+	var hostInfo *hostinfo.HostInfo
+	if cfg.HostInfo && !cfg.DryRun {
+		sources := make(map[string]string)
+		for _, db := range allDatabases {
+			if _, ok := sources[db.SourceRoot]; !ok {
+				sources[db.SourceRoot] = db.Path
+			}
+		}
+		hostInfo = hostinfo.Capture(sources)
+	}
+
+	// Initialize progress tracking
+	progressTracker.Init(len(allDatabases), totalSize)
+	defer progressTracker.Stop()
+
+	// Create backup directory
+	if cfg.DryRun {
+		logger.Info("[DRY RUN] Would create backup directory: %s", backupPath)
+		// The plan is the result of a dry run, unless stdout carries the JSON report
+		planOut := os.Stdout
+		if cfg.JSONReport {
+			planOut = os.Stderr
+		}
+		printDryRunPlan(planOut, cfg, backupPath, allDatabases)
+	} else {
+		// Only one run at a time may write to a destination
+		if !cfg.AllowConcurrent {
+			runLock, err := utils.AcquireRunLock(filepath.Dir(backupPath), runID)
+			if err != nil {
+				if errors.Is(err, utils.ErrRunLocked) {
+					return result, fmt.Errorf("%v; use -allow-concurrent to run anyway", err)
+				}
+				return result, err
+			}
+			defer runLock.Release()
+		}
+
+		var err error
+		if backupPath, err = createBackupDir(backupPath, runID); err != nil {
+			return result, err
+		}
+	}
+
+	// An inventory lists the items and stops before copying anything
+	if cfg.InventoryOnly && !cfg.DryRun {
+		return inventoryRun(ctx, cfg, runID, backupPath, discovered, progressTracker, started, result)
+	}
+
+	// Auto-determine number of workers based on CPU cores
+	workers := runtime.NumCPU()
+
+	// Cap workers at reasonable maximum
+	if workers > len(allDatabases) {
+		workers = len(allDatabases)
+	}
+
+	if workers > 1 {
+		logger.Info("Using %d concurrent workers for backup", workers)
+	}
+
+	// Process databases with worker pool
+	status.setPhase(phaseBackingUp)
+	status.setProgress(progressTracker)
+	status.setItems(allDatabases)
+	backupManifest := manifest.New(cfg.Method)
+	backupManifest.RunID = runID
+	backupManifest.Namespace = cfg.Namespace
+	backupManifest.SkippedPaths = discovered.SkippedPaths
+	backupManifest.SQLiteVersion = backup.SQLiteLibraryVersion()
+	if cfg.VerifySample != "" {
+		backupManifest.VerifySample = cfg.VerifySample
+		backupManifest.VerifySeed = cfg.VerifySeed
+		logger.Info("Sampled verification of %s using seed %d", cfg.VerifySample, cfg.VerifySeed)
+	}
+
+	// Pause containers only for the copy itself, not for compression: they
+	// are unpaused as soon as the copy is done
+	unpause := func() {}
+	if len(discovered.PauseContainers) > 0 && !cfg.DryRun {
+		var err error
+		if unpause, err = pauseContainers(ctx, discovered.DockerClient, discovered.PauseContainers); err != nil {
+			return result, err
+		}
+		// Unpausing twice is harmless; this covers a panic during the copy
+		defer unpause()
+	}
+	// Per-item archives are compressed while the remaining items are
+	// still being copied
+	perItem := cfg.Compress && cfg.ArchiveLayout == constants.ArchiveLayoutPerItem
+	archivePath := archivePathFor(cfg, backupPath)
+	var pipeline *compress.Pipeline
+	var itemDone func(manifest.Item)
+	if perItem && !cfg.DryRun {
+		pipeline = compress.NewPipeline(backupPath, archivePath, runtime.NumCPU(), compressOptions(cfg))
+		defer pipeline.Wait()
+		itemDone = func(item manifest.Item) {
+			pipeline.Add(filepath.ToSlash(item.BackupPath))
+		}
+	}
+	result.NotStarted = processDatabasesConcurrently(ctx, allDatabases, backupPath, cfg, progressTracker, workers, backupManifest, windowClosed, itemDone, status)
+	if result.NotStarted > 0 {
+		logger.Warning("Backup window %s closed: %d item(s) were not started; archiving the partial backup", cfg.Window, result.NotStarted)
+	}
+	unpause()
+	if snapshots != nil {
+		snapshots.release()
+	}
+
+	// Check if context was cancelled
+	if ctx.Err() != nil {
+		logger.Warning("Backup was cancelled: %v", ctx.Err())
+		logger.Warning("Partial backup may exist at: %s", backupPath)
+		return result, ctx.Err()
+	}
+
+	for _, item := range backupManifest.Items {
+		switch item.Status {
+		case manifest.StatusOK:
+			result.Items++
+		case manifest.StatusFailed:
+			result.Failed++
+		case manifest.StatusSkipped:
+			result.Skipped++
+		}
+		if len(item.Warnings) > 0 {
+			if result.Warnings == nil {
+				result.Warnings = make(map[string][]string)
+			}
+			result.Warnings[item.BackupPath] = item.Warnings
+		}
+	}
+
+	// Finish progress tracking
+	if showProgress {
+		progressTracker.Finish()
+	}
+
+	// Record what the backup contains, including data copied from outside
+	// the database directories (such as RocksDB wal_dir)
+	status.setPhase(phaseFinalizing)
+	if !cfg.DryRun {
+		if hostInfo != nil {
+			if err := hostInfo.Write(filepath.Join(backupPath, hostinfo.FileName)); err != nil {
+				logger.Warning("Failed to record host metadata: %v", err)
+			}
+		}
+
+		// Record which volume holds which file before the manifest goes
+		// into the root member
+		if perItem {
+			if err := recordVolumes(backupPath, backupManifest, compressOptions(cfg).VolumeSize); err != nil {
+				return result, err
+			}
+		}
+
+		manifestPath := filepath.Join(backupPath, manifest.FileName)
+		if err := backupManifest.Write(manifestPath); err != nil {
+			return result, fmt.Errorf("failed to write backup manifest: %v", err)
+		}
+		if cfg.Durability != constants.DurabilityNone {
+			if err := utils.SyncFile(manifestPath); err != nil {
+				return result, fmt.Errorf("failed to sync backup manifest: %v", err)
+			}
+		}
+
+		// With the manifest in place the backup is complete, not an orphan
+		if err := utils.RemoveRunMarker(backupPath); err != nil {
+			logger.Warning("%v", err)
+		}
+	}
+
+	// Compare item sizes with earlier runs to catch silent data loss
+	if cfg.CatalogPath != "" && !cfg.DryRun {
+		var err error
+		result.SizeAnomalies, err = updateCatalog(cfg, backupPath, backupManifest, started)
+		if err != nil {
+			logger.Warning("Failed to update backup catalog: %v", err)
+		}
+	}
+
+	logger.Info("Backup created successfully at: %s", backupPath)
+	result.BackupPath = backupPath
+
+	// Mirror the backup tree instead of archiving it
+	if cfg.Output == constants.OutputMirror {
+		if cfg.DryRun {
+			logger.Info("[DRY RUN] Would mirror backup to: %s", cfg.MirrorTarget)
+		} else {
+			status.setPhase(phaseMirroring)
+			mirrorPath, err := mirrorRun(cfg, backupPath, runID)
+			if err != nil {
+				return result, fmt.Errorf("failed to mirror backup: %v", err)
+			}
+			result.MirrorPath = mirrorPath
+			removeBackupDir(cfg, backupPath, "mirrored")
+		}
+	}
+
+	// Compress backup if requested
+	if cfg.Compress {
+		if cfg.DryRun {
+			logger.Info("[DRY RUN] Would create compressed archive: %s", archivePath)
+			if !cfg.KeepBackup {
+				logger.Info("[DRY RUN] Would remove backup directory: %s", backupPath)
+			}
+		} else {
+			status.setPhase(phaseCompressing)
+			if showProgress {
+				logger.Info("Creating compressed archive...")
+			}
+
+			var err error
+			if pipeline != nil {
+				_, err = pipeline.Finish(archiveItems(backupPath, backupManifest))
+			} else {
+				err = compress.CompressDirectoryWithOptions(backupPath, archivePath, compressOptions(cfg))
+			}
+			if err != nil {
+				return result, fmt.Errorf("failed to compress backup: %v", err)
+			}
+
+			logger.Info("Archive created successfully at: %s", archivePath)
+			result.ArchivePath = archivePath
+
+			if signingKey != nil {
+				signaturePath, err := compress.SignArchive(archivePath, signingKey)
+				if err != nil {
+					return result, fmt.Errorf("failed to sign archive: %v", err)
+				}
+				logger.Info("Archive signature written to: %s", signaturePath)
+			}
+
+			// Let restore drills find the archive through the catalog
+			if cfg.CatalogPath != "" {
+				if err := recordArchive(cfg.CatalogPath, runID, archivePath); err != nil {
+					logger.Warning("Failed to record archive in backup catalog: %v", err)
+				}
+			}
+
+			// Auto-remove original backup directory after compression
+			removeBackupDir(cfg, backupPath, "archived")
+		}
+	}
+
+	if warnings := result.warningCount(); warnings > 0 {
+		logger.Warning("%d warning(s) in %d item(s); they are listed in the manifest and the run report", warnings, len(result.Warnings))
+		if cfg.WarningsAsErrors {
+			return result, fmt.Errorf("%d warning(s) with -warnings-as-errors", warnings)
+		}
+	}
+
+	logger.Info("Archival process completed successfully!")
+
+	if result.SizeAnomalies > 0 {
+		logger.Warning("%d item(s) are much smaller than in earlier backups", result.SizeAnomalies)
+	}
+	return result, nil
+}
+
+// removeBackupDir removes the backup directory once it is stored elsewhere,
+// unless the config keeps it or the directory looks like a source
+func removeBackupDir(cfg *types.Config, backupPath, storedAs string) {
+	if cfg.KeepBackup {
+		logger.Info("Backup directory kept: %s", backupPath)
+	} else if err := refuseSourceLike(backupPath, cfg.SourcePaths); err != nil {
+		logger.Warning("Backup directory kept: %v", err)
+	} else if !confirm(fmt.Sprintf("Remove backup directory %s now that it is %s?", backupPath, storedAs), cfg.Yes) {
+		logger.Info("Backup directory kept: %s", backupPath)
+	} else if err := os.RemoveAll(backupPath); err != nil {
+		logger.Warning("Failed to remove backup directory: %v", err)
+	} else {
+		logger.Info("Backup directory removed: %s", backupPath)
+	}
+}
+
+// archivePathFor returns where the archive of the backup at backupPath goes
+func archivePathFor(cfg *types.Config, backupPath string) string {
+	switch {
+	case cfg.ArchivePath != "":
+		return utils.ReplaceDateVars(cfg.ArchivePath)
+	case cfg.ArchiveLayout == constants.ArchiveLayoutPerItem:
+		return utils.ReplaceDateVars(backupPath + ".archive")
+	default:
+		return utils.ReplaceDateVars(backupPath + compress.ArchiveExtension(cfg.CompressionFormat))
+	}
+}
+
+// destinationExcludes returns the paths the run writes to that lie inside
+// one of its sources: the backup directory, the name it falls back to when
+// taken, and the archive with its signature. The backups and archives of
+// earlier runs next to them are recognised by name and excluded too;
+// anything else in the destination's directory may be live data and is
+// still discovered.
+func destinationExcludes(cfg *types.Config, backupPath, runID string) []string {
+	archivePath := archivePathFor(cfg, backupPath)
+	destinations := []string{backupPath, backupPath + "_" + runID, archivePath, archivePath + compress.SignatureSuffix}
+
+	var excludes []string
+	seen := make(map[string]bool)
+	exclude := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			excludes = append(excludes, path)
+		}
+	}
+	dirs := make(map[string]bool)
+	for _, destination := range destinations {
+		for _, sourcePath := range cfg.SourcePaths {
+			if strings.HasPrefix(sourcePath, constants.DockerVolumeScheme) || !utils.IsWithin(destination, sourcePath) {
+				continue
+			}
+			exclude(destination)
+			dirs[filepath.Dir(destination)] = true
+			break
+		}
+	}
+
+	earlierRun := earlierRunPattern(cfg)
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if earlierRun.MatchString(entry.Name()) {
+				exclude(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return excludes
+}
+
+// earlierRunPattern matches the names of the backup directories and
+// archives runs of cfg write: the backup path's name, with any date
+// variable standing for a timestamp, optionally followed by the run ID
+// appended when the name was taken, an archive extension and the
+// signature or temporary suffix. A configured archive path is matched the
+// same way.
+func earlierRunPattern(cfg *types.Config) *regexp.Regexp {
+	namePattern := func(template string) string {
+		var parts []string
+		for _, part := range utils.DateVar.Split(filepath.Base(template), -1) {
+			parts = append(parts, regexp.QuoteMeta(part))
+		}
+		return strings.Join(parts, `\d{8}_\d{6}`)
+	}
+	backupName := `backup_\d+`
+	if cfg.BackupPath != "" {
+		backupName = namePattern(cfg.BackupPath)
+	}
+	var extensions []string
+	for _, format := range []string{constants.CompressionGzip, constants.CompressionXz, constants.CompressionBzip2, constants.CompressionNone} {
+		extensions = append(extensions, regexp.QuoteMeta(compress.ArchiveExtension(format)))
+	}
+	extensions = append(extensions, regexp.QuoteMeta(".archive"))
+	suffixes := regexp.QuoteMeta(compress.SignatureSuffix) + "|" + regexp.QuoteMeta(constants.TempArchiveSuffix)
+
+	pattern := fmt.Sprintf(`^%s(_[0-9a-f]{8})?(%s)?(%s)?$`, backupName, strings.Join(extensions, "|"), suffixes)
+	if cfg.ArchivePath != "" {
+		pattern += fmt.Sprintf(`|^%s(%s)?$`, namePattern(cfg.ArchivePath), suffixes)
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// compressOptions returns the archive options for cfg
+func compressOptions(cfg *types.Config) compress.Options {
+	opts := compress.Options{
+		Compression:  cfg.CompressionFormat,
+		Level:        cfg.CompressionLevel,
+		Durability:   cfg.Durability,
+		Reproducible: cfg.Reproducible,
+		VerifyRename: cfg.NetworkFS,
+
+		StoreIncompressible: cfg.StoreIncompressible,
+		EntryChecksums:      cfg.EntryChecksums,
+	}
+	if cfg.VolumeSize != "" {
+		// Validated with the rest of the configuration
+		opts.VolumeSize, _ = types.ParseSize(cfg.VolumeSize)
+	}
+	if cfg.Reproducible {
+		opts.ModTime = sourceDateEpoch()
+	}
+	if len(cfg.SourceCompressionLevels) > 0 {
+		opts.Levels = make(map[string]int)
+		for sourcePath, level := range cfg.SourceCompressionLevels {
+			opts.Levels[sourceBackupDir(cfg.Namespace, sourcePath)] = level
+		}
+	}
+	return opts
+}
+
+// archiveItems lists the backup paths of the items that get a member of
+// their own in a per-item archive. Items missing from the backup directory,
+// such as failed ones, are left out.
+func archiveItems(backupPath string, m *manifest.Manifest) []string {
+	seen := make(map[string]bool)
+	var items []string
+	for _, item := range m.Items {
+		if item.BackupPath == "" || seen[item.BackupPath] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(backupPath, item.BackupPath)); err != nil {
+			continue
+		}
+		seen[item.BackupPath] = true
+		items = append(items, filepath.ToSlash(item.BackupPath))
+	}
+	return items
+}
+
+// recordVolumes stores in m the volumes of a per-item archive that each item
+// larger than volumeSize is split across. The pipeline plans the same
+// volumes from the same finished items.
+func recordVolumes(backupPath string, m *manifest.Manifest, volumeSize int64) error {
+	if volumeSize <= 0 {
+		return nil
+	}
+	planned := make(map[string][]manifest.Volume)
+	for _, item := range archiveItems(backupPath, m) {
+		volumes, err := compress.PlanVolumes(backupPath, item, volumeSize)
+		if err != nil {
+			return err
+		}
+		if len(volumes) < 2 {
+			continue
+		}
+		for i, files := range volumes {
+			planned[item] = append(planned[item], manifest.Volume{File: compress.VolumeFile(item, i+1), Files: files})
+		}
+	}
+	for i := range m.Items {
+		m.Items[i].Volumes = planned[filepath.ToSlash(m.Items[i].BackupPath)]
+	}
+	return nil
+}
+
+// checkGuardrails refuses a run whose discovery found more items or data
+// than the configured limits, e.g. after an accidental -source=/, unless
+// -yes confirms it
+func checkGuardrails(cfg *types.Config, items int, totalSize int64) error {
+	var exceeded []string
+	if cfg.MaxItems > 0 && items > cfg.MaxItems {
+		exceeded = append(exceeded, fmt.Sprintf("%d items (-max-items %d)", items, cfg.MaxItems))
+	}
+	if cfg.MaxTotalSize != "" {
+		// Validated with the rest of the configuration
+		limit, _ := types.ParseSize(cfg.MaxTotalSize)
+		if totalSize > limit {
+			exceeded = append(exceeded, fmt.Sprintf("%s (-max-total-size %s)", utils.FormatBytes(totalSize), cfg.MaxTotalSize))
+		}
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+
+	message := "discovery found " + strings.Join(exceeded, " and ")
+	if cfg.Yes {
+		logger.Warning("%s; proceeding because of -yes", message)
+		return nil
+	}
+	return fmt.Errorf("%s; check the sources, raise the limits or pass -yes to archive anyway", message)
+}
+
+// discoveredSources is the result of scanning all configured sources
+type discoveredSources struct {
+	Databases       []types.DatabaseInfo
+	SkippedPaths    []types.SkippedPath // Paths left out because they could not be read
+	PauseContainers []string            // Containers to pause while their volumes are copied
+	DockerClient    *docker.Client      // Set when a docker-volume:// source was resolved
+}
+
+// discoverSources scans every source path, resolving docker-volume://
+// sources first. With snapshots, each source is scanned inside the snapshot
+// of its volume. Sources that cannot be scanned are logged and skipped,
+// except that discovery failing under the fail access error policy stops
+// the run with its error.
+func discoverSources(ctx context.Context, cfg *types.Config, snapshots *sourceSnapshots) (discoveredSources, error) {
+	var discovered discoveredSources
+	for _, sourcePath := range cfg.SourcePaths {
+		logger.Info("Scanning source: %s", sourcePath)
+
+		source, err := resolveSource(ctx, &discovered.DockerClient, sourcePath)
+		if err != nil {
+			logger.Warning("Failed to resolve source %s: %v", sourcePath, err)
+			continue
+		}
+		if snapshots != nil {
+			if source.ScanPath, err = snapshots.path(sourcePath); err != nil {
+				logger.Warning("Failed to resolve source %s in snapshot: %v", sourcePath, err)
+				continue
+			}
+			logger.Info("Scanning %s from snapshot at %s", sourcePath, source.ScanPath)
+		}
+
+		// Create a temporary config for each source
+		sourceConfig := &types.Config{
+			SourcePaths:    []string{source.ScanPath},
+			BatchMode:      cfg.BatchMode,
+			MaxDepth:       cfg.MaxDepth,
+			OneFileSystem:  cfg.OneFileSystem,
+			DetectionRules: cfg.DetectionRules,
+			LogDetection:   cfg.LogDetection,
+			IncludePattern: cfg.IncludePattern,
+			ExcludePattern: cfg.ExcludePattern,
+			ExcludePaths:   rebaseExcludes(cfg.ExcludePaths, sourcePath, source.ScanPath),
+			OnAccessError:  cfg.OnAccessError,
+
+			SQLiteAttachments: cfg.SQLiteAttachments,
+		}
+
+		databases, skipped, err := discovery.DiscoverDatabasesWithSkipped(sourceConfig, source.ScanPath)
+		discovered.SkippedPaths = append(discovered.SkippedPaths, skipped...)
+		if err != nil {
+			if cfg.OnAccessError == constants.OnAccessErrorFail {
+				return discovered, fmt.Errorf("failed to discover databases in %s: %v", sourcePath, err)
+			}
+			logger.Warning("Failed to discover databases in %s: %v", sourcePath, err)
+			continue
+		}
+
+		// Add source root information (size is already calculated during discovery)
+		for i := range databases {
+			databases[i].SourceRoot = source.SourceRoot
+			if cfg.SourcePriorities[sourcePath] == constants.PriorityHigh {
+				databases[i].Priority = constants.PriorityHigh
+			}
+			databases[i].Classifications = cfg.SourceClassifications[sourcePath]
+		}
+		assignConsistencyGroups(cfg.ConsistencyGroups, sourcePath, source.ScanPath, databases)
+		if source.PauseContainer != "" && len(databases) > 0 {
+			discovered.PauseContainers = append(discovered.PauseContainers, source.PauseContainer)
+		}
+
+		discovered.Databases = append(discovered.Databases, databases...)
+	}
+	return discovered, nil
+}
+
+// rebaseExcludes maps the excluded paths inside sourcePath onto scanPath,
+// where the source is actually walked (e.g. a snapshot of it)
+func rebaseExcludes(excludes []string, sourcePath, scanPath string) []string {
+	if scanPath == sourcePath {
+		return excludes
+	}
+	var rebased []string
+	for _, exclude := range excludes {
+		if !utils.IsWithin(exclude, sourcePath) {
+			continue
+		}
+		absSource, _ := filepath.Abs(sourcePath)
+		absExclude, _ := filepath.Abs(exclude)
+		if rel, err := filepath.Rel(absSource, absExclude); err == nil {
+			rebased = append(rebased, filepath.Join(scanPath, rel))
+		}
+	}
+	return rebased
+}
+
+// createBackupDir creates a fresh backup directory carrying the run marker
+// that lets gc recognize it if the run never completes. If the path is
+// already taken, for example by another run, the run ID is appended to it.
+func createBackupDir(backupPath, runID string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(backupPath), constants.DirPermission); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	err := os.Mkdir(backupPath, constants.DirPermission)
+	if os.IsExist(err) {
+		uniquePath := backupPath + "_" + runID
+		logger.Warning("Backup directory %s already exists, using %s", backupPath, uniquePath)
+		backupPath = uniquePath
+		err = os.Mkdir(backupPath, constants.DirPermission)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	if err := utils.WriteRunMarker(backupPath, runID); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
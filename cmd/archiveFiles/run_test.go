@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/catalog"
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+func TestCreateBackupDir(t *testing.T) {
+	backupPath := filepath.Join(t.TempDir(), "nested", "backup")
+
+	first, err := createBackupDir(backupPath, "aaaa1111")
+	if err != nil {
+		t.Fatalf("createBackupDir failed: %v", err)
+	}
+	if first != backupPath {
+		t.Errorf("createBackupDir() = %s, want %s", first, backupPath)
+	}
+	if marker, err := utils.ReadRunMarker(first); err != nil || marker.RunID != "aaaa1111" {
+		t.Errorf("Expected a run marker for aaaa1111, got %+v, %v", marker, err)
+	}
+
+	second, err := createBackupDir(backupPath, "bbbb2222")
+	if err != nil {
+		t.Fatalf("createBackupDir for a taken path failed: %v", err)
+	}
+	if second != backupPath+"_bbbb2222" {
+		t.Errorf("createBackupDir() = %s, want the run ID appended", second)
+	}
+}
+
+func TestRunArchive_ConcurrentRun(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	destination := filepath.Join(tempDir, "backups")
+	newConfig := func(name string) *types.Config {
+		return &types.Config{
+			SourcePaths:  []string{sourceDir},
+			BackupPath:   filepath.Join(destination, name),
+			Method:       constants.MethodCheckpoint,
+			LogLevel:     "error",
+			Durability:   constants.DurabilityNone,
+			HideProgress: true,
+		}
+	}
+
+	// Another run holds the destination
+	lock, err := utils.AcquireRunLock(destination, "other")
+	if err != nil {
+		t.Fatalf("AcquireRunLock failed: %v", err)
+	}
+	defer lock.Release()
+
+	_, err = runArchive(context.Background(), newConfig("blocked"), utils.NewRunID(), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "-allow-concurrent") {
+		t.Fatalf("runArchive error = %v, want a concurrent-run error", err)
+	}
+
+	cfg := newConfig("allowed")
+	cfg.AllowConcurrent = true
+	cfg.CatalogPath = filepath.Join(tempDir, "catalog.json")
+	result, err := runArchive(context.Background(), cfg, "cafe0123", nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive with AllowConcurrent failed: %v", err)
+	}
+	if result.RunID != "cafe0123" {
+		t.Errorf("Result run ID = %q, want cafe0123", result.RunID)
+	}
+
+	// The run ID is carried into the manifest and the catalog
+	backupManifest, err := manifest.Load(filepath.Join(result.BackupPath, manifest.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupCatalog, err := catalog.Load(cfg.CatalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backupManifest.RunID != "cafe0123" || len(backupCatalog.Runs) != 1 || backupCatalog.Runs[0].RunID != "cafe0123" {
+		t.Errorf("Run ID not recorded: manifest %q, catalog %+v", backupManifest.RunID, backupCatalog.Runs)
+	}
+	if _, err := os.Stat(filepath.Join(result.BackupPath, constants.RunMarkerFileName)); !os.IsNotExist(err) {
+		t.Errorf("Run marker should be removed after a complete backup, stat error: %v", err)
+	}
+}
+
+func TestRunArchive_Window(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte("log line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A window that opens two hours from now has not started yet
+	now := time.Now()
+	closed := types.TimeWindow{Start: (now.Hour() + 2) % 24 * 60, End: (now.Hour() + 3) % 24 * 60}
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(tempDir, "backup"),
+		Method:       constants.MethodCheckpoint,
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+		Window:       closed.String(),
+	}
+	if _, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil); err == nil || !strings.Contains(err.Error(), "window") {
+		t.Fatalf("runArchive error = %v, want the window to be closed", err)
+	}
+	if _, err := os.Stat(cfg.BackupPath); !os.IsNotExist(err) {
+		t.Errorf("No backup should be started outside the window, stat error: %v", err)
+	}
+
+	// Once the window closes, queued items are recorded as not started
+	databases, err := discovery.DiscoverDatabases(&types.Config{SourcePaths: []string{sourceDir}, BatchMode: true}, sourceDir)
+	if err != nil || len(databases) != 3 {
+		t.Fatalf("Expected 3 items, got %d (%v)", len(databases), err)
+	}
+	windowClosed := make(chan struct{})
+	close(windowClosed)
+	backupManifest := manifest.New(constants.MethodCheckpoint)
+	cfg.Window = "02:00-06:00"
+	notStarted := processDatabasesConcurrently(context.Background(), databases, filepath.Join(tempDir, "partial"), cfg,
+		progress.NewProgressTracker(false), 2, backupManifest, windowClosed, nil, nil)
+	if notStarted != 3 || len(backupManifest.Items) != 3 {
+		t.Fatalf("Expected 3 items not started, got %d (%d manifest items)", notStarted, len(backupManifest.Items))
+	}
+	for _, item := range backupManifest.Items {
+		if item.Status != manifest.StatusSkipped || !strings.Contains(item.Error, "02:00-06:00") {
+			t.Errorf("Expected %s to be skipped for the window, got %s: %s", item.Name, item.Status, item.Error)
+		}
+	}
+}
+
+func TestRunArchive_Guardrails(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), make([]byte, 2048), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(tempDir, "backup"),
+		Method:       constants.MethodCheckpoint,
+		BatchMode:    true,
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+		MaxItems:     2,
+		MaxTotalSize: "4K",
+	}
+	_, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "3 items (-max-items 2) and 6.0 KB (-max-total-size 4K)") {
+		t.Fatalf("runArchive error = %v, want both guardrails exceeded", err)
+	}
+	if _, err := os.Stat(cfg.BackupPath); !os.IsNotExist(err) {
+		t.Errorf("No backup should be started past the guardrails, stat error: %v", err)
+	}
+
+	cfg.Yes = true
+	if _, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil); err != nil {
+		t.Errorf("runArchive with -yes failed: %v", err)
+	}
+}
+
+func TestRunArchive_DestinationInsideSource(t *testing.T) {
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A live database next to the destination is still backed up
+	if err := os.MkdirAll(filepath.Join(sourceDir, "backups"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(sourceDir, "backups", "live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); INSERT INTO t (v) VALUES ('a')"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(sourceDir, "backups", "backup"),
+		Method:       constants.MethodCheckpoint,
+		Compress:     true,
+		KeepBackup:   true,
+		BatchMode:    true,
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+	}
+	// Later runs find the backups and archives of earlier ones in the source
+	for i := 0; i < 3; i++ {
+		result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+		if err != nil {
+			t.Fatalf("runArchive failed: %v", err)
+		}
+		if result.Items != 2 || result.Failed != 0 {
+			t.Errorf("Run %d archived %d items with %d failed, want only app.log and live.db", i+1, result.Items, result.Failed)
+		}
+	}
+}
+
+func TestRunArchive_OnAccessErrorFail(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app.log", "secret.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte("log line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(sourceDir, "secret.log"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &types.Config{
+		SourcePaths:   []string{sourceDir},
+		BackupPath:    filepath.Join(tempDir, "backup"),
+		Method:        constants.MethodCheckpoint,
+		LogLevel:      "error",
+		Durability:    constants.DurabilityNone,
+		HideProgress:  true,
+		OnAccessError: constants.OnAccessErrorFail,
+	}
+	if _, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil); err == nil || !strings.Contains(err.Error(), "secret.log") {
+		t.Errorf("runArchive error = %v, want the unreadable secret.log", err)
+	}
+}
+
+func TestEarlierRunPattern(t *testing.T) {
+	for _, tt := range []struct {
+		cfg   types.Config
+		names []string
+		other []string
+	}{
+		{
+			types.Config{BackupPath: "/data/backups/backup"},
+			[]string{"backup", "backup_0a1b2c3d", "backup.tar.gz", "backup_0a1b2c3d.tar.xz", "backup.tar.gz.sig", "backup.tar.gz.tmp", "backup.archive"},
+			[]string{"backup.db", "backups", "app.db", "backup_live"},
+		},
+		{
+			types.Config{BackupPath: "/data/backups/nightly_$(date +%Y%m%d_%H%M%S)", ArchivePath: "/data/backups/latest.tar.gz"},
+			[]string{"nightly_20250101_020000", "nightly_20250101_020000.tar.gz", "latest.tar.gz", "latest.tar.gz.sig"},
+			[]string{"nightly.db", "latest.db"},
+		},
+		{
+			types.Config{},
+			[]string{"backup_1735696800_0a1b2c3d", "backup_1735696800_0a1b2c3d.tar.gz"},
+			[]string{"backup", "backup.db"},
+		},
+	} {
+		pattern := earlierRunPattern(&tt.cfg)
+		for _, name := range tt.names {
+			if !pattern.MatchString(name) {
+				t.Errorf("%s: %s should be taken for a backup of an earlier run", tt.cfg.BackupPath, name)
+			}
+		}
+		for _, name := range tt.other {
+			if pattern.MatchString(name) {
+				t.Errorf("%s: %s should not be taken for a backup of an earlier run", tt.cfg.BackupPath, name)
+			}
+		}
+	}
+}
+
+func TestRunArchive_PerItemLayout(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.log", "b.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte("log line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &types.Config{
+		SourcePaths:   []string{sourceDir},
+		BackupPath:    filepath.Join(tempDir, "backup"),
+		Method:        constants.MethodCheckpoint,
+		BatchMode:     true,
+		Compress:      true,
+		ArchiveLayout: constants.ArchiveLayoutPerItem,
+		LogLevel:      "error",
+		Durability:    constants.DurabilityNone,
+		HideProgress:  true,
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	if result.ArchivePath != result.BackupPath+".archive" {
+		t.Errorf("ArchivePath = %s, want %s.archive", result.ArchivePath, result.BackupPath)
+	}
+
+	// One member per log file plus the root member
+	index, err := compress.VerifyIndexed(result.ArchivePath)
+	if err != nil {
+		t.Fatalf("VerifyIndexed failed: %v", err)
+	}
+	if len(index.Members) != 3 {
+		t.Errorf("Expected 3 members, got %d", len(index.Members))
+	}
+	manifestData, err := compress.ReadEntry(filepath.Join(result.ArchivePath, compress.RootMemberName), manifest.FileName)
+	if err != nil {
+		t.Fatalf("Root member should hold the manifest: %v", err)
+	}
+	if !strings.Contains(string(manifestData), "a.log") {
+		t.Errorf("Manifest does not list a.log: %s", manifestData)
+	}
+}
+
+func TestRecordVolumes(t *testing.T) {
+	backupPath := t.TempDir()
+	for name, size := range map[string]int{"big.db/000001.sst": 100, "big.db/000002.sst": 100, "small.log/small.log": 10} {
+		path := filepath.Join(backupPath, "source", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := manifest.New(constants.MethodCheckpoint)
+	m.Items = []manifest.Item{
+		{Name: "big.db", BackupPath: filepath.Join("source", "big.db"), Status: manifest.StatusOK},
+		{Name: "small.log", BackupPath: filepath.Join("source", "small.log"), Status: manifest.StatusOK},
+	}
+
+	if err := recordVolumes(backupPath, m, 128); err != nil {
+		t.Fatalf("recordVolumes failed: %v", err)
+	}
+	want := []manifest.Volume{
+		{File: "source/big.db.vol001.tar.gz", Files: []string{"source/big.db/000001.sst"}},
+		{File: "source/big.db.vol002.tar.gz", Files: []string{"source/big.db/000002.sst"}},
+	}
+	if !reflect.DeepEqual(m.Items[0].Volumes, want) {
+		t.Errorf("Volumes of big.db = %+v, want %+v", m.Items[0].Volumes, want)
+	}
+	if m.Items[1].Volumes != nil {
+		t.Errorf("An item that fits into one volume should not be split: %+v", m.Items[1].Volumes)
+	}
+}
+
+func TestRunArchive_Namespace(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.log"), []byte("log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &types.Config{
+		SourcePaths:  []string{sourceDir},
+		BackupPath:   filepath.Join(tempDir, "backup"),
+		Namespace:    "teamA",
+		Method:       constants.MethodCheckpoint,
+		BatchMode:    true,
+		Compress:     true,
+		KeepBackup:   true,
+		CatalogPath:  filepath.Join(tempDir, "catalog.json"),
+		LogLevel:     "error",
+		Durability:   constants.DurabilityNone,
+		HideProgress: true,
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(result.BackupPath, "teamA", "source", "a.log", "a.log")); err != nil {
+		t.Errorf("Item not stored below the namespace: %v", err)
+	}
+	if content, err := compress.ReadEntry(result.ArchivePath, "teamA/source/a.log/a.log"); err != nil || string(content) != "log line\n" {
+		t.Errorf("Archive entry teamA/source/a.log/a.log = %q, %v", content, err)
+	}
+	m, err := manifest.Load(filepath.Join(result.BackupPath, manifest.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Namespace != "teamA" || len(m.Items) != 1 || m.Items[0].BackupPath != "teamA/source/a.log" {
+		t.Errorf("Manifest namespace %q, items %+v", m.Namespace, m.Items)
+	}
+	// sha256("log line\n"), computed while the file was copied
+	if sum := m.Items[0].Checksums["a.log"]; sum != "8e722e34af271ba626bdbdf618ebf1386eaad27b073b6421d329bf5ffca22637" {
+		t.Errorf("Checksum of a.log = %q", sum)
+	}
+	backupCatalog, err := catalog.Load(cfg.CatalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backupCatalog.Runs) != 1 || backupCatalog.Runs[0].Namespace != "teamA" {
+		t.Errorf("Catalog runs = %+v, want one of namespace teamA", backupCatalog.Runs)
+	}
+}
+
+func TestRunArchive_ItemLogs(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(sourceDir, "app.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); INSERT INTO t (v) VALUES ('a')"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	cfg := &types.Config{
+		SourcePaths:       []string{sourceDir},
+		BackupPath:        filepath.Join(tempDir, "backup"),
+		Method:            constants.MethodCheckpoint,
+		BatchMode:         true,
+		Compress:          true,
+		Verify:            true,
+		ItemLogs:          true,
+		LogLevel:          "error",
+		Durability:        constants.DurabilityNone,
+		HideProgress:      true,
+		SQLiteAttachments: map[string][]string{dbPath: {filepath.Join(tempDir, "missing.db")}},
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+
+	content, err := compress.ReadEntry(result.ArchivePath, "source/app.db"+constants.ItemLogSuffix)
+	if err != nil {
+		t.Fatalf("Item log missing from the archive: %v", err)
+	}
+	for _, want := range []string{"item: app.db\n", "type: SQLite\n", "method: file-copy\n", "verification: passed\n", "warning: attached database", "result: ok\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Item log lacks %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestRunArchive_WarningsAsErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(sourceDir, "app.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); INSERT INTO t (v) VALUES ('a')"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// An attachment that does not exist is left out with a warning
+	cfg := &types.Config{
+		SourcePaths:       []string{sourceDir},
+		BackupPath:        filepath.Join(tempDir, "backup"),
+		Method:            constants.MethodCheckpoint,
+		BatchMode:         true,
+		LogLevel:          "error",
+		Durability:        constants.DurabilityNone,
+		HideProgress:      true,
+		SQLiteAttachments: map[string][]string{dbPath: {filepath.Join(tempDir, "missing.db")}},
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	if result.warningCount() != 1 || len(result.Warnings["source/app.db"]) != 1 {
+		t.Fatalf("Warnings = %v, want one for source/app.db", result.Warnings)
+	}
+	report := newRunReport(result, nil, time.Now())
+	if report.Status != reportSucceeded || report.Warnings != 1 {
+		t.Errorf("Report = status %s, %d warning(s)", report.Status, report.Warnings)
+	}
+	if runtime.GOOS == "linux" && (report.Usage == nil || report.Usage.PeakRSSBytes <= 0) {
+		t.Errorf("Report usage = %+v, want the run's resource usage", report.Usage)
+	}
+
+	cfg.WarningsAsErrors = true
+	cfg.BackupPath = filepath.Join(tempDir, "strict")
+	if _, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil); err == nil || !strings.Contains(err.Error(), "-warnings-as-errors") {
+		t.Errorf("runArchive error = %v, want a failure for the warning", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"sort"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+// scheduleJobs returns the order in which items are handed to the workers.
+// Items from high-priority sources always come first, so they are safe if
+// the run is cut short; the policy orders items within each priority.
+// Starting the largest items first keeps a few huge databases from ending up
+// on the tail of the run while the other workers sit idle.
+func scheduleJobs(databases []types.DatabaseInfo, policy string) []types.DatabaseInfo {
+	ordered := append([]types.DatabaseInfo(nil), databases...)
+	switch policy {
+	case constants.ScheduleLargestFirst:
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Size > ordered[j].Size })
+	case constants.ScheduleSmallestFirst:
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Size < ordered[j].Size })
+	case constants.ScheduleInterleaved:
+		// Alternate between the largest and the smallest remaining items,
+		// so large copies overlap with bursts of small ones
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Size > ordered[j].Size })
+		interleaved := make([]types.DatabaseInfo, 0, len(ordered))
+		for low, high := 0, len(ordered)-1; low <= high; low++ {
+			interleaved = append(interleaved, ordered[low])
+			if low < high {
+				interleaved = append(interleaved, ordered[high])
+			}
+			high--
+		}
+		ordered = interleaved
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority == constants.PriorityHigh && ordered[j].Priority != constants.PriorityHigh
+	})
+	return ordered
+}
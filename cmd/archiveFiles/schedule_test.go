@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+func TestScheduleJobs(t *testing.T) {
+	databases := []types.DatabaseInfo{
+		{Name: "a", Size: 30},
+		{Name: "b", Size: 500},
+		{Name: "c", Size: 10},
+		{Name: "d", Size: 200},
+		{Name: "e", Size: 30},
+	}
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"", "a b c d e"},
+		{constants.ScheduleDiscovery, "a b c d e"},
+		{constants.ScheduleLargestFirst, "b d a e c"},
+		{constants.ScheduleSmallestFirst, "c a e d b"},
+		{constants.ScheduleInterleaved, "b c d e a"},
+	}
+	for _, tt := range tests {
+		ordered := scheduleJobs(databases, tt.policy)
+		names := make([]string, len(ordered))
+		for i, db := range ordered {
+			names[i] = db.Name
+		}
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("scheduleJobs(%q) = %s, want %s", tt.policy, got, tt.want)
+		}
+	}
+
+	// High-priority items come first under every policy
+	databases[2].Priority = constants.PriorityHigh
+	databases[4].Priority = constants.PriorityHigh
+	for policy, want := range map[string]string{
+		"":                              "c e a b d",
+		constants.ScheduleLargestFirst:  "e c b d a",
+		constants.ScheduleSmallestFirst: "c e a d b",
+	} {
+		ordered := scheduleJobs(databases, policy)
+		names := make([]string, len(ordered))
+		for i, db := range ordered {
+			names[i] = db.Name
+		}
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("scheduleJobs(%q) with priorities = %s, want %s", policy, got, want)
+		}
+	}
+
+	// The discovered list itself is left alone
+	if databases[0].Name != "a" || databases[1].Name != "b" {
+		t.Error("scheduleJobs must not reorder its input")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/snapshot"
+)
+
+// sourceSnapshots holds the snapshots taken for a run, one per volume that
+// holds a source
+type sourceSnapshots struct {
+	byVolume map[string]*snapshot.Snapshot
+}
+
+// takeSnapshots snapshots every volume holding one of the source paths. If a
+// snapshot fails, the ones already taken are released.
+func takeSnapshots(ctx context.Context, sourcePaths []string) (*sourceSnapshots, error) {
+	snapshots := &sourceSnapshots{byVolume: map[string]*snapshot.Snapshot{}}
+	for _, sourcePath := range sourcePaths {
+		volume, err := snapshot.VolumeOf(sourcePath)
+		if err != nil {
+			snapshots.release()
+			return nil, err
+		}
+		if _, ok := snapshots.byVolume[volume]; ok {
+			continue
+		}
+		snap, err := snapshot.CreateAPFS(ctx, volume)
+		if err != nil {
+			snapshots.release()
+			return nil, err
+		}
+		snapshots.byVolume[volume] = snap
+	}
+	return snapshots, nil
+}
+
+// path maps a source path to its copy in the snapshot of its volume
+func (s *sourceSnapshots) path(sourcePath string) (string, error) {
+	volume, err := snapshot.VolumeOf(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	snap, ok := s.byVolume[volume]
+	if !ok {
+		return "", fmt.Errorf("no snapshot of volume %s", volume)
+	}
+	return snap.Path(sourcePath)
+}
+
+// release unmounts and deletes the snapshots. It may be called more than once.
+func (s *sourceSnapshots) release() {
+	for volume, snap := range s.byVolume {
+		if err := snap.Release(); err != nil {
+			logger.Error("%v", err)
+		}
+		delete(s.byVolume, volume)
+	}
+}
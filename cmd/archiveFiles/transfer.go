@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"archiveFiles/internal/constants"
+)
+
+// transferParts calls transfer for each of parts on up to parallel
+// goroutines, each with its own SSH connection, so a high-latency link is
+// not limited to the throughput of a single stream. No further part is
+// started after a failure; the parts already running are waited for and
+// the error of the lowest failed part is returned.
+func transferParts(parts []int, parallel int, transfer func(part int) error) error {
+	if parallel > len(parts) {
+		parallel = len(parts)
+	}
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failedPart := -1
+	var failure error
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range jobs {
+				if err := transfer(part); err != nil {
+					mu.Lock()
+					if failure == nil || part < failedPart {
+						failedPart, failure = part, err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, part := range parts {
+		mu.Lock()
+		failed := failure != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		jobs <- part
+	}
+	close(jobs)
+	wg.Wait()
+	return failure
+}
+
+// validateParallel checks the value of a -parallel flag
+func validateParallel(parallel int) error {
+	if parallel < 1 || parallel > constants.TransferMaxParallel {
+		return fmt.Errorf("invalid -parallel %d: must be between 1 and %d", parallel, constants.TransferMaxParallel)
+	}
+	return nil
+}
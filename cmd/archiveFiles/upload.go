@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// uploadState records the progress of an archive upload, so that an
+// interrupted upload resumes from the parts already written instead of
+// starting over
+type uploadState struct {
+	Target    string    `json:"target"`          // user@host:/path the archive is uploaded to
+	Size      int64     `json:"size"`            // Archive size when the upload started
+	ModTime   time.Time `json:"mod_time"`        // Archive modification time when the upload started
+	PartSize  int64     `json:"part_size"`       // Bytes per part; the last part may be shorter
+	Completed []int     `json:"completed_parts"` // Parts written to the remote file, ascending
+}
+
+// parts returns the number of parts of the archive
+func (s *uploadState) parts() int {
+	return int((s.Size + s.PartSize - 1) / s.PartSize)
+}
+
+// completed reports whether part was already written
+func (s *uploadState) completed(part int) bool {
+	i := sort.SearchInts(s.Completed, part)
+	return i < len(s.Completed) && s.Completed[i] == part
+}
+
+// markCompleted records part as written
+func (s *uploadState) markCompleted(part int) {
+	if !s.completed(part) {
+		s.Completed = append(s.Completed, part)
+		sort.Ints(s.Completed)
+	}
+}
+
+// loadUploadState reads the state of an earlier upload of archivePath. It
+// returns nil when there is none.
+func loadUploadState(archivePath string) (*uploadState, error) {
+	data, err := os.ReadFile(archivePath + constants.UploadStateSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload state: %v", err)
+	}
+	state := &uploadState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse upload state: %v", err)
+	}
+	return state, nil
+}
+
+// save writes the state next to archivePath via a temporary file, so a
+// crash never leaves a state claiming parts that were not written
+func (s *uploadState) save(archivePath string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload state: %v", err)
+	}
+	statePath := archivePath + constants.UploadStateSuffix
+	tempPath := statePath + ".tmp"
+	if err := os.WriteFile(tempPath, data, constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write upload state: %v", err)
+	}
+	if err := os.Rename(tempPath, statePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace upload state: %v", err)
+	}
+	return nil
+}
+
+// runUpload implements "upload": it copies an archive to a remote host over
+// SSH in parts, resuming an interrupted upload of the same archive
+func runUpload(args []string, stdout, stderr io.Writer) int {
+	uploadCmd := flag.NewFlagSet("upload", flag.ExitOnError)
+	archivePath := uploadCmd.String("archive", "", "Archive file to upload")
+	partSize := uploadCmd.String("part-size", "64M", "Size of the parts the archive is sent in, in whole MiB; at most one part is sent again after an interruption")
+	sshCommand := uploadCmd.String("ssh", "ssh", "SSH command, including options (e.g. \"ssh -p 2222 -i key\")")
+	namespace := uploadCmd.String("namespace", "", "Tenant namespace: the archive is stored in a directory of this name next to the target path")
+	configFile := uploadCmd.String("config", "", "JSON configuration file with the classification policy (default: search standard locations)")
+	parallel := uploadCmd.Int("parallel", constants.TransferParallel, "Number of parts sent at once, each over its own SSH connection")
+
+	// Accept the target before or after the flags
+	var target string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		target, args = args[0], args[1:]
+	}
+	if err := uploadCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if target == "" && uploadCmd.NArg() > 0 {
+		target = uploadCmd.Arg(0)
+	}
+	if target == "" || *archivePath == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles upload -archive=archive_path user@host:/path [-namespace=name] [-part-size=64M] [-parallel=4] [-ssh=command]")
+		return 1
+	}
+
+	remote, err := parseRemoteTarget(target)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	if *namespace != "" {
+		if err := types.ValidateNamespace(*namespace); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		remote.Path = namespacedPath(remote.Path, *namespace)
+	}
+	size, err := types.ParseSize(*partSize)
+	if err != nil || size <= 0 || size%constants.UploadBlockSize != 0 {
+		fmt.Fprintf(stderr, "Invalid -part-size %q: must be a positive number of whole MiB, e.g. 64M\n", *partSize)
+		return 1
+	}
+	if err := validateParallel(*parallel); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	sshArgs := strings.Fields(*sshCommand)
+	if len(sshArgs) == 0 {
+		fmt.Fprintln(stderr, "-ssh must not be empty")
+		return 1
+	}
+
+	if err := checkUploadPolicy(*configFile, *archivePath, remote); err != nil {
+		fmt.Fprintf(stderr, "Upload refused: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+
+	if err := uploadArchive(sshArgs, *archivePath, remote, size, *parallel, stderr); err != nil {
+		fmt.Fprintf(stderr, "Upload failed: %v\n", err)
+		fmt.Fprintln(stderr, "Run the same command again to resume")
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s:%s\n", remote.Host, remote.Path)
+	return 0
+}
+
+// checkUploadPolicy refuses uploads the classification policy of the config
+// forbids, based on the labels recorded in the archive's manifest
+func checkUploadPolicy(configFile, archivePath string, remote remoteTarget) error {
+	cfg, err := loadOptionalConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if err := cfg.ValidateClassifications(); err != nil {
+		return err
+	}
+	data, err := readArchiveManifest(archivePath)
+	// Files that are not readable archives, such as archives encrypted with
+	// age, carry no labels to check
+	if errors.Is(err, apperr.ErrUnsupportedFormat) {
+		return nil
+	}
+	if err != nil || data == nil {
+		return err
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse the manifest of %s: %v", archivePath, err)
+	}
+	return cfg.CheckDestination(m.Classifications(), remote.Host+":"+remote.Path)
+}
+
+// namespacedPath moves the file at remotePath into a directory named after
+// namespace, so tenants uploading archives of the same name to a shared
+// host do not overwrite each other
+func namespacedPath(remotePath, namespace string) string {
+	return path.Join(path.Dir(remotePath), namespace, path.Base(remotePath))
+}
+
+// uploadArchive writes the parts of archivePath missing from the remote
+// file <path>.partial, up to parallel parts at once, recording each one in
+// the upload state once written, then renames the file into place. A state
+// left by an upload of the same, unchanged archive to the same target is
+// resumed.
+func uploadArchive(sshArgs []string, archivePath string, remote remoteTarget, partSize int64, parallel int, stderr io.Writer) error {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat archive: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a file; per-item archives cannot be uploaded", archivePath)
+	}
+
+	target := remote.Host + ":" + remote.Path
+	partialPath := remote.Path + constants.UploadPartialSuffix
+	state, err := loadUploadState(archivePath)
+	if err != nil {
+		return err
+	}
+	resuming := state != nil && state.Target == target && state.Size == info.Size() &&
+		state.ModTime.Equal(info.ModTime()) && state.PartSize == partSize
+	if state != nil && !resuming {
+		fmt.Fprintf(stderr, "Archive or upload settings changed since the interrupted upload, starting over\n")
+	}
+	if !resuming {
+		state = &uploadState{Target: target, Size: info.Size(), ModTime: info.ModTime(), PartSize: partSize}
+		// Bytes of an earlier, different upload must not survive past the
+		// end. The directory may be a namespace's, not created yet.
+		create := fmt.Sprintf("mkdir -p %s && : > %s", shellQuote(path.Dir(remote.Path)), shellQuote(partialPath))
+		if err := runRemote(sshArgs, remote.Host, create, nil, nil); err != nil {
+			return fmt.Errorf("failed to create %s: %v", partialPath, err)
+		}
+		if err := state.save(archivePath); err != nil {
+			return err
+		}
+	} else if len(state.Completed) > 0 {
+		fmt.Fprintf(stderr, "Resuming upload: %d of %d part(s) already written\n", len(state.Completed), state.parts())
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer archive.Close()
+
+	fmt.Fprintf(stderr, "Uploading %s (%s) to %s...\n", archivePath, utils.FormatBytes(info.Size()), target)
+	var missing []int
+	for part := 0; part < state.parts(); part++ {
+		if !state.completed(part) {
+			missing = append(missing, part)
+		}
+	}
+	blocksPerPart := partSize / constants.UploadBlockSize
+	var stateMu sync.Mutex
+	err = transferParts(missing, parallel, func(part int) error {
+		offset := int64(part) * partSize
+		length := partSize
+		if offset+length > state.Size {
+			length = state.Size - offset
+		}
+
+		command := fmt.Sprintf("dd of=%s bs=%d seek=%d conv=notrunc", shellQuote(partialPath), constants.UploadBlockSize, int64(part)*blocksPerPart)
+		if err := runRemote(sshArgs, remote.Host, command, io.NewSectionReader(archive, offset, length), nil); err != nil {
+			return fmt.Errorf("failed to write part %d of %d: %v", part+1, state.parts(), err)
+		}
+		stateMu.Lock()
+		defer stateMu.Unlock()
+		state.markCompleted(part)
+		return state.save(archivePath)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The size check catches parts lost on the remote side, e.g. when the
+	// partial file was removed between invocations
+	finish := fmt.Sprintf("[ $(wc -c < %s) -eq %d ] && mv -f %s %s", shellQuote(partialPath), state.Size, shellQuote(partialPath), shellQuote(remote.Path))
+	if err := runRemote(sshArgs, remote.Host, finish, nil, nil); err != nil {
+		// The state no longer describes the remote file; start over next time
+		os.Remove(archivePath + constants.UploadStateSuffix)
+		return fmt.Errorf("uploaded file %s does not have the size of the archive: %v", partialPath, err)
+	}
+	if err := os.Remove(archivePath + constants.UploadStateSuffix); err != nil {
+		fmt.Fprintf(stderr, "Warning: failed to remove upload state: %v\n", err)
+	}
+	return nil
+}
+
+// runRemote runs command on host with stdin and stdout, returning its error
+// output with a failure
+func runRemote(sshArgs []string, host, command string, stdin io.Reader, stdout io.Writer) error {
+	var errOut bytes.Buffer
+	cmd := exec.Command(sshArgs[0], append(sshArgs[1:], host, command)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(errOut.String()); message != "" {
+			return fmt.Errorf("%v: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
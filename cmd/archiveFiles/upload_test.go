@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+)
+
+// flakySSH is fakeSSH that fails every dd after the first limit ones, like
+// a connection dropping in the middle of an upload. It counts them in
+// counter.
+func flakySSH(t *testing.T, counter string, limit int) []string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "ssh")
+	body := fmt.Sprintf(`#!/bin/sh
+shift
+case "$1" in
+dd*)
+	n=$(($(cat %[1]s 2>/dev/null || echo 0) + 1))
+	echo $n > %[1]s
+	[ $n -gt %[2]d ] && { echo "connection reset" >&2; exit 255; }
+	;;
+esac
+exec sh -c "$1"
+`, shellQuote(counter), limit)
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatalf("Failed to write fake ssh: %v", err)
+	}
+	return []string{script}
+}
+
+func TestUploadArchive_Resume(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	data := make([]byte, 3*constants.UploadBlockSize+1234)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := os.WriteFile(archivePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := remoteTarget{Host: "backup@nas", Path: filepath.Join(dir, "remote", "backup.tar.gz")}
+	if err := os.MkdirAll(filepath.Dir(remote.Path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	counter := filepath.Join(dir, "dd-count")
+
+	// The connection drops after two of the four parts
+	var stderr bytes.Buffer
+	err := uploadArchive(flakySSH(t, counter, 2), archivePath, remote, constants.UploadBlockSize, 1, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "part 3 of 4") || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("uploadArchive error = %v, want part 3 to fail", err)
+	}
+	state, err := loadUploadState(archivePath)
+	if err != nil || state == nil {
+		t.Fatalf("Upload state missing after the interruption: %v", err)
+	}
+	if fmt.Sprint(state.Completed) != "[0 1]" {
+		t.Errorf("Completed parts = %v, want [0 1]", state.Completed)
+	}
+	if _, err := os.Stat(remote.Path); !os.IsNotExist(err) {
+		t.Errorf("An incomplete upload must not appear under the final name, stat error: %v", err)
+	}
+
+	// The next invocation sends only the two missing parts
+	os.Remove(counter)
+	stderr.Reset()
+	if err := uploadArchive(flakySSH(t, counter, 2), archivePath, remote, constants.UploadBlockSize, 1, &stderr); err != nil {
+		t.Fatalf("Resumed upload failed: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Resuming upload: 2 of 4 part(s) already written") {
+		t.Errorf("Resume not reported: %s", stderr.String())
+	}
+	uploaded, err := os.ReadFile(remote.Path)
+	if err != nil || !bytes.Equal(uploaded, data) {
+		t.Fatalf("Uploaded file differs from the archive (read error: %v)", err)
+	}
+	if _, err := os.Stat(archivePath + constants.UploadStateSuffix); !os.IsNotExist(err) {
+		t.Errorf("Upload state should be removed after success, stat error: %v", err)
+	}
+}
+
+func TestUploadArchive_ChangedArchiveStartsOver(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	if err := os.WriteFile(archivePath, bytes.Repeat([]byte("new archive "), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := remoteTarget{Host: "nas", Path: filepath.Join(dir, "uploaded.tar.gz")}
+
+	// A stale state and a longer partial file from another archive
+	stale := &uploadState{Target: "nas:" + remote.Path, Size: 5, PartSize: constants.UploadBlockSize, Completed: []int{0}}
+	if err := stale.save(archivePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(remote.Path+constants.UploadPartialSuffix, bytes.Repeat([]byte("x"), 50000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if err := uploadArchive(fakeSSH(t), archivePath, remote, constants.UploadBlockSize, constants.TransferParallel, &stderr); err != nil {
+		t.Fatalf("uploadArchive failed: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "starting over") {
+		t.Errorf("Restart not reported: %s", stderr.String())
+	}
+	uploaded, _ := os.ReadFile(remote.Path)
+	if want, _ := os.ReadFile(archivePath); !bytes.Equal(uploaded, want) {
+		t.Errorf("Uploaded %d bytes, want the %d bytes of the new archive", len(uploaded), len(want))
+	}
+}
+
+func TestUploadArchive_Parallel(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	data := make([]byte, 7*constants.UploadBlockSize+99)
+	rand.New(rand.NewSource(2)).Read(data)
+	if err := os.WriteFile(archivePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := remoteTarget{Host: "nas", Path: filepath.Join(dir, "remote", "backup.tar.gz")}
+
+	var stderr bytes.Buffer
+	if err := uploadArchive(fakeSSH(t), archivePath, remote, constants.UploadBlockSize, 3, &stderr); err != nil {
+		t.Fatalf("uploadArchive failed: %v", err)
+	}
+	uploaded, err := os.ReadFile(remote.Path)
+	if err != nil || !bytes.Equal(uploaded, data) {
+		t.Fatalf("Uploaded file differs from the archive (read error: %v)", err)
+	}
+}
+
+func TestRunUpload_PartSize(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runUpload([]string{"nas:/backups/a.tar.gz", "-archive", "a.tar.gz", "-part-size", "1500K"}, &stdout, &stderr); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "whole MiB") {
+		t.Errorf("stderr = %q, want the part size rejected", stderr.String())
+	}
+}
+
+func TestRunUpload_Namespace(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	if err := os.WriteFile(archivePath, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace directory does not exist on the remote side yet
+	var stdout, stderr bytes.Buffer
+	target := "nas:" + filepath.Join(dir, "remote", "backup.tar.gz")
+	if code := runUpload([]string{target, "-archive", archivePath, "-namespace", "teamA", "-ssh", fakeSSH(t)[0]}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+	uploadedPath := filepath.Join(dir, "remote", "teamA", "backup.tar.gz")
+	if uploaded, err := os.ReadFile(uploadedPath); err != nil || string(uploaded) != "archive" {
+		t.Errorf("Uploaded %s = %q, %v", uploadedPath, uploaded, err)
+	}
+	if strings.TrimSpace(stdout.String()) != "nas:"+uploadedPath {
+		t.Errorf("stdout = %q, want the namespaced target", stdout.String())
+	}
+
+	stderr.Reset()
+	if code := runUpload([]string{target, "-archive", archivePath, "-namespace", "../other"}, &stdout, &stderr); code != 1 {
+		t.Errorf("exit code = %d for an invalid namespace, want 1", code)
+	}
+}
+
+func TestRunUpload_ClassificationPolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.log"), []byte("user@example.com logged in\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &types.Config{
+		SourcePaths:           []string{sourceDir},
+		BackupPath:            filepath.Join(tempDir, "backup"),
+		Method:                constants.MethodCheckpoint,
+		BatchMode:             true,
+		Compress:              true,
+		SourceClassifications: map[string][]string{sourceDir: {constants.ClassificationPII}},
+		LogLevel:              "error",
+		Durability:            constants.DurabilityNone,
+		HideProgress:          true,
+		Yes:                   true,
+	}
+	result, err := runArchive(context.Background(), cfg, utils.NewRunID(), nil, nil)
+	if err != nil {
+		t.Fatalf("runArchive failed: %v", err)
+	}
+	data, err := readArchiveManifest(result.ArchivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Classifications(); len(got) != 1 || got[0] != constants.ClassificationPII {
+		t.Errorf("Manifest classifications = %v, want [pii]", got)
+	}
+
+	configFile := filepath.Join(tempDir, "config.json")
+	encrypted := filepath.Join(tempDir, "vault")
+	policy := fmt.Sprintf(`{"encrypted_destinations": ["nas:%s"]}`, encrypted)
+	if err := os.WriteFile(configFile, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	plain := "nas:" + filepath.Join(tempDir, "plain", "backup.tar.gz")
+	if code := runUpload([]string{plain, "-archive", result.ArchivePath, "-config", configFile, "-ssh", fakeSSH(t)[0]}, &stdout, &stderr); code != 1 {
+		t.Errorf("exit code = %d for an unencrypted destination, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "Upload refused") || !strings.Contains(stderr.String(), "Hint:") {
+		t.Errorf("stderr = %q, want the upload refused with a hint", stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "plain")); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be sent to a refused destination, stat error: %v", err)
+	}
+
+	stderr.Reset()
+	vault := "nas:" + filepath.Join(encrypted, "backup.tar.gz")
+	if code := runUpload([]string{vault, "-archive", result.ArchivePath, "-config", configFile, "-ssh", fakeSSH(t)[0]}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr.String())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/verify"
+)
+
+// runVerify implements "verify": it checks an existing backup of one
+// database or file against its source, outside of a backup run. Source and
+// backup are only opened read-only.
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	verifyCmd := flag.NewFlagSet("verify", flag.ContinueOnError)
+	source := verifyCmd.String("source", "", "Database or file the backup was taken from")
+	backupPath := verifyCmd.String("backup", "", "Backup of it: the item directory in a backup, or the backed up file itself")
+	typeName := verifyCmd.String("type", "", "Type of the source: rocksdb, sqlite, log or generic (default: detected)")
+	level := verifyCmd.String("level", "", "Verification level: quick, sample (quick plus a sample of keys/rows) or full (quick plus every key/row) (default: quick, or sample with -sample)")
+	sample := verifyCmd.String("sample", "", "Share of keys/rows compared at the sample level, e.g. 5% (default: "+constants.DefaultVerifySample+")")
+	seed := verifyCmd.Int64("seed", 0, "Seed selecting the sample, to reproduce an earlier verification (default: random)")
+	if err := verifyCmd.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "Failed to parse flags: %v\n", err)
+		return 1
+	}
+	if *source == "" || *backupPath == "" {
+		fmt.Fprintln(stderr, "Usage: archiveFiles verify -source=path -backup=path [-type=rocksdb|sqlite|log|generic] [-level=quick|sample|full] [-sample=5%] [-seed=N]")
+		return 1
+	}
+
+	if *level == "" {
+		*level = constants.VerifyLevelQuick
+		if *sample != "" {
+			*level = constants.VerifyLevelSample
+		}
+	}
+	var fraction float64
+	switch *level {
+	case constants.VerifyLevelQuick:
+		if *sample != "" {
+			fmt.Fprintf(stderr, "-sample applies to -level=%s only\n", constants.VerifyLevelSample)
+			return 1
+		}
+	case constants.VerifyLevelSample:
+		if *sample == "" {
+			*sample = constants.DefaultVerifySample
+		}
+		var err error
+		if fraction, err = types.ParseSamplePercent(*sample); err != nil {
+			fmt.Fprintf(stderr, "Invalid -sample: %v\n", err)
+			return 1
+		}
+	case constants.VerifyLevelFull:
+		if *sample != "" {
+			fmt.Fprintf(stderr, "-sample applies to -level=%s only\n", constants.VerifyLevelSample)
+			return 1
+		}
+		fraction = 1
+	default:
+		fmt.Fprintf(stderr, "Invalid -level %q (valid: %s, %s, %s)\n", *level, constants.VerifyLevelQuick, constants.VerifyLevelSample, constants.VerifyLevelFull)
+		return 1
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	db, itemPath, err := verifyTarget(*source, *backupPath, *typeName)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var sampled verify.SampleResult
+	warnings, err := verify.VerifyBackup(db, itemPath, nil)
+	if err == nil && fraction > 0 {
+		sampled, err = verify.VerifySample(db, itemPath, verify.SampleOptions{Fraction: fraction, Seed: *seed})
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(stderr, "Warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Verification failed: %v\n", err)
+		printHint(stderr, err)
+		return 1
+	}
+
+	switch *level {
+	case constants.VerifyLevelSample:
+		fmt.Fprintf(stdout, "Verification OK: %s matches %s (%s, %d of %d keys/rows compared, seed %d)\n", *backupPath, *source, db.Type, sampled.Checked, sampled.Total, *seed)
+	case constants.VerifyLevelFull:
+		fmt.Fprintf(stdout, "Verification OK: %s matches %s (%s, %d keys/rows compared)\n", *backupPath, *source, db.Type, sampled.Checked)
+	default:
+		fmt.Fprintf(stdout, "Verification OK: %s matches %s (%s)\n", *backupPath, *source, db.Type)
+	}
+	return 0
+}
+
+// verifyTarget describes the source for verification and returns the item
+// directory of its backup. A backed up file may be named directly; the
+// directory holding it is the item then.
+func verifyTarget(source, backupPath, typeName string) (types.DatabaseInfo, string, error) {
+	source = filepath.Clean(source)
+	backupPath = filepath.Clean(backupPath)
+	if _, err := os.Stat(source); err != nil {
+		return types.DatabaseInfo{}, "", fmt.Errorf("source: %v", err)
+	}
+	backupInfo, err := os.Stat(backupPath)
+	if err != nil {
+		return types.DatabaseInfo{}, "", fmt.Errorf("backup: %v", err)
+	}
+
+	dbType := discovery.DetectDatabaseType(source)
+	if typeName != "" {
+		if dbType, err = types.ParseDatabaseType(typeName); err != nil {
+			return types.DatabaseInfo{}, "", err
+		}
+	}
+	if dbType == types.DatabaseTypeUnknown {
+		return types.DatabaseInfo{}, "", fmt.Errorf("cannot tell what %s is; pass -type", source)
+	}
+
+	itemPath := backupPath
+	if !backupInfo.IsDir() {
+		if dbType == types.DatabaseTypeRocksDB {
+			return types.DatabaseInfo{}, "", fmt.Errorf("backup %s of a RocksDB database must be a directory", backupPath)
+		}
+		if filepath.Base(backupPath) != filepath.Base(source) {
+			return types.DatabaseInfo{}, "", fmt.Errorf("backup file %s must have the name of its source, %s", backupPath, filepath.Base(source))
+		}
+		itemPath = filepath.Dir(backupPath)
+	}
+
+	db := types.DatabaseInfo{
+		Name:      filepath.Base(source),
+		Path:      source,
+		Type:      dbType,
+		Encrypted: discovery.IsEncrypted(dbType, source),
+	}
+	return db, itemPath, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "data", "app.log")
+	backupDir := filepath.Join(dir, "backup", "data", "app.log")
+	for _, path := range []string{source, filepath.Join(backupDir, "app.log")} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("log line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The item directory and the backed up file itself are both accepted
+	for _, backup := range []string{backupDir, filepath.Join(backupDir, "app.log")} {
+		var stdout, stderr bytes.Buffer
+		if code := runVerify([]string{"-source", source, "-backup", backup}, &stdout, &stderr); code != 0 {
+			t.Fatalf("exit code = %d for -backup %s: %s", code, backup, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), "Verification OK") {
+			t.Errorf("stdout = %q, want the verification reported", stdout.String())
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(backupDir, "app.log"), []byte("tampered\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := runVerify([]string{"-source", source, "-backup", backupDir}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "Verification failed") {
+		t.Errorf("exit code = %d, stderr %q, want the changed backup reported", code, stderr.String())
+	}
+
+	for _, args := range [][]string{
+		{"-source", source},
+		{"-source", source, "-backup", backupDir, "-level", "deep"},
+		{"-source", source, "-backup", backupDir, "-level", "full", "-sample", "5%"},
+		{"-source", source, "-backup", backupDir, "-sample", "200%"},
+		{"-source", source, "-backup", filepath.Join(dir, "backup", "data"), "-type", "rocksdb"},
+	} {
+		stderr.Reset()
+		if code := runVerify(args, &stdout, &stderr); code != 1 {
+			t.Errorf("exit code = %d for %v, want 1 (stderr %q)", code, args, stderr.String())
+		}
+	}
+}
+
+func TestVerifyTarget(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.log")
+	other := filepath.Join(dir, "backup", "other.log")
+	for _, path := range []string{source, other} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := verifyTarget(source, other, ""); err == nil || !strings.Contains(err.Error(), "name of its source") {
+		t.Errorf("verifyTarget error = %v, want a backup file of another name rejected", err)
+	}
+	if _, _, err := verifyTarget(source, filepath.Join(dir, "missing"), ""); err == nil {
+		t.Error("verifyTarget should fail for a missing backup")
+	}
+	db, itemPath, err := verifyTarget(source, filepath.Dir(other), "generic")
+	if err != nil || itemPath != filepath.Dir(other) || db.Name != "app.log" || db.Path != source {
+		t.Errorf("verifyTarget = %+v, %s, %v", db, itemPath, err)
+	}
+}
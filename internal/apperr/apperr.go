@@ -0,0 +1,78 @@
+// Package apperr defines the kinds of failure callers need to tell apart,
+// such as a locked source or a corrupt database, each with a hint on what
+// the user can do about it.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Failure kinds. Test for them with errors.Is.
+var (
+	ErrLocked            = errors.New("locked")
+	ErrCorrupt           = errors.New("corrupt")
+	ErrUnsupportedMethod = errors.New("unsupported method")
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrNotApproved       = errors.New("not approved")
+	ErrPolicy            = errors.New("policy violation")
+)
+
+// hints are the remediation hints of the failure kinds, in lookup order
+var hints = []struct {
+	kind error
+	hint string
+}{
+	{ErrLocked, "stop the application holding the lock or retry later; RocksDB and SQLite databases can usually be copied while open with -method=checkpoint"},
+	{ErrCorrupt, "check the source with the database's own tools (e.g. sqlite3 .recover); -on-corruption=backup-anyway archives it regardless"},
+	{ErrUnsupportedMethod, "use -method=checkpoint, backup, copy or copy-files"},
+	{ErrUnsupportedFormat, "decompress or decrypt the file with the tool that produced it, then pass the resulting .tar or .tar.gz"},
+	{ErrNotApproved, "ask an approver to run archiveFiles approve-restore -archive=<archive> -key=<key.pem> and pass the token with -approval-token or ARCHIVEFILES_APPROVAL_TOKEN"},
+	{ErrPolicy, "send the backup to a destination listed in encrypted_destinations, or correct source_classifications if the label is wrong"},
+	{fs.ErrPermission, "run as a user that can read the source and write the backup destination"},
+}
+
+// Error is a failure of a known kind. errors.Is matches both the kind and
+// the underlying cause.
+type Error struct {
+	Kind error  // One of the Err* values
+	Msg  string // What failed
+	Err  error  // Underlying cause, may be nil
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the kind and the cause for errors.Is and errors.As
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// New returns an error of the given kind
+func New(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an error of the given kind caused by err
+func Wrap(kind error, err error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Hint returns the remediation hint for err, or "" if its kind is unknown
+func Hint(err error) string {
+	for _, h := range hints {
+		if errors.Is(err, h.kind) {
+			return h.hint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	cause := fmt.Errorf("open LOCK: %w", fs.ErrPermission)
+	err := Wrap(ErrLocked, cause, "checkpoint failed for %s", "/data/db")
+
+	if err.Error() != "checkpoint failed for /data/db: open LOCK: permission denied" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if !errors.Is(err, ErrLocked) {
+		t.Error("Expected errors.Is to match the kind")
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Error("Expected errors.Is to match the cause")
+	}
+	if errors.Is(err, ErrCorrupt) {
+		t.Error("Expected errors.Is not to match another kind")
+	}
+
+	// Kinds survive further wrapping
+	wrapped := fmt.Errorf("verification failed: %w", New(ErrCorrupt, "integrity check failed: %s", "page 3"))
+	if !errors.Is(wrapped, ErrCorrupt) {
+		t.Error("Expected errors.Is to match through fmt.Errorf wrapping")
+	}
+	if wrapped.Error() != "verification failed: integrity check failed: page 3" {
+		t.Errorf("Error() = %q", wrapped.Error())
+	}
+}
+
+func TestHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantHint bool
+	}{
+		{"Locked", New(ErrLocked, "locked"), true},
+		{"Corrupt", New(ErrCorrupt, "corrupt"), true},
+		{"Unsupported method", New(ErrUnsupportedMethod, "unknown method"), true},
+		{"Unsupported format", New(ErrUnsupportedFormat, "zstd archive"), true},
+		{"Permission", &os.PathError{Op: "open", Path: "/data", Err: fs.ErrPermission}, true},
+		{"Plain error", errors.New("disk on fire"), false},
+		{"Nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hint(tt.err); (got != "") != tt.wantHint {
+				t.Errorf("Hint() = %q, want hint: %v", got, tt.wantHint)
+			}
+		})
+	}
+
+	// The kind wins over the cause
+	err := Wrap(ErrLocked, fs.ErrPermission, "locked")
+	if Hint(err) != Hint(New(ErrLocked, "locked")) {
+		t.Errorf("Hint() = %q, want the ErrLocked hint", Hint(err))
+	}
+}
@@ -0,0 +1,90 @@
+// Package approval issues and checks restore approval tokens. A token is an
+// approver's Ed25519 signature allowing one archive of a protected
+// namespace to be restored until it expires, so restoring regulated data
+// takes two people: the operator running the restore and the approver
+// holding the private key.
+package approval
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/apperr"
+)
+
+// tokenVersion is the version of the token format
+const tokenVersion = 1
+
+// Claims is what an approval token allows
+type Claims struct {
+	Version        int       `json:"version"`
+	Archive        string    `json:"archive"`            // Base name of the approved archive, for the audit log
+	Namespace      string    `json:"namespace"`          // Namespace recorded in the archive's manifest
+	ManifestSHA256 string    `json:"manifest_sha256"`    // Digest of the archive's manifest.json, binding the token to one backup
+	Approver       string    `json:"approver,omitempty"` // Who approved the restore
+	Expires        time.Time `json:"expires"`
+}
+
+// ManifestDigest returns the digest of manifest.json content that tokens
+// are bound to
+func ManifestDigest(manifestData []byte) string {
+	sum := sha256.Sum256(manifestData)
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue signs claims with the approver's key and returns the token: the
+// claims JSON and its signature, each base64url-encoded and joined by a dot
+func Issue(claims Claims, key ed25519.PrivateKey) (string, error) {
+	claims.Version = tokenVersion
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode approval: %v", err)
+	}
+	signature := ed25519.Sign(key, payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks that token is signed by key and allows restoring the
+// archive whose manifest has the given namespace and digest at time now,
+// and returns its claims
+func Verify(token string, key ed25519.PublicKey, namespace, manifestSHA256 string, now time.Time) (*Claims, error) {
+	if token == "" {
+		return nil, apperr.New(apperr.ErrNotApproved, "restoring namespace %q requires an approval token", namespace)
+	}
+	encodedPayload, encodedSignature, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return nil, apperr.New(apperr.ErrNotApproved, "malformed approval token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, apperr.New(apperr.ErrNotApproved, "malformed approval token: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, apperr.New(apperr.ErrNotApproved, "malformed approval token: %v", err)
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return nil, apperr.New(apperr.ErrNotApproved, "approval token is not signed by the configured approval key")
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, apperr.New(apperr.ErrNotApproved, "malformed approval token: %v", err)
+	}
+	if claims.Version != tokenVersion {
+		return nil, apperr.New(apperr.ErrNotApproved, "unsupported approval token version %d", claims.Version)
+	}
+	if claims.Namespace != namespace || claims.ManifestSHA256 != manifestSHA256 {
+		return nil, apperr.New(apperr.ErrNotApproved, "approval token was issued for another archive (%s)", claims.Archive)
+	}
+	if !now.Before(claims.Expires) {
+		return nil, apperr.New(apperr.ErrNotApproved, "approval token expired at %s", claims.Expires.Format(time.RFC3339))
+	}
+	return &claims, nil
+}
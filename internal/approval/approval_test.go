@@ -0,0 +1,72 @@
+package approval
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/apperr"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	digest := ManifestDigest([]byte(`{"namespace":"pii"}`))
+	claims := Claims{Archive: "backup.tar.gz", Namespace: "pii", ManifestSHA256: digest, Approver: "alice", Expires: now.Add(time.Hour)}
+	token, err := Issue(claims, privateKey)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	got, err := Verify(token, publicKey, "pii", digest, now)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if got.Approver != "alice" || got.Archive != "backup.tar.gz" {
+		t.Errorf("Unexpected claims %+v", got)
+	}
+
+	forged, err := Issue(claims, otherPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(token, ".")
+	_, signature, _ := strings.Cut(forged, ".")
+	tests := []struct {
+		name      string
+		token     string
+		key       ed25519.PublicKey
+		namespace string
+		digest    string
+		now       time.Time
+		want      string
+	}{
+		{"missing", "", publicKey, "pii", digest, now, "requires an approval token"},
+		{"malformed", "not-a-token", publicKey, "pii", digest, now, "malformed"},
+		{"wrong key", token, otherPublicKey, "pii", digest, now, "not signed by"},
+		{"forged signature", payload + "." + signature, publicKey, "pii", digest, now, "not signed by"},
+		{"other archive", token, publicKey, "pii", ManifestDigest([]byte("{}")), now, "another archive"},
+		{"other namespace", token, publicKey, "payments", digest, now, "another archive"},
+		{"expired", token, publicKey, "pii", digest, now.Add(time.Hour), "expired"},
+	}
+	for _, tt := range tests {
+		_, err := Verify(tt.token, tt.key, tt.namespace, tt.digest, tt.now)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Verify = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+		if !errors.Is(err, apperr.ErrNotApproved) {
+			t.Errorf("%s: error %v is not ErrNotApproved", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package audit appends records of security-relevant operations, such as
+// backups and restores, to an append-only JSON Lines file and optionally
+// to syslog
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+// Audit log constants
+const (
+	FilePermission = 0640 // Audit logs name users and hosts; keep them from other users
+
+	ResultStarted = "started"
+	ResultOK      = "ok"
+	ResultFailed  = "failed"
+	ResultDenied  = "denied"
+)
+
+// Record is one line of the audit log
+type Record struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"` // e.g. backup, verify, restore, gc
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Args      []string  `json:"args,omitempty"` // Command line arguments, secrets redacted
+	Archive   string    `json:"archive,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Approver  string    `json:"approver,omitempty"` // Approver named by the approval token, if one was required
+	Result    string    `json:"result"`             // started, ok, failed or denied
+	ExitCode  int       `json:"exit_code,omitempty"`
+	Duration  float64   `json:"duration_seconds,omitempty"` // Time since the started record
+	Error     string    `json:"error,omitempty"`
+}
+
+// NewRecord returns a record of operation started now by the current user
+// on this host
+func NewRecord(operation string) Record {
+	record := Record{Time: time.Now().UTC(), Operation: operation, User: os.Getenv("USER"), PID: os.Getpid()}
+	if current, err := user.Current(); err == nil {
+		record.User = current.Username
+	}
+	record.Host, _ = os.Hostname()
+	return record
+}
+
+// Finish sets the result of the record from the operation's error
+func (r *Record) Finish(err error) {
+	r.Result = ResultOK
+	if err != nil {
+		r.Result = ResultFailed
+		r.Error = err.Error()
+	}
+}
+
+// Writer sends records to an audit log file, syslog or both
+type Writer struct {
+	Path   string // JSON Lines file (empty = none)
+	Syslog bool   // Also send each record to the local syslog
+}
+
+// Enabled reports whether the writer sends records anywhere
+func (w Writer) Enabled() bool {
+	return w.Path != "" || w.Syslog
+}
+
+// Write sends record to every destination of the writer. A failing
+// destination does not keep the record from the others.
+func (w Writer) Write(record Record) error {
+	var errs []error
+	if w.Path != "" {
+		if err := Append(w.Path, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if w.Syslog {
+		if err := sendSyslog(record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Append writes record as one line at the end of the log at path, creating
+// it if needed. A single write to a file opened for appending keeps
+// concurrent writers from interleaving their lines.
+func Append(path string, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, FilePermission)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %v", path, err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write audit log %s: %v", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync audit log %s: %v", path, err)
+	}
+	return file.Close()
+}
+
+// CheckWritable reports an error if the log at path cannot be appended to,
+// so an operation that must be audited can be refused before it starts
+func CheckWritable(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, FilePermission)
+	if err != nil {
+		return fmt.Errorf("audit log %s is not writable: %v", path, err)
+	}
+	return file.Close()
+}
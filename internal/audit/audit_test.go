@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	denied := NewRecord("restore")
+	denied.Archive = "backup.tar.gz"
+	denied.Result = ResultDenied
+	denied.Error = "not approved"
+	if err := Append(path, denied); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	failed := NewRecord("restore")
+	failed.Finish(errors.New("disk full"))
+	if err := Append(path, failed); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	ok := NewRecord("restore")
+	ok.Finish(nil)
+	if err := Append(path, ok); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line %q is not a record: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Got %d records, want 3", len(records))
+	}
+	if records[0].Result != ResultDenied || records[0].Archive != "backup.tar.gz" || records[0].Host == "" || records[0].Time.IsZero() {
+		t.Errorf("Unexpected denied record %+v", records[0])
+	}
+	if records[1].Result != ResultFailed || records[1].Error != "disk full" {
+		t.Errorf("Unexpected failed record %+v", records[1])
+	}
+	if records[2].Result != ResultOK || records[2].Error != "" {
+		t.Errorf("Unexpected ok record %+v", records[2])
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0007 != 0 {
+		t.Errorf("Audit log is readable by others: %v", info.Mode())
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckWritable(filepath.Join(dir, "audit.jsonl")); err != nil {
+		t.Errorf("CheckWritable failed: %v", err)
+	}
+	if err := CheckWritable(filepath.Join(dir, "missing", "audit.jsonl")); err == nil {
+		t.Error("Expected an error for a log in a missing directory")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	if (Writer{}).Enabled() {
+		t.Error("A writer without destinations should be disabled")
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writer := Writer{Path: path}
+	record := NewRecord("gc")
+	record.Result = ResultStarted
+	if err := writer.Write(record); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Record
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Operation != "gc" || got.PID != os.Getpid() {
+		t.Errorf("Unexpected record %+v", got)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package audit
+
+import "fmt"
+
+// sendSyslog fails: there is no local syslog on this platform
+func sendSyslog(record Record) error {
+	return fmt.Errorf("syslog is not supported on this platform")
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// syslogTag identifies audit records among the other syslog messages
+const syslogTag = "archiveFiles-audit"
+
+// sendSyslog sends record as JSON to the local syslog, with the authpriv
+// facility that syslog daemons keep for security messages
+func sendSyslog(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %v", err)
+	}
+	writer, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, syslogTag)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	defer writer.Close()
+	if err := writer.Notice(string(line)); err != nil {
+		return fmt.Errorf("failed to write audit record to syslog: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// rocksDBExclude holds the glob patterns of RocksDB files left out of
+// backups; empty keeps every file
+var rocksDBExclude atomic.Pointer[[]string]
+
+// SetRocksDBExclusions sets the comma-separated glob patterns of files in a
+// RocksDB directory that are not needed to open the database and are left
+// out of backups. An empty string keeps all files.
+func SetRocksDBExclusions(patterns string) {
+	var list []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			list = append(list, pattern)
+		}
+	}
+	rocksDBExclude.Store(&list)
+}
+
+// isCriticalRocksDBFile reports whether a RocksDB needs name to open, so no
+// pattern may exclude it
+func isCriticalRocksDBFile(name string) bool {
+	return name == "CURRENT" || name == "IDENTITY" ||
+		strings.HasPrefix(name, "MANIFEST-") ||
+		strings.HasSuffix(name, ".sst") ||
+		strings.HasSuffix(name, ".log") ||
+		strings.HasSuffix(name, ".blob")
+}
+
+// rocksDBArtifactFilter returns a function reporting whether a top-level
+// file of the database at dbPath is an excluded artifact. The newest
+// OPTIONS file is always kept; when it cannot be told, all of them are.
+func rocksDBArtifactFilter(dbPath string) func(name string) bool {
+	patterns := rocksDBExclude.Load()
+	if patterns == nil || len(*patterns) == 0 {
+		return func(string) bool { return false }
+	}
+
+	latestOptions, err := latestOptionsFile(dbPath)
+	if err != nil {
+		log.Warning("Could not find the OPTIONS file of %s, keeping all of them: %v", dbPath, err)
+	}
+	keepOptions := func(name string) bool {
+		if latestOptions == "" {
+			return strings.HasPrefix(name, "OPTIONS-")
+		}
+		return name == filepath.Base(latestOptions)
+	}
+
+	return func(name string) bool {
+		if keepOptions(name) || isCriticalRocksDBFile(name) {
+			return false
+		}
+		for _, pattern := range *patterns {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// pruneRocksDBArtifacts removes excluded artifacts from a RocksDB backup
+// directory, such as one created by the checkpoint API
+func pruneRocksDBArtifacts(dbPath string) error {
+	excluded := rocksDBArtifactFilter(dbPath)
+	entries, err := os.ReadDir(dbPath)
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !excluded(entry.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dbPath, entry.Name())); err != nil {
+			return err
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Debug("Removed %d unneeded RocksDB file(s) from %s", removed, dbPath)
+	}
+	return nil
+}
@@ -2,66 +2,122 @@ package backup
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"archiveFiles/internal/apperr"
 	"archiveFiles/internal/constants"
 	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/logger"
 	"archiveFiles/internal/progress"
 	"archiveFiles/internal/types"
 	"archiveFiles/internal/utils"
 )
 
+// log is the logger of the backup module (log_levels key "backup")
+var log = logger.NewModule("backup")
+
+// Result describes what a backup captured beyond the copied files
+type Result struct {
+	SequenceNumber uint64   // RocksDB sequence number a copy or export represents; 0 for other methods
+	Warnings       []string // Problems the backup completed despite, e.g. a skipped attachment
+	Method         string   // Step that produced the copy: a RocksDB method or one of the Step* values
+	Fallbacks      []string // Steps that failed before Method was used, with their errors
+}
+
 // SafeBackupDatabase performs a safe backup of a database, handling locked databases appropriately
-func SafeBackupDatabase(sourceInfo types.DatabaseInfo, targetPath string, method string, progressTracker *progress.ProgressTracker) error {
+func SafeBackupDatabase(sourceInfo types.DatabaseInfo, targetPath string, method string, progressTracker *progress.ProgressTracker) (Result, error) {
+	// Encrypted databases cannot be opened without their key
+	if sourceInfo.Encrypted {
+		return backupEncrypted(sourceInfo, targetPath, progressTracker)
+	}
+
 	// Check if database is locked
 	lockInfo, err := discovery.CheckDatabaseLock(sourceInfo.Path, sourceInfo.Type)
 	if err != nil {
-		log.Printf("Warning: Could not check database lock status for %s: %v", sourceInfo.Path, err)
+		log.Warning("Could not check database lock status for %s: %v", sourceInfo.Path, err)
 		// Continue with normal backup if we can't check lock status
 	}
 
 	if lockInfo != nil && lockInfo.IsLocked {
-		log.Printf("Warning: Database %s is locked (%s: %s)", sourceInfo.Path, lockInfo.LockType, lockInfo.ProcessInfo)
+		log.Warning("Database %s is locked (%s: %s)", sourceInfo.Path, lockInfo.LockType, lockInfo.ProcessInfo)
 
 		// For locked databases, we need to use safe methods
 		switch sourceInfo.Type {
 		case types.DatabaseTypeRocksDB:
-			return safeBackupLockedRocksDB(sourceInfo.Path, targetPath, progressTracker)
+			return safeBackupLockedRocksDB(sourceInfo.Path, targetPath, method, progressTracker)
 		case types.DatabaseTypeSQLite:
-			return safeBackupLockedSQLite(sourceInfo.Path, targetPath, progressTracker)
+			result, err := safeBackupLockedSQLite(sourceInfo.Path, targetPath, progressTracker)
+			if err != nil {
+				return Result{}, err
+			}
+			result.Warnings, err = backupSQLiteAttachments(sourceInfo, targetPath, progressTracker)
+			return result, err
 		default:
-			return fmt.Errorf("cannot safely backup locked file: %s (%s)", sourceInfo.Path, lockInfo.ProcessInfo)
+			return Result{}, apperr.New(apperr.ErrLocked, "cannot safely backup locked file: %s (%s)", sourceInfo.Path, lockInfo.ProcessInfo)
 		}
 	}
 
 	// Database is not locked, proceed with normal backup
 	switch sourceInfo.Type {
 	case types.DatabaseTypeRocksDB:
-		return ProcessRocksDB(sourceInfo.Path, targetPath, method, progressTracker)
+		result, err := ProcessRocksDB(sourceInfo.Path, targetPath, method, progressTracker)
+		if result.Method == "" {
+			result.Method = method
+		}
+		return result, err
 	case types.DatabaseTypeSQLite:
-		return ProcessSQLiteDB(sourceInfo.Path, targetPath)
+		if err := ProcessSQLiteDB(sourceInfo.Path, targetPath); err != nil {
+			return Result{}, err
+		}
+		warnings, err := backupSQLiteAttachments(sourceInfo, targetPath, progressTracker)
+		return Result{Warnings: warnings, Method: StepFileCopy}, err
 	case types.DatabaseTypeLogFile:
-		return ProcessLogFile(sourceInfo.Path, targetPath)
+		return Result{Method: StepFileCopy}, ProcessLogFile(sourceInfo.Path, targetPath)
+	case types.DatabaseTypeGenericFile:
+		return Result{Method: StepFileCopy}, ProcessGenericFile(sourceInfo.Path, targetPath)
 	default:
-		return fmt.Errorf("unknown database type: %s", sourceInfo.Path)
+		return Result{}, fmt.Errorf("unknown database type: %s", sourceInfo.Path)
 	}
 }
 
 // ProcessRocksDB processes a RocksDB database using the specified method
-func ProcessRocksDB(sourceDBPath, targetDBPath, method string, progressTracker *progress.ProgressTracker) error {
+func ProcessRocksDB(sourceDBPath, targetDBPath, method string, progressTracker *progress.ProgressTracker) (Result, error) {
 	switch method {
 	case "backup":
+		if rate := rocksDBBackupRate.Load(); rate > 0 {
+			log.Info("Copying the files of %s at %s/s instead of running the backup engine, which cannot be rate-limited", sourceDBPath, utils.FormatBytes(rate))
+			return Result{Method: constants.MethodCopyFiles}, backupRocksDBFiles(sourceDBPath, targetDBPath, utils.NewThrottle(rate), progressTracker)
+		}
 		return BackupRocksDB(sourceDBPath, targetDBPath, progressTracker)
 	case "checkpoint":
-		return CheckpointRocksDB(sourceDBPath, targetDBPath, progressTracker)
+		return Result{}, CheckpointRocksDB(sourceDBPath, targetDBPath, progressTracker)
 	case "copy":
-		return CopyDatabaseData(sourceDBPath, targetDBPath, progressTracker)
+		sequence, err := CopyDatabaseData(sourceDBPath, targetDBPath, progressTracker)
+		return Result{SequenceNumber: sequence}, err
 	case "copy-files":
-		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
+		return Result{}, BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
+	default:
+		return Result{}, apperr.New(apperr.ErrUnsupportedMethod, "unknown method: %s. Available methods: backup, checkpoint, copy, copy-files", method)
+	}
+}
+
+// backupEncrypted copies the files of an encrypted database as they are,
+// whatever the method: the database APIs need the key to read it
+func backupEncrypted(sourceInfo types.DatabaseInfo, targetPath string, progressTracker *progress.ProgressTracker) (Result, error) {
+	log.Info("%s is encrypted at rest, copying its files", sourceInfo.Path)
+	switch sourceInfo.Type {
+	case types.DatabaseTypeRocksDB:
+		return Result{Method: constants.MethodCopyFiles}, BackupRocksDBFiles(sourceInfo.Path, targetPath, progressTracker)
+	case types.DatabaseTypeSQLite:
+		if err := ProcessSQLiteDB(sourceInfo.Path, targetPath); err != nil {
+			return Result{}, err
+		}
+		warnings, err := backupSQLiteAttachments(sourceInfo, targetPath, progressTracker)
+		return Result{Warnings: warnings, Method: StepFileCopy}, err
 	default:
-		return fmt.Errorf("unknown method: %s. Available methods: backup, checkpoint, copy, copy-files", method)
+		return Result{}, fmt.Errorf("unknown encrypted database type: %s", sourceInfo.Path)
 	}
 }
 
@@ -74,7 +130,54 @@ func ProcessSQLiteDB(sourceDBPath, targetPath string) error {
 
 	// Copy SQLite file
 	targetFile := filepath.Join(targetPath, filepath.Base(sourceDBPath))
-	return CopySQLiteDatabase(sourceDBPath, targetFile)
+	if err := CopySQLiteDatabase(sourceDBPath, targetFile); err != nil {
+		return err
+	}
+
+	// A file-level copy is only usable together with its -wal/-shm/-journal
+	// companions, so copy whichever are present alongside it
+	for _, suffix := range constants.SQLiteCompanionSuffixes {
+		companion := sourceDBPath + suffix
+		if _, err := os.Stat(companion); err != nil {
+			continue
+		}
+		if err := utils.CopyFile(companion, targetFile+suffix); err != nil {
+			return fmt.Errorf("failed to copy SQLite companion file %s: %v", companion, err)
+		}
+	}
+	return nil
+}
+
+// backupSQLiteAttachments backs up the ATTACHed databases of a SQLite
+// database into the same target directory, so the unit restores together.
+// It returns a warning for each attachment that could not be read.
+func backupSQLiteAttachments(sourceInfo types.DatabaseInfo, targetPath string, progressTracker *progress.ProgressTracker) ([]string, error) {
+	var warnings []string
+	mainName := filepath.Base(sourceInfo.Path)
+	for _, attachment := range sourceInfo.Attachments {
+		if filepath.Base(attachment) == mainName {
+			return warnings, fmt.Errorf("attached database %s has the same file name as %s", attachment, sourceInfo.Path)
+		}
+		if _, err := os.Stat(attachment); err != nil {
+			log.Warning("Attached database %s of %s is not accessible: %v", attachment, sourceInfo.Path, err)
+			warnings = append(warnings, fmt.Sprintf("attached database %s was left out: %v", attachment, err))
+			continue
+		}
+
+		lockInfo, err := discovery.CheckDatabaseLock(attachment, types.DatabaseTypeSQLite)
+		if err != nil {
+			log.Warning("Could not check database lock status for %s: %v", attachment, err)
+		}
+		if lockInfo != nil && lockInfo.IsLocked {
+			_, err = safeBackupLockedSQLite(attachment, targetPath, progressTracker)
+		} else {
+			err = ProcessSQLiteDB(attachment, targetPath)
+		}
+		if err != nil {
+			return warnings, fmt.Errorf("failed to back up attached database %s: %v", attachment, err)
+		}
+	}
+	return warnings, nil
 }
 
 // ProcessLogFile processes a log file by copying it to the target path
@@ -89,6 +192,17 @@ func ProcessLogFile(sourceLogPath, targetPath string) error {
 	return utils.CopyFile(sourceLogPath, targetFile)
 }
 
+// ProcessGenericFile copies an opaque data file to the target path unchanged
+func ProcessGenericFile(sourcePath, targetPath string) error {
+	// Create target directory
+	if err := os.MkdirAll(targetPath, constants.DirPermission); err != nil {
+		return fmt.Errorf("failed to create target directory: %v", err)
+	}
+
+	targetFile := filepath.Join(targetPath, filepath.Base(sourcePath))
+	return utils.CopyFile(sourcePath, targetFile)
+}
+
 // CopySQLiteDatabase copies a SQLite database file using simple file copy
 // For locked databases, use SafeCopySQLiteDatabase instead
 func CopySQLiteDatabase(sourcePath, targetPath string) error {
@@ -96,68 +210,102 @@ func CopySQLiteDatabase(sourcePath, targetPath string) error {
 }
 
 // safeBackupLockedRocksDB performs a safe backup of a locked RocksDB
-func safeBackupLockedRocksDB(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) error {
-	log.Printf("Attempting safe backup of locked RocksDB: %s", sourceDBPath)
+func safeBackupLockedRocksDB(sourceDBPath, targetDBPath, method string, progressTracker *progress.ProgressTracker) (Result, error) {
+	log.Info("Attempting safe backup of locked RocksDB: %s", sourceDBPath)
 	progressTracker.SetCurrentFile(fmt.Sprintf("Safe backup of locked RocksDB: %s", sourceDBPath))
 
+	// The copy method follows the live database as a secondary instance
+	var fallbacks []string
+	if method == constants.MethodCopy {
+		sequence, err := CopyLiveDatabaseData(sourceDBPath, targetDBPath, progressTracker)
+		if err == nil {
+			return Result{SequenceNumber: sequence, Method: constants.MethodCopy}, nil
+		}
+		log.Info("Secondary instance copy failed for locked RocksDB, trying checkpoint: %v", err)
+		fallbacks = append(fallbacks, fmt.Sprintf("%s: %v", constants.MethodCopy, err))
+		if err := os.RemoveAll(targetDBPath); err != nil {
+			return Result{}, fmt.Errorf("failed to remove partial copy %s: %v", targetDBPath, err)
+		}
+	}
+
 	// For locked RocksDB, we try checkpoint method first, then backup engine
 	err := safeBackupUsingCheckpoint(sourceDBPath, targetDBPath, progressTracker)
 	if err != nil {
-		log.Printf("Checkpoint method failed for locked RocksDB, trying backup engine: %v", err)
-		return safeBackupUsingBackupEngine(sourceDBPath, targetDBPath, progressTracker)
+		log.Info("Checkpoint method failed for locked RocksDB, trying backup engine: %v", err)
+		fallbacks = append(fallbacks, fmt.Sprintf("%s: %v", constants.MethodCheckpoint, err))
+		result, err := safeBackupUsingBackupEngine(sourceDBPath, targetDBPath, progressTracker)
+		result.Method, result.Fallbacks = constants.MethodBackup, fallbacks
+		return result, err
 	}
 
-	return nil
+	return Result{Method: constants.MethodCheckpoint, Fallbacks: fallbacks}, nil
 }
 
 // safeBackupUsingCheckpoint uses checkpoint API for locked databases
 func safeBackupUsingCheckpoint(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) error {
-	log.Printf("Using checkpoint method for locked RocksDB: %s", sourceDBPath)
+	log.Info("Using checkpoint method for locked RocksDB: %s", sourceDBPath)
 	progressTracker.SetCurrentFile(fmt.Sprintf("Creating checkpoint for locked RocksDB: %s", sourceDBPath))
 
 	// Use the checkpoint functionality from rocksdb package
 	err := CheckpointRocksDB(sourceDBPath, targetDBPath, progressTracker)
 	if err != nil {
-		return fmt.Errorf("checkpoint creation failed for locked RocksDB: %v", err)
+		return lockError(err, "checkpoint creation failed for locked RocksDB")
 	}
 
-	log.Printf("Successfully created checkpoint backup of locked RocksDB")
+	log.Info("Successfully created checkpoint backup of locked RocksDB")
 	return nil
 }
 
 // safeBackupUsingBackupEngine uses backup engine for locked databases
-func safeBackupUsingBackupEngine(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) error {
-	log.Printf("Using backup engine for locked RocksDB: %s", sourceDBPath)
+func safeBackupUsingBackupEngine(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) (Result, error) {
+	// The engine runs at full speed, and the rate-limited file copy would
+	// be unusable while the database is open
+	if rocksDBBackupRate.Load() > 0 {
+		return Result{}, apperr.New(apperr.ErrLocked, "the backup engine cannot be rate-limited and the files of %s cannot be copied while it is open; not running the engine at full speed", sourceDBPath)
+	}
+
+	log.Info("Using backup engine for locked RocksDB: %s", sourceDBPath)
 	progressTracker.SetCurrentFile(fmt.Sprintf("Creating backup engine backup for locked RocksDB: %s", sourceDBPath))
 
 	// Use the backup engine functionality from rocksdb package
-	err := BackupRocksDB(sourceDBPath, targetDBPath, progressTracker)
+	result, err := BackupRocksDB(sourceDBPath, targetDBPath, progressTracker)
 	if err != nil {
-		return fmt.Errorf("backup engine failed for locked RocksDB: %v", err)
+		return Result{}, lockError(err, "backup engine failed for locked RocksDB")
 	}
 
-	log.Printf("Successfully created backup engine backup of locked RocksDB")
-	return nil
+	log.Info("Successfully created backup engine backup of locked RocksDB")
+	return result, nil
+}
+
+// lockError gives a failed backup of a locked RocksDB the ErrLocked kind
+// only when RocksDB reports its LOCK file as held; other failures, such as a
+// full destination, are not solved by releasing the lock
+func lockError(err error, msg string) error {
+	status := err.Error()
+	if strings.Contains(status, "lock file") || strings.Contains(status, "lock hold") {
+		return apperr.Wrap(apperr.ErrLocked, err, msg)
+	}
+	return fmt.Errorf("%s: %v", msg, err)
 }
 
 // safeBackupLockedSQLite performs a safe backup of a locked SQLite database
-func safeBackupLockedSQLite(sourceDBPath, targetPath string, progressTracker *progress.ProgressTracker) error {
-	log.Printf("Attempting safe backup of locked SQLite: %s", sourceDBPath)
+func safeBackupLockedSQLite(sourceDBPath, targetPath string, progressTracker *progress.ProgressTracker) (Result, error) {
+	log.Info("Attempting safe backup of locked SQLite: %s", sourceDBPath)
 	progressTracker.SetCurrentFile(fmt.Sprintf("Safe backup of locked SQLite: %s", sourceDBPath))
 
 	// Create target directory
 	if err := os.MkdirAll(targetPath, constants.DirPermission); err != nil {
-		return fmt.Errorf("failed to create target directory: %v", err)
+		return Result{}, fmt.Errorf("failed to create target directory: %v", err)
 	}
 
 	targetFile := filepath.Join(targetPath, filepath.Base(sourceDBPath))
 
 	// Use SQLite's online backup API which is safe for live databases
-	err := SafeCopySQLiteDatabase(sourceDBPath, targetFile)
+	result, err := safeCopySQLite(sourceDBPath, targetFile)
 	if err != nil {
-		return fmt.Errorf("safe SQLite backup failed: %v", err)
+		return Result{}, fmt.Errorf("safe SQLite backup failed: %v", err)
 	}
 
-	log.Printf("Successfully created safe backup of locked SQLite")
-	return nil
+	log.Info("Successfully created safe backup of locked SQLite")
+	return result, nil
 }
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+)
+
+func TestSafeBackupDatabase_GenericFile(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "snapshot.pb")
+	content := []byte("\x0a\x05hello\x12\x03abc")
+	if err := os.WriteFile(sourcePath, content, 0600); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	dbInfo := types.DatabaseInfo{
+		Path: sourcePath,
+		Type: types.DatabaseTypeGenericFile,
+		Name: "snapshot.pb",
+	}
+	targetPath := filepath.Join(tempDir, "backup", "snapshot.pb")
+
+	_, err := SafeBackupDatabase(dbInfo, targetPath, "checkpoint", progress.NewProgressTracker(false))
+	if err != nil {
+		t.Fatalf("SafeBackupDatabase failed: %v", err)
+	}
+
+	copied, err := os.ReadFile(filepath.Join(targetPath, "snapshot.pb"))
+	if err != nil {
+		t.Fatalf("Failed to read copied file: %v", err)
+	}
+	if string(copied) != string(content) {
+		t.Errorf("Copied content mismatch: got %q, want %q", copied, content)
+	}
+
+	info, err := os.Stat(filepath.Join(targetPath, "snapshot.pb"))
+	if err != nil {
+		t.Fatalf("Failed to stat copied file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600 to be preserved, got %v", info.Mode().Perm())
+	}
+}
+
+func TestProcessRocksDB_UnknownMethod(t *testing.T) {
+	tempDir := t.TempDir()
+	_, err := ProcessRocksDB(filepath.Join(tempDir, "db"), filepath.Join(tempDir, "backup"), "snapshot", progress.NewProgressTracker(false))
+	if !errors.Is(err, apperr.ErrUnsupportedMethod) {
+		t.Errorf("Expected ErrUnsupportedMethod, got: %v", err)
+	}
+	if apperr.Hint(err) == "" {
+		t.Error("Expected a hint for an unknown method")
+	}
+}
+
+func TestLockError(t *testing.T) {
+	held := errors.New("IO error: While lock file: /data/db/LOCK: Resource temporarily unavailable")
+	if err := lockError(held, "checkpoint failed"); !errors.Is(err, apperr.ErrLocked) || !errors.Is(err, held) {
+		t.Errorf("lockError(%v) = %v, want ErrLocked wrapping the cause", held, err)
+	}
+	full := errors.New("IO error: No space left on device")
+	if err := lockError(full, "checkpoint failed"); errors.Is(err, apperr.ErrLocked) {
+		t.Errorf("lockError(%v) = %v, want an error without the ErrLocked kind", full, err)
+	}
+}
+
+func TestPlanBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "app.log")
+	if err := os.WriteFile(logPath, []byte("log line\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	plan, err := PlanBackup(types.DatabaseInfo{Path: logPath, Type: types.DatabaseTypeLogFile}, "checkpoint")
+	if err != nil {
+		t.Fatalf("PlanBackup failed: %v", err)
+	}
+	if plan.Method != StepFileCopy || plan.Fallback != "" {
+		t.Errorf("PlanBackup() = %+v, want a plain file copy", plan)
+	}
+
+	rocksDB := types.DatabaseInfo{Path: filepath.Join(tempDir, "db"), Type: types.DatabaseTypeRocksDB}
+	if _, err := PlanBackup(rocksDB, "snapshot"); !errors.Is(err, apperr.ErrUnsupportedMethod) {
+		t.Errorf("Expected ErrUnsupportedMethod, got: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/constants"
+)
+
+// ExternalDir is a directory outside the database directory that was copied
+// into the database's backup
+type ExternalDir struct {
+	SourcePath string // Directory on the source host
+	BackupPath string // Where it was copied to
+}
+
+// ReadDBPaths returns the directories a RocksDB database places SST files in
+// besides its own directory: db_paths of the newest OPTIONS file and the
+// cf_paths of every column family, in order of appearance
+func ReadDBPaths(dbPath string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{}
+	err := scanOptions(dbPath, func(section, key, value string) {
+		isDBPaths := section == "[DBOptions]" && key == "db_paths"
+		isCFPaths := strings.HasPrefix(section, "[CFOptions") && key == "cf_paths"
+		if !isDBPaths && !isCFPaths {
+			return
+		}
+		for _, path := range parsePathList(value) {
+			if samePath(path, dbPath) || seen[filepath.Clean(path)] {
+				continue
+			}
+			seen[filepath.Clean(path)] = true
+			paths = append(paths, path)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// parsePathList extracts the directories of a db_paths or cf_paths value.
+// RocksDB writes entries as {path=/ssd;target_size=1000}; the "/ssd:1000"
+// form of the command line tools is accepted as well.
+func parsePathList(value string) []string {
+	var paths []string
+	if strings.Contains(value, "path=") {
+		fields := strings.FieldsFunc(value, func(r rune) bool { return r == '{' || r == '}' || r == ';' })
+		for _, field := range fields {
+			if path, ok := strings.CutPrefix(strings.TrimSpace(field), "path="); ok {
+				if path = strings.Trim(path, "\""); path != "" {
+					paths = append(paths, path)
+				}
+			}
+		}
+		return paths
+	}
+
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		entry = strings.TrimSpace(entry)
+		if i := strings.LastIndex(entry, ":"); i > 0 {
+			if _, err := strconv.ParseUint(entry[i+1:], 10, 64); err == nil {
+				entry = entry[:i]
+			}
+		}
+		if entry = strings.Trim(entry, "\""); entry != "" {
+			paths = append(paths, entry)
+		}
+	}
+	return paths
+}
+
+// BackupExternalDBPaths copies the db_paths and cf_paths directories of a
+// RocksDB database into <backup>/db_paths/<n>, so data placed on other
+// devices is part of the backup. SST files the backup method already put in
+// the target directory (a checkpoint gathers them there) are not copied again.
+func BackupExternalDBPaths(sourceDBPath, targetDBPath string) ([]ExternalDir, error) {
+	dbPaths, err := ReadDBPaths(sourceDBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	alreadyCopied := func(relPath string) bool {
+		if filepath.Dir(relPath) != "." {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(targetDBPath, relPath))
+		return err == nil
+	}
+
+	var copied []ExternalDir
+	for _, dbPath := range dbPaths {
+		if _, err := os.Stat(dbPath); err != nil {
+			log.Warning("db_path %s configured for %s is not accessible: %v", dbPath, sourceDBPath, err)
+			continue
+		}
+
+		targetPath := filepath.Join(targetDBPath, constants.DBPathsBackupDirName, strconv.Itoa(len(copied)))
+		if err := copyTree(dbPath, targetPath, alreadyCopied); err != nil {
+			return nil, fmt.Errorf("failed to copy db_path %s: %v", dbPath, err)
+		}
+
+		log.Info("Copied db_path %s to %s", dbPath, targetPath)
+		copied = append(copied, ExternalDir{SourcePath: dbPath, BackupPath: targetPath})
+	}
+	return copied, nil
+}
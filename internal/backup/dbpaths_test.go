@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+func TestParsePathList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"{{path=/ssd;target_size=1000}:{path=/hdd;target_size=0}}", []string{"/ssd", "/hdd"}},
+		{"{path=\"/data/ssd\";target_size=1}", []string{"/data/ssd"}},
+		{"/ssd:1000,/hdd:0", []string{"/ssd", "/hdd"}},
+		{"/data/only", []string{"/data/only"}},
+	}
+	for _, tt := range tests {
+		if got := parsePathList(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePathList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReadDBPaths(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "[DBOptions]\n  db_paths={{path=" + dbPath + ";target_size=100}:{path=/hdd;target_size=0}}\n\n" +
+		"[CFOptions \"default\"]\n  cf_paths=\n\n[CFOptions \"cold\"]\n  cf_paths={{path=/archive;target_size=0}:{path=/hdd;target_size=0}}\n"
+	if err := os.WriteFile(filepath.Join(dbPath, "OPTIONS-000003"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := ReadDBPaths(dbPath)
+	if err != nil {
+		t.Fatalf("ReadDBPaths failed: %v", err)
+	}
+	if want := []string{"/hdd", "/archive"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("ReadDBPaths() = %q, want %q", paths, want)
+	}
+}
+
+func TestBackupExternalDBPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "db")
+	hddPath := filepath.Join(tempDir, "hdd")
+	for _, dir := range []string{dbPath, hddPath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := "[DBOptions]\n  db_paths={{path=" + dbPath + ";target_size=100}:{path=" + hddPath + ";target_size=0}}\n"
+	if err := os.WriteFile(filepath.Join(dbPath, "OPTIONS-000003"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"000020.sst", "000021.sst"} {
+		if err := os.WriteFile(filepath.Join(hddPath, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A checkpoint already gathered 000020.sst into the backup
+	targetDBPath := filepath.Join(tempDir, "backup", "db")
+	if err := os.MkdirAll(targetDBPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDBPath, "000020.sst"), []byte("000020.sst"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := BackupExternalDBPaths(dbPath, targetDBPath)
+	if err != nil {
+		t.Fatalf("BackupExternalDBPaths failed: %v", err)
+	}
+	want := []ExternalDir{{SourcePath: hddPath, BackupPath: filepath.Join(targetDBPath, constants.DBPathsBackupDirName, "0")}}
+	if !reflect.DeepEqual(copied, want) {
+		t.Fatalf("BackupExternalDBPaths() = %+v, want %+v", copied, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(want[0].BackupPath, "000021.sst")); err != nil {
+		t.Errorf("000021.sst was not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(want[0].BackupPath, "000020.sst")); !os.IsNotExist(err) {
+		t.Errorf("000020.sst should not be copied twice, stat error: %v", err)
+	}
+}
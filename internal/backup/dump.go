@@ -0,0 +1,407 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode"
+	"unicode/utf8"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/progress"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+// csvHeader is the first row of a csv export. An empty encoding column means
+// the key or value is plain text.
+var csvHeader = []string{"key", "key_encoding", "value", "value_encoding"}
+
+// jsonRecord is one line of a jsonl export
+type jsonRecord struct {
+	Key           string `json:"key"`
+	KeyEncoding   string `json:"key_encoding,omitempty"` // Empty when the key is plain text
+	Value         string `json:"value"`
+	ValueEncoding string `json:"value_encoding,omitempty"` // Empty when the value is plain text
+}
+
+// recordWriter writes records of a text export
+type recordWriter interface {
+	WriteRecord(key, value []byte) error
+	Flush() error
+}
+
+// recordReader reads records of a text export, returning io.EOF at the end
+type recordReader interface {
+	ReadRecord() (key, value []byte, err error)
+}
+
+// isText reports whether data can be written as is: valid UTF-8 without
+// control characters other than tab and newline. Carriage returns are
+// excluded too because csv readers turn \r\n into \n.
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if r != '\t' && r != '\n' && unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeField returns data as text, or encoded with its encoding when binary
+func encodeField(data []byte, encoding string) (string, string) {
+	switch {
+	case isText(data):
+		return string(data), ""
+	case encoding == constants.RocksDBExportHex:
+		return hex.EncodeToString(data), encoding
+	default:
+		return base64.StdEncoding.EncodeToString(data), constants.RocksDBExportBase64
+	}
+}
+
+// decodeField reverses encodeField
+func decodeField(field, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(field), nil
+	case constants.RocksDBExportBase64:
+		return base64.StdEncoding.DecodeString(field)
+	case constants.RocksDBExportHex:
+		return hex.DecodeString(field)
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", encoding)
+	}
+}
+
+type jsonRecordWriter struct {
+	encoder  *json.Encoder
+	encoding string
+}
+
+func (w *jsonRecordWriter) WriteRecord(key, value []byte) error {
+	var record jsonRecord
+	record.Key, record.KeyEncoding = encodeField(key, w.encoding)
+	record.Value, record.ValueEncoding = encodeField(value, w.encoding)
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonRecordWriter) Flush() error { return nil }
+
+type csvRecordWriter struct {
+	writer   *csv.Writer
+	encoding string
+}
+
+func (w *csvRecordWriter) WriteRecord(key, value []byte) error {
+	keyField, keyEncoding := encodeField(key, w.encoding)
+	valueField, valueEncoding := encodeField(value, w.encoding)
+	return w.writer.Write([]string{keyField, keyEncoding, valueField, valueEncoding})
+}
+
+func (w *csvRecordWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// newRecordWriter returns a writer for a jsonl or csv export
+func newRecordWriter(format, encoding string, w io.Writer) (recordWriter, error) {
+	switch format {
+	case constants.RocksDBExportJSONL:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &jsonRecordWriter{encoder: encoder, encoding: encoding}, nil
+	case constants.RocksDBExportCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvRecordWriter{writer: writer, encoding: encoding}, nil
+	default:
+		return nil, fmt.Errorf("unknown text export format: %s", format)
+	}
+}
+
+type jsonRecordReader struct {
+	decoder *json.Decoder
+	line    int
+}
+
+func (r *jsonRecordReader) ReadRecord() ([]byte, []byte, error) {
+	var record jsonRecord
+	if err := r.decoder.Decode(&record); err != nil {
+		if err == io.EOF {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("record %d: %v", r.line+1, err)
+	}
+	r.line++
+	return decodeRecord(r.line, record.Key, record.KeyEncoding, record.Value, record.ValueEncoding)
+}
+
+type csvRecordReader struct {
+	reader *csv.Reader
+	line   int
+}
+
+func (r *csvRecordReader) ReadRecord() ([]byte, []byte, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("record %d: %v", r.line+1, err)
+	}
+	r.line++
+	return decodeRecord(r.line, row[0], row[1], row[2], row[3])
+}
+
+func decodeRecord(line int, key, keyEncoding, value, valueEncoding string) ([]byte, []byte, error) {
+	keyData, err := decodeField(key, keyEncoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("record %d: invalid key: %v", line, err)
+	}
+	valueData, err := decodeField(value, valueEncoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("record %d: invalid value: %v", line, err)
+	}
+	return keyData, valueData, nil
+}
+
+// newRecordReader returns a reader for a jsonl or csv export
+func newRecordReader(format string, r io.Reader) (recordReader, error) {
+	switch format {
+	case constants.RocksDBExportJSONL:
+		return &jsonRecordReader{decoder: json.NewDecoder(r)}, nil
+	case constants.RocksDBExportCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv header: %v", err)
+		}
+		for i, column := range csvHeader {
+			if header[i] != column {
+				return nil, fmt.Errorf("unexpected csv header: %v", header)
+			}
+		}
+		return &csvRecordReader{reader: reader}, nil
+	default:
+		return nil, fmt.Errorf("unknown text export format: %s", format)
+	}
+}
+
+// exportText writes the records of source into one jsonl or csv file in
+// targetDir and returns its metadata
+func exportText(source *pointInTime, targetDir, format, encoding string, progressTracker *progress.ProgressTracker) (*ExportMetadata, error) {
+	metadata := &ExportMetadata{
+		Version:        exportVersion,
+		Format:         format,
+		Encoding:       encoding,
+		SequenceNumber: source.sequence,
+		ColumnFamily:   "default",
+		Comparator:     "leveldb.BytewiseComparator",
+		Files:          []ExportFile{},
+	}
+	current := ExportFile{File: "data." + format}
+	dataPath := filepath.Join(targetDir, current.File)
+
+	file, err := os.OpenFile(dataPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, constants.FilePermission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", current.File, err)
+	}
+	defer file.Close()
+	buffered := bufio.NewWriter(file)
+	writer, err := newRecordWriter(format, encoding, buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := source.db.NewIterator(source.readOpts)
+	defer iter.Close()
+	for iter.SeekToFirst(); iter.Valid(); iter.Next() {
+		key := iter.Key()
+		value := iter.Value()
+		keyData := make([]byte, len(key.Data()))
+		valueData := make([]byte, len(value.Data()))
+		copy(keyData, key.Data())
+		copy(valueData, value.Data())
+		key.Free()
+		value.Free()
+
+		if err := writer.WriteRecord(keyData, valueData); err != nil {
+			return nil, fmt.Errorf("failed to write record to %s: %v", current.File, err)
+		}
+		if current.Entries == 0 {
+			current.SmallestKey = hex.EncodeToString(keyData)
+		}
+		current.LargestKey = hex.EncodeToString(keyData)
+		current.Entries++
+		metadata.Entries++
+		if metadata.Entries%constants.RocksDBProgressUpdateInterval == 0 {
+			progressTracker.UpdateRocksDBProgress(metadata.Entries, 0)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error during iteration: %v", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", current.File, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", current.File, err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %s: %v", current.File, err)
+	}
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", current.File, err)
+	}
+	current.Size = info.Size()
+	metadata.Files = append(metadata.Files, current)
+	return metadata, nil
+}
+
+// ReadExportMetadata reads the metadata of the export in exportDir
+func ReadExportMetadata(exportDir string) (*ExportMetadata, error) {
+	data, err := os.ReadFile(filepath.Join(exportDir, constants.RocksDBExportMetadataFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export metadata: %v", err)
+	}
+	var metadata ExportMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse export metadata: %v", err)
+	}
+	if metadata.Version > exportVersion {
+		return nil, fmt.Errorf("export metadata version %d is newer than supported version %d", metadata.Version, exportVersion)
+	}
+	switch metadata.Format {
+	case constants.RocksDBExportSST, constants.RocksDBExportJSONL, constants.RocksDBExportCSV:
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", metadata.Format)
+	}
+	for _, file := range metadata.Files {
+		if file.File != filepath.Base(file.File) {
+			return nil, fmt.Errorf("export file name %q is not in the export directory", file.File)
+		}
+	}
+	return &metadata, nil
+}
+
+// ImportRocksDB rebuilds a RocksDB database at targetPath from the export
+// in exportDir and returns the number of records imported. SST files are
+// ingested (copied, the export is left intact); jsonl and csv records are
+// written in batches. targetPath must not hold a database yet.
+func ImportRocksDB(exportDir, targetPath string) (int64, error) {
+	metadata, err := ReadExportMetadata(exportDir)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := grocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+	opts.SetCreateIfMissing(true)
+	opts.SetErrorIfExists(true)
+	db, err := grocksdb.OpenDb(opts, targetPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create target db: %v", err)
+	}
+	defer db.Close()
+
+	var count int64
+	if metadata.Format == constants.RocksDBExportSST {
+		count, err = ingestSST(db, exportDir, metadata)
+	} else {
+		count, err = importText(db, exportDir, metadata)
+	}
+	if err != nil {
+		return count, err
+	}
+	if count != metadata.Entries {
+		return count, fmt.Errorf("imported %d records, but the export metadata lists %d", count, metadata.Entries)
+	}
+	log.Info("Imported %d records from %s into %s", count, exportDir, targetPath)
+	return count, nil
+}
+
+// ingestSST ingests all SST files of an export in one call, which works
+// because their key ranges do not overlap
+func ingestSST(db *grocksdb.DB, exportDir string, metadata *ExportMetadata) (int64, error) {
+	if len(metadata.Files) == 0 {
+		return 0, nil
+	}
+	paths := make([]string, 0, len(metadata.Files))
+	var count int64
+	for _, file := range metadata.Files {
+		paths = append(paths, filepath.Join(exportDir, file.File))
+		count += file.Entries
+	}
+
+	ingestOpts := grocksdb.NewDefaultIngestExternalFileOptions()
+	defer ingestOpts.Destroy()
+	ingestOpts.SetMoveFiles(false)
+	if err := db.IngestExternalFile(paths, ingestOpts); err != nil {
+		return 0, fmt.Errorf("failed to ingest SST files: %v", err)
+	}
+	return count, nil
+}
+
+// importText writes the records of the jsonl or csv files of an export
+func importText(db *grocksdb.DB, exportDir string, metadata *ExportMetadata) (int64, error) {
+	writeBatch := grocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeOpts := grocksdb.NewDefaultWriteOptions()
+	defer writeOpts.Destroy()
+
+	var count int64
+	for _, exportFile := range metadata.Files {
+		file, err := os.Open(filepath.Join(exportDir, exportFile.File))
+		if err != nil {
+			return count, fmt.Errorf("failed to open %s: %v", exportFile.File, err)
+		}
+		reader, err := newRecordReader(metadata.Format, bufio.NewReader(file))
+		if err != nil {
+			file.Close()
+			return count, fmt.Errorf("%s: %v", exportFile.File, err)
+		}
+		for {
+			key, value, err := reader.ReadRecord()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return count, fmt.Errorf("%s: %v", exportFile.File, err)
+			}
+			writeBatch.Put(key, value)
+			count++
+			if count%constants.RocksDBWriteBatchSize == 0 {
+				if err := db.Write(writeOpts, writeBatch); err != nil {
+					file.Close()
+					return count, fmt.Errorf("failed to write batch: %v", err)
+				}
+				writeBatch.Clear()
+			}
+		}
+		file.Close()
+	}
+
+	if writeBatch.Count() > 0 {
+		if err := db.Write(writeOpts, writeBatch); err != nil {
+			return count, fmt.Errorf("failed to write final batch: %v", err)
+		}
+	}
+	return count, nil
+}
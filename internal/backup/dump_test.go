@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+func TestRecordWriter_RoundTrip(t *testing.T) {
+	records := [][2][]byte{
+		{[]byte("user:1"), []byte(`{"name": "a, \"b\"", "bio": "line1\nline2"}`)},
+		{[]byte{0x00, 0xff, 0x10}, []byte("plain")},
+		{[]byte("crlf"), []byte("a\r\nb")},
+		{[]byte("empty"), []byte{}},
+	}
+
+	for _, format := range []string{constants.RocksDBExportJSONL, constants.RocksDBExportCSV} {
+		for _, encoding := range []string{constants.RocksDBExportBase64, constants.RocksDBExportHex} {
+			t.Run(format+"/"+encoding, func(t *testing.T) {
+				var buf bytes.Buffer
+				writer, err := newRecordWriter(format, encoding, &buf)
+				if err != nil {
+					t.Fatalf("newRecordWriter failed: %v", err)
+				}
+				for _, record := range records {
+					if err := writer.WriteRecord(record[0], record[1]); err != nil {
+						t.Fatalf("WriteRecord failed: %v", err)
+					}
+				}
+				if err := writer.Flush(); err != nil {
+					t.Fatalf("Flush failed: %v", err)
+				}
+				if !strings.Contains(buf.String(), "user:1") {
+					t.Errorf("Text key was encoded:\n%s", buf.String())
+				}
+
+				reader, err := newRecordReader(format, &buf)
+				if err != nil {
+					t.Fatalf("newRecordReader failed: %v", err)
+				}
+				for i, record := range records {
+					key, value, err := reader.ReadRecord()
+					if err != nil {
+						t.Fatalf("ReadRecord %d failed: %v", i, err)
+					}
+					if !bytes.Equal(key, record[0]) || !bytes.Equal(value, record[1]) {
+						t.Errorf("Record %d = %q=%q, want %q=%q", i, key, value, record[0], record[1])
+					}
+				}
+				if _, _, err := reader.ReadRecord(); !errors.Is(err, io.EOF) {
+					t.Errorf("Expected io.EOF after the last record, got: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestRecordReader_InvalidEncoding(t *testing.T) {
+	input := "key,key_encoding,value,value_encoding\nk,,zz,hex\n"
+	reader, err := newRecordReader(constants.RocksDBExportCSV, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("newRecordReader failed: %v", err)
+	}
+	if _, _, err := reader.ReadRecord(); err == nil || !strings.Contains(err.Error(), "record 1: invalid value") {
+		t.Errorf("Expected an invalid value error, got: %v", err)
+	}
+}
+
+func TestReadExportMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", `{"version":1,"format":"jsonl","files":[{"file":"data.jsonl"}]}`, ""},
+		{"newer version", `{"version":2,"format":"sst"}`, "newer than supported"},
+		{"unknown format", `{"version":1,"format":"parquet"}`, "unknown export format"},
+		{"escaping file", `{"version":1,"format":"sst","files":[{"file":"../000001.sst"}]}`, "not in the export directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, constants.RocksDBExportMetadataFile), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadExportMetadata(dir)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("ReadExportMetadata failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+// exportVersion is the version of the export metadata format
+const exportVersion = 1
+
+// ExportMetadata describes an export. It is written next to the data files
+// so another cluster can ingest them with IngestExternalFile, or ImportRocksDB
+// can rebuild a database from them.
+type ExportMetadata struct {
+	Version        int          `json:"version"`
+	Format         string       `json:"format"`             // Export format: sst, jsonl or csv
+	Encoding       string       `json:"encoding,omitempty"` // Encoding of binary keys and values in jsonl and csv
+	SourcePath     string       `json:"source_path"`        // Database the data was exported from
+	SequenceNumber uint64       `json:"sequence_number"`    // Point in time the export represents
+	ColumnFamily   string       `json:"column_family"`      // Column family the data belongs to
+	Comparator     string       `json:"comparator"`         // Key order of the files
+	Entries        int64        `json:"entries"`            // Records across all files
+	Files          []ExportFile `json:"files"`              // In key order; key ranges do not overlap
+}
+
+// ExportFile describes one exported SST file
+type ExportFile struct {
+	File        string `json:"file"`         // Name relative to the export directory
+	SmallestKey string `json:"smallest_key"` // Hex encoded
+	LargestKey  string `json:"largest_key"`  // Hex encoded
+	Entries     int64  `json:"entries"`
+	Size        int64  `json:"size"` // Bytes on disk
+}
+
+// ExportRocksDB exports a RocksDB database into targetDir, plus metadata
+// describing the export. The sst format writes external SST files, each
+// holding a contiguous key range of about RocksDBExportFileSize bytes. The
+// jsonl and csv formats write one text file with binary keys and values in
+// encoding (base64 when empty). The data is read from a snapshot like the
+// copy method, following a live database as a secondary instance. Only the
+// default column family in bytewise key order is exported.
+func ExportRocksDB(sourceInfo types.DatabaseInfo, targetDir, format, encoding string, progressTracker *progress.ProgressTracker) (Result, error) {
+	if encoding == "" {
+		encoding = constants.RocksDBExportBase64
+	}
+	switch format {
+	case constants.RocksDBExportSST, constants.RocksDBExportJSONL, constants.RocksDBExportCSV:
+	default:
+		return Result{}, fmt.Errorf("unknown rocksdb export format: %s", format)
+	}
+	lockInfo, err := discovery.CheckDatabaseLock(sourceInfo.Path, sourceInfo.Type)
+	if err != nil {
+		log.Warning("Could not check database lock status for %s: %v", sourceInfo.Path, err)
+	}
+	live := lockInfo != nil && lockInfo.IsLocked
+
+	source, err := openPointInTime(sourceInfo.Path, live)
+	if err != nil {
+		return Result{}, err
+	}
+	defer source.Close()
+
+	if err := os.MkdirAll(targetDir, constants.DirPermission); err != nil {
+		return Result{}, fmt.Errorf("failed to create export directory: %v", err)
+	}
+	var metadata *ExportMetadata
+	if format == constants.RocksDBExportSST {
+		metadata, err = exportSST(source, targetDir, progressTracker)
+	} else {
+		metadata, err = exportText(source, targetDir, format, encoding, progressTracker)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	metadata.SourcePath = sourceInfo.Path
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode export metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, constants.RocksDBExportMetadataFile), data, constants.FilePermission); err != nil {
+		return Result{}, fmt.Errorf("failed to write export metadata: %v", err)
+	}
+
+	progressTracker.UpdateRocksDBProgress(metadata.Entries, metadata.Entries)
+	progressTracker.CompleteItem(utils.CalculateSize(targetDir))
+	log.Info("Exported %d records from %s into %d %s file(s) as of sequence number %d",
+		metadata.Entries, sourceInfo.Path, len(metadata.Files), format, source.sequence)
+	return Result{SequenceNumber: source.sequence, Method: ExportStep(format)}, nil
+}
+
+// exportSST writes the records of source into SST files in targetDir and
+// returns their metadata. A file is only started once it has a record:
+// RocksDB cannot create an empty SST file.
+func exportSST(source *pointInTime, targetDir string, progressTracker *progress.ProgressTracker) (*ExportMetadata, error) {
+	metadata := &ExportMetadata{
+		Version:        exportVersion,
+		Format:         constants.RocksDBExportSST,
+		SequenceNumber: source.sequence,
+		ColumnFamily:   "default",
+		Comparator:     "leveldb.BytewiseComparator",
+		Files:          []ExportFile{},
+	}
+
+	envOpts := grocksdb.NewDefaultEnvOptions()
+	defer envOpts.Destroy()
+	writerOpts := grocksdb.NewDefaultOptions()
+	defer writerOpts.Destroy()
+
+	var writer *grocksdb.SSTFileWriter
+	var current ExportFile
+	var fileBytes int64
+	defer func() {
+		if writer != nil {
+			writer.Destroy()
+		}
+	}()
+
+	finishFile := func() error {
+		if writer == nil {
+			return nil
+		}
+		err := writer.Finish()
+		writer.Destroy()
+		writer = nil
+		if err != nil {
+			return fmt.Errorf("failed to finish %s: %v", current.File, err)
+		}
+		info, err := os.Stat(filepath.Join(targetDir, current.File))
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %v", current.File, err)
+		}
+		current.Size = info.Size()
+		metadata.Files = append(metadata.Files, current)
+		return nil
+	}
+
+	iter := source.db.NewIterator(source.readOpts)
+	defer iter.Close()
+	for iter.SeekToFirst(); iter.Valid(); iter.Next() {
+		key := iter.Key()
+		value := iter.Value()
+		keyData := make([]byte, len(key.Data()))
+		valueData := make([]byte, len(value.Data()))
+		copy(keyData, key.Data())
+		copy(valueData, value.Data())
+		key.Free()
+		value.Free()
+
+		if writer == nil {
+			current = ExportFile{
+				File:        fmt.Sprintf("%06d.sst", len(metadata.Files)+1),
+				SmallestKey: hex.EncodeToString(keyData),
+			}
+			fileBytes = 0
+			writer = grocksdb.NewSSTFileWriter(envOpts, writerOpts)
+			if err := writer.Open(filepath.Join(targetDir, current.File)); err != nil {
+				return nil, fmt.Errorf("failed to create %s: %v", current.File, err)
+			}
+		}
+		if err := writer.Put(keyData, valueData); err != nil {
+			return nil, fmt.Errorf("failed to add record to %s: %v", current.File, err)
+		}
+		current.LargestKey = hex.EncodeToString(keyData)
+		current.Entries++
+		metadata.Entries++
+		fileBytes += int64(len(keyData) + len(valueData))
+
+		if fileBytes >= constants.RocksDBExportFileSize {
+			if err := finishFile(); err != nil {
+				return nil, err
+			}
+		}
+		if metadata.Entries%constants.RocksDBProgressUpdateInterval == 0 {
+			progressTracker.UpdateRocksDBProgress(metadata.Entries, 0)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error during iteration: %v", err)
+	}
+	if err := finishFile(); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
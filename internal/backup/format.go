@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/types"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMagic starts the header of every SQLite 3 database file
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// FormatInfo describes the on-disk format of a backed up database, so a
+// restore can tell whether the libraries on its host are new enough
+type FormatInfo struct {
+	RocksDBVersion string // RocksDB release that wrote the newest OPTIONS file
+	FormatVersion  int    // Highest block-based table format_version of any column family
+	PageSize       int    // SQLite page size in bytes
+	SchemaFormat   int    // SQLite schema format number (1-4)
+}
+
+// ReadFormatInfo reads the format of a RocksDB directory or SQLite file.
+// Other types have no format to record.
+func ReadFormatInfo(dbType types.DatabaseType, path string) (FormatInfo, error) {
+	switch dbType {
+	case types.DatabaseTypeRocksDB:
+		return readRocksDBFormat(path)
+	case types.DatabaseTypeSQLite:
+		return readSQLiteFormat(path)
+	default:
+		return FormatInfo{}, nil
+	}
+}
+
+// readRocksDBFormat reads rocksdb_version and format_version from the
+// newest OPTIONS file
+func readRocksDBFormat(dbPath string) (FormatInfo, error) {
+	var info FormatInfo
+	err := scanOptions(dbPath, func(section, key, value string) {
+		switch {
+		case section == "[Version]" && key == "rocksdb_version":
+			info.RocksDBVersion = value
+		case strings.HasPrefix(section, "[TableOptions/BlockBasedTable") && key == "format_version":
+			if version, err := strconv.Atoi(value); err == nil && version > info.FormatVersion {
+				info.FormatVersion = version
+			}
+		}
+	})
+	return info, err
+}
+
+// readSQLiteFormat reads the page size and schema format number from the
+// 100-byte database header
+func readSQLiteFormat(path string) (FormatInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FormatInfo{}, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 100)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return FormatInfo{}, fmt.Errorf("failed to read SQLite header of %s: %v", path, err)
+	}
+	if !bytes.HasPrefix(header, sqliteMagic) {
+		return FormatInfo{}, fmt.Errorf("%s is not a SQLite 3 database", path)
+	}
+
+	// A stored page size of 1 means 65536, which does not fit in 16 bits
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	return FormatInfo{
+		PageSize:     pageSize,
+		SchemaFormat: int(binary.BigEndian.Uint32(header[44:48])),
+	}, nil
+}
+
+// SQLiteLibraryVersion returns the version of the SQLite library linked into
+// this binary, which writes the SQLite copies of a backup
+func SQLiteLibraryVersion() string {
+	version, _, _ := sqlite3.Version()
+	return version
+}
@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/types"
+)
+
+func TestReadFormatInfo_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	createTestSQLiteDB(t, path)
+
+	info, err := ReadFormatInfo(types.DatabaseTypeSQLite, path)
+	if err != nil {
+		t.Fatalf("ReadFormatInfo failed: %v", err)
+	}
+	if info.PageSize < 512 || info.PageSize&(info.PageSize-1) != 0 {
+		t.Errorf("PageSize = %d, want a power of two of at least 512", info.PageSize)
+	}
+	if info.SchemaFormat < 1 || info.SchemaFormat > 4 {
+		t.Errorf("SchemaFormat = %d, want 1-4", info.SchemaFormat)
+	}
+
+	notSQLite := filepath.Join(t.TempDir(), "plain.db")
+	if err := os.WriteFile(notSQLite, make([]byte, 200), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFormatInfo(types.DatabaseTypeSQLite, notSQLite); err == nil {
+		t.Error("Expected an error for a file without SQLite header")
+	}
+}
+
+func TestReadFormatInfo_RocksDB(t *testing.T) {
+	dbPath := t.TempDir()
+	content := "[Version]\n  rocksdb_version=8.10.0\n  options_file_version=1.1\n\n" +
+		"[TableOptions/BlockBasedTable \"default\"]\n  format_version=5\n\n" +
+		"[TableOptions/BlockBasedTable \"cold\"]\n  format_version=6\n"
+	if err := os.WriteFile(filepath.Join(dbPath, "OPTIONS-000007"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ReadFormatInfo(types.DatabaseTypeRocksDB, dbPath)
+	if err != nil {
+		t.Fatalf("ReadFormatInfo failed: %v", err)
+	}
+	if info.RocksDBVersion != "8.10.0" || info.FormatVersion != 6 {
+		t.Errorf("ReadFormatInfo() = %+v, want version 8.10.0 and format_version 6", info)
+	}
+}
@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"fmt"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/discovery"
+	"archiveFiles/internal/types"
+)
+
+// Backup steps that are not RocksDB methods
+const (
+	StepFileCopy   = "file-copy"   // Plain copy of the file(s)
+	StepVacuumInto = "vacuum-into" // SQLite VACUUM INTO, safe while the database is in use
+	StepTableCopy  = "table-copy"  // SQLite table-by-table copy
+)
+
+// ExportStep is the backup step of a RocksDB export in format, e.g.
+// "sst-export"
+func ExportStep(format string) string {
+	return format + "-export"
+}
+
+// Plan describes how SafeBackupDatabase would back up an item right now
+type Plan struct {
+	Method   string // Step tried first: a RocksDB method or one of the Step* values
+	Fallback string // Step used when the first one fails, if any
+	LockInfo string // Lock holder when the source is locked
+}
+
+// PlanBackup works out the method and fallback SafeBackupDatabase would use
+// for an item, without copying anything. It follows the same lock check, so
+// the plan can change if the lock state changes before the backup runs.
+func PlanBackup(sourceInfo types.DatabaseInfo, method string) (Plan, error) {
+	// Encrypted databases are copied file by file whatever the method
+	if sourceInfo.Encrypted {
+		if sourceInfo.Type == types.DatabaseTypeRocksDB {
+			return Plan{Method: constants.MethodCopyFiles}, nil
+		}
+		return Plan{Method: StepFileCopy}, nil
+	}
+
+	lockInfo, _ := discovery.CheckDatabaseLock(sourceInfo.Path, sourceInfo.Type)
+	if lockInfo != nil && lockInfo.IsLocked {
+		plan := Plan{LockInfo: lockInfo.ProcessInfo}
+		switch sourceInfo.Type {
+		case types.DatabaseTypeRocksDB:
+			plan.Method, plan.Fallback = constants.MethodCheckpoint, constants.MethodBackup
+			if rocksDBBackupRate.Load() > 0 {
+				// The engine is not run when it would ignore the rate
+				plan.Fallback = ""
+			}
+			if method == constants.MethodCopy {
+				plan.Method, plan.Fallback = constants.MethodCopy, constants.MethodCheckpoint
+			}
+		case types.DatabaseTypeSQLite:
+			plan.Method, plan.Fallback = StepVacuumInto, StepTableCopy
+		default:
+			return plan, apperr.New(apperr.ErrLocked, "cannot safely backup locked file: %s (%s)", sourceInfo.Path, lockInfo.ProcessInfo)
+		}
+		return plan, nil
+	}
+
+	switch sourceInfo.Type {
+	case types.DatabaseTypeRocksDB:
+		switch method {
+		case constants.MethodBackup, constants.MethodCheckpoint, constants.MethodCopy, constants.MethodCopyFiles:
+			if method == constants.MethodBackup && rocksDBBackupRate.Load() > 0 {
+				return Plan{Method: constants.MethodCopyFiles}, nil
+			}
+			return Plan{Method: method}, nil
+		default:
+			return Plan{}, apperr.New(apperr.ErrUnsupportedMethod, "unknown method: %s. Available methods: backup, checkpoint, copy, copy-files", method)
+		}
+	case types.DatabaseTypeSQLite, types.DatabaseTypeLogFile, types.DatabaseTypeGenericFile:
+		return Plan{Method: StepFileCopy}, nil
+	default:
+		return Plan{}, fmt.Errorf("unknown database type: %s", sourceInfo.Path)
+	}
+}
@@ -2,11 +2,12 @@ package backup
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
+	"archiveFiles/internal/apperr"
 	"archiveFiles/internal/constants"
 	"archiveFiles/internal/progress"
 	"archiveFiles/internal/utils"
@@ -14,8 +15,9 @@ import (
 	"github.com/linxGnu/grocksdb"
 )
 
-// BackupRocksDB creates a backup using RocksDB BackupEngine
-func BackupRocksDB(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) error {
+// BackupRocksDB creates a backup using RocksDB BackupEngine. A backup that
+// fails the engine's own verification is kept, with a warning in the result.
+func BackupRocksDB(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) (Result, error) {
 	progressTracker.SetCurrentFile(fmt.Sprintf("Backing up %s", sourceDBPath))
 
 	// Try to open database in read-write mode first for proper backup
@@ -27,36 +29,41 @@ func BackupRocksDB(sourceDBPath, targetDBPath string, progressTracker *progress.
 	sourceDB, err := grocksdb.OpenDb(sourceOpts, sourceDBPath)
 	if err != nil {
 		// If read-write fails, try read-only mode
-		log.Printf("Could not open database in read-write mode, trying read-only: %v", err)
+		log.Info("Could not open database in read-write mode, trying read-only: %v", err)
 		sourceDB, err = grocksdb.OpenDbForReadOnly(sourceOpts, sourceDBPath, false)
 		if err != nil {
-			log.Printf("Warning: Could not open database for backup engine, falling back to file copy: %v", err)
-			return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
+			log.Warning("Could not open database for backup engine, falling back to file copy: %v", err)
+			return Result{}, BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 		}
 	}
 	defer sourceDB.Close()
 
-	// Create backup engine with target path
+	// Create backup engine with target path. The engine gets default
+	// BackupEngineOptions, so its backup_rate_limit cannot be set: the
+	// bindings only take options for engines opened without a database,
+	// which cannot create backups. See SetRocksDBBackupRate.
 	backupEngine, err := grocksdb.CreateBackupEngineWithPath(sourceDB, targetDBPath)
 	if err != nil {
-		log.Printf("Warning: Could not create backup engine, falling back to file copy: %v", err)
-		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
+		log.Warning("Could not create backup engine, falling back to file copy: %v", err)
+		return Result{}, BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 	defer backupEngine.Close()
 
 	// Create new backup with flush to ensure consistency
 	progressTracker.SetCurrentFile(fmt.Sprintf("Creating backup for %s", sourceDBPath))
+	stopWatch := watchTargetGrowth(targetDBPath, liveFilesSize(sourceDB), progressTracker)
 	err = backupEngine.CreateNewBackupFlush(true)
+	stopWatch()
 	if err != nil {
-		log.Printf("Warning: Backup creation failed, falling back to file copy: %v", err)
-		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
+		log.Warning("Backup creation failed, falling back to file copy: %v", err)
+		return Result{}, BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 
 	// Verify backup integrity
 	backupInfos := backupEngine.GetInfo()
 	if len(backupInfos) == 0 {
-		log.Printf("Warning: No backup info available, falling back to file copy")
-		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
+		log.Warning("No backup info available, falling back to file copy")
+		return Result{}, BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 
 	// Get the latest backup info
@@ -64,18 +71,20 @@ func BackupRocksDB(sourceDBPath, targetDBPath string, progressTracker *progress.
 
 	// Verify the backup
 	progressTracker.SetCurrentFile(fmt.Sprintf("Verifying backup %d for %s", latestBackup.ID, sourceDBPath))
+	var result Result
 	err = backupEngine.VerifyBackup(latestBackup.ID)
 	if err != nil {
-		log.Printf("Warning: Backup verification failed: %v", err)
+		log.Warning("Backup verification failed: %v", err)
 		// Continue anyway - backup might still be valid
+		result.Warnings = append(result.Warnings, fmt.Sprintf("backup engine verification of backup %d failed: %v", latestBackup.ID, err))
 	}
 
 	// Update progress with backup size
 	progressTracker.CompleteItem(int64(latestBackup.Size))
 
-	log.Printf("Successfully created backup ID %d: %d bytes, %d files",
+	log.Info("Successfully created backup ID %d: %d bytes, %d files",
 		latestBackup.ID, latestBackup.Size, latestBackup.NumFiles)
-	return nil
+	return result, nil
 }
 
 // CheckpointRocksDB creates a checkpoint using RocksDB Checkpoint API
@@ -90,7 +99,7 @@ func CheckpointRocksDB(sourceDBPath, targetDBPath string, progressTracker *progr
 	sourceDB, err := grocksdb.OpenDbForReadOnly(sourceOpts, sourceDBPath, false)
 	if err != nil {
 		// If we can't open the database, fall back to file-based backup
-		log.Printf("Warning: Could not open database for checkpoint, falling back to file copy: %v", err)
+		log.Warning("Could not open database for checkpoint, falling back to file copy: %v", err)
 		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 	defer sourceDB.Close()
@@ -99,51 +108,176 @@ func CheckpointRocksDB(sourceDBPath, targetDBPath string, progressTracker *progr
 	checkpoint, err := sourceDB.NewCheckpoint()
 	if err != nil {
 		// If checkpoint creation fails, fall back to file-based backup
-		log.Printf("Warning: Could not create checkpoint object, falling back to file copy: %v", err)
+		log.Warning("Could not create checkpoint object, falling back to file copy: %v", err)
 		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 	defer checkpoint.Destroy()
 
 	// Create checkpoint directory
 	progressTracker.SetCurrentFile(fmt.Sprintf("Creating checkpoint at %s", targetDBPath))
-	if err := checkpoint.CreateCheckpoint(targetDBPath, 0); err != nil {
+	stopWatch := watchTargetGrowth(targetDBPath, liveFilesSize(sourceDB), progressTracker)
+	err = checkpoint.CreateCheckpoint(targetDBPath, 0)
+	stopWatch()
+	if err != nil {
 		// If checkpoint fails, fall back to file-based backup
-		log.Printf("Warning: Checkpoint creation failed, falling back to file copy: %v", err)
+		log.Warning("Checkpoint creation failed, falling back to file copy: %v", err)
 		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 
 	// Verify the checkpoint includes all necessary files
 	if !VerifyBackupCompleteness(sourceDBPath, targetDBPath) {
-		log.Printf("Warning: Checkpoint appears incomplete, falling back to file copy")
+		log.Warning("Checkpoint appears incomplete, falling back to file copy")
 		// Remove incomplete checkpoint
 		os.RemoveAll(targetDBPath)
 		return BackupRocksDBFiles(sourceDBPath, targetDBPath, progressTracker)
 	}
 
+	if err := pruneRocksDBArtifacts(targetDBPath); err != nil {
+		return fmt.Errorf("failed to remove unneeded files from checkpoint: %v", err)
+	}
+
 	// Calculate checkpoint size
 	checkpointSize := utils.CalculateSize(targetDBPath)
 	progressTracker.CompleteItem(checkpointSize)
 	return nil
 }
 
-// CopyDatabaseData copies database data record by record
-func CopyDatabaseData(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) error {
-	// open source database (read-only)
+// CopyDatabaseData copies database data record by record from a snapshot,
+// so the copy represents one point in time, and returns the sequence number
+// of that point
+func CopyDatabaseData(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) (uint64, error) {
+	return copyPointInTime(sourceDBPath, targetDBPath, false, progressTracker)
+}
+
+// CopyLiveDatabaseData is CopyDatabaseData for a database another process
+// has open, followed as a secondary instance
+func CopyLiveDatabaseData(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) (uint64, error) {
+	return copyPointInTime(sourceDBPath, targetDBPath, true, progressTracker)
+}
+
+// copyPointInTime copies the records of a source database as of one
+// sequence number and returns it
+func copyPointInTime(sourceDBPath, targetDBPath string, live bool, progressTracker *progress.ProgressTracker) (uint64, error) {
+	source, err := openPointInTime(sourceDBPath, live)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	count, err := copyRecords(source.db, source.readOpts, targetDBPath, progressTracker)
+	if err != nil {
+		return 0, err
+	}
+	log.Info("Copied %d records from %s as of sequence number %d", count, sourceDBPath, source.sequence)
+	return source.sequence, nil
+}
+
+// rocksDBReadahead is the fixed iterator readahead for reading RocksDB
+// sources; 0 leaves RocksDB's automatic readahead
+var rocksDBReadahead atomic.Uint64
+
+// SetRocksDBReadahead sets the iterator readahead in bytes used when
+// records are read from RocksDB sources. Low-priority runs keep it small so
+// scans do not compete with the service for disk bandwidth. 0 restores
+// RocksDB's automatic readahead.
+func SetRocksDBReadahead(size uint64) {
+	rocksDBReadahead.Store(size)
+}
+
+// rocksDBBackupRate is the copy rate of the backup method in bytes per
+// second; 0 runs the BackupEngine at full speed
+var rocksDBBackupRate atomic.Int64
+
+// SetRocksDBBackupRate limits the backup method to bytesPerSecond. The
+// BackupEngine's backup_rate_limit cannot be set through the bindings, so
+// with a limit the method copies the database's files at that rate instead
+// (see BackupRocksDBFiles) and never runs the engine. 0 removes the limit.
+func SetRocksDBBackupRate(bytesPerSecond int64) {
+	rocksDBBackupRate.Store(bytesPerSecond)
+}
+
+// newSourceReadOptions returns read options for scanning a source database
+func newSourceReadOptions() *grocksdb.ReadOptions {
+	readOpts := grocksdb.NewDefaultReadOptions()
+	if size := rocksDBReadahead.Load(); size > 0 {
+		readOpts.SetReadaheadSize(size)
+	}
+	return readOpts
+}
+
+// pointInTime is a source database opened for reading at one sequence
+// number
+type pointInTime struct {
+	db       *grocksdb.DB
+	readOpts *grocksdb.ReadOptions
+	sequence uint64
+	cleanup  []func()
+}
+
+// Close releases the snapshot and the database
+func (p *pointInTime) Close() {
+	for i := len(p.cleanup) - 1; i >= 0; i-- {
+		p.cleanup[i]()
+	}
+}
+
+// openPointInTime opens a source database read-only with a snapshot. A live
+// database another process has open is followed as a secondary instance
+// instead, whose scratch files live in a temporary directory. RocksDB
+// rejects explicit snapshots in secondary mode, but an iterator reads at
+// the sequence number current when it is created; the instance does not
+// catch up again while it is read, so that number stays fixed.
+func openPointInTime(sourceDBPath string, live bool) (*pointInTime, error) {
+	p := &pointInTime{}
 	sourceOpts := grocksdb.NewDefaultOptions()
 	sourceOpts.SetCreateIfMissing(false)
-	defer sourceOpts.Destroy()
+	p.cleanup = append(p.cleanup, sourceOpts.Destroy)
 
-	sourceDB, err := grocksdb.OpenDbForReadOnly(sourceOpts, sourceDBPath, false)
+	if !live {
+		sourceDB, err := grocksdb.OpenDbForReadOnly(sourceOpts, sourceDBPath, false)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("failed to open source db: %v", err)
+		}
+		snapshot := sourceDB.NewSnapshot()
+		p.cleanup = append(p.cleanup, sourceDB.Close, func() { sourceDB.ReleaseSnapshot(snapshot) })
+		p.db = sourceDB
+		p.readOpts = newSourceReadOptions()
+		p.readOpts.SetSnapshot(snapshot)
+		p.cleanup = append(p.cleanup, p.readOpts.Destroy)
+		p.sequence = snapshot.GetSequenceNumber()
+		return p, nil
+	}
+
+	secondaryDir, err := utils.MkdirTemp(constants.TmpPrefix + "secondary-")
 	if err != nil {
-		return fmt.Errorf("failed to open source db: %v", err)
+		p.Close()
+		return nil, fmt.Errorf("failed to create secondary instance directory: %v", err)
 	}
-	defer sourceDB.Close()
+	p.cleanup = append(p.cleanup, func() { os.RemoveAll(secondaryDir) })
 
-	// Optimization: Use single pass instead of counting first
-	// Progress will be updated incrementally as we copy records
-	readOpts := grocksdb.NewDefaultReadOptions()
-	defer readOpts.Destroy()
+	// Secondary instances must keep all table files open
+	sourceOpts.SetMaxOpenFiles(-1)
+	sourceDB, err := grocksdb.OpenDbAsSecondary(sourceOpts, sourceDBPath, secondaryDir)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to open source db as secondary: %v", err)
+	}
+	p.cleanup = append(p.cleanup, sourceDB.Close)
+	if err := sourceDB.TryCatchUpWithPrimary(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to catch up with the primary: %v", err)
+	}
+	p.db = sourceDB
+	p.readOpts = newSourceReadOptions()
+	p.cleanup = append(p.cleanup, p.readOpts.Destroy)
+	p.sequence = sourceDB.GetLatestSequenceNumber()
+	return p, nil
+}
 
+// copyRecords writes every record readOpts sees in sourceDB into a new
+// database at targetDBPath and returns the number of records
+func copyRecords(sourceDB *grocksdb.DB, readOpts *grocksdb.ReadOptions, targetDBPath string, progressTracker *progress.ProgressTracker) (int64, error) {
 	// create target database
 	targetOpts := grocksdb.NewDefaultOptions()
 	targetOpts.SetCreateIfMissing(true)
@@ -151,7 +285,7 @@ func CopyDatabaseData(sourceDBPath, targetDBPath string, progressTracker *progre
 
 	targetDB, err := grocksdb.OpenDb(targetOpts, targetDBPath)
 	if err != nil {
-		return fmt.Errorf("failed to create target db: %v", err)
+		return 0, fmt.Errorf("failed to create target db: %v", err)
 	}
 	defer targetDB.Close()
 
@@ -193,7 +327,7 @@ func CopyDatabaseData(sourceDBPath, targetDBPath string, progressTracker *progre
 			err = targetDB.Write(writeOpts, writeBatch)
 			if err != nil {
 				// No need to free key/value here - already freed above
-				return fmt.Errorf("failed to write batch: %v", err)
+				return 0, fmt.Errorf("failed to write batch: %v", err)
 			}
 			writeBatch.Clear()
 		}
@@ -210,24 +344,41 @@ func CopyDatabaseData(sourceDBPath, targetDBPath string, progressTracker *progre
 	if writeBatch.Count() > 0 {
 		err = targetDB.Write(writeOpts, writeBatch)
 		if err != nil {
-			return fmt.Errorf("failed to write final batch: %v", err)
+			return 0, fmt.Errorf("failed to write final batch: %v", err)
 		}
 	}
 
 	if err := iter.Err(); err != nil {
-		return fmt.Errorf("error during iteration: %v", err)
+		return 0, fmt.Errorf("error during iteration: %v", err)
 	}
 
 	// Final progress update with actual count
 	progressTracker.UpdateRocksDBProgress(count, count)
 	progressTracker.CompleteItem(utils.CalculateSize(targetDBPath))
-
-	log.Printf("Copied %d records from %s", count, sourceDBPath)
-	return nil
+	return count, nil
 }
 
 // BackupRocksDBFiles creates a backup by copying all RocksDB files
 func BackupRocksDBFiles(sourceDBPath, targetDBPath string, progressTracker *progress.ProgressTracker) error {
+	return backupRocksDBFiles(sourceDBPath, targetDBPath, nil, progressTracker)
+}
+
+// backupRocksDBFiles is BackupRocksDBFiles with the copies paced by
+// throttle; nil copies at full speed
+func backupRocksDBFiles(sourceDBPath, targetDBPath string, throttle *utils.Throttle, progressTracker *progress.ProgressTracker) error {
+	// SST files, MANIFEST and WALs copied one by one while a writer flushes
+	// and compacts do not form a consistent database
+	held, pid, err := utils.RocksDBLockHolder(sourceDBPath)
+	if err != nil {
+		log.Warning("Could not check the LOCK holder of %s: %v", sourceDBPath, err)
+	} else if held {
+		holder := "another process"
+		if pid > 0 {
+			holder = fmt.Sprintf("process %d", pid)
+		}
+		return apperr.New(apperr.ErrLocked, "refusing to copy the files of %s while %s has it open for writing; a file copy of a live database is unusable", sourceDBPath, holder)
+	}
+
 	progressTracker.SetCurrentFile(fmt.Sprintf("Copying RocksDB files from %s", sourceDBPath))
 
 	// Create target directory
@@ -241,32 +392,43 @@ func BackupRocksDBFiles(sourceDBPath, targetDBPath string, progressTracker *prog
 		return fmt.Errorf("failed to read source directory: %v", err)
 	}
 
-	var totalSize int64
+	// Top-level files other than excluded artifacts, plus blob files of the
+	// legacy BlobDB which live in a subdirectory (integrated BlobDB blob
+	// files are already top-level)
+	excluded := rocksDBArtifactFilter(sourceDBPath)
+	var filesToCopy []string
 	for _, file := range sourceFiles {
-		if !file.IsDir() {
-			if info, err := file.Info(); err == nil {
-				totalSize += info.Size()
-			}
+		if !file.IsDir() && !excluded(file.Name()) {
+			filesToCopy = append(filesToCopy, file.Name())
+		}
+	}
+	blobFiles, err := utils.ListRocksDBBlobFiles(sourceDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to list blob files: %v", err)
+	}
+	for _, blobFile := range blobFiles {
+		if filepath.Dir(blobFile) != "." {
+			filesToCopy = append(filesToCopy, blobFile)
 		}
 	}
 
 	var copiedSize int64
-	for _, file := range sourceFiles {
-		if file.IsDir() {
-			continue // Skip subdirectories
-		}
+	for _, name := range filesToCopy {
+		sourcePath := filepath.Join(sourceDBPath, name)
+		targetPath := filepath.Join(targetDBPath, name)
 
-		sourcePath := filepath.Join(sourceDBPath, file.Name())
-		targetPath := filepath.Join(targetDBPath, file.Name())
+		progressTracker.SetCurrentFile(fmt.Sprintf("Copying %s", name))
 
-		progressTracker.SetCurrentFile(fmt.Sprintf("Copying %s", file.Name()))
+		if err := os.MkdirAll(filepath.Dir(targetPath), constants.DirPermission); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", name, err)
+		}
 
 		// Copy the file
-		if err := utils.CopyFile(sourcePath, targetPath); err != nil {
-			return fmt.Errorf("failed to copy file %s: %v", file.Name(), err)
+		if err := utils.CopyFileThrottled(sourcePath, targetPath, throttle); err != nil {
+			return fmt.Errorf("failed to copy file %s: %v", name, err)
 		}
 
-		if info, err := file.Info(); err == nil {
+		if info, err := os.Stat(sourcePath); err == nil {
 			copiedSize += info.Size()
 		}
 	}
@@ -309,12 +471,24 @@ func VerifyBackupCompleteness(sourceDBPath, backupDBPath string) bool {
 			strings.HasSuffix(fileName, ".sst") { // SST files
 
 			if !backupFileMap[fileName] {
-				log.Printf("Warning: Critical file %s missing from backup", fileName)
+				log.Warning("Critical file %s missing from backup", fileName)
 				return false
 			}
 		}
 	}
 
+	// BlobDB blob files hold large values and are as critical as SST files
+	blobFiles, err := utils.ListRocksDBBlobFiles(sourceDBPath)
+	if err != nil {
+		return false
+	}
+	for _, blobFile := range blobFiles {
+		if _, err := os.Stat(filepath.Join(backupDBPath, blobFile)); err != nil {
+			log.Warning("Blob file %s missing from backup", blobFile)
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+)
+
+func TestBackupRocksDBFiles_RefusesLiveDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"CURRENT", "MANIFEST-000001", "000005.sst"} {
+		if err := os.WriteFile(filepath.Join(dbPath, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Hold LOCK the way a running RocksDB writer does. F_OFD_SETLK (37)
+	// conflicts with queries from this process, unlike a classic F_SETLK.
+	lockFile, err := os.OpenFile(filepath.Join(dbPath, "LOCK"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lockFile.Close()
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(lockFile.Fd(), 37, &lock); err != nil {
+		t.Skipf("Open file description locks not supported: %v", err)
+	}
+
+	targetPath := filepath.Join(t.TempDir(), "backup")
+	err = BackupRocksDBFiles(dbPath, targetPath, progress.NewProgressTracker(false))
+	if !errors.Is(err, apperr.ErrLocked) {
+		t.Fatalf("Expected a locked error for a live database, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(targetPath, "000005.sst")); !os.IsNotExist(err) {
+		t.Errorf("No files should be copied from a live database, stat error: %v", err)
+	}
+
+	// Once the writer is gone the copy goes ahead
+	lockFile.Close()
+	if err := BackupRocksDBFiles(dbPath, targetPath, progress.NewProgressTracker(false)); err != nil {
+		t.Fatalf("BackupRocksDBFiles failed after the writer exited: %v", err)
+	}
+}
+
+func TestPlanBackup_LiveRocksDBCopy(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	lockFile, err := os.OpenFile(filepath.Join(dbPath, "LOCK"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lockFile.Close()
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(lockFile.Fd(), 37, &lock); err != nil {
+		t.Skipf("Open file description locks not supported: %v", err)
+	}
+
+	// A live database is copied through a secondary instance, with the
+	// checkpoint as fallback; other methods keep checkpoint then backup
+	rocksDB := types.DatabaseInfo{Path: dbPath, Type: types.DatabaseTypeRocksDB}
+	tests := map[string]Plan{
+		constants.MethodCopy:       {Method: constants.MethodCopy, Fallback: constants.MethodCheckpoint},
+		constants.MethodCheckpoint: {Method: constants.MethodCheckpoint, Fallback: constants.MethodBackup},
+	}
+	for method, want := range tests {
+		plan, err := PlanBackup(rocksDB, method)
+		if err != nil {
+			t.Fatalf("PlanBackup(%s) failed: %v", method, err)
+		}
+		if plan.Method != want.Method || plan.Fallback != want.Fallback || plan.LockInfo == "" {
+			t.Errorf("PlanBackup(%s) = %+v, want %s then %s", method, plan, want.Method, want.Fallback)
+		}
+	}
+}
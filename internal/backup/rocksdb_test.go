@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/progress"
+)
+
+// writeBlobDBFiles creates a RocksDB-like directory with integrated blob
+// files next to the SSTs and legacy blob files in the blob/ subdirectory
+func writeBlobDBFiles(t *testing.T, dbPath string) []string {
+	t.Helper()
+	files := []string{
+		"CURRENT",
+		"MANIFEST-000001",
+		"000004.sst",
+		"000005.blob",
+		filepath.Join("blob", "000002.blob"),
+	}
+	for _, name := range files {
+		path := filepath.Join(dbPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data for "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestBackupRocksDBFiles_BlobFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "db")
+	targetPath := filepath.Join(tempDir, "backup")
+	files := writeBlobDBFiles(t, sourcePath)
+
+	if err := BackupRocksDBFiles(sourcePath, targetPath, progress.NewProgressTracker(false)); err != nil {
+		t.Fatalf("BackupRocksDBFiles failed: %v", err)
+	}
+
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(targetPath, name)); err != nil {
+			t.Errorf("%s was not copied: %v", name, err)
+		}
+	}
+	if !VerifyBackupCompleteness(sourcePath, targetPath) {
+		t.Error("VerifyBackupCompleteness() = false for a complete copy")
+	}
+}
+
+func TestVerifyBackupCompleteness_MissingBlobFile(t *testing.T) {
+	for _, missing := range []string{"000005.blob", filepath.Join("blob", "000002.blob")} {
+		t.Run(missing, func(t *testing.T) {
+			tempDir := t.TempDir()
+			sourcePath := filepath.Join(tempDir, "db")
+			targetPath := filepath.Join(tempDir, "backup")
+			writeBlobDBFiles(t, sourcePath)
+			writeBlobDBFiles(t, targetPath)
+
+			if err := os.Remove(filepath.Join(targetPath, missing)); err != nil {
+				t.Fatal(err)
+			}
+			if VerifyBackupCompleteness(sourcePath, targetPath) {
+				t.Errorf("VerifyBackupCompleteness() = true with %s missing", missing)
+			}
+		})
+	}
+}
+
+func TestBackupRocksDBFiles_ExcludesArtifacts(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "db")
+	files := writeBlobDBFiles(t, sourcePath)
+	artifacts := []string{"LOG.old.1712345678901234", "000007.dbtmp", "OPTIONS-000003", "OPTIONS-000007.dbtmp"}
+	kept := append(files, "LOG", "OPTIONS-000009")
+	for _, name := range append(artifacts, "LOG", "OPTIONS-000009") {
+		if err := os.WriteFile(filepath.Join(sourcePath, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SetRocksDBExclusions(constants.DefaultRocksDBExclude)
+	defer SetRocksDBExclusions("")
+
+	targetPath := filepath.Join(tempDir, "backup")
+	if err := BackupRocksDBFiles(sourcePath, targetPath, progress.NewProgressTracker(false)); err != nil {
+		t.Fatalf("BackupRocksDBFiles failed: %v", err)
+	}
+	for _, name := range kept {
+		if _, err := os.Stat(filepath.Join(targetPath, name)); err != nil {
+			t.Errorf("%s was not copied: %v", name, err)
+		}
+	}
+	for _, name := range artifacts {
+		if _, err := os.Stat(filepath.Join(targetPath, name)); err == nil {
+			t.Errorf("artifact %s was copied", name)
+		}
+	}
+
+	// Critical files stay even when a pattern matches them
+	SetRocksDBExclusions("*.sst,MANIFEST-*,LOG")
+	prunePath := filepath.Join(tempDir, "checkpoint")
+	writeBlobDBFiles(t, prunePath)
+	if err := os.WriteFile(filepath.Join(prunePath, "LOG"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneRocksDBArtifacts(prunePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(prunePath, "LOG")); err == nil {
+		t.Error("LOG was not pruned")
+	}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(prunePath, name)); err != nil {
+			t.Errorf("critical file %s was pruned: %v", name, err)
+		}
+	}
+
+	// Without a numbered OPTIONS file the newest cannot be told; all stay
+	SetRocksDBExclusions("OPTIONS-*")
+	if err := os.WriteFile(filepath.Join(prunePath, "OPTIONS-restored"), []byte("options"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneRocksDBArtifacts(prunePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(prunePath, "OPTIONS-restored")); err != nil {
+		t.Errorf("the only OPTIONS file was pruned: %v", err)
+	}
+}
@@ -4,39 +4,46 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"archiveFiles/internal/sqlitedb"
 )
 
 // SafeCopySQLiteDatabase performs a safe online backup of a SQLite database
 // using SQL commands that work even when the database is locked by another process
 func SafeCopySQLiteDatabase(sourcePath, targetPath string) error {
+	_, err := safeCopySQLite(sourcePath, targetPath)
+	return err
+}
+
+// safeCopySQLite is SafeCopySQLiteDatabase, reporting the step that made
+// the copy and the failed attempt before it
+func safeCopySQLite(sourcePath, targetPath string) (Result, error) {
 	// Try VACUUM INTO method first (SQLite 3.27.0+, 2019)
 	// This is the fastest and most atomic method
 	err := vacuumIntoBackup(sourcePath, targetPath)
 	if err == nil {
-		log.Printf("Successfully completed online SQLite backup using VACUUM INTO: %s -> %s", sourcePath, targetPath)
-		return nil
+		log.Info("Successfully completed online SQLite backup using VACUUM INTO: %s -> %s", sourcePath, targetPath)
+		return Result{Method: StepVacuumInto}, nil
 	}
 
-	log.Printf("VACUUM INTO not available, falling back to table-by-table copy: %v", err)
+	log.Info("VACUUM INTO not available, falling back to table-by-table copy: %v", err)
+	fallbacks := []string{fmt.Sprintf("%s: %v", StepVacuumInto, err)}
 
 	// Fallback: table-by-table copy
 	err = copyDatabaseTableByTable(sourcePath, targetPath)
 	if err != nil {
-		return fmt.Errorf("failed to backup SQLite database: %v", err)
+		return Result{}, fmt.Errorf("failed to backup SQLite database: %v", err)
 	}
 
-	log.Printf("Successfully completed online SQLite backup using table copy: %s -> %s", sourcePath, targetPath)
-	return nil
+	log.Info("Successfully completed online SQLite backup using table copy: %s -> %s", sourcePath, targetPath)
+	return Result{Method: StepTableCopy, Fallbacks: fallbacks}, nil
 }
 
 // vacuumIntoBackup uses VACUUM INTO command (atomic, safe, fast)
 func vacuumIntoBackup(sourcePath, targetPath string) error {
 	// Open source database in read-only mode
-	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", sourcePath))
+	db, err := sqlitedb.Open(sourcePath, sqlitedb.ReadOnly)
 	if err != nil {
 		return fmt.Errorf("failed to open source database: %v", err)
 	}
@@ -56,27 +63,21 @@ func vacuumIntoBackup(sourcePath, targetPath string) error {
 func copyDatabaseTableByTable(sourcePath, targetPath string) error {
 	ctx := context.Background()
 
-	// Open source database in read-only mode
-	sourceDB, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", sourcePath))
+	// Open source database in read-only mode, and open or create the target
+	sourceDB, targetDB, err := sqlitedb.OpenPair(sourcePath, sqlitedb.ReadOnly, targetPath, sqlitedb.Create)
 	if err != nil {
-		return fmt.Errorf("failed to open source database: %v", err)
+		return fmt.Errorf("failed to open databases: %v", err)
 	}
 	defer sourceDB.Close()
+	defer targetDB.Close()
 
 	// Verify source database connection
 	if err := sourceDB.Ping(); err != nil {
 		return fmt.Errorf("failed to connect to source database: %v", err)
 	}
 
-	// Open or create target database
-	targetDB, err := sql.Open("sqlite3", targetPath)
-	if err != nil {
-		return fmt.Errorf("failed to create target database: %v", err)
-	}
-	defer targetDB.Close()
-
 	// Get list of all tables, indexes, views, and triggers
-	schemas, err := getAllSchemas(ctx, sourceDB)
+	schemas, err := getAllSchemas(ctx, sourceDB.DB)
 	if err != nil {
 		return fmt.Errorf("failed to get schemas: %v", err)
 	}
@@ -95,10 +96,10 @@ func copyDatabaseTableByTable(sourcePath, targetPath string) error {
 	// Copy data for all tables
 	for _, schema := range schemas {
 		if schema.Type == "table" && !strings.HasPrefix(schema.Name, "sqlite_") {
-			if err := copyTableData(ctx, sourceDB, targetDB, schema.Name); err != nil {
+			if err := copyTableData(ctx, sourceDB.DB, targetDB.DB, schema.Name); err != nil {
 				return fmt.Errorf("failed to copy table %s: %v", schema.Name, err)
 			}
-			log.Printf("  Copied table: %s", schema.Name)
+			log.Debug("  Copied table: %s", schema.Name)
 		}
 	}
 
@@ -216,7 +217,7 @@ func copyTableData(ctx context.Context, srcDB, dstDB *sql.DB, tableName string)
 	}
 
 	if rowCount > 0 {
-		log.Printf("    Copied %d rows", rowCount)
+		log.Debug("    Copied %d rows", rowCount)
 	}
 
 	return nil
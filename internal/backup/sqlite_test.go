@@ -4,8 +4,12 @@ import (
 	"database/sql"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/types"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -354,3 +358,69 @@ func TestSafeCopySQLiteDatabaseNonExistent(t *testing.T) {
 		t.Error("Expected error for non-existent source database")
 	}
 }
+
+func TestProcessSQLiteDB_CompanionFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "app.db")
+	createTestSQLiteDB(t, sourcePath)
+	companions := map[string]string{"-wal": "wal frames", "-journal": "rollback journal"}
+	for suffix, content := range companions {
+		if err := os.WriteFile(sourcePath+suffix, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targetDir := filepath.Join(tempDir, "backup")
+	if err := ProcessSQLiteDB(sourcePath, targetDir); err != nil {
+		t.Fatalf("ProcessSQLiteDB failed: %v", err)
+	}
+
+	targetFile := filepath.Join(targetDir, "app.db")
+	for suffix, content := range companions {
+		data, err := os.ReadFile(targetFile + suffix)
+		if err != nil {
+			t.Errorf("companion %s was not copied: %v", suffix, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("companion %s content = %q, want %q", suffix, data, content)
+		}
+	}
+	if _, err := os.Stat(targetFile + "-shm"); !os.IsNotExist(err) {
+		t.Errorf("absent -shm companion should not be created")
+	}
+}
+
+func TestSafeBackupDatabase_SQLiteAttachments(t *testing.T) {
+	tempDir := t.TempDir()
+	mainPath := filepath.Join(tempDir, "app.db")
+	auxPath := filepath.Join(tempDir, "aux", "aux.db")
+	if err := os.MkdirAll(filepath.Dir(auxPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createTestSQLiteDB(t, mainPath)
+	createTestSQLiteDB(t, auxPath)
+
+	dbInfo := types.DatabaseInfo{
+		Path:        mainPath,
+		Type:        types.DatabaseTypeSQLite,
+		Name:        "app.db",
+		Attachments: []string{auxPath, filepath.Join(tempDir, "missing.db")},
+	}
+	targetDir := filepath.Join(tempDir, "backup")
+	result, err := SafeBackupDatabase(dbInfo, targetDir, "checkpoint", progress.NewProgressTracker(false))
+	if err != nil {
+		t.Fatalf("SafeBackupDatabase failed: %v", err)
+	}
+
+	verifyTestSQLiteDB(t, filepath.Join(targetDir, "app.db"))
+	verifyTestSQLiteDB(t, filepath.Join(targetDir, "aux.db"))
+
+	// The missing attachment is left out with a warning
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "missing.db") {
+		t.Errorf("Warnings = %v, want one about missing.db", result.Warnings)
+	}
+	if result.Method != StepFileCopy || len(result.Fallbacks) != 0 {
+		t.Errorf("Method = %q, fallbacks %v, want %s without fallbacks", result.Method, result.Fallbacks, StepFileCopy)
+	}
+}
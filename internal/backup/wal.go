@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// ReadWALDir returns the wal_dir configured in the newest OPTIONS file of a
+// RocksDB database, or "" when WALs live in the database directory itself
+func ReadWALDir(dbPath string) (string, error) {
+	var walDir string
+	err := scanOptions(dbPath, func(section, key, value string) {
+		if section == "[DBOptions]" && key == "wal_dir" {
+			walDir = strings.Trim(value, "\"")
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if walDir == "" || samePath(walDir, dbPath) {
+		return "", nil
+	}
+	return walDir, nil
+}
+
+// scanOptions calls fn for every key=value line of the newest OPTIONS file
+// of a RocksDB database, with the section header it appears under. A
+// database without OPTIONS file is not an error.
+func scanOptions(dbPath string, fn func(section, key, value string)) error {
+	optionsFile, err := latestOptionsFile(dbPath)
+	if err != nil || optionsFile == "" {
+		return err
+	}
+
+	file, err := os.Open(optionsFile)
+	if err != nil {
+		return fmt.Errorf("failed to open options file: %v", err)
+	}
+	defer file.Close()
+
+	var section string
+	scanner := bufio.NewScanner(file)
+	// db_paths and cf_paths lists can make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+		if key, value, found := strings.Cut(line, "="); found {
+			fn(section, strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read options file: %v", err)
+	}
+	return nil
+}
+
+// samePath reports whether two paths name the same directory
+func samePath(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// latestOptionsFile returns the OPTIONS-NNNNNN file with the highest number
+func latestOptionsFile(dbPath string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dbPath, "OPTIONS-*"))
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(filepath.Base(match), "OPTIONS-")
+		if _, err := strconv.ParseUint(suffix, 10, 64); err == nil {
+			candidates = append(candidates, match)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, _ := strconv.ParseUint(strings.TrimPrefix(filepath.Base(candidates[i]), "OPTIONS-"), 10, 64)
+		b, _ := strconv.ParseUint(strings.TrimPrefix(filepath.Base(candidates[j]), "OPTIONS-"), 10, 64)
+		return a < b
+	})
+	return candidates[len(candidates)-1], nil
+}
+
+// BackupExternalWALs copies a wal_dir that lives outside the database
+// directory (including its archive/ subdirectory of archived WALs) into the
+// backup. It returns the source wal_dir and the path it was copied to, or
+// empty strings when the database keeps its WALs in place.
+func BackupExternalWALs(sourceDBPath, targetDBPath string) (string, string, error) {
+	walDir, err := ReadWALDir(sourceDBPath)
+	if err != nil {
+		return "", "", err
+	}
+	if walDir == "" {
+		return "", "", nil
+	}
+
+	if _, err := os.Stat(walDir); err != nil {
+		log.Warning("wal_dir %s configured for %s is not accessible: %v", walDir, sourceDBPath, err)
+		return "", "", nil
+	}
+
+	targetWALPath := filepath.Join(targetDBPath, constants.WALBackupDirName)
+	if err := copyTree(walDir, targetWALPath, nil); err != nil {
+		return "", "", fmt.Errorf("failed to copy wal_dir %s: %v", walDir, err)
+	}
+
+	log.Info("Copied external wal_dir %s to %s", walDir, targetWALPath)
+	return walDir, targetWALPath, nil
+}
+
+// copyTree copies the regular files of a directory tree, recreating its
+// layout. Files for which skip returns true are left out; skip may be nil.
+func copyTree(sourceDir, targetDir string, skip func(relPath string) bool) error {
+	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(targetDir, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(targetPath, constants.DirPermission)
+		}
+		if !info.Mode().IsRegular() || (skip != nil && skip(relPath)) {
+			return nil
+		}
+		return utils.CopyFile(path, targetPath)
+	})
+}
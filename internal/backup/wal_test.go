@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+func writeOptionsFile(t *testing.T, dbPath, name, walDir string) {
+	t.Helper()
+	content := "[Version]\n  rocksdb_version=8.1.1\n\n[DBOptions]\n  create_if_missing=true\n  wal_dir=" + walDir + "\n\n[CFOptions \"default\"]\n  wal_dir=/ignored\n"
+	if err := os.WriteFile(filepath.Join(dbPath, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write options file: %v", err)
+	}
+}
+
+func TestReadWALDir(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "db")
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("no options file", func(t *testing.T) {
+		walDir, err := ReadWALDir(dbPath)
+		if err != nil || walDir != "" {
+			t.Errorf("ReadWALDir() = %q, %v; want empty", walDir, err)
+		}
+	})
+
+	t.Run("wal_dir is the db dir", func(t *testing.T) {
+		writeOptionsFile(t, dbPath, "OPTIONS-000005", dbPath)
+		walDir, err := ReadWALDir(dbPath)
+		if err != nil || walDir != "" {
+			t.Errorf("ReadWALDir() = %q, %v; want empty", walDir, err)
+		}
+	})
+
+	t.Run("newest options file wins", func(t *testing.T) {
+		writeOptionsFile(t, dbPath, "OPTIONS-000012", "/wal/new")
+		writeOptionsFile(t, dbPath, "OPTIONS-000009", "/wal/old")
+		walDir, err := ReadWALDir(dbPath)
+		if err != nil || walDir != "/wal/new" {
+			t.Errorf("ReadWALDir() = %q, %v; want /wal/new", walDir, err)
+		}
+	})
+}
+
+func TestBackupExternalWALs(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "db")
+	walDir := filepath.Join(tempDir, "wal")
+	for _, dir := range []string{dbPath, filepath.Join(walDir, "archive")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeOptionsFile(t, dbPath, "OPTIONS-000007", walDir)
+
+	files := map[string]string{
+		"000010.log":         "live wal",
+		"archive/000008.log": "archived wal",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(walDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targetDBPath := filepath.Join(tempDir, "backup", "db")
+	if err := os.MkdirAll(targetDBPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	source, target, err := BackupExternalWALs(dbPath, targetDBPath)
+	if err != nil {
+		t.Fatalf("BackupExternalWALs failed: %v", err)
+	}
+	if source != walDir {
+		t.Errorf("source = %q, want %q", source, walDir)
+	}
+	if want := filepath.Join(targetDBPath, constants.WALBackupDirName); target != want {
+		t.Errorf("target = %q, want %q", target, want)
+	}
+
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(target, name))
+		if err != nil {
+			t.Errorf("%s was not copied: %v", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("%s content = %q, want %q", name, data, content)
+		}
+	}
+}
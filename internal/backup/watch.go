@@ -0,0 +1,52 @@
+package backup
+
+import (
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/progress"
+	"archiveFiles/internal/utils"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+// liveFilesSize returns the size of the SST files of an open database, the
+// bulk of what a checkpoint or backup writes
+func liveFilesSize(db *grocksdb.DB) int64 {
+	var total int64
+	for _, file := range db.GetLiveFilesMetaData() {
+		total += file.Size
+	}
+	return total
+}
+
+// watchTargetGrowth reports the size of targetDir as the progress of the
+// running item until the returned function is called. RocksDB checkpoints
+// and backups give no progress callbacks, so growth of the target is the
+// only measure available.
+func watchTargetGrowth(targetDir string, total int64, progressTracker *progress.ProgressTracker) (stop func()) {
+	if !progressTracker.Enabled() {
+		return func() {}
+	}
+	work := progressTracker.StartWork(total)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Second / constants.ProgressPollsPerSecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				work.Update(utils.CalculateSize(targetDir))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		work.Done()
+	}
+}
@@ -0,0 +1,37 @@
+package backup
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/progress"
+)
+
+func TestWatchTargetGrowth(t *testing.T) {
+	targetDir := t.TempDir()
+	tracker := progress.NewProgressTracker(true)
+	tracker.SetOutput(io.Discard)
+	tracker.Init(1, 1000)
+	defer tracker.Stop()
+
+	stop := watchTargetGrowth(targetDir, 1000, tracker)
+	if err := os.WriteFile(filepath.Join(targetDir, "000001.sst"), make([]byte, 400), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for tracker.Snapshot().InFlightSize != 400 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := tracker.Percent(); got != 40 {
+		t.Errorf("Percent while the target grows = %v, want 40", got)
+	}
+
+	stop()
+	if s := tracker.Snapshot(); s.InFlightSize != 0 {
+		t.Errorf("InFlightSize after stop = %d, want 0", s.InFlightSize)
+	}
+}
@@ -0,0 +1,288 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+// ItemRecord is the size of one item in one backup run
+type ItemRecord struct {
+	SourceRoot string `json:"source_root,omitempty"` // Configured source the item was discovered in
+	SourcePath string `json:"source_path"`
+	Type       string `json:"type"`
+	Size       int64  `json:"size"`               // Size of the item in the backup, in bytes; its source size in an inventory run
+	Checksum   string `json:"checksum,omitempty"` // Digest of the SHA-256 of the item's files, in an inventory run with inventory_hashes
+
+	Classifications []string `json:"classifications,omitempty"` // Labels of the item's source, e.g. pii
+}
+
+// Run records one backup run
+type Run struct {
+	RunID       string       `json:"run_id,omitempty"`    // Matches run_id in the run's manifest and report
+	Namespace   string       `json:"namespace,omitempty"` // Tenant the run belongs to in a shared catalog
+	Time        time.Time    `json:"time"`
+	BackupPath  string       `json:"backup_path"`
+	Duration    float64      `json:"duration_seconds,omitempty"` // Seconds from the start of the run to the end of the backup phase
+	ArchivePath string       `json:"archive_path,omitempty"`     // Compressed archive of the run, recorded once compression succeeds
+	ArchiveSize int64        `json:"archive_size,omitempty"`     // Size of the archive file in bytes, as checked after the rename with network_fs
+	Items       []ItemRecord `json:"items"`
+	Hosts       []string     `json:"hosts,omitempty"`     // Hosts of a fleet run; its items' source paths are prefixed with host:
+	Inventory   bool         `json:"inventory,omitempty"` // The run listed the sources without backing them up
+}
+
+// Drill records one restore drill: an archive restored to scratch space and verified
+type Drill struct {
+	Time        time.Time `json:"time"`
+	RunID       string    `json:"run_id,omitempty"`
+	ArchivePath string    `json:"archive_path"`
+	Succeeded   bool      `json:"succeeded"`
+	Error       string    `json:"error,omitempty"`
+	Duration    float64   `json:"duration_seconds"`
+}
+
+// Catalog is the history of backup runs, kept across runs in a JSON file
+type Catalog struct {
+	Runs   []Run   `json:"runs"`
+	Drills []Drill `json:"drills,omitempty"`
+}
+
+// Drift changes between two inventories
+const (
+	DriftAdded   = "added"
+	DriftRemoved = "removed"
+	DriftChanged = "changed"
+)
+
+// Drift describes an item that appeared, disappeared or changed between
+// two inventory runs
+type Drift struct {
+	SourcePath string
+	Change     string // DriftAdded, DriftRemoved or DriftChanged
+	OldSize    int64
+	NewSize    int64
+}
+
+// Anomaly describes an item whose backup is much smaller than usual
+type Anomaly struct {
+	SourcePath string
+	Size       int64
+	Average    int64   // Trailing average size of the item
+	Drop       float64 // Relative drop against the average, 0.6 means 60% smaller
+}
+
+// Load reads a catalog from disk. A missing file yields an empty catalog.
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Catalog{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog %s: %v", path, err)
+	}
+
+	c := &Catalog{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the catalog atomically via a temporary file
+func (c *Catalog) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal catalog: %v", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, constants.DirPermission); err != nil {
+			return fmt.Errorf("failed to create catalog directory: %v", err)
+		}
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write catalog %s: %v", path, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace catalog %s: %v", path, err)
+	}
+	return nil
+}
+
+// AddRun appends a run, dropping the oldest runs beyond constants.CatalogMaxRuns
+func (c *Catalog) AddRun(run Run) {
+	c.Runs = append(c.Runs, run)
+	if len(c.Runs) > constants.CatalogMaxRuns {
+		c.Runs = c.Runs[len(c.Runs)-constants.CatalogMaxRuns:]
+	}
+}
+
+// SetArchivePath records the archive a run was compressed into and its size
+// (0 for per-item archives). It reports false when the run is not in the
+// catalog.
+func (c *Catalog) SetArchivePath(runID, archivePath string, size int64) bool {
+	for i := len(c.Runs) - 1; i >= 0; i-- {
+		if c.Runs[i].RunID == runID {
+			c.Runs[i].ArchivePath = archivePath
+			c.Runs[i].ArchiveSize = size
+			return true
+		}
+	}
+	return false
+}
+
+// InNamespace returns a view of the catalog holding only the runs of
+// namespace, for comparing a run against its own tenant's history. Changes
+// to the view are not saved with the catalog.
+func (c *Catalog) InNamespace(namespace string) *Catalog {
+	view := &Catalog{Drills: c.Drills}
+	for _, run := range c.Runs {
+		if run.Namespace == namespace {
+			view.Runs = append(view.Runs, run)
+		}
+	}
+	return view
+}
+
+// AddDrill appends a drill result, dropping the oldest beyond constants.CatalogMaxRuns
+func (c *Catalog) AddDrill(drill Drill) {
+	c.Drills = append(c.Drills, drill)
+	if len(c.Drills) > constants.CatalogMaxRuns {
+		c.Drills = c.Drills[len(c.Drills)-constants.CatalogMaxRuns:]
+	}
+}
+
+// TrailingAverage returns the average size of an item over its last window
+// recorded backup runs, and how many runs contributed. Inventory runs
+// record source sizes and are left out.
+func (c *Catalog) TrailingAverage(sourcePath string, window int) (int64, int) {
+	var total int64
+	count := 0
+	for i := len(c.Runs) - 1; i >= 0 && count < window; i-- {
+		if c.Runs[i].Inventory {
+			continue
+		}
+		for _, item := range c.Runs[i].Items {
+			if item.SourcePath == sourcePath {
+				total += item.Size
+				count++
+				break
+			}
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return total / int64(count), count
+}
+
+// LastBackup returns the time of the latest run that backed up an item
+// accepted by match
+func (c *Catalog) LastBackup(match func(ItemRecord) bool) (time.Time, bool) {
+	var last time.Time
+	found := false
+	for _, run := range c.Runs {
+		if run.Inventory {
+			continue
+		}
+		for _, item := range run.Items {
+			if match(item) && (!found || run.Time.After(last)) {
+				last = run.Time
+				found = true
+				break
+			}
+		}
+	}
+	return last, found
+}
+
+// Throughput returns the average backup speed in bytes per second over the
+// last window runs that recorded a duration, and how many runs contributed
+func (c *Catalog) Throughput(window int) (float64, int) {
+	var bytes int64
+	var seconds float64
+	count := 0
+	for i := len(c.Runs) - 1; i >= 0 && count < window; i-- {
+		run := c.Runs[i]
+		if run.Duration <= 0 || run.Inventory {
+			continue
+		}
+		for _, item := range run.Items {
+			bytes += item.Size
+		}
+		seconds += run.Duration
+		count++
+	}
+	if count == 0 || seconds == 0 {
+		return 0, 0
+	}
+	return float64(bytes) / seconds, count
+}
+
+// DetectSizeAnomalies compares the items of a new run against their trailing
+// averages and reports those that shrank by more than threshold (0-1). Items
+// with fewer than constants.AnomalyMinHistory earlier runs are not judged.
+func (c *Catalog) DetectSizeAnomalies(run Run, window int, threshold float64) []Anomaly {
+	var anomalies []Anomaly
+	for _, item := range run.Items {
+		average, count := c.TrailingAverage(item.SourcePath, window)
+		if count < constants.AnomalyMinHistory || average <= 0 {
+			continue
+		}
+
+		drop := 1 - float64(item.Size)/float64(average)
+		if drop > threshold {
+			anomalies = append(anomalies, Anomaly{
+				SourcePath: item.SourcePath,
+				Size:       item.Size,
+				Average:    average,
+				Drop:       drop,
+			})
+		}
+	}
+	return anomalies
+}
+
+// LastInventory returns the latest inventory run
+func (c *Catalog) LastInventory() (Run, bool) {
+	for i := len(c.Runs) - 1; i >= 0; i-- {
+		if c.Runs[i].Inventory {
+			return c.Runs[i], true
+		}
+	}
+	return Run{}, false
+}
+
+// DetectDrift compares an inventory run against an earlier one and reports
+// the items added, removed or changed since, sorted by source path. An item
+// changed when its size did, or its checksum where both runs recorded one.
+func DetectDrift(previous, run Run) []Drift {
+	before := make(map[string]ItemRecord, len(previous.Items))
+	for _, item := range previous.Items {
+		before[item.SourcePath] = item
+	}
+	var drift []Drift
+	for _, item := range run.Items {
+		old, ok := before[item.SourcePath]
+		delete(before, item.SourcePath)
+		switch {
+		case !ok:
+			drift = append(drift, Drift{SourcePath: item.SourcePath, Change: DriftAdded, NewSize: item.Size})
+		case old.Size != item.Size || (old.Checksum != "" && item.Checksum != "" && old.Checksum != item.Checksum):
+			drift = append(drift, Drift{SourcePath: item.SourcePath, Change: DriftChanged, OldSize: old.Size, NewSize: item.Size})
+		}
+	}
+	for _, old := range before {
+		drift = append(drift, Drift{SourcePath: old.SourcePath, Change: DriftRemoved, OldSize: old.Size})
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].SourcePath < drift[j].SourcePath })
+	return drift
+}
@@ -0,0 +1,204 @@
+package catalog
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+func runWithSize(size int64) Run {
+	return Run{
+		Time:  time.Now().UTC(),
+		Items: []ItemRecord{{SourcePath: "/data/app.db", Type: "SQLite", Size: size}},
+	}
+}
+
+func TestLoadMissingCatalog(t *testing.T) {
+	c, err := Load(filepath.Join(t.TempDir(), "catalog.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(c.Runs) != 0 {
+		t.Errorf("Expected empty catalog, got %d runs", len(c.Runs))
+	}
+}
+
+func TestCatalogSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "catalog.json")
+
+	c := &Catalog{}
+	c.AddRun(runWithSize(100))
+	c.AddRun(runWithSize(200))
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Runs) != 2 || loaded.Runs[1].Items[0].Size != 200 {
+		t.Errorf("Loaded catalog = %+v", loaded.Runs)
+	}
+}
+
+func TestAddRunTrimsHistory(t *testing.T) {
+	c := &Catalog{}
+	for i := 0; i < constants.CatalogMaxRuns+5; i++ {
+		c.AddRun(runWithSize(int64(i)))
+	}
+	if len(c.Runs) != constants.CatalogMaxRuns {
+		t.Fatalf("Expected %d runs, got %d", constants.CatalogMaxRuns, len(c.Runs))
+	}
+	if c.Runs[0].Items[0].Size != 5 {
+		t.Errorf("Oldest runs should be dropped first, first size = %d", c.Runs[0].Items[0].Size)
+	}
+}
+
+func TestDetectSizeAnomalies(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []int64
+		size     int64
+		expected int
+	}{
+		{"too little history", []int64{1000, 1000}, 100, 0},
+		{"stable size", []int64{1000, 1000, 1000}, 950, 0},
+		{"genuine shrink within threshold", []int64{1000, 1000, 1000}, 600, 0},
+		{"dramatic drop", []int64{1000, 1000, 1000}, 400, 1},
+		{"growth", []int64{1000, 1000, 1000}, 5000, 0},
+		{"window ignores old runs", []int64{100, 100, 100, 1000, 1000, 1000}, 400, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Catalog{}
+			for _, size := range tt.history {
+				c.AddRun(runWithSize(size))
+			}
+
+			anomalies := c.DetectSizeAnomalies(runWithSize(tt.size), 3, 0.5)
+			if len(anomalies) != tt.expected {
+				t.Fatalf("Expected %d anomalies, got %+v", tt.expected, anomalies)
+			}
+			if tt.expected > 0 && anomalies[0].Average != 1000 {
+				t.Errorf("Average = %d, want 1000", anomalies[0].Average)
+			}
+		})
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	c := &Catalog{}
+	if _, runs := c.Throughput(constants.AnomalyWindow); runs != 0 {
+		t.Errorf("Expected no throughput for an empty catalog, got %d runs", runs)
+	}
+
+	// Runs recorded before durations were tracked are ignored
+	c.AddRun(runWithSize(1000))
+
+	timed := runWithSize(1000)
+	timed.Duration = 10
+	c.AddRun(timed)
+	timed = runWithSize(3000)
+	timed.Duration = 10
+	c.AddRun(timed)
+
+	throughput, runs := c.Throughput(constants.AnomalyWindow)
+	if runs != 2 {
+		t.Fatalf("Expected 2 timed runs, got %d", runs)
+	}
+	if throughput != 200 {
+		t.Errorf("Throughput = %v bytes/s, want 200", throughput)
+	}
+
+	if _, runs := c.Throughput(1); runs != 1 {
+		t.Errorf("Window of 1 should use 1 run, got %d", runs)
+	}
+}
+
+func TestSetArchivePath(t *testing.T) {
+	c := &Catalog{}
+	c.AddRun(Run{RunID: "a"})
+	c.AddRun(Run{RunID: "b"})
+
+	if !c.SetArchivePath("a", "/archives/a.tar.gz", 4096) {
+		t.Fatal("SetArchivePath should find run a")
+	}
+	if c.Runs[0].ArchivePath != "/archives/a.tar.gz" || c.Runs[1].ArchivePath != "" {
+		t.Errorf("Archive paths = %q, %q", c.Runs[0].ArchivePath, c.Runs[1].ArchivePath)
+	}
+	if c.Runs[0].ArchiveSize != 4096 {
+		t.Errorf("Archive size = %d, want 4096", c.Runs[0].ArchiveSize)
+	}
+	if c.SetArchivePath("missing", "/archives/x.tar.gz", 0) {
+		t.Error("SetArchivePath should report an unknown run")
+	}
+}
+
+func TestInNamespace(t *testing.T) {
+	c := &Catalog{}
+	c.AddRun(Run{RunID: "a"})
+	c.AddRun(Run{RunID: "b", Namespace: "teamA"})
+	c.AddRun(Run{RunID: "c", Namespace: "teamB"})
+
+	view := c.InNamespace("teamA")
+	if len(view.Runs) != 1 || view.Runs[0].RunID != "b" {
+		t.Errorf("InNamespace(teamA) = %+v", view.Runs)
+	}
+	if view := c.InNamespace(""); len(view.Runs) != 1 || view.Runs[0].RunID != "a" {
+		t.Errorf("InNamespace(\"\") = %+v", view.Runs)
+	}
+	if len(c.Runs) != 3 {
+		t.Errorf("The view changed the catalog: %d runs", len(c.Runs))
+	}
+}
+
+func TestInventoryRuns(t *testing.T) {
+	c := &Catalog{}
+	c.AddRun(runWithSize(1000))
+	inventory := runWithSize(5000)
+	inventory.Inventory = true
+	inventory.Duration = 1
+	c.AddRun(inventory)
+
+	// Inventories record source sizes and back nothing up
+	if average, count := c.TrailingAverage("/data/app.db", constants.AnomalyWindow); average != 1000 || count != 1 {
+		t.Errorf("TrailingAverage = %d over %d runs, want 1000 over the backup run", average, count)
+	}
+	if _, runs := c.Throughput(constants.AnomalyWindow); runs != 0 {
+		t.Errorf("Throughput used %d run(s), want none", runs)
+	}
+	if last, found := c.LastBackup(func(ItemRecord) bool { return true }); !found || !last.Equal(c.Runs[0].Time) {
+		t.Errorf("LastBackup = %v, %t, want the backup run", last, found)
+	}
+	if last, ok := c.LastInventory(); !ok || last.Items[0].Size != 5000 {
+		t.Errorf("LastInventory = %+v, %t", last, ok)
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	previous := Run{Items: []ItemRecord{
+		{SourcePath: "/data/a.db", Size: 100, Checksum: "aa"},
+		{SourcePath: "/data/b.db", Size: 100, Checksum: "bb"},
+		{SourcePath: "/data/c.db", Size: 100},
+		{SourcePath: "/data/gone.db", Size: 100},
+	}}
+	run := Run{Items: []ItemRecord{
+		{SourcePath: "/data/a.db", Size: 100, Checksum: "aa"},
+		{SourcePath: "/data/b.db", Size: 100, Checksum: "b2"},
+		{SourcePath: "/data/c.db", Size: 200},
+		{SourcePath: "/data/new.db", Size: 50},
+	}}
+	var got []string
+	for _, drift := range DetectDrift(previous, run) {
+		got = append(got, drift.Change+" "+drift.SourcePath)
+	}
+	want := []string{"changed /data/b.db", "changed /data/c.db", "removed /data/gone.db", "added /data/new.db"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DetectDrift = %q, want %q", got, want)
+	}
+}
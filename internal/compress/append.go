@@ -0,0 +1,158 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// AppendDirectory adds the entries of sourceDir to an existing archive
+// without recompressing it: the data of the archive is copied up to its
+// footer, the new entries follow in a gzip member of their own and a new
+// footer covering all entries ends the file. Directories already in the
+// archive are not repeated. Files named in replace are appended again and
+// supersede the archive's copy on extraction; any other name already in the
+// archive is an error. The archive is verified first and rewritten through
+// a temporary file, so a failed append leaves it unchanged.
+func AppendDirectory(archivePath, sourceDir string, replace []string, opts Options) (*Footer, error) {
+	format, err := readableFormat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if format != FormatGzip {
+		return nil, apperr.New(apperr.ErrUnsupportedFormat, "%s is a %s archive; only gzip archives can be appended to", archivePath, format)
+	}
+	footer, offset, err := locateFooter(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	manifest, err := scanEntries(archivePath, func(header *tar.Header, r io.Reader) error {
+		existing[header.Name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigest(footer, manifest); err != nil {
+		return nil, fmt.Errorf("refusing to append to a damaged archive: %w", err)
+	}
+
+	replaceable := make(map[string]bool)
+	for _, name := range replace {
+		replaceable[name] = true
+	}
+
+	durability := opts.Durability
+	if durability == "" {
+		durability = constants.DefaultDurability
+	}
+	tempPath := archivePath + constants.TempArchiveSuffix
+	newFooter, err := writeAppended(archivePath, tempPath, offset, sourceDir, opts, manifest, func(name string, isDir bool) (bool, error) {
+		switch {
+		case !existing[name]:
+			return false, nil
+		case isDir:
+			return true, nil
+		case replaceable[name]:
+			return false, nil
+		default:
+			return false, fmt.Errorf("%s is already in the archive", name)
+		}
+	}, durability != constants.DurabilityNone)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tempPath, archivePath); err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to rename archive into place: %v", err)
+	}
+	if durability == constants.DurabilityFull {
+		if err := utils.SyncDir(filepath.Dir(archivePath)); err != nil {
+			return nil, err
+		}
+	}
+	return newFooter, nil
+}
+
+// writeAppended writes the first offset bytes of archivePath followed by a
+// data member holding sourceDir and a new footer to targetPath
+func writeAppended(archivePath, targetPath string, offset int64, sourceDir string, opts Options, manifest *manifestDigest, skip func(name string, isDir bool) (bool, error), sync bool) (*Footer, error) {
+	source, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer source.Close()
+
+	file, err := os.Create(targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, io.NewSectionReader(source, 0, offset)); err != nil {
+		return nil, fmt.Errorf("failed to copy archive data: %v", err)
+	}
+
+	gzipWriter := gzip.NewWriter(file)
+	output := &switchWriter{w: gzipWriter}
+	tarWriter := tar.NewWriter(output)
+	if err := writeTree(tarWriter, sourceDir, "", opts, manifest, skip); err != nil {
+		return nil, err
+	}
+
+	if err := tarWriter.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush tar stream: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize gzip stream: %v", err)
+	}
+	footer := manifest.footer()
+	if err := writeFooter(tarWriter, output, file, footer, opts); err != nil {
+		return nil, err
+	}
+
+	if sync {
+		if err := file.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync archive file: %v", err)
+		}
+	}
+	return &footer, file.Close()
+}
+
+// ReadEntry returns the content of the last regular-file entry named name,
+// which is the copy extraction leaves in place
+func ReadEntry(archivePath, name string) ([]byte, error) {
+	var content []byte
+	found := false
+	_, err := scanEntries(archivePath, func(header *tar.Header, r io.Reader) error {
+		if header.Name != name || header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r); err != nil {
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		content = buf.Bytes()
+		found = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found in archive %s", name, archivePath)
+	}
+	return content, nil
+}
@@ -0,0 +1,113 @@
+package compress
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTree creates files below dir from a map of relative paths to content
+func writeTestTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for relPath, content := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAppendDirectory(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+	appendDir := filepath.Join(tempDir, "append")
+	writeTestTree(t, appendDir, map[string]string{
+		"a.log":     "alpha, revised",
+		"sub/e.log": "echo",
+		"new/f.log": "foxtrot",
+	})
+
+	footer, err := AppendDirectory(archivePath, appendDir, []string{"a.log"}, Options{})
+	if err != nil {
+		t.Fatalf("AppendDirectory failed: %v", err)
+	}
+	// 6 original entries plus a.log, sub/e.log, new/ and new/f.log
+	if footer.EntryCount != 10 {
+		t.Errorf("EntryCount = %d, want 10", footer.EntryCount)
+	}
+	if _, err := VerifyArchive(archivePath); err != nil {
+		t.Fatalf("Appended archive does not verify: %v", err)
+	}
+
+	targetDir := filepath.Join(tempDir, "extracted")
+	if _, err := ExtractArchive(archivePath, targetDir); err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	for relPath, want := range map[string]string{
+		"a.log":       "alpha, revised",
+		"sub/b.log":   "bravo",
+		"sub/c/d.log": "delta",
+		"sub/e.log":   "echo",
+		"new/f.log":   "foxtrot",
+	} {
+		data, err := os.ReadFile(filepath.Join(targetDir, filepath.FromSlash(relPath)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q (%v), want %q", relPath, data, err, want)
+		}
+	}
+
+	data, err := ReadEntry(archivePath, "a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "alpha, revised" {
+		t.Errorf("ReadEntry(a.log) = %q, want the appended copy", data)
+	}
+}
+
+func TestAppendDirectory_Collision(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+	before, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendDir := filepath.Join(tempDir, "append")
+	writeTestTree(t, appendDir, map[string]string{"sub/b.log": "other bravo"})
+	if _, err := AppendDirectory(archivePath, appendDir, nil, Options{}); err == nil {
+		t.Fatal("Expected an error for an entry already in the archive")
+	}
+
+	after, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("A failed append must leave the archive unchanged")
+	}
+	if _, err := os.Stat(archivePath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Temporary archive was left behind: %v", err)
+	}
+}
+
+func TestAppendDirectory_Damaged(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte in the compressed data ahead of the footer
+	data[20] ^= 0xff
+	if err := os.WriteFile(archivePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	appendDir := filepath.Join(tempDir, "append")
+	writeTestTree(t, appendDir, map[string]string{"x.log": "x-ray"})
+	if _, err := AppendDirectory(archivePath, appendDir, nil, Options{}); err == nil {
+		t.Fatal("Expected an error appending to a damaged archive")
+	}
+}
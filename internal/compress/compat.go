@@ -0,0 +1,157 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/constants"
+)
+
+// Compatibility formats are tar.xz and tar.bz2 archives for consumers that
+// cannot read tar.gz. They are written through the xz and bzip2 tools,
+// which are much slower than gzip. The footer is the last entry of the tar
+// stream, as in a plain tar, so reading it means decompressing the whole
+// archive.
+
+// compatTools maps each compatibility format to the tool writing it
+var compatTools = map[string]string{
+	constants.CompressionXz:    "xz",
+	constants.CompressionBzip2: "bzip2",
+}
+
+// IsCompatFormat reports whether compression is written in compatibility
+// mode by an external tool
+func IsCompatFormat(compression string) bool {
+	_, ok := compatTools[compression]
+	return ok
+}
+
+// ArchiveExtension returns the file extension of archives written with
+// compression; an empty compression means gzip
+func ArchiveExtension(compression string) string {
+	switch compression {
+	case constants.CompressionNone:
+		return ".tar"
+	case constants.CompressionXz:
+		return ".tar.xz"
+	case constants.CompressionBzip2:
+		return ".tar.bz2"
+	default:
+		return ".tar.gz"
+	}
+}
+
+// CheckCompression fails when the tool needed to write compression is not
+// installed, so a run can stop before the backup rather than after it
+func CheckCompression(compression string) error {
+	tool, ok := compatTools[compression]
+	if !ok {
+		return nil
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s archives need the %s tool, which was not found in PATH", compression, tool)
+	}
+	return nil
+}
+
+// writeCompatArchive pipes the tar stream of sourceDir, footer entry
+// included, through the tool of opts.Compression into file
+func writeCompatArchive(file *os.File, sourceDir, root string, skip func(name string, isDir bool) (bool, error), opts Options) (Footer, error) {
+	tool := compatTools[opts.Compression]
+	var errOut bytes.Buffer
+	args := []string{"-c"}
+	if opts.Level != 0 {
+		args = append(args, "-"+strconv.Itoa(opts.Level))
+	}
+	cmd := exec.Command(tool, args...)
+	cmd.Stdout = file
+	cmd.Stderr = &errOut
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to start %s: %v", tool, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return Footer{}, fmt.Errorf("failed to start %s: %v", tool, err)
+	}
+
+	tarWriter := tar.NewWriter(stdin)
+	manifest := newManifestDigest()
+	footer := Footer{}
+	writeErr := writeTree(tarWriter, sourceDir, root, opts, manifest, skip)
+	if writeErr == nil {
+		footer = manifest.footer()
+		writeErr = writeFooterEntry(tarWriter, footer, opts)
+	}
+
+	// Closing stdin lets the tool finish, also when writing failed
+	stdin.Close()
+	waitErr := cmd.Wait()
+	if writeErr != nil {
+		return Footer{}, writeErr
+	}
+	if waitErr != nil {
+		return Footer{}, toolError(tool, waitErr, &errOut)
+	}
+	return footer, nil
+}
+
+// xzReader streams the output of "xz -dc". A decompression error is
+// returned at the end of the stream instead of a plain io.EOF.
+type xzReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	errOut bytes.Buffer
+	done   bool
+}
+
+// openXzReader starts decompressing file with xz
+func openXzReader(file *os.File) (*xzReader, error) {
+	r := &xzReader{cmd: exec.Command("xz", "-dc")}
+	r.cmd.Stdin = file
+	r.cmd.Stderr = &r.errOut
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start xz: %v", err)
+	}
+	r.stdout = stdout
+	if err := r.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start xz: %v", err)
+	}
+	return r, nil
+}
+
+func (r *xzReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF && !r.done {
+		r.done = true
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			return n, toolError("xz", waitErr, &r.errOut)
+		}
+	}
+	return n, err
+}
+
+// Close stops xz if the stream was not read to the end
+func (r *xzReader) Close() error {
+	r.stdout.Close()
+	if !r.done {
+		r.done = true
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	}
+	return nil
+}
+
+// toolError describes a failed run of tool with its error output
+func toolError(tool string, err error, errOut *bytes.Buffer) error {
+	if message := strings.TrimSpace(errOut.String()); message != "" {
+		return fmt.Errorf("%s failed: %v: %s", tool, err, message)
+	}
+	return fmt.Errorf("%s failed: %v", tool, err)
+}
@@ -2,38 +2,345 @@ package compress
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
 )
 
+// Options controls how an archive is written
+type Options struct {
+	Compression  string         // gzip, a compatibility format (xz or bzip2), or none for a plain tar (empty means gzip)
+	Level        int            // Compression level, 1-9 (0 means the format's default)
+	Levels       map[string]int // Entry name prefix -> level for the entries below it, e.g. one source's items (gzip only)
+	Durability   string         // fsync policy: none, data, full (empty means constants.DefaultDurability)
+	Reproducible bool           // Normalize headers so identical trees produce byte-identical archives
+	ModTime      time.Time      // With Reproducible, the mtime stamped on every entry (zero means the Unix epoch)
+	VerifyRename bool           // After the rename, fsync the archive and check its size and footer again (NFS and other network filesystems)
+
+	StoreIncompressible bool // Store files that are compressed already, e.g. zstd SST files, without compressing them again (gzip only)
+	EntryChecksums      bool // Record the SHA-256 of each file in its PAX header (PAXChecksumKey); files are read twice
+
+	VolumeSize int64 // Per-item archives: split items larger than this into volumes of at most this size, see PlanVolumes (0 = one member per item)
+}
+
+// writtenArchive is what writeArchive wrote, to check the file against
+// once it is renamed into place
+type writtenArchive struct {
+	Size   int64
+	Footer Footer
+}
+
 // CompressDirectory compresses a directory to a tar.gz archive
 func CompressDirectory(sourceDir, targetPath string) error {
+	return CompressDirectoryWithOptions(sourceDir, targetPath, Options{})
+}
+
+// CompressDirectoryWithOptions compresses a directory to a tar.gz archive.
+// The archive is written to a temporary file next to targetPath and renamed
+// into place once complete, so a crash never leaves a truncated archive
+// under the final name.
+func CompressDirectoryWithOptions(sourceDir, targetPath string, opts Options) error {
+	durability := opts.Durability
+	if durability == "" {
+		durability = constants.DefaultDurability
+	}
+
+	tempPath := targetPath + constants.TempArchiveSuffix
+	written, err := writeArchive(sourceDir, "", nil, tempPath, opts, durability != constants.DurabilityNone)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, targetPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename archive into place: %v", err)
+	}
+	if opts.VerifyRename {
+		if err := verifyRenamed(targetPath, written); err != nil {
+			return err
+		}
+	}
+
+	// Persist the rename itself by syncing the parent directory
+	if durability == constants.DurabilityFull {
+		if err := utils.SyncDir(filepath.Dir(targetPath)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeArchive streams sourceDir, or only its subtree root when root is not
+// empty, into an archive file at targetPath, tar.gz unless opts.Compression
+// names a compatibility format or none. Entry names are relative to
+// sourceDir; entries for which skip returns true are left out.
+func writeArchive(sourceDir, root string, skip func(name string, isDir bool) (bool, error), targetPath string, opts Options, sync bool) (*writtenArchive, error) {
 	// Create target file
 	file, err := os.Create(targetPath)
 	if err != nil {
-		return fmt.Errorf("failed to create archive file: %v", err)
+		return nil, fmt.Errorf("failed to create archive file: %v", err)
 	}
 	defer file.Close()
 
-	// Create gzip writer
-	gzipWriter := gzip.NewWriter(file)
-	defer gzipWriter.Close()
+	var footer Footer
+	switch {
+	case opts.Compression == constants.CompressionNone:
+		footer, err = writeTarArchive(file, sourceDir, root, skip, opts)
+	case IsCompatFormat(opts.Compression):
+		footer, err = writeCompatArchive(file, sourceDir, root, skip, opts)
+	default:
+		footer, err = writeGzipArchive(file, sourceDir, root, skip, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if sync {
+		if err := file.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync archive file: %v", err)
+		}
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive size: %v", err)
+	}
+	return &writtenArchive{Size: size, Footer: footer}, file.Close()
+}
+
+// verifyRenamed checks an archive renamed into place against what was
+// written. Network filesystems such as NFS can report a write as done and
+// still lose part of it, which the first read of the file would reveal much
+// later: the fsync pushes the data to the server, then the size and the
+// footer at the end of the file are read back. An archive that fails the
+// check is removed, so no damaged archive is left under its final name.
+func verifyRenamed(path string, written *writtenArchive) error {
+	err := checkRenamed(path, written)
+	if err != nil {
+		if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) {
+			return fmt.Errorf("%v; failed to remove the archive: %v", err, removeErr)
+		}
+	}
+	return err
+}
+
+// checkRenamed does the checks of verifyRenamed
+func checkRenamed(path string, written *writtenArchive) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to reopen archive %s: %v", path, err)
+	}
+	syncErr := file.Sync()
+	file.Close()
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync archive %s: %v", path, syncErr)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat archive %s: %v", path, err)
+	}
+	if info.Size() != written.Size {
+		return apperr.New(apperr.ErrCorrupt, "archive %s is %d bytes after the rename, %d were written", path, info.Size(), written.Size)
+	}
+	footer, err := ReadFooter(path)
+	if err != nil {
+		return err
+	}
+	if *footer != written.Footer {
+		return apperr.New(apperr.ErrCorrupt, "archive %s has a different footer after the rename than was written", path)
+	}
+	return nil
+}
+
+// writeTarArchive writes the plain tar stream of sourceDir to file, with the
+// footer as its last entry like in a compatibility archive. There is
+// nothing to decompress, so reading the footer only seeks over the entries.
+func writeTarArchive(file io.Writer, sourceDir, root string, skip func(name string, isDir bool) (bool, error), opts Options) (Footer, error) {
+	buffered := bufio.NewWriterSize(file, constants.CompressionBufferSize)
+	tarWriter := tar.NewWriter(buffered)
+	manifest := newManifestDigest()
+	if err := writeTree(tarWriter, sourceDir, root, opts, manifest, skip); err != nil {
+		return Footer{}, err
+	}
+	footer := manifest.footer()
+	if err := writeFooterEntry(tarWriter, footer, opts); err != nil {
+		return Footer{}, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return Footer{}, fmt.Errorf("failed to write archive: %v", err)
+	}
+	return footer, nil
+}
+
+// writeGzipArchive writes the tar.gz stream of sourceDir to file, with the
+// footer in a gzip member of its own
+func writeGzipArchive(file io.Writer, sourceDir, root string, skip func(name string, isDir bool) (bool, error), opts Options) (Footer, error) {
+	// The tar writer goes through a switchWriter so the footer, and entries
+	// compressed at a level of their own, can be placed in gzip members of
+	// their own
+	output := &switchWriter{}
+	members := &gzipMembers{file: file, output: output}
+	if err := members.start(opts.Level); err != nil {
+		return Footer{}, err
+	}
 
 	// Create tar writer
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
+	tarWriter := tar.NewWriter(output)
+	manifest := newManifestDigest()
+	if len(opts.Levels) > 0 || opts.StoreIncompressible {
+		skip = switchLevels(tarWriter, members, sourceDir, opts, skip)
+	}
+
+	if err := writeTree(tarWriter, sourceDir, root, opts, manifest, skip); err != nil {
+		return Footer{}, err
+	}
+
+	// End the data member, then write the footer into a member of its own
+	if err := tarWriter.Flush(); err != nil {
+		return Footer{}, fmt.Errorf("failed to flush tar stream: %v", err)
+	}
+	if err := members.close(); err != nil {
+		return Footer{}, err
+	}
+	footer := manifest.footer()
+	if err := writeFooter(tarWriter, output, file, footer, opts); err != nil {
+		return Footer{}, err
+	}
+	return footer, nil
+}
+
+// gzipMembers writes the data of an archive as a sequence of gzip members
+type gzipMembers struct {
+	file    io.Writer
+	output  *switchWriter
+	current *gzip.Writer
+	level   int
+}
+
+// start ends the current member, if any, and begins one compressed at
+// level (0 means gzip's default, levelStored no compression)
+func (g *gzipMembers) start(level int) error {
+	if err := g.close(); err != nil {
+		return err
+	}
+	gzipLevel := gzip.DefaultCompression
+	switch level {
+	case 0:
+	case levelStored:
+		gzipLevel = gzip.NoCompression
+	default:
+		gzipLevel = level
+	}
+	writer, err := gzip.NewWriterLevel(g.file, gzipLevel)
+	if err != nil {
+		return fmt.Errorf("invalid gzip compression level %d: %v", level, err)
+	}
+	g.current, g.level = writer, level
+	g.output.w = writer
+	return nil
+}
+
+// close ends the current member
+func (g *gzipMembers) close() error {
+	if g.current == nil {
+		return nil
+	}
+	err := g.current.Close()
+	g.current = nil
+	if err != nil {
+		return fmt.Errorf("failed to finalize gzip stream: %v", err)
+	}
+	return nil
+}
 
-	// Walk through source directory
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+// switchLevels wraps skip so that each regular file not skipped is written
+// to a gzip member compressed at its level, starting a new member whenever
+// the level changes from the current one. Directories and other entries
+// without data stay in the current member. With opts.StoreIncompressible,
+// files of sourceDir that would not shrink are stored uncompressed.
+func switchLevels(tarWriter *tar.Writer, members *gzipMembers, sourceDir string, opts Options, skip func(name string, isDir bool) (bool, error)) func(name string, isDir bool) (bool, error) {
+	return func(name string, isDir bool) (bool, error) {
+		if skip != nil {
+			if skipped, err := skip(name, isDir); err != nil || skipped {
+				return skipped, err
+			}
+		}
+		if isDir {
+			return false, nil
+		}
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+			return false, nil
+		}
+		level := entryLevel(opts, name)
+		if opts.StoreIncompressible && incompressible(path) {
+			level = levelStored
+		}
+		if level == members.level {
+			return false, nil
+		}
+		// The padding of the previous entry belongs to its member
+		if err := tarWriter.Flush(); err != nil {
+			return false, fmt.Errorf("failed to flush tar stream: %v", err)
+		}
+		return false, members.start(level)
+	}
+}
+
+// entryLevel returns the compression level of the entry name: that of the
+// longest prefix in opts.Levels covering it, otherwise opts.Level
+func entryLevel(opts Options, name string) int {
+	level, longest := opts.Level, -1
+	for prefix, prefixLevel := range opts.Levels {
+		covers := name == prefix || strings.HasPrefix(name, prefix+"/")
+		if covers && len(prefix) > longest {
+			level, longest = prefixLevel, len(prefix)
+		}
+	}
+	return level
+}
+
+// writeTree writes the entries of sourceDir, or of its subtree root when root
+// is not empty, to tarWriter and records them in manifest. Entry names are
+// relative to sourceDir. Entries for which skip returns true are left out;
+// skip may be nil.
+func writeTree(tarWriter *tar.Writer, sourceDir, root string, opts Options, manifest *manifestDigest, skip func(name string, isDir bool) (bool, error)) error {
+	// filepath.Walk visits entries in lexical order, which keeps archive
+	// layout stable between runs
+	return filepath.Walk(filepath.Join(sourceDir, filepath.FromSlash(root)), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		// A pause of backup I/O holds compression between entries too
+		utils.WaitWhilePaused(context.Background())
+
+		// Resolve symlink targets; the second argument of FileInfoHeader is
+		// the link target, not the entry name
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
 
 		// Create tar header
-		header, err := tar.FileInfoHeader(info, info.Name())
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return err
 		}
@@ -43,27 +350,84 @@ func CompressDirectory(sourceDir, targetPath string) error {
 		if err != nil {
 			return err
 		}
-		header.Name = relPath
+		header.Name = archiveEntryName(relPath, info.IsDir())
+		if skip != nil {
+			if skipped, err := skip(header.Name, info.IsDir()); err != nil || skipped {
+				return err
+			}
+		}
+
+		// Force PAX so long paths and non-ASCII names are stored verbatim
+		header.Format = tar.FormatPAX
+
+		// The header precedes the content, so the checksum takes a pass of
+		// its own over the file
+		var entrySum []byte
+		if opts.EntryChecksums && info.Mode().IsRegular() {
+			if entrySum, err = fileSHA256(path); err != nil {
+				return err
+			}
+			if header.PAXRecords == nil {
+				header.PAXRecords = make(map[string]string)
+			}
+			header.PAXRecords[PAXChecksumKey] = hex.EncodeToString(entrySum)
+		}
+
+		if opts.Reproducible {
+			normalizeHeader(header, opts.ModTime)
+		}
 
 		// Write header
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return err
 		}
 
-		// If it's a file, write content
-		if !info.IsDir() {
+		// If it's a regular file, write content
+		contentHash := sha256.New()
+		if info.Mode().IsRegular() {
 			file, err := os.Open(path)
 			if err != nil {
 				return err
 			}
 			defer file.Close()
 
-			_, err = io.Copy(tarWriter, file)
+			_, err = io.Copy(io.MultiWriter(tarWriter, contentHash), file)
 			if err != nil {
 				return err
 			}
+			if entrySum != nil && !bytes.Equal(entrySum, contentHash.Sum(nil)) {
+				return fmt.Errorf("%s changed while it was archived", path)
+			}
 		}
 
+		manifest.add(header, contentHash.Sum(nil))
 		return nil
 	})
 }
+
+// normalizeHeader strips host-specific and volatile fields from a header
+func normalizeHeader(header *tar.Header, modTime time.Time) {
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+
+	// Backup copies get fresh mtimes on every run, so real mtimes would make
+	// otherwise identical archives differ
+	if modTime.IsZero() {
+		modTime = time.Unix(0, 0)
+	}
+	header.ModTime = modTime.Truncate(time.Second)
+}
+
+// archiveEntryName converts a relative filesystem path to a tar entry name:
+// slash separated, with a trailing slash for directories
+func archiveEntryName(relPath string, isDir bool) string {
+	name := filepath.ToSlash(relPath)
+	if isDir && name != "." {
+		name += "/"
+	}
+	return name
+}
@@ -2,12 +2,17 @@ package compress
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompressDirectory(t *testing.T) {
@@ -329,7 +334,7 @@ func verifyArchiveContents(archivePath string, expectedFiles map[string]string)
 			return fmt.Errorf("failed to read tar header: %v", err)
 		}
 
-		if header.FileInfo().IsDir() {
+		if header.FileInfo().IsDir() || header.Name == FooterEntryName {
 			continue
 		}
 
@@ -526,3 +531,396 @@ func TestCompressDirectory_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestCompressDirectoryWithOptions_Durability(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	testFiles := map[string]string{"data.log": "durable content"}
+	if err := os.WriteFile(filepath.Join(sourceDir, "data.log"), []byte(testFiles["data.log"]), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, durability := range []string{"none", "data", "full"} {
+		t.Run(durability, func(t *testing.T) {
+			archivePath := filepath.Join(tempDir, durability+".tar.gz")
+			err := CompressDirectoryWithOptions(sourceDir, archivePath, Options{Durability: durability})
+			if err != nil {
+				t.Fatalf("CompressDirectoryWithOptions failed: %v", err)
+			}
+
+			if err := verifyArchiveContents(archivePath, testFiles); err != nil {
+				t.Errorf("Archive verification failed: %v", err)
+			}
+
+			// The temporary file must have been renamed away
+			if _, err := os.Stat(archivePath + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("Temporary archive file should not remain after success")
+			}
+		})
+	}
+
+	t.Run("Failure leaves no partial archive", func(t *testing.T) {
+		archivePath := filepath.Join(tempDir, "missing.tar.gz")
+		err := CompressDirectoryWithOptions(filepath.Join(tempDir, "missing"), archivePath, Options{})
+		if err == nil {
+			t.Fatal("Expected error for missing source directory")
+		}
+		for _, path := range []string{archivePath, archivePath + ".tmp"} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("%s should not exist after a failed compression", path)
+			}
+		}
+	})
+}
+
+func TestCompressDirectoryWithOptions_VerifyRename(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	testFiles := map[string]string{"data.log": strings.Repeat("network filesystem\n", 500)}
+	if err := os.WriteFile(filepath.Join(sourceDir, "data.log"), []byte(testFiles["data.log"]), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	archivePath := filepath.Join(tempDir, "nfs.tar.gz")
+	if err := CompressDirectoryWithOptions(sourceDir, archivePath, Options{VerifyRename: true}); err != nil {
+		t.Fatalf("CompressDirectoryWithOptions failed: %v", err)
+	}
+	if err := verifyArchiveContents(archivePath, testFiles); err != nil {
+		t.Errorf("Archive verification failed: %v", err)
+	}
+
+	// Simulate a short write the server acknowledged anyway
+	written, err := writeArchive(sourceDir, "", nil, archivePath, Options{}, false)
+	if err != nil {
+		t.Fatalf("writeArchive failed: %v", err)
+	}
+	if err := verifyRenamed(archivePath, written); err != nil {
+		t.Fatalf("An intact archive should verify: %v", err)
+	}
+	if err := os.Truncate(archivePath, written.Size-10); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyRenamed(archivePath, written); err == nil || !strings.Contains(err.Error(), "were written") {
+		t.Errorf("verifyRenamed error = %v, want a size mismatch", err)
+	}
+	if _, err := os.Stat(archivePath); !os.IsNotExist(err) {
+		t.Errorf("The short archive should have been removed: %v", err)
+	}
+
+	// The right size, but the end of the file never reached the server
+	if written, err = writeArchive(sourceDir, "", nil, archivePath, Options{}, false); err != nil {
+		t.Fatalf("writeArchive failed: %v", err)
+	}
+	data, _ := os.ReadFile(archivePath)
+	if err := os.WriteFile(archivePath, append(data[:len(data)-10], make([]byte, 10)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyRenamed(archivePath, written); err == nil {
+		t.Error("verifyRenamed should fail when the footer cannot be read back")
+	}
+	if _, err := os.Stat(archivePath); !os.IsNotExist(err) {
+		t.Errorf("The archive with a lost footer should have been removed: %v", err)
+	}
+}
+
+func TestCompressDirectoryWithOptions_Levels(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	testFiles := map[string]string{
+		"logs/app.log":     strings.Repeat("GET /index.html 200\n", 2000),
+		"logs/old/app.log": strings.Repeat("GET /about.html 404\n", 2000),
+		"sst/000012.sst":   strings.Repeat("sst block ", 500),
+	}
+	for relPath, content := range testFiles {
+		fullPath := filepath.Join(sourceDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	archivePath := filepath.Join(tempDir, "levels.tar.gz")
+	opts := Options{Level: 1, Levels: map[string]int{"logs": 9}}
+	if err := CompressDirectoryWithOptions(sourceDir, archivePath, opts); err != nil {
+		t.Fatalf("CompressDirectoryWithOptions failed: %v", err)
+	}
+	if err := verifyArchiveContents(archivePath, testFiles); err != nil {
+		t.Errorf("Archive verification failed: %v", err)
+	}
+	if _, err := VerifyArchive(archivePath); err != nil {
+		t.Errorf("VerifyArchive failed: %v", err)
+	}
+
+	// The root entry, logs/ at level 9, sst/ back at level 1, then the footer
+	if members := countGzipMembers(t, archivePath); members != 4 {
+		t.Errorf("Archive has %d gzip members, want 4", members)
+	}
+}
+
+// countGzipMembers returns the number of gzip members of an archive
+func countGzipMembers(t *testing.T, archivePath string) int {
+	t.Helper()
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	members := 0
+	reader := bufio.NewReader(file)
+	gzipReader, err := gzip.NewReader(reader)
+	for err == nil {
+		gzipReader.Multistream(false)
+		if _, err = io.Copy(io.Discard, gzipReader); err != nil {
+			t.Fatalf("Failed to read gzip member %d: %v", members+1, err)
+		}
+		members++
+		err = gzipReader.Reset(reader)
+	}
+	if err != io.EOF {
+		t.Fatalf("Failed to read gzip member %d: %v", members+1, err)
+	}
+	return members
+}
+
+func TestCompressDirectoryWithOptions_StoreIncompressible(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	random := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	testFiles := map[string]string{
+		"logs/app.log":        strings.Repeat("GET /index.html 200\n", 20000),
+		"sst/000012.sst":      string(random),
+		"sst/more/000013.sst": string(random[1:]),
+	}
+	for relPath, content := range testFiles {
+		fullPath := filepath.Join(sourceDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	archivePath := filepath.Join(tempDir, "stored.tar.gz")
+	if err := CompressDirectoryWithOptions(sourceDir, archivePath, Options{StoreIncompressible: true}); err != nil {
+		t.Fatalf("CompressDirectoryWithOptions failed: %v", err)
+	}
+	if err := verifyArchiveContents(archivePath, testFiles); err != nil {
+		t.Errorf("Archive verification failed: %v", err)
+	}
+	if _, err := VerifyArchive(archivePath); err != nil {
+		t.Errorf("VerifyArchive failed: %v", err)
+	}
+
+	// Everything up to sst/, the stored SST files with the directory
+	// between them, then the footer
+	if members := countGzipMembers(t, archivePath); members != 3 {
+		t.Errorf("Archive has %d gzip members, want 3", members)
+	}
+}
+
+func TestIncompressible(t *testing.T) {
+	tempDir := t.TempDir()
+	random := make([]byte, 128*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := []byte(strings.Repeat("2024-03-15 INFO request served\n", 5000))
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"000012.sst", random, true},
+		{"000013.sst", text, false},
+		{"app.log.gz", text, true},
+		{"small.bin", random[:1024], false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tempDir, tt.name)
+		if err := os.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := incompressible(path); got != tt.want {
+			t.Errorf("incompressible(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEntryLevel(t *testing.T) {
+	opts := Options{Level: 3, Levels: map[string]int{"logs": 9, "logs/cold": 1}}
+	tests := []struct {
+		name string
+		want int
+	}{
+		{".", 3},
+		{"logs/", 9},
+		{"logs/app.log", 9},
+		{"logs/cold/old.log", 1},
+		{"logs2/app.log", 3},
+		{"manifest.json", 3},
+	}
+	for _, tt := range tests {
+		if got := entryLevel(opts, tt.name); got != tt.want {
+			t.Errorf("entryLevel(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompressDirectory_LongAndUnicodeNames(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+
+	longDir := strings.Repeat("nested_directory_", 8)
+	testFiles := map[string]string{
+		longDir + "/" + strings.Repeat("x", 120) + ".log": "long path content",
+		"数据库/日志文件.log":                                    "unicode content",
+		"café/résumé-ñ.txt":                               "accented content",
+	}
+
+	for relPath, content := range testFiles {
+		fullPath := filepath.Join(sourceDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", relPath, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", relPath, err)
+		}
+	}
+
+	archivePath := filepath.Join(tempDir, "names.tar.gz")
+	if err := CompressDirectory(sourceDir, archivePath); err != nil {
+		t.Fatalf("CompressDirectory failed: %v", err)
+	}
+
+	if err := verifyArchiveContents(archivePath, testFiles); err != nil {
+		t.Errorf("Archive verification failed: %v", err)
+	}
+
+	// Every entry must carry a PAX header and directories a trailing slash
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to create gzip reader: %v", err)
+	}
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar header: %v", err)
+		}
+		if header.Name == FooterEntryName {
+			continue
+		}
+		if header.Format != tar.FormatPAX {
+			t.Errorf("Entry %s has format %v, want PAX", header.Name, header.Format)
+		}
+		if header.Typeflag == tar.TypeDir && header.Name != "." && !strings.HasSuffix(header.Name, "/") {
+			t.Errorf("Directory entry %s should end with a slash", header.Name)
+		}
+	}
+}
+
+func TestCompressDirectoryWithOptions_Reproducible(t *testing.T) {
+	tempDir := t.TempDir()
+	testFiles := map[string]string{
+		"b/second.log": "second",
+		"a/first.log":  "first",
+		"root.log":     "root",
+	}
+
+	// Two identical trees created at different times
+	createTree := func(dir string, mtime time.Time) {
+		for relPath, content := range testFiles {
+			fullPath := filepath.Join(dir, filepath.FromSlash(relPath))
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			if err := os.Chtimes(fullPath, mtime, mtime); err != nil {
+				t.Fatalf("Failed to set mtime: %v", err)
+			}
+		}
+	}
+	treeA := filepath.Join(tempDir, "treeA")
+	treeB := filepath.Join(tempDir, "treeB")
+	createTree(treeA, time.Now().Add(-time.Hour))
+	createTree(treeB, time.Now())
+
+	archiveA := filepath.Join(tempDir, "a.tar.gz")
+	archiveB := filepath.Join(tempDir, "b.tar.gz")
+	opts := Options{Reproducible: true}
+	if err := CompressDirectoryWithOptions(treeA, archiveA, opts); err != nil {
+		t.Fatalf("Compress tree A failed: %v", err)
+	}
+	if err := CompressDirectoryWithOptions(treeB, archiveB, opts); err != nil {
+		t.Fatalf("Compress tree B failed: %v", err)
+	}
+
+	dataA, err := os.ReadFile(archiveA)
+	if err != nil {
+		t.Fatalf("Failed to read archive A: %v", err)
+	}
+	dataB, err := os.ReadFile(archiveB)
+	if err != nil {
+		t.Fatalf("Failed to read archive B: %v", err)
+	}
+	if !bytes.Equal(dataA, dataB) {
+		t.Error("Reproducible archives of identical trees should be byte-identical")
+	}
+
+	if err := verifyArchiveContents(archiveA, testFiles); err != nil {
+		t.Errorf("Archive verification failed: %v", err)
+	}
+
+	t.Run("Fixed mod time", func(t *testing.T) {
+		stamp := time.Unix(1700000000, 0)
+		archivePath := filepath.Join(tempDir, "stamped.tar.gz")
+		if err := CompressDirectoryWithOptions(treeA, archivePath, Options{Reproducible: true, ModTime: stamp}); err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+
+		file, err := os.Open(archivePath)
+		if err != nil {
+			t.Fatalf("Failed to open archive: %v", err)
+		}
+		defer file.Close()
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("Failed to create gzip reader: %v", err)
+		}
+		tarReader := tar.NewReader(gzReader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Failed to read tar header: %v", err)
+			}
+			if !header.ModTime.Equal(stamp) {
+				t.Errorf("Entry %s has mtime %v, want %v", header.Name, header.ModTime, stamp)
+			}
+			if header.Uid != 0 || header.Gid != 0 || header.Uname != "" || header.Gname != "" {
+				t.Errorf("Entry %s should have normalized ownership", header.Name)
+			}
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"archiveFiles/internal/constants"
+)
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// EstimateRatio estimates the gzip compression ratio (compressed / raw) of
+// the files under paths by compressing chunks spread evenly over each file,
+// reading at most sampleBytes in total. It returns the ratio and the number
+// of bytes sampled; with nothing to sample the ratio is 1.
+func EstimateRatio(paths []string, sampleBytes int64) (float64, int64, error) {
+	var files []string
+	var fileSizes []int64
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() && info.Size() > 0 {
+				files = append(files, path)
+				fileSizes = append(fileSizes, info.Size())
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to scan %s: %v", root, err)
+		}
+	}
+	if len(files) == 0 || sampleBytes <= 0 {
+		return 1, 0, nil
+	}
+
+	// Each file gets an equal share of the budget, in whole chunks
+	perFile := sampleBytes / int64(len(files))
+	if perFile < constants.EstimateChunkSize {
+		perFile = constants.EstimateChunkSize
+	}
+
+	compressed := &countingWriter{}
+	gzipWriter := gzip.NewWriter(compressed)
+	var sampled int64
+	buf := make([]byte, constants.EstimateChunkSize)
+	for i, path := range files {
+		if sampled >= sampleBytes {
+			break
+		}
+		n, err := sampleFile(path, fileSizes[i], perFile, buf, gzipWriter)
+		if err != nil {
+			return 0, 0, err
+		}
+		sampled += n
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return 0, 0, err
+	}
+	if sampled == 0 {
+		return 1, 0, nil
+	}
+	return float64(compressed.n) / float64(sampled), sampled, nil
+}
+
+// sampleFile writes up to budget bytes of a file to w, as chunks taken at
+// evenly spaced offsets
+func sampleFile(path string, size, budget int64, buf []byte, w io.Writer) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	chunkSize := int64(len(buf))
+	chunks := budget / chunkSize
+	if chunks < 1 {
+		chunks = 1
+	}
+	stride := size / chunks
+	if stride < chunkSize {
+		stride = chunkSize
+	}
+
+	var total int64
+	for offset := int64(0); offset < size && total < budget; offset += stride {
+		n, err := file.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return total, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return total, err
+		}
+		total += int64(n)
+	}
+	return total, nil
+}
@@ -0,0 +1,65 @@
+package compress
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEstimateRatio(t *testing.T) {
+	dir := t.TempDir()
+
+	repetitive := filepath.Join(dir, "repetitive.log")
+	if err := os.WriteFile(repetitive, bytes.Repeat([]byte("GET /index.html 200\n"), 50000), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	random := make([]byte, 512*1024)
+	rand.Read(random)
+	randomDir := filepath.Join(dir, "db")
+	if err := os.MkdirAll(randomDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(randomDir, "000001.sst"), random, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	t.Run("Compressible data", func(t *testing.T) {
+		ratio, sampled, err := EstimateRatio([]string{repetitive}, 1024*1024)
+		if err != nil {
+			t.Fatalf("EstimateRatio failed: %v", err)
+		}
+		if sampled == 0 || ratio > 0.1 {
+			t.Errorf("ratio = %.3f, sampled = %d, expected a small ratio", ratio, sampled)
+		}
+	})
+
+	t.Run("Random data in a directory", func(t *testing.T) {
+		ratio, _, err := EstimateRatio([]string{randomDir}, 1024*1024)
+		if err != nil {
+			t.Fatalf("EstimateRatio failed: %v", err)
+		}
+		if ratio < 0.95 {
+			t.Errorf("ratio = %.3f, random data should not compress", ratio)
+		}
+	})
+
+	t.Run("Sample budget", func(t *testing.T) {
+		_, sampled, err := EstimateRatio([]string{repetitive, randomDir}, 128*1024)
+		if err != nil {
+			t.Fatalf("EstimateRatio failed: %v", err)
+		}
+		if sampled > 128*1024 {
+			t.Errorf("sampled %d bytes, budget was %d", sampled, 128*1024)
+		}
+	})
+
+	t.Run("Nothing to sample", func(t *testing.T) {
+		ratio, sampled, err := EstimateRatio([]string{t.TempDir()}, 1024)
+		if err != nil || ratio != 1 || sampled != 0 {
+			t.Errorf("EstimateRatio() = %v, %d, %v; want 1, 0, nil", ratio, sampled, err)
+		}
+	})
+}
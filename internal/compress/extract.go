@@ -0,0 +1,148 @@
+package compress
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+)
+
+// ExtractArchive unpacks a gzip or plain tar archive into targetDir,
+// recomputing the manifest digest on the way and comparing it with the
+// footer. On error targetDir may hold a partial tree; callers extract into a
+// staging directory.
+func ExtractArchive(archivePath, targetDir string) (*Footer, error) {
+	footer, err := ReadFooter(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := openTarStream(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	if err := os.MkdirAll(targetDir, constants.DirPermission); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", targetDir, err)
+	}
+
+	manifest := newManifestDigest()
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return footer, fmt.Errorf("failed to read archive entry: %v", err)
+		}
+		if header.Name == FooterEntryName {
+			continue
+		}
+
+		contentSum, err := extractEntry(tarReader, header, targetDir)
+		if err != nil {
+			return footer, err
+		}
+		if err := checkEntrySum(header, contentSum); err != nil {
+			return footer, err
+		}
+		manifest.add(header, contentSum)
+	}
+
+	return footer, checkDigest(footer, manifest)
+}
+
+// extractEntry writes one tar entry below targetDir and returns the SHA-256
+// of its content
+func extractEntry(content io.Reader, header *tar.Header, targetDir string) ([]byte, error) {
+	contentHash := sha256.New()
+	path, err := entryPath(targetDir, header.Name)
+	if err != nil {
+		return nil, err
+	}
+	// Entries must not be written through a symlink extracted earlier. The
+	// "." entry is the target directory itself.
+	if path != filepath.Clean(targetDir) && (!resolvesInside(targetDir, filepath.Dir(path)) ||
+		(header.Typeflag != tar.TypeSymlink && !resolvesInside(targetDir, path))) {
+		return nil, apperr.New(apperr.ErrCorrupt, "archive entry %q points outside the target directory", header.Name)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(path, os.FileMode(header.Mode).Perm()|0700); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", path, err)
+		}
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(path), constants.DirPermission); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %v", header.Name, err)
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", path, err)
+		}
+		_, err = io.Copy(io.MultiWriter(out, contentHash), content)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %v", header.Name, err)
+		}
+		os.Chtimes(path, header.ModTime, header.ModTime)
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(path), constants.DirPermission); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %v", header.Name, err)
+		}
+		if err := os.Symlink(header.Linkname, path); err != nil {
+			return nil, fmt.Errorf("failed to create symlink %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported archive entry %s (type %c)", header.Name, header.Typeflag)
+	}
+	return contentHash.Sum(nil), nil
+}
+
+// entryPath maps an archive entry name to a path below targetDir, rejecting
+// names that would escape it
+func entryPath(targetDir, name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", apperr.New(apperr.ErrCorrupt, "archive entry %q points outside the target directory", name)
+	}
+	return filepath.Join(targetDir, cleaned), nil
+}
+
+// resolvesInside reports whether path, or its nearest existing ancestor,
+// resolves to a location inside root once symlinks are followed
+func resolvesInside(root, path string) bool {
+	existing := path
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return false
+		}
+		existing = parent
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	realPath, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		// A dangling symlink leads nowhere we could write to safely
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, realPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
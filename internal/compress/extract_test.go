@@ -0,0 +1,97 @@
+package compress
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+)
+
+func TestExtractArchive(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+	targetDir := filepath.Join(tempDir, "extracted")
+
+	footer, err := ExtractArchive(archivePath, targetDir)
+	if err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	if footer.EntryCount != 6 {
+		t.Errorf("EntryCount = %d, want 6", footer.EntryCount)
+	}
+
+	for relPath, want := range map[string]string{"a.log": "alpha", "sub/b.log": "bravo", "sub/c/d.log": "delta"} {
+		data, err := os.ReadFile(filepath.Join(targetDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			t.Errorf("%s was not extracted: %v", relPath, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s content = %q, want %q", relPath, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, FooterEntryName)); !os.IsNotExist(err) {
+		t.Errorf("Footer entry should not be extracted, stat error: %v", err)
+	}
+}
+
+func TestExtractArchive_Corrupt(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+
+	// Pair this archive's data with the footer of an archive whose a.log differs
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.log"), []byte("ALPHA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otherArchive := filepath.Join(tempDir, "other.tar.gz")
+	if err := CompressDirectory(sourceDir, otherArchive); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherData, err := os.ReadFile(otherArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dataOffset := findFooter(data)
+	_, otherOffset := findFooter(otherData)
+	spliced := filepath.Join(tempDir, "spliced.tar.gz")
+	if err := os.WriteFile(spliced, append(data[:dataOffset:dataOffset], otherData[otherOffset:]...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ExtractArchive(spliced, filepath.Join(tempDir, "extracted"))
+	if !errors.Is(err, apperr.ErrCorrupt) {
+		t.Errorf("Expected a corruption error, got %v", err)
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	targetDir := t.TempDir()
+	for _, name := range []string{"../escape", "/etc/passwd", "sub/../../escape"} {
+		if _, err := entryPath(targetDir, name); err == nil {
+			t.Errorf("entryPath(%q) should be rejected", name)
+		}
+	}
+	if path, err := entryPath(targetDir, "sub/ok.log"); err != nil || path != filepath.Join(targetDir, "sub", "ok.log") {
+		t.Errorf("entryPath(sub/ok.log) = %q, %v", path, err)
+	}
+}
+
+func TestResolvesInside(t *testing.T) {
+	targetDir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(targetDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !resolvesInside(targetDir, filepath.Join(targetDir, "new", "file")) {
+		t.Error("A path below the target should resolve inside it")
+	}
+	if resolvesInside(targetDir, filepath.Join(targetDir, "link", "file")) {
+		t.Error("A path through a symlink to another directory should not resolve inside the target")
+	}
+}
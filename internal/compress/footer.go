@@ -0,0 +1,290 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"archiveFiles/internal/apperr"
+)
+
+// Archive footer constants
+const (
+	FooterEntryName  = ".archivefiles-footer.json" // Tar entry holding the footer
+	footerMemberName = "archivefiles-footer"       // gzip member name marking the footer
+	footerVersion    = 2                           // Version 1 digests covered only entry names, sizes and content hashes
+	footerSearchSize = 64 * 1024                   // Bytes read from the end of the archive when locating the footer
+)
+
+// Footer is the self-test trailer stored as the last entry of every archive.
+// It lives in a separate gzip member so it can be read from the tail of the
+// file without decompressing the whole archive.
+type Footer struct {
+	Version        int    `json:"version"`
+	EntryCount     int    `json:"entry_count"`     // Number of tar entries before the footer
+	ManifestSHA256 string `json:"manifest_sha256"` // Digest over entry names, types, link targets, modes, sizes and content hashes
+}
+
+// switchWriter forwards writes to a replaceable destination
+type switchWriter struct {
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// manifestDigest accumulates the digest recorded in the footer. The version
+// 1 digest is kept alongside so archives written before version 2 still
+// verify.
+type manifestDigest struct {
+	hash   hash.Hash
+	hashV1 hash.Hash
+	count  int
+}
+
+func newManifestDigest() *manifestDigest {
+	return &manifestDigest{hash: sha256.New(), hashV1: sha256.New()}
+}
+
+// add records one archive entry
+func (m *manifestDigest) add(header *tar.Header, contentSum []byte) {
+	fmt.Fprintf(m.hash, "%s\t%c\t%s\t%o\t%d\t%x\n", header.Name, header.Typeflag, header.Linkname, header.Mode, header.Size, contentSum)
+	fmt.Fprintf(m.hashV1, "%s\t%d\t%x\n", header.Name, header.Size, contentSum)
+	m.count++
+}
+
+// footer returns the footer describing all recorded entries
+func (m *manifestDigest) footer() Footer {
+	return Footer{
+		Version:        footerVersion,
+		EntryCount:     m.count,
+		ManifestSHA256: fmt.Sprintf("%x", m.hash.Sum(nil)),
+	}
+}
+
+// writeFooter writes the footer entry and the tar end-of-archive marker into
+// a new gzip member appended to file
+func writeFooter(tarWriter *tar.Writer, output *switchWriter, file io.Writer, footer Footer, opts Options) error {
+	footerWriter := gzip.NewWriter(file)
+	footerWriter.Name = footerMemberName
+	output.w = footerWriter
+
+	if err := writeFooterEntry(tarWriter, footer, opts); err != nil {
+		return err
+	}
+	if err := footerWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive footer: %v", err)
+	}
+	return nil
+}
+
+// writeFooterEntry writes the footer as the last tar entry and closes the
+// tar stream
+func writeFooterEntry(tarWriter *tar.Writer, footer Footer, opts Options) error {
+	data, err := json.Marshal(footer)
+	if err != nil {
+		return fmt.Errorf("failed to encode archive footer: %v", err)
+	}
+
+	modTime := time.Now()
+	if opts.Reproducible {
+		modTime = opts.ModTime
+		if modTime.IsZero() {
+			modTime = time.Unix(0, 0)
+		}
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     FooterEntryName,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  modTime.Truncate(time.Second),
+		Format:   tar.FormatPAX,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive footer: %v", err)
+	}
+	if _, err := tarWriter.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive footer: %v", err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finalize tar stream: %v", err)
+	}
+	return nil
+}
+
+// ReadFooter reads the footer from the last few KB of an archive. A missing
+// or corrupt footer means the archive is truncated or was not written by
+// this tool.
+func ReadFooter(archivePath string) (*Footer, error) {
+	format, err := readableFormat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if format != FormatGzip {
+		return readTarFooter(archivePath)
+	}
+	footer, _, err := locateFooter(archivePath)
+	return footer, err
+}
+
+// locateFooter reads the footer of an archive and returns it with the offset
+// of the gzip member holding it
+func locateFooter(archivePath string) (*Footer, int64, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat archive: %v", err)
+	}
+
+	tailSize := int64(footerSearchSize)
+	if info.Size() < tailSize {
+		tailSize = info.Size()
+	}
+	tail := make([]byte, tailSize)
+	if _, err := file.ReadAt(tail, info.Size()-tailSize); err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read archive tail: %v", err)
+	}
+
+	footer, offset := findFooter(tail)
+	if offset < 0 {
+		return nil, 0, noFooterError(archivePath)
+	}
+	return footer, info.Size() - tailSize + int64(offset), nil
+}
+
+// findFooter scans data backwards for the gzip member carrying the footer
+// and returns it with its offset, or -1 when there is none
+func findFooter(data []byte) (*Footer, int) {
+	magic := []byte{0x1f, 0x8b, 0x08}
+	for i := bytes.LastIndex(data, magic); i >= 0; i = bytes.LastIndex(data[:i], magic) {
+		if footer, ok := parseFooterMember(data[i:]); ok {
+			return footer, i
+		}
+	}
+	return nil, -1
+}
+
+// parseFooterMember decodes the gzip member at the start of data as the
+// footer: a member named footerMemberName whose tar stream starts with the
+// footer entry and then ends. The member is read to its end so that its
+// gzip checksum is validated.
+func parseFooterMember(data []byte) (*Footer, bool) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil || gzipReader.Name != footerMemberName {
+		return nil, false
+	}
+	gzipReader.Multistream(false)
+
+	tarReader := tar.NewReader(gzipReader)
+	header, err := tarReader.Next()
+	if err != nil || header.Name != FooterEntryName {
+		return nil, false
+	}
+
+	footer, err := decodeFooter(tarReader)
+	if err != nil {
+		return nil, false
+	}
+
+	// Drain the member so the gzip checksum is validated
+	if _, err := io.Copy(io.Discard, gzipReader); err != nil {
+		return nil, false
+	}
+	return footer, true
+}
+
+// decodeFooter decodes the content of the footer entry
+func decodeFooter(r io.Reader) (*Footer, error) {
+	var footer Footer
+	if err := json.NewDecoder(r).Decode(&footer); err != nil {
+		return nil, err
+	}
+	return &footer, nil
+}
+
+// VerifyArchive streams the whole archive, recomputes the manifest digest
+// and compares it with the footer
+func VerifyArchive(archivePath string) (*Footer, error) {
+	footer, err := ReadFooter(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := scanEntries(archivePath, nil)
+	if err != nil {
+		return footer, err
+	}
+	return footer, checkDigest(footer, manifest)
+}
+
+// scanEntries streams every entry of an archive except the footer, passing
+// each to visit (which may be nil) and recording it in a manifest digest.
+// visit may read the entry content from r.
+func scanEntries(archivePath string, visit func(header *tar.Header, r io.Reader) error) (*manifestDigest, error) {
+	stream, err := openTarStream(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	manifest := newManifestDigest()
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive entry: %v", err)
+		}
+		if header.Name == FooterEntryName {
+			continue
+		}
+
+		contentHash := sha256.New()
+		content := io.TeeReader(tarReader, contentHash)
+		if visit != nil {
+			if err := visit(header, content); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", header.Name, err)
+		}
+		contentSum := contentHash.Sum(nil)
+		if err := checkEntrySum(header, contentSum); err != nil {
+			return nil, err
+		}
+		manifest.add(header, contentSum)
+	}
+	return manifest, nil
+}
+
+// checkDigest compares the digest of the entries actually read with the footer
+func checkDigest(footer *Footer, manifest *manifestDigest) error {
+	actual := manifest.footer()
+	if footer.Version < footerVersion {
+		actual.ManifestSHA256 = fmt.Sprintf("%x", manifest.hashV1.Sum(nil))
+	}
+	if actual.EntryCount != footer.EntryCount {
+		return apperr.New(apperr.ErrCorrupt, "entry count mismatch (footer: %d, archive: %d)", footer.EntryCount, actual.EntryCount)
+	}
+	if actual.ManifestSHA256 != footer.ManifestSHA256 {
+		return apperr.New(apperr.ErrCorrupt, "manifest digest mismatch (footer: %s, archive: %s)", footer.ManifestSHA256, actual.ManifestSHA256)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package compress
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createFooterTestArchive(t *testing.T) (string, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	files := map[string]string{
+		"a.log":       "alpha",
+		"sub/b.log":   "bravo",
+		"sub/c/d.log": "delta",
+	}
+	for relPath, content := range files {
+		fullPath := filepath.Join(sourceDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	archivePath := filepath.Join(tempDir, "footer.tar.gz")
+	if err := CompressDirectory(sourceDir, archivePath); err != nil {
+		t.Fatalf("CompressDirectory failed: %v", err)
+	}
+	return tempDir, archivePath
+}
+
+func TestReadFooter(t *testing.T) {
+	_, archivePath := createFooterTestArchive(t)
+
+	footer, err := ReadFooter(archivePath)
+	if err != nil {
+		t.Fatalf("ReadFooter failed: %v", err)
+	}
+
+	// Root dir, a.log, sub/, sub/b.log, sub/c/, sub/c/d.log
+	if footer.EntryCount != 6 {
+		t.Errorf("EntryCount = %d, want 6", footer.EntryCount)
+	}
+	if len(footer.ManifestSHA256) != 64 {
+		t.Errorf("ManifestSHA256 has unexpected length: %q", footer.ManifestSHA256)
+	}
+	if footer.Version != footerVersion {
+		t.Errorf("Version = %d, want %d", footer.Version, footerVersion)
+	}
+}
+
+func TestReadFooter_Truncated(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	for _, cut := range []int{1, 16, len(data) / 2} {
+		truncated := filepath.Join(tempDir, "truncated.tar.gz")
+		if err := os.WriteFile(truncated, data[:len(data)-cut], 0644); err != nil {
+			t.Fatalf("Failed to write truncated archive: %v", err)
+		}
+		if _, err := ReadFooter(truncated); err == nil {
+			t.Errorf("Expected ReadFooter to fail when %d bytes are cut", cut)
+		}
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+
+	if _, err := VerifyArchive(archivePath); err != nil {
+		t.Errorf("VerifyArchive failed on a valid archive: %v", err)
+	}
+
+	// Splice another archive's footer onto this archive's data
+	otherSource := filepath.Join(tempDir, "other")
+	if err := os.MkdirAll(otherSource, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(otherSource, "x.log"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	otherArchive := filepath.Join(tempDir, "other.tar.gz")
+	if err := CompressDirectory(otherSource, otherArchive); err != nil {
+		t.Fatalf("CompressDirectory failed: %v", err)
+	}
+
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	otherData, err := os.ReadFile(otherArchive)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	_, dataOffset := findFooter(data)
+	_, otherOffset := findFooter(otherData)
+	if dataOffset < 0 || otherOffset < 0 {
+		t.Fatal("Expected both archives to contain a footer")
+	}
+
+	spliced := filepath.Join(tempDir, "spliced.tar.gz")
+	splicedData := append(append([]byte{}, data[:dataOffset]...), otherData[otherOffset:]...)
+	if err := os.WriteFile(spliced, splicedData, 0644); err != nil {
+		t.Fatalf("Failed to write spliced archive: %v", err)
+	}
+	if _, err := ReadFooter(spliced); err != nil {
+		t.Fatalf("ReadFooter should still find the spliced footer: %v", err)
+	}
+	if _, err := VerifyArchive(spliced); err == nil {
+		t.Error("Expected VerifyArchive to detect a mismatched footer")
+	}
+
+	if _, err := VerifyArchive(filepath.Join(tempDir, "missing.tar.gz")); err == nil {
+		t.Error("Expected error for missing archive")
+	}
+}
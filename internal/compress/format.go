@@ -0,0 +1,186 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"archiveFiles/internal/apperr"
+)
+
+// Format is the container format of an archive as recognised from its
+// leading bytes. File extensions are never consulted: artifacts are often
+// renamed by the tooling that moves them around.
+type Format string
+
+// Archive formats
+const (
+	FormatGzip      Format = "gzip"      // Written by archiveFiles
+	FormatTar       Format = "tar"       // A decompressed archive, e.g. after gunzip
+	FormatIndexed   Format = "per-item"  // A per-item archive directory
+	FormatZstd      Format = "zstd"      // Not readable
+	FormatLZ4       Format = "lz4"       // Not readable
+	FormatXz        Format = "xz"        // Compatibility format, read through the xz tool
+	FormatBzip2     Format = "bzip2"     // Compatibility format
+	FormatZip       Format = "zip"       // Not readable
+	FormatEncrypted Format = "encrypted" // age, OpenSSL or PGP container, not readable
+	FormatUnknown   Format = "unknown"
+)
+
+// sniffSize is the number of leading bytes needed to recognise every format;
+// the tar magic sits at offset 257
+const sniffSize = 512
+
+// signatures are the magic bytes of each format at their offset, in
+// lookup order
+var signatures = []struct {
+	format Format
+	offset int
+	magic  []byte
+}{
+	{FormatGzip, 0, []byte{0x1f, 0x8b}},
+	{FormatZstd, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatLZ4, 0, []byte{0x04, 0x22, 0x4d, 0x18}},
+	{FormatXz, 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{FormatBzip2, 0, []byte("BZh")},
+	{FormatZip, 0, []byte("PK\x03\x04")},
+	{FormatZip, 0, []byte("PK\x05\x06")}, // Empty zip
+	{FormatEncrypted, 0, []byte("age-encryption.org/")},
+	{FormatEncrypted, 0, []byte("-----BEGIN AGE ENCRYPTED FILE-----")},
+	{FormatEncrypted, 0, []byte("-----BEGIN PGP MESSAGE-----")},
+	{FormatEncrypted, 0, []byte("Salted__")}, // openssl enc
+	{FormatTar, 257, []byte("ustar")},
+}
+
+// DetectFormat reports the format of the archive at path from its content
+func DetectFormat(path string) (Format, error) {
+	if IsIndexed(path) {
+		return FormatIndexed, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FormatUnknown, fmt.Errorf("failed to read archive header: %v", err)
+	}
+	return sniffFormat(head[:n]), nil
+}
+
+// sniffFormat matches the leading bytes of a file against the signatures
+func sniffFormat(head []byte) Format {
+	for _, sig := range signatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.format
+		}
+	}
+	return FormatUnknown
+}
+
+// readableFormat detects the format of a single-file archive and fails with
+// ErrUnsupportedFormat unless its tar entries can be read
+func readableFormat(archivePath string) (Format, error) {
+	format, err := DetectFormat(archivePath)
+	if err != nil {
+		return format, err
+	}
+	switch format {
+	case FormatGzip, FormatTar, FormatXz, FormatBzip2:
+		return format, nil
+	case FormatIndexed:
+		return format, apperr.New(apperr.ErrUnsupportedFormat, "%s is a per-item archive directory, not a single archive file", archivePath)
+	case FormatUnknown:
+		return format, apperr.New(apperr.ErrUnsupportedFormat, "%s is not a recognised archive", archivePath)
+	default:
+		return format, apperr.New(apperr.ErrUnsupportedFormat, "%s is a %s file; only gzip, xz, bzip2 and plain tar archives can be read", archivePath, format)
+	}
+}
+
+// tarStream is the decompressed tar stream of an archive
+type tarStream struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close releases the decompressor and the file
+func (s *tarStream) Close() error {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i].Close()
+	}
+	return nil
+}
+
+// openTarStream opens an archive for reading its tar entries, decompressing
+// it unless it is a plain tar
+func openTarStream(archivePath string) (*tarStream, error) {
+	format, err := readableFormat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	switch format {
+	case FormatTar:
+		return &tarStream{Reader: file, closers: []io.Closer{file}}, nil
+	case FormatBzip2:
+		return &tarStream{Reader: bzip2.NewReader(file), closers: []io.Closer{file}}, nil
+	case FormatXz:
+		xz, err := openXzReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &tarStream{Reader: xz, closers: []io.Closer{file, xz}}, nil
+	}
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	return &tarStream{Reader: gzipReader, closers: []io.Closer{file, gzipReader}}, nil
+}
+
+// readTarFooter finds the footer entry of a plain tar, xz or bzip2 archive.
+// Unlike a gzip archive these have no separate footer member, so the
+// entries are walked up to the footer. In a plain tar their content is
+// seeked over; the others must be decompressed in full.
+func readTarFooter(archivePath string) (*Footer, error) {
+	stream, err := openTarStream(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	// stream.Reader is the file itself for a plain tar, which tar.Reader
+	// can seek in
+	tarReader := tar.NewReader(stream.Reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, apperr.Wrap(apperr.ErrCorrupt, err, "failed to read archive entry")
+		}
+		if header.Name != FooterEntryName {
+			continue
+		}
+		footer, err := decodeFooter(tarReader)
+		if err != nil {
+			return nil, apperr.Wrap(apperr.ErrCorrupt, err, "invalid archive footer in %s", archivePath)
+		}
+		return footer, nil
+	}
+	return nil, noFooterError(archivePath)
+}
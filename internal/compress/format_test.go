@@ -0,0 +1,192 @@
+package compress
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+)
+
+func TestSniffFormat(t *testing.T) {
+	tarHead := make([]byte, sniffSize)
+	copy(tarHead[257:], "ustar\x0000")
+
+	tests := []struct {
+		name string
+		head []byte
+		want Format
+	}{
+		{"Gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, FormatGzip},
+		{"Zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, FormatZstd},
+		{"LZ4", []byte{0x04, 0x22, 0x4d, 0x18, 0x64}, FormatLZ4},
+		{"Xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, FormatXz},
+		{"Bzip2", []byte("BZh91AY&SY"), FormatBzip2},
+		{"Zip", []byte("PK\x03\x04\x14\x00"), FormatZip},
+		{"Age", []byte("age-encryption.org/v1\n-> X25519"), FormatEncrypted},
+		{"OpenSSL", []byte("Salted__12345678"), FormatEncrypted},
+		{"PGP armor", []byte("-----BEGIN PGP MESSAGE-----\n"), FormatEncrypted},
+		{"Tar", tarHead, FormatTar},
+		{"Text", []byte("hello world"), FormatUnknown},
+		{"Empty", nil, FormatUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffFormat(tt.head); got != tt.want {
+				t.Errorf("sniffFormat() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFormat_IgnoresExtension(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+
+	renamed := filepath.Join(tempDir, "backup.zip")
+	if err := os.Rename(archivePath, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if format, err := DetectFormat(renamed); err != nil || format != FormatGzip {
+		t.Errorf("DetectFormat() = %s, %v, want gzip", format, err)
+	}
+	if _, err := VerifyArchive(renamed); err != nil {
+		t.Errorf("VerifyArchive of a renamed archive failed: %v", err)
+	}
+
+	_, itemsDir := createIndexedTestArchive(t)
+	if format, err := DetectFormat(itemsDir); err != nil || format != FormatIndexed {
+		t.Errorf("DetectFormat() of a per-item archive = %s, %v", format, err)
+	}
+}
+
+func TestExtractArchive_PlainTar(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+
+	// gunzip keeps every member, so the footer entry ends the tar stream
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(tempDir, "footer.tar.gz.bak")
+	tarFile, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(tarFile, gzipReader); err != nil {
+		t.Fatal(err)
+	}
+	tarFile.Close()
+
+	want, err := ReadFooter(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	footer, err := ReadFooter(tarPath)
+	if err != nil {
+		t.Fatalf("ReadFooter of a plain tar failed: %v", err)
+	}
+	if *footer != *want {
+		t.Errorf("Footer = %+v, want %+v", footer, want)
+	}
+	if _, err := VerifyArchive(tarPath); err != nil {
+		t.Errorf("VerifyArchive of a plain tar failed: %v", err)
+	}
+
+	targetDir := filepath.Join(tempDir, "extracted")
+	if _, err := ExtractArchive(tarPath, targetDir); err != nil {
+		t.Fatalf("ExtractArchive of a plain tar failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(targetDir, "sub", "c", "d.log"))
+	if err != nil || string(data) != "delta" {
+		t.Errorf("Extracted d.log = %q, %v", data, err)
+	}
+
+	if _, err := AppendDirectory(tarPath, targetDir, nil, Options{}); !errors.Is(err, apperr.ErrUnsupportedFormat) {
+		t.Errorf("AppendDirectory to a plain tar = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestCompressDirectory_CompatFormats(t *testing.T) {
+	tempDir, gzipPath := createFooterTestArchive(t)
+	sourceDir := filepath.Join(tempDir, "source")
+	want, err := ReadFooter(gzipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		compression string
+		format      Format
+	}{
+		{constants.CompressionXz, FormatXz},
+		{constants.CompressionBzip2, FormatBzip2},
+		{constants.CompressionNone, FormatTar},
+	} {
+		t.Run(tt.compression, func(t *testing.T) {
+			if err := CheckCompression(tt.compression); err != nil {
+				t.Skip(err)
+			}
+			archivePath := filepath.Join(tempDir, "backup"+ArchiveExtension(tt.compression))
+			if err := CompressDirectoryWithOptions(sourceDir, archivePath, Options{Compression: tt.compression, VerifyRename: true}); err != nil {
+				t.Fatalf("CompressDirectoryWithOptions failed: %v", err)
+			}
+			if format, err := DetectFormat(archivePath); err != nil || format != tt.format {
+				t.Errorf("DetectFormat() = %s, %v, want %s", format, err, tt.format)
+			}
+
+			// The same entries as the gzip archive, so the same footer
+			footer, err := VerifyArchive(archivePath)
+			if err != nil {
+				t.Fatalf("VerifyArchive failed: %v", err)
+			}
+			if footer.ManifestSHA256 != want.ManifestSHA256 || footer.EntryCount != want.EntryCount {
+				t.Errorf("Footer = %+v, want %+v", footer, want)
+			}
+
+			targetDir := filepath.Join(tempDir, tt.compression)
+			if _, err := ExtractArchive(archivePath, targetDir); err != nil {
+				t.Fatalf("ExtractArchive failed: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(targetDir, "sub", "c", "d.log"))
+			if err != nil || string(data) != "delta" {
+				t.Errorf("Extracted d.log = %q, %v", data, err)
+			}
+
+			// A damaged stream fails verification rather than reading short
+			data, _ = os.ReadFile(archivePath)
+			data[len(data)/2] ^= 0xff
+			if err := os.WriteFile(archivePath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := VerifyArchive(archivePath); err == nil {
+				t.Error("VerifyArchive of a damaged archive should fail")
+			}
+		})
+	}
+}
+
+func TestReadFooter_UnsupportedFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	archivePath := filepath.Join(tempDir, "backup.tar.gz")
+	if err := os.WriteFile(archivePath, []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x58}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReadFooter(archivePath)
+	if !errors.Is(err, apperr.ErrUnsupportedFormat) {
+		t.Fatalf("ReadFooter of a zstd file = %v, want ErrUnsupportedFormat", err)
+	}
+	if _, err := ExtractArchive(archivePath, filepath.Join(tempDir, "out")); !errors.Is(err, apperr.ErrUnsupportedFormat) {
+		t.Errorf("ExtractArchive of a zstd file = %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -0,0 +1,73 @@
+package compress
+
+import (
+	"compress/flate"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Incompressible file detection constants
+const (
+	levelStored           = -1        // Entry level meaning stored without compression
+	incompressibleMinSize = 64 * 1024 // Smaller files are not worth a gzip member of their own
+	incompressibleSample  = 64 * 1024 // Bytes sampled from the middle of a file
+	incompressibleRatio   = 0.97      // Sample compressing to more than this is treated as incompressible
+)
+
+// compressedExtensions are extensions of files that are compressed already
+// by their format. SST files are not listed: RocksDB may store them
+// uncompressed, so they are sampled.
+var compressedExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".zst": true, ".xz": true, ".bz2": true, ".lz4": true,
+	".zip": true, ".7z": true, ".rar": true, ".br": true, ".snappy": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".mp3": true, ".mp4": true, ".mkv": true, ".webm": true, ".pdf": true,
+}
+
+// incompressible reports whether the regular file at path would gain
+// almost nothing from compression: its extension names a compressed
+// format, or a sample from its middle barely shrinks under fast deflate
+func incompressible(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() < incompressibleMinSize {
+		return false
+	}
+	if compressedExtensions[strings.ToLower(filepath.Ext(path))] {
+		return true
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// The middle skips headers, which tend to compress well
+	offset := int64(0)
+	if info.Size() > incompressibleSample {
+		offset = (info.Size() - incompressibleSample) / 2
+	}
+	sample := make([]byte, incompressibleSample)
+	n, err := file.ReadAt(sample, offset)
+	if err != nil && err != io.EOF {
+		return false
+	}
+
+	counter := &byteCounter{}
+	writer, _ := flate.NewWriter(counter, flate.BestSpeed)
+	writer.Write(sample[:n])
+	writer.Close()
+	return float64(counter.n) > incompressibleRatio*float64(n)
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,267 @@
+package compress
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// Per-item archive constants
+const (
+	IndexFileName  = "index.json"  // Index at the top of a per-item archive directory
+	RootMemberName = "root.tar.gz" // Member holding the files outside any item, such as manifest.json
+	indexVersion   = 1
+)
+
+// Index lists the members of a per-item archive: a directory holding one
+// tar.gz per backed up item plus a root member. Each member is a complete
+// archive with its own footer, so members can be uploaded, verified and
+// restored independently and one damaged member leaves the others usable.
+type Index struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Members   []Member  `json:"members"`
+}
+
+// Member describes one archive of a per-item archive
+type Member struct {
+	Item           string `json:"item,omitempty"` // Backup path of the item, relative to the backup root; empty for the root member
+	File           string `json:"file"`           // Member archive, relative to the archive directory
+	Size           int64  `json:"size"`
+	SHA256         string `json:"sha256"` // Digest of the member file
+	EntryCount     int    `json:"entry_count"`
+	ManifestSHA256 string `json:"manifest_sha256"` // Manifest digest from the member's footer
+
+	// Items larger than Options.VolumeSize are split into volumes, one
+	// member each, so a restore of some of their files reads only the
+	// volumes holding them
+	Volume int      `json:"volume,omitempty"` // 1-based volume of the item; 0 when the item is not split
+	Files  []string `json:"files,omitempty"`  // Entry names of the files in the volume
+}
+
+// memberFile names the member archive of an item, mirroring its backup path
+func memberFile(item string) string {
+	return item + ".tar.gz"
+}
+
+// CompressItems writes a per-item archive of backupDir into targetDir: one
+// member per item (slash-separated paths relative to backupDir), a root
+// member with everything outside the items and the index. Items are
+// compressed concurrently, one per CPU. The index is written last, so a
+// directory without one is incomplete.
+func CompressItems(backupDir, targetDir string, items []string, opts Options) (*Index, error) {
+	return NewPipeline(backupDir, targetDir, runtime.NumCPU(), opts).Finish(items)
+}
+
+// newIndex returns an empty index, timestamped like the archive entries
+func newIndex(opts Options) *Index {
+	index := &Index{Version: indexVersion, CreatedAt: time.Now().UTC()}
+	if opts.Reproducible {
+		index.CreatedAt = opts.ModTime.UTC()
+	}
+	return index
+}
+
+// outsideItems returns a skip function leaving out items and their contents,
+// so the root member holds only what is not part of any item
+func outsideItems(items []string) func(name string, isDir bool) (bool, error) {
+	return func(name string, isDir bool) (bool, error) {
+		for _, item := range items {
+			if name == item || name == item+"/" || strings.HasPrefix(name, item+"/") {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// writeIndex stores the index of a per-item archive atomically
+func writeIndex(targetDir string, index *Index, durability string) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive index: %v", err)
+	}
+	indexPath := filepath.Join(targetDir, IndexFileName)
+	tempPath := indexPath + constants.TempArchiveSuffix
+	if err := os.WriteFile(tempPath, data, constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write archive index: %v", err)
+	}
+	if err := os.Rename(tempPath, indexPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename archive index into place: %v", err)
+	}
+	if durability == constants.DurabilityFull {
+		return utils.SyncDir(targetDir)
+	}
+	return nil
+}
+
+// writeMember archives the subtree root of backupDir into targetDir/file
+// through a temporary file and describes the result
+func writeMember(backupDir, root string, skip func(name string, isDir bool) (bool, error), targetDir, file string, opts Options, sync bool) (*Member, error) {
+	memberPath := filepath.Join(targetDir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(memberPath), constants.DirPermission); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %v", file, err)
+	}
+
+	tempPath := memberPath + constants.TempArchiveSuffix
+	written, err := writeArchive(backupDir, root, skip, tempPath, opts, sync)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	if err := os.Rename(tempPath, memberPath); err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to rename %s into place: %v", file, err)
+	}
+	if opts.VerifyRename {
+		if err := verifyRenamed(memberPath, written); err != nil {
+			return nil, err
+		}
+	}
+
+	footer, err := ReadFooter(memberPath)
+	if err != nil {
+		return nil, err
+	}
+	size, sum, err := fileDigest(memberPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Member{
+		Item:           root,
+		File:           file,
+		Size:           size,
+		SHA256:         sum,
+		EntryCount:     footer.EntryCount,
+		ManifestSHA256: footer.ManifestSHA256,
+	}, nil
+}
+
+// fileDigest returns the size and hex SHA-256 of a file
+func fileDigest(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return size, fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// IsIndexed reports whether path is a per-item archive directory
+func IsIndexed(path string) bool {
+	_, err := os.Stat(filepath.Join(path, IndexFileName))
+	return err == nil
+}
+
+// LoadIndex reads the index of a per-item archive
+func LoadIndex(archiveDir string) (*Index, error) {
+	indexPath := filepath.Join(archiveDir, IndexFileName)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive index %s: %v", indexPath, err)
+	}
+	index := &Index{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, apperr.Wrap(apperr.ErrCorrupt, err, "failed to parse archive index %s", indexPath)
+	}
+	return index, nil
+}
+
+// VerifyIndexed checks every member of a per-item archive against the index
+// and streams it against its footer. All members are checked; the error
+// names each damaged one.
+func VerifyIndexed(archiveDir string) (*Index, error) {
+	index, err := LoadIndex(archiveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var damaged []string
+	for _, member := range index.Members {
+		if err := verifyMember(archiveDir, member); err != nil {
+			damaged = append(damaged, fmt.Sprintf("%s: %v", member.File, err))
+		}
+	}
+	if len(damaged) > 0 {
+		return index, apperr.New(apperr.ErrCorrupt, "%d of %d archive member(s) damaged: %s", len(damaged), len(index.Members), strings.Join(damaged, "; "))
+	}
+	return index, nil
+}
+
+// verifyMember checks one member file against its index entry
+func verifyMember(archiveDir string, member Member) error {
+	memberPath := filepath.Join(archiveDir, filepath.FromSlash(member.File))
+	size, sum, err := fileDigest(memberPath)
+	if err != nil {
+		return err
+	}
+	if size != member.Size || sum != member.SHA256 {
+		return fmt.Errorf("file digest does not match the index")
+	}
+	footer, err := VerifyArchive(memberPath)
+	if err != nil {
+		return err
+	}
+	if footer.ManifestSHA256 != member.ManifestSHA256 {
+		return fmt.Errorf("footer does not match the index")
+	}
+	return nil
+}
+
+// ExtractIndexed unpacks the root member and the members of the given items
+// (all items when items is empty) of a per-item archive into targetDir. Of
+// an item split into volumes, a file or directory inside it can be named
+// instead, which unpacks only the volumes holding it. Each member is checked
+// against its footer and the index.
+func ExtractIndexed(archiveDir, targetDir string, items []string) error {
+	index, err := LoadIndex(archiveDir)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool)
+	for _, member := range index.Members {
+		if member.Item != "" && len(items) > 0 {
+			selected := false
+			for _, item := range items {
+				if member.holds(item) {
+					selected = true
+					found[item] = true
+				}
+			}
+			if !selected {
+				continue
+			}
+		}
+		footer, err := ExtractArchive(filepath.Join(archiveDir, filepath.FromSlash(member.File)), targetDir)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", member.File, err)
+		}
+		if footer.ManifestSHA256 != member.ManifestSHA256 {
+			return apperr.New(apperr.ErrCorrupt, "%s does not match the archive index", member.File)
+		}
+	}
+	for _, item := range items {
+		if !found[item] {
+			return fmt.Errorf("item %s is not in archive %s", item, archiveDir)
+		}
+	}
+	return nil
+}
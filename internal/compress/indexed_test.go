@@ -0,0 +1,118 @@
+package compress
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+)
+
+// createIndexedTestArchive writes a per-item archive of a backup with two
+// SQLite-style items, a log file item and a manifest outside the items
+func createIndexedTestArchive(t *testing.T) (string, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	backupDir := filepath.Join(tempDir, "backup")
+	writeTestTree(t, backupDir, map[string]string{
+		"data/app.db/app.db":     "app",
+		"data/users.db/users.db": "users",
+		"logs/server.log":        "log",
+		"manifest.json":          "{}",
+	})
+	archiveDir := filepath.Join(tempDir, "backup.archive")
+	items := []string{"data/app.db", "data/users.db", "logs/server.log"}
+	if _, err := CompressItems(backupDir, archiveDir, items, Options{}); err != nil {
+		t.Fatalf("CompressItems failed: %v", err)
+	}
+	return tempDir, archiveDir
+}
+
+func TestCompressItems(t *testing.T) {
+	tempDir, archiveDir := createIndexedTestArchive(t)
+
+	if !IsIndexed(archiveDir) {
+		t.Fatal("IsIndexed = false for a per-item archive")
+	}
+	index, err := VerifyIndexed(archiveDir)
+	if err != nil {
+		t.Fatalf("VerifyIndexed failed: %v", err)
+	}
+	var files []string
+	for _, member := range index.Members {
+		files = append(files, member.File)
+	}
+	want := "data/app.db.tar.gz data/users.db.tar.gz logs/server.log.tar.gz " + RootMemberName
+	if got := strings.Join(files, " "); got != want {
+		t.Errorf("Members = %s, want %s", got, want)
+	}
+
+	targetDir := filepath.Join(tempDir, "restored")
+	if err := ExtractIndexed(archiveDir, targetDir, nil); err != nil {
+		t.Fatalf("ExtractIndexed failed: %v", err)
+	}
+	for relPath, want := range map[string]string{
+		"data/app.db/app.db":     "app",
+		"data/users.db/users.db": "users",
+		"logs/server.log":        "log",
+		"manifest.json":          "{}",
+	} {
+		data, err := os.ReadFile(filepath.Join(targetDir, filepath.FromSlash(relPath)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q (%v), want %q", relPath, data, err, want)
+		}
+	}
+}
+
+func TestExtractIndexed_SelectedItems(t *testing.T) {
+	tempDir, archiveDir := createIndexedTestArchive(t)
+
+	targetDir := filepath.Join(tempDir, "restored")
+	if err := ExtractIndexed(archiveDir, targetDir, []string{"data/users.db"}); err != nil {
+		t.Fatalf("ExtractIndexed failed: %v", err)
+	}
+	for relPath, present := range map[string]bool{
+		"data/users.db/users.db": true,
+		"manifest.json":          true,
+		"data/app.db":            false,
+		"logs/server.log":        false,
+	} {
+		if _, err := os.Stat(filepath.Join(targetDir, filepath.FromSlash(relPath))); (err == nil) != present {
+			t.Errorf("%s present = %v, want %v", relPath, err == nil, present)
+		}
+	}
+
+	if err := ExtractIndexed(archiveDir, filepath.Join(tempDir, "other"), []string{"data/missing.db"}); err == nil {
+		t.Error("Expected an error for an item that is not in the archive")
+	}
+}
+
+func TestVerifyIndexed_DamagedMember(t *testing.T) {
+	tempDir, archiveDir := createIndexedTestArchive(t)
+
+	memberPath := filepath.Join(archiveDir, "data", "app.db.tar.gz")
+	data, err := os.ReadFile(memberPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(memberPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = VerifyIndexed(archiveDir)
+	if !errors.Is(err, apperr.ErrCorrupt) {
+		t.Fatalf("Expected a corruption error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 of 4") || !strings.Contains(err.Error(), "data/app.db.tar.gz") {
+		t.Errorf("Error should name the one damaged member: %v", err)
+	}
+
+	// The other members are still usable on their own
+	targetDir := filepath.Join(tempDir, "restored")
+	if err := ExtractIndexed(archiveDir, targetDir, []string{"data/users.db", "logs/server.log"}); err != nil {
+		t.Errorf("ExtractIndexed of intact members failed: %v", err)
+	}
+}
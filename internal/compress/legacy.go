@@ -0,0 +1,152 @@
+package compress
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+)
+
+// errNoFooter is the cause of the error returned for an archive without a
+// footer. Archives written before footers were introduced have none.
+var errNoFooter = errors.New("truncated or written before archives had footers")
+
+// legacyHeadSize is the number of leading content bytes kept for each file
+// of a legacy archive, enough to recognise a SQLite database
+const legacyHeadSize = 16
+
+// noFooterError reports that no footer was found in archivePath
+func noFooterError(archivePath string) error {
+	return apperr.Wrap(apperr.ErrCorrupt, errNoFooter, "archive footer not found in %s", archivePath)
+}
+
+// LegacyEntry is an entry of a legacy archive
+type LegacyEntry struct {
+	Name    string // Slash-separated path relative to the backup root
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	Head    []byte // Leading content bytes of a regular file
+}
+
+// IsLegacy reports whether archivePath is a single-file archive without a
+// footer, as the tool wrote before archives carried one. A truncated
+// archive lacks its footer as well; ScanLegacy and ExtractLegacy tell the
+// two apart.
+func IsLegacy(archivePath string) bool {
+	_, err := ReadFooter(archivePath)
+	return errors.Is(err, errNoFooter)
+}
+
+// ScanLegacy streams a legacy archive and returns its entries. Without a
+// footer there is no digest to check the content against, so it only
+// proves the archive is complete: every gzip checksum must match and the
+// tar stream must end with its end-of-archive marker.
+func ScanLegacy(archivePath string) ([]LegacyEntry, error) {
+	return walkLegacy(archivePath, nil)
+}
+
+// ExtractLegacy unpacks a legacy archive into targetDir and returns its
+// entries. As with ExtractArchive, targetDir may hold a partial tree on
+// error.
+func ExtractLegacy(archivePath, targetDir string) ([]LegacyEntry, error) {
+	if err := os.MkdirAll(targetDir, constants.DirPermission); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", targetDir, err)
+	}
+	return walkLegacy(archivePath, func(header *tar.Header, r io.Reader) error {
+		_, err := extractEntry(r, header, targetDir)
+		return err
+	})
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// prefixWriter keeps the first max bytes written to it
+type prefixWriter struct {
+	buf []byte
+	max int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.max - len(w.buf); room > 0 {
+		w.buf = append(w.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// walkLegacy reads every entry of a legacy archive, passing each to visit
+// (which may be nil) before recording it. visit may read the entry content
+// from r.
+func walkLegacy(archivePath string, visit func(header *tar.Header, r io.Reader) error) ([]LegacyEntry, error) {
+	stream, err := openTarStream(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	// entriesEnd is the offset after the last entry, padded to a whole
+	// block; the end-of-archive marker is the two zero blocks after it
+	counter := &countingReader{r: stream}
+	var entriesEnd int64
+	var entries []LegacyEntry
+	tarReader := tar.NewReader(counter)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, apperr.Wrap(apperr.ErrCorrupt, err, "failed to read archive entry")
+		}
+		if header.Name == FooterEntryName {
+			return nil, apperr.New(apperr.ErrCorrupt, "%s has a footer entry but no footer; it is damaged, not a legacy archive", archivePath)
+		}
+		entriesEnd = counter.n + (header.Size+511)/512*512
+
+		head := &prefixWriter{max: legacyHeadSize}
+		content := io.TeeReader(tarReader, head)
+		if visit != nil {
+			if err := visit(header, content); err != nil {
+				return nil, err
+			}
+		} else if _, err := io.CopyN(io.Discard, content, legacyHeadSize); err != nil && err != io.EOF {
+			return nil, apperr.Wrap(apperr.ErrCorrupt, err, "failed to read %s", header.Name)
+		}
+
+		entry := LegacyEntry{
+			Name:    strings.TrimSuffix(strings.TrimPrefix(header.Name, "./"), "/"),
+			IsDir:   header.Typeflag == tar.TypeDir,
+			Size:    header.Size,
+			ModTime: header.ModTime,
+			Head:    head.buf,
+		}
+		if entry.Name != "." && entry.Name != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	if counter.n < entriesEnd+2*512 {
+		return nil, apperr.New(apperr.ErrCorrupt, "%s ends without a tar end-of-archive marker: it is truncated", archivePath)
+	}
+	// Reading to the end validates the checksum of the last gzip member
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return nil, apperr.Wrap(apperr.ErrCorrupt, err, "failed to read the end of %s", archivePath)
+	}
+	return entries, nil
+}
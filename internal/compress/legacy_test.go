@@ -0,0 +1,148 @@
+package compress
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+)
+
+// writeLegacyArchive archives dir the way CompressDirectory did before
+// archives had a footer: one gzip member, FileInfoHeader entries named by
+// their relative path and a "." entry for the root
+func writeLegacyArchive(t *testing.T, dir, archivePath string) {
+	t.Helper()
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, info.Name())
+		if err != nil {
+			return err
+		}
+		if header.Name, err = filepath.Rel(dir, path); err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = tarWriter.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to write legacy archive: %v", err)
+	}
+}
+
+func createLegacyTestArchive(t *testing.T) (string, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	backupDir := filepath.Join(tempDir, "backup")
+	writeTestTree(t, backupDir, map[string]string{
+		"data/app.db/CURRENT":    "MANIFEST-000001\n",
+		"data/app.db/000001.sst": "sst",
+		"data/users.db":          "SQLite format 3\x00users",
+		"logs/server.log":        "log line\n",
+	})
+	archivePath := filepath.Join(tempDir, "backup.tar.gz")
+	writeLegacyArchive(t, backupDir, archivePath)
+	return tempDir, archivePath
+}
+
+func TestScanLegacy(t *testing.T) {
+	tempDir, archivePath := createLegacyTestArchive(t)
+
+	if !IsLegacy(archivePath) {
+		t.Fatal("IsLegacy = false for an archive without a footer")
+	}
+	if _, err := ReadFooter(archivePath); !errors.Is(err, apperr.ErrCorrupt) {
+		t.Errorf("ReadFooter = %v, want ErrCorrupt", err)
+	}
+	_, current := createFooterTestArchive(t)
+	if IsLegacy(current) {
+		t.Error("IsLegacy = true for an archive with a footer")
+	}
+
+	entries, err := ScanLegacy(archivePath)
+	if err != nil {
+		t.Fatalf("ScanLegacy failed: %v", err)
+	}
+	byName := make(map[string]LegacyEntry)
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+	// data, data/app.db, its two files, data/users.db, logs, logs/server.log
+	if len(entries) != 7 {
+		t.Errorf("Got %d entries, want 7: %+v", len(entries), entries)
+	}
+	if entry := byName["data/app.db"]; !entry.IsDir {
+		t.Errorf("data/app.db = %+v, want a directory", entry)
+	}
+	if entry := byName["data/users.db"]; string(entry.Head) != "SQLite format 3\x00" || entry.Size != 21 {
+		t.Errorf("data/users.db = %+v", entry)
+	}
+
+	targetDir := filepath.Join(tempDir, "extracted")
+	if _, err := ExtractLegacy(archivePath, targetDir); err != nil {
+		t.Fatalf("ExtractLegacy failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(targetDir, "logs", "server.log"))
+	if err != nil || string(data) != "log line\n" {
+		t.Errorf("Extracted server.log = %q, %v", data, err)
+	}
+}
+
+func TestScanLegacy_Truncated(t *testing.T) {
+	tempDir, archivePath := createLegacyTestArchive(t)
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(tempDir, "truncated.tar.gz")
+	if err := os.WriteFile(truncated, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanLegacy(truncated); err == nil {
+		t.Error("Expected ScanLegacy to fail on a truncated archive")
+	}
+
+	// A current archive cut at its footer member is a complete gzip stream
+	// but lacks the tar end-of-archive marker
+	_, current := createFooterTestArchive(t)
+	data, err = os.ReadFile(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, offset := findFooter(data)
+	if err := os.WriteFile(truncated, data[:offset], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !IsLegacy(truncated) {
+		t.Fatal("An archive without its footer member should look like a legacy one")
+	}
+	if _, err := ScanLegacy(truncated); !errors.Is(err, apperr.ErrCorrupt) || !strings.Contains(err.Error(), "end-of-archive marker") {
+		t.Errorf("ScanLegacy of an archive without its footer member = %v, want a missing end-of-archive marker", err)
+	}
+}
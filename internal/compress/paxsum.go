@@ -0,0 +1,46 @@
+package compress
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"archiveFiles/internal/apperr"
+)
+
+// PAXChecksumKey is the PAX record holding the hex SHA-256 of a regular file
+// entry's content. Any PAX-aware reader can check an entry against it
+// without knowing about the footer; vendor keys are namespaced like
+// SCHILY.* and LIBARCHIVE.*.
+const PAXChecksumKey = "ARCHIVEFILES.sha256"
+
+// fileSHA256 returns the SHA-256 of the content of the file at path
+func fileSHA256(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("failed to checksum %s: %v", path, err)
+	}
+	return hash.Sum(nil), nil
+}
+
+// checkEntrySum compares the SHA-256 of an entry's content with the PAX
+// checksum recorded in its header; entries without one pass
+func checkEntrySum(header *tar.Header, contentSum []byte) error {
+	recorded, ok := header.PAXRecords[PAXChecksumKey]
+	if !ok {
+		return nil
+	}
+	if actual := hex.EncodeToString(contentSum); recorded != actual {
+		return apperr.New(apperr.ErrCorrupt, "entry %s does not match its PAX checksum (recorded: %s, content: %s)", header.Name, recorded, actual)
+	}
+	return nil
+}
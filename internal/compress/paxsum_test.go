@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/apperr"
+)
+
+func TestCompressDirectoryWithOptions_EntryChecksums(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.log": "alpha", "sub/b.log": "bravo"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archivePath := filepath.Join(tempDir, "sums.tar.gz")
+	if err := CompressDirectoryWithOptions(sourceDir, archivePath, Options{EntryChecksums: true}); err != nil {
+		t.Fatalf("CompressDirectoryWithOptions failed: %v", err)
+	}
+	if _, err := VerifyArchive(archivePath); err != nil {
+		t.Errorf("VerifyArchive failed: %v", err)
+	}
+
+	// A plain tar reader sees the checksums on files only
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	files := 0
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		recorded, ok := header.PAXRecords[PAXChecksumKey]
+		if header.Name == FooterEntryName || header.Typeflag != tar.TypeReg {
+			if ok {
+				t.Errorf("Entry %s has a PAX checksum", header.Name)
+			}
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(content)
+		if recorded != hex.EncodeToString(sum[:]) {
+			t.Errorf("Entry %s has PAX checksum %q, want %x", header.Name, recorded, sum)
+		}
+		files++
+	}
+	if files != 2 {
+		t.Errorf("Read %d files, want 2", files)
+	}
+}
+
+func TestScanEntries_PAXChecksumMismatch(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "bad.tar.gz")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	content := []byte("alpha")
+	header := &tar.Header{
+		Name:       "a.log",
+		Mode:       0644,
+		Size:       int64(len(content)),
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{PAXChecksumKey: hex.EncodeToString(make([]byte, sha256.Size))},
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		t.Fatal(err)
+	}
+	tarWriter.Write(content)
+	tarWriter.Close()
+	gzipWriter.Close()
+	file.Close()
+
+	if _, err := scanEntries(archivePath, nil); !errors.Is(err, apperr.ErrCorrupt) {
+		t.Errorf("scanEntries error = %v, want ErrCorrupt", err)
+	}
+}
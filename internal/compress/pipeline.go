@@ -0,0 +1,158 @@
+package compress
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"archiveFiles/internal/constants"
+)
+
+// Pipeline builds a per-item archive while the backup is still running:
+// every item handed to Add is compressed in the background, up to workers at
+// a time, so compressing finished items overlaps with copying the others.
+// Finish compresses what is left, adds the root member and writes the index.
+type Pipeline struct {
+	backupDir string
+	targetDir string
+	opts      Options
+	sync      bool
+	slots     chan struct{} // Limits concurrent compressions
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	members map[string][]Member // Finished members by item, one per volume
+	queued  map[string]bool
+	errs    []string
+}
+
+// NewPipeline starts a per-item archive of backupDir in targetDir that
+// compresses up to workers items at a time. Nothing is written until the
+// first item is added.
+func NewPipeline(backupDir, targetDir string, workers int, opts Options) *Pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	if opts.Durability == "" {
+		opts.Durability = constants.DefaultDurability
+	}
+	return &Pipeline{
+		backupDir: backupDir,
+		targetDir: targetDir,
+		opts:      opts,
+		sync:      opts.Durability != constants.DurabilityNone,
+		slots:     make(chan struct{}, workers),
+		members:   make(map[string][]Member),
+		queued:    make(map[string]bool),
+	}
+}
+
+// Add queues a finished item (a slash-separated path relative to the backup
+// directory) for compression without waiting for it. The item must not
+// change afterwards. Adding an item twice has no effect.
+func (p *Pipeline) Add(item string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queued[item] {
+		return
+	}
+	p.queued[item] = true
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		members, err := p.writeItem(item)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if err != nil {
+			p.errs = append(p.errs, fmt.Sprintf("%s: %v", item, err))
+			return
+		}
+		p.members[item] = members
+	}()
+}
+
+// writeItem writes the member of an item, or one member per volume when
+// the item is larger than the volume size. Each member takes a slot of its
+// own, so the volumes of one large item are compressed concurrently.
+func (p *Pipeline) writeItem(item string) ([]Member, error) {
+	volumes, err := PlanVolumes(p.backupDir, item, p.opts.VolumeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]Member, len(volumes))
+	errs := make([]error, len(volumes))
+	var wg sync.WaitGroup
+	for i, files := range volumes {
+		wg.Add(1)
+		go func(i int, files []string) {
+			defer wg.Done()
+			p.slots <- struct{}{}
+			defer func() { <-p.slots }()
+
+			if len(volumes) == 1 {
+				member, err := writeMember(p.backupDir, item, nil, p.targetDir, memberFile(item), p.opts, p.sync)
+				if err == nil {
+					members[i] = *member
+				}
+				errs[i] = err
+				return
+			}
+			member, err := writeMember(p.backupDir, item, inVolume(files), p.targetDir, VolumeFile(item, i+1), p.opts, p.sync)
+			if err != nil {
+				errs[i] = fmt.Errorf("volume %d: %v", i+1, err)
+				return
+			}
+			member.Volume = i + 1
+			member.Files = files
+			members[i] = *member
+		}(i, files)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// Wait blocks until every queued item has been compressed. It is safe to
+// call when the archive is abandoned; the directory then has no index and
+// is not a valid archive.
+func (p *Pipeline) Wait() {
+	p.wg.Wait()
+}
+
+// Finish compresses the items that were not added yet, waits for all of
+// them, writes the root member with everything outside the items and then
+// the index. Members are listed in the order of items.
+func (p *Pipeline) Finish(items []string) (*Index, error) {
+	for _, item := range items {
+		p.Add(item)
+	}
+	p.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.errs) > 0 {
+		return nil, fmt.Errorf("failed to archive %s", strings.Join(p.errs, "; "))
+	}
+
+	index := newIndex(p.opts)
+	for _, item := range items {
+		index.Members = append(index.Members, p.members[item]...)
+	}
+	root, err := writeMember(p.backupDir, "", outsideItems(items), p.targetDir, RootMemberName, p.opts, p.sync)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive backup root: %v", err)
+	}
+	index.Members = append(index.Members, *root)
+
+	if err := writeIndex(p.targetDir, index, p.opts.Durability); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
@@ -0,0 +1,57 @@
+package compress
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	tempDir := t.TempDir()
+	backupDir := filepath.Join(tempDir, "backup")
+	writeTestTree(t, backupDir, map[string]string{
+		"data/a.db/a.db": "alpha",
+		"data/b.db/b.db": "bravo",
+		"data/c.db/c.db": "charlie",
+		"manifest.json":  "{}",
+	})
+	archiveDir := filepath.Join(tempDir, "backup.archive")
+
+	// Items added while the backup runs, one of them twice, and one that is
+	// only passed to Finish
+	pipeline := NewPipeline(backupDir, archiveDir, 2, Options{})
+	pipeline.Add("data/b.db")
+	pipeline.Add("data/a.db")
+	pipeline.Add("data/b.db")
+	index, err := pipeline.Finish([]string{"data/a.db", "data/b.db", "data/c.db"})
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+
+	var items []string
+	for _, member := range index.Members {
+		items = append(items, member.Item)
+	}
+	if got := strings.Join(items, ","); got != "data/a.db,data/b.db,data/c.db," {
+		t.Errorf("Member items = %s, want the order passed to Finish plus the root member", got)
+	}
+	if _, err := VerifyIndexed(archiveDir); err != nil {
+		t.Errorf("VerifyIndexed failed: %v", err)
+	}
+}
+
+func TestPipeline_FailedItem(t *testing.T) {
+	tempDir := t.TempDir()
+	backupDir := filepath.Join(tempDir, "backup")
+	writeTestTree(t, backupDir, map[string]string{"data/a.db/a.db": "alpha"})
+	archiveDir := filepath.Join(tempDir, "backup.archive")
+
+	pipeline := NewPipeline(backupDir, archiveDir, 2, Options{})
+	pipeline.Add("data/missing.db")
+	if _, err := pipeline.Finish([]string{"data/a.db"}); err == nil || !strings.Contains(err.Error(), "data/missing.db") {
+		t.Fatalf("Expected Finish to report the failed item, got: %v", err)
+	}
+	if IsIndexed(archiveDir) {
+		t.Error("No index should be written when an item failed")
+	}
+}
@@ -0,0 +1,146 @@
+package compress
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"archiveFiles/internal/constants"
+)
+
+// SignatureSuffix is appended to an archive path to name its detached signature
+const SignatureSuffix = ".sig"
+
+// signatureAlgorithm identifies the signature scheme in signature files
+const signatureAlgorithm = "ed25519"
+
+// Signature is a detached signature over an archive's footer. The footer's
+// manifest digest covers every entry name, type, link target, mode, size and
+// content hash, so a valid
+// signature together with a full VerifyArchive proves the archive content.
+type Signature struct {
+	Algorithm      string `json:"algorithm"`
+	EntryCount     int    `json:"entry_count"`
+	ManifestSHA256 string `json:"manifest_sha256"`
+	Signature      string `json:"signature"` // Base64-encoded signature of signedMessage
+}
+
+// signedMessage is the byte string that is actually signed
+func signedMessage(footer *Footer) []byte {
+	return []byte(fmt.Sprintf("archivefiles-signature-v2\n%d\n%s\n", footer.EntryCount, footer.ManifestSHA256))
+}
+
+// LoadPrivateKey reads an Ed25519 private key from a PKCS#8 PEM file, as
+// written by `openssl genpkey -algorithm ed25519`
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %v", path, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an Ed25519 key", path)
+	}
+	return privateKey, nil
+}
+
+// LoadPublicKey reads an Ed25519 public key from a PKIX PEM file, as written
+// by `openssl pkey -pubout`
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %v", path, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", path)
+	}
+	return publicKey, nil
+}
+
+// readPEM returns the DER bytes of the first PEM block of the given type
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %v", path, err)
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no %s PEM block in %s", blockType, path)
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// SignArchive writes a detached signature for an archive next to it and
+// returns the signature path
+func SignArchive(archivePath string, key ed25519.PrivateKey) (string, error) {
+	footer, err := ReadFooter(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	signature := Signature{
+		Algorithm:      signatureAlgorithm,
+		EntryCount:     footer.EntryCount,
+		ManifestSHA256: footer.ManifestSHA256,
+		Signature:      base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(footer))),
+	}
+	data, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal signature: %v", err)
+	}
+
+	signaturePath := archivePath + SignatureSuffix
+	if err := os.WriteFile(signaturePath, data, constants.FilePermission); err != nil {
+		return "", fmt.Errorf("failed to write signature %s: %v", signaturePath, err)
+	}
+	return signaturePath, nil
+}
+
+// VerifySignature checks an archive's detached signature against a public
+// key and the footer of the archive. Callers wanting tamper evidence for the
+// content must also check the footer itself with VerifyArchive.
+func VerifySignature(archivePath string, footer *Footer, key ed25519.PublicKey) error {
+	signaturePath := archivePath + SignatureSuffix
+	data, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return fmt.Errorf("failed to read signature %s: %v", signaturePath, err)
+	}
+
+	var signature Signature
+	if err := json.Unmarshal(data, &signature); err != nil {
+		return fmt.Errorf("failed to parse signature %s: %v", signaturePath, err)
+	}
+	if signature.Algorithm != signatureAlgorithm {
+		return fmt.Errorf("unsupported signature algorithm: %s", signature.Algorithm)
+	}
+	if signature.ManifestSHA256 != footer.ManifestSHA256 || signature.EntryCount != footer.EntryCount {
+		return fmt.Errorf("signature does not match archive manifest")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	if !ed25519.Verify(key, signedMessage(footer), sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package compress
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestKeys generates an Ed25519 key pair and stores it as PEM files
+func writeTestKeys(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privatePath := filepath.Join(dir, "sign.pem")
+	publicPath := filepath.Join(dir, "sign.pub.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestSignAndVerifyArchive(t *testing.T) {
+	tempDir, archivePath := createFooterTestArchive(t)
+	privatePath, publicPath := writeTestKeys(t, tempDir)
+
+	privateKey, err := LoadPrivateKey(privatePath)
+	if err != nil {
+		t.Fatalf("LoadPrivateKey failed: %v", err)
+	}
+	publicKey, err := LoadPublicKey(publicPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey failed: %v", err)
+	}
+
+	signaturePath, err := SignArchive(archivePath, privateKey)
+	if err != nil {
+		t.Fatalf("SignArchive failed: %v", err)
+	}
+	if signaturePath != archivePath+SignatureSuffix {
+		t.Errorf("signature path = %s", signaturePath)
+	}
+
+	footer, err := VerifyArchive(archivePath)
+	if err != nil {
+		t.Fatalf("VerifyArchive failed: %v", err)
+	}
+	if err := VerifySignature(archivePath, footer, publicKey); err != nil {
+		t.Fatalf("VerifySignature failed: %v", err)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, otherPublicPath := writeTestKeys(t, t.TempDir())
+		otherKey, err := LoadPublicKey(otherPublicPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifySignature(archivePath, footer, otherKey); err == nil {
+			t.Error("Expected verification with another key to fail")
+		}
+	})
+
+	t.Run("different manifest", func(t *testing.T) {
+		tampered := *footer
+		tampered.ManifestSHA256 = strings.Repeat("0", 64)
+		if err := VerifySignature(archivePath, &tampered, publicKey); err == nil {
+			t.Error("Expected verification against a different manifest to fail")
+		}
+	})
+}
+
+func TestVerifyArchive_ChangedSymlinkTarget(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.log"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.log", filepath.Join(sourceDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(tempDir, "links.tar.gz")
+	if err := CompressDirectory(sourceDir, archivePath); err != nil {
+		t.Fatalf("CompressDirectory failed: %v", err)
+	}
+	privatePath, publicPath := writeTestKeys(t, tempDir)
+	privateKey, err := LoadPrivateKey(privatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := LoadPublicKey(publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignArchive(archivePath, privateKey); err != nil {
+		t.Fatalf("SignArchive failed: %v", err)
+	}
+
+	// Rewrite the archive as plain tar with the link pointing elsewhere,
+	// keeping the signed footer
+	tamperedPath := filepath.Join(tempDir, "tampered.tar")
+	stream, err := openTarStream(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	file, err := os.Create(tamperedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tarReader := tar.NewReader(stream)
+	tarWriter := tar.NewWriter(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			header.Linkname = "/etc/passwd"
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(archivePath + SignatureSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tamperedPath+SignatureSuffix, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	footer, err := ReadFooter(tamperedPath)
+	if err != nil {
+		t.Fatalf("ReadFooter failed: %v", err)
+	}
+	if err := VerifySignature(tamperedPath, footer, publicKey); err != nil {
+		t.Fatalf("VerifySignature failed: %v", err)
+	}
+	if _, err := VerifyArchive(tamperedPath); err == nil {
+		t.Error("Expected verification of an archive with a changed symlink target to fail")
+	}
+}
+
+func TestLoadPrivateKey_WrongBlock(t *testing.T) {
+	tempDir := t.TempDir()
+	_, publicPath := writeTestKeys(t, tempDir)
+	if _, err := LoadPrivateKey(publicPath); err == nil {
+		t.Error("Expected error loading a public key as private key")
+	}
+}
@@ -0,0 +1,81 @@
+package compress
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VolumeFile names the member archive of volume n (1-based) of an item split
+// into volumes, next to where the item's single member would be
+func VolumeFile(item string, n int) string {
+	return fmt.Sprintf("%s.vol%03d.tar.gz", item, n)
+}
+
+// PlanVolumes splits the files of item (a slash-separated path relative to
+// backupDir) into volumes of at most volumeSize bytes each, in lexical
+// order, and returns the entry names of the files of each volume. A file
+// larger than volumeSize gets a volume of its own. An item that fits into
+// one volume, or any item when volumeSize is 0, gets a single volume. The
+// plan only depends on the tree, so planning a finished item again gives
+// the same volumes.
+func PlanVolumes(backupDir, item string, volumeSize int64) ([][]string, error) {
+	var volumes [][]string
+	var current []string
+	var currentSize int64
+	err := filepath.Walk(filepath.Join(backupDir, filepath.FromSlash(item)), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(backupDir, path)
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		if !info.Mode().IsRegular() {
+			size = 0
+		}
+		if volumeSize > 0 && len(current) > 0 && currentSize+size > volumeSize {
+			volumes = append(volumes, current)
+			current, currentSize = nil, 0
+		}
+		current = append(current, archiveEntryName(relPath, false))
+		currentSize += size
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan volumes of %s: %v", item, err)
+	}
+	return append(volumes, current), nil
+}
+
+// inVolume returns a skip function leaving out the files of the item that
+// belong to other volumes. Directories are written to every volume, so each
+// volume extracts on its own.
+func inVolume(files []string) func(name string, isDir bool) (bool, error) {
+	wanted := make(map[string]bool, len(files))
+	for _, file := range files {
+		wanted[file] = true
+	}
+	return func(name string, isDir bool) (bool, error) {
+		return !isDir && !wanted[name], nil
+	}
+}
+
+// holds reports whether member holds name: the member's item, a directory
+// inside a volume's item, or one of its files
+func (m Member) holds(name string) bool {
+	if name == m.Item {
+		return true
+	}
+	for _, file := range m.Files {
+		if file == name || strings.HasPrefix(file, name+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package compress
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanVolumes(t *testing.T) {
+	backupDir := t.TempDir()
+	writeTestTree(t, backupDir, map[string]string{
+		"db/000001.sst": strings.Repeat("a", 60),
+		"db/000002.sst": strings.Repeat("b", 60),
+		"db/000003.sst": strings.Repeat("c", 150),
+		"db/CURRENT":    "MANIFEST-000004\n",
+		"db/MANIFEST-4": "m",
+	})
+
+	volumes, err := PlanVolumes(backupDir, "db", 128)
+	if err != nil {
+		t.Fatalf("PlanVolumes failed: %v", err)
+	}
+	want := [][]string{
+		{"db/000001.sst", "db/000002.sst"},
+		{"db/000003.sst"}, // Larger than a volume, so on its own
+		{"db/CURRENT", "db/MANIFEST-4"},
+	}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("PlanVolumes = %v, want %v", volumes, want)
+	}
+
+	if volumes, err := PlanVolumes(backupDir, "db", 0); err != nil || len(volumes) != 1 || len(volumes[0]) != 5 {
+		t.Errorf("PlanVolumes without a volume size = %v, %v, want one volume", volumes, err)
+	}
+}
+
+func TestCompressItems_Volumes(t *testing.T) {
+	tempDir := t.TempDir()
+	backupDir := filepath.Join(tempDir, "backup")
+	writeTestTree(t, backupDir, map[string]string{
+		"data/big.db/000001.sst": strings.Repeat("a", 100),
+		"data/big.db/000002.sst": strings.Repeat("b", 100),
+		"data/big.db/CURRENT":    "MANIFEST-000003\n",
+		"data/small.db/small.db": "small",
+		"manifest.json":          "{}",
+	})
+	archiveDir := filepath.Join(tempDir, "backup.archive")
+	items := []string{"data/big.db", "data/small.db"}
+	if _, err := CompressItems(backupDir, archiveDir, items, Options{VolumeSize: 128}); err != nil {
+		t.Fatalf("CompressItems failed: %v", err)
+	}
+
+	index, err := VerifyIndexed(archiveDir)
+	if err != nil {
+		t.Fatalf("VerifyIndexed failed: %v", err)
+	}
+	var files []string
+	for _, member := range index.Members {
+		files = append(files, member.File)
+	}
+	want := "data/big.db.vol001.tar.gz data/big.db.vol002.tar.gz data/small.db.tar.gz " + RootMemberName
+	if got := strings.Join(files, " "); got != want {
+		t.Errorf("Members = %s, want %s", got, want)
+	}
+	if second := index.Members[1]; second.Volume != 2 || !reflect.DeepEqual(second.Files, []string{"data/big.db/000002.sst", "data/big.db/CURRENT"}) {
+		t.Errorf("Second volume = %+v", second)
+	}
+
+	// A file of a split item unpacks only the volume holding it
+	targetDir := filepath.Join(tempDir, "restored")
+	if err := ExtractIndexed(archiveDir, targetDir, []string{"data/big.db/CURRENT"}); err != nil {
+		t.Fatalf("ExtractIndexed failed: %v", err)
+	}
+	for relPath, present := range map[string]bool{
+		"data/big.db/CURRENT":    true,
+		"data/big.db/000002.sst": true,
+		"data/big.db/000001.sst": false,
+		"data/small.db":          false,
+		"manifest.json":          true,
+	} {
+		if _, err := os.Stat(filepath.Join(targetDir, filepath.FromSlash(relPath))); (err == nil) != present {
+			t.Errorf("%s present = %v, want %v", relPath, err == nil, present)
+		}
+	}
+
+	// The item itself unpacks every volume
+	fullDir := filepath.Join(tempDir, "full")
+	if err := ExtractIndexed(archiveDir, fullDir, []string{"data/big.db"}); err != nil {
+		t.Fatalf("ExtractIndexed failed: %v", err)
+	}
+	for _, name := range []string{"000001.sst", "000002.sst", "CURRENT"} {
+		if _, err := os.Stat(filepath.Join(fullDir, "data", "big.db", name)); err != nil {
+			t.Errorf("%s missing after restoring the whole item: %v", name, err)
+		}
+	}
+}
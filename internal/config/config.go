@@ -1,10 +1,14 @@
 package config
 
 import (
+	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"archiveFiles/internal/constants"
 	"archiveFiles/internal/types"
@@ -23,6 +27,11 @@ func LoadConfigFromJSON(filename string) (*types.Config, error) {
 		return nil, fmt.Errorf("failed to parse JSON config: %v", err)
 	}
 
+	if config.ConfigVersion > constants.ConfigVersion {
+		return nil, fmt.Errorf("config file %s has config_version %d, newer than this version of archiveFiles supports (%d)",
+			filename, config.ConfigVersion, constants.ConfigVersion)
+	}
+
 	return config, nil
 }
 
@@ -44,12 +53,15 @@ func SaveConfigToJSON(config *types.Config, filename string) error {
 // GetDefaultConfig returns a configuration with sensible defaults
 func GetDefaultConfig() *types.Config {
 	return &types.Config{
-		Method:    constants.MethodCheckpoint,
-		Compress:  true,
-		BatchMode: false,
-		Verify:    false,
-		LogLevel:  "info",
-		ColorLog:  true,
+		ConfigVersion: constants.ConfigVersion,
+		Method:        constants.MethodCheckpoint,
+		Compress:      true,
+		BatchMode:     false,
+		Verify:        false,
+		LogLevel:      "info",
+		ColorLog:      true,
+		Durability:    constants.DefaultDurability,
+		OnAccessError: constants.DefaultOnAccessError,
 	}
 }
 
@@ -79,8 +91,186 @@ func MergeConfigs(jsonConfig *types.Config, flagConfig *types.Config) *types.Con
 	if flagConfig.ArchivePath != "" {
 		merged.ArchivePath = flagConfig.ArchivePath
 	}
+	if flagConfig.Namespace != "" {
+		merged.Namespace = flagConfig.Namespace
+	}
 	// Always override method (even if it's the default) since it's explicitly set
 	merged.Method = flagConfig.Method
+	if flagConfig.ArchiveLayout != "" {
+		merged.ArchiveLayout = flagConfig.ArchiveLayout
+	}
+	if flagConfig.VolumeSize != "" {
+		merged.VolumeSize = flagConfig.VolumeSize
+	}
+	if flagConfig.Output != "" {
+		merged.Output = flagConfig.Output
+	}
+	if flagConfig.MirrorTarget != "" {
+		merged.MirrorTarget = flagConfig.MirrorTarget
+	}
+	if flagConfig.MirrorSSH != "" {
+		merged.MirrorSSH = flagConfig.MirrorSSH
+	}
+	if flagConfig.Durability != "" {
+		merged.Durability = flagConfig.Durability
+	}
+	if flagConfig.OnCorruption != "" {
+		merged.OnCorruption = flagConfig.OnCorruption
+	}
+	if flagConfig.LogOutput != "" {
+		merged.LogOutput = flagConfig.LogOutput
+	}
+	if flagConfig.Window != "" {
+		merged.Window = flagConfig.Window
+	}
+	if flagConfig.MaxItems != 0 {
+		merged.MaxItems = flagConfig.MaxItems
+	}
+	if flagConfig.MaxTotalSize != "" {
+		merged.MaxTotalSize = flagConfig.MaxTotalSize
+	}
+	if flagConfig.Yes {
+		merged.Yes = true
+	}
+	if flagConfig.Schedule != "" {
+		merged.Schedule = flagConfig.Schedule
+	}
+	if flagConfig.Snapshot != "" {
+		merged.Snapshot = flagConfig.Snapshot
+	}
+	if flagConfig.OnAccessError != "" {
+		merged.OnAccessError = flagConfig.OnAccessError
+	}
+	if flagConfig.Reproducible {
+		merged.Reproducible = true
+	}
+	if flagConfig.NetworkFS {
+		merged.NetworkFS = true
+	}
+	if flagConfig.MaxDepth > 0 {
+		merged.MaxDepth = flagConfig.MaxDepth
+	}
+	if flagConfig.SQLiteMaxConnections != 0 {
+		merged.SQLiteMaxConnections = flagConfig.SQLiteMaxConnections
+	}
+	if flagConfig.RocksDBBackupRateMBps != 0 {
+		merged.RocksDBBackupRateMBps = flagConfig.RocksDBBackupRateMBps
+	}
+	if flagConfig.OneFileSystem {
+		merged.OneFileSystem = true
+	}
+	if flagConfig.DropPageCache {
+		merged.DropPageCache = true
+	}
+	if flagConfig.Preread {
+		merged.Preread = true
+	}
+	if flagConfig.Nice {
+		merged.Nice = true
+	}
+	if flagConfig.TmpDir != "" {
+		merged.TmpDir = flagConfig.TmpDir
+	}
+	if flagConfig.HostInfo {
+		merged.HostInfo = true
+	}
+	if flagConfig.ItemLogs {
+		merged.ItemLogs = true
+	}
+	if flagConfig.IncludePattern != "" {
+		merged.IncludePattern = flagConfig.IncludePattern
+	}
+	if flagConfig.ExcludePattern != "" {
+		merged.ExcludePattern = flagConfig.ExcludePattern
+	}
+	if flagConfig.LogDetection != "" {
+		merged.LogDetection = flagConfig.LogDetection
+	}
+	if flagConfig.RocksDBExclude != "" {
+		merged.RocksDBExclude = flagConfig.RocksDBExclude
+	}
+	if flagConfig.KeepRocksDBArtifacts {
+		merged.KeepRocksDBArtifacts = true
+	}
+	if flagConfig.InventoryOnly {
+		merged.InventoryOnly = true
+	}
+	if flagConfig.InventoryHashes {
+		merged.InventoryHashes = true
+	}
+	if flagConfig.RocksDBExport != "" {
+		merged.RocksDBExport = flagConfig.RocksDBExport
+	}
+	if flagConfig.RocksDBExportEncoding != "" {
+		merged.RocksDBExportEncoding = flagConfig.RocksDBExportEncoding
+	}
+	if flagConfig.CompressionFormat != "" {
+		merged.CompressionFormat = flagConfig.CompressionFormat
+	}
+	if flagConfig.CompressionLevel != 0 {
+		merged.CompressionLevel = flagConfig.CompressionLevel
+	}
+	if flagConfig.StoreIncompressible {
+		merged.StoreIncompressible = true
+	}
+	if flagConfig.EntryChecksums {
+		merged.EntryChecksums = true
+	}
+	// -remove-backup and -progress default to true, so they override the
+	// config file only when given on the command line, in either direction
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "remove-backup":
+			merged.KeepBackup = flagConfig.KeepBackup
+		case "progress":
+			merged.HideProgress = flagConfig.HideProgress
+		}
+	})
+	if flagConfig.ProgressInterval != "" {
+		merged.ProgressInterval = flagConfig.ProgressInterval
+	}
+	if flagConfig.AllowConcurrent {
+		merged.AllowConcurrent = true
+	}
+	if flagConfig.JSONReport {
+		merged.JSONReport = true
+	}
+	if flagConfig.WarningsAsErrors {
+		merged.WarningsAsErrors = true
+	}
+	if flagConfig.VerifySample != "" {
+		merged.VerifySample = flagConfig.VerifySample
+	}
+	if flagConfig.VerifySeed != 0 {
+		merged.VerifySeed = flagConfig.VerifySeed
+	}
+	if flagConfig.Interval != "" {
+		merged.Interval = flagConfig.Interval
+	}
+	if flagConfig.StatusAddr != "" {
+		merged.StatusAddr = flagConfig.StatusAddr
+	}
+	if flagConfig.ControlSocket != "" {
+		merged.ControlSocket = flagConfig.ControlSocket
+	}
+	if flagConfig.K8sJob {
+		merged.K8sJob = true
+	}
+	if flagConfig.TerminationLog != "" {
+		merged.TerminationLog = flagConfig.TerminationLog
+	}
+	if flagConfig.SignKey != "" {
+		merged.SignKey = flagConfig.SignKey
+	}
+	if flagConfig.CatalogPath != "" {
+		merged.CatalogPath = flagConfig.CatalogPath
+	}
+	if flagConfig.SizeDropThreshold > 0 {
+		merged.SizeDropThreshold = flagConfig.SizeDropThreshold
+	}
+	if flagConfig.FaultInject != "" {
+		merged.FaultInject = flagConfig.FaultInject
+	}
 
 	// For boolean flags, we need special handling since false might be intentional
 	// Override if we detect flags were explicitly set
@@ -131,3 +321,38 @@ func FindDefaultConfig() string {
 	return "" // No default config found
 }
 
+// LoadSourceList reads source paths from a file, one per line. A filename of
+// "-" reads from standard input.
+func LoadSourceList(filename string) ([]string, error) {
+	if filename == "-" {
+		return ReadSourceList(os.Stdin)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source list %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	return ReadSourceList(file)
+}
+
+// ReadSourceList parses one path per line, skipping blank lines and lines
+// starting with '#'
+func ReadSourceList(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	// Allow paths up to the usual PATH_MAX and then some
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read source list: %v", err)
+	}
+	return paths, nil
+}
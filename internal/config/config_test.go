@@ -2,9 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"flag"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"archiveFiles/internal/types"
@@ -219,6 +221,30 @@ func TestMergeConfigs(t *testing.T) {
 	}
 }
 
+func TestMergeConfigs_DefaultTrueFlags(t *testing.T) {
+	removeBackup := flag.Bool("remove-backup", true, "")
+	progress := flag.Bool("progress", true, "")
+	jsonConfig := &types.Config{KeepBackup: true, HideProgress: false}
+
+	// Unset flags leave the config file alone
+	merged := MergeConfigs(jsonConfig, &types.Config{KeepBackup: !*removeBackup, HideProgress: !*progress})
+	if !merged.KeepBackup || merged.HideProgress {
+		t.Errorf("merged = keep %v, hide %v; want the config file's values", merged.KeepBackup, merged.HideProgress)
+	}
+
+	// Flags given on the command line win in either direction
+	if err := flag.Set("remove-backup", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := flag.Set("progress", "false"); err != nil {
+		t.Fatal(err)
+	}
+	merged = MergeConfigs(jsonConfig, &types.Config{KeepBackup: !*removeBackup, HideProgress: !*progress})
+	if merged.KeepBackup || !merged.HideProgress {
+		t.Errorf("merged = keep %v, hide %v; want the flags' values", merged.KeepBackup, merged.HideProgress)
+	}
+}
+
 func TestFindDefaultConfig(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir, err := os.MkdirTemp("", "config_test")
@@ -373,3 +399,36 @@ func TestConfigValidation(t *testing.T) {
 		}
 	})
 }
+
+func TestReadSourceList(t *testing.T) {
+	input := "/data/db1\n\n  /data/db2  \n# comment line\n/data/with space/db3\n"
+	paths, err := ReadSourceList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadSourceList failed: %v", err)
+	}
+
+	expected := []string{"/data/db1", "/data/db2", "/data/with space/db3"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("ReadSourceList = %v, want %v", paths, expected)
+	}
+}
+
+func TestLoadSourceList(t *testing.T) {
+	tempDir := t.TempDir()
+	listFile := filepath.Join(tempDir, "sources.txt")
+	if err := os.WriteFile(listFile, []byte("/a\n/b\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source list: %v", err)
+	}
+
+	paths, err := LoadSourceList(listFile)
+	if err != nil {
+		t.Fatalf("LoadSourceList failed: %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/a", "/b"}) {
+		t.Errorf("LoadSourceList = %v, want [/a /b]", paths)
+	}
+
+	if _, err := LoadSourceList(filepath.Join(tempDir, "missing.txt")); err == nil {
+		t.Error("Expected error for missing source list")
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+// MigrationResult is a config file upgraded to the current schema
+type MigrationResult struct {
+	Data        []byte   // Migrated JSON document
+	FromVersion int      // Schema version of the input
+	Notes       []string // Changes that need the user's attention
+}
+
+// field is one top-level key of a JSON object, with its value verbatim
+type field struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// MigrateConfig upgrades a config file to constants.ConfigVersion. Keys keep
+// their order and values keep their formatting; JSON has no comments, so
+// there are none to carry over. Unknown keys are kept and reported.
+func MigrateConfig(data []byte) (*MigrationResult, error) {
+	fields, err := parseFields(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON config: %v", err)
+	}
+
+	result := &MigrationResult{}
+	for _, f := range fields {
+		if f.Key == "config_version" {
+			if err := json.Unmarshal(f.Value, &result.FromVersion); err != nil {
+				return nil, fmt.Errorf("invalid config_version: %v", err)
+			}
+		}
+	}
+	if result.FromVersion > constants.ConfigVersion {
+		return nil, fmt.Errorf("config_version %d is newer than this version of archiveFiles supports (%d)", result.FromVersion, constants.ConfigVersion)
+	}
+
+	if result.FromVersion < 1 {
+		fields = migrateLegacyFields(fields, result)
+	}
+	fields = migrateRestoreAuditLog(fields, result)
+
+	// Report keys the current schema ignores, but keep them
+	known := configKeys()
+	for _, f := range fields {
+		if !known[f.Key] {
+			result.Notes = append(result.Notes, fmt.Sprintf("%s is not a known setting and is ignored", f.Key))
+		}
+	}
+
+	version, _ := json.Marshal(constants.ConfigVersion)
+	fields = setField(fields, "config_version", version)
+
+	result.Data, err = formatFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// migrateLegacyFields converts the settings of the original single-binary
+// CLI (config version 0) to the version 1 schema
+func migrateLegacyFields(fields []field, result *MigrationResult) []field {
+	migrated := make([]field, 0, len(fields))
+	for _, f := range fields {
+		value := strings.TrimSpace(string(f.Value))
+		switch f.Key {
+		case "remove_backup":
+			// Inverted as keep_backup, which defaults to false
+			if value == "false" {
+				migrated = append(migrated, field{Key: "keep_backup", Value: json.RawMessage("true")})
+			}
+			continue
+		case "show_progress":
+			// Inverted as hide_progress, which defaults to false
+			if value == "false" {
+				migrated = append(migrated, field{Key: "hide_progress", Value: json.RawMessage("true")})
+			}
+			continue
+		case "filter":
+			if value != `""` && value != "null" {
+				result.Notes = append(result.Notes, "filter was dropped: it is not supported, use include_pattern")
+			}
+			continue
+		case "compression_format":
+			switch value {
+			case `"` + constants.CompressionGzip + `"`, `"` + constants.CompressionXz + `"`, `"` + constants.CompressionBzip2 + `"`, `"` + constants.CompressionNone + `"`, `""`, "null":
+			default:
+				result.Notes = append(result.Notes, fmt.Sprintf("compression_format %s was dropped: only gzip, xz, bzip2 and none (plain tar) are supported", value))
+				continue
+			}
+		case "include_pattern":
+			if value != `""` && value != "null" {
+				result.Notes = append(result.Notes, "include_pattern now selects extra files to archive as generic files; databases and logs are always included")
+			}
+		}
+		migrated = append(migrated, f)
+	}
+	return migrated
+}
+
+// migrateRestoreAuditLog folds restore_audit_log into audit_log, which now
+// records restore attempts along with every other audited command
+func migrateRestoreAuditLog(fields []field, result *MigrationResult) []field {
+	var restoreLog, auditLog json.RawMessage
+	for _, f := range fields {
+		switch f.Key {
+		case "restore_audit_log":
+			restoreLog = f.Value
+		case "audit_log":
+			auditLog = f.Value
+		}
+	}
+	if restoreLog == nil {
+		return fields
+	}
+
+	migrated := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if f.Key != "restore_audit_log" {
+			migrated = append(migrated, f)
+			continue
+		}
+		value := strings.TrimSpace(string(f.Value))
+		switch {
+		case value == `""` || value == "null":
+		case auditLog == nil:
+			migrated = append(migrated, field{Key: "audit_log", Value: f.Value})
+		case value != strings.TrimSpace(string(auditLog)):
+			result.Notes = append(result.Notes, fmt.Sprintf("restore_audit_log %s was dropped: restore attempts are recorded in audit_log %s", value, strings.TrimSpace(string(auditLog))))
+		}
+	}
+	return migrated
+}
+
+// parseFields reads the top-level keys of a JSON object in document order
+func parseFields(data []byte) ([]field, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("config must be a JSON object")
+	}
+
+	var fields []field
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field{Key: key, Value: value})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// setField replaces a key's value, or inserts the key first
+func setField(fields []field, key string, value json.RawMessage) []field {
+	for i := range fields {
+		if fields[i].Key == key {
+			fields[i].Value = value
+			return fields
+		}
+	}
+	return append([]field{{Key: key, Value: value}}, fields...)
+}
+
+// formatFields writes fields as an indented JSON object
+func formatFields(fields []field) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, f := range fields {
+		key, _ := json.Marshal(f.Key)
+		var value bytes.Buffer
+		if err := json.Indent(&value, f.Value, "  ", "  "); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %v", f.Key, err)
+		}
+		fmt.Fprintf(&buf, "  %s: %s", key, value.Bytes())
+		if i < len(fields)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// configKeys returns the JSON keys of types.Config
+func configKeys() map[string]bool {
+	keys := map[string]bool{}
+	configType := reflect.TypeOf(types.Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		name, _, _ := strings.Cut(configType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
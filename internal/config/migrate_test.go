@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+const legacyConfig = `{
+  "source_paths": ["./testdata/test_db"],
+  "backup_path": "backup_$(date +%Y%m%d_%H%M%S)",
+  "method": "checkpoint",
+  "compress": true,
+  "remove_backup": false,
+  "batch_mode": true,
+  "show_progress": true,
+  "filter": "",
+  "compression_format": "zstd",
+  "verify": false,
+  "retention": 7
+}`
+
+func TestMigrateConfig_Legacy(t *testing.T) {
+	result, err := MigrateConfig([]byte(legacyConfig))
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+	if result.FromVersion != 0 {
+		t.Errorf("FromVersion = %d, want 0", result.FromVersion)
+	}
+
+	var migrated map[string]interface{}
+	if err := json.Unmarshal(result.Data, &migrated); err != nil {
+		t.Fatalf("Migrated config is not valid JSON: %v\n%s", err, result.Data)
+	}
+	for _, key := range []string{"remove_backup", "show_progress", "filter", "compression_format"} {
+		if _, ok := migrated[key]; ok {
+			t.Errorf("Legacy key %s should be removed", key)
+		}
+	}
+	if migrated["keep_backup"] != true {
+		t.Errorf("remove_backup=false should become keep_backup=true: %v", migrated)
+	}
+	if _, ok := migrated["hide_progress"]; ok {
+		t.Errorf("show_progress=true should not set hide_progress: %v", migrated)
+	}
+	if migrated["config_version"] != float64(constants.ConfigVersion) {
+		t.Errorf("config_version = %v, want %d", migrated["config_version"], constants.ConfigVersion)
+	}
+	if migrated["method"] != "checkpoint" || migrated["retention"] != float64(7) {
+		t.Errorf("Other settings should be kept: %v", migrated)
+	}
+
+	// Key order is preserved, with the version first
+	data := string(result.Data)
+	if !strings.HasPrefix(data, "{\n  \"config_version\": 1,\n  \"source_paths\"") {
+		t.Errorf("Unexpected layout:\n%s", data)
+	}
+	if strings.Index(data, `"method"`) > strings.Index(data, `"verify"`) {
+		t.Errorf("Key order changed:\n%s", data)
+	}
+
+	notes := strings.Join(result.Notes, "\n")
+	for _, want := range []string{"compression_format", "retention"} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("Notes missing %q: %v", want, result.Notes)
+		}
+	}
+	if strings.Contains(notes, "show_progress") || strings.Contains(notes, "filter") {
+		t.Errorf("Default legacy values should not need a note: %v", result.Notes)
+	}
+}
+
+func TestMigrateConfig_LoadsAfterMigration(t *testing.T) {
+	result, err := MigrateConfig([]byte(legacyConfig))
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, result.Data, 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := LoadConfigFromJSON(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromJSON failed: %v", err)
+	}
+	if cfg.ConfigVersion != constants.ConfigVersion || !cfg.BatchMode {
+		t.Errorf("Unexpected config after migration: %+v", cfg)
+	}
+
+	// Migrating a current config changes nothing
+	again, err := MigrateConfig(result.Data)
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+	if string(again.Data) != string(result.Data) {
+		t.Errorf("Migration is not idempotent:\n%s\nvs\n%s", result.Data, again.Data)
+	}
+}
+
+func TestMigrateConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"Newer version", `{"config_version": 99}`},
+		{"Not an object", `["a"]`},
+		{"Invalid JSON", `{"method": }`},
+		{"Invalid version", `{"config_version": "one"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MigrateConfig([]byte(tt.input)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromJSON_NewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"config_version": 99, "method": "copy"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := LoadConfigFromJSON(path); err == nil {
+		t.Error("Expected error for a config from a newer version")
+	}
+}
+
+func TestMigrateConfig_LegacyFlagsMapped(t *testing.T) {
+	input := `{"source_paths": ["/data"], "show_progress": false, "exclude_pattern": "*.tmp", "compression_format": "gzip"}`
+	result, err := MigrateConfig([]byte(input))
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+
+	var migrated map[string]interface{}
+	if err := json.Unmarshal(result.Data, &migrated); err != nil {
+		t.Fatalf("Migrated config is not valid JSON: %v", err)
+	}
+	if migrated["hide_progress"] != true {
+		t.Errorf("show_progress=false should become hide_progress=true: %v", migrated)
+	}
+	if migrated["exclude_pattern"] != "*.tmp" || migrated["compression_format"] != "gzip" {
+		t.Errorf("Supported settings should be kept: %v", migrated)
+	}
+	if _, ok := migrated["keep_backup"]; ok {
+		t.Errorf("keep_backup should not be set without remove_backup=false: %v", migrated)
+	}
+}
+
+func TestMigrateConfig_RestoreAuditLog(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantAudit interface{}
+		wantNotes int
+	}{
+		{`{"config_version": 1, "restore_audit_log": "/var/log/restore.jsonl"}`, "/var/log/restore.jsonl", 0},
+		{`{"config_version": 1, "audit_log": "/var/log/audit.jsonl", "restore_audit_log": "/var/log/audit.jsonl"}`, "/var/log/audit.jsonl", 0},
+		{`{"config_version": 1, "audit_log": "/var/log/audit.jsonl", "restore_audit_log": "/var/log/restore.jsonl"}`, "/var/log/audit.jsonl", 1},
+		{`{"config_version": 1, "restore_audit_log": ""}`, nil, 0},
+	}
+	for _, tt := range tests {
+		result, err := MigrateConfig([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("MigrateConfig(%s) failed: %v", tt.input, err)
+		}
+		var migrated map[string]interface{}
+		if err := json.Unmarshal(result.Data, &migrated); err != nil {
+			t.Fatalf("Migrated config is not valid JSON: %v", err)
+		}
+		if _, ok := migrated["restore_audit_log"]; ok || migrated["audit_log"] != tt.wantAudit {
+			t.Errorf("MigrateConfig(%s) = %s, want audit_log %v and no restore_audit_log", tt.input, result.Data, tt.wantAudit)
+		}
+		if len(result.Notes) != tt.wantNotes {
+			t.Errorf("MigrateConfig(%s) notes = %q, want %d", tt.input, result.Notes, tt.wantNotes)
+		}
+	}
+}
@@ -2,20 +2,39 @@ package constants
 
 // File and directory permissions
 const (
-	DirPermission  = 0755 // Standard directory permission
-	FilePermission = 0644 // Standard file permission
+	DirPermission           = 0755 // Standard directory permission
+	FilePermission          = 0644 // Standard file permission
+	ControlSocketPermission = 0600 // Control socket: only the owner may cancel runs
 )
 
+// DefaultControlSocket is the conventional path of the control socket
+const DefaultControlSocket = "/var/run/archiveFiles.sock"
+
 // RocksDB backup constants
 const (
 	RocksDBWriteBatchSize         = 1000 // Number of records per write batch
 	RocksDBProgressUpdateInterval = 5000 // Update progress every N records
 )
 
+// RocksDB export constants
+const (
+	RocksDBExportSST          = "sst"         // Export format: external SST files for IngestExternalFile
+	RocksDBExportJSONL        = "jsonl"       // Export format: one JSON object per record
+	RocksDBExportCSV          = "csv"         // Export format: key and value columns
+	RocksDBExportMetadataFile = "export.json" // File describing an export, next to its data files
+	RocksDBExportFileSize     = 256 << 20     // Key and value bytes per exported SST file
+	RocksDBExportBase64       = "base64"      // Encoding of binary keys and values in text exports
+	RocksDBExportHex          = "hex"         // Alternative encoding of binary keys and values
+)
+
 // Progress display constants
 const (
-	ProgressBarWidth          = 40 // Width of progress bar in characters
-	ProgressFileNameMaxLength = 30 // Maximum length of displayed file name
+	ProgressBarWidth          = 40 // Maximum width of progress bar in characters
+	ProgressBarMinWidth       = 10 // Narrowest progress bar before the line is truncated
+	ProgressFileNameMaxLength = 30 // Displayed file name length the bar shrinks to make room for
+	DefaultTerminalWidth      = 80 // Columns assumed when the terminal size is unknown
+	ProgressFramesPerSecond   = 10 // How often the progress line is redrawn
+	ProgressPollsPerSecond    = 2  // How often a growing checkpoint or backup directory is measured
 )
 
 // Compression constants
@@ -23,6 +42,26 @@ const (
 	CompressionBufferSize = 32 * 1024 // 32KB buffer for compression
 )
 
+// File copy constants
+const (
+	CopyBufferSize        = 4 << 20  // 4MB chunks for file copies; SST files are commonly 64-256MB
+	CopyThroughputMinSize = 16 << 20 // Files from this size on have their copy rate logged at debug level
+	PrereadMaxSize        = 1 << 30  // With -preread, larger files are copied directly: reading them ahead would evict their start from the page cache again
+)
+
+// Temporary directory constants
+const (
+	TmpPrefix     = "archivefiles-" // Name prefix of the temporary directories the tool creates
+	TmpMinFree    = 1 << 30         // Free space a run requires in the temporary directory (1GB)
+	TmpStaleHours = 7 * 24          // Temporary directories untouched this long were left by a killed process and are removed
+)
+
+// Low-priority mode (-nice) constants
+const (
+	NiceLevel            = 19        // CPU priority of the process, the lowest
+	NiceRocksDBReadahead = 32 * 1024 // Fixed iterator readahead for RocksDB sources; RocksDB's own grows to 256KB
+)
+
 // Backup method constants
 const (
 	MethodCheckpoint = "checkpoint" // Recommended method
@@ -31,14 +70,227 @@ const (
 	MethodCopyFiles  = "copy-files" // File-level copy
 )
 
+// Configuration schema constants
+const (
+	ConfigVersion = 1 // Current config file schema; files without config_version are version 0 (legacy)
+)
+
+// Archive compression formats
+const (
+	CompressionGzip  = "gzip"  // tar.gz archives (default)
+	CompressionXz    = "xz"    // tar.xz through the xz tool, for consumers that need it; much slower
+	CompressionBzip2 = "bzip2" // tar.bz2 through the bzip2 tool, for consumers that need it; much slower
+	CompressionNone  = "none"  // Plain tar, for destinations that compress transparently (e.g. ZFS)
+
+	MaxCompressionLevel = 9 // Highest level of every supported format
+)
+
 // Default paths and patterns
 const (
-	DefaultBackupPathFormat  = "backup_%d" // Using Unix timestamp
-	DefaultArchivePathFormat = "%s.tar.gz" // Archive format
+	DefaultBackupPathFormat  = "backup_%d"          // Using Unix timestamp
+	DefaultArchivePathFormat = "%s.tar.gz"          // Archive format
+	RunLockFileName          = ".archivefiles.lock" // Per-destination lock file preventing concurrent runs
+	RunMarkerFileName        = ".archivefiles-run"  // Marks a backup directory whose run has not completed
+	TempArchiveSuffix        = ".tmp"               // Suffix of archives still being written
+)
+
+// MaxNamespaceLength is the longest tenant namespace accepted
+const MaxNamespaceLength = 64
+
+// Restore approval constants
+const (
+	ApprovalTokenEnv      = "ARCHIVEFILES_APPROVAL_TOKEN" // Environment variable holding the approval token of a restore
+	ApprovalValidityHours = 24                            // Default lifetime of an approval token
+)
+
+// Swap restore constants
+const (
+	SwapNewSuffix = ".new" // Staging directory a swap restore extracts into
+	SwapOldSuffix = ".old" // Previous live directory kept for rollback
+)
+
+// Upload constants
+const (
+	UploadStateSuffix   = ".upload.json" // Progress of an interrupted upload, kept next to the archive
+	UploadPartialSuffix = ".partial"     // Remote file an upload writes before renaming it into place
+	UploadBlockSize     = 1 << 20        // Parts are written in 1 MiB blocks, so part sizes are whole MiB
+
+	DownloadPartialSuffix = ".partial" // Local file a download writes before renaming it into place
+
+	TransferParallel    = 4  // Parts sent or received at once, each over its own SSH connection
+	TransferMaxParallel = 32 // Upper bound for -parallel; sshd refuses bursts of new connections
+)
+
+// Fleet constants
+const (
+	FleetParallel       = 4                   // Hosts a fleet coordinator backs up at once by default
+	FleetReportFileName = "fleet-report.json" // Consolidated report written next to the archives of a fleet run
 )
 
 // Database detection constants
 const (
-	MinRocksDBFilesRequired = 2  // Minimum RocksDB marker files needed
-	SQLiteHeaderSize        = 16 // Size of SQLite header to read
+	SQLiteHeaderSize = 16 // Size of SQLite header to read
+)
+
+// Durability policy constants (controls fsync of backups and archives)
+const (
+	DurabilityNone    = "none" // Never fsync, rely on the OS page cache
+	DurabilityData    = "data" // fsync copied files and the final archive
+	DurabilityFull    = "full" // Also fsync directories and the archive's parent after rename
+	DefaultDurability = DurabilityData
 )
+
+// Archive layout constants
+const (
+	ArchiveLayoutSingle  = "single"   // One tar.gz holding the whole backup
+	ArchiveLayoutPerItem = "per-item" // A directory with one tar.gz per item and an index
+)
+
+// Verification levels of the verify subcommand
+const (
+	VerifyLevelQuick  = "quick"  // The checks of -verify: critical files and sizes, integrity check, file checksums
+	VerifyLevelSample = "sample" // Quick, plus comparing a sample of keys/rows with the source
+	VerifyLevelFull   = "full"   // Quick, plus comparing every key/row with the source
+
+	DefaultVerifySample = "5%" // Sample size of the sample level when -sample is not given
+
+	VerifyBufferSize = 1 << 20 // 1MB chunks for hashing and comparing files during verification, whatever their size
+)
+
+// Corruption policy constants (what to do when a source fails its integrity check)
+const (
+	OnCorruptionFail         = "fail"          // Treat the item as failed
+	OnCorruptionBackupAnyway = "backup-anyway" // Back it up and flag it in the manifest
+	OnCorruptionSkip         = "skip"          // Leave it out of the backup and flag it in the manifest
+	DefaultOnCorruption      = OnCorruptionFail
+)
+
+// Log file detection constants
+const (
+	LogDetectionPermissive = "permissive" // Log-like file names, or content that looks like a log
+	LogDetectionStrict     = "strict"     // Only files whose content looks like a log
+	DefaultLogDetection    = LogDetectionPermissive
+	LogSniffSize           = 4096 // Bytes read from the start of a file to judge its content
+	LogSniffLines          = 10   // Lines of those bytes that are judged
+)
+
+// Access error policy constants (what to do when discovery cannot read a path)
+const (
+	OnAccessErrorSkip    = "skip" // Leave the path out and record it in the run report
+	OnAccessErrorWarn    = "warn" // Like skip, and log a warning
+	OnAccessErrorFail    = "fail" // Abort the run
+	DefaultOnAccessError = OnAccessErrorWarn
+)
+
+// RocksDB external directory constants
+const (
+	WALBackupDirName     = "wal_dir"  // Subdirectory of a RocksDB backup holding an external wal_dir
+	DBPathsBackupDirName = "db_paths" // Subdirectory of a RocksDB backup holding its db_paths/cf_paths directories
+)
+
+// RocksDB BlobDB constants
+const (
+	RocksDBBlobFileExt   = ".blob" // Extension of BlobDB blob files
+	RocksDBLegacyBlobDir = "blob"  // Subdirectory used by the legacy stackable BlobDB
+)
+
+// SQLiteCompanionSuffixes are the suffixes of files SQLite keeps next to a
+// database (write-ahead log, shared memory index and rollback journal)
+var SQLiteCompanionSuffixes = []string{"-wal", "-shm", "-journal"}
+
+// SQLite connection constants
+const (
+	SQLiteBusyTimeoutMs         = 5000 // How long a connection waits for another process's lock before failing
+	SQLiteLockProbeTimeoutMs    = 100  // How long the lock check during backup waits for the write lock
+	DefaultSQLiteMaxConnections = 16   // SQLite connections open at once across all workers
+)
+
+// DefaultRocksDBExclude lists the RocksDB files left out of backups unless
+// overridden: rotated info logs, leftovers of interrupted writes and OPTIONS
+// files superseded by a newer one (the newest is always kept)
+const DefaultRocksDBExclude = "LOG.old.*,*.dbtmp,OPTIONS-*"
+
+// Docker constants
+const (
+	DockerVolumeScheme     = "docker-volume://"     // Source prefix naming a Docker volume
+	DockerSocketPath       = "/var/run/docker.sock" // Default Docker Engine API socket
+	ContainerOutputLimit   = 64 * 1024              // Container output kept for a report; earlier output is dropped
+	ContainerOutputMaxRead = 256 * 1024 * 1024      // Container output read at most; longer output is cut there
+)
+
+// Job scheduling policies (the order items are handed to the workers)
+const (
+	ScheduleDiscovery     = "discovery"      // Discovery order
+	ScheduleLargestFirst  = "largest-first"  // Largest items first, so no huge item is left for the tail
+	ScheduleSmallestFirst = "smallest-first" // Smallest items first, so most items are done early
+	ScheduleInterleaved   = "interleaved"    // Alternate largest and smallest remaining items
+)
+
+// Source priorities
+const (
+	PriorityHigh   = "high"   // Backed up before all normal-priority items
+	PriorityNormal = "normal" // Default
+)
+
+// Source snapshot constants
+const (
+	SnapshotAPFS = "apfs" // Local APFS snapshot taken with tmutil (macOS)
+)
+
+// Kubernetes job mode constants
+const (
+	K8sConfigPath              = "/etc/archivefiles/config.json" // Config file mounted from a ConfigMap
+	K8sTerminationLogPath      = "/dev/termination-log"          // Default terminationMessagePath of a container
+	K8sTerminationLogLimit     = 4096                            // Kubernetes truncates termination messages beyond this size
+	K8sReportSkippedPathsLimit = 10                              // Unreadable paths listed in the run report
+	K8sRunIDAnnotation         = "archivefiles.io/run-id"        // Event annotation carrying the run ID
+)
+
+// Estimate constants
+const (
+	EstimateSampleBytes = 16 * 1024 * 1024 // Total bytes read to estimate the compression ratio
+	EstimateChunkSize   = 64 * 1024        // Size of each sampled chunk
+)
+
+// Backup catalog constants
+const (
+	CatalogMaxRuns           = 365 // Runs kept in the catalog; older ones are dropped
+	AnomalyWindow            = 7   // Number of earlier runs averaged for size anomaly detection
+	AnomalyMinHistory        = 3   // Earlier runs required before an item's size is judged
+	DefaultSizeDropThreshold = 50  // Percent drop against the trailing average that counts as an anomaly
+	ExitCodeSizeAnomaly      = 3   // Exit code when a backup completed but sizes look anomalous
+	ExitCodePartial          = 4   // Exit code when the time window closed before every item was started
+)
+
+// ItemLogSuffix is appended to an item's backup directory to name the log
+// of its backup (-item-logs)
+const ItemLogSuffix = ".backup.log"
+
+// Backup output constants
+const (
+	OutputLocal  = "local"  // The backup directory, compressed into an archive with -compress
+	OutputMirror = "mirror" // The backup tree copied file by file to a remote host, with an index
+)
+
+// Data classification constants
+const (
+	ClassificationPII       = "pii"
+	ClassificationFinancial = "financial"
+	ClassificationPublic    = "public"
+)
+
+// DefaultEncryptedOnlyClassifications are the labels whose backups only go
+// to encrypted destinations when encrypted_only_classifications is not set
+var DefaultEncryptedOnlyClassifications = []string{ClassificationPII}
+
+// Log output constants
+const (
+	LogOutputStderr   = "stderr"       // Standard error, with timestamps and optional colors
+	LogOutputSyslog   = "syslog"       // The local syslog daemon, daemon facility
+	LogOutputJournald = "journald"     // The systemd journal, in its native protocol
+	LogTag            = "archiveFiles" // Syslog tag and journal identifier
+)
+
+// LogModules are the internal packages whose log level can be set
+// separately in log_levels
+var LogModules = []string{"backup", "discovery", "hostinfo", "snapshot", "utils", "verify"}
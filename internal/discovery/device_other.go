@@ -0,0 +1,10 @@
+//go:build !unix
+
+package discovery
+
+import "os"
+
+// deviceID is not available on this platform, so -one-file-system is a no-op
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
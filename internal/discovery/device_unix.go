@@ -0,0 +1,17 @@
+//go:build unix
+
+package discovery
+
+import (
+	"os"
+	"syscall"
+)
+
+// deviceID returns the device number of the filesystem holding info
+func deviceID(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
@@ -1,20 +1,47 @@
 package discovery
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+	"archiveFiles/internal/sqlitedb"
 	"archiveFiles/internal/types"
 	"archiveFiles/internal/utils"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// log is the discovery module logger; its level can be set in log_levels
+var log = logger.NewModule("discovery")
+
 // DiscoverDatabases discovers databases in the source path
 func DiscoverDatabases(config *types.Config, sourcePath string) ([]types.DatabaseInfo, error) {
+	databases, _, err := DiscoverDatabasesWithSkipped(config, sourcePath)
+	return databases, err
+}
+
+// DiscoverDatabasesWithSkipped discovers databases in the source path and
+// also returns the paths left out because they could not be read. What
+// happens to those depends on config.OnAccessError.
+func DiscoverDatabasesWithSkipped(config *types.Config, sourcePath string) ([]types.DatabaseInfo, []types.SkippedPath, error) {
+	var skipped []types.SkippedPath
+	databases, err := discoverDatabases(config, sourcePath, &skipped)
+	if err != nil {
+		return databases, skipped, err
+	}
+	return groupSQLiteUnits(config, databases), skipped, nil
+}
+
+// discoverDatabases finds every database and file in the source path
+func discoverDatabases(config *types.Config, sourcePath string, skipped *[]types.SkippedPath) ([]types.DatabaseInfo, error) {
 	var databases []types.DatabaseInfo
 
 	// Check if source path exists
@@ -30,39 +57,44 @@ func DiscoverDatabases(config *types.Config, sourcePath string) ([]types.Databas
 
 	if !info.IsDir() {
 		// Single file mode
-		dbType := DetectDatabaseType(sourcePath)
+		dbType := detectFileType(config, sourcePath)
 		if dbType == types.DatabaseTypeUnknown {
 			return nil, fmt.Errorf("unknown file type: %s", sourcePath)
 		}
 
 		databases = append(databases, types.DatabaseInfo{
-			Path: sourcePath,
-			Type: dbType,
-			Name: filepath.Base(sourcePath),
-			Size: info.Size(), // Single file size is already known
+			Path:      sourcePath,
+			Type:      dbType,
+			Name:      filepath.Base(sourcePath),
+			Size:      info.Size(), // Single file size is already known
+			Encrypted: IsEncrypted(dbType, sourcePath),
 		})
 
 		return databases, nil
 	}
 
 	// Check if the directory itself is a database (like RocksDB)
-	dbType := DetectDatabaseType(sourcePath)
+	dbType := detectDatabaseType(sourcePath, config.LogDetection)
 	if dbType != types.DatabaseTypeUnknown {
 		// The entire directory is a database, treat it as a single unit
 		databases = append(databases, types.DatabaseInfo{
-			Path: sourcePath,
-			Type: dbType,
-			Name: filepath.Base(sourcePath),
-			Size: utils.CalculateSize(sourcePath), // Calculate size once during discovery
+			Path:      sourcePath,
+			Type:      dbType,
+			Name:      filepath.Base(sourcePath),
+			Size:      utils.CalculateSize(sourcePath), // Calculate size once during discovery
+			Encrypted: IsEncrypted(dbType, sourcePath),
 		})
 
 		return databases, nil
 	}
 
+	// Remember the root device so the walk can stay on one filesystem
+	rootDevice, haveRootDevice := deviceID(info)
+
 	// Directory mode - scan directory for multiple databases
 	err = filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return err
+			return handleAccessError(config, path, err, skipped)
 		}
 
 		// Skip the root directory itself
@@ -70,15 +102,50 @@ func DiscoverDatabases(config *types.Config, sourcePath string) ([]types.Databas
 			return nil
 		}
 
+		// Do not cross into other mounts when restricted to one filesystem
+		if config.OneFileSystem && info.IsDir() && haveRootDevice {
+			if device, ok := deviceID(info); ok && device != rootDevice {
+				return filepath.SkipDir
+			}
+		}
+
+		// Entries below the depth limit are ignored entirely
+		depth := pathDepth(sourcePath, path)
+		if config.MaxDepth > 0 && depth > config.MaxDepth {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Excluded directories are skipped with everything below them
+		if isExcludedPath(config.ExcludePaths, path) ||
+			(config.ExcludePattern != "" && !utils.ShouldIncludeFile(path, "", config.ExcludePattern)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Unreadable files would otherwise go unrecognized or fail later
+		if info.Mode().IsRegular() {
+			if err := checkReadable(path); err != nil {
+				return handleAccessError(config, path, err, skipped)
+			}
+		}
+
 		// Detect database/file type (works for both files and directories)
-		dbType := DetectDatabaseType(path)
+		dbType := detectFileType(config, path)
 		if dbType == types.DatabaseTypeUnknown {
+			// Directories at the depth limit are checked but not descended
+			if info.IsDir() && config.MaxDepth > 0 && depth >= config.MaxDepth {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Include/exclude patterns have been removed - all discovered databases are included
-
-		// Create relative name for backup
+		// The backup keeps the directory structure of the source, so that
+		// a/b.db and a_b.db cannot end up at the same path
 		relPath, err := filepath.Rel(sourcePath, path)
 		if err != nil {
 			relPath = filepath.Base(path)
@@ -93,10 +160,11 @@ func DiscoverDatabases(config *types.Config, sourcePath string) ([]types.Databas
 		}
 
 		databases = append(databases, types.DatabaseInfo{
-			Path: path,
-			Type: dbType,
-			Name: strings.ReplaceAll(relPath, string(filepath.Separator), "_"),
-			Size: size, // Size calculated during discovery
+			Path:      path,
+			Type:      dbType,
+			Name:      filepath.ToSlash(relPath),
+			Size:      size, // Size calculated during discovery
+			Encrypted: IsEncrypted(dbType, path),
 		})
 
 		// If this is a RocksDB directory, don't walk into it
@@ -110,112 +178,306 @@ func DiscoverDatabases(config *types.Config, sourcePath string) ([]types.Databas
 	return databases, err
 }
 
-// DetectDatabaseType detects database type based on file characteristics
+// isExcludedPath reports whether path is one of excludes or lies below one
+func isExcludedPath(excludes []string, path string) bool {
+	for _, exclude := range excludes {
+		if utils.IsWithin(path, exclude) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAccessError applies the access error policy to a path the walk
+// could not read. Skipped paths are recorded; fail stops the walk.
+func handleAccessError(config *types.Config, path string, err error, skipped *[]types.SkippedPath) error {
+	switch config.OnAccessError {
+	case constants.OnAccessErrorFail:
+		return err
+	case constants.OnAccessErrorSkip:
+	default:
+		log.Warning("Skipping unreadable path %s: %v", path, err)
+	}
+	*skipped = append(*skipped, types.SkippedPath{Path: path, Error: err.Error()})
+	return nil
+}
+
+// checkReadable reports whether a file can be opened for reading
+func checkReadable(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// groupSQLiteUnits treats each SQLite database as one logical unit with its
+// companion files and configured ATTACHed databases: those files are removed
+// from the item list, recorded on the main database and counted in its size
+func groupSQLiteUnits(config *types.Config, databases []types.DatabaseInfo) []types.DatabaseInfo {
+	members := make(map[string]bool)
+	for i := range databases {
+		db := &databases[i]
+		if db.Type != types.DatabaseTypeSQLite {
+			continue
+		}
+
+		for _, suffix := range constants.SQLiteCompanionSuffixes {
+			companion := db.Path + suffix
+			if info, err := os.Stat(companion); err == nil {
+				members[filepath.Clean(companion)] = true
+				db.Size += info.Size()
+			}
+		}
+
+		for _, attachment := range sqliteAttachments(config, db.Path) {
+			members[filepath.Clean(attachment)] = true
+			db.Attachments = append(db.Attachments, attachment)
+			if info, err := os.Stat(attachment); err == nil {
+				db.Size += info.Size()
+			}
+		}
+	}
+
+	if len(members) == 0 {
+		return databases
+	}
+
+	grouped := databases[:0]
+	for _, db := range databases {
+		if !members[filepath.Clean(db.Path)] {
+			grouped = append(grouped, db)
+		}
+	}
+	return grouped
+}
+
+// sqliteAttachments returns the configured ATTACHed databases of dbPath
+func sqliteAttachments(config *types.Config, dbPath string) []string {
+	if len(config.SQLiteAttachments) == 0 {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		absPath = filepath.Clean(dbPath)
+	}
+	for configuredPath, attachments := range config.SQLiteAttachments {
+		if absConfigured, err := filepath.Abs(configuredPath); err == nil && absConfigured == absPath {
+			return attachments
+		}
+	}
+	return nil
+}
+
+// detectFileType runs rule-based and built-in detection, then classifies
+// remaining regular files matching the include pattern as generic files
+func detectFileType(config *types.Config, path string) types.DatabaseType {
+	dbType := detectWithRules(config, path)
+	if dbType != types.DatabaseTypeUnknown || config.IncludePattern == "" {
+		return dbType
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		if utils.ShouldIncludeFile(path, config.IncludePattern, "") {
+			return types.DatabaseTypeGenericFile
+		}
+	}
+	return types.DatabaseTypeUnknown
+}
+
+// detectWithRules applies user-defined detection rules to regular files and
+// falls back to built-in detection when none match
+func detectWithRules(config *types.Config, path string) types.DatabaseType {
+	if len(config.DetectionRules) > 0 {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			for _, rule := range config.DetectionRules {
+				if matchesRule(rule, path) {
+					if dbType, err := types.ParseDatabaseType(rule.Type); err == nil {
+						return dbType
+					}
+				}
+			}
+		}
+	}
+	return detectDatabaseType(path, config.LogDetection)
+}
+
+// matchesRule reports whether a file satisfies every condition of a rule
+func matchesRule(rule types.DetectionRule, path string) bool {
+	if rule.Pattern != "" {
+		if matched, _ := filepath.Match(rule.Pattern, filepath.Base(path)); !matched {
+			return false
+		}
+	}
+
+	if rule.Magic != "" {
+		magic, err := hex.DecodeString(rule.Magic)
+		if err != nil || len(magic) == 0 {
+			return false
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+
+		prefix := make([]byte, len(magic))
+		if _, err := io.ReadFull(file, prefix); err != nil {
+			return false
+		}
+		if !bytes.Equal(prefix, magic) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pathDepth returns how many levels below root path is (direct children are 1)
+func pathDepth(root, path string) int {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil || relPath == "." {
+		return 0
+	}
+	return len(strings.Split(relPath, string(filepath.Separator)))
+}
+
+// DetectDatabaseType detects database type based on file characteristics,
+// with permissive log file detection
 func DetectDatabaseType(path string) types.DatabaseType {
-	// Check if it's a RocksDB directory
+	return detectDatabaseType(path, constants.DefaultLogDetection)
+}
+
+// detectDatabaseType detects database type, judging log files by
+// logDetection (empty = permissive)
+func detectDatabaseType(path, logDetection string) types.DatabaseType {
+	// Check if it's a RocksDB directory; other directories are never items
 	if info, err := os.Stat(path); err == nil && info.IsDir() {
 		// Look for RocksDB files
-		if hasRocksDBFiles(path) {
+		if hasRocksDBFiles(path) || isEncryptedRocksDB(path) {
 			return types.DatabaseTypeRocksDB
 		}
+		return types.DatabaseTypeUnknown
 	}
 
 	// Check if it's a SQLite file
-	if isSQLiteFile(path) {
+	if isSQLiteFile(path) || isEncryptedSQLiteFile(path) {
 		return types.DatabaseTypeSQLite
 	}
 
 	// Check if it's a log file
-	if isLogFile(path) {
+	if isLogFile(path, logDetection) {
 		return types.DatabaseTypeLogFile
 	}
 
 	return types.DatabaseTypeUnknown
 }
 
-// hasRocksDBFiles checks if directory contains RocksDB files
+// RocksDB on-disk format constants used for detection
+const (
+	rocksDBCurrentFile    = "CURRENT"
+	rocksDBManifestPrefix = "MANIFEST-"
+	logBlockSize          = 32768 // Log writer block size
+	logHeaderSize         = 7     // checksum (4) + length (2) + type (1)
+	logRecyclableHeader   = 11    // Recyclable records also carry a log number (4)
+	logFullType           = 1
+	logFirstType          = 2
+	logRecyclableFull     = 5
+	logRecyclableFirst    = 6
+	crcMaskDelta          = 0xa282ead8
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// hasRocksDBFiles checks if directory is a RocksDB database: CURRENT must
+// name an existing MANIFEST whose first record is a valid log record
 func hasRocksDBFiles(dirPath string) bool {
-	files, err := os.ReadDir(dirPath)
-	if err != nil {
+	manifestName, ok := readCurrentManifest(dirPath)
+	if !ok {
 		return false
 	}
+	return hasValidManifestHeader(filepath.Join(dirPath, manifestName))
+}
 
-	var rocksDBFileCount int
-	for _, file := range files {
-		name := file.Name()
-		if strings.HasPrefix(name, "CURRENT") ||
-			strings.HasPrefix(name, "MANIFEST") ||
-			strings.HasPrefix(name, "LOG") ||
-			strings.HasSuffix(name, ".sst") ||
-			strings.HasSuffix(name, ".log") {
-			rocksDBFileCount++
-		}
+// readCurrentManifest returns the MANIFEST file name referenced by CURRENT
+func readCurrentManifest(dirPath string) (string, bool) {
+	file, err := os.Open(filepath.Join(dirPath, rocksDBCurrentFile))
+	if err != nil {
+		return "", false
 	}
+	defer file.Close()
 
-	// Require at least 2 RocksDB files to be considered a valid RocksDB directory
-	return rocksDBFileCount >= 2
-}
-
-// isSQLiteFile checks if file is a SQLite database
-func isSQLiteFile(filePath string) bool {
-	// Check file extension
-	ext := strings.ToLower(filepath.Ext(filePath))
-	if ext == ".db" || ext == ".sqlite" || ext == ".sqlite3" || ext == ".db3" {
-		// Verify it's actually a SQLite file by checking header
-		return hasValidSQLiteHeader(filePath)
+	// CURRENT holds a single short line such as "MANIFEST-000005\n"
+	buf := make([]byte, 256)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", false
 	}
 
-	return false
+	name := strings.TrimSpace(string(buf[:n]))
+	if !strings.HasPrefix(name, rocksDBManifestPrefix) || strings.ContainsAny(name, "/\\") {
+		return "", false
+	}
+	return name, true
 }
 
-// isLogFile checks if file is a log file
-func isLogFile(filePath string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	filename := strings.ToLower(filepath.Base(filePath))
-
-	// Check by extension (.log files are always logs)
-	if ext == ".log" || ext == ".logx" {
-		return true
+// hasValidManifestHeader checks that a MANIFEST starts with a complete,
+// checksummed log record of type FULL or FIRST
+func hasValidManifestHeader(manifestPath string) bool {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return false
 	}
+	defer file.Close()
 
-	// For .txt files, be more inclusive but still use some pattern matching
-	if ext == ".txt" {
-		// Common log patterns
-		logPatterns := []string{
-			"access", "error", "debug", "info", "warn", "trace",
-			"audit", "security", "application", "system", "server",
-			"database", "sql", "query", "transaction", "backup",
-			"log", "messages", "syslog", "output", "trace",
-		}
+	header := make([]byte, logRecyclableHeader)
+	if _, err := io.ReadFull(file, header[:logHeaderSize]); err != nil {
+		return false
+	}
 
-		// Check if filename contains any log patterns
-		for _, pattern := range logPatterns {
-			if strings.Contains(filename, pattern) {
-				return true
-			}
+	recordType := header[6]
+	headerSize := logHeaderSize
+	switch recordType {
+	case logFullType, logFirstType:
+	case logRecyclableFull, logRecyclableFirst:
+		headerSize = logRecyclableHeader
+		if _, err := io.ReadFull(file, header[logHeaderSize:]); err != nil {
+			return false
 		}
+	default:
+		return false
+	}
 
-		// For testing purposes, also consider files with generic names like "test.txt"
-		// as potential log files if they don't clearly indicate another type
-		if strings.Contains(filename, "test") || strings.Contains(filename, "sample") {
-			return true
-		}
+	length := int(binary.LittleEndian.Uint16(header[4:6]))
+	if length == 0 || headerSize+length > logBlockSize {
+		return false
 	}
 
-	// Check by filename patterns (for files without extensions or other extensions)
-	logPatterns := []string{
-		"access", "error", "debug", "info", "warn", "trace",
-		"audit", "security", "application", "system", "server",
-		"database", "sql", "query", "transaction", "backup",
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(file, payload); err != nil {
+		return false
 	}
 
-	// Only consider files with log-like names and no extension or specific extensions
-	if ext == "" || ext == ".out" {
-		for _, pattern := range logPatterns {
-			if strings.Contains(filename, pattern) {
-				return true
-			}
-		}
+	// The checksum covers the type byte, the log number (if any) and the payload
+	crc := crc32.Update(0, castagnoliTable, header[6:headerSize])
+	crc = crc32.Update(crc, castagnoliTable, payload)
+	return unmaskCRC(binary.LittleEndian.Uint32(header[0:4])) == crc
+}
+
+// unmaskCRC reverses the masking RocksDB applies to stored checksums
+func unmaskCRC(masked uint32) uint32 {
+	rot := masked - crcMaskDelta
+	return (rot >> 17) | (rot << 15)
+}
+
+// isSQLiteFile checks if file is a SQLite database
+func isSQLiteFile(filePath string) bool {
+	// Check file extension
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == ".db" || ext == ".sqlite" || ext == ".sqlite3" || ext == ".db3" {
+		// Verify it's actually a SQLite file by checking header
+		return hasValidSQLiteHeader(filePath)
 	}
 
 	return false
@@ -244,7 +506,7 @@ func CheckDatabaseLock(dbPath string, dbType types.DatabaseType) (*types.Databas
 		return checkRocksDBLock(dbPath)
 	case types.DatabaseTypeSQLite:
 		return checkSQLiteLock(dbPath)
-	case types.DatabaseTypeLogFile:
+	case types.DatabaseTypeLogFile, types.DatabaseTypeGenericFile:
 		return nil, nil
 	default:
 		// For unknown types, return nil
@@ -268,6 +530,31 @@ func checkRocksDBLock(dbPath string) (*types.DatabaseLockInfo, error) {
 	return info, nil
 }
 
+// probeSQLiteWriteLock takes and releases the write lock of a SQLite
+// database, waiting at most constants.SQLiteLockProbeTimeoutMs for it
+func probeSQLiteWriteLock(dbPath string) error {
+	db, err := sqlitedb.Open(dbPath, sqlitedb.ReadWrite)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", constants.SQLiteLockProbeTimeoutMs)); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "ROLLBACK")
+	return err
+}
+
 // checkSQLiteLock checks if SQLite database is locked
 func checkSQLiteLock(dbPath string) (*types.DatabaseLockInfo, error) {
 	info := &types.DatabaseLockInfo{}
@@ -278,31 +565,24 @@ func checkSQLiteLock(dbPath string) (*types.DatabaseLockInfo, error) {
 	}
 
 	// Check for SQLite lock files
-	lockFiles := []string{
-		dbPath + "-wal",
-		dbPath + "-shm",
-		dbPath + "-journal",
-	}
-
 	hasLockFiles := false
-	for _, lockFile := range lockFiles {
-		if _, err := os.Stat(lockFile); err == nil {
+	for _, suffix := range constants.SQLiteCompanionSuffixes {
+		if _, err := os.Stat(dbPath + suffix); err == nil {
 			hasLockFiles = true
 			break
 		}
 	}
 
-	// Try to open the database with a write lock to test if it's locked
-	db, err := sql.Open("sqlite3", dbPath+"?mode=rw&_txlock=exclusive&_timeout=100")
-	if err != nil {
+	// Try to take the write lock to test if another process holds it.
+	// BEGIN IMMEDIATE does not keep readers out, so the probe does not
+	// stall a live database.
+	if err := probeSQLiteWriteLock(dbPath); err != nil {
 		if strings.Contains(err.Error(), "locked") || strings.Contains(err.Error(), "busy") {
 			info.IsLocked = true
 			info.LockType = "SQLite database lock"
 			info.ProcessInfo = "Database is locked by another SQLite process"
 			return info, nil
 		}
-	} else {
-		db.Close()
 	}
 
 	if hasLockFiles {
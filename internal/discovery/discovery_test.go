@@ -1,10 +1,15 @@
 package discovery
 
 import (
+	"database/sql"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"archiveFiles/internal/constants"
 	"archiveFiles/internal/types"
 )
 
@@ -42,6 +47,7 @@ func TestDetectDatabaseType(t *testing.T) {
 				t.Fatalf("Failed to create RocksDB file %s: %v", file, err)
 			}
 		}
+		writeRocksDBMarkers(t, rocksdbDir)
 
 		dbType := DetectDatabaseType(rocksdbDir)
 		if dbType != types.DatabaseTypeRocksDB {
@@ -88,7 +94,7 @@ func TestDetectDatabaseType(t *testing.T) {
 
 		for _, ext := range logExtensions {
 			logFile := filepath.Join(tempDir, "test"+ext)
-			err := os.WriteFile(logFile, []byte("Log file content"), 0644)
+			err := os.WriteFile(logFile, []byte("2024-03-01 02:00:00 Log file content\n"), 0644)
 			if err != nil {
 				t.Fatalf("Failed to create log file with extension %s: %v", ext, err)
 			}
@@ -225,6 +231,7 @@ func TestDiscoverDatabases(t *testing.T) {
 				t.Fatalf("Failed to create RocksDB file %s: %v", file, err)
 			}
 		}
+		writeRocksDBMarkers(t, rocksdbDir)
 
 		config := &types.Config{
 			SourcePaths: []string{rocksdbDir},
@@ -504,6 +511,36 @@ func TestCheckDatabaseLock(t *testing.T) {
 		}
 	})
 
+	// Test a database another connection is writing to
+	t.Run("SQLite write lock", func(t *testing.T) {
+		sqliteFile := filepath.Join(tempDir, "busy.db")
+		writer, err := sql.Open("sqlite3", sqliteFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Close()
+		writer.SetMaxOpenConns(1)
+		if _, err := writer.Exec("CREATE TABLE t (v TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := writer.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("INSERT INTO t VALUES ('pending')"); err != nil {
+			t.Fatal(err)
+		}
+
+		lockInfo, err := CheckDatabaseLock(sqliteFile, types.DatabaseTypeSQLite)
+		if err != nil {
+			t.Errorf("CheckDatabaseLock failed: %v", err)
+		}
+		if lockInfo == nil || !lockInfo.IsLocked || lockInfo.LockType != "SQLite database lock" {
+			t.Errorf("Expected the write lock to be detected, got %+v", lockInfo)
+		}
+	})
+
 	// Test unlocked database
 	t.Run("Unlocked database", func(t *testing.T) {
 		sqliteFile := filepath.Join(tempDir, "unlocked.db")
@@ -625,8 +662,8 @@ func TestDiscoverDatabases_EdgeCases(t *testing.T) {
 		}
 
 		// Should find the deeply nested file
-		// The name will be constructed from the relative path with separators replaced by underscores
-		expectedName := "level1_level2_level3_level4_deep.db"
+		// The name is the slash-separated path relative to the source root
+		expectedName := "level1/level2/level3/level4/deep.db"
 		found := false
 		for _, db := range databases {
 			if db.Name == expectedName {
@@ -680,3 +717,561 @@ func TestDiscoverDatabases_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestDiscoverDatabases_MaxDepth(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Log files at depths 1, 2 and 3
+	files := []string{
+		"top.log",
+		filepath.Join("a", "middle.log"),
+		filepath.Join("a", "b", "deep.log"),
+	}
+	for _, relPath := range files {
+		fullPath := filepath.Join(tempDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte("log line\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		maxDepth int
+		expected int
+	}{
+		{0, 3},
+		{1, 1},
+		{2, 2},
+		{3, 3},
+	}
+
+	for _, tt := range tests {
+		cfg := &types.Config{MaxDepth: tt.maxDepth}
+		databases, err := DiscoverDatabases(cfg, tempDir)
+		if err != nil {
+			t.Fatalf("DiscoverDatabases(max-depth=%d) failed: %v", tt.maxDepth, err)
+		}
+		if len(databases) != tt.expected {
+			t.Errorf("max-depth=%d: found %d items, want %d", tt.maxDepth, len(databases), tt.expected)
+		}
+	}
+}
+
+func TestDiscoverDatabases_OneFileSystem(t *testing.T) {
+	// Everything in a temp dir lives on one filesystem, so the flag must not
+	// hide anything
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "sub", "app.log"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	databases, err := DiscoverDatabases(&types.Config{OneFileSystem: true}, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+	if len(databases) != 1 {
+		t.Errorf("Expected 1 item on the same filesystem, got %d", len(databases))
+	}
+}
+
+// encodeLogRecord builds a single FULL log record as RocksDB writes it
+func encodeLogRecord(payload []byte) []byte {
+	record := make([]byte, logHeaderSize+len(payload))
+	record[6] = logFullType
+	binary.LittleEndian.PutUint16(record[4:6], uint16(len(payload)))
+	copy(record[logHeaderSize:], payload)
+
+	crc := crc32.Update(0, castagnoliTable, record[6:7])
+	crc = crc32.Update(crc, castagnoliTable, payload)
+	masked := ((crc >> 15) | (crc << 17)) + crcMaskDelta
+	binary.LittleEndian.PutUint32(record[0:4], masked)
+	return record
+}
+
+// writeRocksDBMarkers writes a CURRENT file and a MANIFEST with a valid
+// first record so the directory is detected as RocksDB
+func writeRocksDBMarkers(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "CURRENT"), []byte("MANIFEST-000001\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CURRENT: %v", err)
+	}
+	manifest := encodeLogRecord([]byte("leveldb.BytewiseComparator"))
+	if err := os.WriteFile(filepath.Join(dir, "MANIFEST-000001"), manifest, 0644); err != nil {
+		t.Fatalf("Failed to write MANIFEST: %v", err)
+	}
+}
+
+func TestHasRocksDBFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	newDir := func(name string) string {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		return dir
+	}
+	writeFile := func(dir, name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Run("Valid database", func(t *testing.T) {
+		dir := newDir("valid")
+		writeRocksDBMarkers(t, dir)
+		if !hasRocksDBFiles(dir) {
+			t.Error("Expected directory with valid CURRENT and MANIFEST to be RocksDB")
+		}
+	})
+
+	t.Run("Only log files", func(t *testing.T) {
+		dir := newDir("logs")
+		writeFile(dir, "app.log", []byte("line"))
+		writeFile(dir, "LOG", []byte("line"))
+		writeFile(dir, "error.log", []byte("line"))
+		if hasRocksDBFiles(dir) {
+			t.Error("Directory with only log files must not be detected as RocksDB")
+		}
+	})
+
+	t.Run("CURRENT references missing MANIFEST", func(t *testing.T) {
+		dir := newDir("missing_manifest")
+		writeFile(dir, "CURRENT", []byte("MANIFEST-000009\n"))
+		if hasRocksDBFiles(dir) {
+			t.Error("Expected false when MANIFEST is missing")
+		}
+	})
+
+	t.Run("CURRENT with garbage", func(t *testing.T) {
+		dir := newDir("garbage_current")
+		writeFile(dir, "CURRENT", []byte("not a manifest name"))
+		writeFile(dir, "MANIFEST-000001", encodeLogRecord([]byte("x")))
+		if hasRocksDBFiles(dir) {
+			t.Error("Expected false for CURRENT without a MANIFEST reference")
+		}
+	})
+
+	t.Run("CURRENT with path traversal", func(t *testing.T) {
+		dir := newDir("traversal")
+		writeFile(dir, "CURRENT", []byte("MANIFEST-../../etc\n"))
+		if hasRocksDBFiles(dir) {
+			t.Error("Expected false for CURRENT containing path separators")
+		}
+	})
+
+	t.Run("Corrupt MANIFEST checksum", func(t *testing.T) {
+		dir := newDir("corrupt")
+		writeRocksDBMarkers(t, dir)
+		record := encodeLogRecord([]byte("leveldb.BytewiseComparator"))
+		record[len(record)-1] ^= 0xff
+		writeFile(dir, "MANIFEST-000001", record)
+		if hasRocksDBFiles(dir) {
+			t.Error("Expected false for MANIFEST with a bad checksum")
+		}
+	})
+
+	t.Run("MANIFEST with text content", func(t *testing.T) {
+		dir := newDir("text_manifest")
+		writeFile(dir, "CURRENT", []byte("MANIFEST-000001\n"))
+		writeFile(dir, "MANIFEST-000001", []byte("test content"))
+		if hasRocksDBFiles(dir) {
+			t.Error("Expected false for MANIFEST without a log record header")
+		}
+	})
+}
+
+func TestDiscoverDatabases_DetectionRules(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string][]byte{
+		"inventory.mdb": []byte("\x00\x01\x00\x00Standard Jet DB"),
+		"image.bin":     []byte("\xca\xfe\xba\xbebinary"),
+		"other.bin":     []byte("no magic here"),
+		"notes.dat":     []byte("plain"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cfg := &types.Config{
+		DetectionRules: []types.DetectionRule{
+			{Pattern: "*.mdb", Type: "logfile"},
+			{Pattern: "*.bin", Magic: "cafebabe", Type: "logfile"},
+		},
+	}
+
+	databases, err := DiscoverDatabases(cfg, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	found := make(map[string]types.DatabaseType)
+	for _, db := range databases {
+		found[db.Name] = db.Type
+	}
+
+	if found["inventory.mdb"] != types.DatabaseTypeLogFile {
+		t.Errorf("Expected inventory.mdb to match the pattern rule, got %v", found)
+	}
+	if found["image.bin"] != types.DatabaseTypeLogFile {
+		t.Errorf("Expected image.bin to match the magic rule, got %v", found)
+	}
+	if _, ok := found["other.bin"]; ok {
+		t.Error("other.bin lacks the magic prefix and must not match")
+	}
+	if _, ok := found["notes.dat"]; ok {
+		t.Error("notes.dat matches no rule and must not be discovered")
+	}
+
+	// Single file sources honour the rules as well
+	single, err := DiscoverDatabases(cfg, filepath.Join(tempDir, "inventory.mdb"))
+	if err != nil {
+		t.Fatalf("DiscoverDatabases on single file failed: %v", err)
+	}
+	if len(single) != 1 || single[0].Type != types.DatabaseTypeLogFile {
+		t.Errorf("Expected single rule-matched file, got %v", single)
+	}
+}
+
+func TestDiscoverDatabases_IncludePattern(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{"settings.yaml", "dump.pb", "app.log", "readme.md"}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cfg := &types.Config{IncludePattern: "*.yaml, *.pb"}
+	databases, err := DiscoverDatabases(cfg, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	found := make(map[string]types.DatabaseType)
+	for _, db := range databases {
+		found[db.Name] = db.Type
+	}
+
+	expected := map[string]types.DatabaseType{
+		"settings.yaml": types.DatabaseTypeGenericFile,
+		"dump.pb":       types.DatabaseTypeGenericFile,
+		"app.log":       types.DatabaseTypeLogFile, // Built-in detection still wins
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Found %v, want %v", found, expected)
+	}
+	for name, dbType := range expected {
+		if found[name] != dbType {
+			t.Errorf("%s detected as %v, want %v", name, found[name], dbType)
+		}
+	}
+}
+
+func TestDiscoverDatabases_ExcludePattern(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		"app.log",
+		"app-temp.log",
+		filepath.Join("cache", "cached.log"),
+		filepath.Join("logs", "server.log"),
+	}
+	for _, relPath := range files {
+		fullPath := filepath.Join(tempDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte("log line\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	cfg := &types.Config{ExcludePattern: "*temp*, cache"}
+	databases, err := DiscoverDatabases(cfg, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, db := range databases {
+		found[db.Name] = true
+	}
+	if len(found) != 2 || !found["app.log"] || !found["logs/server.log"] {
+		t.Errorf("Found %v, want app.log and logs/server.log", found)
+	}
+}
+
+func TestDiscoverDatabases_ExcludePaths(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, relPath := range []string{"app.log", filepath.Join("backup", "app.log"), "backup.tar.gz.log"} {
+		fullPath := filepath.Join(tempDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte("log line\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	cfg := &types.Config{ExcludePaths: []string{filepath.Join(tempDir, "backup"), filepath.Join(tempDir, "backup.tar.gz.log")}}
+	databases, err := DiscoverDatabases(cfg, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+	if len(databases) != 1 || databases[0].Name != "app.log" {
+		t.Errorf("Found %v, want only app.log", databases)
+	}
+}
+
+func TestDiscoverDatabases_NamesDoNotCollide(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, relPath := range []string{filepath.Join("a", "b.db"), "a_b.db"} {
+		fullPath := filepath.Join(tempDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte("SQLite format 3\x00"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", relPath, err)
+		}
+	}
+
+	databases, err := DiscoverDatabases(&types.Config{}, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	found := make(map[string]string)
+	for _, db := range databases {
+		found[db.Name] = db.Path
+	}
+	if len(found) != 2 || found["a/b.db"] == "" || found["a_b.db"] == "" {
+		t.Errorf("Found %v, want distinct names a/b.db and a_b.db", found)
+	}
+}
+
+func TestDiscoverDatabases_OnAccessError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	tempDir := t.TempDir()
+	for _, relPath := range []string{"app.log", "secret.log", filepath.Join("private", "server.log")} {
+		fullPath := filepath.Join(tempDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte("log line\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(tempDir, "secret.log"), 0); err != nil {
+		t.Fatal(err)
+	}
+	privateDir := filepath.Join(tempDir, "private")
+	if err := os.Chmod(privateDir, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(privateDir, 0755) // Let t.TempDir clean up
+
+	for _, policy := range []string{constants.OnAccessErrorSkip, constants.OnAccessErrorWarn} {
+		t.Run(policy, func(t *testing.T) {
+			cfg := &types.Config{OnAccessError: policy}
+			databases, skipped, err := DiscoverDatabasesWithSkipped(cfg, tempDir)
+			if err != nil {
+				t.Fatalf("DiscoverDatabasesWithSkipped failed: %v", err)
+			}
+			if len(databases) != 1 || databases[0].Name != "app.log" {
+				t.Errorf("Found %v, want only app.log", databases)
+			}
+
+			skippedPaths := make(map[string]bool)
+			for _, s := range skipped {
+				skippedPaths[s.Path] = true
+			}
+			if len(skipped) != 2 || !skippedPaths[filepath.Join(tempDir, "secret.log")] || !skippedPaths[privateDir] {
+				t.Errorf("Skipped %v, want secret.log and private", skipped)
+			}
+		})
+	}
+
+	t.Run(constants.OnAccessErrorFail, func(t *testing.T) {
+		cfg := &types.Config{OnAccessError: constants.OnAccessErrorFail}
+		if _, err := DiscoverDatabases(cfg, tempDir); err == nil {
+			t.Error("Expected discovery to fail on an unreadable path")
+		}
+	})
+}
+
+func TestDiscoverDatabases_SQLiteUnits(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"app.db":         "SQLite format 3\x00main",
+		"app.db-wal":     "wal",
+		"app.db-shm":     "shm",
+		"aux.sqlite":     "SQLite format 3\x00aux",
+		"other.db":       "SQLite format 3\x00other",
+		"other.db-extra": "not a companion",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cfg := &types.Config{
+		IncludePattern: "*.db-*", // Would otherwise pick up the companions as generic files
+		SQLiteAttachments: map[string][]string{
+			filepath.Join(tempDir, "app.db"): {filepath.Join(tempDir, "aux.sqlite")},
+		},
+	}
+	databases, err := DiscoverDatabases(cfg, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	found := make(map[string]types.DatabaseInfo)
+	for _, db := range databases {
+		found[db.Name] = db
+	}
+
+	if len(found) != 3 {
+		t.Errorf("Found %d items, want app.db, other.db and other.db-extra: %v", len(found), found)
+	}
+	for _, name := range []string{"app.db-wal", "app.db-shm", "aux.sqlite"} {
+		if _, ok := found[name]; ok {
+			t.Errorf("%s should be part of the app.db unit, not a separate item", name)
+		}
+	}
+
+	app := found["app.db"]
+	if len(app.Attachments) != 1 || app.Attachments[0] != filepath.Join(tempDir, "aux.sqlite") {
+		t.Errorf("app.db attachments = %v", app.Attachments)
+	}
+	wantSize := int64(len(files["app.db"]) + len(files["app.db-wal"]) + len(files["app.db-shm"]) + len(files["aux.sqlite"]))
+	if app.Size != wantSize {
+		t.Errorf("app.db size = %d, want %d", app.Size, wantSize)
+	}
+	if found["other.db-extra"].Type != types.DatabaseTypeGenericFile {
+		t.Errorf("other.db-extra detected as %v, want GenericFile", found["other.db-extra"].Type)
+	}
+}
+
+func TestIsLogFile(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []struct {
+		name       string
+		content    string
+		permissive bool
+		strict     bool
+	}{
+		{"events.ndjson", "{\"event\":\"login\",\"user\":1}\n{\"event\":\"logout\",\"user\":1}\n", true, true},
+		{"app.log", "2024-03-01T02:00:00Z INFO started\n2024-03-01T02:00:01Z ERROR failed\n\tat main.go:10\n", true, true},
+		{"syslog.1", "Mar  1 02:00:00 host sshd[42]: Accepted publickey\n", true, true},
+		{"requests", "10.0.0.1 - - [01/Mar/2024:02:00:00 +0000] \"GET / HTTP/1.1\" 200 512\n", true, true},
+		{"output.txt", "[WARN] 2024/03/01 02:00:00 disk almost full\n", true, true},
+		{"test.txt", "Log file content", false, false},
+		{"sample.txt", "2024-03-01 02:00:00 sample run started\n", true, true},
+		{"empty.log", "", true, false},
+		{"notes.txt", "Remember to renew the certificate.\nCall the vendor.\n", false, false},
+		{"config.json", "{\"a\":1}\n", false, false},
+		{"blob", "\x00\x01\x02 2024-03-01 02:00\n", false, false},
+	}
+	for _, f := range files {
+		path := filepath.Join(tempDir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", f.name, err)
+		}
+		if got := isLogFile(path, constants.LogDetectionPermissive); got != f.permissive {
+			t.Errorf("isLogFile(%s, permissive) = %v, want %v", f.name, got, f.permissive)
+		}
+		if got := isLogFile(path, constants.LogDetectionStrict); got != f.strict {
+			t.Errorf("isLogFile(%s, strict) = %v, want %v", f.name, got, f.strict)
+		}
+	}
+}
+
+func TestDiscoverDatabases_StrictLogDetection(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"app.log":       "2024-03-01 02:00:00 started\n",
+		"events.ndjson": "{\"event\":\"login\"}\n",
+		"test.txt":      "Log file content",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cfg := &types.Config{LogDetection: constants.LogDetectionStrict}
+	databases, err := DiscoverDatabases(cfg, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	found := make(map[string]types.DatabaseType)
+	for _, db := range databases {
+		found[db.Name] = db.Type
+	}
+	if len(found) != 2 || found["app.log"] != types.DatabaseTypeLogFile || found["events.ndjson"] != types.DatabaseTypeLogFile {
+		t.Errorf("Found %v, want app.log and events.ndjson as log files", found)
+	}
+}
+
+func TestDiscoverDatabases_Encrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	random := rand.New(rand.NewSource(1))
+	ciphertext := func(n int) []byte {
+		data := make([]byte, n)
+		random.Read(data)
+		return data
+	}
+	writeFile := func(relPath string, data []byte) {
+		fullPath := filepath.Join(tempDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, data, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", relPath, err)
+		}
+	}
+
+	// SQLCipher without and with a plaintext header
+	writeFile("cipher.db", ciphertext(4096))
+	writeFile("header.db", append([]byte("SQLite format 3\x00"), ciphertext(4096-16)...))
+	// RocksDB EncryptedEnv prefixes every file, CURRENT included
+	writeFile(filepath.Join("store", "CURRENT"), ciphertext(4096+32))
+	writeFile(filepath.Join("store", "MANIFEST-000005"), ciphertext(4096+128))
+	// Zeroed pages are not ciphertext
+	writeFile("empty.db", make([]byte, 4096))
+
+	databases, err := DiscoverDatabases(&types.Config{}, tempDir)
+	if err != nil {
+		t.Fatalf("DiscoverDatabases failed: %v", err)
+	}
+
+	want := map[string]types.DatabaseType{
+		"cipher.db": types.DatabaseTypeSQLite,
+		"header.db": types.DatabaseTypeSQLite,
+		"store":     types.DatabaseTypeRocksDB,
+	}
+	if len(databases) != len(want) {
+		t.Fatalf("Found %d items, want %d: %v", len(databases), len(want), databases)
+	}
+	for _, db := range databases {
+		if db.Type != want[db.Name] || !db.Encrypted {
+			t.Errorf("%s detected as %v (encrypted %v), want encrypted %v", db.Name, db.Type, db.Encrypted, want[db.Name])
+		}
+	}
+
+	if IsEncrypted(types.DatabaseTypeSQLite, filepath.Join(tempDir, "missing.db")) {
+		t.Error("A missing file should not be reported as encrypted")
+	}
+}
@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archiveFiles/internal/types"
+)
+
+// Encryption at rest detection constants
+const (
+	sqliteMagic            = "SQLite format 3\x00"
+	sqliteHeaderSize       = 100  // Database header at the start of page 1
+	sqliteMinPageSize      = 512  // Smallest SQLite page size; files are whole pages
+	encryptedSampleSize    = 512  // Bytes sampled to tell ciphertext from plain data
+	encryptedMinByteValues = 160  // Distinct byte values ciphertext shows in the sample
+	rocksDBEncryptedPrefix = 4096 // Plaintext prefix EncryptedEnv writes at the start of every file
+)
+
+// IsEncrypted reports whether a detected database is encrypted at rest, so
+// that it can only be copied file by file and checked by checksum: a
+// SQLCipher database or a RocksDB store written through an encrypted env
+func IsEncrypted(dbType types.DatabaseType, path string) bool {
+	switch dbType {
+	case types.DatabaseTypeSQLite:
+		return isEncryptedSQLiteFile(path)
+	case types.DatabaseTypeRocksDB:
+		return isEncryptedRocksDB(path)
+	default:
+		return false
+	}
+}
+
+// isEncryptedSQLiteFile checks whether a file with a SQLite extension is a
+// SQLCipher database. Without a plaintext header the whole file looks
+// random; with one the header is intact but page 1 does not start with a
+// b-tree page.
+func isEncryptedSQLiteFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext != ".db" && ext != ".sqlite" && ext != ".sqlite3" && ext != ".db3" {
+		return false
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() < sqliteMinPageSize || info.Size()%sqliteMinPageSize != 0 {
+		return false
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	sample := make([]byte, encryptedSampleSize)
+	if _, err := io.ReadFull(file, sample); err != nil {
+		return false
+	}
+
+	if string(sample[:len(sqliteMagic)]) == sqliteMagic {
+		// 0x05 and 0x0d are the interior and leaf table b-tree pages the
+		// schema table starts with
+		pageType := sample[sqliteHeaderSize]
+		return pageType != 0x05 && pageType != 0x0d && looksEncrypted(sample[sqliteHeaderSize:])
+	}
+	return looksEncrypted(sample)
+}
+
+// isEncryptedRocksDB checks whether a directory is a RocksDB store written
+// through an encrypted env: it has CURRENT and a MANIFEST, but CURRENT is
+// an encryption prefix followed by ciphertext instead of a MANIFEST name
+func isEncryptedRocksDB(dirPath string) bool {
+	manifests, err := filepath.Glob(filepath.Join(dirPath, rocksDBManifestPrefix+"*"))
+	if err != nil || len(manifests) == 0 {
+		return false
+	}
+
+	file, err := os.Open(filepath.Join(dirPath, rocksDBCurrentFile))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, rocksDBEncryptedPrefix)
+	if _, err := io.ReadFull(file, head); err != nil {
+		return false
+	}
+	return !strings.HasPrefix(string(head), rocksDBManifestPrefix)
+}
+
+// looksEncrypted reports whether data has the byte distribution of
+// ciphertext, which plain text and structured data do not reach
+func looksEncrypted(data []byte) bool {
+	var seen [256]bool
+	values := 0
+	for _, b := range data {
+		if !seen[b] {
+			seen[b] = true
+			values++
+		}
+	}
+	return values >= encryptedMinByteValues*len(data)/encryptedSampleSize
+}
@@ -0,0 +1,141 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"archiveFiles/internal/constants"
+)
+
+// isLogFile checks if file is a log file. Permissive detection accepts
+// log-like names and sniffs the content of other text files; strict
+// detection requires the content to look like a log whatever the name.
+func isLogFile(filePath, detection string) bool {
+	byName := hasLogFileName(filePath)
+	if detection == constants.LogDetectionStrict {
+		return (byName || isSniffCandidate(filePath)) && looksLikeLog(filePath)
+	}
+	return byName || (isSniffCandidate(filePath) && looksLikeLog(filePath))
+}
+
+// isSniffCandidate reports whether a file whose name does not mark it as a
+// log may still be one: JSON lines files, text files, files without an
+// extension and rotated files such as syslog.1
+func isSniffCandidate(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch ext {
+	case "", ".txt", ".out", ".ndjson", ".jsonl":
+		return true
+	}
+	return strings.Trim(ext[1:], "0123456789") == ""
+}
+
+// logTimestamp matches a line starting with a timestamp, optionally after a
+// level: ISO 8601 and RFC 3339, the Go log package, syslog and the
+// Common Log Format used by web server access logs
+var logTimestamp = regexp.MustCompile(`^(?:\[?(?:TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\]?:?\s+)?\[?(?:` +
+	`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}` +
+	`|\d{4}/\d{2}/\d{2} \d{2}:\d{2}` +
+	`|[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}` +
+	`|\S+ \S+ \S+ \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2})`)
+
+// looksLikeLog judges the first lines of a file: it is a log when every line
+// is a JSON object (JSON lines) or at least half of them start with a
+// timestamp, leaving room for stack traces and other continuation lines
+func looksLikeLog(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, constants.LogSniffSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	data := buf[:n]
+	if err == nil {
+		// The file goes on; judge complete lines only
+		end := bytes.LastIndexByte(data, '\n')
+		if end < 0 {
+			return false
+		}
+		data = data[:end]
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return false
+	}
+
+	var lines, jsonLines, stamped int
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+		if strings.HasPrefix(line, "{") && json.Valid([]byte(line)) {
+			jsonLines++
+		}
+		if logTimestamp.MatchString(line) {
+			stamped++
+		}
+		if lines == constants.LogSniffLines {
+			break
+		}
+	}
+	return lines > 0 && (jsonLines == lines || stamped*2 >= lines)
+}
+
+// hasLogFileName checks if the file name is that of a log file
+func hasLogFileName(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	filename := strings.ToLower(filepath.Base(filePath))
+
+	// Check by extension (.log files are always logs)
+	if ext == ".log" || ext == ".logx" {
+		return true
+	}
+
+	// For .txt files, be more inclusive but still use some pattern matching
+	if ext == ".txt" {
+		// Common log patterns
+		logPatterns := []string{
+			"access", "error", "debug", "info", "warn", "trace",
+			"audit", "security", "application", "system", "server",
+			"database", "sql", "query", "transaction", "backup",
+			"log", "messages", "syslog", "output", "trace",
+		}
+
+		// Check if filename contains any log patterns
+		for _, pattern := range logPatterns {
+			if strings.Contains(filename, pattern) {
+				return true
+			}
+		}
+	}
+
+	// Check by filename patterns (for files without extensions or other extensions)
+	logPatterns := []string{
+		"access", "error", "debug", "info", "warn", "trace",
+		"audit", "security", "application", "system", "server",
+		"database", "sql", "query", "transaction", "backup",
+	}
+
+	// Only consider files with log-like names and no extension or specific extensions
+	if ext == "" || ext == ".out" {
+		for _, pattern := range logPatterns {
+			if strings.Contains(filename, pattern) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+// containerPollInterval is how often a running container is checked for
+// exit. Shortened in tests.
+var containerPollInterval = time.Second
+
+// ContainerSpec describes a disposable container
+type ContainerSpec struct {
+	Image string   // Image to run; it must already be present on the host
+	Cmd   []string // Command and arguments
+	Binds []string // Bind mounts in host:container[:ro] form
+}
+
+// ContainerResult is the outcome of a container run
+type ContainerResult struct {
+	ExitCode  int
+	Output    []byte // Combined stdout and stderr, trimmed to the last constants.ContainerOutputLimit bytes
+	Truncated bool   // Whether earlier output was dropped
+}
+
+// RunContainer creates a container, starts it, waits for it to exit and
+// returns its output. The container is removed afterwards, also when the
+// run fails or ctx is cancelled.
+func (c *Client) RunContainer(ctx context.Context, spec ContainerSpec) (ContainerResult, error) {
+	var result ContainerResult
+
+	// A TTY makes the logs endpoint return plain text instead of the
+	// multiplexed stdout/stderr stream
+	create := map[string]interface{}{
+		"Image":           spec.Image,
+		"Cmd":             spec.Cmd,
+		"Tty":             true,
+		"NetworkDisabled": true,
+		"HostConfig":      map[string]interface{}{"Binds": spec.Binds},
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/containers/create", create, &created); err != nil {
+		return result, fmt.Errorf("failed to create container from %s: %v", spec.Image, err)
+	}
+	containerPath := "/containers/" + url.PathEscape(created.ID)
+	defer c.do(context.Background(), http.MethodDelete, containerPath+"?force=1", nil)
+
+	if err := c.do(ctx, http.MethodPost, containerPath+"/start", nil); err != nil {
+		return result, fmt.Errorf("failed to start container: %v", err)
+	}
+
+	// Poll instead of using /wait, which would outlast the client timeout
+	for {
+		var inspect struct {
+			State struct {
+				Running  bool `json:"Running"`
+				ExitCode int  `json:"ExitCode"`
+			} `json:"State"`
+		}
+		if err := c.do(ctx, http.MethodGet, containerPath+"/json", &inspect); err != nil {
+			return result, fmt.Errorf("failed to inspect container: %v", err)
+		}
+		if !inspect.State.Running {
+			result.ExitCode = inspect.State.ExitCode
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(containerPollInterval):
+		}
+	}
+
+	resp, err := c.request(ctx, http.MethodGet, containerPath+"/logs?stdout=1&stderr=1", nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to read container output: %v", err)
+	}
+	defer resp.Body.Close()
+	result.Output, result.Truncated, err = readTail(io.LimitReader(resp.Body, constants.ContainerOutputMaxRead), constants.ContainerOutputLimit)
+	if err != nil {
+		return result, fmt.Errorf("failed to read container output: %v", err)
+	}
+	return result, nil
+}
+
+// readTail reads r to the end and returns its last limit bytes, holding at
+// most twice that in memory, and whether earlier bytes were dropped
+func readTail(r io.Reader, limit int) ([]byte, bool, error) {
+	tail := make([]byte, 0, 2*limit)
+	chunk := make([]byte, 32*1024)
+	truncated := false
+	for {
+		n, err := r.Read(chunk)
+		tail = append(tail, chunk[:n]...)
+		if len(tail) > 2*limit {
+			tail = append(tail[:0], tail[len(tail)-limit:]...)
+			truncated = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if len(tail) > limit {
+		tail = tail[len(tail)-limit:]
+		truncated = true
+	}
+	return tail, truncated, nil
+}
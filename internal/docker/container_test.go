@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeContainerRuntime serves the container endpoints RunContainer uses. The
+// container reports as running for the first inspect and then exits with
+// exitCode, having printed output.
+func fakeContainerRuntime(t *testing.T, exitCode int, output string) (*Client, *[]string, *map[string]interface{}) {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+
+	var mu sync.Mutex
+	calls := []string{}
+	created := map[string]interface{}{}
+	inspections := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.URL.Path == "/containers/create":
+			json.NewDecoder(r.Body).Decode(&created)
+			json.NewEncoder(w).Encode(map[string]string{"Id": "abc123"})
+		case r.URL.Path == "/containers/abc123/json":
+			inspections++
+			state := map[string]interface{}{"Running": inspections == 1, "ExitCode": exitCode}
+			json.NewEncoder(w).Encode(map[string]interface{}{"State": state})
+		case r.URL.Path == "/containers/abc123/logs":
+			w.Write([]byte(output))
+		case strings.HasPrefix(r.URL.Path, "/containers/abc123"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "no such endpoint"})
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return NewClientWithSocket(socketPath), &calls, &created
+}
+
+func TestRunContainer(t *testing.T) {
+	defer func(interval time.Duration) { containerPollInterval = interval }(containerPollInterval)
+	containerPollInterval = time.Millisecond
+
+	client, calls, created := fakeContainerRuntime(t, 3, "checked 12 tables\ncorruption in table 7\n")
+	result, err := client.RunContainer(context.Background(), ContainerSpec{
+		Image: "myapp:1.4",
+		Cmd:   []string{"sh", "-c", "myapp check /archive"},
+		Binds: []string{"/tmp/extract:/archive"},
+	})
+	if err != nil {
+		t.Fatalf("RunContainer failed: %v", err)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3", result.ExitCode)
+	}
+	if string(result.Output) != "checked 12 tables\ncorruption in table 7\n" || result.Truncated {
+		t.Errorf("Output = %q (truncated %t)", result.Output, result.Truncated)
+	}
+
+	if (*created)["Image"] != "myapp:1.4" || (*created)["NetworkDisabled"] != true {
+		t.Errorf("Unexpected create request: %v", *created)
+	}
+	hostConfig, _ := (*created)["HostConfig"].(map[string]interface{})
+	if binds, _ := hostConfig["Binds"].([]interface{}); len(binds) != 1 || binds[0] != "/tmp/extract:/archive" {
+		t.Errorf("Unexpected binds: %v", hostConfig)
+	}
+
+	// The container is removed after its output was read
+	last := (*calls)[len(*calls)-1]
+	if last != "DELETE /containers/abc123" {
+		t.Errorf("Last call = %q, want the container removed; calls: %v", last, *calls)
+	}
+}
+
+func TestRunContainer_MissingImage(t *testing.T) {
+	client, calls := fakeDocker(t)
+	if _, err := client.RunContainer(context.Background(), ContainerSpec{Image: "missing"}); err == nil {
+		t.Error("Expected an error when the container cannot be created")
+	}
+	for _, call := range *calls {
+		if strings.Contains(call, "/start") {
+			t.Errorf("Container must not be started after a failed create: %v", *calls)
+		}
+	}
+}
+
+func TestReadTail(t *testing.T) {
+	output := strings.Repeat("a", 100) + strings.Repeat("b", 10)
+	tail, truncated, err := readTail(strings.NewReader(output), 10)
+	if err != nil || string(tail) != strings.Repeat("b", 10) || !truncated {
+		t.Errorf("readTail = %q (truncated %t, err %v), want the last 10 bytes", tail, truncated, err)
+	}
+	tail, truncated, err = readTail(strings.NewReader("short"), 10)
+	if err != nil || string(tail) != "short" || truncated {
+		t.Errorf("readTail = %q (truncated %t, err %v), want all of the output", tail, truncated, err)
+	}
+}
@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+// VolumeSource is a parsed docker-volume://name[?pause=container] source
+type VolumeSource struct {
+	Volume         string // Docker volume name
+	PauseContainer string // Container paused while the volume is backed up (optional)
+}
+
+// String returns the source without options, e.g. docker-volume://pgdata
+func (s VolumeSource) String() string {
+	return constants.DockerVolumeScheme + s.Volume
+}
+
+// IsVolumeSource reports whether a source path uses the docker-volume scheme
+func IsVolumeSource(source string) bool {
+	return strings.HasPrefix(source, constants.DockerVolumeScheme)
+}
+
+// ParseVolumeSource parses a docker-volume://name[?pause=container] source
+func ParseVolumeSource(source string) (VolumeSource, error) {
+	if !IsVolumeSource(source) {
+		return VolumeSource{}, fmt.Errorf("not a docker volume source: %s", source)
+	}
+
+	rest := strings.TrimPrefix(source, constants.DockerVolumeScheme)
+	name, rawQuery, _ := strings.Cut(rest, "?")
+	if name == "" || strings.Contains(name, "/") {
+		return VolumeSource{}, fmt.Errorf("invalid docker volume name in %s", source)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return VolumeSource{}, fmt.Errorf("invalid options in %s: %v", source, err)
+	}
+	for key := range query {
+		if key != "pause" {
+			return VolumeSource{}, fmt.Errorf("unknown option %q in %s", key, source)
+		}
+	}
+
+	return VolumeSource{Volume: name, PauseContainer: query.Get("pause")}, nil
+}
+
+// Client talks to the Docker Engine API over its unix socket
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the socket named by DOCKER_HOST
+// (unix:// only) or the default /var/run/docker.sock
+func NewClient() (*Client, error) {
+	socketPath := constants.DockerSocketPath
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			return nil, fmt.Errorf("unsupported DOCKER_HOST %s: only unix sockets are supported", host)
+		}
+		socketPath = strings.TrimPrefix(host, "unix://")
+	}
+	return NewClientWithSocket(socketPath), nil
+}
+
+// NewClientWithSocket creates a client for a specific unix socket
+func NewClientWithSocket(socketPath string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second}}
+}
+
+// do sends a request to the Docker API and decodes a JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, out interface{}) error {
+	return c.doJSON(ctx, method, path, nil, out)
+}
+
+// doJSON is do with a JSON request body (nil = no body)
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := c.request(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode docker API response: %v", err)
+		}
+	}
+	return nil
+}
+
+// request sends a request to the Docker API and returns the response if it
+// succeeded. The caller closes the body.
+func (c *Client) request(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	// The host is ignored by the unix socket dialer
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API request failed: %v", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("docker API %s %s: %s", method, path, apiErr.Message)
+		}
+		return nil, fmt.Errorf("docker API %s %s: status %d", method, path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// VolumeMountpoint returns the host directory backing a named volume
+func (c *Client) VolumeMountpoint(ctx context.Context, name string) (string, error) {
+	var volume struct {
+		Mountpoint string `json:"Mountpoint"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/volumes/"+url.PathEscape(name), &volume); err != nil {
+		return "", err
+	}
+	if volume.Mountpoint == "" {
+		return "", fmt.Errorf("docker volume %s has no mountpoint", name)
+	}
+	return volume.Mountpoint, nil
+}
+
+// PauseContainer freezes all processes of a container
+func (c *Client) PauseContainer(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/pause", nil)
+}
+
+// UnpauseContainer resumes a paused container
+func (c *Client) UnpauseContainer(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/unpause", nil)
+}
@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakeDocker serves a minimal Docker Engine API on a unix socket
+func fakeDocker(t *testing.T) (*Client, *[]string) {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+
+	var mu sync.Mutex
+	calls := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/volumes/pgdata", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"Name":       "pgdata",
+			"Mountpoint": "/var/lib/docker/volumes/pgdata/_data",
+		})
+	})
+	mux.HandleFunc("/volumes/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "get missing: no such volume"})
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return NewClientWithSocket(socketPath), &calls
+}
+
+func TestParseVolumeSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		want    VolumeSource
+		wantErr bool
+	}{
+		{"docker-volume://pgdata", VolumeSource{Volume: "pgdata"}, false},
+		{"docker-volume://pgdata?pause=postgres", VolumeSource{Volume: "pgdata", PauseContainer: "postgres"}, false},
+		{"docker-volume://", VolumeSource{}, true},
+		{"docker-volume://a/b", VolumeSource{}, true},
+		{"docker-volume://pgdata?stop=postgres", VolumeSource{}, true},
+		{"/var/lib/data", VolumeSource{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := ParseVolumeSource(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVolumeSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseVolumeSource() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if s := (VolumeSource{Volume: "pgdata", PauseContainer: "postgres"}).String(); s != "docker-volume://pgdata" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestVolumeMountpoint(t *testing.T) {
+	client, _ := fakeDocker(t)
+
+	mountpoint, err := client.VolumeMountpoint(context.Background(), "pgdata")
+	if err != nil {
+		t.Fatalf("VolumeMountpoint failed: %v", err)
+	}
+	if mountpoint != "/var/lib/docker/volumes/pgdata/_data" {
+		t.Errorf("mountpoint = %q", mountpoint)
+	}
+
+	if _, err := client.VolumeMountpoint(context.Background(), "missing"); err == nil {
+		t.Error("expected error for missing volume")
+	}
+}
+
+func TestPauseUnpauseContainer(t *testing.T) {
+	client, calls := fakeDocker(t)
+
+	if err := client.PauseContainer(context.Background(), "postgres"); err != nil {
+		t.Fatalf("PauseContainer failed: %v", err)
+	}
+	if err := client.UnpauseContainer(context.Background(), "postgres"); err != nil {
+		t.Fatalf("UnpauseContainer failed: %v", err)
+	}
+
+	want := []string{"POST /containers/postgres/pause", "POST /containers/postgres/unpause"}
+	if len(*calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", *calls, want)
+	}
+	for i := range want {
+		if (*calls)[i] != want[i] {
+			t.Errorf("call %d = %q, want %q", i, (*calls)[i], want[i])
+		}
+	}
+}
+
+func TestNewClientRejectsTCPHost(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	if _, err := NewClient(); err == nil {
+		t.Error("expected error for tcp DOCKER_HOST")
+	}
+}
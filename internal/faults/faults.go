@@ -0,0 +1,190 @@
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInjected is returned by operations failed on purpose
+var ErrInjected = errors.New("injected fault")
+
+// Spec describes which faults to inject. It is parsed from a comma-separated
+// list such as "fail=5%,corrupt=0.1%,delay=200ms,seed=42".
+type Spec struct {
+	FailRate    float64       // Fraction of operations that fail
+	CorruptRate float64       // Fraction of bytes flipped in each staged backup
+	MaxDelay    time.Duration // Upper bound of the random delay before each operation
+	Seed        int64         // Seed of the random source (0 = time-based)
+}
+
+// ParseSpec parses a fault injection spec
+func ParseSpec(s string) (Spec, error) {
+	var spec Spec
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Spec{}, fmt.Errorf("invalid fault spec %q, expected key=value", part)
+		}
+
+		var err error
+		switch key {
+		case "fail":
+			spec.FailRate, err = parseRate(value)
+		case "corrupt":
+			spec.CorruptRate, err = parseRate(value)
+		case "delay":
+			spec.MaxDelay, err = time.ParseDuration(value)
+			if err == nil && spec.MaxDelay < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "seed":
+			spec.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return Spec{}, fmt.Errorf("unknown fault %q (supported: fail, corrupt, delay, seed)", key)
+		}
+		if err != nil {
+			return Spec{}, fmt.Errorf("invalid value for fault %s: %v", key, err)
+		}
+	}
+	return spec, nil
+}
+
+// parseRate converts a percentage such as "5%" or "0.1" (percent) to a
+// fraction between 0 and 1
+func parseRate(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("%s is not between 0%% and 100%%", value)
+	}
+	return percent / 100, nil
+}
+
+// injector holds the enabled spec and its random source
+type injector struct {
+	spec Spec
+	mu   sync.Mutex
+	rng  *rand.Rand
+}
+
+var active atomic.Pointer[injector]
+
+// Enable turns on fault injection for the whole process
+func Enable(spec Spec) {
+	seed := spec.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	active.Store(&injector{spec: spec, rng: rand.New(rand.NewSource(seed))})
+}
+
+// Disable turns fault injection off
+func Disable() {
+	active.Store(nil)
+}
+
+// Enabled reports whether fault injection is on
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// float64 draws from the shared random source
+func (i *injector) float64() float64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rng.Float64()
+}
+
+// int63n draws from the shared random source
+func (i *injector) int63n(n int64) int64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rng.Int63n(n)
+}
+
+// Inject is called before an operation. When fault injection is enabled it
+// sleeps for a random delay and fails the operation at the configured rate.
+func Inject(operation string) error {
+	i := active.Load()
+	if i == nil {
+		return nil
+	}
+	if i.spec.MaxDelay > 0 {
+		time.Sleep(time.Duration(i.int63n(int64(i.spec.MaxDelay) + 1)))
+	}
+	if i.spec.FailRate > 0 && i.float64() < i.spec.FailRate {
+		return fmt.Errorf("%s: %w", operation, ErrInjected)
+	}
+	return nil
+}
+
+// CorruptTree flips the configured fraction of bytes in every regular file
+// under dir and returns how many bytes were changed
+func CorruptTree(dir string) (int, error) {
+	i := active.Load()
+	if i == nil || i.spec.CorruptRate == 0 {
+		return 0, nil
+	}
+
+	corrupted := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			return nil
+		}
+
+		// Round the expected count up or down at random so small files
+		// are still hit now and then
+		expected := float64(info.Size()) * i.spec.CorruptRate
+		count := int(expected)
+		if i.float64() < expected-float64(count) {
+			count++
+		}
+		if count == 0 {
+			return nil
+		}
+
+		n, err := corruptFile(i, path, info.Size(), count)
+		corrupted += n
+		return err
+	})
+	return corrupted, err
+}
+
+// corruptFile inverts count bytes at random offsets of a file
+func corruptFile(i *injector, path string, size int64, count int) (int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	b := make([]byte, 1)
+	for n := 0; n < count; n++ {
+		offset := i.int63n(size)
+		if _, err := file.ReadAt(b, offset); err != nil {
+			return n, err
+		}
+		b[0] ^= 0xFF
+		if _, err := file.WriteAt(b, offset); err != nil {
+			return n, err
+		}
+	}
+	return count, nil
+}
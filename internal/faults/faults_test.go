@@ -0,0 +1,122 @@
+package faults
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Spec
+		wantErr bool
+	}{
+		{"", Spec{}, false},
+		{"fail=5%", Spec{FailRate: 0.05}, false},
+		{"fail=5%,corrupt=0.1%,delay=200ms,seed=42", Spec{FailRate: 0.05, CorruptRate: 0.001, MaxDelay: 200 * time.Millisecond, Seed: 42}, false},
+		{" corrupt=50 , seed=-1 ", Spec{CorruptRate: 0.5, Seed: -1}, false},
+		{"fail=150%", Spec{}, true},
+		{"fail=-1%", Spec{}, true},
+		{"delay=-1s", Spec{}, true},
+		{"delay=soon", Spec{}, true},
+		{"explode=1%", Spec{}, true},
+		{"fail", Spec{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSpec(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	t.Cleanup(Disable)
+
+	t.Run("Disabled", func(t *testing.T) {
+		Disable()
+		if Enabled() {
+			t.Error("Expected fault injection to be disabled")
+		}
+		if err := Inject("copy"); err != nil {
+			t.Errorf("Inject() with injection disabled = %v", err)
+		}
+	})
+
+	t.Run("Always fail", func(t *testing.T) {
+		Enable(Spec{FailRate: 1, Seed: 1})
+		err := Inject("copy /data/app.db")
+		if !errors.Is(err, ErrInjected) {
+			t.Errorf("Inject() = %v, want ErrInjected", err)
+		}
+	})
+
+	t.Run("Never fail", func(t *testing.T) {
+		Enable(Spec{Seed: 1})
+		for i := 0; i < 100; i++ {
+			if err := Inject("copy"); err != nil {
+				t.Fatalf("Inject() = %v, want nil", err)
+			}
+		}
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		Enable(Spec{MaxDelay: 20 * time.Millisecond, Seed: 1})
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			Inject("copy")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Delays exceeded their bound: %v", elapsed)
+		}
+	})
+}
+
+func TestCorruptTree(t *testing.T) {
+	t.Cleanup(Disable)
+
+	dir := t.TempDir()
+	original := bytes.Repeat([]byte("archive"), 200)
+	path := filepath.Join(dir, "sub", "data.bin")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	Disable()
+	if n, err := CorruptTree(dir); err != nil || n != 0 {
+		t.Fatalf("CorruptTree() with injection disabled = %d, %v", n, err)
+	}
+
+	Enable(Spec{CorruptRate: 0.01, Seed: 7})
+	n, err := CorruptTree(dir)
+	if err != nil {
+		t.Fatalf("CorruptTree failed: %v", err)
+	}
+	if n != len(original)/100 {
+		t.Errorf("CorruptTree() corrupted %d bytes, want %d", n, len(original)/100)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if len(data) != len(original) {
+		t.Errorf("Corruption changed the file size: %d -> %d", len(original), len(data))
+	}
+	if bytes.Equal(data, original) {
+		t.Error("Expected file content to change")
+	}
+}
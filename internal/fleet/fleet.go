@@ -0,0 +1,91 @@
+// Package fleet describes a fleet of hosts backed up by one coordinator,
+// which runs an agent on each host over SSH and collects their archives
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archiveFiles/internal/constants"
+)
+
+// Host is one host of the fleet and the sources backed up on it
+type Host struct {
+	Host    string   `json:"host"`    // SSH destination, e.g. backup@db1
+	Sources []string `json:"sources"` // Absolute source paths on the host
+	Method  string   `json:"method"`  // Backup method of the host's agent (default: checkpoint)
+}
+
+// Config is a fleet config: the hosts and how to reach their agents
+type Config struct {
+	Hosts       []Host `json:"hosts"`
+	SSH         string `json:"ssh"`          // SSH command, including options (default: ssh)
+	Agent       string `json:"agent"`        // archiveFiles binary on the hosts (default: archiveFiles)
+	ArchiveDir  string `json:"archive_dir"`  // Directory the archives of the hosts are written to (default: current directory)
+	CatalogPath string `json:"catalog_path"` // Catalog the fleet run is recorded in as one run (empty = not recorded)
+	Parallel    int    `json:"parallel"`     // Hosts backed up at once (0 = constants.FleetParallel)
+}
+
+// Load reads and validates a fleet config
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fleet config %s: %v", path, err)
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse fleet config %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fleet config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the config. Host names must be unique: each host's
+// archive is named after it.
+func (c *Config) Validate() error {
+	if len(c.Hosts) == 0 {
+		return fmt.Errorf("no hosts")
+	}
+	seen := make(map[string]bool)
+	for i, host := range c.Hosts {
+		name := host.Host[strings.LastIndex(host.Host, "@")+1:]
+		if name == "" || strings.ContainsAny(host.Host, ":/ ") {
+			return fmt.Errorf("host %d: invalid SSH destination %q", i+1, host.Host)
+		}
+		if seen[name] {
+			return fmt.Errorf("host %s is listed twice", name)
+		}
+		seen[name] = true
+		if len(host.Sources) == 0 {
+			return fmt.Errorf("host %s has no sources", host.Host)
+		}
+		for _, source := range host.Sources {
+			if !filepath.IsAbs(source) || strings.Contains(source, ",") {
+				return fmt.Errorf("host %s: source %q must be an absolute path without commas", host.Host, source)
+			}
+		}
+	}
+	if c.Parallel < 0 {
+		return fmt.Errorf("invalid parallel: %d (must be 0 or greater)", c.Parallel)
+	}
+	return nil
+}
+
+// Workers returns the number of hosts backed up at once
+func (c *Config) Workers() int {
+	if c.Parallel == 0 {
+		return constants.FleetParallel
+	}
+	return c.Parallel
+}
+
+// ArchiveName returns the file name of the archive of host in a fleet run,
+// e.g. db1_<runID>.tar.gz for backup@db1
+func ArchiveName(host, runID string) string {
+	return fmt.Sprintf("%s_%s.tar.gz", host[strings.LastIndex(host, "@")+1:], runID)
+}
@@ -0,0 +1,60 @@
+package fleet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fleet.json")
+	content := `{"hosts": [{"host": "backup@db1", "sources": ["/data/db"], "method": "copy"}], "parallel": 2}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Hosts) != 1 || cfg.Hosts[0].Method != "copy" || cfg.Workers() != 2 {
+		t.Errorf("Load = %+v", cfg)
+	}
+	if (&Config{}).Workers() != constants.FleetParallel {
+		t.Errorf("Workers without parallel = %d, want %d", (&Config{}).Workers(), constants.FleetParallel)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"hosts": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "no hosts") {
+		t.Errorf("Load error = %v, want an empty fleet rejected", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, hosts := range [][]Host{
+		{{Host: "", Sources: []string{"/data"}}},
+		{{Host: "backup@", Sources: []string{"/data"}}},
+		{{Host: "db1:/data", Sources: []string{"/data"}}},
+		{{Host: "db1"}},
+		{{Host: "db1", Sources: []string{"data"}}},
+		{{Host: "db1", Sources: []string{"/data,/srv"}}},
+		{{Host: "backup@db1", Sources: []string{"/data"}}, {Host: "root@db1", Sources: []string{"/srv"}}},
+	} {
+		if err := (&Config{Hosts: hosts}).Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", hosts)
+		}
+	}
+	if err := (&Config{Hosts: []Host{{Host: "db1", Sources: []string{"/data"}}}, Parallel: -1}).Validate(); err == nil {
+		t.Error("Expected an error for a negative parallel")
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	if got := ArchiveName("backup@db1.example.com", "20250101T020000-ab12"); got != "db1.example.com_20250101T020000-ab12.tar.gz" {
+		t.Errorf("ArchiveName = %s", got)
+	}
+}
@@ -0,0 +1,150 @@
+package hostinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var log = logger.NewModule("hostinfo")
+
+// FileName is the name of the host metadata file at the root of a backup
+const FileName = "HOSTINFO.json"
+
+// relevantEnv lists the environment variables that influence how databases
+// are read and written. Others are left out so no secrets end up in archives.
+var relevantEnv = []string{"TZ", "LANG", "LC_ALL", "TMPDIR", "SQLITE_TMPDIR"}
+
+// trackedModules are the Go modules whose versions are recorded
+var trackedModules = []string{"github.com/linxGnu/grocksdb", "github.com/mattn/go-sqlite3"}
+
+// Mount describes a filesystem holding backed up sources
+type Mount struct {
+	MountPoint   string   `json:"mount_point"`
+	Device       string   `json:"device,omitempty"`
+	FSType       string   `json:"fs_type,omitempty"`
+	Options      string   `json:"options,omitempty"`       // Per-mount options, e.g. rw,noatime
+	SuperOptions string   `json:"super_options,omitempty"` // Filesystem-wide options (Linux)
+	Sources      []string `json:"sources"`                 // Configured sources on this mount
+}
+
+// HostInfo is a snapshot of the machine a backup was taken on, stored next
+// to the manifest to help debug restores on different machines
+type HostInfo struct {
+	CapturedAt    time.Time         `json:"captured_at"`
+	Hostname      string            `json:"hostname"`
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	Kernel        string            `json:"kernel,omitempty"`
+	GoVersion     string            `json:"go_version"`
+	SQLiteVersion string            `json:"sqlite_version"`
+	Modules       map[string]string `json:"modules,omitempty"` // Database binding modules and their versions
+	Mounts        []Mount           `json:"mounts,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// Capture collects the host metadata, including the mount of every source.
+// sources maps each source to a path inside it. Details that cannot be
+// determined are logged and left empty.
+func Capture(sources map[string]string) *HostInfo {
+	info := &HostInfo{
+		CapturedAt: time.Now().UTC(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		GoVersion:  runtime.Version(),
+	}
+	info.SQLiteVersion, _, _ = sqlite3.Version()
+
+	var err error
+	if info.Hostname, err = os.Hostname(); err != nil {
+		log.Warning("Failed to read hostname: %v", err)
+	}
+	if info.Kernel, err = kernelRelease(); err != nil {
+		log.Warning("Failed to read kernel release: %v", err)
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range build.Deps {
+			for _, module := range trackedModules {
+				if dep.Path == module {
+					if info.Modules == nil {
+						info.Modules = make(map[string]string)
+					}
+					info.Modules[module] = dep.Version
+				}
+			}
+		}
+	}
+
+	for _, name := range relevantEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			if info.Env == nil {
+				info.Env = make(map[string]string)
+			}
+			info.Env[name] = value
+		}
+	}
+
+	info.Mounts = groupMounts(sources)
+	return info
+}
+
+// groupMounts looks up the mount of every source and groups the sources by mount
+func groupMounts(sources map[string]string) []Mount {
+	byPoint := make(map[string]*Mount)
+	for source, path := range sources {
+		mount, err := mountOf(path)
+		if err != nil {
+			log.Warning("Failed to look up the mount of %s: %v", path, err)
+			continue
+		}
+		if existing, ok := byPoint[mount.MountPoint]; ok {
+			existing.Sources = append(existing.Sources, source)
+			continue
+		}
+		mount.Sources = []string{source}
+		byPoint[mount.MountPoint] = &mount
+	}
+
+	mounts := make([]Mount, 0, len(byPoint))
+	for _, mount := range byPoint {
+		sort.Strings(mount.Sources)
+		mounts = append(mounts, *mount)
+	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].MountPoint < mounts[j].MountPoint })
+	return mounts
+}
+
+// Write stores the host metadata as indented JSON
+func (h *HostInfo) Write(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal host info: %v", err)
+	}
+	if err := os.WriteFile(path, data, constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write host info %s: %v", path, err)
+	}
+	return nil
+}
+
+// Load reads host metadata written by Write
+func Load(path string) (*HostInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host info %s: %v", path, err)
+	}
+	info := &HostInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("failed to parse host info %s: %v", path, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,59 @@
+package hostinfo
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Mount flags from <sys/mount.h>, which the syscall package does not export
+var mountFlagNames = []struct {
+	flag uint32
+	name string
+}{
+	{0x1, "rdonly"},
+	{0x2, "synchronous"},
+	{0x4, "noexec"},
+	{0x8, "nosuid"},
+	{0x10, "nodev"},
+	{0x00800000, "journaled"},
+	{0x10000000, "noatime"},
+}
+
+// kernelRelease returns the running kernel release, as uname -r prints it
+func kernelRelease() (string, error) {
+	return syscall.Sysctl("kern.osrelease")
+}
+
+// mountOf returns the mount holding path, from statfs
+func mountOf(path string) (Mount, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Mount{}, fmt.Errorf("failed to stat filesystem of %s: %v", path, err)
+	}
+
+	var options []string
+	for _, option := range mountFlagNames {
+		if stat.Flags&option.flag != 0 {
+			options = append(options, option.name)
+		}
+	}
+	return Mount{
+		MountPoint: cString(stat.Mntonname[:]),
+		Device:     cString(stat.Mntfromname[:]),
+		FSType:     cString(stat.Fstypename[:]),
+		Options:    strings.Join(options, ","),
+	}, nil
+}
+
+// cString converts a NUL-terminated statfs name
+func cString(chars []int8) string {
+	var name []byte
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name)
+}
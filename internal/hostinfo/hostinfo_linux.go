@@ -0,0 +1,113 @@
+package hostinfo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// kernelRelease returns the running kernel release, as uname -r prints it
+func kernelRelease() (string, error) {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// mountOf returns the mount holding path, from /proc/self/mountinfo
+func mountOf(path string) (Mount, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return Mount{}, err
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return Mount{}, err
+	}
+
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return Mount{}, err
+	}
+	defer file.Close()
+	return parseMountInfo(file, resolved)
+}
+
+// parseMountInfo finds the innermost mount holding path in mountinfo data.
+// Each line reads: id parent major:minor root mountpoint options [optional
+// fields...] - fstype source superoptions
+func parseMountInfo(r io.Reader, path string) (Mount, error) {
+	var best Mount
+	found := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		separator := -1
+		for i, field := range fields {
+			if field == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 6 || len(fields) < separator+4 {
+			continue
+		}
+
+		mountPoint := unescapeMountField(fields[4])
+		if !pathWithin(path, mountPoint) {
+			continue
+		}
+		// Later entries stack on top of earlier ones at the same point
+		if found && len(mountPoint) < len(best.MountPoint) {
+			continue
+		}
+		best = Mount{
+			MountPoint:   mountPoint,
+			Device:       unescapeMountField(fields[separator+2]),
+			FSType:       fields[separator+1],
+			Options:      fields[5],
+			SuperOptions: fields[separator+3],
+		}
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return Mount{}, err
+	}
+	if !found {
+		return Mount{}, fmt.Errorf("no mount found for %s", path)
+	}
+	return best, nil
+}
+
+// pathWithin reports whether path is mountPoint or lies below it
+func pathWithin(path, mountPoint string) bool {
+	if mountPoint == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+	return path == mountPoint || strings.HasPrefix(path, mountPoint+"/")
+}
+
+// unescapeMountField decodes the octal escapes (\040 for a space) the kernel
+// uses in mountinfo paths
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if value, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package hostinfo
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro
+35 22 8:17 / /data rw,noatime shared:2 - xfs /dev/sdb1 rw,attr2,inode64
+36 35 0:45 / /data/tmp rw,nosuid,nodev - tmpfs tmpfs rw,size=1024k
+37 22 8:33 / /mnt/backup\040disk ro,relatime - ext4 /dev/sdc1 ro
+`
+
+func TestParseMountInfo(t *testing.T) {
+	tests := []struct {
+		path       string
+		mountPoint string
+		fsType     string
+		options    string
+	}{
+		{"/data/app/orders.db", "/data", "xfs", "rw,noatime"},
+		{"/data", "/data", "xfs", "rw,noatime"},
+		{"/data/tmp/cache.db", "/data/tmp", "tmpfs", "rw,nosuid,nodev"},
+		{"/database/app.db", "/", "ext4", "rw,relatime"},
+		{"/mnt/backup disk/x", "/mnt/backup disk", "ext4", "ro,relatime"},
+	}
+	for _, tt := range tests {
+		mount, err := parseMountInfo(strings.NewReader(sampleMountInfo), tt.path)
+		if err != nil {
+			t.Fatalf("parseMountInfo(%s): %v", tt.path, err)
+		}
+		if mount.MountPoint != tt.mountPoint || mount.FSType != tt.fsType || mount.Options != tt.options {
+			t.Errorf("parseMountInfo(%s) = %+v, want %s %s %s", tt.path, mount, tt.mountPoint, tt.fsType, tt.options)
+		}
+	}
+
+	mount, _ := parseMountInfo(strings.NewReader(sampleMountInfo), "/data/app")
+	if mount.Device != "/dev/sdb1" || mount.SuperOptions != "rw,attr2,inode64" {
+		t.Errorf("Device/SuperOptions = %s/%s", mount.Device, mount.SuperOptions)
+	}
+}
+
+func TestMountOf(t *testing.T) {
+	mount, err := mountOf(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mount.MountPoint == "" || mount.FSType == "" {
+		t.Errorf("mountOf = %+v, want a mount point and filesystem type", mount)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package hostinfo
+
+import "fmt"
+
+// kernelRelease is not implemented on this platform
+func kernelRelease() (string, error) {
+	return "", fmt.Errorf("kernel release is not available on this platform")
+}
+
+// mountOf is not implemented on this platform
+func mountOf(path string) (Mount, error) {
+	return Mount{}, fmt.Errorf("mount lookup is not available on this platform")
+}
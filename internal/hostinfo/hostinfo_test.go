@@ -0,0 +1,39 @@
+package hostinfo
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCaptureAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TZ", "UTC")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	info := Capture(map[string]string{"/data/app": dir})
+	if info.OS != runtime.GOOS || info.Arch != runtime.GOARCH {
+		t.Errorf("OS/Arch = %s/%s, want %s/%s", info.OS, info.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+	if info.SQLiteVersion == "" {
+		t.Error("SQLite version was not recorded")
+	}
+	if info.Env["TZ"] != "UTC" {
+		t.Errorf("Env[TZ] = %q, want UTC", info.Env["TZ"])
+	}
+	if _, ok := info.Env["AWS_SECRET_ACCESS_KEY"]; ok {
+		t.Error("Unrelated environment variables must not be recorded")
+	}
+
+	path := filepath.Join(dir, FileName)
+	if err := info.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Hostname != info.Hostname || len(loaded.Mounts) != len(info.Mounts) {
+		t.Errorf("Loaded %+v, want %+v", loaded, info)
+	}
+}
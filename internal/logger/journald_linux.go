@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is where journald receives messages in its native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalPriorities are the syslog priorities the journal stores per level
+var journalPriorities = map[LogLevel]int{
+	DEBUG:   7,
+	INFO:    6,
+	WARNING: 4,
+	ERROR:   3,
+	FATAL:   2,
+}
+
+// journalSink writes messages to the systemd journal
+type journalSink struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// NewJournalSink connects to the systemd journal and returns a sink logging
+// under identifier, which journalctl -t selects
+func NewJournalSink(identifier string) (Sink, error) {
+	return newJournalSink(journalSocket, identifier)
+}
+
+// newJournalSink connects to the journal socket at socketPath
+func newJournalSink(socketPath, identifier string) (Sink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the systemd journal: %v", err)
+	}
+	return &journalSink{conn: conn, identifier: identifier}, nil
+}
+
+// Write sends message as one journal entry with the priority of level
+func (s *journalSink) Write(level LogLevel, message string) error {
+	var entry bytes.Buffer
+	appendJournalField(&entry, "PRIORITY", strconv.Itoa(journalPriorities[level]))
+	appendJournalField(&entry, "SYSLOG_IDENTIFIER", s.identifier)
+	appendJournalField(&entry, "MESSAGE", message)
+	_, err := s.conn.Write(entry.Bytes())
+	return err
+}
+
+// appendJournalField encodes a field in the journal's native protocol:
+// KEY=value on one line, or for a value spanning lines the key on a line
+// followed by the value's length as a little-endian uint64, the value and
+// a newline
+func appendJournalField(entry *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		entry.WriteString(key + "=" + value + "\n")
+		return
+	}
+	entry.WriteString(key + "\n")
+	binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.WriteString(value + "\n")
+}
@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalSink(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "journal.socket")
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	sink, err := newJournalSink(socketPath, "archiveFiles")
+	if err != nil {
+		t.Fatalf("newJournalSink failed: %v", err)
+	}
+	var buf bytes.Buffer
+	logger := New(&buf, INFO, true)
+	logger.SetSink(sink)
+	logger.Debug("filtered")
+	logger.Warning("disk %s almost full", "/backup")
+	logger.Error("two\nlines")
+
+	packet := make([]byte, 4096)
+	n, err := journal.Read(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "PRIORITY=4\nSYSLOG_IDENTIFIER=archiveFiles\nMESSAGE=disk /backup almost full\n"
+	if string(packet[:n]) != want {
+		t.Errorf("Entry = %q, want %q", packet[:n], want)
+	}
+
+	n, err = journal.Read(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], 9)
+	want = "PRIORITY=3\nSYSLOG_IDENTIFIER=archiveFiles\nMESSAGE\n" + string(length[:]) + "two\nlines\n"
+	if string(packet[:n]) != want {
+		t.Errorf("Entry = %q, want %q", packet[:n], want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Messages the sink took should not reach the output, got %q", buf.String())
+	}
+
+	// Once the journal is gone, messages fall back to the output
+	journal.Close()
+	logger.Error("journal down")
+	if !strings.Contains(buf.String(), "journal down") {
+		t.Errorf("Expected the message on the output, got %q", buf.String())
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package logger
+
+import "fmt"
+
+// NewJournalSink fails: the systemd journal only exists on Linux
+func NewJournalSink(identifier string) (Sink, error) {
+	return nil, fmt.Errorf("the systemd journal is only available on Linux")
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
 )
 
@@ -50,19 +51,31 @@ var (
 	}
 )
 
+// Sink receives log messages in place of the output writer. System logs
+// such as syslog and the systemd journal keep their own timestamps and
+// store the level as the message priority.
+type Sink interface {
+	Write(level LogLevel, message string) error
+}
+
 // Logger is a leveled logger with color support
 type Logger struct {
-	mu          sync.Mutex
-	output      io.Writer
-	minLevel    LogLevel
-	colorOutput bool
-	prefix      string
-	stdLogger   *log.Logger
+	mu           sync.Mutex
+	output       io.Writer
+	sink         Sink // Replaces output when set; output is the fallback if it fails
+	minLevel     LogLevel
+	moduleLevels map[string]LogLevel // Per-module overrides of minLevel
+	colorOutput  bool
+	prefix       string
+	stdLogger    *log.Logger
 }
 
 // Global default logger
 var defaultLogger *Logger
 
+// exit ends the process after a fatal message
+var exit = os.Exit
+
 func init() {
 	defaultLogger = New(os.Stderr, INFO, true)
 }
@@ -84,6 +97,17 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.minLevel = level
 }
 
+// SetModuleLevel sets the minimum log level of one module, overriding the
+// logger's level for messages logged through that module
+func (l *Logger) SetModuleLevel(module string, level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.moduleLevels == nil {
+		l.moduleLevels = make(map[string]LogLevel)
+	}
+	l.moduleLevels[module] = level
+}
+
 // SetColorOutput enables or disables color output
 func (l *Logger) SetColorOutput(enabled bool) {
 	l.mu.Lock()
@@ -91,6 +115,14 @@ func (l *Logger) SetColorOutput(enabled bool) {
 	l.colorOutput = enabled
 }
 
+// SetSink sends messages to sink instead of the output writer, or back to
+// the output writer if sink is nil
+func (l *Logger) SetSink(sink Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sink = sink
+}
+
 // SetPrefix sets the logger prefix
 func (l *Logger) SetPrefix(prefix string) {
 	l.mu.Lock()
@@ -100,16 +132,38 @@ func (l *Logger) SetPrefix(prefix string) {
 
 // log is the internal logging function
 func (l *Logger) log(level LogLevel, format string, v ...interface{}) {
+	l.logModule("", level, format, v...)
+}
+
+// logModule logs a message of a module, filtered by the module's level if
+// it has one
+func (l *Logger) logModule(module string, level LogLevel, format string, v ...interface{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if level < l.minLevel {
+	minLevel := l.minLevel
+	if moduleLevel, ok := l.moduleLevels[module]; ok {
+		minLevel = moduleLevel
+	}
+	if level < minLevel {
 		return
 	}
 
 	message := fmt.Sprintf(format, v...)
 	levelName := levelNames[level]
 
+	// The sink knows the level already; a message it rejects still reaches
+	// the output writer
+	if l.sink != nil {
+		sinkMessage := message
+		if l.prefix != "" {
+			sinkMessage = l.prefix + " " + sinkMessage
+		}
+		if err := l.sink.Write(level, sinkMessage); err == nil {
+			return
+		}
+	}
+
 	var output string
 	if l.colorOutput {
 		color := levelColors[level]
@@ -124,7 +178,7 @@ func (l *Logger) log(level LogLevel, format string, v ...interface{}) {
 
 	// Use the standard logger to get timestamp
 	l.stdLogger.SetPrefix("")
-	_ = l.stdLogger.Output(3, output)
+	_ = l.stdLogger.Output(4, output)
 }
 
 // Debug logs a debug message
@@ -150,7 +204,7 @@ func (l *Logger) Error(format string, v ...interface{}) {
 // Fatal logs a fatal message and exits
 func (l *Logger) Fatal(format string, v ...interface{}) {
 	l.log(FATAL, format, v...)
-	os.Exit(1)
+	exit(1)
 }
 
 // Package-level functions using the default logger
@@ -160,11 +214,45 @@ func SetLevel(level LogLevel) {
 	defaultLogger.SetLevel(level)
 }
 
+// SetModuleLevel sets the minimum log level of a module for the default logger
+func SetModuleLevel(module string, level LogLevel) {
+	defaultLogger.SetModuleLevel(module, level)
+}
+
+// ParseLevel converts a level name (debug, info, warning/warn, error) to a
+// LogLevel
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warning", "warn":
+		return WARNING, nil
+	case "error":
+		return ERROR, nil
+	default:
+		return INFO, fmt.Errorf("invalid log level: %s", name)
+	}
+}
+
 // SetColorOutput enables or disables color output for the default logger
 func SetColorOutput(enabled bool) {
 	defaultLogger.SetColorOutput(enabled)
 }
 
+// SetExitFunc replaces os.Exit as the way Fatal ends the process, e.g. to
+// record the exit status first
+func SetExitFunc(f func(code int)) {
+	exit = f
+}
+
+// SetSink sends the messages of the default logger to sink, or back to
+// stderr if sink is nil
+func SetSink(sink Sink) {
+	defaultLogger.SetSink(sink)
+}
+
 // SetPrefix sets the prefix for the default logger
 func SetPrefix(prefix string) {
 	defaultLogger.SetPrefix(prefix)
@@ -219,3 +307,34 @@ func Fatalf(format string, v ...interface{}) {
 func GetDefaultLogger() *Logger {
 	return defaultLogger
 }
+
+// Module logs on behalf of one internal package through the default logger,
+// so that its level can be set separately with SetModuleLevel
+type Module struct {
+	name string
+}
+
+// NewModule returns the logger of a module
+func NewModule(name string) *Module {
+	return &Module{name: name}
+}
+
+// Debug logs a debug message
+func (m *Module) Debug(format string, v ...interface{}) {
+	defaultLogger.logModule(m.name, DEBUG, format, v...)
+}
+
+// Info logs an info message
+func (m *Module) Info(format string, v ...interface{}) {
+	defaultLogger.logModule(m.name, INFO, format, v...)
+}
+
+// Warning logs a warning message
+func (m *Module) Warning(format string, v ...interface{}) {
+	defaultLogger.logModule(m.name, WARNING, format, v...)
+}
+
+// Error logs an error message
+func (m *Module) Error(format string, v ...interface{}) {
+	defaultLogger.logModule(m.name, ERROR, format, v...)
+}
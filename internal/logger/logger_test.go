@@ -211,3 +211,52 @@ func TestConcurrentLogging(t *testing.T) {
 		t.Errorf("Expected 10 log messages, got %d", count)
 	}
 }
+
+func TestModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	original := defaultLogger
+	defaultLogger = New(&buf, WARNING, false)
+	defer func() { defaultLogger = original }()
+
+	SetModuleLevel("backup", DEBUG)
+	backupLog := NewModule("backup")
+	verifyLog := NewModule("verify")
+
+	backupLog.Debug("backup detail")
+	verifyLog.Info("verify progress")
+	verifyLog.Warning("verify warning")
+	Info("global info")
+
+	output := buf.String()
+	if !strings.Contains(output, "backup detail") {
+		t.Errorf("Expected the debug message of a debug-level module, got %q", output)
+	}
+	if strings.Contains(output, "verify progress") || strings.Contains(output, "global info") {
+		t.Errorf("Expected modules without a level to use the global level, got %q", output)
+	}
+	if !strings.Contains(output, "verify warning") {
+		t.Errorf("Expected warnings at the global level, got %q", output)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    LogLevel
+		wantErr bool
+	}{
+		{"debug", DEBUG, false},
+		{"INFO", INFO, false},
+		{"warn", WARNING, false},
+		{"warning", WARNING, false},
+		{"error", ERROR, false},
+		{"verbose", INFO, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
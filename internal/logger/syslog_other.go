@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package logger
+
+import "fmt"
+
+// NewSyslogSink fails: there is no local syslog on this platform
+func NewSyslogSink(tag string) (Sink, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd
+
+package logger
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink writes messages to the local syslog daemon
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink connects to the local syslog daemon and returns a sink
+// logging with the daemon facility under tag
+func NewSyslogSink(tag string) (Sink, error) {
+	writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %v", err)
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+// Write logs message with the syslog priority of level
+func (s *syslogSink) Write(level LogLevel, message string) error {
+	switch level {
+	case DEBUG:
+		return s.writer.Debug(message)
+	case INFO:
+		return s.writer.Info(message)
+	case WARNING:
+		return s.writer.Warning(message)
+	case ERROR:
+		return s.writer.Err(message)
+	default:
+		return s.writer.Crit(message)
+	}
+}
@@ -0,0 +1,189 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/types"
+)
+
+// FileName is the name of the manifest written at the root of a backup
+const FileName = "manifest.json"
+
+// Version is the current manifest format version
+const Version = 1
+
+// Item status values
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// PathMapping records where data that lives outside an item's own path
+// (for example a RocksDB wal_dir) was stored in the backup
+type PathMapping struct {
+	Kind       string `json:"kind"`        // What the path holds: "wal_dir" or "db_paths"
+	SourcePath string `json:"source_path"` // Original location on the source host
+	BackupPath string `json:"backup_path"` // Location relative to the backup root
+}
+
+// Volume records which files of an item split across the volumes of a
+// per-item archive one volume holds
+type Volume struct {
+	File  string   `json:"file"`  // Member archive, relative to the archive directory
+	Files []string `json:"files"` // Files of the item in it, relative to the backup root
+}
+
+// Item describes one archived database or file
+type Item struct {
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	SourceRoot    string        `json:"source_root"`
+	SourcePath    string        `json:"source_path"`
+	BackupPath    string        `json:"backup_path"` // Relative to the backup root
+	Size          int64         `json:"size"`        // Source size at discovery
+	BackupSize    int64         `json:"backup_size"` // Size of the item in the backup
+	Status        string        `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	Warnings      []string      `json:"warnings,omitempty"` // Problems the item was archived despite, e.g. a failed source integrity check
+	ExternalPaths []PathMapping `json:"external_paths,omitempty"`
+
+	// On-disk format, checked on restore against the host's libraries
+	RocksDBVersion string `json:"rocksdb_version,omitempty"` // RocksDB release that wrote the database
+	FormatVersion  int    `json:"format_version,omitempty"`  // RocksDB block-based table format_version
+	PageSize       int    `json:"page_size,omitempty"`       // SQLite page size
+	SchemaFormat   int    `json:"schema_format,omitempty"`   // SQLite schema format number
+
+	SequenceNumber uint64 `json:"sequence_number,omitempty"` // RocksDB sequence number a copy or export represents, for replication tooling
+	Export         string `json:"export,omitempty"`          // Export format when the item holds exported data instead of a database, e.g. "sst"
+	Encrypted      bool   `json:"encrypted,omitempty"`       // Encrypted at rest; the files were copied as they are and verified by checksum only
+
+	Classifications []string `json:"classifications,omitempty"` // Labels of the item's source, e.g. pii, checked before the backup leaves the host
+
+	ConsistencyGroup string `json:"consistency_group,omitempty"` // Consistency group the item was backed up with, back-to-back with the group's other items
+
+	Volumes []Volume `json:"volumes,omitempty"` // Volumes of a per-item archive the item is split across, when larger than volume_size
+
+	Checksums map[string]string `json:"checksums,omitempty"` // Hex SHA-256 of each file copied into the item, computed during the copy; keyed by slash-separated path relative to backup_path
+}
+
+// Manifest lists everything contained in a backup. It is safe for
+// concurrent use by backup workers.
+type Manifest struct {
+	mu        sync.Mutex
+	Version   int       `json:"version"`
+	RunID     string    `json:"run_id,omitempty"`
+	Namespace string    `json:"namespace,omitempty"` // Tenant namespace; item backup paths start with it
+	CreatedAt time.Time `json:"created_at"`
+	Method    string    `json:"method"`
+	Items     []Item    `json:"items"`
+
+	SQLiteVersion string `json:"sqlite_version,omitempty"` // SQLite library that wrote the SQLite copies
+
+	SkippedPaths []types.SkippedPath `json:"skipped_paths,omitempty"` // Paths discovery could not read
+
+	VerifySample string `json:"verify_sample,omitempty"` // Sample size of sampled verification, if enabled
+	VerifySeed   int64  `json:"verify_seed,omitempty"`   // Seed that reproduces the verification sample
+
+	AppendedRuns []string `json:"appended_runs,omitempty"` // Runs whose items were appended to the archive later
+
+	Reconstructed bool `json:"reconstructed,omitempty"` // Rebuilt from the tar headers of a legacy archive; types and sizes are best effort
+
+	Inventory bool `json:"inventory,omitempty"` // Lists the items of an inventory run, which copied no data; item sizes are source sizes
+}
+
+// New creates an empty manifest
+func New(method string) *Manifest {
+	return &Manifest{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Method:    method,
+	}
+}
+
+// AddItem records an item
+func (m *Manifest) AddItem(item Item) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Items = append(m.Items, item)
+}
+
+// Write saves the manifest as JSON, with items sorted by backup path so the
+// output does not depend on worker scheduling
+func (m *Manifest) Write(path string) error {
+	m.mu.Lock()
+	sort.Slice(m.Items, func(i, j int) bool {
+		return m.Items[i].BackupPath < m.Items[j].BackupPath
+	})
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", path, err)
+	}
+	return nil
+}
+
+// Merge adds the items and skipped paths of other, a later run appended to
+// the backup m describes
+func (m *Manifest) Merge(other *Manifest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Items = append(m.Items, other.Items...)
+	m.SkippedPaths = append(m.SkippedPaths, other.SkippedPaths...)
+	if other.RunID != "" {
+		m.AppendedRuns = append(m.AppendedRuns, other.RunID)
+	}
+	if m.SQLiteVersion == "" {
+		m.SQLiteVersion = other.SQLiteVersion
+	}
+}
+
+// Classifications returns the labels of all items, sorted
+func (m *Manifest) Classifications() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var labels []string
+	seen := make(map[string]bool)
+	for _, item := range m.Items {
+		for _, label := range item.Classifications {
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Load reads a manifest from disk
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", path, err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Parse decodes a manifest, e.g. one read from inside an archive
+func Parse(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package manifest
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestManifestWriteAndLoad(t *testing.T) {
+	m := New("checkpoint")
+
+	// Workers add items concurrently
+	var wg sync.WaitGroup
+	for _, name := range []string{"c", "a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			m.AddItem(Item{
+				Name:       name,
+				Type:       "RocksDB",
+				BackupPath: "src/" + name,
+				Status:     StatusOK,
+			})
+		}(name)
+	}
+	wg.Wait()
+
+	m.AddItem(Item{
+		Name:       "d",
+		BackupPath: "src/d",
+		Status:     StatusOK,
+		ExternalPaths: []PathMapping{
+			{Kind: "wal_dir", SourcePath: "/wal", BackupPath: "src/d/wal_dir"},
+		},
+	})
+
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := m.Write(path); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loaded.Version != Version || loaded.Method != "checkpoint" {
+		t.Errorf("Unexpected header: version=%d method=%s", loaded.Version, loaded.Method)
+	}
+	if len(loaded.Items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(loaded.Items))
+	}
+	for i, want := range []string{"a", "b", "c", "d"} {
+		if loaded.Items[i].Name != want {
+			t.Errorf("Item %d = %s, want %s (items must be sorted)", i, loaded.Items[i].Name, want)
+		}
+	}
+	if len(loaded.Items[3].ExternalPaths) != 1 || loaded.Items[3].ExternalPaths[0].SourcePath != "/wal" {
+		t.Errorf("External path mapping not preserved: %+v", loaded.Items[3].ExternalPaths)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing manifest")
+	}
+}
@@ -0,0 +1,193 @@
+// Package mirror describes backups stored as a plain directory tree on a
+// remote host, one file per backup file, instead of as an archive
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/manifest"
+)
+
+// File names in a mirror target
+const (
+	IndexFileName  = "MIRROR-INDEX.json" // Written into the run directory after all of its files
+	LatestFileName = "LATEST"            // Names the run directory of the last complete mirror
+)
+
+// Version is the current index format version
+const Version = 1
+
+// File is one file of a mirrored backup
+type File struct {
+	Path   string      `json:"path"` // Relative to the backup root, slash-separated
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"` // Permission bits
+	SHA256 string      `json:"sha256"`
+}
+
+// Index lists every file of a mirrored backup with its checksum. Files with
+// the checksum of a file in the previous run are linked to it on the remote
+// host instead of being sent again.
+type Index struct {
+	Version   int       `json:"version"`
+	RunID     string    `json:"run_id,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []File    `json:"files"`
+}
+
+// Build walks the backup at root and returns the index of its files, sorted
+// by path. Backups only contain directories and regular files; anything
+// else is an error rather than silently missing from the mirror.
+func Build(root string) (*Index, error) {
+	index := &Index{Version: Version, CreatedAt: time.Now().UTC()}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return fmt.Errorf("cannot mirror %s: not a regular file", path)
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		index.Files = append(index.Files, File{
+			Path:   filepath.ToSlash(relPath),
+			Size:   info.Size(),
+			Mode:   info.Mode().Perm(),
+			SHA256: sum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index backup %s: %v", root, err)
+	}
+	sort.Slice(index.Files, func(i, j int) bool {
+		return index.Files[i].Path < index.Files[j].Path
+	})
+	return index, nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Marshal encodes the index as JSON
+func (i *Index) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal mirror index: %v", err)
+	}
+	return data, nil
+}
+
+// Parse decodes an index, e.g. one read from a mirror target
+func Parse(data []byte) (*Index, error) {
+	index := &Index{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse mirror index: %v", err)
+	}
+	if index.Version > Version {
+		return nil, fmt.Errorf("mirror index version %d is newer than this version of archiveFiles supports (%d)", index.Version, Version)
+	}
+	return index, nil
+}
+
+// BySHA256 returns a file of the index for each checksum in it
+func (i *Index) BySHA256() map[string]File {
+	files := make(map[string]File, len(i.Files))
+	for _, file := range i.Files {
+		files[file.SHA256] = file
+	}
+	return files
+}
+
+// Select returns the files of the index that restoring items, backup paths
+// of items in m, needs: the files below each item and below the paths it
+// keeps data in outside its own (such as a RocksDB wal_dir), and every file
+// that belongs to no item, such as the manifest. Empty items selects all.
+func (i *Index) Select(m *manifest.Manifest, items []string) ([]File, error) {
+	if len(items) == 0 {
+		return i.Files, nil
+	}
+
+	var itemPaths, selected []string
+	known := make(map[string]manifest.Item)
+	for _, item := range m.Items {
+		known[item.BackupPath] = item
+		itemPaths = append(itemPaths, item.BackupPath)
+		for _, external := range item.ExternalPaths {
+			itemPaths = append(itemPaths, external.BackupPath)
+		}
+	}
+	for _, name := range items {
+		item, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("item %s is not in the backup", name)
+		}
+		selected = append(selected, item.BackupPath)
+		for _, external := range item.ExternalPaths {
+			selected = append(selected, external.BackupPath)
+		}
+	}
+
+	var files []File
+	for _, file := range i.Files {
+		if below(file.Path, selected) || !below(file.Path, itemPaths) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// below reports whether the slash-separated file is one of dirs or inside
+// one of them
+func below(file string, dirs []string) bool {
+	for _, dir := range dirs {
+		if file == dir || strings.HasPrefix(file, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Size returns the total size of the files in the index
+func (i *Index) Size() int64 {
+	var size int64
+	for _, file := range i.Files {
+		size += file.Size
+	}
+	return size
+}
@@ -0,0 +1,100 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/manifest"
+)
+
+func TestBuild(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "data", "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "manifest.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "data", "db", "000001.sst"), []byte("sst"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := Build(root)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if len(index.Files) != 2 || index.Files[0].Path != "data/db/000001.sst" || index.Files[1].Path != "manifest.json" {
+		t.Fatalf("Unexpected files %+v", index.Files)
+	}
+	sst := index.Files[0]
+	if sst.Size != 3 || sst.Mode != 0600 || sst.SHA256 != "7b8932a7d01817e6e54e4d39151138caaaf577726f29b8a627bfc55da0de2588" {
+		t.Errorf("Unexpected entry %+v", sst)
+	}
+	if index.Size() != 5 {
+		t.Errorf("Size = %d, want 5", index.Size())
+	}
+
+	data, err := index.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := parsed.BySHA256()[sst.SHA256]; got.Path != sst.Path {
+		t.Errorf("BySHA256 = %+v, want %s", got, sst.Path)
+	}
+
+	if err := os.Symlink("manifest.json", filepath.Join(root, "link")); err != nil {
+		t.Skip("symlinks not supported")
+	}
+	if _, err := Build(root); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Build error = %v, want the symlink rejected", err)
+	}
+}
+
+func TestParse_NewerVersion(t *testing.T) {
+	if _, err := Parse([]byte(`{"version": 99}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Parse error = %v, want a newer version rejected", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	index := &Index{Files: []File{
+		{Path: "data/app.db/app.db"},
+		{Path: "data/app.db.backup.log"},
+		{Path: "data/kv/CURRENT"},
+		{Path: "data/kv/000001.sst"},
+		{Path: "data/kv2/CURRENT"},
+		{Path: "external/kv/wal/000002.log"},
+		{Path: "manifest.json"},
+	}}
+	m := &manifest.Manifest{Items: []manifest.Item{
+		{BackupPath: "data/app.db"},
+		{BackupPath: "data/kv", ExternalPaths: []manifest.PathMapping{{Kind: "wal_dir", BackupPath: "external/kv/wal"}}},
+		{BackupPath: "data/kv2"},
+	}}
+
+	files, err := index.Select(m, []string{"data/kv"})
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	want := "data/app.db.backup.log data/kv/CURRENT data/kv/000001.sst external/kv/wal/000002.log manifest.json"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("Selected %s, want %s", got, want)
+	}
+
+	if files, _ := index.Select(m, nil); len(files) != len(index.Files) {
+		t.Errorf("Selecting no items returned %d files, want all %d", len(files), len(index.Files))
+	}
+	if _, err := index.Select(m, []string{"data/missing"}); err == nil || !strings.Contains(err.Error(), "not in the backup") {
+		t.Errorf("Select error = %v, want an unknown item rejected", err)
+	}
+}
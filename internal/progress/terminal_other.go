@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package progress
+
+// ttyColumns is not available on this platform
+func ttyColumns() int {
+	return 0
+}
+
+// watchResize is not available on this platform; the width is read once
+func watchResize(onResize func()) {}
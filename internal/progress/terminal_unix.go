@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd
+
+package progress
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// winsize is the terminal size reported by TIOCGWINSZ
+type winsize struct {
+	Rows, Cols, XPixels, YPixels uint16
+}
+
+// ttyColumns returns the width of the terminal on stderr, where progress is
+// drawn, or 0 when stderr is not a terminal
+func ttyColumns() int {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stderr.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.Cols)
+}
+
+// watchResize calls onResize whenever the terminal window changes size
+func watchResize(onResize func()) {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	go func() {
+		for range resized {
+			onResize()
+		}
+	}()
+}
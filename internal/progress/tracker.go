@@ -2,46 +2,107 @@ package progress
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"archiveFiles/internal/constants"
 	"archiveFiles/internal/utils"
 )
 
-// ProgressTracker tracks progress of backup operations
+// ProgressTracker tracks progress of backup operations. Workers publish
+// updates with atomic operations and never draw; a single render goroutine,
+// started by Init, redraws the line from a Snapshot at a fixed frame rate.
 type ProgressTracker struct {
-	mu            sync.Mutex
-	totalItems    int
-	currentItem   int
-	totalSize     int64
-	processedSize int64
-	startTime     time.Time
-	currentFile   string
-	enabled       bool
+	enabled bool
+
+	// Published by workers
+	totalItems    atomic.Int64
+	currentItem   atomic.Int64
+	totalSize     atomic.Int64
+	processedSize atomic.Int64
+	inFlightSize  atomic.Int64 // Bytes written so far by items that are still running
+	records       atomic.Int64 // RocksDB records copied by the last record-level copy
+	totalRecords  atomic.Int64 // Records that copy expects (0 = unknown)
+	currentFile   atomic.Pointer[string]
+	startTime     atomic.Pointer[time.Time]
+
+	// Rendering
+	mu       sync.Mutex    // Guards out, interval and the render loop
+	out      io.Writer     // Progress goes to stderr so stdout stays clean for results
+	interval time.Duration // Time between frames
+	stop     chan struct{} // Closed to stop the render loop; nil when it is not running
+	done     chan struct{} // Closed when the render loop has exited
+}
+
+// Snapshot is an immutable view of the progress at one point in time
+type Snapshot struct {
+	TotalItems    int
+	CurrentItem   int
+	TotalSize     int64
+	ProcessedSize int64
+	InFlightSize  int64
+	Records       int64
+	TotalRecords  int64
+	CurrentFile   string
+	StartTime     time.Time
 }
 
-// NewProgressTracker creates a new progress tracker
+// NewProgressTracker creates a new progress tracker writing to stderr
 func NewProgressTracker(enabled bool) *ProgressTracker {
-	return &ProgressTracker{
-		startTime: time.Now(),
-		enabled:   enabled,
+	p := &ProgressTracker{enabled: enabled, out: os.Stderr, interval: time.Second / constants.ProgressFramesPerSecond}
+	now := time.Now()
+	p.startTime.Store(&now)
+	return p
+}
+
+// SetOutput redirects progress output, e.g. for tests
+func (p *ProgressTracker) SetOutput(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out = w
+}
+
+// SetInterval sets the time between frames, so that many small items do
+// not make the terminal a bottleneck. It applies from the next Init. The
+// default is constants.ProgressFramesPerSecond frames a second; intervals
+// of 0 or less keep the current one.
+func (p *ProgressTracker) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interval = interval
 }
 
-// Init initializes progress tracking
+// Init initializes progress tracking and starts drawing
 func (p *ProgressTracker) Init(totalItems int, totalSize int64) {
 	if !p.enabled {
 		return
 	}
+	p.totalItems.Store(int64(totalItems))
+	p.totalSize.Store(totalSize)
+	p.currentItem.Store(0)
+	p.processedSize.Store(0)
+	p.inFlightSize.Store(0)
+	p.records.Store(0)
+	p.totalRecords.Store(0)
+	now := time.Now()
+	p.startTime.Store(&now)
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.totalItems = totalItems
-	p.totalSize = totalSize
-	p.currentItem = 0
-	p.processedSize = 0
-	p.startTime = time.Now()
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.render(p.interval, p.stop, p.done)
+	}
 }
 
 // SetCurrentFile updates the current processing file
@@ -49,10 +110,7 @@ func (p *ProgressTracker) SetCurrentFile(filename string) {
 	if !p.enabled {
 		return
 	}
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.currentFile = filename
-	p.displayProgress()
+	p.currentFile.Store(&filename)
 }
 
 // CompleteItem marks an item as completed
@@ -60,123 +118,284 @@ func (p *ProgressTracker) CompleteItem(size int64) {
 	if !p.enabled {
 		return
 	}
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.currentItem++
-	p.processedSize += size
-	p.displayProgress()
+	p.currentItem.Add(1)
+	p.processedSize.Add(size)
 }
 
-// UpdateRocksDBProgress updates progress for RocksDB copying (by record count)
+// UpdateRocksDBProgress publishes the progress of a record-level RocksDB
+// copy. A total of 0 means the number of records is not known yet.
 func (p *ProgressTracker) UpdateRocksDBProgress(processed, total int64) {
 	if !p.enabled {
 		return
 	}
+	p.totalRecords.Store(total)
+	p.records.Store(processed)
+}
+
+// Work reports the byte progress of one running item, e.g. a checkpoint
+// whose target directory grows, so the bar moves before the item completes.
+// Its bytes count as processed until Done.
+type Work struct {
+	tracker  *ProgressTracker
+	total    int64
+	reported atomic.Int64
+}
+
+// StartWork starts reporting the progress of an item expected to write
+// total bytes (0 = unknown)
+func (p *ProgressTracker) StartWork(total int64) *Work {
+	return &Work{tracker: p, total: total}
+}
+
+// Enabled reports whether the tracker counts progress, so callers can skip
+// measuring work nobody will see
+func (p *ProgressTracker) Enabled() bool {
+	return p.enabled
+}
+
+// Update reports that the item has written done bytes so far. Progress
+// beyond the expected total is not shown until the item completes.
+func (w *Work) Update(done int64) {
+	if !w.tracker.enabled {
+		return
+	}
+	if w.total > 0 && done > w.total {
+		done = w.total
+	}
+	previous := w.reported.Swap(done)
+	w.tracker.inFlightSize.Add(done - previous)
+}
+
+// Done withdraws the reported bytes; the item's CompleteItem counts them
+func (w *Work) Done() {
+	if !w.tracker.enabled {
+		return
+	}
+	w.tracker.inFlightSize.Add(-w.reported.Swap(0))
+}
+
+// Snapshot returns the current progress. Disabled trackers do not count.
+func (p *ProgressTracker) Snapshot() Snapshot {
+	s := Snapshot{
+		TotalItems:    int(p.totalItems.Load()),
+		CurrentItem:   int(p.currentItem.Load()),
+		TotalSize:     p.totalSize.Load(),
+		ProcessedSize: p.processedSize.Load(),
+		InFlightSize:  p.inFlightSize.Load(),
+		Records:       p.records.Load(),
+		TotalRecords:  p.totalRecords.Load(),
+		StartTime:     *p.startTime.Load(),
+	}
+	if file := p.currentFile.Load(); file != nil {
+		s.CurrentFile = *file
+	}
+	return s
+}
+
+// Percent returns the completed share of the total size, including the
+// bytes of running items (or of the item count when sizes are unknown), as a
+// percentage. Disabled trackers do not count and always report 0.
+func (p *ProgressTracker) Percent() float64 {
+	return p.Snapshot().Percent()
+}
+
+// Percent returns the completed share of the snapshot, like
+// ProgressTracker.Percent
+func (s Snapshot) Percent() float64 {
+	if s.TotalSize > 0 {
+		return math.Min(100, float64(s.ProcessedSize+s.InFlightSize)*100/float64(s.TotalSize))
+	}
+	if s.TotalItems > 0 {
+		return float64(s.CurrentItem) * 100 / float64(s.TotalItems)
+	}
+	return 0
+}
+
+// render redraws the progress line every interval until stop is closed
+func (p *ProgressTracker) render(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.draw(p.Snapshot())
+		}
+	}
+}
+
+// stopRendering stops the render loop and waits for its last frame
+func (p *ProgressTracker) stopRendering() {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	// For RocksDB, we use record count as a proxy for progress
-	if total > 0 {
-		p.displayRocksDBProgress(processed, total)
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
 	}
 }
 
+// draw writes one frame
+func (p *ProgressTracker) draw(s Snapshot) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.displayProgress(s)
+}
+
 // displayProgress displays overall progress
-func (p *ProgressTracker) displayProgress() {
-	if p.totalItems == 0 {
+func (p *ProgressTracker) displayProgress(s Snapshot) {
+	if s.TotalItems == 0 {
 		return
 	}
 
-	percentage := float64(p.currentItem) / float64(p.totalItems) * 100
-	elapsed := time.Since(p.startTime)
+	percentage := s.Percent()
+	elapsed := time.Since(s.StartTime)
+	processed := s.ProcessedSize + s.InFlightSize
 
 	// Calculate speed and ETA
 	var eta time.Duration
 	var speed string
-	if p.processedSize > 0 && elapsed.Seconds() > 0 {
-		bytesPerSecond := float64(p.processedSize) / elapsed.Seconds()
+	if processed > 0 && elapsed.Seconds() > 0 {
+		bytesPerSecond := float64(processed) / elapsed.Seconds()
 		speed = utils.FormatBytes(int64(bytesPerSecond)) + "/s"
 
 		if bytesPerSecond > 0 {
-			remainingBytes := p.totalSize - p.processedSize
+			remainingBytes := s.TotalSize - processed
 			etaSeconds := float64(remainingBytes) / bytesPerSecond
 			eta = time.Duration(etaSeconds) * time.Second
 		}
 	}
 
-	// Create progress bar
-	filled := int(percentage / 100 * float64(constants.ProgressBarWidth))
-	if filled < 0 {
-		filled = 0
-	}
-	if filled > constants.ProgressBarWidth {
-		filled = constants.ProgressBarWidth
-	}
-	bar := strings.Repeat("█", filled) + strings.Repeat("░", constants.ProgressBarWidth-filled)
-
 	// Format output
-	fmt.Printf("\r[%s] %.1f%% (%d/%d) | %s | %s",
-		bar,
+	stats := fmt.Sprintf(" %.1f%% (%d/%d) | %s | %s",
 		percentage,
-		p.currentItem,
-		p.totalItems,
-		utils.FormatBytes(p.processedSize)+"/"+utils.FormatBytes(p.totalSize),
+		s.CurrentItem,
+		s.TotalItems,
+		utils.FormatBytes(processed)+"/"+utils.FormatBytes(s.TotalSize),
 		speed,
 	)
 
 	if eta > 0 {
-		fmt.Printf(" | ETA: %s", utils.FormatDuration(eta))
+		stats += fmt.Sprintf(" | ETA: %s", utils.FormatDuration(eta))
 	}
 
-	if p.currentFile != "" {
-		fmt.Printf(" | %s", utils.TruncateString(p.currentFile, constants.ProgressFileNameMaxLength))
+	// A record-level RocksDB copy that is still running
+	if s.Records > 0 && (s.TotalRecords == 0 || s.Records < s.TotalRecords) {
+		stats += fmt.Sprintf(" | %d records", s.Records)
 	}
 
-	fmt.Print("   ") // Clear any remaining characters
+	p.printLine(percentage, stats, s.CurrentFile)
 }
 
-// displayRocksDBProgress displays RocksDB specific progress
-func (p *ProgressTracker) displayRocksDBProgress(processed, total int64) {
-	percentage := float64(processed) / float64(total) * 100
-	elapsed := time.Since(p.startTime)
+// printLine redraws the progress line: the bar, the stats and the current
+// file, sized to the terminal width
+func (p *ProgressTracker) printLine(percentage float64, stats, currentFile string) {
+	width := terminalWidth()
+	available := width - 1 - utils.DisplayWidth("[]"+stats)
+	barWidth, fileWidth := layoutLine(available, currentFile)
 
-	// Calculate records per second
-	var speed string
-	if elapsed.Seconds() > 0 {
-		recordsPerSecond := float64(processed) / elapsed.Seconds()
-		speed = fmt.Sprintf("%.0f rec/s", recordsPerSecond)
+	line := "[" + renderBar(percentage, barWidth) + "]" + stats
+	if currentFile != "" && fileWidth > 0 {
+		line += " | " + utils.TruncateString(currentFile, fileWidth)
+	}
+	fmt.Fprint(p.out, "\r"+fitLine(line, width))
+}
+
+// layoutLine splits the columns left next to the stats between the bar and
+// the file name. The bar shrinks towards constants.ProgressBarMinWidth to
+// show up to constants.ProgressFileNameMaxLength columns of the file name;
+// space beyond the widest bar goes to the file name.
+func layoutLine(available int, fileName string) (barWidth, fileWidth int) {
+	wanted := 0
+	if fileName != "" {
+		wanted = len(" | ") + min(utils.DisplayWidth(fileName), constants.ProgressFileNameMaxLength)
 	}
 
-	// Create progress bar
-	filled := int(percentage / 100 * float64(constants.ProgressBarWidth))
+	barWidth = min(max(available-wanted, constants.ProgressBarMinWidth), constants.ProgressBarWidth)
+	if fileName != "" {
+		fileWidth = available - barWidth - len(" | ")
+	}
+	return barWidth, max(fileWidth, 0)
+}
+
+// renderBar draws a bar of width characters filled to percentage
+func renderBar(percentage float64, width int) string {
+	filled := int(percentage / 100 * float64(width))
 	if filled < 0 {
 		filled = 0
 	}
-	if filled > constants.ProgressBarWidth {
-		filled = constants.ProgressBarWidth
+	if filled > width {
+		filled = width
 	}
-	bar := strings.Repeat("█", filled) + strings.Repeat("░", constants.ProgressBarWidth-filled)
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
 
-	fmt.Printf("\r  [%s] %.1f%% (%d/%d records) | %s | %s   ",
-		bar,
-		percentage,
-		processed,
-		total,
-		speed,
-		p.currentFile,
-	)
+var (
+	widthOnce   sync.Once
+	cachedWidth atomic.Int64
+)
+
+// terminalWidth returns the width of the terminal on stderr. It is queried
+// once and again whenever the window is resized (SIGWINCH).
+func terminalWidth() int {
+	widthOnce.Do(func() {
+		cachedWidth.Store(int64(queryTerminalWidth()))
+		watchResize(func() {
+			cachedWidth.Store(int64(queryTerminalWidth()))
+		})
+	})
+	return int(cachedWidth.Load())
+}
+
+// queryTerminalWidth asks the terminal for its width, falling back to
+// $COLUMNS and then constants.DefaultTerminalWidth
+func queryTerminalWidth() int {
+	if columns := ttyColumns(); columns > 0 {
+		return columns
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return constants.DefaultTerminalWidth
 }
 
-// Finish completes progress tracking
+// fitLine truncates line to the terminal width and pads it with spaces, so
+// that redrawing with \r fully overwrites the previous line. The last column
+// is left empty because writing it makes some terminals wrap.
+func fitLine(line string, width int) string {
+	width--
+	if width <= 0 {
+		return line
+	}
+	line = utils.TruncateString(line, width)
+	return line + strings.Repeat(" ", width-utils.DisplayWidth(line))
+}
+
+// Stop stops drawing without printing a summary, e.g. when a run fails. It
+// is safe to call more than once.
+func (p *ProgressTracker) Stop() {
+	if !p.enabled {
+		return
+	}
+	p.stopRendering()
+}
+
+// Finish draws the final frame and prints a summary
 func (p *ProgressTracker) Finish() {
 	if !p.enabled {
 		return
 	}
+	p.stopRendering()
+
+	s := p.Snapshot()
 	p.mu.Lock()
 	defer p.mu.Unlock()
-
-	elapsed := time.Since(p.startTime)
-	fmt.Printf("\nCompleted %d item(s) in %s (%s total)\n",
-		p.totalItems,
-		utils.FormatDuration(elapsed),
-		utils.FormatBytes(p.totalSize))
+	p.displayProgress(s)
+	fmt.Fprintf(p.out, "\nCompleted %d item(s) in %s (%s total)\n",
+		s.TotalItems,
+		utils.FormatDuration(time.Since(s.StartTime)),
+		utils.FormatBytes(s.TotalSize))
 }
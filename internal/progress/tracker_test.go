@@ -1,7 +1,10 @@
 package progress
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -14,7 +17,7 @@ func TestNewProgressTracker(t *testing.T) {
 		if !tracker.enabled {
 			t.Error("Expected tracker to be enabled")
 		}
-		if tracker.startTime.IsZero() {
+		if tracker.Snapshot().StartTime.IsZero() {
 			t.Error("Expected start time to be set")
 		}
 	})
@@ -28,6 +31,47 @@ func TestNewProgressTracker(t *testing.T) {
 	})
 }
 
+func TestProgressTracker_Output(t *testing.T) {
+	tracker := NewProgressTracker(true)
+	if tracker.out != os.Stderr {
+		t.Error("Expected progress to be written to stderr by default")
+	}
+
+	var buf bytes.Buffer
+	tracker.SetOutput(&buf)
+	tracker.Init(1, 100)
+	tracker.SetCurrentFile("app.db")
+	tracker.CompleteItem(100)
+	tracker.Finish()
+
+	out := buf.String()
+	if !strings.Contains(out, "app.db") || !strings.Contains(out, "Completed 1 item(s)") {
+		t.Errorf("Expected progress and summary in output, got %q", out)
+	}
+}
+
+func TestProgressTracker_SetInterval(t *testing.T) {
+	tracker := NewProgressTracker(true)
+	var buf bytes.Buffer
+	tracker.SetOutput(&buf)
+	tracker.SetInterval(time.Hour)
+	tracker.SetInterval(0) // Ignored
+	tracker.Init(1000, 0)
+	for i := 0; i < 1000; i++ {
+		tracker.SetCurrentFile(fmt.Sprintf("file-%d.log", i))
+		tracker.CompleteItem(0)
+	}
+	tracker.Finish()
+
+	// Updates never draw; only the final frame is written
+	if frames := strings.Count(buf.String(), "\r"); frames != 1 {
+		t.Errorf("Expected only the final frame with an hourly interval, got %d frame(s): %q", frames, buf.String())
+	}
+	if !strings.Contains(buf.String(), "(1000/1000)") {
+		t.Errorf("Expected the final frame to show every item, got %q", buf.String())
+	}
+}
+
 func TestProgressTracker_Init(t *testing.T) {
 	// Test enabled tracker
 	t.Run("Enabled tracker", func(t *testing.T) {
@@ -37,33 +81,33 @@ func TestProgressTracker_Init(t *testing.T) {
 
 		tracker.Init(totalItems, totalSize)
 
-		if tracker.totalItems != totalItems {
-			t.Errorf("Expected totalItems to be %d, got %d", totalItems, tracker.totalItems)
+		if tracker.Snapshot().TotalItems != totalItems {
+			t.Errorf("Expected totalItems to be %d, got %d", totalItems, tracker.Snapshot().TotalItems)
 		}
-		if tracker.totalSize != totalSize {
-			t.Errorf("Expected totalSize to be %d, got %d", totalSize, tracker.totalSize)
+		if tracker.Snapshot().TotalSize != totalSize {
+			t.Errorf("Expected totalSize to be %d, got %d", totalSize, tracker.Snapshot().TotalSize)
 		}
-		if tracker.currentItem != 0 {
-			t.Errorf("Expected currentItem to be 0, got %d", tracker.currentItem)
+		if tracker.Snapshot().CurrentItem != 0 {
+			t.Errorf("Expected currentItem to be 0, got %d", tracker.Snapshot().CurrentItem)
 		}
-		if tracker.processedSize != 0 {
-			t.Errorf("Expected processedSize to be 0, got %d", tracker.processedSize)
+		if tracker.Snapshot().ProcessedSize != 0 {
+			t.Errorf("Expected processedSize to be 0, got %d", tracker.Snapshot().ProcessedSize)
 		}
 	})
 
 	// Test disabled tracker
 	t.Run("Disabled tracker", func(t *testing.T) {
 		tracker := NewProgressTracker(false)
-		originalItems := tracker.totalItems
-		originalSize := tracker.totalSize
+		originalItems := tracker.Snapshot().TotalItems
+		originalSize := tracker.Snapshot().TotalSize
 
 		tracker.Init(100, 2048)
 
 		// Should not change values when disabled
-		if tracker.totalItems != originalItems {
+		if tracker.Snapshot().TotalItems != originalItems {
 			t.Error("Disabled tracker should not update totalItems")
 		}
-		if tracker.totalSize != originalSize {
+		if tracker.Snapshot().TotalSize != originalSize {
 			t.Error("Disabled tracker should not update totalSize")
 		}
 	})
@@ -77,20 +121,20 @@ func TestProgressTracker_SetCurrentFile(t *testing.T) {
 
 		tracker.SetCurrentFile(filename)
 
-		if tracker.currentFile != filename {
-			t.Errorf("Expected currentFile to be %s, got %s", filename, tracker.currentFile)
+		if tracker.Snapshot().CurrentFile != filename {
+			t.Errorf("Expected currentFile to be %s, got %s", filename, tracker.Snapshot().CurrentFile)
 		}
 	})
 
 	// Test disabled tracker
 	t.Run("Disabled tracker", func(t *testing.T) {
 		tracker := NewProgressTracker(false)
-		originalFile := tracker.currentFile
+		originalFile := tracker.Snapshot().CurrentFile
 
 		tracker.SetCurrentFile("test_file.db")
 
 		// Should not change when disabled
-		if tracker.currentFile != originalFile {
+		if tracker.Snapshot().CurrentFile != originalFile {
 			t.Error("Disabled tracker should not update currentFile")
 		}
 	})
@@ -108,45 +152,45 @@ func TestProgressTracker_CompleteItem(t *testing.T) {
 
 		// Complete first item
 		tracker.CompleteItem(size1)
-		if tracker.currentItem != 1 {
-			t.Errorf("Expected currentItem to be 1, got %d", tracker.currentItem)
+		if tracker.Snapshot().CurrentItem != 1 {
+			t.Errorf("Expected currentItem to be 1, got %d", tracker.Snapshot().CurrentItem)
 		}
-		if tracker.processedSize != size1 {
-			t.Errorf("Expected processedSize to be %d, got %d", size1, tracker.processedSize)
+		if tracker.Snapshot().ProcessedSize != size1 {
+			t.Errorf("Expected processedSize to be %d, got %d", size1, tracker.Snapshot().ProcessedSize)
 		}
 
 		// Complete second item
 		tracker.CompleteItem(size2)
-		if tracker.currentItem != 2 {
-			t.Errorf("Expected currentItem to be 2, got %d", tracker.currentItem)
+		if tracker.Snapshot().CurrentItem != 2 {
+			t.Errorf("Expected currentItem to be 2, got %d", tracker.Snapshot().CurrentItem)
 		}
-		if tracker.processedSize != size1+size2 {
-			t.Errorf("Expected processedSize to be %d, got %d", size1+size2, tracker.processedSize)
+		if tracker.Snapshot().ProcessedSize != size1+size2 {
+			t.Errorf("Expected processedSize to be %d, got %d", size1+size2, tracker.Snapshot().ProcessedSize)
 		}
 
 		// Complete third item
 		tracker.CompleteItem(size3)
-		if tracker.currentItem != 3 {
-			t.Errorf("Expected currentItem to be 3, got %d", tracker.currentItem)
+		if tracker.Snapshot().CurrentItem != 3 {
+			t.Errorf("Expected currentItem to be 3, got %d", tracker.Snapshot().CurrentItem)
 		}
-		if tracker.processedSize != size1+size2+size3 {
-			t.Errorf("Expected processedSize to be %d, got %d", size1+size2+size3, tracker.processedSize)
+		if tracker.Snapshot().ProcessedSize != size1+size2+size3 {
+			t.Errorf("Expected processedSize to be %d, got %d", size1+size2+size3, tracker.Snapshot().ProcessedSize)
 		}
 	})
 
 	// Test disabled tracker
 	t.Run("Disabled tracker", func(t *testing.T) {
 		tracker := NewProgressTracker(false)
-		originalItem := tracker.currentItem
-		originalSize := tracker.processedSize
+		originalItem := tracker.Snapshot().CurrentItem
+		originalSize := tracker.Snapshot().ProcessedSize
 
 		tracker.CompleteItem(100)
 
 		// Should not change when disabled
-		if tracker.currentItem != originalItem {
+		if tracker.Snapshot().CurrentItem != originalItem {
 			t.Error("Disabled tracker should not update currentItem")
 		}
-		if tracker.processedSize != originalSize {
+		if tracker.Snapshot().ProcessedSize != originalSize {
 			t.Error("Disabled tracker should not update processedSize")
 		}
 	})
@@ -216,14 +260,14 @@ func TestProgressTracker_Concurrency(t *testing.T) {
 
 	// Verify final state
 	expectedItems := numGoroutines * itemsPerGoroutine
-	if tracker.currentItem != expectedItems {
-		t.Errorf("Expected currentItem to be %d, got %d", expectedItems, tracker.currentItem)
+	if tracker.Snapshot().CurrentItem != expectedItems {
+		t.Errorf("Expected currentItem to be %d, got %d", expectedItems, tracker.Snapshot().CurrentItem)
 	}
 
 	// Verify that the processedSize is reasonable (sum of all individual sizes)
 	expectedMinSize := int64(numGoroutines * (1 + itemsPerGoroutine) * itemsPerGoroutine / 2)
-	if tracker.processedSize != expectedMinSize {
-		t.Errorf("Expected processedSize to be %d, got %d", expectedMinSize, tracker.processedSize)
+	if tracker.Snapshot().ProcessedSize != expectedMinSize {
+		t.Errorf("Expected processedSize to be %d, got %d", expectedMinSize, tracker.Snapshot().ProcessedSize)
 	}
 }
 
@@ -272,17 +316,17 @@ func TestProgressTracker_StateConsistency(t *testing.T) {
 	tracker.Init(totalItems, totalSize)
 
 	// Verify initial state
-	if tracker.totalItems != totalItems {
-		t.Errorf("Expected totalItems to be %d, got %d", totalItems, tracker.totalItems)
+	if tracker.Snapshot().TotalItems != totalItems {
+		t.Errorf("Expected totalItems to be %d, got %d", totalItems, tracker.Snapshot().TotalItems)
 	}
-	if tracker.totalSize != totalSize {
-		t.Errorf("Expected totalSize to be %d, got %d", totalSize, tracker.totalSize)
+	if tracker.Snapshot().TotalSize != totalSize {
+		t.Errorf("Expected totalSize to be %d, got %d", totalSize, tracker.Snapshot().TotalSize)
 	}
-	if tracker.currentItem != 0 {
-		t.Errorf("Expected currentItem to be 0, got %d", tracker.currentItem)
+	if tracker.Snapshot().CurrentItem != 0 {
+		t.Errorf("Expected currentItem to be 0, got %d", tracker.Snapshot().CurrentItem)
 	}
-	if tracker.processedSize != 0 {
-		t.Errorf("Expected processedSize to be 0, got %d", tracker.processedSize)
+	if tracker.Snapshot().ProcessedSize != 0 {
+		t.Errorf("Expected processedSize to be 0, got %d", tracker.Snapshot().ProcessedSize)
 	}
 
 	// Update progress step by step
@@ -291,13 +335,13 @@ func TestProgressTracker_StateConsistency(t *testing.T) {
 		tracker.CompleteItem(int64(i * 100))
 
 		// Verify state after each update
-		if tracker.currentItem != i {
-			t.Errorf("After item %d: expected currentItem to be %d, got %d", i, i, tracker.currentItem)
+		if tracker.Snapshot().CurrentItem != i {
+			t.Errorf("After item %d: expected currentItem to be %d, got %d", i, i, tracker.Snapshot().CurrentItem)
 		}
 
 		expectedSize := int64(i * (i + 1) * 100 / 2)
-		if tracker.processedSize != expectedSize {
-			t.Errorf("After item %d: expected processedSize to be %d, got %d", i, expectedSize, tracker.processedSize)
+		if tracker.Snapshot().ProcessedSize != expectedSize {
+			t.Errorf("After item %d: expected processedSize to be %d, got %d", i, expectedSize, tracker.Snapshot().ProcessedSize)
 		}
 	}
 }
@@ -308,11 +352,11 @@ func TestProgressTracker_EdgeCases(t *testing.T) {
 		tracker := NewProgressTracker(true)
 		tracker.Init(0, 0)
 
-		if tracker.totalItems != 0 {
-			t.Errorf("Expected totalItems to be 0, got %d", tracker.totalItems)
+		if tracker.Snapshot().TotalItems != 0 {
+			t.Errorf("Expected totalItems to be 0, got %d", tracker.Snapshot().TotalItems)
 		}
-		if tracker.totalSize != 0 {
-			t.Errorf("Expected totalSize to be 0, got %d", tracker.totalSize)
+		if tracker.Snapshot().TotalSize != 0 {
+			t.Errorf("Expected totalSize to be 0, got %d", tracker.Snapshot().TotalSize)
 		}
 	})
 
@@ -322,11 +366,11 @@ func TestProgressTracker_EdgeCases(t *testing.T) {
 		tracker.Init(-1, -100)
 
 		// Should handle negative values gracefully
-		if tracker.totalItems != -1 {
-			t.Errorf("Expected totalItems to be -1, got %d", tracker.totalItems)
+		if tracker.Snapshot().TotalItems != -1 {
+			t.Errorf("Expected totalItems to be -1, got %d", tracker.Snapshot().TotalItems)
 		}
-		if tracker.totalSize != -100 {
-			t.Errorf("Expected totalSize to be -100, got %d", tracker.totalSize)
+		if tracker.Snapshot().TotalSize != -100 {
+			t.Errorf("Expected totalSize to be -100, got %d", tracker.Snapshot().TotalSize)
 		}
 	})
 
@@ -338,11 +382,11 @@ func TestProgressTracker_EdgeCases(t *testing.T) {
 
 		tracker.Init(largeItems, largeSize)
 
-		if tracker.totalItems != largeItems {
-			t.Errorf("Expected totalItems to be %d, got %d", largeItems, tracker.totalItems)
+		if tracker.Snapshot().TotalItems != largeItems {
+			t.Errorf("Expected totalItems to be %d, got %d", largeItems, tracker.Snapshot().TotalItems)
 		}
-		if tracker.totalSize != largeSize {
-			t.Errorf("Expected totalSize to be %d, got %d", largeSize, tracker.totalSize)
+		if tracker.Snapshot().TotalSize != largeSize {
+			t.Errorf("Expected totalSize to be %d, got %d", largeSize, tracker.Snapshot().TotalSize)
 		}
 	})
 
@@ -351,8 +395,8 @@ func TestProgressTracker_EdgeCases(t *testing.T) {
 		tracker := NewProgressTracker(true)
 		tracker.SetCurrentFile("")
 
-		if tracker.currentFile != "" {
-			t.Errorf("Expected currentFile to be empty, got %s", tracker.currentFile)
+		if tracker.Snapshot().CurrentFile != "" {
+			t.Errorf("Expected currentFile to be empty, got %s", tracker.Snapshot().CurrentFile)
 		}
 	})
 
@@ -366,7 +410,7 @@ func TestProgressTracker_EdgeCases(t *testing.T) {
 
 		tracker.SetCurrentFile(longName)
 
-		if tracker.currentFile != longName {
+		if tracker.Snapshot().CurrentFile != longName {
 			t.Error("Expected currentFile to handle long names")
 		}
 	})
@@ -380,12 +424,12 @@ func TestProgressTracker_TimingBehavior(t *testing.T) {
 	tracker.Init(1, 100)
 
 	// The start time should be close to when we started
-	if time.Since(tracker.startTime) > time.Second {
+	if time.Since(tracker.Snapshot().StartTime) > time.Second {
 		t.Error("Start time should be recent")
 	}
 
 	// Start time should be after our recorded time
-	if tracker.startTime.Before(startTime) {
+	if tracker.Snapshot().StartTime.Before(startTime) {
 		t.Error("Start time should be after test start")
 	}
 }
@@ -400,16 +444,218 @@ func TestProgressTracker_MultipleInit(t *testing.T) {
 	// Second initialization should reset everything
 	tracker.Init(10, 1000)
 
-	if tracker.totalItems != 10 {
-		t.Errorf("Expected totalItems to be 10 after re-init, got %d", tracker.totalItems)
+	if tracker.Snapshot().TotalItems != 10 {
+		t.Errorf("Expected totalItems to be 10 after re-init, got %d", tracker.Snapshot().TotalItems)
+	}
+	if tracker.Snapshot().TotalSize != 1000 {
+		t.Errorf("Expected totalSize to be 1000 after re-init, got %d", tracker.Snapshot().TotalSize)
+	}
+	if tracker.Snapshot().CurrentItem != 0 {
+		t.Errorf("Expected currentItem to be 0 after re-init, got %d", tracker.Snapshot().CurrentItem)
 	}
-	if tracker.totalSize != 1000 {
-		t.Errorf("Expected totalSize to be 1000 after re-init, got %d", tracker.totalSize)
+	if tracker.Snapshot().ProcessedSize != 0 {
+		t.Errorf("Expected processedSize to be 0 after re-init, got %d", tracker.Snapshot().ProcessedSize)
 	}
-	if tracker.currentItem != 0 {
-		t.Errorf("Expected currentItem to be 0 after re-init, got %d", tracker.currentItem)
+}
+
+func TestProgressTracker_Percent(t *testing.T) {
+	tracker := NewProgressTracker(true)
+	if got := tracker.Percent(); got != 0 {
+		t.Errorf("Percent before Init = %v, want 0", got)
+	}
+
+	tracker.Init(4, 1000)
+	tracker.CompleteItem(250)
+	if got := tracker.Percent(); got != 25 {
+		t.Errorf("Percent = %v, want 25", got)
+	}
+
+	// Sizes can exceed the discovery estimate; never report more than 100%
+	tracker.CompleteItem(2000)
+	if got := tracker.Percent(); got != 100 {
+		t.Errorf("Percent = %v, want 100", got)
+	}
+
+	disabled := NewProgressTracker(false)
+	disabled.Init(4, 1000)
+	disabled.CompleteItem(500)
+	if got := disabled.Percent(); got != 0 {
+		t.Errorf("Disabled tracker Percent = %v, want 0", got)
+	}
+}
+
+func TestProgressTracker_Work(t *testing.T) {
+	tracker := NewProgressTracker(true)
+	tracker.Init(2, 1000)
+
+	work := tracker.StartWork(500)
+	work.Update(200)
+	if got := tracker.Percent(); got != 20 {
+		t.Errorf("Percent while running = %v, want 20", got)
+	}
+
+	// Growth beyond the expected total waits for the item to complete
+	work.Update(900)
+	if got := tracker.Percent(); got != 50 {
+		t.Errorf("Percent past the expected total = %v, want 50", got)
+	}
+
+	work.Done()
+	if s := tracker.Snapshot(); s.InFlightSize != 0 {
+		t.Errorf("InFlightSize after Done = %d, want 0", s.InFlightSize)
+	}
+	tracker.CompleteItem(600)
+	if got := tracker.Percent(); got != 60 {
+		t.Errorf("Percent after completion = %v, want 60", got)
+	}
+
+	disabled := NewProgressTracker(false)
+	disabled.StartWork(100).Update(50)
+	if s := disabled.Snapshot(); s.InFlightSize != 0 {
+		t.Errorf("Disabled tracker counted %d in-flight bytes", s.InFlightSize)
+	}
+}
+
+func TestFitLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		width int
+		want  string
+	}{
+		{"Padded", "[██░░] 50%", 15, "[██░░] 50%    "},
+		{"Truncated", "[██░░] 50% | file.db", 15, "[██░░] 50% ..."},
+		{"Wide characters", "| 数据库备份", 10, "| 数据..."},
+		{"Unknown width", "line", 0, "line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitLine(tt.line, tt.width); got != tt.want {
+				t.Errorf("fitLine(%q, %d) = %q, want %q", tt.line, tt.width, got, tt.want)
+			}
+		})
 	}
-	if tracker.processedSize != 0 {
-		t.Errorf("Expected processedSize to be 0 after re-init, got %d", tracker.processedSize)
+}
+
+func TestLayoutLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		available int
+		fileName  string
+		wantBar   int
+		wantFile  int
+	}{
+		{"Wide terminal", 120, "app.db", 40, 77},
+		{"Bar shrinks for the file name", 50, "a_rather_long_database_file_name.db", 17, 30},
+		{"Minimum bar", 20, "a_rather_long_database_file_name.db", 10, 7},
+		{"Too narrow for the file name", 11, "app.db", 10, 0},
+		{"No file", 30, "", 30, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bar, file := layoutLine(tt.available, tt.fileName)
+			if bar != tt.wantBar || file != tt.wantFile {
+				t.Errorf("layoutLine(%d, %q) = (%d, %d), want (%d, %d)", tt.available, tt.fileName, bar, file, tt.wantBar, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestRenderBar(t *testing.T) {
+	if got := renderBar(50, 10); got != "█████░░░░░" {
+		t.Errorf("renderBar(50, 10) = %q", got)
+	}
+	if got := renderBar(150, 4); got != "████" {
+		t.Errorf("renderBar(150, 4) = %q", got)
+	}
+}
+
+// frameRecorder records each write to the progress output
+type frameRecorder struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (r *frameRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func (r *frameRecorder) frames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.writes...)
+}
+
+func TestProgressTracker_RenderLoop(t *testing.T) {
+	var out frameRecorder
+	tracker := NewProgressTracker(true)
+	tracker.SetOutput(&out)
+	tracker.Init(40, 4000)
+
+	// Workers only publish; none of them writes to the output
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				tracker.SetCurrentFile(fmt.Sprintf("worker_%d_%d.db", id, j))
+				tracker.UpdateRocksDBProgress(int64(j+1)*5000, 0)
+				tracker.CompleteItem(100)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The render goroutine draws without any further updates
+	deadline := time.Now().Add(2 * time.Second)
+	for len(out.frames()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	frames := out.frames()
+	if len(frames) == 0 {
+		t.Fatal("Expected the render loop to draw a frame")
+	}
+	if last := frames[len(frames)-1]; !strings.Contains(last, "(40/40)") || !strings.Contains(last, "records") {
+		t.Errorf("Expected the frame to show all items and the running record copy, got %q", last)
+	}
+
+	tracker.Finish()
+	frames = out.frames()
+	for _, frame := range frames[:len(frames)-1] {
+		if !strings.HasPrefix(frame, "\r") {
+			t.Errorf("Expected each frame to be one complete line redraw, got %q", frame)
+		}
+	}
+
+	// Nothing is drawn after Finish
+	time.Sleep(3 * time.Second / 10)
+	if after := out.frames(); len(after) != len(frames) {
+		t.Errorf("Expected no frames after Finish, got %d more", len(after)-len(frames))
+	}
+}
+
+func TestProgressTracker_Stop(t *testing.T) {
+	var out frameRecorder
+	tracker := NewProgressTracker(true)
+	tracker.SetOutput(&out)
+	tracker.Init(1, 100)
+	tracker.Stop()
+	tracker.Stop()
+
+	drawn := len(out.frames())
+	time.Sleep(3 * time.Second / 10)
+	if len(out.frames()) != drawn {
+		t.Error("Expected no frames after Stop")
+	}
+	for _, frame := range out.frames() {
+		if strings.Contains(frame, "Completed") {
+			t.Errorf("Stop must not print a summary, got %q", frame)
+		}
 	}
 }
@@ -0,0 +1,176 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// CheckFunc inspects an extracted backup before it is moved into place;
+// returning an error aborts the restore
+type CheckFunc func(dir string) error
+
+// ExtractFunc writes a backup into dir, which does not exist yet. It lets
+// backups that are not archives, such as mirrors, be restored the same way.
+type ExtractFunc func(dir string) error
+
+// RestoreArchive restores an archive into targetDir, which must not exist or
+// be empty. The archive is extracted into <target>.new, checked against its
+// footer and by check (which may be nil), and only then renamed into place.
+// archivePath may also be a per-item archive directory, or a legacy archive
+// without a footer, which gets a reconstructed manifest.
+func RestoreArchive(archivePath, targetDir string, check CheckFunc) error {
+	return RestoreItems(archivePath, targetDir, nil, check)
+}
+
+// RestoreItems is RestoreArchive for a subset of the items of a per-item
+// archive; only their members and the root member are extracted. An empty
+// items restores everything.
+func RestoreItems(archivePath, targetDir string, items []string, check CheckFunc) error {
+	return RestoreExtracted(targetDir, archiveExtractor(archivePath, items), check)
+}
+
+// RestoreExtracted is RestoreArchive for a backup that extract writes into
+// the staging directory
+func RestoreExtracted(targetDir string, extract ExtractFunc, check CheckFunc) error {
+	targetDir = filepath.Clean(targetDir)
+	if entries, err := os.ReadDir(targetDir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty; use -swap to replace a live directory", targetDir)
+	}
+
+	newDir, err := stage(targetDir, extract, check)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(targetDir); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(newDir)
+		return fmt.Errorf("failed to replace empty %s: %v", targetDir, err)
+	}
+	if err := os.Rename(newDir, targetDir); err != nil {
+		return fmt.Errorf("failed to move %s into place: %v", newDir, err)
+	}
+	return syncParent(targetDir)
+}
+
+// SwapRestoreArchive restores an archive next to the live directory and
+// swaps it in: the archive is extracted and verified into <target>.new, the
+// live directory is renamed to <target>.old and the new one takes its place.
+// The two renames keep the window without a directory at targetDir minimal,
+// and <target>.old allows an instant rollback (see RollbackSwap). It returns
+// the path of the rollback copy, or "" when targetDir did not exist yet.
+func SwapRestoreArchive(archivePath, targetDir string, check CheckFunc) (string, error) {
+	return SwapRestoreExtracted(targetDir, archiveExtractor(archivePath, nil), check)
+}
+
+// SwapRestoreExtracted is SwapRestoreArchive for a backup that extract
+// writes into the staging directory
+func SwapRestoreExtracted(targetDir string, extract ExtractFunc, check CheckFunc) (string, error) {
+	targetDir = filepath.Clean(targetDir)
+	oldDir := targetDir + constants.SwapOldSuffix
+
+	newDir, err := stage(targetDir, extract, check)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+		if err := os.Rename(newDir, targetDir); err != nil {
+			return "", fmt.Errorf("failed to move %s into place: %v", newDir, err)
+		}
+		return "", syncParent(targetDir)
+	}
+
+	// Only the latest rollback copy is kept
+	if err := os.RemoveAll(oldDir); err != nil {
+		return "", fmt.Errorf("failed to remove previous rollback copy %s: %v", oldDir, err)
+	}
+	if err := os.Rename(targetDir, oldDir); err != nil {
+		return "", fmt.Errorf("failed to move live directory aside: %v", err)
+	}
+	if err := os.Rename(newDir, targetDir); err != nil {
+		if undoErr := os.Rename(oldDir, targetDir); undoErr != nil {
+			return "", fmt.Errorf("failed to move %s into place: %v; live directory is at %s (%v)", newDir, err, oldDir, undoErr)
+		}
+		return "", fmt.Errorf("failed to move %s into place, live directory restored: %v", newDir, err)
+	}
+	return oldDir, syncParent(targetDir)
+}
+
+// archiveExtractor returns the ExtractFunc extracting items (all if empty)
+// of an archive, which is checked against its footer
+func archiveExtractor(archivePath string, items []string) ExtractFunc {
+	return func(dir string) error {
+		switch {
+		case compress.IsIndexed(archivePath):
+			return compress.ExtractIndexed(archivePath, dir, items)
+		case len(items) > 0:
+			return fmt.Errorf("%s is not a per-item archive; items cannot be restored selectively", archivePath)
+		case compress.IsLegacy(archivePath):
+			return extractLegacy(archivePath, dir)
+		default:
+			_, err := compress.ExtractArchive(archivePath, dir)
+			return err
+		}
+	}
+}
+
+// stage extracts a backup into <target>.new, verifies and syncs it and
+// returns its path. Nothing is left behind on failure.
+func stage(targetDir string, extract ExtractFunc, check CheckFunc) (string, error) {
+	newDir := targetDir + constants.SwapNewSuffix
+
+	// A staging directory left by an interrupted restore is ours to replace
+	if err := os.RemoveAll(newDir); err != nil {
+		return "", fmt.Errorf("failed to remove stale %s: %v", newDir, err)
+	}
+	if err := extract(newDir); err != nil {
+		os.RemoveAll(newDir)
+		return "", fmt.Errorf("restore into %s failed, %s left untouched: %w", newDir, targetDir, err)
+	}
+	if check != nil {
+		if err := check(newDir); err != nil {
+			os.RemoveAll(newDir)
+			return "", err
+		}
+	}
+	if err := utils.SyncTree(newDir, true); err != nil {
+		os.RemoveAll(newDir)
+		return "", err
+	}
+	return newDir, nil
+}
+
+// RollbackSwap undoes a swap restore by exchanging targetDir and
+// <target>.old, so running it twice restores the swapped-in data again
+func RollbackSwap(targetDir string) error {
+	targetDir = filepath.Clean(targetDir)
+	oldDir := targetDir + constants.SwapOldSuffix
+	if _, err := os.Stat(oldDir); err != nil {
+		return fmt.Errorf("no rollback copy at %s: %v", oldDir, err)
+	}
+
+	tempDir := targetDir + constants.SwapNewSuffix
+	if err := os.RemoveAll(tempDir); err != nil {
+		return fmt.Errorf("failed to remove stale %s: %v", tempDir, err)
+	}
+	if err := os.Rename(targetDir, tempDir); err != nil {
+		return fmt.Errorf("failed to move live directory aside: %v", err)
+	}
+	if err := os.Rename(oldDir, targetDir); err != nil {
+		os.Rename(tempDir, targetDir)
+		return fmt.Errorf("failed to move %s into place: %v", oldDir, err)
+	}
+	if err := os.Rename(tempDir, oldDir); err != nil {
+		return fmt.Errorf("rolled back, but the replaced directory was left at %s: %v", tempDir, err)
+	}
+	return syncParent(targetDir)
+}
+
+// syncParent makes the renames in the directory containing path durable
+func syncParent(path string) error {
+	return utils.SyncDir(filepath.Dir(path))
+}
@@ -0,0 +1,118 @@
+package restore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/constants"
+)
+
+// createRestoreTestArchive archives a directory holding one file with the
+// given content
+func createRestoreTestArchive(t *testing.T, dir, content string) string {
+	t.Helper()
+	sourceDir := filepath.Join(dir, "source_"+content)
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "data.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := sourceDir + ".tar.gz"
+	if err := compress.CompressDirectory(sourceDir, archivePath); err != nil {
+		t.Fatalf("CompressDirectory failed: %v", err)
+	}
+	return archivePath
+}
+
+func readData(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "data.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	return string(data)
+}
+
+func TestRestoreArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	archivePath := createRestoreTestArchive(t, tempDir, "v1")
+	targetDir := filepath.Join(tempDir, "live")
+
+	if err := RestoreArchive(archivePath, targetDir, nil); err != nil {
+		t.Fatalf("RestoreArchive failed: %v", err)
+	}
+	if got := readData(t, targetDir); got != "v1" {
+		t.Errorf("Restored data = %q, want v1", got)
+	}
+
+	if err := RestoreArchive(archivePath, targetDir, nil); err == nil {
+		t.Error("Expected RestoreArchive to refuse a non-empty target")
+	}
+}
+
+func TestSwapRestoreArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	targetDir := filepath.Join(tempDir, "live")
+
+	// Into a directory that does not exist yet
+	oldDir, err := SwapRestoreArchive(createRestoreTestArchive(t, tempDir, "v1"), targetDir, nil)
+	if err != nil || oldDir != "" {
+		t.Fatalf("SwapRestoreArchive() = %q, %v", oldDir, err)
+	}
+
+	// Over the live directory
+	oldDir, err = SwapRestoreArchive(createRestoreTestArchive(t, tempDir, "v2"), targetDir, nil)
+	if err != nil {
+		t.Fatalf("SwapRestoreArchive failed: %v", err)
+	}
+	if oldDir != targetDir+constants.SwapOldSuffix {
+		t.Errorf("oldDir = %q, want %q", oldDir, targetDir+constants.SwapOldSuffix)
+	}
+	if got := readData(t, targetDir); got != "v2" {
+		t.Errorf("Live data = %q, want v2", got)
+	}
+	if got := readData(t, oldDir); got != "v1" {
+		t.Errorf("Rollback copy = %q, want v1", got)
+	}
+	if _, err := os.Stat(targetDir + constants.SwapNewSuffix); !os.IsNotExist(err) {
+		t.Errorf("Staging directory should be gone, stat error: %v", err)
+	}
+
+	// A bad archive leaves the live directory alone
+	if _, err := SwapRestoreArchive(filepath.Join(tempDir, "missing.tar.gz"), targetDir, nil); err == nil {
+		t.Error("Expected an error for a missing archive")
+	}
+	if got := readData(t, targetDir); got != "v2" {
+		t.Errorf("Live data after failed restore = %q, want v2", got)
+	}
+
+	// A failed check leaves the live directory alone
+	reject := func(dir string) error { return errors.New("rejected") }
+	if _, err := SwapRestoreArchive(createRestoreTestArchive(t, tempDir, "v3"), targetDir, reject); err == nil {
+		t.Error("Expected the check to abort the restore")
+	}
+	if got := readData(t, targetDir); got != "v2" {
+		t.Errorf("Live data after rejected restore = %q, want v2", got)
+	}
+	if _, err := os.Stat(targetDir + constants.SwapNewSuffix); !os.IsNotExist(err) {
+		t.Errorf("Staging directory should be removed, stat error: %v", err)
+	}
+
+	// Rolling back twice returns to the swapped-in data
+	if err := RollbackSwap(targetDir); err != nil {
+		t.Fatalf("RollbackSwap failed: %v", err)
+	}
+	if got := readData(t, targetDir); got != "v1" {
+		t.Errorf("Live data after rollback = %q, want v1", got)
+	}
+	if err := RollbackSwap(targetDir); err != nil {
+		t.Fatalf("Second RollbackSwap failed: %v", err)
+	}
+	if got := readData(t, targetDir); got != "v2" {
+		t.Errorf("Live data after second rollback = %q, want v2", got)
+	}
+}
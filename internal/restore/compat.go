@@ -0,0 +1,100 @@
+package restore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// maxSQLiteSchemaFormat is the newest schema format number SQLite defines
+const maxSQLiteSchemaFormat = 4
+
+// Environment describes the libraries that will open the restored databases
+type Environment struct {
+	SQLiteVersion  string // SQLite library version ("" = not checked)
+	RocksDBVersion string // RocksDB release version ("" = not checked)
+}
+
+// CurrentEnvironment returns the SQLite version linked into this binary. The
+// RocksDB bindings do not report a version, so it is left for the caller.
+func CurrentEnvironment() Environment {
+	version, _, _ := sqlite3.Version()
+	return Environment{SQLiteVersion: version}
+}
+
+// CheckCompatibility lists the ways a backup needs newer libraries than env
+// provides. Databases written by a newer release may use format features
+// an older one cannot read, which otherwise only shows up as a cryptic
+// error when the application opens them.
+func CheckCompatibility(m *manifest.Manifest, env Environment) []string {
+	var problems []string
+	sqliteChecked := false
+	for _, item := range m.Items {
+		if item.Status != manifest.StatusOK {
+			continue
+		}
+		switch item.Type {
+		case types.DatabaseTypeSQLite.String():
+			if item.SchemaFormat > maxSQLiteSchemaFormat {
+				problems = append(problems, fmt.Sprintf("%s uses SQLite schema format %d, newer than any known release", item.Name, item.SchemaFormat))
+			}
+			if !sqliteChecked && env.SQLiteVersion != "" && compareVersions(m.SQLiteVersion, env.SQLiteVersion) > 0 {
+				problems = append(problems, fmt.Sprintf("SQLite databases were written by SQLite %s, this host has %s", m.SQLiteVersion, env.SQLiteVersion))
+			}
+			sqliteChecked = true
+		case types.DatabaseTypeRocksDB.String():
+			if env.RocksDBVersion != "" && compareVersions(item.RocksDBVersion, env.RocksDBVersion) > 0 {
+				problems = append(problems, fmt.Sprintf("%s was written by RocksDB %s (table format_version %d), this host has %s",
+					item.Name, item.RocksDBVersion, item.FormatVersion, env.RocksDBVersion))
+			}
+		}
+	}
+	return problems
+}
+
+// compareVersions compares dotted version numbers such as 3.45.1, returning
+// -1, 0 or 1. An empty or unparsable version compares as equal to anything.
+func compareVersions(a, b string) int {
+	partsA, okA := parseVersion(a)
+	partsB, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0
+	}
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x = partsA[i]
+		}
+		if i < len(partsB) {
+			y = partsB[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion splits a dotted version into its numbers
+func parseVersion(version string) ([]int, bool) {
+	if version == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
@@ -0,0 +1,47 @@
+package restore
+
+import (
+	"testing"
+
+	"archiveFiles/internal/manifest"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"3.45.1", "3.45.1", 0},
+		{"3.45.1", "3.9.0", 1},
+		{"8.1", "8.1.1", -1},
+		{"", "9.0.0", 0},
+		{"8.x", "9.0.0", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	m := &manifest.Manifest{
+		SQLiteVersion: "3.45.1",
+		Items: []manifest.Item{
+			{Name: "a.db", Type: "SQLite", Status: manifest.StatusOK, SchemaFormat: 4},
+			{Name: "b.db", Type: "SQLite", Status: manifest.StatusOK, SchemaFormat: 4},
+			{Name: "kv", Type: "RocksDB", Status: manifest.StatusOK, RocksDBVersion: "9.1.0", FormatVersion: 6},
+			{Name: "failed", Type: "RocksDB", Status: manifest.StatusFailed, RocksDBVersion: "99.0.0"},
+		},
+	}
+
+	if problems := CheckCompatibility(m, Environment{SQLiteVersion: "3.46.0", RocksDBVersion: "9.1.0"}); len(problems) != 0 {
+		t.Errorf("Expected no problems on a newer host, got %q", problems)
+	}
+	if problems := CheckCompatibility(m, Environment{SQLiteVersion: "3.31.1"}); len(problems) != 1 {
+		t.Errorf("Expected one SQLite problem, got %q", problems)
+	}
+	if problems := CheckCompatibility(m, Environment{RocksDBVersion: "8.1.1"}); len(problems) != 1 {
+		t.Errorf("Expected one RocksDB problem, got %q", problems)
+	}
+}
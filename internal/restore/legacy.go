@@ -0,0 +1,99 @@
+package restore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+)
+
+// legacyMethod is the method recorded in a reconstructed manifest; the
+// archive does not say which one was used
+const legacyMethod = "unknown"
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// LegacyManifest reconstructs a best-effort manifest from the entries of a
+// legacy archive. The old layout stored each item at <source>/<name>, where
+// source is the base name of the scanned root, so every entry two levels
+// deep is an item and anything below it belongs to that item. Types are
+// inferred from the content: a directory holding a CURRENT file is RocksDB,
+// a file with the SQLite header is SQLite and a .log file a log file.
+// Source paths and sizes at discovery are unknown; the backup is dated by
+// its newest entry.
+func LegacyManifest(entries []compress.LegacyEntry) *manifest.Manifest {
+	m := manifest.New(legacyMethod)
+	m.Reconstructed = true
+
+	var newest time.Time
+	items := make(map[string]*manifest.Item)
+	var order []string
+	for _, entry := range entries {
+		if entry.ModTime.After(newest) {
+			newest = entry.ModTime
+		}
+		parts := strings.SplitN(entry.Name, "/", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		backupPath := path.Join(parts[0], parts[1])
+		item, ok := items[backupPath]
+		if !ok {
+			item = &manifest.Item{
+				Name:       parts[1],
+				Type:       types.DatabaseTypeUnknown.String(),
+				SourceRoot: parts[0],
+				BackupPath: backupPath,
+				Status:     manifest.StatusOK,
+			}
+			items[backupPath] = item
+			order = append(order, backupPath)
+		}
+		if !entry.IsDir {
+			item.BackupSize += entry.Size
+		}
+
+		switch {
+		case len(parts) == 3 && parts[2] == "CURRENT":
+			item.Type = types.DatabaseTypeRocksDB.String()
+		case len(parts) == 2 && !entry.IsDir && bytes.HasPrefix(entry.Head, sqliteHeader):
+			item.Type = types.DatabaseTypeSQLite.String()
+		case len(parts) == 2 && !entry.IsDir && strings.HasSuffix(entry.Name, ".log"):
+			item.Type = types.DatabaseTypeLogFile.String()
+		}
+	}
+
+	if !newest.IsZero() {
+		m.CreatedAt = newest.UTC()
+	}
+	for _, backupPath := range order {
+		m.AddItem(*items[backupPath])
+	}
+	return m
+}
+
+// extractLegacy unpacks a legacy archive into dir and writes the
+// reconstructed manifest next to the items, so the restored tree looks like
+// one written by the current version
+func extractLegacy(archivePath, dir string) error {
+	entries, err := compress.ExtractLegacy(archivePath, dir)
+	if err != nil {
+		return err
+	}
+	manifestPath := filepath.Join(dir, manifest.FileName)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return nil
+	}
+	if err := LegacyManifest(entries).Write(manifestPath); err != nil {
+		return fmt.Errorf("failed to write reconstructed manifest: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package restore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/compress"
+	"archiveFiles/internal/manifest"
+	"archiveFiles/internal/types"
+)
+
+func TestLegacyManifest(t *testing.T) {
+	modTime := time.Date(2023, 5, 1, 2, 0, 0, 0, time.UTC)
+	entries := []compress.LegacyEntry{
+		{Name: "data", IsDir: true},
+		{Name: "data/app.db", IsDir: true},
+		{Name: "data/app.db/CURRENT", Size: 16},
+		{Name: "data/app.db/000001.sst", Size: 100, ModTime: modTime},
+		{Name: "data/users.db", Size: 4096, Head: []byte("SQLite format 3\x00")},
+		{Name: "logs", IsDir: true},
+		{Name: "logs/server.log", Size: 9, Head: []byte("log line\n")},
+		{Name: "logs/blob.bin", Size: 3, Head: []byte("abc")},
+	}
+
+	m := LegacyManifest(entries)
+	if !m.Reconstructed || !m.CreatedAt.Equal(modTime) {
+		t.Errorf("Manifest = reconstructed %v, created %v", m.Reconstructed, m.CreatedAt)
+	}
+	want := map[string]struct {
+		typ  string
+		size int64
+	}{
+		"data/app.db":     {types.DatabaseTypeRocksDB.String(), 116},
+		"data/users.db":   {types.DatabaseTypeSQLite.String(), 4096},
+		"logs/server.log": {types.DatabaseTypeLogFile.String(), 9},
+		"logs/blob.bin":   {types.DatabaseTypeUnknown.String(), 3},
+	}
+	if len(m.Items) != len(want) {
+		t.Fatalf("Got %d items, want %d: %+v", len(m.Items), len(want), m.Items)
+	}
+	for _, item := range m.Items {
+		w, ok := want[item.BackupPath]
+		if !ok || item.Type != w.typ || item.BackupSize != w.size || item.Status != manifest.StatusOK {
+			t.Errorf("Item %s = type %s, size %d, status %s", item.BackupPath, item.Type, item.BackupSize, item.Status)
+		}
+	}
+}
+
+func TestRestoreArchive_Legacy(t *testing.T) {
+	tempDir := t.TempDir()
+	archivePath := filepath.Join(tempDir, "legacy.tar.gz")
+
+	// One gzip member without a footer, as archives were written before
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range []*tar.Header{
+		{Name: ".", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "data", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "data/users.db", Typeflag: tar.TypeReg, Mode: 0644, Size: 21},
+	} {
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Write([]byte("SQLite format 3\x00users"))
+	tarWriter.Close()
+	gzipWriter.Close()
+	file.Close()
+
+	targetDir := filepath.Join(tempDir, "live")
+	if err := RestoreArchive(archivePath, targetDir, nil); err != nil {
+		t.Fatalf("RestoreArchive of a legacy archive failed: %v", err)
+	}
+	m, err := manifest.Load(filepath.Join(targetDir, manifest.FileName))
+	if err != nil {
+		t.Fatalf("No reconstructed manifest: %v", err)
+	}
+	if len(m.Items) != 1 || m.Items[0].BackupPath != "data/users.db" || m.Items[0].Type != types.DatabaseTypeSQLite.String() {
+		t.Errorf("Reconstructed items = %+v", m.Items)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "data", "users.db")); err != nil {
+		t.Errorf("users.db was not restored: %v", err)
+	}
+}
@@ -2,6 +2,9 @@ package restore
 
 import (
 	"fmt"
+	"strings"
+
+	"archiveFiles/internal/apperr"
 
 	"github.com/linxGnu/grocksdb"
 )
@@ -13,7 +16,7 @@ func RestoreBackupToPlain(backupDir, restoreDir string) error {
 
 	backupEngine, err := grocksdb.OpenBackupEngine(opts, backupDir)
 	if err != nil {
-		return fmt.Errorf("failed to open backup engine: %v", err)
+		return classify(err, "failed to open backup engine")
 	}
 	defer backupEngine.Close()
 
@@ -23,8 +26,22 @@ func RestoreBackupToPlain(backupDir, restoreDir string) error {
 	// Restore latest backup
 	err = backupEngine.RestoreDBFromLatestBackup(restoreDir, restoreDir, restoreOpts)
 	if err != nil {
-		return fmt.Errorf("failed to restore backup: %v", err)
+		return classify(err, "failed to restore backup")
 	}
 
 	return nil
 }
+
+// classify gives a RocksDB error its failure kind, recognized from the
+// status prefix RocksDB puts in front of every message
+func classify(err error, msg string) error {
+	status := err.Error()
+	switch {
+	case strings.HasPrefix(status, "Corruption:"):
+		return apperr.Wrap(apperr.ErrCorrupt, err, msg)
+	case strings.Contains(status, "lock file"):
+		return apperr.Wrap(apperr.ErrLocked, err, msg)
+	default:
+		return fmt.Errorf("%s: %v", msg, err)
+	}
+}
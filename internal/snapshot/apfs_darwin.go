@@ -0,0 +1,78 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/utils"
+)
+
+// VolumeOf returns the mount point of the volume holding path
+func VolumeOf(path string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", fmt.Errorf("failed to stat filesystem of %s: %v", path, err)
+	}
+	var name []byte
+	for _, c := range stat.Mntonname {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
+
+// CreateAPFS takes a local APFS snapshot with tmutil and mounts the copy of
+// volume read-only. Mounting a snapshot requires root.
+func CreateAPFS(ctx context.Context, volume string) (*Snapshot, error) {
+	output, err := runCommand(ctx, "tmutil", "localsnapshot")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create APFS snapshot: %v", err)
+	}
+	date, err := parseSnapshotDate(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create APFS snapshot: %v", err)
+	}
+	snap := &Snapshot{Name: snapshotName(date), Volume: volume, date: date}
+
+	snap.MountPoint, err = utils.MkdirTemp(constants.TmpPrefix + "snapshot-")
+	if err != nil {
+		snap.delete()
+		return nil, fmt.Errorf("failed to create snapshot mount point: %v", err)
+	}
+	if _, err := runCommand(ctx, "mount_apfs", "-o", "rdonly,nobrowse", "-s", snap.Name, volume, snap.MountPoint); err != nil {
+		os.Remove(snap.MountPoint)
+		snap.delete()
+		return nil, fmt.Errorf("failed to mount APFS snapshot %s: %v", snap.Name, err)
+	}
+	log.Info("Mounted APFS snapshot %s of %s at %s", snap.Name, volume, snap.MountPoint)
+	return snap, nil
+}
+
+// Release unmounts the snapshot and deletes it. Snapshots left behind are
+// purged by macOS when space runs low, but would pin deleted data until then.
+func (s *Snapshot) Release() error {
+	// Clean up even if the run was cancelled
+	ctx := context.Background()
+	if _, err := runCommand(ctx, "umount", s.MountPoint); err != nil {
+		return fmt.Errorf("failed to unmount APFS snapshot %s: %v", s.Name, err)
+	}
+	os.Remove(s.MountPoint)
+	if err := s.delete(); err != nil {
+		return err
+	}
+	log.Info("Released APFS snapshot %s", s.Name)
+	return nil
+}
+
+// delete removes the snapshot from the volume
+func (s *Snapshot) delete() error {
+	if _, err := runCommand(context.Background(), "tmutil", "deletelocalsnapshots", s.date); err != nil {
+		return fmt.Errorf("failed to delete APFS snapshot %s: %v", s.Name, err)
+	}
+	return nil
+}
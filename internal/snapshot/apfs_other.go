@@ -0,0 +1,23 @@
+//go:build !darwin
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+)
+
+// VolumeOf returns the mount point of the volume holding path
+func VolumeOf(path string) (string, error) {
+	return "", fmt.Errorf("APFS snapshots are only available on macOS")
+}
+
+// CreateAPFS is only available on macOS
+func CreateAPFS(ctx context.Context, volume string) (*Snapshot, error) {
+	return nil, fmt.Errorf("APFS snapshots are only available on macOS")
+}
+
+// Release is a no-op where snapshots cannot be created
+func (s *Snapshot) Release() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"archiveFiles/internal/logger"
+)
+
+var log = logger.NewModule("snapshot")
+
+// Snapshot is a read-only, point-in-time copy of a volume, mounted so that
+// databases can be copied from it while applications keep writing to the
+// live volume
+type Snapshot struct {
+	Name       string // Snapshot name, e.g. com.apple.TimeMachine.2024-01-15-123456.local
+	Volume     string // Mount point of the snapshotted volume
+	MountPoint string // Directory the snapshot is mounted on
+
+	date string // tmutil snapshot date, used to delete the snapshot
+}
+
+// Path maps a path on the live volume to the same path inside the snapshot
+func (s *Snapshot) Path(path string) (string, error) {
+	return mapPath(s.Volume, s.MountPoint, path)
+}
+
+// runCommand runs an external tool and returns its combined output.
+// Replaced in tests.
+var runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return output, nil
+}
+
+// snapshotDatePattern matches the line tmutil localsnapshot prints for the
+// snapshot it created
+var snapshotDatePattern = regexp.MustCompile(`Created local snapshot with date: (\S+)`)
+
+// parseSnapshotDate extracts the snapshot date from tmutil localsnapshot
+// output
+func parseSnapshotDate(output string) (string, error) {
+	match := snapshotDatePattern.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("unexpected tmutil output: %s", strings.TrimSpace(output))
+	}
+	return match[1], nil
+}
+
+// snapshotName returns the name of the local Time Machine snapshot taken at date
+func snapshotName(date string) string {
+	return "com.apple.TimeMachine." + date + ".local"
+}
+
+// mapPath maps path on the volume mounted at volume to mountPoint. Paths
+// outside the volume's mount point are taken relative to the root: on macOS
+// firmlinks make the Data volume's directories (/Users, /Applications, ...)
+// appear at the top of the filesystem.
+func mapPath(volume, mountPoint, path string) (string, error) {
+	path = filepath.Clean(path)
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("snapshot paths must be absolute: %s", path)
+	}
+
+	rel, err := filepath.Rel(filepath.Clean(volume), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = strings.TrimPrefix(path, string(filepath.Separator))
+	}
+	return filepath.Join(mountPoint, rel), nil
+}
@@ -0,0 +1,50 @@
+package snapshot
+
+import "testing"
+
+func TestParseSnapshotDate(t *testing.T) {
+	output := "NOTE: local snapshots are considered purgeable and may be removed at any time by deleted(8).\nCreated local snapshot with date: 2024-01-15-123456\n"
+	date, err := parseSnapshotDate(output)
+	if err != nil {
+		t.Fatalf("parseSnapshotDate failed: %v", err)
+	}
+	if date != "2024-01-15-123456" {
+		t.Errorf("Expected date 2024-01-15-123456, got %s", date)
+	}
+	if name := snapshotName(date); name != "com.apple.TimeMachine.2024-01-15-123456.local" {
+		t.Errorf("Unexpected snapshot name %s", name)
+	}
+
+	if _, err := parseSnapshotDate("Failed to create local snapshot"); err == nil {
+		t.Error("Expected an error for output without a snapshot date")
+	}
+}
+
+func TestMapPath(t *testing.T) {
+	tests := []struct {
+		volume string
+		path   string
+		want   string
+	}{
+		{"/Volumes/Work", "/Volumes/Work/db/app.sqlite", "/mnt/snap/db/app.sqlite"},
+		{"/Volumes/Work", "/Volumes/Work", "/mnt/snap"},
+		// Firmlinked Data volume directories appear at the root
+		{"/System/Volumes/Data", "/Users/dev/Library/app/rocksdb", "/mnt/snap/Users/dev/Library/app/rocksdb"},
+		{"/System/Volumes/Data", "/System/Volumes/Data/Users/dev", "/mnt/snap/Users/dev"},
+		{"/", "/opt/data/../db", "/mnt/snap/opt/db"},
+	}
+	for _, tt := range tests {
+		got, err := mapPath(tt.volume, "/mnt/snap", tt.path)
+		if err != nil {
+			t.Errorf("mapPath(%s, %s) failed: %v", tt.volume, tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("mapPath(%s, %s) = %s, want %s", tt.volume, tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := mapPath("/", "/mnt/snap", "relative/db"); err == nil {
+		t.Error("Expected an error for a relative path")
+	}
+}
@@ -0,0 +1,159 @@
+// Package sqlitedb opens SQLite databases for the other packages. Every
+// connection uses the same busy timeout and URI parameters, and the number
+// of connections open at once is bounded, so backing up many SQLite sources
+// concurrently cannot run out of file descriptors.
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"archiveFiles/internal/constants"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Mode is how a database is opened
+type Mode int
+
+const (
+	ReadOnly  Mode = iota // Live database another process may write to
+	Immutable             // File nothing writes to, e.g. a finished backup; skips locking entirely
+	ReadWrite             // Existing database that is written to
+	Create                // Database that is created if it does not exist
+)
+
+// DB is a database handle holding one connection slot until it is closed
+type DB struct {
+	*sql.DB
+	releaseOnce sync.Once
+}
+
+// Close closes the database and frees its connection slot
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	db.releaseOnce.Do(func() { slots.release(1) })
+	return err
+}
+
+// Open opens the database at path, waiting while the maximum number of
+// connections is open
+func Open(path string, mode Mode) (*DB, error) {
+	slots.acquire(1)
+	db, err := open(path, mode)
+	if err != nil {
+		slots.release(1)
+	}
+	return db, err
+}
+
+// OpenPair opens two databases, e.g. the source and target of a copy. Their
+// slots are taken together, so concurrent copies cannot each hold one slot
+// while waiting for another.
+func OpenPair(firstPath string, firstMode Mode, secondPath string, secondMode Mode) (*DB, *DB, error) {
+	slots.acquire(2)
+	first, err := open(firstPath, firstMode)
+	if err != nil {
+		slots.release(2)
+		return nil, nil, err
+	}
+	second, err := open(secondPath, secondMode)
+	if err != nil {
+		first.Close()
+		slots.release(1)
+		return nil, nil, err
+	}
+	return first, second, nil
+}
+
+// open opens one connection without taking a slot
+func open(path string, mode Mode) (*DB, error) {
+	db, err := sql.Open("sqlite3", DSN(path, mode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	// One connection per handle, so handles count connections
+	db.SetMaxOpenConns(1)
+	return &DB{DB: db}, nil
+}
+
+// DSN returns the connection string for path in mode. The path is escaped
+// so that '?', '#' and '%' in file names are not taken as URI syntax.
+func DSN(path string, mode Mode) string {
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+	busyTimeout := fmt.Sprintf("_busy_timeout=%d", constants.SQLiteBusyTimeoutMs)
+	switch mode {
+	case Immutable:
+		return "file:" + escaped + "?mode=ro&immutable=1"
+	case ReadWrite:
+		return "file:" + escaped + "?mode=rw&" + busyTimeout
+	case Create:
+		return "file:" + escaped + "?mode=rwc&" + busyTimeout
+	default:
+		return "file:" + escaped + "?mode=ro&" + busyTimeout
+	}
+}
+
+// SetMaxConnections sets how many connections may be open at once
+// (0 = constants.DefaultSQLiteMaxConnections). Values below 2 are raised to
+// 2, which OpenPair needs.
+func SetMaxConnections(n int) {
+	if n == 0 {
+		n = constants.DefaultSQLiteMaxConnections
+	}
+	if n < 2 {
+		n = 2
+	}
+	slots.setLimit(n)
+}
+
+// slots limits open connections
+var slots = newSemaphore(constants.DefaultSQLiteMaxConnections)
+
+// semaphore is a counting semaphore whose slots can be taken several at a
+// time, atomically
+type semaphore struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+	used  int
+}
+
+func newSemaphore(limit int) *semaphore {
+	s := &semaphore{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *semaphore) acquire(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.used+n > s.limit {
+		s.cond.Wait()
+	}
+	s.used += n
+}
+
+func (s *semaphore) release(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+	s.cond.Broadcast()
+}
+
+// setLimit changes the limit; connections already open stay open
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.cond.Broadcast()
+}
+
+// inUse returns the number of open connections
+func (s *semaphore) inUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
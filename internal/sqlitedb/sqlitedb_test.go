@@ -0,0 +1,96 @@
+package sqlitedb
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDSN(t *testing.T) {
+	tests := []struct {
+		mode Mode
+		want string
+	}{
+		{ReadOnly, "file:/data/a%3fb%23c%25d.db?mode=ro&_busy_timeout=5000"},
+		{Immutable, "file:/data/a%3fb%23c%25d.db?mode=ro&immutable=1"},
+		{ReadWrite, "file:/data/a%3fb%23c%25d.db?mode=rw&_busy_timeout=5000"},
+		{Create, "file:/data/a%3fb%23c%25d.db?mode=rwc&_busy_timeout=5000"},
+	}
+	for _, tt := range tests {
+		if got := DSN("/data/a?b#c%d.db", tt.mode); got != tt.want {
+			t.Errorf("DSN(mode %d) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestOpen_Modes(t *testing.T) {
+	SetMaxConnections(0)
+	path := filepath.Join(t.TempDir(), "odd?name#1.db")
+
+	db, err := Open(path, Create)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE t (v INTEGER); INSERT INTO t VALUES (42)"); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	db.Close()
+
+	for _, mode := range []Mode{ReadOnly, Immutable} {
+		db, err := Open(path, mode)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		var v int
+		if err := db.QueryRow("SELECT v FROM t").Scan(&v); err != nil || v != 42 {
+			t.Errorf("mode %d: read %d, %v", mode, v, err)
+		}
+		if _, err := db.Exec("INSERT INTO t VALUES (1)"); err == nil || !strings.Contains(err.Error(), "readonly") {
+			t.Errorf("mode %d: expected a read-only error, got: %v", mode, err)
+		}
+		db.Close()
+	}
+
+	if used := slots.inUse(); used != 0 {
+		t.Errorf("Expected no connection slots in use, got %d", used)
+	}
+}
+
+func TestOpen_WaitsForSlot(t *testing.T) {
+	SetMaxConnections(2)
+	defer SetMaxConnections(0)
+	dir := t.TempDir()
+
+	first, second, err := OpenPair(filepath.Join(dir, "a.db"), Create, filepath.Join(dir, "b.db"), Create)
+	if err != nil {
+		t.Fatalf("OpenPair failed: %v", err)
+	}
+
+	opened := make(chan *DB)
+	go func() {
+		db, err := Open(filepath.Join(dir, "c.db"), Create)
+		if err != nil {
+			t.Errorf("Open failed: %v", err)
+		}
+		opened <- db
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("Open did not wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	first.Close() // closing twice frees the slot once
+	third := <-opened
+	if used := slots.inUse(); used != 2 {
+		t.Errorf("Expected 2 connection slots in use, got %d", used)
+	}
+	second.Close()
+	third.Close()
+	if used := slots.inUse(); used != 0 {
+		t.Errorf("Expected no connection slots in use, got %d", used)
+	}
+}
@@ -1,13 +1,19 @@
 package types
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"archiveFiles/internal/apperr"
 	"archiveFiles/internal/constants"
+	"archiveFiles/internal/faults"
+	"archiveFiles/internal/utils"
 )
 
 // DatabaseType represents the type of database
@@ -18,6 +24,7 @@ const (
 	DatabaseTypeSQLite
 	DatabaseTypeLogFile
 	DatabaseTypeUnknown
+	DatabaseTypeGenericFile // Opaque data file, copied byte-for-byte and checksummed
 )
 
 // String returns the string representation of DatabaseType
@@ -29,32 +36,296 @@ func (dt DatabaseType) String() string {
 		return "SQLite"
 	case DatabaseTypeLogFile:
 		return "LogFile"
+	case DatabaseTypeGenericFile:
+		return "GenericFile"
 	default:
 		return "Unknown"
 	}
 }
 
+// ParseDatabaseType converts a type name (as returned by String, case
+// insensitive) back to a DatabaseType
+func ParseDatabaseType(name string) (DatabaseType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "rocksdb":
+		return DatabaseTypeRocksDB, nil
+	case "sqlite":
+		return DatabaseTypeSQLite, nil
+	case "logfile", "log":
+		return DatabaseTypeLogFile, nil
+	case "genericfile", "generic":
+		return DatabaseTypeGenericFile, nil
+	default:
+		return DatabaseTypeUnknown, fmt.Errorf("unknown database type: %s", name)
+	}
+}
+
+// ParseSamplePercent converts a sample size such as "5%" or "2.5" (percent)
+// to a fraction between 0 (exclusive) and 1
+func ParseSamplePercent(value string) (float64, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSpace(value), "%")
+	percent, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sample percentage: %s", value)
+	}
+	if percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid sample percentage: %s (must be greater than 0 and at most 100)", value)
+	}
+	return percent / 100, nil
+}
+
+// TimeWindow is a daily time window such as 02:00-06:00, in local time. A
+// window whose end is before its start crosses midnight.
+type TimeWindow struct {
+	Start int // Minutes after midnight
+	End   int // Minutes after midnight
+}
+
+// ParseTimeWindow parses a window in HH:MM-HH:MM form
+func ParseTimeWindow(value string) (TimeWindow, error) {
+	startText, endText, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s (expected HH:MM-HH:MM)", value)
+	}
+	var window TimeWindow
+	for _, part := range []struct {
+		text   string
+		minute *int
+	}{{startText, &window.Start}, {endText, &window.End}} {
+		clock, err := time.Parse("15:04", strings.TrimSpace(part.text))
+		if err != nil {
+			return TimeWindow{}, fmt.Errorf("invalid time window: %s (expected HH:MM-HH:MM)", value)
+		}
+		*part.minute = clock.Hour()*60 + clock.Minute()
+	}
+	if window.Start == window.End {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s (start and end are the same)", value)
+	}
+	return window, nil
+}
+
+// Deadline returns when the occurrence of the window that contains t ends,
+// or false when t is outside the window
+func (w TimeWindow) Deadline(t time.Time) (time.Time, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	endOn := func(day int) time.Time {
+		return time.Date(t.Year(), t.Month(), day, w.End/60, w.End%60, 0, 0, t.Location())
+	}
+
+	if w.Start < w.End {
+		if minute >= w.Start && minute < w.End {
+			return endOn(t.Day()), true
+		}
+		return time.Time{}, false
+	}
+	// Crosses midnight: either the evening part or the morning part
+	if minute >= w.Start {
+		return endOn(t.Day() + 1), true
+	}
+	if minute < w.End {
+		return endOn(t.Day()), true
+	}
+	return time.Time{}, false
+}
+
+// String formats the window as HH:MM-HH:MM
+func (w TimeWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// ParseSize parses a size such as 1048576, 512M, 500GB or 1.5TiB. Units are
+// powers of 1024, as in utils.FormatBytes.
+func ParseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "IB"), "B")
+	multiplier := int64(1)
+	if n := len(text); n > 0 {
+		if exp := strings.IndexByte("KMGTPE", text[n-1]); exp >= 0 {
+			multiplier = int64(1) << (10 * (exp + 1))
+			text = text[:n-1]
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || number < 0 || number*float64(multiplier) >= float64(1<<63) {
+		return 0, fmt.Errorf("invalid size: %s (expected e.g. 500GB)", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// DetectionRule maps files matching a glob pattern and/or a magic-byte
+// prefix to a handler type, ahead of the built-in detection
+type DetectionRule struct {
+	Pattern string `json:"pattern"` // Glob matched against the file name, e.g. "*.mdb"
+	Magic   string `json:"magic"`   // Hex-encoded prefix of the file content, e.g. "00010000"
+	Type    string `json:"type"`    // Handler type: sqlite, logfile, generic
+}
+
+// Validate checks that the rule can be applied
+func (r DetectionRule) Validate() error {
+	if r.Pattern == "" && r.Magic == "" {
+		return fmt.Errorf("rule needs a pattern or a magic prefix")
+	}
+	if r.Pattern != "" {
+		if _, err := filepath.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", r.Pattern, err)
+		}
+	}
+	if r.Magic != "" {
+		if _, err := hex.DecodeString(r.Magic); err != nil {
+			return fmt.Errorf("invalid magic %q: must be hex encoded", r.Magic)
+		}
+	}
+	dbType, err := ParseDatabaseType(r.Type)
+	if err != nil {
+		return err
+	}
+	// Rules match single files, so directory-based types make no sense
+	if dbType == DatabaseTypeRocksDB {
+		return fmt.Errorf("type %s cannot be assigned to files", r.Type)
+	}
+	return nil
+}
+
+// ConsistencyGroup names databases that must be captured at the same
+// logical moment, such as a RocksDB store and its SQLite metadata. One
+// worker backs up its members back-to-back, between the optional hooks.
+type ConsistencyGroup struct {
+	Name     string   `json:"name"`
+	Paths    []string `json:"paths"`     // Source paths of the member databases, e.g. "/data/app/store"
+	PreHook  string   `json:"pre_hook"`  // Shell command run before the first member, e.g. to pause the application (empty = none)
+	PostHook string   `json:"post_hook"` // Shell command run after the last member, also when a member failed (empty = none)
+}
+
 // DatabaseInfo contains information about a discovered database
 type DatabaseInfo struct {
 	Path       string       // Path to the database
 	Type       DatabaseType // Type of database
-	Name       string       // Name for backup
+	Name       string       // Backup path relative to the source root, slash-separated
 	SourceRoot string       // Track which source directory this came from
 	Size       int64        // File/directory size for progress tracking
+	Priority   string       // Priority of the source it came from: high, or empty for normal
+	Encrypted  bool         // Encrypted at rest (SQLCipher, RocksDB encrypted env): copied as files and verified by checksum only
+
+	Classifications []string // Classification labels of the source it came from, e.g. pii
+
+	Attachments []string // Auxiliary SQLite databases ATTACHed by the application, backed up with the main file
+
+	ConsistencyGroup string // Consistency group the database belongs to (empty = none)
+}
+
+// SkippedPath is a path discovery left out because it could not be read
+type SkippedPath struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
 }
 
 // Config holds all configuration options
 type Config struct {
-	SourcePaths []string `json:"source_paths"` // Support multiple source directories
-	BackupPath  string   `json:"backup_path"`
-	ArchivePath string   `json:"archive_path"`
-	Method      string   `json:"method"` // backup, checkpoint, copy
-	Compress    bool     `json:"compress"`
-	BatchMode   bool     `json:"batch_mode"` // Process directory vs single database
-	Verify      bool     `json:"verify"`     // Verify backup data against source
-	DryRun      bool     `json:"dry_run"`    // Dry run mode: simulate actions without executing them
-	LogLevel    string   `json:"log_level"`  // Log level: debug, info, warning, error (default: info)
-	ColorLog    bool     `json:"color_log"`  // Enable colored log output (default: true)
+	ConfigVersion int `json:"config_version"` // Schema version of the config file (see constants.ConfigVersion)
+
+	SourcePaths   []string `json:"source_paths"` // Support multiple source directories
+	BackupPath    string   `json:"backup_path"`
+	ArchivePath   string   `json:"archive_path"`
+	Namespace     string   `json:"namespace"` // Tenant prefix of item directories, archive entries, catalog records and upload keys, e.g. "teamA" (empty = none)
+	Method        string   `json:"method"`    // backup, checkpoint, copy
+	Compress      bool     `json:"compress"`
+	BatchMode     bool     `json:"batch_mode"`      // Process directory vs single database
+	Verify        bool     `json:"verify"`          // Verify backup data against source
+	DryRun        bool     `json:"dry_run"`         // Dry run mode: simulate actions without executing them
+	LogLevel      string   `json:"log_level"`       // Log level: debug, info, warning, error (default: info)
+	ColorLog      bool     `json:"color_log"`       // Enable colored log output (default: true)
+	LogOutput     string   `json:"log_output"`      // Where log messages go: stderr, syslog, journald (default: stderr)
+	Durability    string   `json:"durability"`      // fsync policy: none, data, full (default: data)
+	OnCorruption  string   `json:"on_corruption"`   // Source integrity failure policy: fail, backup-anyway, skip (default: fail)
+	OnAccessError string   `json:"on_access_error"` // Unreadable path policy during discovery: skip, warn, fail (default: warn)
+	Reproducible  bool     `json:"reproducible"`    // Deterministic archives: sorted entries, fixed owners and mtimes
+	NetworkFS     bool     `json:"network_fs"`      // Archive destination is a network filesystem: check the archive again after the rename
+	MaxDepth      int      `json:"max_depth"`       // Maximum discovery depth below each source (0 = unlimited)
+	OneFileSystem bool     `json:"one_file_system"` // Do not descend into other filesystems during discovery
+	Snapshot      string   `json:"snapshot"`        // Copy sources from a filesystem snapshot: apfs (empty = live files)
+	DropPageCache bool     `json:"drop_page_cache"` // Evict copied source data from the page cache (Linux)
+	Preread       bool     `json:"preread"`         // Read each source file sequentially right before copying it, so the copy and checksum passes hit the page cache
+	Nice          bool     `json:"nice"`            // Run at the lowest CPU priority and idle I/O class, with small RocksDB readahead
+	TmpDir        string   `json:"tmp_dir"`         // Directory for temporary state such as secondary instance directories (empty = $TMPDIR or /tmp)
+	Schedule      string   `json:"schedule"`        // Job order: discovery, largest-first, smallest-first, interleaved (default: discovery)
+	Window        string   `json:"window"`          // Daily time window for runs, e.g. "02:00-06:00"; no new items start after it closes (empty = unlimited)
+	HostInfo      bool     `json:"host_info"`       // Record host metadata in HOSTINFO.json inside the backup
+	ItemLogs      bool     `json:"item_logs"`       // Write <item>.backup.log next to each item: method, fallbacks, timings, verification
+
+	SQLiteMaxConnections int `json:"sqlite_max_connections"` // SQLite connections open at once across all workers (0 = 16; at least 2)
+
+	RocksDBBackupRateMBps int `json:"rocksdb_backup_rate_mbps"` // Copy rate of -method=backup in MB/s; the files are copied at that rate instead of through the BackupEngine (0 = unlimited)
+
+	MaxItems     int    `json:"max_items"`      // Refuse a run whose discovery finds more items (0 = unlimited)
+	MaxTotalSize string `json:"max_total_size"` // Refuse a run whose discovery finds more data, e.g. "500GB" (empty = unlimited)
+	Yes          bool   `json:"-"`              // Proceed past the guardrails; only accepted on the command line
+
+	DetectionRules []DetectionRule `json:"detection_rules"` // Site-specific file type rules, checked before built-in detection
+	LogDetection   string          `json:"log_detection"`   // Log file detection: permissive (name or content) or strict (content only) (default: permissive)
+	IncludePattern string          `json:"include_pattern"` // Comma-separated globs; otherwise unrecognized matching files are archived as generic files
+	ExcludePattern string          `json:"exclude_pattern"` // Comma-separated globs; matching files and directories are skipped during discovery
+	ExcludePaths   []string        `json:"-"`               // Paths skipped during discovery with everything below them; set per run for destinations inside a source
+
+	RocksDBExclude        string `json:"rocksdb_exclude"`         // Comma-separated globs of RocksDB files left out of backups (default: rotated logs, *.dbtmp, old OPTIONS files)
+	KeepRocksDBArtifacts  bool   `json:"keep_rocksdb_artifacts"`  // Copy every file of a RocksDB directory, e.g. for forensics
+	RocksDBExport         string `json:"rocksdb_export"`          // Export RocksDB data instead of backing it up: sst, jsonl or csv (empty = back up with method)
+	RocksDBExportEncoding string `json:"rocksdb_export_encoding"` // Encoding of binary keys and values in jsonl and csv exports: base64 (default) or hex
+
+	InventoryOnly   bool `json:"inventory_only"`   // List the items in the manifest and catalog without copying any data
+	InventoryHashes bool `json:"inventory_hashes"` // Record the SHA-256 of every file of an inventory, so changes that keep the size are noticed
+
+	CompressionFormat   string `json:"compression_format"`   // Archive format: gzip, xz, bzip2 or none for a plain tar (default: gzip)
+	CompressionLevel    int    `json:"compression_level"`    // Compression level, 1-9 (0 = the format's default)
+	StoreIncompressible bool   `json:"store_incompressible"` // Store already-compressed files (zstd SSTs, .gz, images) without compressing them again (gzip only)
+	EntryChecksums      bool   `json:"entry_checksums"`      // Record each file's SHA-256 in its PAX header so plain tar tooling can verify entries
+	ArchiveLayout       string `json:"archive_layout"`       // Archive layout: single, per-item (default: single)
+	VolumeSize          string `json:"volume_size"`          // Per-item layout: split items larger than this into volumes, e.g. "500G" (empty = one member per item)
+	Output              string `json:"output"`               // Where the backup goes: local, mirror (default: local)
+	MirrorTarget        string `json:"mirror_target"`        // user@host:/path the backup tree is mirrored below with output mirror
+	MirrorSSH           string `json:"mirror_ssh"`           // SSH command used for the mirror, including options (default: ssh)
+	KeepBackup          bool   `json:"keep_backup"`          // Keep the backup directory after compressing it
+	HideProgress        bool   `json:"hide_progress"`        // Do not draw the progress bar
+	ProgressInterval    string `json:"progress_interval"`    // How often the progress bar is redrawn, e.g. "1s" (default: 100ms)
+	AllowConcurrent     bool   `json:"allow_concurrent"`     // Skip the per-destination run lock
+	JSONReport          bool   `json:"json_report"`          // Print the run report as JSON on stdout instead of the archive path
+	WarningsAsErrors    bool   `json:"warnings_as_errors"`   // Fail the run when any item was archived with warnings
+
+	SQLiteAttachments map[string][]string `json:"sqlite_attachments"` // Main SQLite database path -> auxiliary databases the application ATTACHes to it
+	SourcePriorities  map[string]string   `json:"source_priorities"`  // Source path -> priority: high, normal (default: normal). High-priority sources are backed up first
+
+	SourceCompressionLevels map[string]int `json:"source_compression_levels"` // Source path -> compression level for its items, overriding compression_level (gzip only)
+
+	SourceClassifications        map[string][]string `json:"source_classifications"`         // Source path -> classification labels, e.g. ["pii"], recorded in the manifest and catalog
+	EncryptedOnlyClassifications []string            `json:"encrypted_only_classifications"` // Labels whose backups are only uploaded or mirrored to encrypted_destinations (default: pii)
+	EncryptedDestinations        []string            `json:"encrypted_destinations"`         // Upload and mirror targets that encrypt data at rest, e.g. "backup@vault:/secure"
+
+	ConsistencyGroups []ConsistencyGroup `json:"consistency_groups"` // Databases backed up back-to-back by one worker, optionally between hooks that pause the application
+
+	LogLevels map[string]string `json:"log_levels"` // Per-module log levels overriding log_level, e.g. {"backup": "debug"}
+
+	VerifySample string `json:"verify_sample"` // Verify a pseudo-random sample of keys/rows, e.g. "5%" (empty = disabled)
+	VerifySeed   int64  `json:"verify_seed"`   // Seed for the verification sample (0 = derived from the run start time)
+
+	Interval      string `json:"interval"`       // Daemon mode: run repeatedly at this interval, e.g. "24h" (empty = run once)
+	StatusAddr    string `json:"status_addr"`    // Daemon mode: address serving /healthz and /status, e.g. ":8080"; a Unix socket such as "unix:/run/archivefiles.sock" also serves /pause, /resume and /reload
+	ControlSocket string `json:"control_socket"` // Unix socket accepting control commands such as status and cancel-run (empty = disabled)
+
+	K8sJob         bool   `json:"k8s_job"`         // Single-shot Kubernetes Job mode: ConfigMap config, termination message report, Event JSON on stdout
+	TerminationLog string `json:"termination_log"` // Kubernetes job mode: where the run report is written (default: /dev/termination-log)
+
+	SignKey string `json:"sign_key"` // Ed25519 private key (PEM) for signing archives (empty = unsigned)
+
+	RestoreApprovalNamespaces []string `json:"restore_approval_namespaces"` // Namespaces whose archives only restore with an approval token
+	RestoreApprovalPubKey     string   `json:"restore_approval_pubkey"`     // Ed25519 public key (PEM) of the approvers, checked against approval tokens
+	RestoreAuditLog           string   `json:"restore_audit_log"`           // Deprecated: former name of audit_log, used when audit_log is not set
+
+	AuditLog    string `json:"audit_log"`    // JSON Lines file every backup, verify, restore and gc invocation, and every restore attempt, is appended to (empty = not logged)
+	AuditSyslog bool   `json:"audit_syslog"` // Also send audit records to the local syslog (authpriv facility)
+
+	CatalogPath       string `json:"catalog_path"`        // JSON file tracking per-item backup sizes across runs (empty = disabled)
+	SizeDropThreshold int    `json:"size_drop_threshold"` // Percent shrink against the trailing average reported as an anomaly (default: 50)
+
+	FaultInject string `json:"fault_inject"` // Testing only: faults to inject, e.g. "fail=5%,corrupt=0.1%,delay=200ms" (empty = disabled)
 }
 
 // DatabaseLockInfo contains information about database locks
@@ -74,6 +345,12 @@ type BackupProgress struct {
 	StartTime      time.Time
 }
 
+// ShowProgress reports whether the progress bar is drawn. It is hidden on
+// request and at the error log level.
+func (c *Config) ShowProgress() bool {
+	return !c.HideProgress && strings.ToLower(c.LogLevel) != "error"
+}
+
 // Validate validates the configuration and returns an error if invalid
 func (c *Config) Validate() error {
 	// Validate source paths
@@ -86,6 +363,14 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("empty source path not allowed")
 		}
 
+		// Docker volumes are resolved to their mountpoint at run time
+		if strings.HasPrefix(sourcePath, constants.DockerVolumeScheme) {
+			if strings.TrimPrefix(sourcePath, constants.DockerVolumeScheme) == "" {
+				return fmt.Errorf("empty docker volume name in source %s", sourcePath)
+			}
+			continue
+		}
+
 		// Security: Check for path traversal attempts
 		if err := validatePathSecurity(sourcePath); err != nil {
 			return fmt.Errorf("invalid source path %s: %v", sourcePath, err)
@@ -97,11 +382,25 @@ func (c *Config) Validate() error {
 		}
 	}
 
-	// Validate backup path
+	// Validate backup path. A source inside it would be removed with the
+	// backup directory once archived; the reverse is handled by leaving the
+	// destination out of discovery.
 	if c.BackupPath != "" {
 		if err := validatePathSecurity(c.BackupPath); err != nil {
 			return fmt.Errorf("invalid backup path: %v", err)
 		}
+		backupPath := utils.ReplaceDateVars(c.BackupPath)
+		for _, sourcePath := range c.SourcePaths {
+			if !strings.HasPrefix(sourcePath, constants.DockerVolumeScheme) && utils.IsWithin(sourcePath, backupPath) {
+				return fmt.Errorf("source %s lies inside the backup path %s", sourcePath, c.BackupPath)
+			}
+		}
+	}
+
+	if c.TmpDir != "" {
+		if info, err := os.Stat(c.TmpDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("temporary directory does not exist: %s", c.TmpDir)
+		}
 	}
 
 	// Validate archive path
@@ -111,6 +410,15 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.Namespace != "" {
+		if err := ValidateNamespace(c.Namespace); err != nil {
+			return err
+		}
+	}
+	if err := c.ValidateRestoreApproval(); err != nil {
+		return err
+	}
+
 	// Validate backup method
 	validMethods := []string{
 		constants.MethodCheckpoint,
@@ -123,16 +431,437 @@ func (c *Config) Validate() error {
 	}
 
 	// Validate log level
+	validLevels := []string{"debug", "info", "warning", "error"}
 	if c.LogLevel != "" {
-		validLevels := []string{"debug", "info", "warning", "error"}
 		if !contains(validLevels, strings.ToLower(c.LogLevel)) {
 			return fmt.Errorf("invalid log level: %s (valid: %s)", c.LogLevel, strings.Join(validLevels, ", "))
 		}
 	}
+	if c.LogOutput != "" {
+		validOutputs := []string{constants.LogOutputStderr, constants.LogOutputSyslog, constants.LogOutputJournald}
+		if !contains(validOutputs, c.LogOutput) {
+			return fmt.Errorf("invalid log output: %s (valid: %s)", c.LogOutput, strings.Join(validOutputs, ", "))
+		}
+	}
+	for module, level := range c.LogLevels {
+		if !contains(constants.LogModules, module) {
+			return fmt.Errorf("invalid log module: %s (valid: %s)", module, strings.Join(constants.LogModules, ", "))
+		}
+		if !contains(validLevels, strings.ToLower(level)) {
+			return fmt.Errorf("invalid log level for %s: %s (valid: %s)", module, level, strings.Join(validLevels, ", "))
+		}
+	}
+
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("invalid max depth: %d (must be 0 or greater)", c.MaxDepth)
+	}
+	if c.RocksDBBackupRateMBps < 0 {
+		return fmt.Errorf("invalid rocksdb backup rate: %d (must not be negative)", c.RocksDBBackupRateMBps)
+	}
+	if c.RocksDBBackupRateMBps > 0 && c.Method != constants.MethodBackup {
+		return fmt.Errorf("rocksdb backup rate applies to method %s only, not %s", constants.MethodBackup, c.Method)
+	}
+
+	if c.SQLiteMaxConnections != 0 && c.SQLiteMaxConnections < 2 {
+		return fmt.Errorf("invalid sqlite max connections: %d (must be at least 2, or 0 for the default)", c.SQLiteMaxConnections)
+	}
+
+	for i, rule := range c.DetectionRules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid detection rule %d: %v", i+1, err)
+		}
+	}
+
+	for dbPath, attachments := range c.SQLiteAttachments {
+		if dbPath == "" {
+			return fmt.Errorf("sqlite_attachments: empty database path")
+		}
+		for _, attachment := range attachments {
+			if attachment == "" {
+				return fmt.Errorf("sqlite_attachments: empty attachment path for %s", dbPath)
+			}
+		}
+	}
+
+	for sourcePath, priority := range c.SourcePriorities {
+		if !contains(c.SourcePaths, sourcePath) {
+			return fmt.Errorf("source_priorities: %s is not one of the source paths", sourcePath)
+		}
+		if priority != constants.PriorityHigh && priority != constants.PriorityNormal {
+			return fmt.Errorf("source_priorities: invalid priority %q for %s (valid: %s, %s)", priority, sourcePath, constants.PriorityHigh, constants.PriorityNormal)
+		}
+	}
+
+	if err := c.ValidateClassifications(); err != nil {
+		return err
+	}
+
+	groupOf := make(map[string]string)
+	for i, group := range c.ConsistencyGroups {
+		if group.Name == "" {
+			return fmt.Errorf("consistency_groups: group %d has no name", i+1)
+		}
+		if len(group.Paths) == 0 {
+			return fmt.Errorf("consistency_groups: group %s has no paths", group.Name)
+		}
+		for _, path := range group.Paths {
+			if path == "" {
+				return fmt.Errorf("consistency_groups: empty path in group %s", group.Name)
+			}
+			path = filepath.Clean(path)
+			if other, ok := groupOf[path]; ok {
+				return fmt.Errorf("consistency_groups: %s is in both %s and %s", path, other, group.Name)
+			}
+			groupOf[path] = group.Name
+		}
+		for _, other := range c.ConsistencyGroups[:i] {
+			if other.Name == group.Name {
+				return fmt.Errorf("consistency_groups: duplicate group name %s", group.Name)
+			}
+		}
+	}
+
+	if c.CompressionFormat != "" {
+		validFormats := []string{constants.CompressionGzip, constants.CompressionXz, constants.CompressionBzip2, constants.CompressionNone}
+		if !contains(validFormats, c.CompressionFormat) {
+			return fmt.Errorf("unsupported compression format: %s (supported: %s)", c.CompressionFormat, strings.Join(validFormats, ", "))
+		}
+		if c.CompressionFormat != constants.CompressionGzip && c.ArchiveLayout == constants.ArchiveLayoutPerItem {
+			return fmt.Errorf("compression format %s is not supported with the %s archive layout", c.CompressionFormat, constants.ArchiveLayoutPerItem)
+		}
+	}
+	if c.StoreIncompressible && c.CompressionFormat != "" && c.CompressionFormat != constants.CompressionGzip {
+		return fmt.Errorf("store_incompressible is only supported with gzip archives, not %s", c.CompressionFormat)
+	}
+	if c.CompressionLevel < 0 || c.CompressionLevel > constants.MaxCompressionLevel {
+		return fmt.Errorf("invalid compression level: %d (valid: 1-%d)", c.CompressionLevel, constants.MaxCompressionLevel)
+	}
+	if c.CompressionLevel != 0 && c.CompressionFormat == constants.CompressionNone {
+		return fmt.Errorf("compression level %d has no effect on uncompressed archives", c.CompressionLevel)
+	}
+	for sourcePath, level := range c.SourceCompressionLevels {
+		if !contains(c.SourcePaths, sourcePath) {
+			return fmt.Errorf("source_compression_levels: %s is not one of the source paths", sourcePath)
+		}
+		if level < 1 || level > constants.MaxCompressionLevel {
+			return fmt.Errorf("source_compression_levels: invalid level %d for %s (valid: 1-%d)", level, sourcePath, constants.MaxCompressionLevel)
+		}
+		if c.CompressionFormat != "" && c.CompressionFormat != constants.CompressionGzip {
+			return fmt.Errorf("source_compression_levels are only supported with gzip archives, not %s", c.CompressionFormat)
+		}
+	}
+
+	switch c.RocksDBExport {
+	case "", constants.RocksDBExportSST, constants.RocksDBExportJSONL, constants.RocksDBExportCSV:
+	default:
+		return fmt.Errorf("invalid rocksdb export format: %s (valid: sst, jsonl, csv)", c.RocksDBExport)
+	}
+	switch c.RocksDBExportEncoding {
+	case "", constants.RocksDBExportBase64, constants.RocksDBExportHex:
+	default:
+		return fmt.Errorf("invalid rocksdb export encoding: %s (valid: base64, hex)", c.RocksDBExportEncoding)
+	}
+
+	if c.ArchiveLayout != "" {
+		validLayouts := []string{constants.ArchiveLayoutSingle, constants.ArchiveLayoutPerItem}
+		if !contains(validLayouts, c.ArchiveLayout) {
+			return fmt.Errorf("invalid archive layout: %s (valid: %s)", c.ArchiveLayout, strings.Join(validLayouts, ", "))
+		}
+		if c.ArchiveLayout == constants.ArchiveLayoutPerItem && c.SignKey != "" {
+			return fmt.Errorf("sign_key is not supported with the %s archive layout", constants.ArchiveLayoutPerItem)
+		}
+	}
+	if c.VolumeSize != "" {
+		if size, err := ParseSize(c.VolumeSize); err != nil || size <= 0 {
+			return fmt.Errorf("invalid volume size %q: must be a positive size, e.g. 500G", c.VolumeSize)
+		}
+		if c.ArchiveLayout != constants.ArchiveLayoutPerItem {
+			return fmt.Errorf("volume_size requires the %s archive layout", constants.ArchiveLayoutPerItem)
+		}
+	}
+
+	if c.Output != "" {
+		validOutputs := []string{constants.OutputLocal, constants.OutputMirror}
+		if !contains(validOutputs, c.Output) {
+			return fmt.Errorf("invalid output: %s (valid: %s)", c.Output, strings.Join(validOutputs, ", "))
+		}
+	}
+	if c.Output == constants.OutputMirror {
+		host, remotePath, _ := strings.Cut(c.MirrorTarget, ":")
+		if host == "" || !strings.HasPrefix(remotePath, "/") {
+			return fmt.Errorf("output %s requires mirror_target as user@host:/path, got %q", constants.OutputMirror, c.MirrorTarget)
+		}
+		if err := c.CheckDestination(c.Classifications(), c.MirrorTarget); err != nil {
+			return err
+		}
+		if c.ArchiveLayout == constants.ArchiveLayoutPerItem {
+			return fmt.Errorf("archive layout %s is not supported with output %s, which creates no archive", c.ArchiveLayout, constants.OutputMirror)
+		}
+		if c.SignKey != "" {
+			return fmt.Errorf("sign_key is not supported with output %s, which creates no archive", constants.OutputMirror)
+		}
+	}
+
+	if c.InventoryHashes && !c.InventoryOnly {
+		return fmt.Errorf("inventory_hashes requires inventory_only")
+	}
+	if c.InventoryOnly {
+		if c.Output == constants.OutputMirror {
+			return fmt.Errorf("output %s is not supported with inventory_only, which copies no data", constants.OutputMirror)
+		}
+		if c.SignKey != "" {
+			return fmt.Errorf("sign_key is not supported with inventory_only, which creates no archive")
+		}
+	}
+
+	// Validate durability policy
+	if c.Durability != "" {
+		validDurability := []string{
+			constants.DurabilityNone,
+			constants.DurabilityData,
+			constants.DurabilityFull,
+		}
+		if !contains(validDurability, c.Durability) {
+			return fmt.Errorf("invalid durability: %s (valid: %s)", c.Durability, strings.Join(validDurability, ", "))
+		}
+	}
+
+	if c.ProgressInterval != "" {
+		interval, err := time.ParseDuration(c.ProgressInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid progress interval: %s (must be a positive duration such as 500ms)", c.ProgressInterval)
+		}
+	}
+
+	if c.Interval != "" {
+		interval, err := time.ParseDuration(c.Interval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid interval: %s (must be a positive duration such as 1h)", c.Interval)
+		}
+	}
+
+	if c.FaultInject != "" {
+		if _, err := faults.ParseSpec(c.FaultInject); err != nil {
+			return fmt.Errorf("invalid fault injection spec: %v", err)
+		}
+	}
+
+	if c.Window != "" {
+		if _, err := ParseTimeWindow(c.Window); err != nil {
+			return err
+		}
+	}
+
+	if c.MaxItems < 0 {
+		return fmt.Errorf("invalid max items: %d", c.MaxItems)
+	}
+	if c.MaxTotalSize != "" {
+		if _, err := ParseSize(c.MaxTotalSize); err != nil {
+			return fmt.Errorf("invalid max total size: %v", err)
+		}
+	}
+
+	for _, pattern := range strings.Split(c.RocksDBExclude, ",") {
+		if _, err := filepath.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("invalid rocksdb_exclude pattern %q: %v", pattern, err)
+		}
+	}
+
+	if c.Schedule != "" {
+		validSchedules := []string{
+			constants.ScheduleDiscovery,
+			constants.ScheduleLargestFirst,
+			constants.ScheduleSmallestFirst,
+			constants.ScheduleInterleaved,
+		}
+		if !contains(validSchedules, c.Schedule) {
+			return fmt.Errorf("invalid schedule: %s (valid: %s)", c.Schedule, strings.Join(validSchedules, ", "))
+		}
+	}
+
+	if c.Snapshot != "" {
+		if c.Snapshot != constants.SnapshotAPFS {
+			return fmt.Errorf("unsupported snapshot provider: %s (supported: %s)", c.Snapshot, constants.SnapshotAPFS)
+		}
+		for _, sourcePath := range c.SourcePaths {
+			if strings.HasPrefix(sourcePath, constants.DockerVolumeScheme) {
+				return fmt.Errorf("snapshots apply to local paths, not docker volume source %s", sourcePath)
+			}
+		}
+	}
+
+	if c.K8sJob && c.Interval != "" {
+		return fmt.Errorf("k8s job mode runs once and cannot be combined with an interval")
+	}
+	if c.JSONReport && (c.K8sJob || c.Interval != "") {
+		return fmt.Errorf("json_report only applies to a single run outside k8s job mode")
+	}
+
+	if c.VerifySample != "" {
+		if _, err := ParseSamplePercent(c.VerifySample); err != nil {
+			return err
+		}
+	}
+
+	if c.SizeDropThreshold < 0 || c.SizeDropThreshold > 100 {
+		return fmt.Errorf("invalid size drop threshold: %d (must be between 0 and 100)", c.SizeDropThreshold)
+	}
+
+	// Validate corruption policy
+	if c.OnCorruption != "" {
+		validPolicies := []string{
+			constants.OnCorruptionFail,
+			constants.OnCorruptionBackupAnyway,
+			constants.OnCorruptionSkip,
+		}
+		if !contains(validPolicies, c.OnCorruption) {
+			return fmt.Errorf("invalid on-corruption policy: %s (valid: %s)", c.OnCorruption, strings.Join(validPolicies, ", "))
+		}
+	}
+
+	// Validate log file detection
+	if c.LogDetection != "" && c.LogDetection != constants.LogDetectionPermissive && c.LogDetection != constants.LogDetectionStrict {
+		return fmt.Errorf("invalid log detection: %s (valid: %s, %s)", c.LogDetection, constants.LogDetectionPermissive, constants.LogDetectionStrict)
+	}
+
+	// Validate access error policy
+	if c.OnAccessError != "" {
+		validPolicies := []string{
+			constants.OnAccessErrorSkip,
+			constants.OnAccessErrorWarn,
+			constants.OnAccessErrorFail,
+		}
+		if !contains(validPolicies, c.OnAccessError) {
+			return fmt.Errorf("invalid on-access-error policy: %s (valid: %s)", c.OnAccessError, strings.Join(validPolicies, ", "))
+		}
+	}
 
 	return nil
 }
 
+// ValidateRestoreApproval checks the restore approval settings, which the
+// restore commands use without validating the rest of the config
+func (c *Config) ValidateRestoreApproval() error {
+	if len(c.RestoreApprovalNamespaces) == 0 {
+		return nil
+	}
+	for _, namespace := range c.RestoreApprovalNamespaces {
+		if err := ValidateNamespace(namespace); err != nil {
+			return fmt.Errorf("invalid restore_approval_namespaces: %v", err)
+		}
+	}
+	if c.RestoreApprovalPubKey == "" {
+		return fmt.Errorf("restore_approval_namespaces requires restore_approval_pubkey")
+	}
+	if c.AuditLogPath() == "" {
+		return fmt.Errorf("restore_approval_namespaces requires audit_log")
+	}
+	return nil
+}
+
+// AuditLogPath returns the audit log file: audit_log, or the
+// restore_audit_log of older configs
+func (c *Config) AuditLogPath() string {
+	if c.AuditLog != "" {
+		return c.AuditLog
+	}
+	return c.RestoreAuditLog
+}
+
+// ValidateClassifications checks the classification settings, which upload
+// uses without validating the rest of the config
+func (c *Config) ValidateClassifications() error {
+	for sourcePath, labels := range c.SourceClassifications {
+		if len(c.SourcePaths) > 0 && !contains(c.SourcePaths, sourcePath) {
+			return fmt.Errorf("source_classifications: %s is not one of the source paths", sourcePath)
+		}
+		for _, label := range labels {
+			if err := validateLabel(label); err != nil {
+				return fmt.Errorf("source_classifications: %v", err)
+			}
+		}
+	}
+	for _, label := range c.EncryptedOnlyClassifications {
+		if err := validateLabel(label); err != nil {
+			return fmt.Errorf("encrypted_only_classifications: %v", err)
+		}
+	}
+	for _, destination := range c.EncryptedDestinations {
+		if destination == "" {
+			return fmt.Errorf("encrypted_destinations: empty destination")
+		}
+	}
+	return nil
+}
+
+// validateLabel checks a classification label: lowercase letters, digits,
+// '_' and '-', e.g. pii
+func validateLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty classification label")
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return fmt.Errorf("invalid classification label %q: use lowercase letters, digits, '_' and '-'", label)
+		}
+	}
+	return nil
+}
+
+// Classifications returns the labels of all sources, sorted
+func (c *Config) Classifications() []string {
+	var labels []string
+	for _, sourceLabels := range c.SourceClassifications {
+		for _, label := range sourceLabels {
+			if !contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// CheckDestination refuses to send data carrying classifications to
+// destination, a user@host:/path target, unless every label that needs
+// encryption at rest (encrypted_only_classifications, default pii) may go
+// there: destination must be one of encrypted_destinations or below one
+func (c *Config) CheckDestination(classifications []string, destination string) error {
+	restricted := c.EncryptedOnlyClassifications
+	if len(restricted) == 0 {
+		restricted = constants.DefaultEncryptedOnlyClassifications
+	}
+	for _, label := range classifications {
+		if !contains(restricted, label) {
+			continue
+		}
+		for _, encrypted := range c.EncryptedDestinations {
+			encrypted = strings.TrimSuffix(encrypted, "/")
+			if destination == encrypted || strings.HasPrefix(destination, encrypted+"/") {
+				return nil
+			}
+		}
+		return apperr.New(apperr.ErrPolicy, "backups classified %s may only go to encrypted destinations; %s is not one of encrypted_destinations", label, destination)
+	}
+	return nil
+}
+
+// ValidateNamespace checks that a tenant namespace can serve as a single
+// directory name and remote key component on any host: letters, digits,
+// '.', '_' and '-', starting with a letter or digit
+func ValidateNamespace(namespace string) error {
+	if namespace == "" || len(namespace) > constants.MaxNamespaceLength {
+		return fmt.Errorf("invalid namespace %q: must be 1-%d characters", namespace, constants.MaxNamespaceLength)
+	}
+	for i, r := range namespace {
+		alphanumeric := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		if !alphanumeric && (i == 0 || (r != '.' && r != '_' && r != '-')) {
+			return fmt.Errorf("invalid namespace %q: use letters, digits, '.', '_' and '-', starting with a letter or digit", namespace)
+		}
+	}
+	return nil
+}
+
 // validatePathSecurity checks for path traversal and other security issues
 func validatePathSecurity(path string) error {
 	if path == "" {
@@ -1,11 +1,14 @@
 package types
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"archiveFiles/internal/apperr"
 	"archiveFiles/internal/constants"
 )
 
@@ -19,6 +22,7 @@ func TestDatabaseType_String(t *testing.T) {
 		{"SQLite", DatabaseTypeSQLite, "SQLite"},
 		{"LogFile", DatabaseTypeLogFile, "LogFile"},
 		{"Unknown", DatabaseTypeUnknown, "Unknown"},
+		{"GenericFile", DatabaseTypeGenericFile, "GenericFile"},
 		{"Invalid", DatabaseType(999), "Unknown"},
 	}
 
@@ -150,6 +154,38 @@ func TestConfig_Validate(t *testing.T) {
 		}
 	})
 
+	t.Run("Docker volume source", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{"docker-volume://pgdata?pause=postgres"},
+			Method:      constants.MethodCheckpoint,
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected docker volume source to pass validation, got error: %v", err)
+		}
+
+		cfg.SourcePaths = []string{"docker-volume://"}
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected error for empty docker volume name")
+		}
+	})
+
+	t.Run("Source inside backup path", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			BackupPath:  tempDir,
+			Method:      constants.MethodCheckpoint,
+		}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "inside the backup path") {
+			t.Errorf("Expected error about source inside backup path, got: %v", err)
+		}
+
+		// The reverse is allowed; the backup is left out of discovery
+		cfg.BackupPath = filepath.Join(sourceDir, "backup")
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected backup path inside source to pass validation, got error: %v", err)
+		}
+	})
+
 	t.Run("Empty source paths", func(t *testing.T) {
 		cfg := &Config{
 			SourcePaths: []string{},
@@ -226,6 +262,177 @@ func TestConfig_Validate(t *testing.T) {
 		}
 	})
 
+	t.Run("Mirror output without a target", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths:  []string{sourceDir},
+			Method:       constants.MethodCheckpoint,
+			Output:       constants.OutputMirror,
+			MirrorTarget: "nas:backups",
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "mirror_target") {
+			t.Errorf("Expected error about mirror_target, got: %v", err)
+		}
+		cfg.MirrorTarget = "backup@nas:/backups"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate failed for a valid mirror target: %v", err)
+		}
+	})
+
+	t.Run("Invalid log output", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			Method:      constants.MethodCheckpoint,
+			LogOutput:   "eventlog",
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid log output") {
+			t.Errorf("Expected error about invalid log output, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid durability", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			Method:      constants.MethodCheckpoint,
+			Durability:  "sometimes",
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid durability") {
+			t.Errorf("Expected error about invalid durability, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid interval", func(t *testing.T) {
+		for _, interval := range []string{"daily", "0s", "-1h"} {
+			cfg := &Config{
+				SourcePaths: []string{sourceDir},
+				Method:      constants.MethodCheckpoint,
+				Interval:    interval,
+			}
+
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), "invalid interval") {
+				t.Errorf("Interval %q: expected error about invalid interval, got: %v", interval, err)
+			}
+		}
+	})
+
+	t.Run("JSON report in daemon mode", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			Method:      constants.MethodCheckpoint,
+			Interval:    "24h",
+			JSONReport:  true,
+		}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "json_report") {
+			t.Errorf("Expected error about json_report, got: %v", err)
+		}
+	})
+
+	t.Run("Source priorities", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths:      []string{sourceDir},
+			Method:           constants.MethodCheckpoint,
+			SourcePriorities: map[string]string{sourceDir: constants.PriorityHigh},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected valid source priority, got: %v", err)
+		}
+
+		cfg.SourcePriorities = map[string]string{sourceDir: "urgent"}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid priority") {
+			t.Errorf("Expected error about invalid priority, got: %v", err)
+		}
+
+		cfg.SourcePriorities = map[string]string{"/elsewhere": constants.PriorityHigh}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "not one of the source paths") {
+			t.Errorf("Expected error about an unknown source, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid schedule", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			Method:      constants.MethodCheckpoint,
+			Schedule:    "random",
+		}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid schedule") {
+			t.Errorf("Expected error about invalid schedule, got: %v", err)
+		}
+	})
+
+	t.Run("Snapshot provider", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			Method:      constants.MethodCheckpoint,
+			Snapshot:    "zfs",
+		}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unsupported snapshot provider") {
+			t.Errorf("Expected error about the snapshot provider, got: %v", err)
+		}
+
+		cfg = &Config{
+			SourcePaths: []string{"docker-volume://pgdata"},
+			Method:      constants.MethodCheckpoint,
+			Snapshot:    constants.SnapshotAPFS,
+		}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "docker volume") {
+			t.Errorf("Expected error about snapshotting a docker volume, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid log_levels", func(t *testing.T) {
+		for _, levels := range []map[string]string{{"network": "debug"}, {"backup": "verbose"}} {
+			cfg := &Config{
+				SourcePaths: []string{sourceDir},
+				Method:      constants.MethodCheckpoint,
+				LogLevels:   levels,
+			}
+			if err := cfg.Validate(); err == nil {
+				t.Errorf("Expected error for log_levels %v", levels)
+			}
+		}
+
+		cfg := &Config{
+			SourcePaths: []string{sourceDir},
+			Method:      constants.MethodCheckpoint,
+			LogLevels:   map[string]string{"backup": "debug", "hostinfo": "warning", "snapshot": "debug", "verify": "INFO"},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected valid log_levels, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid on-access-error policy", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths:   []string{sourceDir},
+			Method:        constants.MethodCheckpoint,
+			OnAccessError: "ignore",
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid on-access-error policy") {
+			t.Errorf("Expected error about invalid on-access-error policy, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid on-corruption policy", func(t *testing.T) {
+		cfg := &Config{
+			SourcePaths:  []string{sourceDir},
+			Method:       constants.MethodCheckpoint,
+			OnCorruption: "ignore",
+		}
+
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid on-corruption policy") {
+			t.Errorf("Expected error about invalid on-corruption policy, got: %v", err)
+		}
+	})
+
 	t.Run("Valid log levels", func(t *testing.T) {
 		validLevels := []string{"debug", "info", "warning", "error"}
 
@@ -368,3 +575,519 @@ func TestContains(t *testing.T) {
 		}
 	})
 }
+
+func TestParseDatabaseType(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected DatabaseType
+		wantErr  bool
+	}{
+		{"rocksdb", DatabaseTypeRocksDB, false},
+		{"SQLite", DatabaseTypeSQLite, false},
+		{"LogFile", DatabaseTypeLogFile, false},
+		{"log", DatabaseTypeLogFile, false},
+		{"generic", DatabaseTypeGenericFile, false},
+		{"mystery", DatabaseTypeUnknown, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDatabaseType(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDatabaseType(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.expected {
+			t.Errorf("ParseDatabaseType(%q) = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestDetectionRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    DetectionRule
+		wantErr bool
+	}{
+		{"Pattern only", DetectionRule{Pattern: "*.mdb", Type: "logfile"}, false},
+		{"Magic only", DetectionRule{Magic: "cafebabe", Type: "logfile"}, false},
+		{"Generic type", DetectionRule{Pattern: "*.mdb", Type: "generic"}, false},
+		{"Pattern and magic", DetectionRule{Pattern: "*.dat", Magic: "00ff", Type: "sqlite"}, false},
+		{"Neither pattern nor magic", DetectionRule{Type: "logfile"}, true},
+		{"Bad pattern", DetectionRule{Pattern: "[", Type: "logfile"}, true},
+		{"Bad magic", DetectionRule{Magic: "zz", Type: "logfile"}, true},
+		{"Unknown type", DetectionRule{Pattern: "*.mdb", Type: "mystery"}, true},
+		{"Directory type", DetectionRule{Pattern: "*.mdb", Type: "rocksdb"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSamplePercent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		wantErr  bool
+	}{
+		{"5%", 0.05, false},
+		{"2.5", 0.025, false},
+		{" 100% ", 1, false},
+		{"0%", 0, true},
+		{"150%", 0, true},
+		{"five", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSamplePercent(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSamplePercent(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("ParseSamplePercent(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateFaultInject(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	cfg := &Config{
+		SourcePaths: []string{sourceDir},
+		Method:      constants.MethodCheckpoint,
+		FaultInject: "fail=5%,corrupt=0.1%,delay=10ms,seed=1",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid fault spec to pass validation, got error: %v", err)
+	}
+
+	cfg.FaultInject = "explode=1%"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown fault")
+	}
+}
+
+func TestConfig_CompressionFormatAndProgress(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, format := range []string{"", "gzip", "xz", "bzip2", "none"} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, CompressionFormat: format}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("compression format %q should be valid, got error: %v", format, err)
+		}
+	}
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, CompressionFormat: "zstd"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unsupported compression format")
+	}
+	cfg = &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, CompressionFormat: "xz", ArchiveLayout: constants.ArchiveLayoutPerItem}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for xz with per-item archives")
+	}
+
+	for _, tt := range []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"level", Config{CompressionLevel: 9}, false},
+		{"level too high", Config{CompressionLevel: 19}, true},
+		{"source level", Config{SourceCompressionLevels: map[string]int{sourceDir: 9}}, false},
+		{"source level of unknown source", Config{SourceCompressionLevels: map[string]int{"/elsewhere": 9}}, true},
+		{"source level out of range", Config{SourceCompressionLevels: map[string]int{sourceDir: 0}}, true},
+		{"source level with xz", Config{CompressionFormat: "xz", SourceCompressionLevels: map[string]int{sourceDir: 9}}, true},
+		{"store incompressible", Config{StoreIncompressible: true}, false},
+		{"store incompressible with xz", Config{CompressionFormat: "xz", StoreIncompressible: true}, true},
+		{"level without compression", Config{CompressionFormat: "none", CompressionLevel: 5}, true},
+		{"per-item without compression", Config{CompressionFormat: "none", ArchiveLayout: constants.ArchiveLayoutPerItem}, true},
+	} {
+		tt.cfg.SourcePaths = []string{sourceDir}
+		tt.cfg.Method = constants.MethodCheckpoint
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	tests := []struct {
+		logLevel     string
+		hideProgress bool
+		want         bool
+	}{
+		{"info", false, true},
+		{"info", true, false},
+		{"error", false, false},
+		{"ERROR", false, false},
+	}
+	for _, tt := range tests {
+		cfg := &Config{LogLevel: tt.logLevel, HideProgress: tt.hideProgress}
+		if got := cfg.ShowProgress(); got != tt.want {
+			t.Errorf("ShowProgress() with log level %s, hide %t = %t, want %t", tt.logLevel, tt.hideProgress, got, tt.want)
+		}
+	}
+}
+
+func TestConfig_ArchiveLayout(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, layout := range []string{"", constants.ArchiveLayoutSingle, constants.ArchiveLayoutPerItem} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ArchiveLayout: layout}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("archive layout %q should be valid, got error: %v", layout, err)
+		}
+	}
+
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ArchiveLayout: "sharded"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid archive layout") {
+		t.Errorf("Expected error about invalid archive layout, got: %v", err)
+	}
+
+	cfg = &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ArchiveLayout: constants.ArchiveLayoutPerItem, SignKey: "key.pem"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for signing a per-item archive")
+	}
+
+	cfg = &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ArchiveLayout: constants.ArchiveLayoutPerItem, VolumeSize: "500G"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("volume size with the per-item layout should be valid, got error: %v", err)
+	}
+	for _, broken := range []Config{
+		{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, VolumeSize: "500G"},
+		{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ArchiveLayout: constants.ArchiveLayoutPerItem, VolumeSize: "0"},
+		{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ArchiveLayout: constants.ArchiveLayoutPerItem, VolumeSize: "lots"},
+	} {
+		if err := broken.Validate(); err == nil {
+			t.Errorf("Expected an error for volume size %q with layout %q", broken.VolumeSize, broken.ArchiveLayout)
+		}
+	}
+}
+
+func TestConfig_RocksDBExport(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, format := range []string{"", constants.RocksDBExportSST, constants.RocksDBExportJSONL, constants.RocksDBExportCSV} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, RocksDBExport: format}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("rocksdb export %q should be valid, got error: %v", format, err)
+		}
+	}
+
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, RocksDBExport: "parquet"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid rocksdb export format") {
+		t.Errorf("Expected error about invalid rocksdb export format, got: %v", err)
+	}
+
+	cfg = &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, RocksDBExport: constants.RocksDBExportCSV, RocksDBExportEncoding: "base32"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid rocksdb export encoding") {
+		t.Errorf("Expected error about invalid rocksdb export encoding, got: %v", err)
+	}
+}
+
+func TestConfig_LogDetection(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, detection := range []string{"", constants.LogDetectionPermissive, constants.LogDetectionStrict} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, LogDetection: detection}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("log detection %q should be valid, got error: %v", detection, err)
+		}
+	}
+
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, LogDetection: "content"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid log detection") {
+		t.Errorf("Expected error about invalid log detection, got: %v", err)
+	}
+}
+
+func TestConfig_SQLiteMaxConnections(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, n := range []int{0, 2, 64} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, SQLiteMaxConnections: n}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("sqlite max connections %d should be valid, got error: %v", n, err)
+		}
+	}
+
+	for _, n := range []int{1, -1} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, SQLiteMaxConnections: n}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid sqlite max connections") {
+			t.Errorf("Expected error about invalid sqlite max connections for %d, got: %v", n, err)
+		}
+	}
+}
+
+func TestConfig_RocksDBBackupRate(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodBackup, RocksDBBackupRateMBps: 50}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("a backup rate with method backup should be valid, got error: %v", err)
+	}
+
+	cfg = &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, RocksDBBackupRateMBps: 50}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "applies to method backup only") {
+		t.Errorf("Expected a backup rate with method checkpoint to be declined, got: %v", err)
+	}
+
+	cfg = &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodBackup, RocksDBBackupRateMBps: -1}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid rocksdb backup rate") {
+		t.Errorf("Expected error about invalid rocksdb backup rate, got: %v", err)
+	}
+}
+
+func TestConfig_ProgressInterval(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, interval := range []string{"", "50ms", "2s"} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ProgressInterval: interval}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("progress interval %q should be valid, got error: %v", interval, err)
+		}
+	}
+
+	for _, interval := range []string{"0s", "-1s", "fast"} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ProgressInterval: interval}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid progress interval") {
+			t.Errorf("Expected error about invalid progress interval for %q, got: %v", interval, err)
+		}
+	}
+}
+
+func TestConfig_TmpDir(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, TmpDir: t.TempDir()}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("existing temporary directory should be valid, got error: %v", err)
+	}
+	cfg.TmpDir = filepath.Join(sourceDir, "missing")
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "temporary directory does not exist") {
+		t.Errorf("Expected error about the missing temporary directory, got: %v", err)
+	}
+}
+
+func TestConfig_InventoryOnly(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	for _, tt := range []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"inventory", Config{InventoryOnly: true, InventoryHashes: true}, false},
+		{"hashes without inventory", Config{InventoryHashes: true}, true},
+		{"inventory with mirror", Config{InventoryOnly: true, Output: constants.OutputMirror, MirrorTarget: "backup@host:/backups"}, true},
+		{"inventory with signing", Config{InventoryOnly: true, SignKey: "/etc/archiveFiles/sign.pem"}, true},
+	} {
+		tt.cfg.SourcePaths = []string{sourceDir}
+		tt.cfg.Method = constants.MethodCheckpoint
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfig_ConsistencyGroups(t *testing.T) {
+	sourceDir := t.TempDir()
+	group := ConsistencyGroup{Name: "app", Paths: []string{"/data/app/store", "/data/app/meta.db"}, PreHook: "true"}
+
+	cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ConsistencyGroups: []ConsistencyGroup{group}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("consistency group should be valid, got error: %v", err)
+	}
+
+	for _, groups := range [][]ConsistencyGroup{
+		{{Paths: []string{"/data/a"}}},
+		{{Name: "empty"}},
+		{{Name: "blank", Paths: []string{""}}},
+		{group, {Name: "app", Paths: []string{"/data/other"}}},
+		{group, {Name: "other", Paths: []string{"/data/app/store/"}}},
+	} {
+		cfg := &Config{SourcePaths: []string{sourceDir}, Method: constants.MethodCheckpoint, ConsistencyGroups: groups}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "consistency_groups") {
+			t.Errorf("Expected consistency_groups error for %+v, got: %v", groups, err)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1048576": 1 << 20,
+		"512M":    512 << 20,
+		"500GB":   500 << 30,
+		"1.5TiB":  3 << 39,
+		" 2 kb ":  2048,
+		"0":       0,
+	}
+	for value, want := range tests {
+		if got, err := ParseSize(value); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "GB", "-1G", "10X", "1e30"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("Expected an error for size %q", value)
+		}
+	}
+
+	cfg := &Config{SourcePaths: []string{t.TempDir()}, Method: constants.MethodCheckpoint, MaxTotalSize: "lots"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid max total size") {
+		t.Errorf("Expected error about invalid max total size, got: %v", err)
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	for _, namespace := range []string{"teamA", "team-a.prod", "a", "42_ops"} {
+		if err := ValidateNamespace(namespace); err != nil {
+			t.Errorf("ValidateNamespace(%q) = %v", namespace, err)
+		}
+	}
+	for _, namespace := range []string{"", ".", "..", "-team", "team/a", "team a", "../x", strings.Repeat("a", 65)} {
+		if err := ValidateNamespace(namespace); err == nil {
+			t.Errorf("Expected an error for namespace %q", namespace)
+		}
+	}
+
+	cfg := &Config{SourcePaths: []string{t.TempDir()}, Method: constants.MethodCheckpoint, Namespace: "team/a"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid namespace") {
+		t.Errorf("Expected error about invalid namespace, got: %v", err)
+	}
+}
+
+func TestValidateRestoreApproval(t *testing.T) {
+	cfg := &Config{RestoreApprovalNamespaces: []string{"pii"}, RestoreApprovalPubKey: "approvers.pem", AuditLog: "audit.log"}
+	if err := cfg.ValidateRestoreApproval(); err != nil {
+		t.Errorf("ValidateRestoreApproval failed: %v", err)
+	}
+
+	// restore_audit_log of older configs stands in for audit_log
+	legacy := &Config{RestoreApprovalNamespaces: []string{"pii"}, RestoreApprovalPubKey: "approvers.pem", RestoreAuditLog: "restore.log"}
+	if err := legacy.ValidateRestoreApproval(); err != nil || legacy.AuditLogPath() != "restore.log" {
+		t.Errorf("ValidateRestoreApproval = %v with audit log %q, want restore.log accepted", err, legacy.AuditLogPath())
+	}
+	legacy.AuditLog = "audit.log"
+	if legacy.AuditLogPath() != "audit.log" {
+		t.Errorf("AuditLogPath = %q, want audit_log to win", legacy.AuditLogPath())
+	}
+
+	for _, broken := range []Config{
+		{RestoreApprovalNamespaces: []string{"pii/x"}, RestoreApprovalPubKey: "approvers.pem", AuditLog: "audit.log"},
+		{RestoreApprovalNamespaces: []string{"pii"}, AuditLog: "audit.log"},
+		{RestoreApprovalNamespaces: []string{"pii"}, RestoreApprovalPubKey: "approvers.pem"},
+	} {
+		if err := broken.ValidateRestoreApproval(); err == nil {
+			t.Errorf("Expected an error for %+v", broken)
+		}
+	}
+}
+
+func TestConfig_Classifications(t *testing.T) {
+	source := t.TempDir()
+	cfg := &Config{
+		SourcePaths:           []string{source},
+		SourceClassifications: map[string][]string{source: {"pii", "financial"}},
+		EncryptedDestinations: []string{"backup@vault:/secure/"},
+	}
+	if err := cfg.ValidateClassifications(); err != nil {
+		t.Fatalf("ValidateClassifications failed: %v", err)
+	}
+	if got := cfg.Classifications(); strings.Join(got, ",") != "financial,pii" {
+		t.Errorf("Classifications() = %v, want [financial pii]", got)
+	}
+
+	if err := cfg.CheckDestination(cfg.Classifications(), "backup@vault:/secure/teamA"); err != nil {
+		t.Errorf("Expected a destination below an encrypted one to be allowed, got: %v", err)
+	}
+	err := cfg.CheckDestination(cfg.Classifications(), "backup@nas:/backups")
+	if !errors.Is(err, apperr.ErrPolicy) {
+		t.Errorf("Expected a policy violation for an unencrypted destination, got: %v", err)
+	}
+	if err := cfg.CheckDestination(cfg.Classifications(), "backup@vault:/secure-old"); !errors.Is(err, apperr.ErrPolicy) {
+		t.Errorf("Expected a policy violation for a sibling of an encrypted destination, got: %v", err)
+	}
+	if err := cfg.CheckDestination([]string{"financial"}, "backup@nas:/backups"); err != nil {
+		t.Errorf("Expected financial to be allowed anywhere by default, got: %v", err)
+	}
+	cfg.EncryptedOnlyClassifications = []string{"financial"}
+	if err := cfg.CheckDestination([]string{"financial"}, "backup@nas:/backups"); !errors.Is(err, apperr.ErrPolicy) {
+		t.Errorf("Expected a policy violation for financial, got: %v", err)
+	}
+
+	for _, broken := range []Config{
+		{SourcePaths: []string{source}, SourceClassifications: map[string][]string{"/elsewhere": {"pii"}}},
+		{SourceClassifications: map[string][]string{source: {"PII"}}},
+		{EncryptedOnlyClassifications: []string{""}},
+		{EncryptedDestinations: []string{""}},
+	} {
+		if err := broken.ValidateClassifications(); err == nil {
+			t.Errorf("Expected an error for %+v", broken)
+		}
+	}
+
+	mirrored := &Config{
+		SourcePaths:           []string{source},
+		Method:                constants.MethodCheckpoint,
+		Output:                constants.OutputMirror,
+		MirrorTarget:          "backup@nas:/backups",
+		SourceClassifications: map[string][]string{source: {"pii"}},
+	}
+	if err := mirrored.Validate(); !errors.Is(err, apperr.ErrPolicy) {
+		t.Errorf("Expected a policy violation for mirroring pii to an unencrypted target, got: %v", err)
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	window, err := ParseTimeWindow("02:00-06:30")
+	if err != nil {
+		t.Fatalf("ParseTimeWindow failed: %v", err)
+	}
+	if window.Start != 120 || window.End != 390 || window.String() != "02:00-06:30" {
+		t.Errorf("Unexpected window %+v (%s)", window, window)
+	}
+
+	for _, value := range []string{"02:00", "2am-6am", "02:00-25:00", "03:00-03:00", ""} {
+		if _, err := ParseTimeWindow(value); err == nil {
+			t.Errorf("Expected an error for window %q", value)
+		}
+	}
+}
+
+func TestTimeWindow_Deadline(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window string
+		now    time.Time
+		want   time.Time
+		inside bool
+	}{
+		{"02:00-06:00", at(10, 3, 15), at(10, 6, 0), true},
+		{"02:00-06:00", at(10, 2, 0), at(10, 6, 0), true},
+		{"02:00-06:00", at(10, 6, 0), time.Time{}, false},
+		{"02:00-06:00", at(10, 13, 0), time.Time{}, false},
+		// Crossing midnight: the evening part ends the next morning
+		{"22:00-04:00", at(10, 23, 30), at(11, 4, 0), true},
+		{"22:00-04:00", at(11, 1, 0), at(11, 4, 0), true},
+		{"22:00-04:00", at(11, 12, 0), time.Time{}, false},
+		// Month boundaries are handled by time.Date
+		{"22:00-04:00", at(31, 22, 0), time.Date(2024, time.April, 1, 4, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		window, err := ParseTimeWindow(tt.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, inside := window.Deadline(tt.now)
+		if inside != tt.inside || !got.Equal(tt.want) {
+			t.Errorf("%s at %s: Deadline() = %s, %t; want %s, %t", tt.window, tt.now.Format("Jan 2 15:04"), got, inside, tt.want, tt.inside)
+		}
+	}
+}
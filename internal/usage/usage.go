@@ -0,0 +1,71 @@
+// Package usage measures the resources a run consumes, so backup windows can
+// be planned from data: CPU time, storage I/O and memory of the process, and
+// of the cgroup it runs in where the platform has one.
+package usage
+
+import (
+	"fmt"
+
+	"archiveFiles/internal/utils"
+)
+
+// Usage is the resource consumption of a run
+type Usage struct {
+	CPUSeconds   float64      `json:"cpu_seconds"`      // User plus system CPU time, including child processes such as xz or ssh
+	ReadBytes    int64        `json:"read_bytes"`       // Bytes read from storage; reads served by the page cache are not counted (Linux)
+	WrittenBytes int64        `json:"written_bytes"`    // Bytes written to storage (Linux)
+	PeakRSSBytes int64        `json:"peak_rss_bytes"`   // Highest resident set size of the process so far, not only during the run
+	Cgroup       *CgroupUsage `json:"cgroup,omitempty"` // The cgroup (e.g. container) the process runs in, with cgroup v2 on Linux
+}
+
+// CgroupUsage is the resource consumption of a whole cgroup, which includes
+// every process in it and not only this one
+type CgroupUsage struct {
+	Path            string  `json:"path"` // Below the cgroup v2 mount, e.g. /kubepods/pod1234/abcd
+	CPUSeconds      float64 `json:"cpu_seconds"`
+	ReadBytes       int64   `json:"read_bytes"`
+	WrittenBytes    int64   `json:"written_bytes"`
+	PeakMemoryBytes int64   `json:"peak_memory_bytes,omitempty"` // memory.peak of the cgroup so far (Linux 5.19 and later)
+}
+
+// Read returns the counters of the process so far. Subtract an earlier
+// reading with Since to get the usage in between.
+func Read() (Usage, error) {
+	current, err := readProcess()
+	if err != nil {
+		return Usage{}, err
+	}
+	// A missing or unreadable cgroup only leaves the cgroup part out
+	if cgroup, err := readCgroup(); err == nil {
+		current.Cgroup = cgroup
+	}
+	return current, nil
+}
+
+// Since returns the usage between the earlier reading before and u. Peaks
+// are not counters and are taken from u.
+func (u Usage) Since(before Usage) Usage {
+	delta := Usage{
+		CPUSeconds:   u.CPUSeconds - before.CPUSeconds,
+		ReadBytes:    u.ReadBytes - before.ReadBytes,
+		WrittenBytes: u.WrittenBytes - before.WrittenBytes,
+		PeakRSSBytes: u.PeakRSSBytes,
+	}
+	// Only a cgroup read both times is comparable; processes can move
+	if u.Cgroup != nil && before.Cgroup != nil && u.Cgroup.Path == before.Cgroup.Path {
+		delta.Cgroup = &CgroupUsage{
+			Path:            u.Cgroup.Path,
+			CPUSeconds:      u.Cgroup.CPUSeconds - before.Cgroup.CPUSeconds,
+			ReadBytes:       u.Cgroup.ReadBytes - before.Cgroup.ReadBytes,
+			WrittenBytes:    u.Cgroup.WrittenBytes - before.Cgroup.WrittenBytes,
+			PeakMemoryBytes: u.Cgroup.PeakMemoryBytes,
+		}
+	}
+	return delta
+}
+
+// String summarizes the usage for a log line
+func (u Usage) String() string {
+	return fmt.Sprintf("CPU %.1fs, read %s, written %s, peak RSS %s",
+		u.CPUSeconds, utils.FormatBytes(u.ReadBytes), utils.FormatBytes(u.WrittenBytes), utils.FormatBytes(u.PeakRSSBytes))
+}
@@ -0,0 +1,33 @@
+package usage
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// readProcess returns the CPU time and peak RSS of the process and its
+// waited-for children from getrusage. macOS counts block operations, not
+// bytes, so storage I/O is left at zero.
+func readProcess() (Usage, error) {
+	var self, children syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &self); err != nil {
+		return Usage{}, fmt.Errorf("failed to read resource usage: %v", err)
+	}
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children); err != nil {
+		return Usage{}, fmt.Errorf("failed to read resource usage of child processes: %v", err)
+	}
+	return Usage{
+		CPUSeconds:   cpuSeconds(self) + cpuSeconds(children),
+		PeakRSSBytes: self.Maxrss, // macOS reports bytes
+	}, nil
+}
+
+// cpuSeconds returns the user plus system time of a getrusage result
+func cpuSeconds(r syscall.Rusage) float64 {
+	return float64(r.Utime.Sec+r.Stime.Sec) + float64(r.Utime.Usec+r.Stime.Usec)/1e6
+}
+
+// readCgroup is not implemented on this platform
+func readCgroup() (*CgroupUsage, error) {
+	return nil, fmt.Errorf("cgroups are not available on this platform")
+}
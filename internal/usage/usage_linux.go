@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cgroupRoots are where the cgroup v2 hierarchy is mounted: on its own, or
+// next to the v1 controllers on hybrid hosts
+var cgroupRoots = []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"}
+
+// readProcess returns the counters of the process and its waited-for
+// children from getrusage. Block counts are in 512-byte units, the same
+// counters /proc/self/io reports as read_bytes and write_bytes. The
+// fields are 32 bits wide on 32-bit platforms, so they are widened first.
+func readProcess() (Usage, error) {
+	var self, children syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &self); err != nil {
+		return Usage{}, fmt.Errorf("failed to read resource usage: %v", err)
+	}
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children); err != nil {
+		return Usage{}, fmt.Errorf("failed to read resource usage of child processes: %v", err)
+	}
+	return Usage{
+		CPUSeconds:   cpuSeconds(self) + cpuSeconds(children),
+		ReadBytes:    (int64(self.Inblock) + int64(children.Inblock)) * 512,
+		WrittenBytes: (int64(self.Oublock) + int64(children.Oublock)) * 512,
+		PeakRSSBytes: int64(self.Maxrss) * 1024, // Linux reports kilobytes
+	}, nil
+}
+
+// cpuSeconds returns the user plus system time of a getrusage result
+func cpuSeconds(r syscall.Rusage) float64 {
+	return float64(r.Utime.Sec+r.Stime.Sec) + float64(r.Utime.Usec+r.Stime.Usec)/1e6
+}
+
+// readCgroup returns the counters of the cgroup v2 group of the process
+func readCgroup() (*CgroupUsage, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	path, err := parseCgroupPath(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every cgroup v2 group has cpu.stat, whichever controllers are enabled
+	var dir string
+	var file *os.File
+	for _, root := range cgroupRoots {
+		dir = filepath.Join(root, path)
+		if file, err = os.Open(filepath.Join(dir, "cpu.stat")); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	cgroup := &CgroupUsage{Path: path}
+	usec, err := parseCPUStat(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	cgroup.CPUSeconds = float64(usec) / 1e6
+
+	// io.stat is missing without the io controller; CPU alone still helps
+	if file, err := os.Open(filepath.Join(dir, "io.stat")); err == nil {
+		cgroup.ReadBytes, cgroup.WrittenBytes, err = parseIOStat(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "memory.peak")); err == nil {
+		cgroup.PeakMemoryBytes, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	return cgroup, nil
+}
+
+// parseCgroupPath returns the cgroup v2 path from /proc/self/cgroup, the
+// line reading "0::/path". Hosts on cgroup v1 have no such line.
+func parseCgroupPath(data string) (string, error) {
+	for _, line := range strings.Split(data, "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy")
+}
+
+// parseCPUStat returns usage_usec from a cgroup cpu.stat file
+func parseCPUStat(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("cpu.stat has no usage_usec")
+}
+
+// parseIOStat sums rbytes and wbytes over the devices of a cgroup io.stat
+// file, whose lines read "major:minor rbytes=N wbytes=N rios=N ..."
+func parseIOStat(r io.Reader) (read, written int64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for _, field := range fields[min(1, len(fields)):] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid io.stat field %q", field)
+			}
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				written += n
+			}
+		}
+	}
+	return read, written, scanner.Err()
+}
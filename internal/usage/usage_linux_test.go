@@ -0,0 +1,42 @@
+package usage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCgroupPath(t *testing.T) {
+	path, err := parseCgroupPath("0::/kubepods/burstable/pod1234/abcd\n")
+	if err != nil || path != "/kubepods/burstable/pod1234/abcd" {
+		t.Errorf("parseCgroupPath = %q, %v", path, err)
+	}
+	hybrid := "4:memory:/user.slice\n1:name=systemd:/user.slice\n0::/user.slice/session-1.scope\n"
+	if path, _ := parseCgroupPath(hybrid); path != "/user.slice/session-1.scope" {
+		t.Errorf("parseCgroupPath(hybrid) = %q", path)
+	}
+	if _, err := parseCgroupPath("4:memory:/user.slice\n1:cpu:/\n"); err == nil {
+		t.Error("parseCgroupPath accepted a cgroup v1 only host")
+	}
+}
+
+func TestParseCPUStat(t *testing.T) {
+	usec, err := parseCPUStat(strings.NewReader("usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n"))
+	if err != nil || usec != 2500000 {
+		t.Errorf("parseCPUStat = %d, %v", usec, err)
+	}
+	if _, err := parseCPUStat(strings.NewReader("nr_periods 0\n")); err == nil {
+		t.Error("parseCPUStat accepted a file without usage_usec")
+	}
+}
+
+func TestParseIOStat(t *testing.T) {
+	data := "8:0 rbytes=1048576 wbytes=4096 rios=10 wios=1 dbytes=0 dios=0\n" +
+		"253:1 rbytes=2048 wbytes=8192 rios=2 wios=3 dbytes=0 dios=0\n"
+	read, written, err := parseIOStat(strings.NewReader(data))
+	if err != nil || read != 1050624 || written != 12288 {
+		t.Errorf("parseIOStat = %d, %d, %v", read, written, err)
+	}
+	if _, _, err := parseIOStat(strings.NewReader("8:0 rbytes=x\n")); err == nil {
+		t.Error("parseIOStat accepted a malformed value")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package usage
+
+import "fmt"
+
+// readProcess is not implemented on this platform
+func readProcess() (Usage, error) {
+	return Usage{}, fmt.Errorf("resource usage is not available on this platform")
+}
+
+// readCgroup is not implemented on this platform
+func readCgroup() (*CgroupUsage, error) {
+	return nil, fmt.Errorf("cgroups are not available on this platform")
+}
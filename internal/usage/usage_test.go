@@ -0,0 +1,43 @@
+package usage
+
+import "testing"
+
+func TestSince(t *testing.T) {
+	before := Usage{CPUSeconds: 1, ReadBytes: 100, WrittenBytes: 10, PeakRSSBytes: 50,
+		Cgroup: &CgroupUsage{Path: "/job", CPUSeconds: 2, ReadBytes: 1000, PeakMemoryBytes: 70}}
+	after := Usage{CPUSeconds: 4.5, ReadBytes: 300, WrittenBytes: 60, PeakRSSBytes: 80,
+		Cgroup: &CgroupUsage{Path: "/job", CPUSeconds: 7, ReadBytes: 5000, WrittenBytes: 20, PeakMemoryBytes: 90}}
+
+	delta := after.Since(before)
+	if delta.CPUSeconds != 3.5 || delta.ReadBytes != 200 || delta.WrittenBytes != 50 || delta.PeakRSSBytes != 80 {
+		t.Errorf("Since = %+v", delta)
+	}
+	if delta.Cgroup == nil || delta.Cgroup.CPUSeconds != 5 || delta.Cgroup.ReadBytes != 4000 ||
+		delta.Cgroup.WrittenBytes != 20 || delta.Cgroup.PeakMemoryBytes != 90 {
+		t.Errorf("Since cgroup = %+v", delta.Cgroup)
+	}
+
+	// A process moved to another cgroup has no comparable reading
+	after.Cgroup.Path = "/elsewhere"
+	if delta := after.Since(before); delta.Cgroup != nil {
+		t.Errorf("Since compared different cgroups: %+v", delta.Cgroup)
+	}
+}
+
+func TestRead(t *testing.T) {
+	before, err := Read()
+	if err != nil {
+		t.Skipf("Resource usage not available: %v", err)
+	}
+	after, err := Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	delta := after.Since(before)
+	if delta.CPUSeconds < 0 || delta.ReadBytes < 0 || delta.WrittenBytes < 0 {
+		t.Errorf("Counters went backwards: %+v", delta)
+	}
+	if after.PeakRSSBytes <= 0 {
+		t.Errorf("PeakRSSBytes = %d", after.PeakRSSBytes)
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"archiveFiles/internal/constants"
+)
+
+// ListRocksDBBlobFiles returns the BlobDB blob files of a RocksDB directory,
+// relative to dbPath. Integrated BlobDB keeps them next to the SST files; the
+// legacy stackable BlobDB keeps them in a "blob" subdirectory.
+func ListRocksDBBlobFiles(dbPath string) ([]string, error) {
+	var blobFiles []string
+	for _, dir := range []string{"", constants.RocksDBLegacyBlobDir} {
+		entries, err := os.ReadDir(filepath.Join(dbPath, dir))
+		if err != nil {
+			if dir != "" && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), constants.RocksDBBlobFileExt) {
+				blobFiles = append(blobFiles, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	sort.Strings(blobFiles)
+	return blobFiles, nil
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/faults"
+)
+
+// copyBuffers holds constants.CopyBufferSize buffers shared by all copies
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, constants.CopyBufferSize)
+		return &buf
+	},
+}
+
+// dropPageCache makes CopyFile evict source pages from the page cache once
+// they are copied
+var dropPageCache atomic.Bool
+
+// SetDropPageCache sets whether CopyFile evicts copied source data from the
+// page cache, so that a large backup does not push the application's hot
+// data out of memory
+func SetDropPageCache(enabled bool) {
+	dropPageCache.Store(enabled)
+}
+
+// smallReadahead makes CopyFile leave out the sequential access hint
+var smallReadahead atomic.Bool
+
+// SetSmallReadahead sets whether CopyFile leaves the kernel's readahead at
+// its default instead of hinting sequential access, which doubles it, so
+// that low-priority runs keep their reads small
+func SetSmallReadahead(enabled bool) {
+	smallReadahead.Store(enabled)
+}
+
+// preread makes CopyFile read each source file once before copying it
+var preread atomic.Bool
+
+// SetPreread sets whether CopyFile reads each source file sequentially into
+// the page cache before copying it, so that the copy and the checksum passes
+// after it read from memory instead of seeking between source and target on
+// a spinning disk. Files larger than constants.PrereadMaxSize are copied
+// directly.
+func SetPreread(enabled bool) {
+	preread.Store(enabled)
+}
+
+// copyChecksums holds a copiedFile for each target path CopyFile wrote,
+// with the SHA-256 of the source data computed as it went by
+var copyChecksums sync.Map
+
+// copiedFile is what CopyFile wrote to a target path
+type copiedFile struct {
+	sum     string
+	size    int64
+	modTime time.Time
+}
+
+// CopyChecksum returns the SHA-256 of what CopyFile copied to targetPath
+// during this run, so verification can check the copy without reading the
+// source again. A target replaced since, e.g. by a fallback method after a
+// failed copy, has no checksum.
+func CopyChecksum(targetPath string) (string, bool) {
+	value, ok := copyChecksums.Load(filepath.Clean(targetPath))
+	if !ok {
+		return "", false
+	}
+	copied := value.(copiedFile)
+	info, err := os.Stat(targetPath)
+	if err != nil || info.Size() != copied.size || !info.ModTime().Equal(copied.modTime) {
+		return "", false
+	}
+	return copied.sum, true
+}
+
+// ResetCopyChecksums forgets the checksums of earlier copies, so a
+// long-running process does not accumulate them across runs
+func ResetCopyChecksums() {
+	copyChecksums.Range(func(key, _ interface{}) bool {
+		copyChecksums.Delete(key)
+		return true
+	})
+}
+
+// CopyFile copies a file from source to target in large chunks, hinting
+// sequential access to the kernel so it reads ahead (see SetSmallReadahead). It does not use
+// copy_file_range, which would leave no point to drop cached pages. The
+// data is hashed on its way through, see CopyChecksum.
+func CopyFile(sourcePath, targetPath string) error {
+	return CopyFileThrottled(sourcePath, targetPath, nil)
+}
+
+// CopyFileThrottled is CopyFile paced by throttle; a nil throttle copies
+// at full speed. Throttled copies are not pre-read, which would read the
+// whole file at full speed first.
+func CopyFileThrottled(sourcePath, targetPath string, throttle *Throttle) error {
+	if err := faults.Inject("copy " + sourcePath); err != nil {
+		return err
+	}
+
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %v", err)
+	}
+	defer sourceFile.Close()
+
+	targetFile, err := os.Create(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to create target file: %v", err)
+	}
+	defer targetFile.Close()
+
+	started := time.Now()
+	if !smallReadahead.Load() {
+		adviseSequential(sourceFile)
+	}
+	if preread.Load() && throttle == nil {
+		if err := prereadFile(sourceFile); err != nil {
+			return fmt.Errorf("failed to pre-read source file: %v", err)
+		}
+	}
+	hash := sha256.New()
+	copied, err := copyChunks(io.MultiWriter(targetFile, hash), sourceFile, dropPageCache.Load(), throttle)
+	if err != nil {
+		return fmt.Errorf("failed to copy file: %v", err)
+	}
+	logThroughput(sourcePath, copied, time.Since(started))
+	if info, err := targetFile.Stat(); err == nil {
+		copyChecksums.Store(filepath.Clean(targetPath), copiedFile{sum: hex.EncodeToString(hash.Sum(nil)), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	// Preserve file permissions
+	if sourceInfo, err := os.Stat(sourcePath); err == nil {
+		if chmodErr := os.Chmod(targetPath, sourceInfo.Mode()); chmodErr != nil {
+			// Log error but don't fail the copy operation
+			log.Warning("Failed to preserve file permissions for %s: %v", targetPath, chmodErr)
+		}
+	}
+
+	return nil
+}
+
+// prereadFile reads file from start to end so its pages are cached, then
+// rewinds it. Files too large to stay cached are left alone.
+func prereadFile(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > constants.PrereadMaxSize {
+		return nil
+	}
+
+	bufPtr := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bufPtr)
+	buf := *bufPtr
+	for {
+		WaitWhilePaused(context.Background())
+		_, err := file.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	return err
+}
+
+// copyChunks copies source to target through a pooled buffer. With
+// dropCache, each chunk is evicted from the page cache after it is written;
+// with a throttle, each chunk waits for its share of the rate.
+func copyChunks(target io.Writer, source *os.File, dropCache bool, throttle *Throttle) (int64, error) {
+	bufPtr := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bufPtr)
+	buf := *bufPtr
+
+	var copied int64
+	for {
+		// Copies have no context; a pause holds them until resumed
+		WaitWhilePaused(context.Background())
+
+		n, readErr := source.Read(buf)
+		if n > 0 {
+			if _, err := target.Write(buf[:n]); err != nil {
+				return copied, err
+			}
+			if dropCache {
+				adviseDontNeed(source, copied, int64(n))
+			}
+			copied += int64(n)
+			throttle.wait(int64(n))
+		}
+		if readErr == io.EOF {
+			return copied, nil
+		}
+		if readErr != nil {
+			return copied, readErr
+		}
+	}
+}
+
+// Throttle paces copies to a number of bytes per second, counted across
+// all the copies it is passed to
+type Throttle struct {
+	bytesPerSecond int64
+	started        time.Time
+
+	mu     sync.Mutex
+	copied int64
+}
+
+// NewThrottle returns a throttle allowing bytesPerSecond from now on
+func NewThrottle(bytesPerSecond int64) *Throttle {
+	return &Throttle{bytesPerSecond: bytesPerSecond, started: time.Now()}
+}
+
+// wait accounts for n copied bytes and blocks until they fit in the rate
+func (t *Throttle) wait(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.copied += n
+	due := t.started.Add(time.Duration(float64(t.copied) / float64(t.bytesPerSecond) * float64(time.Second)))
+	t.mu.Unlock()
+	if delay := time.Until(due); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// logThroughput reports the copy rate of files large enough for it to mean
+// something
+func logThroughput(path string, size int64, elapsed time.Duration) {
+	if size < constants.CopyThroughputMinSize || elapsed <= 0 {
+		return
+	}
+	rate := int64(float64(size) / elapsed.Seconds())
+	log.Debug("Copied %s (%s) in %s, %s/s", path, FormatBytes(size), FormatDuration(elapsed), FormatBytes(rate))
+}
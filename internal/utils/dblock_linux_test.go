@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// fOFDSetLK is F_OFD_SETLK, which the syscall package does not define. Open
+// file description locks conflict with F_GETLK queries from the same
+// process, so a lock held by another process can be simulated in-process.
+const fOFDSetLK = 37
+
+// holdOFDLock write-locks path like a RocksDB writer would hold its LOCK
+// file, until the returned file is closed
+func holdOFDLock(t *testing.T, path string) *os.File {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(file.Fd(), fOFDSetLK, &lock); err != nil {
+		file.Close()
+		t.Skipf("Open file description locks not supported: %v", err)
+	}
+	return file
+}
+
+func TestRocksDBLockHolder(t *testing.T) {
+	dbPath := t.TempDir()
+
+	if held, _, err := RocksDBLockHolder(dbPath); err != nil || held {
+		t.Errorf("Database without LOCK file: held = %t, err = %v", held, err)
+	}
+
+	lockPath := filepath.Join(dbPath, "LOCK")
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if held, _, err := RocksDBLockHolder(dbPath); err != nil || held {
+		t.Errorf("Closed database: held = %t, err = %v", held, err)
+	}
+
+	writer := holdOFDLock(t, lockPath)
+	held, _, err := RocksDBLockHolder(dbPath)
+	if err != nil || !held {
+		t.Errorf("Open database: held = %t, err = %v", held, err)
+	}
+
+	writer.Close()
+	if held, _, err := RocksDBLockHolder(dbPath); err != nil || held {
+		t.Errorf("Database after writer exit: held = %t, err = %v", held, err)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// RocksDBLockHolder reports whether another process holds the LOCK file of
+// a RocksDB database, and its PID when the system reports one (0 otherwise).
+// RocksDB takes a POSIX record lock on LOCK while the database is open for
+// writing; F_GETLK finds it without taking it.
+func RocksDBLockHolder(dbPath string) (bool, int, error) {
+	file, err := os.Open(filepath.Join(dbPath, "LOCK"))
+	if os.IsNotExist(err) {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to open LOCK file: %v", err)
+	}
+	defer file.Close()
+
+	// Ask whether a write lock on the whole file could be taken
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(file.Fd(), syscall.F_GETLK, &lock); err != nil {
+		return false, 0, fmt.Errorf("failed to query LOCK file: %v", err)
+	}
+	if lock.Type == syscall.F_UNLCK {
+		return false, 0, nil
+	}
+	// Open file description locks are reported with a PID of -1
+	return true, max(int(lock.Pid), 0), nil
+}
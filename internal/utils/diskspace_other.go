@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package utils
+
+// FreeSpace is not available on this platform
+func FreeSpace(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,25 @@
+//go:build linux && (amd64 || arm64 || riscv64 || ppc64le || s390x)
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// posix_fadvise advice values
+const (
+	fadvSequential = 2
+	fadvDontNeed   = 4
+)
+
+// adviseSequential asks the kernel for aggressive readahead on file. It is
+// only a hint, so errors are ignored.
+func adviseSequential(file *os.File) {
+	syscall.Syscall6(syscall.SYS_FADVISE64, file.Fd(), 0, 0, fadvSequential, 0, 0)
+}
+
+// adviseDontNeed asks the kernel to drop the cached pages of a file range
+func adviseDontNeed(file *os.File, offset, length int64) {
+	syscall.Syscall6(syscall.SYS_FADVISE64, file.Fd(), uintptr(offset), uintptr(length), fadvDontNeed, 0, 0)
+}
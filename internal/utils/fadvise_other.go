@@ -0,0 +1,11 @@
+//go:build !(linux && (amd64 || arm64 || riscv64 || ppc64le || s390x))
+
+package utils
+
+import "os"
+
+// adviseSequential is a no-op where posix_fadvise is not available
+func adviseSequential(file *os.File) {}
+
+// adviseDontNeed is a no-op where posix_fadvise is not available
+func adviseDontNeed(file *os.File, offset, length int64) {}
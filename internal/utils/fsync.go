@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SyncFile flushes a file's contents to stable storage
+func SyncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for sync: %v", path, err)
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %v", path, err)
+	}
+	return nil
+}
+
+// SyncDir flushes a directory entry table so that created, renamed or
+// removed entries survive a power loss
+func SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s for sync: %v", path, err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %v", path, err)
+	}
+	return nil
+}
+
+// SyncTree fsyncs every regular file under root, and every directory as well
+// when syncDirs is true. Files are synced before their parent directories.
+func SyncTree(root string, syncDirs bool) error {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if syncDirs {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return SyncFile(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Sync deepest directories first so parents are flushed last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := SyncDir(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,19 +1,58 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"archiveFiles/internal/sqlitedb"
+
 	"github.com/linxGnu/grocksdb"
 )
 
+// Write load limits and naming
+const (
+	MaxWriteLoad       = 100000                     // Highest supported writes per second
+	writeLoadKeyPrefix = "archivefiles_write_load_" // RocksDB key prefix of generated writes
+	writeLoadTable     = "archivefiles_write_load"  // SQLite table receiving generated writes
+	writeLoadPayload   = 256                        // Bytes of random payload per write
+)
+
+// LockOptions controls how long a lock is held and what happens meanwhile
+type LockOptions struct {
+	Duration  time.Duration // How long to hold the lock (0 = until SIGINT/SIGTERM)
+	WriteLoad int           // Background writes per second while held (0 = none)
+}
+
+// ParseWriteLoad parses a write rate such as "100/s" or "100" into writes
+// per second
+func ParseWriteLoad(s string) (int, error) {
+	value := strings.TrimSuffix(strings.TrimSpace(s), "/s")
+	rate, err := strconv.Atoi(value)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid write load %q, expected a positive rate such as 100/s", s)
+	}
+	if rate > MaxWriteLoad {
+		return 0, fmt.Errorf("write load %d/s exceeds the maximum of %d/s", rate, MaxWriteLoad)
+	}
+	return rate, nil
+}
+
 // LockRocksDB locks a RocksDB database for testing purposes
 func LockRocksDB(dbPath string, duration time.Duration) error {
-	log.Printf("Locking RocksDB database: %s", dbPath)
+	return LockRocksDBWithOptions(dbPath, LockOptions{Duration: duration})
+}
+
+// LockRocksDBWithOptions locks a RocksDB database for testing purposes and
+// optionally writes to it in the background while the lock is held
+func LockRocksDBWithOptions(dbPath string, lockOpts LockOptions) error {
+	log.Info("Locking RocksDB database: %s", dbPath)
 
 	// Open database (this creates the lock file)
 	opts := grocksdb.NewDefaultOptions()
@@ -26,35 +65,128 @@ func LockRocksDB(dbPath string, duration time.Duration) error {
 	}
 	defer db.Close()
 
-	log.Printf("Database locked: %s", dbPath)
-	log.Printf("Lock duration: %v", duration)
+	writeOpts := grocksdb.NewDefaultWriteOptions()
+	defer writeOpts.Destroy()
+
+	log.Info("Database locked: %s", dbPath)
+	return holdLock(dbPath, lockOpts, func(n int) error {
+		key := fmt.Sprintf("%s%012d", writeLoadKeyPrefix, n)
+		return db.Put(writeOpts, []byte(key), randomPayload())
+	})
+}
+
+// LockSQLite holds a SQLite database busy for testing purposes. Without a
+// write load it holds an exclusive transaction (BEGIN EXCLUSIVE), so other
+// connections cannot write to it. With a write load it commits each write in
+// its own transaction instead, so other connections see a busy but live
+// database.
+func LockSQLite(dbPath string, lockOpts LockOptions) error {
+	log.Info("Locking SQLite database: %s", dbPath)
+
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("failed to open database for locking: %v", err)
+	}
+	db, err := sqlitedb.Open(dbPath, sqlitedb.ReadWrite)
+	if err != nil {
+		return fmt.Errorf("failed to open database for locking: %v", err)
+	}
+	defer db.Close()
+
+	// Pin a single connection: transactions belong to a connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open database for locking: %v", err)
+	}
+	defer conn.Close()
+
+	if lockOpts.WriteLoad > 0 {
+		createTable := "CREATE TABLE IF NOT EXISTS " + writeLoadTable +
+			" (id INTEGER PRIMARY KEY, written_at INTEGER NOT NULL, payload BLOB NOT NULL)"
+		if _, err := conn.ExecContext(ctx, createTable); err != nil {
+			return fmt.Errorf("failed to create write load table: %v", err)
+		}
+
+		log.Info("Database busy: %s", dbPath)
+		insert := "INSERT INTO " + writeLoadTable + " (written_at, payload) VALUES (?, ?)"
+		return holdLock(dbPath, lockOpts, func(int) error {
+			_, err := conn.ExecContext(ctx, insert, time.Now().UnixNano(), randomPayload())
+			return err
+		})
+	}
+
+	if _, err := conn.ExecContext(ctx, "BEGIN EXCLUSIVE"); err != nil {
+		return fmt.Errorf("failed to acquire exclusive lock: %v", err)
+	}
+	defer conn.ExecContext(ctx, "ROLLBACK")
+
+	log.Info("Database locked: %s", dbPath)
+	return holdLock(dbPath, lockOpts, nil)
+}
+
+// holdLock blocks until the lock duration expires or a signal arrives,
+// calling write at the configured rate in the meantime
+func holdLock(dbPath string, lockOpts LockOptions, write func(n int) error) error {
+	log.Info("Lock duration: %v", lockOpts.Duration)
 
 	// Set up signal handling for graceful exit
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	// If duration is specified, use a timer
-	if duration > 0 {
-		timer := time.NewTimer(duration)
+	var expired <-chan time.Time
+	if lockOpts.Duration > 0 {
+		timer := time.NewTimer(lockOpts.Duration)
 		defer timer.Stop()
+		expired = timer.C
+	} else {
+		log.Info("Database locked, press Ctrl+C to release lock...")
+	}
+
+	var tick <-chan time.Time
+	if write != nil && lockOpts.WriteLoad > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(lockOpts.WriteLoad))
+		defer ticker.Stop()
+		tick = ticker.C
+		log.Info("Generating %d writes/s", lockOpts.WriteLoad)
+	}
 
+	writes := 0
+	for {
 		select {
-		case <-timer.C:
-			log.Printf("Lock duration expired, releasing lock: %s", dbPath)
+		case <-tick:
+			if err := write(writes); err != nil {
+				return fmt.Errorf("background write failed after %d writes: %v", writes, err)
+			}
+			writes++
+		case <-expired:
+			log.Info("Lock duration expired, releasing lock: %s", dbPath)
+			return releaseLock(dbPath, tick != nil, writes)
 		case sig := <-sigChan:
-			log.Printf("Received signal %v, releasing lock: %s", sig, dbPath)
+			log.Info("Received signal %v, releasing lock: %s", sig, dbPath)
+			return releaseLock(dbPath, tick != nil, writes)
 		}
-	} else {
-		// If no duration specified, wait for signal
-		log.Printf("Database locked, press Ctrl+C to release lock...")
-		sig := <-sigChan
-		log.Printf("Received signal %v, releasing lock: %s", sig, dbPath)
 	}
+}
 
-	log.Printf("Database lock released: %s", dbPath)
+// releaseLock logs the end of a lock and how many writes were generated
+func releaseLock(dbPath string, wrote bool, writes int) error {
+	if wrote {
+		log.Info("Generated %d writes", writes)
+	}
+	log.Info("Database lock released: %s", dbPath)
 	return nil
 }
 
+// randomPayload returns random bytes for a generated write, so the data
+// does not compress away
+func randomPayload() []byte {
+	payload := make([]byte, writeLoadPayload)
+	rand.Read(payload)
+	return payload
+}
+
 // IsRocksDBLocked checks if a RocksDB database is locked
 func IsRocksDBLocked(dbPath string) bool {
 	opts := grocksdb.NewDefaultOptions()
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseWriteLoad(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"100/s", 100, false},
+		{"5", 5, false},
+		{" 20/s ", 20, false},
+		{"0/s", 0, true},
+		{"-3/s", 0, true},
+		{"fast", 0, true},
+		{"100/m", 0, true},
+		{"1000000/s", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseWriteLoad(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWriteLoad() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseWriteLoad() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// createSQLiteDB creates a small SQLite database for lock tests
+func createSQLiteDB(t *testing.T) string {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	return dbPath
+}
+
+func TestLockSQLite(t *testing.T) {
+	t.Run("Exclusive lock blocks writers", func(t *testing.T) {
+		dbPath := createSQLiteDB(t)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- LockSQLite(dbPath, LockOptions{Duration: 500 * time.Millisecond})
+		}()
+		time.Sleep(150 * time.Millisecond)
+
+		other, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=0")
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer other.Close()
+
+		if _, err := other.Exec("INSERT INTO items (name) VALUES ('blocked')"); err == nil {
+			t.Error("Expected write to fail while the database is locked")
+		}
+
+		if err := <-done; err != nil {
+			t.Fatalf("LockSQLite failed: %v", err)
+		}
+		if _, err := other.Exec("INSERT INTO items (name) VALUES ('released')"); err != nil {
+			t.Errorf("Expected write to succeed after release: %v", err)
+		}
+	})
+
+	t.Run("Write load", func(t *testing.T) {
+		dbPath := createSQLiteDB(t)
+
+		if err := LockSQLite(dbPath, LockOptions{Duration: 300 * time.Millisecond, WriteLoad: 100}); err != nil {
+			t.Fatalf("LockSQLite failed: %v", err)
+		}
+
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + writeLoadTable).Scan(&count); err != nil {
+			t.Fatalf("Failed to count generated writes: %v", err)
+		}
+		if count == 0 {
+			t.Error("Expected generated writes to be committed")
+		}
+	})
+
+	t.Run("Missing database", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing.sqlite")
+		if err := LockSQLite(missing, LockOptions{Duration: time.Millisecond}); err == nil {
+			t.Error("Expected error for a missing database")
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ioPause halts backup I/O on request: while it is paused, copies stop
+// before their next chunk and no new items start, until it is resumed
+var ioPause struct {
+	mu      sync.Mutex
+	paused  atomic.Bool
+	resumed chan struct{} // Closed by ResumeIO
+}
+
+// PauseIO pauses backup I/O and reports whether it was running
+func PauseIO() bool {
+	ioPause.mu.Lock()
+	defer ioPause.mu.Unlock()
+	if ioPause.paused.Load() {
+		return false
+	}
+	ioPause.resumed = make(chan struct{})
+	ioPause.paused.Store(true)
+	log.Info("Backup I/O paused")
+	return true
+}
+
+// ResumeIO lets paused backup I/O continue and reports whether it was paused
+func ResumeIO() bool {
+	ioPause.mu.Lock()
+	defer ioPause.mu.Unlock()
+	if !ioPause.paused.Load() {
+		return false
+	}
+	ioPause.paused.Store(false)
+	close(ioPause.resumed)
+	log.Info("Backup I/O resumed")
+	return true
+}
+
+// IOPaused reports whether backup I/O is paused
+func IOPaused() bool {
+	return ioPause.paused.Load()
+}
+
+// WaitWhilePaused blocks while backup I/O is paused. It returns the error
+// of ctx if ctx is done first.
+func WaitWhilePaused(ctx context.Context) error {
+	if !ioPause.paused.Load() {
+		return nil
+	}
+	ioPause.mu.Lock()
+	resumed := ioPause.resumed
+	paused := ioPause.paused.Load()
+	ioPause.mu.Unlock()
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
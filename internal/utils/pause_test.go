@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPauseIO(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "source")
+	if err := os.WriteFile(sourcePath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !PauseIO() || PauseIO() {
+		t.Fatal("PauseIO should report true only when I/O was running")
+	}
+	defer ResumeIO()
+	if !IOPaused() {
+		t.Fatal("IOPaused = false after PauseIO")
+	}
+
+	// A copy started during the pause waits for the resume
+	copied := make(chan error, 1)
+	go func() { copied <- CopyFile(sourcePath, filepath.Join(tempDir, "target")) }()
+	select {
+	case err := <-copied:
+		t.Fatalf("CopyFile finished while paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Waiting ends with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WaitWhilePaused(ctx); err != context.Canceled {
+		t.Errorf("WaitWhilePaused = %v, want context.Canceled", err)
+	}
+
+	if !ResumeIO() || ResumeIO() {
+		t.Fatal("ResumeIO should report true only when I/O was paused")
+	}
+	select {
+	case err := <-copied:
+		if err != nil {
+			t.Errorf("CopyFile failed after resume: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CopyFile did not continue after ResumeIO")
+	}
+	if err := WaitWhilePaused(context.Background()); err != nil {
+		t.Errorf("WaitWhilePaused while running = %v", err)
+	}
+}
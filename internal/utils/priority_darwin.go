@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"fmt"
+	"syscall"
+
+	"archiveFiles/internal/constants"
+)
+
+// LowerPriority gives the process the lowest CPU priority. macOS has no
+// I/O scheduling class to set, so disk access keeps its priority.
+func LowerPriority() error {
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, constants.NiceLevel); err != nil {
+		return fmt.Errorf("failed to lower CPU priority: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"archiveFiles/internal/constants"
+)
+
+// ioprio_set arguments from <linux/ioprio.h>
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// LowerPriority gives the process the lowest CPU priority and the idle I/O
+// scheduling class, so it only gets the CPU and disk time the service does
+// not use. Linux keeps both per thread, so every thread is changed; threads
+// started later, and child processes such as xz, inherit them. The idle
+// class only takes effect with an I/O scheduler that supports it (bfq);
+// errors setting it are reported after the CPU priority is lowered.
+func LowerPriority() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return fmt.Errorf("failed to list threads: %v", err)
+	}
+	var ioErr error
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		// Threads may exit while the list is walked
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, constants.NiceLevel); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to lower CPU priority: %v", err)
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift)
+		if errno != 0 && errno != syscall.ESRCH && ioErr == nil {
+			ioErr = fmt.Errorf("failed to set the idle I/O class: %v", errno)
+		}
+	}
+	return ioErr
+}
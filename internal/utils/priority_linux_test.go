@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLowerPriority(t *testing.T) {
+	nice, err := exec.LookPath("nice")
+	if err != nil {
+		t.Skip("nice is not installed")
+	}
+	// The idle I/O class may be refused in containers; the CPU priority is
+	// what is checked
+	if err := LowerPriority(); err != nil {
+		t.Logf("LowerPriority: %v", err)
+	}
+
+	// Child processes inherit the priority of whichever thread starts them
+	out, err := exec.Command(nice).Output()
+	if err != nil {
+		t.Fatalf("nice failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "19" {
+		t.Errorf("Child process niceness = %s, want 19", got)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package utils
+
+import "fmt"
+
+// LowerPriority is not implemented on this platform
+func LowerPriority() error {
+	return fmt.Errorf("lowering the process priority is not supported on this platform")
+}
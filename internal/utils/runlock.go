@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+// ErrRunLocked is returned when another run holds the lock of a destination
+var ErrRunLocked = errors.New("another run is active against this destination")
+
+// RunLock is an exclusive lock on a backup destination, held for one run
+type RunLock struct {
+	file *os.File
+	path string
+}
+
+// NewRunID returns a short random identifier for one run
+func NewRunID() string {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(id)
+}
+
+// AcquireRunLock takes the run lock of a destination directory without
+// waiting. If another run holds it, the error wraps ErrRunLocked and names
+// the holder. The lock is released when the process exits, so a crashed run
+// never leaves a stale lock behind.
+func AcquireRunLock(dir, runID string) (*RunLock, error) {
+	if err := os.MkdirAll(dir, constants.DirPermission); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	path := filepath.Join(dir, constants.RunLockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, constants.FilePermission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run lock %s: %v", path, err)
+	}
+
+	if err := lockFile(file); err != nil {
+		holder, _ := os.ReadFile(path)
+		file.Close()
+		if errors.Is(err, ErrRunLocked) {
+			return nil, fmt.Errorf("%w (%s, held by %s)", ErrRunLocked, dir, strings.TrimSpace(string(holder)))
+		}
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+
+	// Record the holder for the error message of competing runs
+	holder := fmt.Sprintf("pid %d, run %s, since %s\n", os.Getpid(), runID, time.Now().UTC().Format(time.RFC3339))
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(holder), 0)
+	}
+
+	return &RunLock{file: file, path: path}, nil
+}
+
+// Release gives up the lock. The lock file stays in place: removing it would
+// let a competing run lock a file that is about to disappear.
+func (l *RunLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	unlockFile(l.file)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
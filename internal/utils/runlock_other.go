@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd)
+
+package utils
+
+import "os"
+
+// lockFile is not available on this platform, so concurrent runs are not
+// detected
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on this platform
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"archiveFiles/internal/constants"
+)
+
+func TestNewRunID(t *testing.T) {
+	first, second := NewRunID(), NewRunID()
+	if len(first) != 8 {
+		t.Errorf("NewRunID() = %q, want 8 characters", first)
+	}
+	if first == second {
+		t.Errorf("NewRunID() returned %q twice", first)
+	}
+}
+
+func TestAcquireRunLock(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skip("run locks are not enforced on this platform")
+	}
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	lock, err := AcquireRunLock(dir, "aaaa1111")
+	if err != nil {
+		t.Fatalf("AcquireRunLock failed: %v", err)
+	}
+
+	_, err = AcquireRunLock(dir, "bbbb2222")
+	if !errors.Is(err, ErrRunLocked) {
+		t.Fatalf("Second AcquireRunLock error = %v, want ErrRunLocked", err)
+	}
+	if !strings.Contains(err.Error(), "run aaaa1111") {
+		t.Errorf("Error should name the holder: %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, constants.RunLockFileName)); err != nil {
+		t.Errorf("Lock file should be kept after release: %v", err)
+	}
+
+	lock, err = AcquireRunLock(dir, "bbbb2222")
+	if err != nil {
+		t.Fatalf("AcquireRunLock after release failed: %v", err)
+	}
+	lock.Release()
+}
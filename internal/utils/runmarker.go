@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+// RunMarker identifies the run that created a backup directory. It is
+// written when the directory is created and removed once the backup is
+// complete, so a directory still carrying one was left behind by a crash.
+type RunMarker struct {
+	RunID     string    `json:"run_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Host      string    `json:"host,omitempty"`
+	PID       int       `json:"pid"`
+}
+
+// WriteRunMarker marks dir as being written by the run runID
+func WriteRunMarker(dir, runID string) error {
+	host, _ := os.Hostname()
+	data, err := json.Marshal(RunMarker{
+		RunID:     runID,
+		CreatedAt: time.Now().UTC(),
+		Host:      host,
+		PID:       os.Getpid(),
+	})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, constants.RunMarkerFileName)
+	if err := os.WriteFile(path, data, constants.FilePermission); err != nil {
+		return fmt.Errorf("failed to write run marker %s: %v", path, err)
+	}
+	return nil
+}
+
+// ReadRunMarker returns the run marker of dir. The error satisfies
+// os.IsNotExist when dir has none.
+func ReadRunMarker(dir string) (*RunMarker, error) {
+	data, err := os.ReadFile(filepath.Join(dir, constants.RunMarkerFileName))
+	if err != nil {
+		return nil, err
+	}
+	marker := &RunMarker{}
+	if err := json.Unmarshal(data, marker); err != nil {
+		return nil, fmt.Errorf("invalid run marker in %s: %v", dir, err)
+	}
+	return marker, nil
+}
+
+// RemoveRunMarker marks the backup in dir as complete
+func RemoveRunMarker(dir string) error {
+	err := os.Remove(filepath.Join(dir, constants.RunMarkerFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove run marker: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"archiveFiles/internal/constants"
+)
+
+// tmpDir holds the directory set by SetTmpDir
+var tmpDir atomic.Value
+
+// SetTmpDir sets the directory temporary state is created in: secondary
+// instance directories, work directories of append and the remote agent,
+// snapshot mount points and deep verification extractions. Empty means
+// the system default (os.TempDir, i.e. $TMPDIR or /tmp).
+func SetTmpDir(dir string) {
+	tmpDir.Store(dir)
+}
+
+// TmpDir returns the directory temporary state is created in
+func TmpDir() string {
+	if dir, _ := tmpDir.Load().(string); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// MkdirTemp creates a new directory in TmpDir, named after pattern like
+// os.MkdirTemp. pattern should start with constants.TmpPrefix so that
+// RemoveStaleTemp recognises it if the process dies before removing it.
+func MkdirTemp(pattern string) (string, error) {
+	return os.MkdirTemp(TmpDir(), pattern)
+}
+
+// CheckTmpDir checks that dir is a writable directory with at least
+// minFree bytes available. Free space is not checked where it cannot be
+// measured.
+func CheckTmpDir(dir string, minFree uint64) error {
+	probe, err := os.MkdirTemp(dir, constants.TmpPrefix+"probe-")
+	if err != nil {
+		return fmt.Errorf("temporary directory %s is not writable: %v", dir, err)
+	}
+	os.Remove(probe)
+	if free, ok := FreeSpace(dir); ok && free < minFree {
+		return fmt.Errorf("temporary directory %s has %s free, need at least %s", dir, FormatBytes(int64(free)), FormatBytes(int64(minFree)))
+	}
+	return nil
+}
+
+// staleTempKinds are the names, after constants.TmpPrefix, of the
+// directories RemoveStaleTemp may remove. Snapshot mount points are left
+// alone: a stale one may still have a snapshot mounted on it.
+var staleTempKinds = []string{"secondary-", "append-", "agent-", "deep-verify-"}
+
+// RemoveStaleTemp removes the directories in dir that MkdirTemp created
+// and that have not been modified for maxAge, left behind by processes
+// that were killed before cleaning up. Only directories of the current
+// user that are not mount points are removed. It returns the removed paths.
+func RemoveStaleTemp(dir string, maxAge time.Duration) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	parent, err := os.Stat(dir)
+	if err != nil {
+		return nil
+	}
+	var removed []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !isStaleTempName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge || !removableTemp(info, parent) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(path); err == nil {
+			removed = append(removed, path)
+		}
+	}
+	return removed
+}
+
+// isStaleTempName reports whether name is that of a directory
+// RemoveStaleTemp may remove
+func isStaleTempName(name string) bool {
+	for _, kind := range staleTempKinds {
+		if strings.HasPrefix(name, constants.TmpPrefix+kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package utils
+
+import "os"
+
+// removableTemp cannot tell the owner of a directory on this platform, so
+// stale temporary directories are kept
+func removableTemp(info, parent os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// removableTemp reports whether the directory described by info belongs to
+// the current user and is on the same device as its parent, i.e. is not a
+// mount point
+func removableTemp(info, parent os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	parentStat, parentOK := parent.Sys().(*syscall.Stat_t)
+	if !ok || !parentOK {
+		return false
+	}
+	return int(stat.Uid) == os.Getuid() && stat.Dev == parentStat.Dev
+}
@@ -2,15 +2,18 @@ package utils
 
 import (
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
+
+	"archiveFiles/internal/logger"
 )
 
+// log is the logger of the utils module
+var log = logger.NewModule("utils")
+
 // CalculateSize calculates the total size of a file or directory
 func CalculateSize(path string) int64 {
 	var size int64
@@ -59,50 +62,19 @@ func FormatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dh%dm", hours, minutes)
 }
 
-// TruncateString truncates string to specified length
+// TruncateString truncates string to at most length terminal columns. Runes
+// are never split, and wide (e.g. CJK) characters count as two columns.
 func TruncateString(s string, length int) string {
-	// Convert to runes for proper Unicode handling
-	runes := []rune(s)
-	if len(runes) <= length {
+	if DisplayWidth(s) <= length {
 		return s
 	}
 	if length < 3 {
 		if length <= 0 {
 			return ""
 		}
-		return string(runes[:length])
+		return truncateWidth(s, length)
 	}
-	return string(runes[:length-3]) + "..."
-}
-
-// CopyFile copies a file from source to destination
-func CopyFile(sourcePath, targetPath string) error {
-	sourceFile, err := os.Open(sourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to open source file: %v", err)
-	}
-	defer sourceFile.Close()
-
-	targetFile, err := os.Create(targetPath)
-	if err != nil {
-		return fmt.Errorf("failed to create target file: %v", err)
-	}
-	defer targetFile.Close()
-
-	_, err = io.Copy(targetFile, sourceFile)
-	if err != nil {
-		return fmt.Errorf("failed to copy file: %v", err)
-	}
-
-	// Preserve file permissions
-	if sourceInfo, err := os.Stat(sourcePath); err == nil {
-		if chmodErr := os.Chmod(targetPath, sourceInfo.Mode()); chmodErr != nil {
-			// Log error but don't fail the copy operation
-			log.Printf("Warning: Failed to preserve file permissions for %s: %v", targetPath, chmodErr)
-		}
-	}
-
-	return nil
+	return truncateWidth(s, length-3) + "..."
 }
 
 // ShouldIncludeFile checks if a file should be included based on patterns
@@ -135,6 +107,21 @@ func ShouldIncludeFile(path, includePattern, excludePattern string) bool {
 	return true // Include by default if no patterns specified
 }
 
+// IsWithin reports whether path is dir or lies below it. Both are made
+// absolute; symlinks are not resolved.
+func IsWithin(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // BytesEqual compares two byte slices for equality
 func BytesEqual(a, b []byte) bool {
 	if len(a) != len(b) {
@@ -148,10 +135,12 @@ func BytesEqual(a, b []byte) bool {
 	return true
 }
 
+// DateVar matches the date variable ReplaceDateVars expands
+var DateVar = regexp.MustCompile(`\$\(\s*date \+%Y%m%d_%H%M%S\s*\)`)
+
 // ReplaceDateVars replaces $(date +%Y%m%d_%H%M%S) with current timestamp
 func ReplaceDateVars(s string) string {
-	pattern := regexp.MustCompile(`\$\(\s*date \+%Y%m%d_%H%M%S\s*\)`)
-	return pattern.ReplaceAllStringFunc(s, func(_ string) string {
+	return DateVar.ReplaceAllStringFunc(s, func(_ string) string {
 		return time.Now().Format("20060102_150405")
 	})
 }
@@ -6,6 +6,8 @@ import (
 	"regexp"
 	"testing"
 	"time"
+
+	"archiveFiles/internal/constants"
 )
 
 func TestFormatBytes(t *testing.T) {
@@ -119,6 +121,27 @@ func TestShouldIncludeFile(t *testing.T) {
 	}
 }
 
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		expected  bool
+	}{
+		{"/data/app", "/data/app", true},
+		{"/data/app/backup", "/data/app", true},
+		{"/data/app/../app/backup", "/data/app", true},
+		{"/data/application", "/data/app", false},
+		{"/data", "/data/app", false},
+		{"/other/app", "/data/app", false},
+		{"/data/..backup", "/data", true},
+	}
+
+	for _, tt := range tests {
+		if got := IsWithin(tt.path, tt.dir); got != tt.expected {
+			t.Errorf("IsWithin(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.expected)
+		}
+	}
+}
+
 func TestBytesEqual(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -146,6 +169,31 @@ func TestBytesEqual(t *testing.T) {
 	}
 }
 
+func TestCopyFileThrottled(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.bin")
+	content := make([]byte, 256*1024)
+	if err := os.WriteFile(sourceFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two files at 1MB/s share the rate: 512KB take half a second
+	throttle := NewThrottle(1024 * 1024)
+	started := time.Now()
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := CopyFileThrottled(sourceFile, filepath.Join(tempDir, name), throttle); err != nil {
+			t.Fatalf("CopyFileThrottled failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 400*time.Millisecond {
+		t.Errorf("Throttled copies took %v, want about 500ms", elapsed)
+	}
+	copied, err := os.ReadFile(filepath.Join(tempDir, "b.bin"))
+	if err != nil || !BytesEqual(copied, content) {
+		t.Errorf("Throttled copy does not match the source (%v)", err)
+	}
+}
+
 func TestCopyFile(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir, err := os.MkdirTemp("", "utils_test")
@@ -218,6 +266,88 @@ func TestCopyFile(t *testing.T) {
 			t.Error("Expected error for invalid destination path")
 		}
 	})
+
+	// Files larger than one buffer are copied chunk by chunk
+	t.Run("Multiple chunks", func(t *testing.T) {
+		for _, dropCache := range []bool{false, true} {
+			SetDropPageCache(dropCache)
+			sourceFile := filepath.Join(tempDir, "large.sst")
+			targetFile := filepath.Join(tempDir, "large_copy.sst")
+
+			content := make([]byte, 2*constants.CopyBufferSize+12345)
+			for i := range content {
+				content[i] = byte(i % 251)
+			}
+			if err := os.WriteFile(sourceFile, content, 0644); err != nil {
+				t.Fatalf("Failed to create source file: %v", err)
+			}
+
+			if err := CopyFile(sourceFile, targetFile); err != nil {
+				t.Fatalf("CopyFile failed (drop cache %t): %v", dropCache, err)
+			}
+			copiedContent, err := os.ReadFile(targetFile)
+			if err != nil {
+				t.Fatalf("Failed to read copied file: %v", err)
+			}
+			if !BytesEqual(content, copiedContent) {
+				t.Errorf("Copied content doesn't match original (drop cache %t)", dropCache)
+			}
+		}
+		SetDropPageCache(false)
+	})
+
+	// The checksum of the copied data is kept until the target changes
+	t.Run("Copy checksum", func(t *testing.T) {
+		sourceFile := filepath.Join(tempDir, "hashed.log")
+		targetFile := filepath.Join(tempDir, "hashed_copy.log")
+		if err := os.WriteFile(sourceFile, []byte("hello\n"), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+		if err := CopyFile(sourceFile, targetFile); err != nil {
+			t.Fatalf("CopyFile failed: %v", err)
+		}
+		sum, ok := CopyChecksum(targetFile)
+		if want := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"; !ok || sum != want {
+			t.Errorf("CopyChecksum = %q, %t, want %s", sum, ok, want)
+		}
+
+		if err := os.WriteFile(targetFile, []byte("replaced by another method\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := CopyChecksum(targetFile); ok {
+			t.Error("A replaced target should have no copy checksum")
+		}
+		ResetCopyChecksums()
+		if _, ok := CopyChecksum(targetFile); ok {
+			t.Error("ResetCopyChecksums should forget every checksum")
+		}
+	})
+
+	// Pre-reading leaves the file at its start for the copy
+	t.Run("Preread", func(t *testing.T) {
+		SetPreread(true)
+		defer SetPreread(false)
+		sourceFile := filepath.Join(tempDir, "preread.sst")
+		targetFile := filepath.Join(tempDir, "preread_copy.sst")
+		content := make([]byte, constants.CopyBufferSize+4321)
+		for i := range content {
+			content[i] = byte(i % 253)
+		}
+		if err := os.WriteFile(sourceFile, content, 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+
+		if err := CopyFile(sourceFile, targetFile); err != nil {
+			t.Fatalf("CopyFile failed: %v", err)
+		}
+		copiedContent, err := os.ReadFile(targetFile)
+		if err != nil {
+			t.Fatalf("Failed to read copied file: %v", err)
+		}
+		if !BytesEqual(content, copiedContent) {
+			t.Error("Copied content doesn't match original after pre-reading")
+		}
+	})
 }
 
 func TestCalculateSize(t *testing.T) {
@@ -325,6 +455,38 @@ func TestTruncateString_EdgeCases(t *testing.T) {
 			t.Errorf("TruncateString should handle unicode properly, got %s", result)
 		}
 	})
+
+	t.Run("Wide characters", func(t *testing.T) {
+		// Each CJK character takes two columns; none may be split
+		result := TruncateString("数据库备份文件.db", 8)
+		if result != "数据..." {
+			t.Errorf("TruncateString should count wide characters as two columns, got %s", result)
+		}
+		if DisplayWidth(result) > 8 {
+			t.Errorf("TruncateString result is %d columns wide, want at most 8", DisplayWidth(result))
+		}
+	})
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"backup.db", 9},
+		{"Привет", 6},
+		{"数据库", 6},
+		{"한국어.db", 9},
+		{"e\u0301", 1}, // Combining accent
+		{"█░", 2},
+	}
+
+	for _, tt := range tests {
+		if got := DisplayWidth(tt.input); got != tt.want {
+			t.Errorf("DisplayWidth(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
 }
 
 func TestReplaceDateVars(t *testing.T) {
@@ -354,3 +516,88 @@ func TestReplaceDateVars(t *testing.T) {
 		t.Errorf("expected foo_YYYYMMDD_HHMMSS_bar, got %s", out3)
 	}
 }
+
+func TestSyncTree(t *testing.T) {
+	tempDir := t.TempDir()
+	nested := filepath.Join(tempDir, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create nested dirs: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(nested, "file.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if err := SyncTree(tempDir, false); err != nil {
+		t.Errorf("SyncTree(files only) failed: %v", err)
+	}
+	if err := SyncTree(tempDir, true); err != nil {
+		t.Errorf("SyncTree(with dirs) failed: %v", err)
+	}
+	if err := SyncTree(filepath.Join(tempDir, "missing"), true); err == nil {
+		t.Error("Expected error for missing root")
+	}
+	if err := SyncDir(filepath.Join(tempDir, "missing")); err == nil {
+		t.Error("Expected error syncing missing directory")
+	}
+}
+
+func TestTmpDir(t *testing.T) {
+	dir := t.TempDir()
+	SetTmpDir(dir)
+	defer SetTmpDir("")
+
+	workDir, err := MkdirTemp(constants.TmpPrefix + "test-")
+	if err != nil {
+		t.Fatalf("MkdirTemp failed: %v", err)
+	}
+	if filepath.Dir(workDir) != dir {
+		t.Errorf("MkdirTemp created %s, want it in %s", workDir, dir)
+	}
+	if err := CheckTmpDir(dir, 1); err != nil {
+		t.Errorf("CheckTmpDir failed: %v", err)
+	}
+	if err := CheckTmpDir(dir, 1<<62); err == nil {
+		t.Error("CheckTmpDir should fail when the directory lacks the required space")
+	}
+	if err := CheckTmpDir(filepath.Join(dir, "missing"), 1); err == nil {
+		t.Error("CheckTmpDir should fail for a missing directory")
+	}
+
+	// Only directories of the tool that are old enough are removed, and
+	// snapshot mount points and names the tool does not use are kept
+	stale := filepath.Join(dir, constants.TmpPrefix+"secondary-1")
+	foreign := filepath.Join(dir, "other-1")
+	snapshot := filepath.Join(dir, constants.TmpPrefix+"snapshot-1")
+	unknown := filepath.Join(dir, constants.TmpPrefix+"other-1")
+	others := filepath.Join(dir, constants.TmpPrefix+"append-1")
+	kept := []string{workDir, foreign, snapshot, unknown}
+	for _, path := range []string{stale, foreign, snapshot, unknown, others} {
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-48 * time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A directory of another user is kept; only root can create one
+	if os.Getuid() == 0 && os.Chown(others, 65534, 65534) == nil {
+		kept = append(kept, others)
+	} else if err := os.Remove(others); err != nil {
+		t.Fatal(err)
+	}
+	removed := RemoveStaleTemp(dir, 24*time.Hour)
+	if len(removed) != 1 || removed[0] != stale {
+		t.Errorf("RemoveStaleTemp removed %v, want only %s", removed, stale)
+	}
+	for _, path := range kept {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s should be kept: %v", path, err)
+		}
+	}
+
+	SetTmpDir("")
+	if TmpDir() != os.TempDir() {
+		t.Errorf("TmpDir = %s without a setting, want %s", TmpDir(), os.TempDir())
+	}
+}
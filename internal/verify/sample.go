@@ -0,0 +1,509 @@
+package verify
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"archiveFiles/internal/sqlitedb"
+	"archiveFiles/internal/types"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+// SampleOptions selects the keys/rows checked by sampled verification
+type SampleOptions struct {
+	Fraction float64 // Share of keys/rows to check, between 0 and 1
+	Seed     int64   // Seed of the pseudo-random selection; the same seed selects the same sample
+}
+
+// SampleResult summarizes a sampled verification
+type SampleResult struct {
+	Total   int // Keys/rows in the source; estimated when only a sample was read
+	Checked int // Keys/rows selected and compared against the backup
+}
+
+// VerifySample compares a deterministic pseudo-random sample of keys (RocksDB)
+// or rows (SQLite) between source and backup. The sample is reached by
+// seeking to positions drawn from the seed, so its cost grows with the
+// sample rather than with the database, and a run can be reproduced from
+// its recorded seed. A fraction of 1 compares every key or row.
+func VerifySample(sourceInfo types.DatabaseInfo, backupPath string, opts SampleOptions) (SampleResult, error) {
+	var result SampleResult
+	var err error
+	if sourceInfo.Encrypted {
+		// Encrypted databases are fully checksummed by VerifyBackup instead
+		return result, nil
+	}
+	switch sourceInfo.Type {
+	case types.DatabaseTypeRocksDB:
+		result, err = sampleRocksDB(sourceInfo.Path, backupPath, opts)
+	case types.DatabaseTypeSQLite:
+		result, err = sampleSQLite(sourceInfo.Path, filepath.Join(backupPath, filepath.Base(sourceInfo.Path)), opts)
+	default:
+		// Plain files are fully checksummed by VerifyBackup already
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	log.Info("Sampled verification passed for %s: %d of %d keys/rows checked (%.2f%%, seed %d)",
+		sourceInfo.Name, result.Checked, result.Total, opts.Fraction*100, opts.Seed)
+	return result, nil
+}
+
+// sampleSelector decides deterministically whether a key or row is sampled
+type sampleSelector struct {
+	seed  [8]byte
+	limit uint64
+}
+
+func newSampleSelector(opts SampleOptions) *sampleSelector {
+	s := &sampleSelector{}
+	binary.LittleEndian.PutUint64(s.seed[:], uint64(opts.Seed))
+	if opts.Fraction >= 1 {
+		s.limit = math.MaxUint64
+	} else {
+		s.limit = uint64(opts.Fraction * math.MaxUint64)
+	}
+	return s
+}
+
+// selected hashes the seed, a scope (e.g. table name) and the data
+func (s *sampleSelector) selected(scope string, data []byte) bool {
+	h := fnv.New64a()
+	h.Write(s.seed[:])
+	h.Write([]byte(scope))
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum64() <= s.limit
+}
+
+// Rowid sampling limits
+const (
+	sampleMaxRowidSparseness = 16      // Rowid range per row beyond which a table is hashed whole instead of sampled by rowid
+	sampleDrawsPerRow        = 4       // Rowid draws allowed per row to sample, as draws may find a row checked already
+	sampleMaxDraws           = 1 << 20 // Rowid draws per table at most
+)
+
+// sampleCount returns how many positions to draw to sample fraction of
+// total keys or rows: at least one, at most total
+func sampleCount(total int64, fraction float64) int64 {
+	count := int64(math.Ceil(float64(total) * fraction))
+	return max(1, min(count, total))
+}
+
+// sampleRocksDB seeks the source to keys drawn between its first and last
+// key, and checks that the backup holds the same value for each key found.
+// Draws are uniform over the key range, not over the keys, so keys in
+// sparse regions are found more often; a key found twice is checked once.
+func sampleRocksDB(sourcePath, backupPath string, opts SampleOptions) (SampleResult, error) {
+	var result SampleResult
+
+	sourceOpts := grocksdb.NewDefaultOptions()
+	defer sourceOpts.Destroy()
+	sourceDB, err := grocksdb.OpenDbForReadOnly(sourceOpts, sourcePath, false)
+	if err != nil {
+		return result, fmt.Errorf("failed to open source database: %v", err)
+	}
+	defer sourceDB.Close()
+
+	backupOpts := grocksdb.NewDefaultOptions()
+	defer backupOpts.Destroy()
+	backupDB, err := grocksdb.OpenDbForReadOnly(backupOpts, backupPath, false)
+	if err != nil {
+		return result, fmt.Errorf("failed to open backup database: %v", err)
+	}
+	defer backupDB.Close()
+
+	readOpts := grocksdb.NewDefaultReadOptions()
+	readOpts.SetFillCache(false)
+	defer readOpts.Destroy()
+
+	iter := sourceDB.NewIterator(readOpts)
+	defer iter.Close()
+
+	// checkKey compares the key the iterator is at with the backup
+	checkKey := func() ([]byte, error) {
+		key := iter.Key()
+		keyData := append([]byte(nil), key.Data()...)
+		key.Free()
+		value := iter.Value()
+		sourceValue := append([]byte(nil), value.Data()...)
+		value.Free()
+
+		backupValue, err := backupDB.Get(readOpts, keyData)
+		if err != nil {
+			return keyData, fmt.Errorf("failed to read key %x from backup: %v", keyData, err)
+		}
+		exists := backupValue.Exists()
+		matches := exists && string(backupValue.Data()) == string(sourceValue)
+		backupValue.Free()
+		if !exists {
+			return keyData, fmt.Errorf("sampled key %x missing from backup", keyData)
+		}
+		if !matches {
+			return keyData, fmt.Errorf("sampled key %x has a different value in backup", keyData)
+		}
+		return keyData, nil
+	}
+
+	if opts.Fraction >= 1 {
+		for iter.SeekToFirst(); iter.Valid(); iter.Next() {
+			if _, err := checkKey(); err != nil {
+				return result, err
+			}
+			result.Total++
+			result.Checked++
+		}
+		if err := iter.Err(); err != nil {
+			return result, fmt.Errorf("failed to iterate source database: %v", err)
+		}
+		return result, nil
+	}
+
+	iter.SeekToFirst()
+	if !iter.Valid() {
+		if err := iter.Err(); err != nil {
+			return result, fmt.Errorf("failed to iterate source database: %v", err)
+		}
+		return result, nil
+	}
+	first := copyKey(iter)
+	iter.SeekToLast()
+	last := copyKey(iter)
+
+	total, _ := strconv.ParseInt(sourceDB.GetProperty("rocksdb.estimate-num-keys"), 10, 64)
+	result.Total = int(max(total, 1))
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	seen := make(map[string]bool)
+	for i := sampleCount(int64(result.Total), opts.Fraction); i > 0; i-- {
+		iter.Seek(randomKeyBetween(rng, first, last))
+		if !iter.Valid() {
+			// Draws past the last key are padded beyond it
+			iter.SeekToLast()
+		}
+		if err := iter.Err(); err != nil {
+			return result, fmt.Errorf("failed to seek source database: %v", err)
+		}
+		key := iter.Key()
+		seenBefore := seen[string(key.Data())]
+		key.Free()
+		if seenBefore {
+			continue
+		}
+		keyData, err := checkKey()
+		if err != nil {
+			return result, err
+		}
+		seen[string(keyData)] = true
+		result.Checked++
+	}
+
+	return result, nil
+}
+
+// copyKey returns a copy of the key the iterator is at
+func copyKey(iter *grocksdb.Iterator) []byte {
+	key := iter.Key()
+	defer key.Free()
+	return append([]byte(nil), key.Data()...)
+}
+
+// randomKeyBetween draws a key between first and last: their common prefix
+// followed by eight bytes drawn between the next eight bytes of each
+func randomKeyBetween(rng *rand.Rand, first, last []byte) []byte {
+	prefix := 0
+	for prefix < len(first) && prefix < len(last) && first[prefix] == last[prefix] {
+		prefix++
+	}
+	word := func(key []byte) uint64 {
+		var b [8]byte
+		copy(b[:], key[min(prefix, len(key)):])
+		return binary.BigEndian.Uint64(b[:])
+	}
+	low, high := word(first), word(last)
+	drawn := low
+	if high > low {
+		drawn += uint64(rng.Int63n(int64(min(high-low, math.MaxInt64-1)) + 1))
+	}
+	key := append(append([]byte(nil), first[:prefix]...), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(key[prefix:], drawn)
+	return key
+}
+
+// sampleSQLite checks a sample of the rows of every table. Rowid tables are
+// sampled by seeking to random rowids; WITHOUT ROWID tables, and every table
+// when the fraction is 1, are read whole and sampled by a seeded hash of
+// their rows instead.
+func sampleSQLite(sourceFile, backupFile string, opts SampleOptions) (SampleResult, error) {
+	var result SampleResult
+
+	sourceDB, backupDB, err := sqlitedb.OpenPair(sourceFile, sqlitedb.ReadOnly, backupFile, sqlitedb.Immutable)
+	if err != nil {
+		return result, fmt.Errorf("failed to open databases: %v", err)
+	}
+	defer sourceDB.Close()
+	defer backupDB.Close()
+
+	tables, err := listTables(sourceDB.DB)
+	if err != nil {
+		return result, err
+	}
+
+	selector := newSampleSelector(opts)
+	rng := rand.New(rand.NewSource(opts.Seed))
+	for _, table := range tables {
+		rowid, err := hasRowid(sourceDB.DB, table)
+		if err != nil {
+			return result, err
+		}
+		if rowid && opts.Fraction < 1 {
+			total, checked, sampled, err := sampleTableByRowid(sourceDB.DB, backupDB.DB, table, rng, opts.Fraction)
+			if err != nil {
+				return result, err
+			}
+			if sampled {
+				result.Total += total
+				result.Checked += checked
+				continue
+			}
+		}
+
+		sourceRows, total, err := sampleTableRows(sourceDB.DB, table, selector)
+		if err != nil {
+			return result, fmt.Errorf("failed to sample source table %s: %v", table, err)
+		}
+		backupRows, _, err := sampleTableRows(backupDB.DB, table, selector)
+		if err != nil {
+			return result, fmt.Errorf("failed to sample backup table %s: %v", table, err)
+		}
+
+		for row, count := range sourceRows {
+			if backupRows[row] < count {
+				return result, fmt.Errorf("sampled row of table %s missing from backup", table)
+			}
+			result.Checked += count
+		}
+		result.Total += total
+	}
+
+	return result, nil
+}
+
+// hasRowid reports whether a table has rowids, i.e. was not created
+// WITHOUT ROWID
+func hasRowid(db *sql.DB, table string) (bool, error) {
+	var schema string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&schema); err != nil {
+		return false, fmt.Errorf("failed to read schema of table %s: %v", table, err)
+	}
+	return !strings.Contains(strings.ToUpper(strings.Join(strings.Fields(schema), " ")), "WITHOUT ROWID"), nil
+}
+
+// sampleTableByRowid draws rowids between the lowest and highest of a table
+// and checks the first source row at or after each against the backup. The
+// backup row with the same rowid normally matches; VACUUM INTO may renumber
+// rowids of tables without an INTEGER PRIMARY KEY, so a row that differs is
+// looked up by content before it counts as missing. It returns the table's
+// row count and the rows checked. Tables whose rowids are too sparse for
+// draws to find rows in bounded time are not sampled, which the returned
+// bool reports.
+func sampleTableByRowid(source, backup *sql.DB, table string, rng *rand.Rand, fraction float64) (int, int, bool, error) {
+	quoted := quoteIdentifier(table)
+	var low, high sql.NullInt64
+	var rows int64
+	if err := source.QueryRow(fmt.Sprintf("SELECT MIN(rowid), MAX(rowid), COUNT(*) FROM %s", quoted)).Scan(&low, &high, &rows); err != nil {
+		return 0, 0, false, fmt.Errorf("failed to read rowid range of table %s: %v", table, err)
+	}
+	if !low.Valid {
+		return 0, 0, true, nil
+	}
+	// A span that overflows int64 is sparse as well
+	span := high.Int64 - low.Int64 + 1
+	if span <= 0 || span/rows > sampleMaxRowidSparseness {
+		return 0, 0, false, nil
+	}
+
+	sourceStmt, err := source.Prepare(fmt.Sprintf("SELECT rowid, * FROM %s WHERE rowid >= ? ORDER BY rowid LIMIT 1", quoted))
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to sample source table %s: %v", table, err)
+	}
+	defer sourceStmt.Close()
+	backupStmt, err := backup.Prepare(fmt.Sprintf("SELECT * FROM %s WHERE rowid = ?", quoted))
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to sample backup table %s: %v", table, err)
+	}
+	defer backupStmt.Close()
+
+	// Draws landing on a row checked already are repeated, up to a limit
+	target := sampleCount(rows, fraction)
+	draws := min(target*sampleDrawsPerRow, sampleMaxDraws)
+	seen := make(map[int64]bool)
+	checked := 0
+	for ; draws > 0 && int64(checked) < target; draws-- {
+		rowid, values, columns, err := queryRow(sourceStmt, low.Int64+rng.Int63n(span))
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("failed to sample source table %s: %v", table, err)
+		}
+		if values == nil || seen[rowid] {
+			continue
+		}
+		seen[rowid] = true
+
+		_, backupValues, _, err := queryRow(backupStmt, rowid)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("failed to sample backup table %s: %v", table, err)
+		}
+		if backupValues == nil || encodeRow(backupValues) != encodeRow(values) {
+			found, err := rowExists(backup, table, columns, values)
+			if err != nil {
+				return 0, 0, false, fmt.Errorf("failed to sample backup table %s: %v", table, err)
+			}
+			if !found {
+				return 0, 0, false, fmt.Errorf("sampled row of table %s missing from backup", table)
+			}
+		}
+		checked++
+	}
+	return int(rows), checked, true, nil
+}
+
+// queryRow runs a single-row query taking a rowid and returns the row's
+// values and columns. Queries selecting the rowid first return it apart
+// from the values. Values are nil when there is no row.
+func queryRow(stmt *sql.Stmt, rowid int64) (int64, []interface{}, []string, error) {
+	rows, err := stmt.Query(rowid)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if !rows.Next() {
+		return 0, nil, nil, rows.Err()
+	}
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return 0, nil, nil, err
+	}
+	if len(columns) > 0 && columns[0] == "rowid" {
+		id, _ := values[0].(int64)
+		return id, values[1:], columns[1:], nil
+	}
+	return rowid, values, columns, nil
+}
+
+// rowExists reports whether a table holds a row with the given values
+func rowExists(db *sql.DB, table string, columns []string, values []interface{}) (bool, error) {
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = quoteIdentifier(column) + " IS ?"
+	}
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1", quoteIdentifier(table), strings.Join(conditions, " AND "))
+	var one int
+	err := db.QueryRow(query, values...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// quoteIdentifier quotes a table or column name for SQLite
+func quoteIdentifier(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
+// listTables returns the user tables of a SQLite database
+func listTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// sampleTableRows reads a whole table and returns the encoded sampled rows
+// with their multiplicity, and the number of rows read
+func sampleTableRows(db *sql.DB, table string, selector *sampleSelector) (map[string]int, int, error) {
+	rows, err := db.Query("SELECT * FROM " + quoteIdentifier(table))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	sampled := make(map[string]int)
+	scanned := 0
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, 0, err
+		}
+		scanned++
+
+		encoded := encodeRow(values)
+		if selector.selected(table, []byte(encoded)) {
+			sampled[encoded]++
+		}
+	}
+	return sampled, scanned, rows.Err()
+}
+
+// encodeRow serializes a row unambiguously for hashing and comparison
+func encodeRow(values []interface{}) string {
+	var b strings.Builder
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			b.WriteString("N;")
+		case int64:
+			fmt.Fprintf(&b, "I%d;", v)
+		case float64:
+			fmt.Fprintf(&b, "F%v;", v)
+		case []byte:
+			fmt.Fprintf(&b, "B%d:%s;", len(v), v)
+		case string:
+			fmt.Fprintf(&b, "B%d:%s;", len(v), v)
+		case time.Time:
+			fmt.Fprintf(&b, "T%s;", v.UTC().Format(time.RFC3339Nano))
+		default:
+			fmt.Fprintf(&b, "V%v;", v)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,202 @@
+package verify
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archiveFiles/internal/types"
+)
+
+// createSampleDB creates a SQLite database with a table of n rows
+func createSampleDB(t *testing.T, path string, n int) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE items (name TEXT, payload BLOB, score REAL)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		_, err := db.Exec("INSERT INTO items VALUES (?, ?, ?)", fmt.Sprintf("item-%d", i), []byte{byte(i)}, float64(i)/3)
+		if err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+}
+
+func TestVerifySample_SQLite(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "app.db")
+	createSampleDB(t, sourcePath, 200)
+
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	backupFile := filepath.Join(backupDir, "app.db")
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backupFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info := types.DatabaseInfo{Path: sourcePath, Type: types.DatabaseTypeSQLite, Name: "app.db"}
+	opts := SampleOptions{Fraction: 0.25, Seed: 42}
+
+	result, err := VerifySample(info, backupDir, opts)
+	if err != nil {
+		t.Fatalf("VerifySample failed for an identical backup: %v", err)
+	}
+	if result.Total != 200 {
+		t.Errorf("Total = %d, want 200", result.Total)
+	}
+	if result.Checked == 0 || result.Checked == 200 {
+		t.Errorf("Checked = %d, expected a partial sample", result.Checked)
+	}
+
+	// The same seed selects the same sample
+	again, err := VerifySample(info, backupDir, opts)
+	if err != nil || again.Checked != result.Checked {
+		t.Errorf("Sample not reproducible: %d vs %d (%v)", again.Checked, result.Checked, err)
+	}
+
+	// Damage every row of the backup; any non-empty sample must notice
+	db, err := sql.Open("sqlite3", backupFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE items SET score = score + 1"); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := VerifySample(info, backupDir, opts); err == nil {
+		t.Error("Expected VerifySample to detect modified rows")
+	}
+}
+
+func TestSampleSelector(t *testing.T) {
+	all := newSampleSelector(SampleOptions{Fraction: 1, Seed: 7})
+	none := newSampleSelector(SampleOptions{Fraction: 0, Seed: 7})
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if !all.selected("", key) {
+			t.Fatalf("Fraction 1 should select every key")
+		}
+		if none.selected("", key) {
+			t.Fatalf("Fraction 0 should select nothing")
+		}
+	}
+}
+
+func TestVerifySample_SQLiteRenumberedAndWithoutRowid(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "app.db")
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backup holds the same rows under different rowids, and a
+	// WITHOUT ROWID table that can only be read whole
+	for _, target := range []struct {
+		path    string
+		reverse bool
+	}{{sourcePath, false}, {filepath.Join(backupDir, "app.db"), true}} {
+		db, err := sql.Open("sqlite3", target.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements := []string{
+			"CREATE TABLE items (name TEXT)",
+			"CREATE TABLE settings (key TEXT PRIMARY KEY, value TEXT) WITHOUT ROWID",
+		}
+		for i := 0; i < 100; i++ {
+			n := i
+			if target.reverse {
+				n = 99 - i
+			}
+			statements = append(statements,
+				fmt.Sprintf("INSERT INTO items VALUES ('item-%d')", n),
+				fmt.Sprintf("INSERT INTO settings VALUES ('key-%d', 'value-%d')", n, n))
+		}
+		for _, statement := range statements {
+			if _, err := db.Exec(statement); err != nil {
+				db.Close()
+				t.Fatal(err)
+			}
+		}
+		db.Close()
+	}
+
+	info := types.DatabaseInfo{Path: sourcePath, Type: types.DatabaseTypeSQLite, Name: "app.db"}
+	result, err := VerifySample(info, backupDir, SampleOptions{Fraction: 0.1, Seed: 3})
+	if err != nil {
+		t.Fatalf("VerifySample failed for renumbered rows: %v", err)
+	}
+	if result.Total != 200 {
+		t.Errorf("Total = %d, want 200", result.Total)
+	}
+	if result.Checked == 0 || result.Checked > 100 {
+		t.Errorf("Checked = %d, expected a partial sample", result.Checked)
+	}
+}
+
+func TestVerifySample_SQLiteSparseRowids(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "app.db")
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two rows far apart: drawing rowids between them would almost never
+	// find a row, so the table is hashed whole
+	for _, path := range []string{sourcePath, filepath.Join(backupDir, "app.db")} {
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, statement := range []string{
+			"CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)",
+			"INSERT INTO events VALUES (1, 'first')",
+			"INSERT INTO events VALUES (1700000000000000, 'second')",
+		} {
+			if _, err := db.Exec(statement); err != nil {
+				db.Close()
+				t.Fatal(err)
+			}
+		}
+		db.Close()
+	}
+
+	info := types.DatabaseInfo{Path: sourcePath, Type: types.DatabaseTypeSQLite, Name: "app.db"}
+	done := make(chan struct{})
+	var result SampleResult
+	var err error
+	go func() {
+		result, err = VerifySample(info, backupDir, SampleOptions{Fraction: 0.05, Seed: 1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("VerifySample did not finish on sparse rowids")
+	}
+	if err != nil {
+		t.Fatalf("VerifySample failed: %v", err)
+	}
+	if result.Total != 2 {
+		t.Errorf("Total = %d, want the 2 rows of the table", result.Total)
+	}
+}
@@ -1,41 +1,66 @@
 package verify
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"database/sql"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 
+	"archiveFiles/internal/apperr"
+	"archiveFiles/internal/constants"
+	"archiveFiles/internal/logger"
 	"archiveFiles/internal/progress"
+	"archiveFiles/internal/sqlitedb"
 	"archiveFiles/internal/types"
 	"archiveFiles/internal/utils"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/linxGnu/grocksdb"
 )
 
-// VerifyBackup verifies that a backup matches the source database
-func VerifyBackup(sourceInfo types.DatabaseInfo, backupPath string, progressTracker *progress.ProgressTracker) error {
+// log reports verification results under the "verify" module level
+var log = logger.NewModule("verify")
+
+// VerifyBackup verifies that a backup matches the source database. It also
+// returns differences that did not fail verification but deserve a look,
+// such as a RocksDB backup with fewer SST files than its source.
+func VerifyBackup(sourceInfo types.DatabaseInfo, backupPath string, progressTracker *progress.ProgressTracker) ([]string, error) {
 	if progressTracker != nil {
 		progressTracker.SetCurrentFile(fmt.Sprintf("Verifying %s", sourceInfo.Name))
 	}
 
+	// The content of encrypted databases cannot be read without their key
+	if sourceInfo.Encrypted {
+		return nil, verifyEncrypted(sourceInfo, backupPath)
+	}
+
 	switch sourceInfo.Type {
 	case types.DatabaseTypeRocksDB:
 		return verifyRocksDB(sourceInfo.Path, backupPath)
 	case types.DatabaseTypeSQLite:
-		return verifySQLite(sourceInfo.Path, backupPath)
-	case types.DatabaseTypeLogFile:
-		return verifyFile(sourceInfo.Path, backupPath)
+		if err := verifySQLite(sourceInfo.Path, backupPath); err != nil {
+			return nil, err
+		}
+		for _, attachment := range sourceInfo.Attachments {
+			if _, err := os.Stat(attachment); err != nil {
+				continue // Skipped during backup as well
+			}
+			if err := verifySQLite(attachment, backupPath); err != nil {
+				return nil, fmt.Errorf("attached database %s: %w", attachment, err)
+			}
+		}
+		return nil, nil
+	case types.DatabaseTypeLogFile, types.DatabaseTypeGenericFile:
+		return nil, verifyFile(sourceInfo.Path, backupPath)
 	default:
-		return fmt.Errorf("unsupported database type for verification: %s", sourceInfo.Type)
+		return nil, fmt.Errorf("unsupported database type for verification: %s", sourceInfo.Type)
 	}
 }
 
 // verifyRocksDB verifies a RocksDB backup by comparing critical files
-func verifyRocksDB(sourcePath, backupPath string) error {
+func verifyRocksDB(sourcePath, backupPath string) ([]string, error) {
 	// For RocksDB, we verify by:
 	// 1. Checking that all critical files exist in backup
 	// 2. Comparing file sizes (checksums would be too expensive for large DBs)
@@ -43,15 +68,17 @@ func verifyRocksDB(sourcePath, backupPath string) error {
 
 	// Check if backup directory exists
 	if _, err := os.Stat(backupPath); err != nil {
-		return fmt.Errorf("backup directory does not exist: %v", err)
+		return nil, fmt.Errorf("backup directory does not exist: %v", err)
 	}
 
 	// Get list of source files
 	sourceFiles, err := os.ReadDir(sourcePath)
 	if err != nil {
-		return fmt.Errorf("failed to read source directory: %v", err)
+		return nil, fmt.Errorf("failed to read source directory: %v", err)
 	}
 
+	var warnings []string
+
 	// Check critical files
 	criticalFiles := []string{"CURRENT", "OPTIONS"}
 	for _, criticalFile := range criticalFiles {
@@ -62,22 +89,24 @@ func verifyRocksDB(sourcePath, backupPath string) error {
 		if _, err := os.Stat(sourceFile); err == nil {
 			// File exists in source, must exist in backup
 			if _, err := os.Stat(backupFile); err != nil {
-				return fmt.Errorf("critical file %s missing from backup", criticalFile)
+				return nil, fmt.Errorf("critical file %s missing from backup", criticalFile)
 			}
 
 			// Verify file sizes match
 			sourceInfo, _ := os.Stat(sourceFile)
 			backupInfo, _ := os.Stat(backupFile)
 			if sourceInfo.Size() != backupInfo.Size() {
-				log.Printf("Warning: File size mismatch for %s (source: %d, backup: %d)",
+				warning := fmt.Sprintf("file size mismatch for %s (source: %d, backup: %d)",
 					criticalFile, sourceInfo.Size(), backupInfo.Size())
+				log.Warning("%s", warning)
+				warnings = append(warnings, warning)
 			}
 		}
 	}
 
 	// Verify MANIFEST files
 	if err := verifyManifestFiles(sourcePath, backupPath); err != nil {
-		return fmt.Errorf("manifest verification failed: %v", err)
+		return nil, fmt.Errorf("manifest verification failed: %v", err)
 	}
 
 	// Count SST files in source and backup
@@ -90,7 +119,7 @@ func verifyRocksDB(sourcePath, backupPath string) error {
 
 	backupFiles, err := os.ReadDir(backupPath)
 	if err != nil {
-		return fmt.Errorf("failed to read backup directory: %v", err)
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
 	}
 
 	for _, file := range backupFiles {
@@ -101,10 +130,47 @@ func verifyRocksDB(sourcePath, backupPath string) error {
 
 	// SST counts should match
 	if sourceSSTCount != backupSSTCount {
-		log.Printf("Warning: SST file count mismatch (source: %d, backup: %d)", sourceSSTCount, backupSSTCount)
+		warning := fmt.Sprintf("SST file count mismatch (source: %d, backup: %d)", sourceSSTCount, backupSSTCount)
+		log.Warning("%s", warning)
+		warnings = append(warnings, warning)
+	}
+
+	// Blob files of BlobDB stores: each one in the source must be present in
+	// the backup with the same size
+	if err := verifyBlobFiles(sourcePath, backupPath); err != nil {
+		return nil, err
+	}
+
+	log.Info("RocksDB verification passed: %d SST files, critical files present", backupSSTCount)
+	return warnings, nil
+}
+
+// verifyBlobFiles compares BlobDB blob files between source and backup
+func verifyBlobFiles(sourcePath, backupPath string) error {
+	sourceBlobs, err := utils.ListRocksDBBlobFiles(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to list source blob files: %v", err)
+	}
+
+	for _, blobFile := range sourceBlobs {
+		sourceInfo, err := os.Stat(filepath.Join(sourcePath, blobFile))
+		if err != nil {
+			// Removed by blob garbage collection since the backup was taken
+			continue
+		}
+		backupInfo, err := os.Stat(filepath.Join(backupPath, blobFile))
+		if err != nil {
+			return fmt.Errorf("blob file %s missing from backup", blobFile)
+		}
+		if sourceInfo.Size() != backupInfo.Size() {
+			return fmt.Errorf("blob file %s size mismatch (source: %d, backup: %d)",
+				blobFile, sourceInfo.Size(), backupInfo.Size())
+		}
 	}
 
-	log.Printf("RocksDB verification passed: %d SST files, critical files present", backupSSTCount)
+	if len(sourceBlobs) > 0 {
+		log.Info("Verified %d blob files", len(sourceBlobs))
+	}
 	return nil
 }
 
@@ -132,7 +198,7 @@ func verifyManifestFiles(sourcePath, backupPath string) error {
 	}
 
 	// At least one MANIFEST file should exist in backup
-	log.Printf("MANIFEST files present (source: %d, backup: %d)", len(sourceManifests), len(backupManifests))
+	log.Debug("MANIFEST files present (source: %d, backup: %d)", len(sourceManifests), len(backupManifests))
 	return nil
 }
 
@@ -175,18 +241,98 @@ func verifySQLite(sourcePath, backupPath string) error {
 	}
 
 	// Run integrity check on backup
-	if err := checkSQLiteIntegrity(backupFile); err != nil {
-		return fmt.Errorf("backup integrity check failed: %v", err)
+	if err := checkSQLiteIntegrity(backupFile, sqlitedb.Immutable); err != nil {
+		return fmt.Errorf("backup integrity check failed: %w", err)
 	}
 
-	log.Printf("SQLite verification passed: integrity check OK, size %s",
+	log.Info("SQLite verification passed: integrity check OK, size %s",
 		utils.FormatBytes(backupInfo.Size()))
 	return nil
 }
 
+// CheckSQLiteIntegrity checks a SQLite database for corruption with
+// PRAGMA integrity_check. Corruption is reported as apperr.ErrCorrupt;
+// other errors mean the check could not run.
+func CheckSQLiteIntegrity(dbPath string) error {
+	return checkSQLiteIntegrity(dbPath, sqlitedb.ReadOnly)
+}
+
+// CheckRocksDBReadable checks a RocksDB store on its own, e.g. one restored
+// from an archive: it must open read-only and every key and value must read
+// back with valid block checksums
+func CheckRocksDBReadable(dbPath string) error {
+	opts := grocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+	db, err := grocksdb.OpenDbForReadOnly(opts, dbPath, false)
+	if err != nil {
+		return apperr.Wrap(apperr.ErrCorrupt, err, "failed to open RocksDB store")
+	}
+	defer db.Close()
+
+	readOpts := grocksdb.NewDefaultReadOptions()
+	defer readOpts.Destroy()
+	readOpts.SetVerifyChecksums(true)
+	readOpts.SetFillCache(false)
+
+	iterator := db.NewIterator(readOpts)
+	defer iterator.Close()
+	count := 0
+	for iterator.SeekToFirst(); iterator.Valid(); iterator.Next() {
+		iterator.Key().Free()
+		iterator.Value().Free()
+		count++
+	}
+	if err := iterator.Err(); err != nil {
+		return apperr.Wrap(apperr.ErrCorrupt, err, "failed to read RocksDB store after %d record(s)", count)
+	}
+	log.Info("RocksDB store %s readable: %d record(s)", dbPath, count)
+	return nil
+}
+
+// CheckSQLiteForeignKeys runs PRAGMA foreign_key_check on a SQLite
+// database and describes the violations found, or returns "" when there
+// are none. Violations are not corruption: SQLite does not enforce foreign
+// keys unless the application asks it to.
+func CheckSQLiteForeignKeys(dbPath string) (string, error) {
+	db, err := sqlitedb.Open(dbPath, sqlitedb.ReadOnly)
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return "", fmt.Errorf("foreign key check query failed: %v", err)
+	}
+	defer rows.Close()
+
+	violations := 0
+	var firstTable string
+	for rows.Next() {
+		var table string
+		var rowID, parent, fkID sql.NullString
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return "", fmt.Errorf("failed to scan foreign key check result: %v", err)
+		}
+		if violations == 0 {
+			firstTable = table
+		}
+		violations++
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("foreign key check failed: %v", err)
+	}
+
+	if violations > 0 {
+		return fmt.Sprintf("%d foreign key violation(s), first in table %s", violations, firstTable), nil
+	}
+	return "", nil
+}
+
 // checkSQLiteIntegrity runs PRAGMA integrity_check on a SQLite database
-func checkSQLiteIntegrity(dbPath string) error {
-	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", dbPath))
+// opened in mode
+func checkSQLiteIntegrity(dbPath string, mode sqlitedb.Mode) error {
+	db, err := sqlitedb.Open(dbPath, mode)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
@@ -199,9 +345,45 @@ func checkSQLiteIntegrity(dbPath string) error {
 	}
 
 	if result != "ok" {
-		return fmt.Errorf("integrity check failed: %s", result)
+		return apperr.New(apperr.ErrCorrupt, "integrity check failed: %s", result)
+	}
+
+	return nil
+}
+
+// verifyEncrypted verifies the file copy of an encrypted database by
+// comparing the checksum of every file in the backup with its source
+func verifyEncrypted(sourceInfo types.DatabaseInfo, backupPath string) error {
+	if sourceInfo.Type == types.DatabaseTypeSQLite {
+		if err := verifyFile(sourceInfo.Path, backupPath); err != nil {
+			return err
+		}
+		for _, attachment := range sourceInfo.Attachments {
+			if _, err := os.Stat(attachment); err != nil {
+				continue // Skipped during backup as well
+			}
+			if err := verifyFile(attachment, backupPath); err != nil {
+				return fmt.Errorf("attached database %s: %w", attachment, err)
+			}
+		}
+		return nil
 	}
 
+	backupFiles, err := os.ReadDir(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup directory: %v", err)
+	}
+	verified := 0
+	for _, file := range backupFiles {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		if err := verifyFile(filepath.Join(sourceInfo.Path, file.Name()), backupPath); err != nil {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		verified++
+	}
+	log.Info("Encrypted RocksDB verification passed: %d files checksummed", verified)
 	return nil
 }
 
@@ -230,32 +412,70 @@ func verifyFile(sourcePath, backupPath string) error {
 			sourceInfo.Size(), backupInfo.Size())
 	}
 
-	// Compare checksums for files smaller than 100MB
-	if sourceInfo.Size() < 100*1024*1024 {
-		sourceHash, err := calculateFileHash(sourcePath)
-		if err != nil {
-			return fmt.Errorf("failed to hash source: %v", err)
-		}
-
+	// The source was hashed while it was copied, so only the backup is read
+	// again. Files another method wrote are compared with the source.
+	if sourceHash, copied := utils.CopyChecksum(backupFile); copied {
 		backupHash, err := calculateFileHash(backupFile)
 		if err != nil {
 			return fmt.Errorf("failed to hash backup: %v", err)
 		}
-
 		if sourceHash != backupHash {
 			return fmt.Errorf("file checksum mismatch")
 		}
-
-		log.Printf("File verification passed: size %s, checksum %s",
+		log.Info("File verification passed: size %s, checksum %s",
 			utils.FormatBytes(sourceInfo.Size()), sourceHash[:16])
-	} else {
-		log.Printf("File verification passed: size %s (checksum skipped for large file)",
-			utils.FormatBytes(sourceInfo.Size()))
+		return nil
 	}
-
+	if err := compareFiles(sourcePath, backupFile); err != nil {
+		return err
+	}
+	log.Info("File verification passed: size %s, content identical",
+		utils.FormatBytes(sourceInfo.Size()))
 	return nil
 }
 
+// compareFiles reads both files side by side in chunks of
+// constants.VerifyBufferSize, so a multi-GB log is compared in bounded
+// memory, and reports the offset of the first difference
+func compareFiles(sourcePath, backupPath string) error {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %v", err)
+	}
+	defer sourceFile.Close()
+	backupFile, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer backupFile.Close()
+
+	sourceBuf := make([]byte, constants.VerifyBufferSize)
+	backupBuf := make([]byte, constants.VerifyBufferSize)
+	var offset int64
+	for {
+		n, sourceErr := io.ReadFull(sourceFile, sourceBuf)
+		m, backupErr := io.ReadFull(backupFile, backupBuf)
+		if sourceErr != nil && sourceErr != io.EOF && sourceErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read source: %v", sourceErr)
+		}
+		if backupErr != nil && backupErr != io.EOF && backupErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read backup: %v", backupErr)
+		}
+		if !bytes.Equal(sourceBuf[:n], backupBuf[:m]) {
+			for i := 0; i < n && i < m; i++ {
+				if sourceBuf[i] != backupBuf[i] {
+					return fmt.Errorf("file content mismatch at offset %d", offset+int64(i))
+				}
+			}
+			return fmt.Errorf("file content mismatch at offset %d", offset+int64(min(n, m)))
+		}
+		if sourceErr != nil {
+			return nil
+		}
+		offset += int64(n)
+	}
+}
+
 // calculateFileHash calculates SHA256 hash of a file
 func calculateFileHash(filePath string) (string, error) {
 	file, err := os.Open(filePath)
@@ -265,7 +485,7 @@ func calculateFileHash(filePath string) (string, error) {
 	defer file.Close()
 
 	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.CopyBuffer(hash, file, make([]byte, constants.VerifyBufferSize)); err != nil {
 		return "", err
 	}
 
@@ -2,11 +2,15 @@ package verify
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"archiveFiles/internal/constants"
 	"archiveFiles/internal/types"
+	"archiveFiles/internal/utils"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -39,6 +43,83 @@ func TestVerifyFile(t *testing.T) {
 	}
 }
 
+func TestVerifyFile_CopyChecksum(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "source.log")
+	if err := os.WriteFile(sourcePath, []byte("test log content\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatalf("Failed to create backup dir: %v", err)
+	}
+	backupPath := filepath.Join(backupDir, "source.log")
+	if err := utils.CopyFile(sourcePath, backupPath); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+
+	// The source is not read again: the backup is checked against what
+	// was copied, even if the source changed since
+	if err := os.WriteFile(sourcePath, []byte("test log CONTENT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFile(sourcePath, backupDir); err != nil {
+		t.Errorf("Verification against the copy checksum failed: %v", err)
+	}
+
+	// Damage that keeps the size and mtime is still caught
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backupPath, []byte("test log c0ntent\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(backupPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFile(sourcePath, backupDir); err == nil {
+		t.Error("Verification should fail for a backup that differs from what was copied")
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	content := make([]byte, 2*constants.VerifyBufferSize+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	sourcePath := filepath.Join(tempDir, "source.log")
+	backupPath := filepath.Join(tempDir, "backup.log")
+	if err := os.WriteFile(sourcePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backupPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(sourcePath, backupPath); err != nil {
+		t.Errorf("compareFiles failed for identical files: %v", err)
+	}
+
+	// A difference past the first chunk is reported at its offset
+	offset := constants.VerifyBufferSize + 7
+	content[offset]++
+	if err := os.WriteFile(backupPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(sourcePath, backupPath); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", offset)) {
+		t.Errorf("compareFiles error = %v, want a mismatch at offset %d", err, offset)
+	}
+
+	// A backup cut short mismatches where it ends
+	if err := os.WriteFile(backupPath, content[:constants.VerifyBufferSize], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareFiles(sourcePath, backupPath); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", constants.VerifyBufferSize)) {
+		t.Errorf("compareFiles error = %v, want a mismatch at offset %d", err, constants.VerifyBufferSize)
+	}
+}
+
 func TestVerifyFile_SizeMismatch(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -234,7 +315,7 @@ func TestVerifyBackup(t *testing.T) {
 	}
 
 	// Test verification
-	err := VerifyBackup(dbInfo, backupDir, nil)
+	_, err := VerifyBackup(dbInfo, backupDir, nil)
 	if err != nil {
 		t.Errorf("VerifyBackup should succeed, got error: %v", err)
 	}
@@ -247,8 +328,161 @@ func TestVerifyBackup_UnsupportedType(t *testing.T) {
 		Name: "test",
 	}
 
-	err := VerifyBackup(dbInfo, "/tmp/backup", nil)
+	_, err := VerifyBackup(dbInfo, "/tmp/backup", nil)
 	if err == nil {
 		t.Error("VerifyBackup should fail for unsupported database type")
 	}
 }
+
+func TestVerifyBackup_GenericFile(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "config.yaml")
+	if err := os.WriteFile(sourcePath, []byte("key: value\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatalf("Failed to create backup dir: %v", err)
+	}
+	backupFile := filepath.Join(backupDir, "config.yaml")
+	if err := os.WriteFile(backupFile, []byte("key: value\n"), 0644); err != nil {
+		t.Fatalf("Failed to create backup file: %v", err)
+	}
+
+	dbInfo := types.DatabaseInfo{Path: sourcePath, Type: types.DatabaseTypeGenericFile, Name: "config.yaml"}
+	if _, err := VerifyBackup(dbInfo, backupDir, nil); err != nil {
+		t.Errorf("VerifyBackup should succeed for identical generic file, got: %v", err)
+	}
+
+	// Same size, different content must fail the checksum comparison
+	if err := os.WriteFile(backupFile, []byte("key: VALUE\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify backup file: %v", err)
+	}
+	if _, err := VerifyBackup(dbInfo, backupDir, nil); err == nil {
+		t.Error("VerifyBackup should fail when checksums differ")
+	}
+}
+
+func TestVerifyBackup_Encrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "cipher.db")
+	ciphertext := make([]byte, 4096)
+	for i := range ciphertext {
+		ciphertext[i] = byte(i*7 + i/256)
+	}
+	if err := os.WriteFile(sourcePath, ciphertext, 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	backupDir := filepath.Join(tempDir, "backup")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatalf("Failed to create backup dir: %v", err)
+	}
+	backupFile := filepath.Join(backupDir, "cipher.db")
+	if err := os.WriteFile(backupFile, ciphertext, 0644); err != nil {
+		t.Fatalf("Failed to create backup file: %v", err)
+	}
+
+	// Not a database without its key, yet the copy verifies by checksum
+	dbInfo := types.DatabaseInfo{Path: sourcePath, Type: types.DatabaseTypeSQLite, Name: "cipher.db", Encrypted: true}
+	if _, err := VerifyBackup(dbInfo, backupDir, nil); err != nil {
+		t.Errorf("VerifyBackup should succeed for an identical encrypted copy, got: %v", err)
+	}
+	if _, err := VerifySample(dbInfo, backupDir, SampleOptions{Fraction: 0.5}); err != nil {
+		t.Errorf("VerifySample should skip encrypted databases, got: %v", err)
+	}
+
+	ciphertext[100] ^= 0xff
+	if err := os.WriteFile(backupFile, ciphertext, 0644); err != nil {
+		t.Fatalf("Failed to modify backup file: %v", err)
+	}
+	if _, err := VerifyBackup(dbInfo, backupDir, nil); err == nil {
+		t.Error("VerifyBackup should fail when checksums differ")
+	}
+}
+
+func TestVerifyBlobFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "db")
+	backupPath := filepath.Join(tempDir, "backup")
+
+	blobFiles := []string{"000007.blob", filepath.Join("blob", "000003.blob")}
+	for _, dir := range []string{sourcePath, backupPath} {
+		for _, name := range blobFiles {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("blob values"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := verifyBlobFiles(sourcePath, backupPath); err != nil {
+		t.Fatalf("verifyBlobFiles failed for matching blobs: %v", err)
+	}
+
+	// Truncated blob in the backup
+	if err := os.WriteFile(filepath.Join(backupPath, blobFiles[1]), []byte("blob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBlobFiles(sourcePath, backupPath); err == nil {
+		t.Error("Expected error for blob size mismatch")
+	}
+
+	// Missing blob in the backup
+	if err := os.Remove(filepath.Join(backupPath, blobFiles[0])); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBlobFiles(sourcePath, backupPath); err == nil {
+		t.Error("Expected error for missing blob file")
+	}
+}
+
+func TestCheckSQLiteForeignKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "orders.db")
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE customers (id INTEGER PRIMARY KEY);
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers(id));
+		INSERT INTO customers (id) VALUES (1);
+		INSERT INTO orders (customer_id) VALUES (1);
+	`)
+	if err != nil {
+		db.Close()
+		t.Fatalf("Failed to populate database: %v", err)
+	}
+	db.Close()
+
+	if violations, err := CheckSQLiteForeignKeys(dbPath); err != nil || violations != "" {
+		t.Fatalf("CheckSQLiteForeignKeys = %q, %v for a consistent database", violations, err)
+	}
+
+	// Foreign keys are not enforced by default, so a dangling reference can be written
+	db, err = sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO orders (customer_id) VALUES (42)"); err != nil {
+		db.Close()
+		t.Fatalf("Failed to insert dangling reference: %v", err)
+	}
+	db.Close()
+
+	violations, err := CheckSQLiteForeignKeys(dbPath)
+	if err != nil || !strings.Contains(violations, "1 foreign key violation(s), first in table orders") {
+		t.Errorf("CheckSQLiteForeignKeys = %q, %v; want the violation described", violations, err)
+	}
+
+	// A violation is not corruption
+	if err := CheckSQLiteIntegrity(dbPath); err != nil {
+		t.Errorf("CheckSQLiteIntegrity failed for a database with a foreign key violation: %v", err)
+	}
+}